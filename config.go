@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/openfluke/tokentrove/pkg"
+	"gopkg.in/yaml.v3"
+)
+
+// parseFlags parses the flags of a command, adding -config: a YAML file of
+// flag values, such as tokentrove.yaml. Its top-level keys apply to every
+// command having a flag of that name, and those under a key named after the
+// command (process, analyze, serve, ...) to that command only, taking
+// precedence. Flags given on the command line override both.
+//
+// It also adds -log-level and -log-format and sets up the logger from them.
+func parseFlags(fs *flag.FlagSet, args []string) {
+	configPath := fs.String("config", "", "YAML file of flag values, shared by the commands (flags given here override it)")
+	logLevel := fs.String("log-level", "info", "Least severe messages logged: 'debug', 'info', 'warn' or 'error'")
+	logFormat := fs.String("log-format", pkg.LogConsole, "Log format: 'console' (for reading), 'text' (logfmt) or 'json' (one object per line)")
+	fs.Parse(args)
+	if *configPath != "" {
+		if err := applyConfig(fs, *configPath); err != nil {
+			fatalf("%v", err)
+		}
+	}
+	logger, err := pkg.NewLogger(os.Stdout, *logLevel, *logFormat)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	pkg.SetLogger(logger)
+}
+
+// applyConfig sets the flags of fs not given on the command line from the
+// config file at path
+func applyConfig(fs *flag.FlagSet, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read config: %w", err)
+	}
+	var file map[string]interface{}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("invalid config %s: %w", path, err)
+	}
+
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	values := make(map[string]string)
+	for key, v := range file {
+		if _, ok := v.(map[string]interface{}); ok || fs.Lookup(key) == nil {
+			continue // a command's section, or a flag of another command
+		}
+		s, err := configValue(v)
+		if err != nil {
+			return fmt.Errorf("config %s: %s: %w", path, key, err)
+		}
+		values[key] = s
+	}
+	if section, ok := file[fs.Name()].(map[string]interface{}); ok {
+		for name, v := range section {
+			if fs.Lookup(name) == nil {
+				return fmt.Errorf("config %s: %s has no flag -%s", path, fs.Name(), name)
+			}
+			s, err := configValue(v)
+			if err != nil {
+				return fmt.Errorf("config %s: %s.%s: %w", path, fs.Name(), name, err)
+			}
+			values[name] = s
+		}
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if given[name] || name == "config" {
+			continue
+		}
+		if err := fs.Set(name, values[name]); err != nil {
+			return fmt.Errorf("config %s: -%s: %w", path, name, err)
+		}
+	}
+	return nil
+}
+
+// configValue is a YAML value as a flag value: a scalar as written, or a
+// list joined with commas, as -stopwords and -caches take them
+func configValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			s, err := configValue(item)
+			if err != nil {
+				return "", err
+			}
+			parts[i] = s
+		}
+		return strings.Join(parts, ","), nil
+	case map[string]interface{}:
+		return "", fmt.Errorf("a flag value cannot be a mapping")
+	}
+	return fmt.Sprint(v), nil
+}
@@ -1,11 +1,18 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/openfluke/tokentrove/pkg"
+	"github.com/openfluke/tokentrove/pkg/query"
 	"github.com/openfluke/tokentrove/pkg/web"
 )
 
@@ -21,14 +28,54 @@ func main() {
 		inputDir := processCmd.String("input", "", "Input directory to process (required)")
 		outputFile := processCmd.String("output", "output.txt", "Output text file / directory")
 		processType := processCmd.String("type", "text", "Type: 'text', 'token', or 'lowercase'")
+		tokenizerSpec := processCmd.String("tokenizer", "", "How -type token/lowercase and -cache tokens split text into words: 'ascii', 'whitespace', 'unicode', 'cjk' or 'regex:PATTERN' (default: ascii for -type, white space for -cache)")
+		stem := processCmd.String("stem", "", "With -cache, index the stems of the words in this language: "+strings.Join(pkg.StemLanguages(), ", "))
 		concurrency := processCmd.Int("multi", 100, "Number of concurrent workers")
 		replace := processCmd.Bool("r", false, "Replace existing files in output")
 		ramLimitStr := processCmd.String("ram-limit", "", "Soft memory limit (e.g., '1GB', '512MB')")
+		backend := processCmd.String("backend", "text", "N-gram backend for -cache ngrams/ngramfreq: 'text' (in memory) or 'bolt' (BoltDB on disk)")
+		compress := processCmd.String("compress", "none", "With -cache, compress n-gram artifacts and fileuniqindex.txt: 'none', 'gzip' or 'zstd'")
+		shards := processCmd.Int("shards", 0, "With -cache ngrams, split each n-gram index into this many hash-partitioned shards (0 = single files)")
+		minCount := processCmd.Int("min-count", 2, "With -cache ngramfreq, keep n-grams occurring at least this many times")
+		minFiles := processCmd.Int("min-files", 1, "With -cache ngrams, keep n-grams found in at least this many files")
+		stopwordsPath := processCmd.String("stopwords", "", "With -cache ngrams/ngramfreq, skip n-grams beginning or ending with a word listed in this file or a built-in language list (en, de, ...)")
+		sentences := processCmd.Bool("sentences", false, "With -type token, write one sentence per line; with -cache ngrams/ngramfreq/skipgrams, keep n-grams within a line")
+		placeholders := processCmd.String("placeholders", "", "With -type token/lowercase, replace these with <NUM>, <DATE>, <URL> and <EMAIL>: comma-separated 'num', 'date', 'url', 'email', or 'all'")
+		positions := processCmd.Bool("positions", false, "With -cache index, also write positions.bin (word offsets per file)")
+		checkpoint := processCmd.Int("checkpoint", 10000, "Token files read between n-gram build checkpoints (0 = only after each n)")
+		dedupThreshold := processCmd.Float64("dedup-threshold", 0.8, "With -cache dedup, estimated shingle similarity (0-1) at which files are near-duplicates")
+		shingle := processCmd.Int("shingle", 5, "With -cache dedup, consecutive words per shingle")
+		normalizeSpec := processCmd.String("normalize", "fold", "With -cache normalize, how words are normalized: comma-separated 'fold', 'nfkc' and 'accents'")
 		statusOnly := processCmd.Bool("status", false, "Show remaining files to convert by file type")
-		cacheMode := processCmd.String("cache", "", "Cache mode: 'tokens', 'index', 'ngrams', or 'ngramfreq'")
+		cacheMode := processCmd.String("cache", "", "Cache mode: 'tokens', 'docs', 'index', 'ngrams', 'ngramfreq', 'tfidf', 'stats', 'skipgrams', 'collocations', 'normalize', 'dates', or 'dedup'")
 		ngramMax := processCmd.Int("ngrams", 15, "Max n-gram size")
+		useOCR := processCmd.Bool("ocr", false, "OCR images and image-only PDF pages (requires tesseract, pdftoppm)")
+		ocrLang := processCmd.String("ocr-lang", "eng", "Tesseract language(s) for OCR, e.g. 'eng+deu'")
+		structuredMode := processCmd.String("structured", "values", "JSON/YAML text: 'values', 'keys' (keys + values), or 'raw'")
+		htmlMode := processCmd.String("html", "full", "HTML text: 'full' (all text) or 'content' (main content, no menus/scripts/banners)")
+		mdCode := processCmd.String("md-code", "strip", "Markdown code blocks: 'strip', 'tag' ([code lang] ... [/code]), or 'keep'")
+		codeMode := processCmd.String("code", "comments", "Source code text: 'comments' (comments + string literals), 'identifiers' (split camelCase/snake_case), or 'raw'")
+		maxSizeStr := processCmd.String("max-size", "", "Skip files larger than this (e.g., '500MB')")
+		maxPages := processCmd.Int("max-pages", 0, "Keep at most this many pages/slides/sheets per document (0 = all)")
+		timeout := processCmd.Duration("timeout", 0, "Give up on a document after this long (e.g., '2m'; 0 = no limit)")
+		formatTimeouts := processCmd.String("format-timeouts", "", "Per-format timeouts overriding -timeout, e.g. '.pdf=5m,.csv=30s'")
+		extWorkersSpec := processCmd.String("ext-workers", "", "Workers of their own for these extensions instead of sharing -multi, e.g. '.pdf=2,.docx=4'")
+		sniff := processCmd.Bool("sniff", true, "Detect the real format from file contents when the extension is missing or wrong")
+		emailHeaders := processCmd.Bool("email-headers", true, "Include Subject/From/To/Date headers in .eml/.mbox text")
+		archives := processCmd.Bool("archives", false, "Descend into .zip/.tar/.tar.gz/.7z archives and extract each member")
+		metadata := processCmd.Bool("metadata", false, "Write a .meta.json sidecar (title, author, dates, pages, ...) next to each output")
+		perPage := processCmd.Bool("pages", false, "Write one output file per page (file.pdf.page0001.txt, ...)")
+		detectLang := processCmd.Bool("detect-lang", false, "Record each document's detected language in languages.txt")
+		langList := processCmd.String("lang", "", "Only convert documents in these languages, e.g. 'en,de' (implies -detect-lang)")
+		include := processCmd.String("include", "", "Only convert files whose path under -input matches one of these comma-separated globs, e.g. 'contracts/**/*.pdf' (** spans directories)")
+		exclude := processCmd.String("exclude", "", "Leave out files whose path under -input matches one of these comma-separated globs")
+		extList := processCmd.String("ext", "", "Only convert files with these extensions, e.g. 'pdf,docx'")
+		dryRun := processCmd.Bool("dry-run", false, "List per extension what would be converted, kept or skipped, without converting anything")
+		watch := processCmd.Bool("watch", false, "After converting, keep watching -input and convert files as they are added or modified (until Ctrl-C)")
+		watchDelay := processCmd.Duration("watch-delay", 2*time.Second, "With -watch, convert changed files once none has changed for this long")
+		watchCache := processCmd.String("watch-cache", "", "With -watch and -type token, update this cache incrementally after each batch (see analyze -incremental)")
 
-		processCmd.Parse(os.Args[2:])
+		parseFlags(processCmd, os.Args[2:])
 
 		if *inputDir == "" {
 			fmt.Println("Error: -input directory is required")
@@ -36,37 +83,101 @@ func main() {
 			os.Exit(1)
 		}
 
+		ramLimit, err := pkg.ParseMemoryLimit(*ramLimitStr)
+		if err != nil {
+			fatalf("checking RAM limit: %v", err)
+		}
+		tok, err := pkg.ParseTokenizer(*tokenizerSpec)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		pkg.SetTokenizer(tok)
+		if err := pkg.SetStemming(*stem); err != nil {
+			fatalf("%v", err)
+		}
+
+		ctx, stop := interruptContext()
+		defer stop()
+
 		// Handle cache mode
 		if *cacheMode != "" {
+			pkg.SetCacheRAMLimit(ramLimit)
+			pkg.SetCacheWorkers(*concurrency)
+			pkg.SetCheckpointInterval(*checkpoint)
+			pkg.SetIndexPositions(*positions)
+			pkg.SetCacheShards(*shards)
+			pkg.SetNgramMinCount(*minCount)
+			pkg.SetNgramMinFiles(*minFiles)
+			pkg.SetSentenceBoundaries(*sentences)
+			pkg.SetDedupThreshold(*dedupThreshold)
+			pkg.SetDedupShingle(*shingle)
+			if err := pkg.SetStopwordFile(*stopwordsPath); err != nil {
+				fatalf("%v", err)
+			}
+			if err := pkg.SetNormalization(*normalizeSpec); err != nil {
+				fatalf("%v", err)
+			}
+			if err := pkg.SetCacheBackend(*backend); err != nil {
+				fatalf("%v", err)
+			}
+			if err := pkg.SetCacheCompression(*compress); err != nil {
+				fatalf("%v", err)
+			}
 			switch *cacheMode {
 			case "tokens":
-				if err := pkg.BuildTokenCache(*inputDir, *outputFile); err != nil {
-					fmt.Printf("Error building token cache: %v\n", err)
-					os.Exit(1)
+				if err := pkg.BuildTokenCache(ctx, *inputDir, *outputFile); err != nil {
+					fatalf("building token cache: %v", err)
+				}
+			case "docs":
+				if err := pkg.BuildDocsCache(ctx, *outputFile); err != nil {
+					fatalf("building docs cache: %v", err)
 				}
 			case "index":
-				if err := pkg.BuildIndexCache(*inputDir, *outputFile); err != nil {
-					fmt.Printf("Error building index cache: %v\n", err)
-					os.Exit(1)
+				if err := pkg.BuildIndexCache(ctx, *inputDir, *outputFile); err != nil {
+					fatalf("building index cache: %v", err)
 				}
 			case "ngrams":
-				if err := pkg.BuildNgramCache(*outputFile, *ngramMax); err != nil {
-					fmt.Printf("Error building ngram cache: %v\n", err)
-					os.Exit(1)
+				if err := pkg.BuildNgramCache(ctx, *outputFile, *ngramMax); err != nil {
+					fatalf("building ngram cache: %v", err)
 				}
 			case "ngramfiles":
-				if err := pkg.BuildNgramFilesCache(*outputFile, *ngramMax); err != nil {
-					fmt.Printf("Error building ngramfiles cache: %v\n", err)
-					os.Exit(1)
+				if err := pkg.BuildNgramFilesCache(ctx, *outputFile, *ngramMax); err != nil {
+					fatalf("building ngramfiles cache: %v", err)
 				}
 			case "ngramfreq":
-				if err := pkg.BuildNgramFreqCache(*outputFile, *ngramMax); err != nil {
-					fmt.Printf("Error building ngramfreq cache: %v\n", err)
-					os.Exit(1)
+				if err := pkg.BuildNgramFreqCache(ctx, *outputFile, *ngramMax); err != nil {
+					fatalf("building ngramfreq cache: %v", err)
+				}
+			case "tfidf":
+				if err := pkg.BuildTFIDFCache(ctx, *outputFile); err != nil {
+					fatalf("building tfidf cache: %v", err)
+				}
+			case "stats":
+				if err := pkg.BuildStatsCache(ctx, *outputFile); err != nil {
+					fatalf("building stats cache: %v", err)
+				}
+			case "skipgrams":
+				if err := pkg.BuildSkipgramCache(ctx, *outputFile, *ngramMax); err != nil {
+					fatalf("building skipgrams cache: %v", err)
+				}
+			case "collocations":
+				if err := pkg.BuildCollocationCache(ctx, *outputFile, *ngramMax); err != nil {
+					fatalf("building collocations cache: %v", err)
+				}
+			case "normalize":
+				if err := pkg.BuildNormalizedVocab(ctx, *outputFile); err != nil {
+					fatalf("building normalize cache: %v", err)
+				}
+			case "dates":
+				if err := pkg.BuildDatesCache(ctx, *outputFile); err != nil {
+					fatalf("building dates cache: %v", err)
+				}
+			case "dedup":
+				if err := pkg.BuildDedupCache(ctx, *outputFile); err != nil {
+					fatalf("building dedup cache: %v", err)
 				}
 			default:
-				fmt.Printf("Unknown cache mode: %s (use 'tokens', 'index', 'ngrams', 'ngramfiles', or 'ngramfreq')\n", *cacheMode)
-				os.Exit(1)
+				fatalf("unknown cache mode: %s (use 'tokens', 'docs', 'index', 'ngrams', 'ngramfiles', 'ngramfreq', 'tfidf', 'stats', 'skipgrams', 'collocations', 'normalize', 'dates', or 'dedup')", *cacheMode)
 			}
 			return
 		}
@@ -74,23 +185,108 @@ func main() {
 		// Handle status mode
 		if *statusOnly {
 			if err := pkg.ShowStatus(*inputDir, *outputFile); err != nil {
-				fmt.Printf("Error getting status: %v\n", err)
-				os.Exit(1)
+				fatalf("getting status: %v", err)
 			}
 			return
 		}
 
-		ramLimit, err := pkg.ParseMemoryLimit(*ramLimitStr)
+		pkg.SetEmailHeaders(*emailHeaders)
+		pkg.SetContentSniffing(*sniff)
+		if err := pkg.SetStructuredMode(*structuredMode); err != nil {
+			fatalf("%v", err)
+		}
+		if err := pkg.SetHTMLMode(*htmlMode); err != nil {
+			fatalf("%v", err)
+		}
+		if err := pkg.SetMarkdownCodeMode(*mdCode); err != nil {
+			fatalf("%v", err)
+		}
+		if err := pkg.SetCodeMode(*codeMode); err != nil {
+			fatalf("%v", err)
+		}
+
+		maxSize, err := pkg.ParseMemoryLimit(*maxSizeStr)
 		if err != nil {
-			fmt.Printf("Error checking RAM limit: %v\n", err)
-			os.Exit(1)
+			fatalf("checking max size: %v", err)
 		}
+		perFormat, err := pkg.ParseFormatTimeouts(*formatTimeouts)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		extWorkers, err := pkg.ParseExtWorkers(*extWorkersSpec)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		placeholderKinds, err := pkg.ParsePlaceholders(*placeholders)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		pkg.SetExtractOptions(pkg.ExtractOptions{
+			MaxFileSize:    int64(maxSize),
+			MaxPages:       *maxPages,
+			Timeout:        *timeout,
+			FormatTimeouts: perFormat,
+		})
 
-		fmt.Printf("Starting process (Type: %s, Workers: %d, Replace: %v, RAM Limit: %s)...\n", *processType, *concurrency, *replace, *ramLimitStr)
+		if *useOCR {
+			ocr, err := pkg.NewTesseractOCR(*ocrLang)
+			if err != nil {
+				fatalf("enabling OCR: %v", err)
+			}
+			pkg.SetOCRBackend(ocr)
+		}
 
-		if err := pkg.RunProcess(*inputDir, *outputFile, *processType, *concurrency, *replace, ramLimit); err != nil {
-			fmt.Printf("Error processing files: %v\n", err)
-			os.Exit(1)
+		opts := pkg.ProcessOptions{
+			ProcessType:  *processType,
+			Workers:      *concurrency,
+			Replace:      *replace,
+			RAMLimit:     ramLimit,
+			Archives:     *archives,
+			Pages:        *perPage,
+			Metadata:     *metadata,
+			Sentences:    *sentences,
+			Placeholders: placeholderKinds,
+
+			DetectLanguage: *detectLang,
+			Languages:      splitList(*langList),
+
+			Include: splitList(*include),
+			Exclude: splitList(*exclude),
+			Exts:    splitList(*extList),
+
+			ExtWorkers: extWorkers,
+		}
+		if *dryRun {
+			report, err := pkg.DryRun(*inputDir, *outputFile, opts)
+			if err != nil {
+				fatalf("dry run: %v", err)
+			}
+			report.Print(os.Stdout)
+			return
+		}
+
+		if *watchCache != "" && !*watch {
+			fatalf("-watch-cache needs -watch")
+		}
+
+		pkg.Logger().Info("Starting process", "type", *processType, "workers", *concurrency, "replace", *replace, "ramLimit", *ramLimitStr)
+		if *watch {
+			var after func() error
+			if *watchCache != "" {
+				pkg.SetCacheRAMLimit(ramLimit)
+				after = func() error { return pkg.UpdateCache(ctx, *outputFile, *watchCache, *ngramMax) }
+			}
+			if err := pkg.WatchProcess(ctx, *inputDir, *outputFile, opts, *watchDelay, after); err != nil {
+				fatalf("watching files: %v", err)
+			}
+			return
+		}
+		if err := pkg.RunProcess(ctx, *inputDir, *outputFile, opts); err != nil {
+			if ctx.Err() != nil {
+				// Stopped by a signal, after logging its summary
+				os.Exit(130)
+			}
+			fatalf("processing files: %v", err)
 		}
 
 	case "analyze":
@@ -101,8 +297,32 @@ func main() {
 		ngramMax := analyzeCmd.Int("ngrams", 15, "Max n-gram size for frequency analysis")
 		host := analyzeCmd.Bool("host", false, "Start web server to browse cache")
 		port := analyzeCmd.Int("port", 3000, "Web server port (used with -host)")
+		reportWorkers := analyzeCmd.Int("report-workers", 2, "Reports generated at once (used with -host)")
+		reportQueue := analyzeCmd.Int("report-queue", 100, "Reports that can wait for a worker (used with -host)")
+		grpcPort := analyzeCmd.Int("grpc-port", 0, "Also serve the gRPC API on this port (0 = off; used with -host)")
+		reloadDelay := analyzeCmd.Duration("reload-delay", 5*time.Second, "Reload the cache once its files stop changing for this long, e.g. after a rebuild (0 = never; used with -host)")
+		ngramCache := analyzeCmd.Int("ngram-cache", 10000, "Most frequent n-grams of each size the web server keeps in memory (used with -host)")
+		maxReports := analyzeCmd.Int("max-reports", 0, "Keep only this many of the newest reports (0 = all; used with -host)")
+		maxReportAge := analyzeCmd.Duration("max-report-age", 0, "Delete reports older than this, e.g. '168h' (0 = never; used with -host)")
+		maxReportSize := analyzeCmd.String("max-report-size", "", "Delete the oldest reports beyond this total size, e.g. '500MB' (used with -host)")
+		ramLimitStr := analyzeCmd.String("ram-limit", "", "Soft memory limit; n-gram counts spill to disk above it (e.g., '1GB', '512MB')")
+		workers := analyzeCmd.Int("multi", runtime.NumCPU(), "Number of workers reading token files")
+		backend := analyzeCmd.String("backend", "text", "N-gram backend: 'text' (in memory) or 'bolt' (BoltDB on disk, for n-gram sets larger than RAM)")
+		compress := analyzeCmd.String("compress", "none", "Compress n-gram artifacts and fileuniqindex.txt: 'none', 'gzip' or 'zstd'")
+		shards := analyzeCmd.Int("shards", 0, "Split each n-gram index into this many hash-partitioned shards (0 = single files)")
+		minCount := analyzeCmd.Int("min-count", 2, "Keep n-grams occurring at least this many times in the frequency files")
+		minFiles := analyzeCmd.Int("min-files", 1, "Keep n-grams found in at least this many files in the n-gram index")
+		stopwordsPath := analyzeCmd.String("stopwords", "", "Skip n-grams beginning or ending with a word listed in this file (one per line) or a built-in language list (en, de, ...)")
+		sentences := analyzeCmd.Bool("sentences", false, "Keep n-grams within sentences (lines of token files written with process -sentences)")
+		tokenizerSpec := analyzeCmd.String("tokenizer", "", "Split the lines of the token files into words with 'ascii', 'whitespace', 'unicode', 'cjk' or 'regex:PATTERN' (default: at white space)")
+		stem := analyzeCmd.String("stem", "", "Index the stems of the words in this language, keeping the words of each stem in stemforms.txt: "+strings.Join(pkg.StemLanguages(), ", "))
+		positions := analyzeCmd.Bool("positions", false, "Also write positions.bin (word offsets per file) for phrase and proximity queries")
+		checkpoint := analyzeCmd.Int("checkpoint", 10000, "Token files read between n-gram build checkpoints (0 = only after each n)")
+		incremental := analyzeCmd.Bool("incremental", false, "Only re-tokenize added/changed files and merge them into the existing cache")
+		resume := analyzeCmd.Bool("resume", false, "Skip the steps the cache manifest shows complete and current for this input and -ngrams")
+		skip := analyzeCmd.String("skip", "", "Skip these steps, comma-separated: "+strings.Join(pkg.AnalyzeSteps, ", "))
 
-		analyzeCmd.Parse(os.Args[2:])
+		parseFlags(analyzeCmd, os.Args[2:])
 
 		if *inputDir == "" || *outputDir == "" {
 			fmt.Println("Error: -input and -output are required")
@@ -112,17 +332,66 @@ func main() {
 
 		// If hosting, start web server
 		if *host {
+			useCacheTokenizer(*outputDir)
+			web.SetReportWorkers(*reportWorkers)
+			web.SetReportQueueSize(*reportQueue)
+			web.SetGRPCPort(*grpcPort)
+			web.SetReloadDelay(*reloadDelay)
+			web.SetNgramCacheSize(*ngramCache)
+			if err := setReportRetention(*maxReports, *maxReportAge, *maxReportSize); err != nil {
+				fatalf("%v", err)
+			}
 			if err := web.StartServer(*outputDir, *reportsDir, *ngramMax, *port); err != nil {
-				fmt.Printf("Error starting web server: %v\n", err)
-				os.Exit(1)
+				fatalf("starting web server: %v", err)
 			}
 			return
 		}
 
 		// Otherwise run analysis
-		if err := pkg.Analyze(*inputDir, *outputDir, *ngramMax); err != nil {
-			fmt.Printf("Error during analysis: %v\n", err)
-			os.Exit(1)
+		ctx, stop := interruptContext()
+		defer stop()
+		ramLimit, err := pkg.ParseMemoryLimit(*ramLimitStr)
+		if err != nil {
+			fatalf("checking RAM limit: %v", err)
+		}
+		tok, err := pkg.ParseTokenizer(*tokenizerSpec)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		pkg.SetTokenizer(tok)
+		if err := pkg.SetStemming(*stem); err != nil {
+			fatalf("%v", err)
+		}
+		pkg.SetCacheRAMLimit(ramLimit)
+		pkg.SetCacheWorkers(*workers)
+		pkg.SetCheckpointInterval(*checkpoint)
+		pkg.SetIndexPositions(*positions)
+		pkg.SetCacheShards(*shards)
+		pkg.SetNgramMinCount(*minCount)
+		pkg.SetNgramMinFiles(*minFiles)
+		pkg.SetSentenceBoundaries(*sentences)
+		if err := pkg.SetStopwordFile(*stopwordsPath); err != nil {
+			fatalf("%v", err)
+		}
+		if err := pkg.SetCacheBackend(*backend); err != nil {
+			fatalf("%v", err)
+		}
+		if err := pkg.SetCacheCompression(*compress); err != nil {
+			fatalf("%v", err)
+		}
+		if err := pkg.SetAnalyzeSkip(*skip); err != nil {
+			fatalf("%v", err)
+		}
+		pkg.SetAnalyzeResume(*resume)
+
+		if *incremental {
+			if err := pkg.UpdateCache(ctx, *inputDir, *outputDir, *ngramMax); err != nil {
+				fatalf("incremental update: %v", err)
+			}
+			return
+		}
+		if err := pkg.Analyze(ctx, *inputDir, *outputDir, *ngramMax); err != nil {
+			fatalf("analysis: %v", err)
 		}
 
 	case "ngramfiles":
@@ -130,7 +399,7 @@ func main() {
 		cacheDir := ngramfilesCmd.String("cache", "", "Cache directory containing ngram files (required)")
 		ngramMax := ngramfilesCmd.Int("ngrams", 15, "Max n-gram size")
 
-		ngramfilesCmd.Parse(os.Args[2:])
+		parseFlags(ngramfilesCmd, os.Args[2:])
 
 		if *cacheDir == "" {
 			fmt.Println("Error: -cache directory is required")
@@ -138,22 +407,343 @@ func main() {
 			os.Exit(1)
 		}
 
-		if err := pkg.BuildNgramFilesCache(*cacheDir, *ngramMax); err != nil {
-			fmt.Printf("Error building ngramfiles cache: %v\n", err)
+		ctx, stop := interruptContext()
+		defer stop()
+		if err := pkg.BuildNgramFilesCache(ctx, *cacheDir, *ngramMax); err != nil {
+			fatalf("building ngramfiles cache: %v", err)
+		}
+
+	case "compact":
+		compactCmd := flag.NewFlagSet("compact", flag.ExitOnError)
+		cacheDir := compactCmd.String("cache", "", "Cache directory to compact (required)")
+
+		parseFlags(compactCmd, os.Args[2:])
+
+		if *cacheDir == "" {
+			fmt.Println("Error: -cache directory is required")
+			compactCmd.PrintDefaults()
+			os.Exit(1)
+		}
+
+		ctx, stop := interruptContext()
+		defer stop()
+		if err := pkg.CompactCache(ctx, *cacheDir); err != nil {
+			fatalf("compacting cache: %v", err)
+		}
+
+	case "merge":
+		mergeCmd := flag.NewFlagSet("merge", flag.ExitOnError)
+		outputDir := mergeCmd.String("out", "", "Directory to write the merged cache to (required)")
+		compress := mergeCmd.String("compress", "none", "Compress n-gram artifacts and fileuniqindex.txt: 'none', 'gzip' or 'zstd'")
+		shards := mergeCmd.Int("shards", 0, "Split each n-gram index into this many hash-partitioned shards (0 = single files)")
+
+		parseFlags(mergeCmd, os.Args[2:])
+
+		if *outputDir == "" || mergeCmd.NArg() < 2 {
+			fmt.Println("Usage: tokentrove merge -out DIR CACHE CACHE...")
+			mergeCmd.PrintDefaults()
+			os.Exit(1)
+		}
+		if err := pkg.SetCacheCompression(*compress); err != nil {
+			fatalf("%v", err)
+		}
+		pkg.SetCacheShards(*shards)
+
+		ctx, stop := interruptContext()
+		defer stop()
+		if err := pkg.MergeCaches(ctx, *outputDir, mergeCmd.Args()); err != nil {
+			fatalf("merging caches: %v", err)
+		}
+
+	case "diff":
+		diffCmd := flag.NewFlagSet("diff", flag.ExitOnError)
+		top := diffCmd.Int("top", 20, "Words, files and n-grams to list per section (0 = all)")
+		ngramMax := diffCmd.Int("ngrams", 0, "Max n-gram size to compare (0 = every size both caches have)")
+
+		parseFlags(diffCmd, os.Args[2:])
+
+		if diffCmd.NArg() != 2 {
+			fmt.Println("Usage: tokentrove diff [-top 20] [-ngrams N] OLD_CACHE NEW_CACHE")
+			diffCmd.PrintDefaults()
+			os.Exit(1)
+		}
+
+		d, err := pkg.DiffCaches(diffCmd.Arg(0), diffCmd.Arg(1), *ngramMax, *top)
+		if err != nil {
+			fatalf("comparing caches: %v", err)
+		}
+		d.Print(os.Stdout, *top)
+
+	case "serve":
+		serveCmd := flag.NewFlagSet("serve", flag.ExitOnError)
+		cacheDir := serveCmd.String("cache", "", "Cache directory to serve (required)")
+		caches := serveCmd.String("caches", "", "More caches to serve, as comma-separated name=dir pairs, e.g. 'legal=/data/legal,hr=/data/hr'")
+		reportsDir := serveCmd.String("reports", "", "Reports output directory")
+		ngramMax := serveCmd.Int("ngrams", 0, "Max n-gram size to serve (0 = every size the cache has)")
+		port := serveCmd.Int("port", 3000, "Web server port")
+		bind := serveCmd.String("bind", "", "Address to listen on, e.g. '127.0.0.1' (default: all interfaces)")
+		tlsCert := serveCmd.String("tls-cert", "", "PEM certificate file; serve HTTPS (with -tls-key)")
+		tlsKey := serveCmd.String("tls-key", "", "PEM private key file for -tls-cert")
+		reportWorkers := serveCmd.Int("report-workers", 2, "Reports generated at once")
+		reportQueue := serveCmd.Int("report-queue", 100, "Reports that can wait for a worker; more are refused")
+		grpcPort := serveCmd.Int("grpc-port", 0, "Also serve the gRPC API on this port (0 = off)")
+		reloadDelay := serveCmd.Duration("reload-delay", 5*time.Second, "Reload a cache once its files stop changing for this long, e.g. after a rebuild (0 = never)")
+		ngramCache := serveCmd.Int("ngram-cache", 10000, "Most frequent n-grams of each size kept in memory")
+		maxReports := serveCmd.Int("max-reports", 0, "Keep only this many of the newest reports (0 = all)")
+		maxReportAge := serveCmd.Duration("max-report-age", 0, "Delete reports older than this, e.g. '168h' (0 = never)")
+		maxReportSize := serveCmd.String("max-report-size", "", "Delete the oldest reports beyond this total size, e.g. '500MB'")
+
+		parseFlags(serveCmd, os.Args[2:])
+
+		if *cacheDir == "" {
+			fmt.Println("Error: -cache directory is required")
+			serveCmd.PrintDefaults()
+			os.Exit(1)
+		}
+
+		if err := addCaches(*caches); err != nil {
+			fatalf("%v", err)
+		}
+		useCacheTokenizer(*cacheDir)
+		web.SetBindAddress(*bind)
+		web.SetReportWorkers(*reportWorkers)
+		web.SetReportQueueSize(*reportQueue)
+		web.SetGRPCPort(*grpcPort)
+		web.SetReloadDelay(*reloadDelay)
+		web.SetNgramCacheSize(*ngramCache)
+		if err := setReportRetention(*maxReports, *maxReportAge, *maxReportSize); err != nil {
+			fatalf("%v", err)
+		}
+		if err := web.SetTLS(*tlsCert, *tlsKey); err != nil {
+			fatalf("%v", err)
+		}
+		if err := web.StartServer(*cacheDir, *reportsDir, *ngramMax, *port); err != nil {
+			fatalf("starting web server: %v", err)
+		}
+
+	case "query":
+		queryCmd := flag.NewFlagSet("query", flag.ExitOnError)
+		cacheDir := queryCmd.String("cache", "", "Cache directory to search (required)")
+		limit := queryCmd.Int("limit", 20, "Matching files to list (0 = all)")
+		snippets := queryCmd.Bool("snippets", false, "Show the words around each file's first match, the match in [brackets]")
+		pathGlob := queryCmd.String("path", "", "Only files whose path matches this glob (** spans directories), e.g. 'reports/2023/**'")
+		exts := queryCmd.String("ext", "", "Only files converted from these comma-separated extensions, e.g. '.pdf,.docx'")
+		stopwordsSpec := queryCmd.String("stopwords", "", "Leave these stopwords out of the query: a built-in language list (en, de, ...) or a file")
+		normalize := queryCmd.Bool("normalize", false, "Match every spelling of the query's words that normalizes alike, e.g. Invoice and INVOICE (needs -cache normalize)")
+		phrase := queryCmd.Bool("phrase", false, "Look the arguments up as one phrase, split into words as process -type token splits them, instead of as a query")
+
+		parseFlags(queryCmd, os.Args[2:])
+
+		if *cacheDir == "" || queryCmd.NArg() == 0 {
+			fmt.Println(`Usage: tokentrove query -cache DIR [-limit 20] [-snippets] [-path GLOB] [-ext .pdf] [-stopwords en] [-normalize] 'word "a phrase" OR (other NOT excluded)'`)
+			fmt.Println(`       tokentrove query -cache DIR -phrase [flags] 'some phrase'`)
+			queryCmd.PrintDefaults()
 			os.Exit(1)
 		}
 
+		ix, err := query.Open(*cacheDir)
+		if err != nil {
+			fatalf("opening cache: %v", err)
+		}
+		pkg.SetTokenizer(ix.Tokenizer())
+		q := strings.Join(queryCmd.Args(), " ")
+		if *phrase {
+			node := query.PhraseQuery(q)
+			if node == nil {
+				fatalf("no words in %q", q)
+			}
+			q = node.String()
+		}
+		if *stopwordsSpec != "" {
+			stop, err := pkg.LoadStopwords(*stopwordsSpec)
+			if err != nil {
+				fatalf("%v", err)
+			}
+			if node, err := query.Parse(q); err == nil {
+				q = query.WithoutStopwords(node, func(w string) bool { return stop[w] }).String()
+			}
+		}
+		if *normalize {
+			node, err := query.Parse(q)
+			if err == nil {
+				node, err = ix.Normalize(node)
+			}
+			if err != nil {
+				fatalf("%v", err)
+			}
+			q = node.String()
+		}
+		results, err := ix.Search(q)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		if *pathGlob != "" || *exts != "" {
+			files, err := pkg.FilterFiles(*cacheDir, *pathGlob, *exts)
+			if err != nil {
+				fatalf("%v", err)
+			}
+			kept := results[:0]
+			for _, r := range results {
+				if files.Contains(uint32(r.Index)) {
+					kept = append(kept, r)
+				}
+			}
+			results = kept
+		}
+		if *phrase && ix.CountsHits() {
+			total := 0
+			for _, r := range results {
+				total += r.Hits
+			}
+			fmt.Printf("%d matching files, %d occurrences\n", len(results), total)
+		} else {
+			fmt.Printf("%d matching files\n", len(results))
+		}
+		for i, r := range results {
+			if *limit > 0 && i >= *limit {
+				fmt.Printf("... and %d more\n", len(results)-i)
+				break
+			}
+			fmt.Printf("%6d  %s\n", r.Hits, r.File)
+			if *snippets {
+				if e, _ := ix.Excerpt(r.Index, q, 30); e != nil && e.Match != "" {
+					fmt.Printf("        %s\n", strings.TrimSpace(e.Before+" ["+e.Match+"] "+e.After))
+				}
+			}
+		}
+		ix.Close()
+
+	case "export":
+		exportCmd := flag.NewFlagSet("export", flag.ExitOnError)
+		cacheDir := exportCmd.String("cache", "", "Cache directory to export (required)")
+		what := exportCmd.String("what", pkg.ExportVocab, "What to export: 'vocab' (words with files and occurrences), 'ngrams' (n-gram counts) or 'postings' (files of each word)")
+		format := exportCmd.String("format", pkg.ExportCSV, "Output format: 'csv', 'json' or 'jsonl' (one object per line)")
+		ngramMax := exportCmd.Int("ngrams", 0, "With -what ngrams, max n-gram size (0 = every size the cache has)")
+		outPath := exportCmd.String("out", "", "File to write (default: standard output)")
+
+		parseFlags(exportCmd, os.Args[2:])
+
+		if *cacheDir == "" {
+			fmt.Println("Usage: tokentrove export -cache DIR [-what vocab|ngrams|postings] [-format csv|json|jsonl] [-out FILE]")
+			exportCmd.PrintDefaults()
+			os.Exit(1)
+		}
+
+		out := os.Stdout
+		if *outPath != "" {
+			f, err := os.Create(*outPath)
+			if err != nil {
+				fatalf("%v", err)
+			}
+			out = f
+		}
+		if err := pkg.Export(out, *cacheDir, *what, *format, *ngramMax); err != nil {
+			if *outPath != "" {
+				out.Close()
+				os.Remove(*outPath)
+			}
+			fatalf("exporting: %v", err)
+		}
+		if err := out.Close(); err != nil {
+			fatalf("exporting: %v", err)
+		}
+
 	default:
 		printUsage()
 		os.Exit(1)
 	}
 }
 
+// setReportRetention applies the web server's report retention flags
+func setReportRetention(maxCount int, maxAge time.Duration, maxSize string) error {
+	maxBytes, err := pkg.ParseMemoryLimit(maxSize)
+	if err != nil {
+		return fmt.Errorf("invalid -max-report-size: %w", err)
+	}
+	web.SetReportRetention(maxCount, maxAge, int64(maxBytes))
+	return nil
+}
+
+// addCaches registers the name=dir pairs of -caches with the web server
+func addCaches(spec string) error {
+	if spec == "" {
+		return nil
+	}
+	for _, pair := range strings.Split(spec, ",") {
+		name, dir, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || dir == "" {
+			return fmt.Errorf("invalid -caches entry %q (use name=dir)", pair)
+		}
+		if err := web.AddCache(name, dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// useCacheTokenizer splits queries and prompts with the tokenizer the cache
+// in dir was built with, and stems them if it was stemmed
+func useCacheTokenizer(dir string) {
+	tok, err := pkg.CacheTokenizer(dir)
+	if err != nil {
+		pkg.Logger().Warn("Could not read the cache's tokenizer; using the default", "dir", dir, "error", err)
+	}
+	pkg.SetTokenizer(tok)
+	if st, err := pkg.CacheStemmer(dir); err == nil && st != nil {
+		pkg.SetStemming(st.Language())
+	}
+}
+
+// splitList splits a comma-separated flag value, dropping empty items
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// interruptContext returns a context done on Ctrl-C or SIGTERM, on which
+// builds and processing stop where they can resume from. Only the first
+// signal is caught, so a second one kills a command slow to stop.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case s := <-sig:
+			signal.Stop(sig)
+			pkg.Logger().Warn("Stopping; interrupt again to quit at once", "signal", s)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(sig)
+		cancel()
+	}
+}
+
+// fatalf logs an error and exits
+func fatalf(format string, args ...any) {
+	pkg.Logger().Error(fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
+
 func printUsage() {
 	fmt.Println("Usage: tokentrove <command> [arguments]")
 	fmt.Println("\nCommands:")
 	fmt.Println("  process      Process a directory and extract text from all supported files")
 	fmt.Println("  analyze      Run all analysis steps (tokens, index, ngramfreq) in one command")
 	fmt.Println("  ngramfiles   Build file → ngram reverse index from existing ngram cache")
+	fmt.Println("  compact      Drop deleted files and unused words from a cache and renumber it")
+	fmt.Println("  merge        Combine caches built from different token directories into one")
+	fmt.Println("  diff         Compare two caches: vocabulary, files and n-gram frequency changes")
+	fmt.Println("  query        Search a cache with AND/OR/NOT and quoted phrases")
+	fmt.Println("  export       Write a cache's vocabulary, n-grams or postings as CSV, JSON or JSON lines")
+	fmt.Println("  serve        Browse a cache and generate reports in the web interface")
 	fmt.Println("\nRun 'tokentrove <command> -h' for more information.")
 }
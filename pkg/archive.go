@@ -0,0 +1,235 @@
+package pkg
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// maxArchiveDepth limits how far nested archives (zip inside tar, ...) are followed
+const maxArchiveDepth = 4
+
+// archiveKind returns the archive type of path, or "" if it is not an archive
+func archiveKind(path string) string {
+	lower := strings.ToLower(filepath.Base(path))
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return "zip"
+	case strings.HasSuffix(lower, ".tar"):
+		return "tar"
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return "tar.gz"
+	case strings.HasSuffix(lower, ".tar.bz2"), strings.HasSuffix(lower, ".tbz2"):
+		return "tar.bz2"
+	case strings.HasSuffix(lower, ".7z"):
+		return "7z"
+	}
+	return ""
+}
+
+// processArchive extracts every supported member of an archive, writing
+// each one to outBase/<member path>.txt (outBase is the archive's own output path).
+// label names the archive in the logs: its path, or for a nested archive
+// unpacked to a temp file the path inside the outer one (outer.zip/inner.tar.gz).
+func processArchive(path, label, outBase string, opts ProcessOptions, depth int, logs runLogs) {
+	var err error
+	switch archiveKind(path) {
+	case "zip":
+		err = walkZip(path, label, outBase, opts, depth, logs)
+	case "tar", "tar.gz", "tar.bz2":
+		err = walkTar(path, label, outBase, opts, depth, logs)
+	case "7z":
+		err = walk7z(path, label, outBase, opts, depth, logs)
+	}
+	if err != nil {
+		logs.fail(label, fmt.Errorf("archive error: %w", err))
+	}
+}
+
+func walkZip(path, label, outBase string, opts ProcessOptions, depth int, logs runLogs) error {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			logs.fail(label+"/"+f.Name, fmt.Errorf("open member: %w", err))
+			continue
+		}
+		processArchiveMember(label, f.Name, rc, outBase, opts, depth, logs)
+		rc.Close()
+	}
+	return nil
+}
+
+func walkTar(path, label, outBase string, opts ProcessOptions, depth int, logs runLogs) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	switch archiveKind(path) {
+	case "tar.gz":
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	case "tar.bz2":
+		r = bzip2.NewReader(f)
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		processArchiveMember(label, hdr.Name, tr, outBase, opts, depth, logs)
+	}
+}
+
+// walk7z unpacks the archive with the 7z CLI into a temp dir, then walks it
+func walk7z(path, label, outBase string, opts ProcessOptions, depth int, logs runLogs) error {
+	bin, err := exec.LookPath("7z")
+	if err != nil {
+		return fmt.Errorf("7z not found in PATH: %w", err)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "tokentrove-7z-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cmd := exec.Command(bin, "x", "-y", "-o"+tmpDir, path)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("7z: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return filepath.Walk(tmpDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		name, err := filepath.Rel(tmpDir, p)
+		if err != nil {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			logs.fail(label+"/"+name, fmt.Errorf("open member: %w", err))
+			return nil
+		}
+		processArchiveMember(label, filepath.ToSlash(name), f, outBase, opts, depth, logs)
+		f.Close()
+		return nil
+	})
+}
+
+// processArchiveMember converts a single member in memory, or descends into it
+// if it is itself an archive (nested archives are unpacked to a temp file).
+// archiveLabel names the archive holding it, as processArchive's label.
+func processArchiveMember(archiveLabel, name string, r io.Reader, outBase string, opts ProcessOptions, depth int, logs runLogs) {
+	label := archiveLabel + "/" + name
+
+	memberPath, ok := safeMemberPath(name)
+	if !ok {
+		logs.fail(label, errors.New("unsafe member path"))
+		return
+	}
+	if strings.HasPrefix(filepath.Base(memberPath), ".") {
+		return
+	}
+
+	kind := archiveKind(memberPath)
+	if kind == "" {
+		memberOut := filepath.Join(outBase, memberPath)
+		if !opts.Replace && outputExists(memberOut, opts) {
+			return
+		}
+		res, err := ExtractContentFromReader(r, filepath.Ext(memberPath))
+		if err != nil {
+			logExtractError(label, err, logs)
+			return
+		}
+		writeOutput(res, label, nil, memberOut, opts, logs)
+		return
+	}
+
+	if depth >= maxArchiveDepth {
+		logs.ignore(label, "nested archive too deep")
+		return
+	}
+
+	// Keep the archive suffix on the temp file so archiveKind recognizes it
+	tmp, err := os.CreateTemp("", "tokentrove-nested-*."+kind)
+	if err != nil {
+		logs.fail(label, fmt.Errorf("temp file error: %w", err))
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	// The size limit of any input holds before the copy, so one huge nested
+	// member cannot fill the disk
+	limits := extractOptions
+	src := r
+	if limits.MaxFileSize > 0 {
+		src = io.LimitReader(r, limits.MaxFileSize+1)
+	}
+	n, err := io.Copy(tmp, src)
+	tmp.Close()
+	if err == nil {
+		err = limits.checkFileSize(n)
+	}
+	if errors.Is(err, ErrTooLarge) {
+		logs.ignore(label, err.Error())
+		return
+	}
+	if err != nil {
+		logs.fail(label, fmt.Errorf("read member: %w", err))
+		return
+	}
+
+	processArchive(tmp.Name(), label, filepath.Join(outBase, memberPath), opts, depth+1, logs)
+}
+
+// safeMemberPath cleans an archive member name and rejects absolute paths or
+// ".." components that would escape the output directory
+func safeMemberPath(name string) (string, bool) {
+	cleaned := filepath.Clean(filepath.FromSlash(strings.TrimLeft(name, "/\\")))
+	if cleaned == "." || filepath.IsAbs(cleaned) {
+		return "", false
+	}
+	for _, part := range strings.Split(filepath.ToSlash(cleaned), "/") {
+		if part == ".." {
+			return "", false
+		}
+	}
+	return cleaned, true
+}
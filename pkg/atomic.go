@@ -0,0 +1,138 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// tmpSuffix marks a cache file that is still being written. Builders write to
+// path+tmpSuffix and rename it over path once it is complete, so a crash
+// leaves the previous version (or nothing) instead of a truncated file.
+const tmpSuffix = ".tmp"
+
+// ErrTruncated is returned when a binary cache file is shorter than its
+// header says, which only happens to files written before writes were atomic
+var ErrTruncated = errors.New("truncated cache file")
+
+// atomicFile is a file written under a temporary name and renamed into place
+// by Close. Abort, a failed write or a failed close discards it instead.
+type atomicFile struct {
+	f        *os.File
+	path     string
+	replaces []string // removed once the file is in place
+	err      error    // first write error
+	done     bool
+}
+
+// createAtomic starts writing path under its temporary name
+func createAtomic(path string) (*atomicFile, error) {
+	f, err := os.Create(path + tmpSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("could not create %s: %w", path, err)
+	}
+	return &atomicFile{f: f, path: path}, nil
+}
+
+func (a *atomicFile) Write(p []byte) (int, error) {
+	n, err := a.f.Write(p)
+	if err != nil && a.err == nil {
+		a.err = err
+	}
+	return n, err
+}
+
+// WriteAt is for files whose header is filled in last
+func (a *atomicFile) WriteAt(p []byte, off int64) (int, error) {
+	n, err := a.f.WriteAt(p, off)
+	if err != nil && a.err == nil {
+		a.err = err
+	}
+	return n, err
+}
+
+func (a *atomicFile) Seek(offset int64, whence int) (int64, error) {
+	return a.f.Seek(offset, whence)
+}
+
+// Close renames the file into place, unless a write failed. Calling it
+// again, or after Abort, does nothing.
+func (a *atomicFile) Close() error {
+	if a.done {
+		return nil
+	}
+	a.done = true
+	err := a.err
+	if cerr := a.f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(a.f.Name())
+		return fmt.Errorf("could not write %s: %w", a.path, err)
+	}
+	if err := os.Rename(a.f.Name(), a.path); err != nil {
+		os.Remove(a.f.Name())
+		return err
+	}
+	for _, path := range a.replaces {
+		os.Remove(path)
+	}
+	return nil
+}
+
+// Abort discards the file, leaving any previous version in place. It does
+// nothing after Close, so it can be deferred.
+func (a *atomicFile) Abort() {
+	if a.done {
+		return
+	}
+	a.done = true
+	a.f.Close()
+	os.Remove(a.f.Name())
+}
+
+// writeFileAtomic is os.WriteFile through a temporary file
+func writeFileAtomic(path string, data []byte) error {
+	a, err := createAtomic(path)
+	if err != nil {
+		return err
+	}
+	if _, err := a.Write(data); err != nil {
+		a.Abort()
+		return fmt.Errorf("could not write %s: %w", path, err)
+	}
+	return a.Close()
+}
+
+// PartialArtifacts lists the temporary files in a cache directory and its
+// docs/ subdirectory, relative to cacheDir. Each is a write that was
+// interrupted; the artifact it was replacing, if any, is still the previous
+// complete version.
+func PartialArtifacts(cacheDir string) []string {
+	var partial []string
+	for _, dir := range []string{cacheDir, filepath.Join(cacheDir, docsDirName)} {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if !e.IsDir() && strings.HasSuffix(e.Name(), tmpSuffix) {
+				rel, _ := filepath.Rel(cacheDir, filepath.Join(dir, e.Name()))
+				partial = append(partial, rel)
+			}
+		}
+	}
+	sort.Strings(partial)
+	return partial
+}
+
+// removePartialArtifacts deletes the leftovers of interrupted writes. Steps
+// run one at a time, so when one begins no other write is in flight.
+func removePartialArtifacts(cacheDir string) {
+	for _, name := range PartialArtifacts(cacheDir) {
+		os.Remove(filepath.Join(cacheDir, name))
+	}
+}
@@ -0,0 +1,131 @@
+package pkg
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/RoaringBitmap/roaring/v2"
+)
+
+// FileCoverage is how much of a file is boilerplate: of its Tokens, the
+// Covered ones are inside an n-gram found in enough other files
+type FileCoverage struct {
+	Index    int
+	Tokens   int
+	Covered  int
+	Coverage float64 // Covered / Tokens
+}
+
+// BoilerplateCoverage measures, for each file of files (nil for all), the
+// share of its tokens inside n-grams of size n that at least minOther other
+// files of them also contain, and returns the files with any, the largest
+// share first. It needs the n-gram index (-cache ngrams); with
+// {n}gramfiles.txt (-cache ngramfiles) only the files holding such an
+// n-gram are read. progress is called after
+// each file read, from the reading goroutines, with the files done and to
+// read; an error from it stops the scan and is returned.
+func BoilerplateCoverage(cacheDir string, n, minOther int, files *roaring.Bitmap,
+	progress func(done, total int) error) ([]FileCoverage, error) {
+	filesList, err := readLines(filepath.Join(cacheDir, "files.txt"))
+	if err != nil {
+		return nil, fmt.Errorf("could not read files.txt: %w", err)
+	}
+	words, err := readLines(filepath.Join(cacheDir, "uniq.txt"))
+	if err != nil {
+		return nil, fmt.Errorf("could not read uniq.txt: %w", err)
+	}
+
+	// The n-grams in minOther other files, by key and by index
+	shared := make(map[string]bool)
+	sharedIdx := roaring.New()
+	err = scanNgramIndex(cacheDir, n, func(idx int, key string, in *roaring.Bitmap) {
+		count := in.GetCardinality()
+		if files != nil {
+			count = in.AndCardinality(files)
+		}
+		if int(count) > minOther {
+			shared[key] = true
+			sharedIdx.Add(uint32(idx))
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The files to read: those of files holding a shared n-gram when the
+	// reverse index says which, or else all of files
+	candidates := fileSet(files, len(filesList))
+	if len(shared) == 0 {
+		candidates.Clear()
+	} else if path := filepath.Join(cacheDir, fmt.Sprintf("%dgramfiles.txt", n)); CacheFileExists(path) {
+		holding := roaring.New()
+		if err := scanIndexFile(path, func(idx int, ngrams *roaring.Bitmap) {
+			if ngrams.Intersects(sharedIdx) {
+				holding.Add(uint32(idx))
+			}
+		}); err != nil {
+			return nil, err
+		}
+		candidates.And(holding)
+	}
+	total := int(candidates.GetCardinality())
+
+	src := newTokenSource(cacheDir, readCacheInput(cacheDir), indexWords(words))
+	if src.cacheDir == "" && src.inputDir == "" {
+		return nil, fmt.Errorf("no word IDs (-cache docs) or token directory in settings.txt to read the files from")
+	}
+	results := make([]FileCoverage, len(filesList))
+	var done atomic.Int64
+	err = forEachTokenIndex(src, filesList, total, bitmapIndices(candidates), func(worker, fileIdx int, ids []int) error {
+		covered := make([]bool, len(ids))
+		var key []byte
+		for i := 0; i+n <= len(ids); i++ {
+			key = key[:0]
+			for k, id := range ids[i : i+n] {
+				if k > 0 {
+					key = append(key, '|')
+				}
+				key = strconv.AppendInt(key, int64(id), 10)
+			}
+			if shared[string(key)] {
+				for k := i; k < i+n; k++ {
+					covered[k] = true
+				}
+			}
+		}
+		fc := FileCoverage{Index: fileIdx, Tokens: len(ids)}
+		for _, c := range covered {
+			if c {
+				fc.Covered++
+			}
+		}
+		if fc.Tokens > 0 {
+			fc.Coverage = float64(fc.Covered) / float64(fc.Tokens)
+		}
+		results[fileIdx] = fc
+		if progress != nil {
+			return progress(int(done.Add(1)), total)
+		}
+		return nil
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var coverage []FileCoverage
+	for _, fc := range results {
+		if fc.Covered > 0 {
+			coverage = append(coverage, fc)
+		}
+	}
+	sort.SliceStable(coverage, func(i, j int) bool {
+		if coverage[i].Coverage != coverage[j].Coverage {
+			return coverage[i].Coverage > coverage[j].Coverage
+		}
+		return coverage[i].Covered > coverage[j].Covered
+	})
+	return coverage, nil
+}
@@ -0,0 +1,358 @@
+package pkg
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/RoaringBitmap/roaring/v2"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Cache backends for the n-gram builders
+const (
+	BackendText = "text" // in-memory maps, spilled to sorted runs above the RAM limit
+	BackendBolt = "bolt" // counts and postings in a BoltDB file, updated as files are read
+)
+
+// cacheBackend is the n-gram backend used by BuildNgramCache and BuildNgramFreqCache
+var cacheBackend = BackendText
+
+// SetCacheBackend selects where the n-gram builders accumulate their results.
+// The bolt backend keeps n-gram sets larger than RAM in ngramcounts.db and
+// ngrampostings.db, flushing each worker's map into them as it fills up; the
+// text files the rest of the tool reads are written from the database at the
+// end of each n. Either way the output files are the same.
+func SetCacheBackend(name string) error {
+	switch name {
+	case BackendText, BackendBolt:
+		cacheBackend = name
+		return nil
+	}
+	return fmt.Errorf("unknown cache backend %q (use '%s' or '%s')", name, BackendText, BackendBolt)
+}
+
+// Bolt databases written by the bolt backend, one per build step so each
+// step's manifest artifacts stay its own
+const (
+	NgramCountsDB   = "ngramcounts.db"
+	NgramPostingsDB = "ngrampostings.db"
+)
+
+// boltFlushEntries is how many n-grams a worker collects before flushing them
+// to the database, on top of the RAM limit check
+const boltFlushEntries = 1 << 20
+
+// boltBatchSize is how many keys one write transaction copies when a bucket
+// is rewritten
+const boltBatchSize = 100000
+
+// NgramStore is a BoltDB file holding one bucket per n ("2gram", "3gram", ...)
+// that maps n-gram keys ("w1|w2") to a uvarint count in NgramCountsDB, or to
+// a uvarint first-occurrence position followed by a roaring bitmap of files
+// in NgramPostingsDB
+type NgramStore struct {
+	db *bolt.DB
+}
+
+// OpenNgramStore opens a database written by the bolt backend for reading
+func OpenNgramStore(path string) (*NgramStore, error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s: %w", path, err)
+	}
+	return &NgramStore{db: db}, nil
+}
+
+// createNgramStore opens or creates a database for a build. Writes skip
+// fsync; Close syncs once at the end.
+func createNgramStore(path string) (*NgramStore, error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{NoSync: true, NoFreelistSync: true})
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s: %w", path, err)
+	}
+	return &NgramStore{db: db}, nil
+}
+
+// Close syncs and closes the database
+func (s *NgramStore) Close() error {
+	if !s.db.IsReadOnly() {
+		if err := s.db.Sync(); err != nil {
+			s.db.Close()
+			return err
+		}
+	}
+	return s.db.Close()
+}
+
+func ngramBucket(n int) []byte {
+	return fmt.Appendf(nil, "%dgram", n)
+}
+
+// Count returns how often an n-gram occurs in a NgramCountsDB
+func (s *NgramStore) Count(n int, key string) (int, bool, error) {
+	var count uint64
+	var found bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(ngramBucket(n))
+		if b == nil {
+			return nil
+		}
+		if v := b.Get([]byte(key)); v != nil {
+			count, _ = binary.Uvarint(v)
+			found = true
+		}
+		return nil
+	})
+	return int(count), found, err
+}
+
+// Files returns the files an n-gram occurs in from a NgramPostingsDB
+func (s *NgramStore) Files(n int, key string) (*roaring.Bitmap, bool, error) {
+	var files *roaring.Bitmap
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(ngramBucket(n))
+		if b == nil {
+			return nil
+		}
+		v := b.Get([]byte(key))
+		if v == nil {
+			return nil
+		}
+		p, err := decodeStoredPosting(v)
+		if err != nil {
+			return fmt.Errorf("%d-gram %s: %w", n, key, err)
+		}
+		files = p.files
+		return nil
+	})
+	return files, files != nil, err
+}
+
+// resetN drops everything stored for n
+func (s *NgramStore) resetN(n int) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		err := tx.DeleteBucket(ngramBucket(n))
+		if errors.Is(err, bolt.ErrBucketNotFound) {
+			return nil
+		}
+		return err
+	})
+}
+
+// addCounts adds counts to the stored counts of n in one transaction. Keys
+// are written in sorted order, which keeps bolt's page splits cheap.
+func (s *NgramStore) addCounts(n int, counts map[string]int) error {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(ngramBucket(n))
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			count := uint64(counts[key])
+			if v := b.Get([]byte(key)); v != nil {
+				old, _ := binary.Uvarint(v)
+				count += old
+			}
+			// Put keeps the slice until the commit, so each value is its own
+			if err := b.Put([]byte(key), binary.AppendUvarint(nil, count)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// addPostings merges postings into the stored postings of n
+func (s *NgramStore) addPostings(n int, postings map[string]*ngramPosting) error {
+	keys := make([]string, 0, len(postings))
+	for key := range postings {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(ngramBucket(n))
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			p := postings[key]
+			if v := b.Get([]byte(key)); v != nil {
+				old, err := decodeStoredPosting(v)
+				if err != nil {
+					return fmt.Errorf("%d-gram %s: %w", n, key, err)
+				}
+				old.files.Or(p.files)
+				old.first = min(old.first, p.first)
+				p = old
+			}
+			v, err := encodeStoredPosting(p)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(key), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func encodeStoredPosting(p *ngramPosting) ([]byte, error) {
+	p.files.RunOptimize()
+	buf := binary.AppendUvarint(nil, p.first)
+	files, err := p.files.ToBytes()
+	if err != nil {
+		return nil, err
+	}
+	return append(buf, files...), nil
+}
+
+func decodeStoredPosting(v []byte) (*ngramPosting, error) {
+	first, size := binary.Uvarint(v)
+	if size <= 0 {
+		return nil, fmt.Errorf("corrupt posting")
+	}
+	files := roaring.New()
+	// Values are only valid inside the transaction, so the bitmap gets a copy
+	if _, err := files.FromBuffer(slices.Clone(v[size:])); err != nil {
+		return nil, err
+	}
+	return &ngramPosting{files: files, first: first}, nil
+}
+
+// eachCount calls emit for every stored count of n in key order
+func (s *NgramStore) eachCount(n int, emit func(countRecord) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(ngramBucket(n))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			count, _ := binary.Uvarint(v)
+			return emit(countRecord{string(k), int(count)})
+		})
+	})
+}
+
+// writeNgramIndex writes the n-gram index of n into cacheDir from the stored
+// postings of n, in first-occurrence order like the text backend. The order
+// comes from a temporary bucket keyed by the big-endian first position, so it
+// never has to fit in memory. N-grams in fewer than the minimum number of
+// files are left out of it.
+func (s *NgramStore) writeNgramIndex(cacheDir string, n int) (int, error) {
+	order := fmt.Appendf(nil, "%dgram-order", n)
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(order); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+			return err
+		}
+		_, err := tx.CreateBucket(order)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// A write transaction holds its dirty pages in memory until it commits,
+	// so the order bucket is filled in batches
+	var after []byte
+	for done := false; !done; {
+		err := s.db.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket(ngramBucket(n))
+			if b == nil {
+				done = true
+				return nil
+			}
+			ob := tx.Bucket(order)
+			c := b.Cursor()
+			k, v := c.First()
+			if after != nil {
+				k, v = c.Seek(after)
+				if k != nil && string(k) == string(after) {
+					k, v = c.Next()
+				}
+			}
+			for i := 0; i < boltBatchSize; i++ {
+				if k == nil {
+					done = true
+					return nil
+				}
+				first, size := binary.Uvarint(v)
+				if size <= 0 {
+					return fmt.Errorf("%d-gram %s: corrupt posting", n, k)
+				}
+				if ngramMinFiles > 1 {
+					p, err := decodeStoredPosting(v)
+					if err != nil {
+						return fmt.Errorf("%d-gram %s: %w", n, k, err)
+					}
+					if p.files.GetCardinality() < uint64(ngramMinFiles) {
+						after = slices.Clone(k)
+						k, v = c.Next()
+						continue
+					}
+				}
+				if err := ob.Put(binary.BigEndian.AppendUint64(nil, first), slices.Clone(k)); err != nil {
+					return err
+				}
+				after = slices.Clone(k)
+				k, v = c.Next()
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	defer s.db.Update(func(tx *bolt.Tx) error { return tx.DeleteBucket(order) })
+
+	count := 0
+	err = s.db.View(func(tx *bolt.Tx) error {
+		ob := tx.Bucket(order)
+		b := tx.Bucket(ngramBucket(n))
+
+		// Shard sizes first, so each part's binary postings can be laid out
+		counts := make([]int, shardCount())
+		ob.ForEach(func(_, key []byte) error {
+			counts[ngramShardOf(string(key), len(counts))]++
+			count++
+			return nil
+		})
+
+		w, err := createNgramIndex(cacheDir, n, counts)
+		if err != nil {
+			return err
+		}
+		err = ob.ForEach(func(_, key []byte) error {
+			p, err := decodeStoredPosting(b.Get(key))
+			if err != nil {
+				return fmt.Errorf("%d-gram %s: %w", n, key, err)
+			}
+			return w.add(string(key), p.files)
+		})
+		if err != nil {
+			w.abort()
+			return err
+		}
+		return w.close()
+	})
+	return count, err
+}
+
+// removeStaleStore deletes a database left by an earlier bolt build when the
+// text backend rebuilds its outputs
+func removeStaleStore(path string) {
+	if cacheBackend != BackendBolt && fileExists(path) {
+		logger.Info("Removing a database from an earlier bolt build", "path", path)
+		os.Remove(path)
+	}
+}
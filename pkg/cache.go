@@ -2,33 +2,55 @@ package pkg
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
+
+	"github.com/RoaringBitmap/roaring/v2"
 )
 
 // BuildTokenCache extracts all unique words and file list from input directory
-func BuildTokenCache(inputDir, outputDir string) error {
-	fmt.Println("Building token cache...")
-	fmt.Printf("Input:  %s\n", inputDir)
-	fmt.Printf("Output: %s\n\n", outputDir)
+func BuildTokenCache(ctx context.Context, inputDir, outputDir string) error {
+	logger.Info("Building token cache", "input", inputDir, "output", outputDir)
+	reporter.OnStage(StepTokens)
 
 	// Create output directory
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
 		return fmt.Errorf("could not create output directory: %w", err)
 	}
-
-	// Write settings.txt with input path (overwrites if exists)
+	if err := beginStep(outputDir, StepTokens); err != nil {
+		return err
+	}
+	// A full rebuild invalidates the incremental state (see UpdateCache) and
+	// the ID streams, which index the old vocabulary
+	os.Remove(filepath.Join(outputDir, fileHashesName))
+	os.RemoveAll(filepath.Join(outputDir, docsDirName))
+
+	// Write settings.txt with input path and tokenizer (overwrites if exists)
+	settings := "input=" + inputDir + "\n"
+	if tokenizer != nil {
+		settings += "tokenizer=" + tokenizer.String() + "\n"
+	}
+	if stemmer != nil {
+		settings += "stem=" + stemmer.Language() + "\n"
+	}
 	settingsPath := filepath.Join(outputDir, "settings.txt")
-	if err := os.WriteFile(settingsPath, []byte("input="+inputDir+"\n"), 0644); err != nil {
+	if err := writeFileAtomic(settingsPath, []byte(settings)); err != nil {
 		return fmt.Errorf("could not write settings: %w", err)
 	}
-	fmt.Printf("Settings written to: %s\n", settingsPath)
+	logger.Info("Settings written", "path", settingsPath)
 
-	// Use a map to track unique words
+	// Use a map to track unique words, and with stemming the words of each
+	// stem
 	uniqueWords := make(map[string]struct{})
+	forms := make(stemForms)
 
 	// Count files first
 	var fileCount int
@@ -36,7 +58,7 @@ func BuildTokenCache(inputDir, outputDir string) error {
 		if err != nil {
 			return nil
 		}
-		if info.IsDir() || strings.HasPrefix(filepath.Base(path), ".") {
+		if info.IsDir() || skipTokenFile(path) {
 			return nil
 		}
 		fileCount++
@@ -46,7 +68,7 @@ func BuildTokenCache(inputDir, outputDir string) error {
 		return err
 	}
 
-	fmt.Printf("Found %d files to scan...\n", fileCount)
+	logger.Info("Found files to scan", "files", fileCount)
 
 	// Track all file paths (relative)
 	var allFiles []string
@@ -54,10 +76,13 @@ func BuildTokenCache(inputDir, outputDir string) error {
 	// Process each file
 	processed := 0
 	err = filepath.Walk(inputDir, func(path string, info os.FileInfo, err error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if err != nil {
 			return nil
 		}
-		if info.IsDir() || strings.HasPrefix(filepath.Base(path), ".") {
+		if info.IsDir() || skipTokenFile(path) {
 			return nil
 		}
 
@@ -80,19 +105,21 @@ func BuildTokenCache(inputDir, outputDir string) error {
 
 		for scanner.Scan() {
 			line := scanner.Text()
-			words := strings.Fields(line)
+			words := SplitWords(line)
 			for _, word := range words {
 				word = strings.TrimSpace(word)
-				if word != "" {
-					uniqueWords[word] = struct{}{}
+				if word == "" {
+					continue
 				}
+				if stemmer != nil {
+					word = forms.add(word)
+				}
+				uniqueWords[word] = struct{}{}
 			}
 		}
 
 		processed++
-		if processed%1000 == 0 || processed == fileCount {
-			fmt.Printf("Scanned: %d / %d files (%d unique tokens so far)\n", processed, fileCount, len(uniqueWords))
-		}
+		reporter.OnFile(processed, fileCount)
 
 		return nil
 	})
@@ -109,46 +136,68 @@ func BuildTokenCache(inputDir, outputDir string) error {
 
 	// Write to uniq.txt (overwrites if exists)
 	outPath := filepath.Join(outputDir, "uniq.txt")
-	outFile, err := os.Create(outPath)
+	outFile, err := createAtomic(outPath)
 	if err != nil {
 		return fmt.Errorf("could not create output file: %w", err)
 	}
-	defer outFile.Close()
+	defer outFile.Abort()
 
 	writer := bufio.NewWriter(outFile)
 	for _, word := range sortedWords {
 		writer.WriteString(word)
 		writer.WriteString("\n")
 	}
-	writer.Flush()
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	if err := outFile.Close(); err != nil {
+		return err
+	}
+
+	logger.Info("Done! Unique tokens written", "path", outPath, "tokens", len(sortedWords))
 
-	fmt.Printf("\nDone! Found %d unique tokens.\n", len(sortedWords))
-	fmt.Printf("Written to: %s\n", outPath)
+	if stemmer == nil {
+		os.Remove(filepath.Join(outputDir, StemFormsName))
+	} else {
+		if err := forms.write(outputDir); err != nil {
+			return fmt.Errorf("could not write %s: %w", StemFormsName, err)
+		}
+		logger.Info("Stem forms written", "path", filepath.Join(outputDir, StemFormsName), "language", stemmer.Language())
+	}
 
 	// Write files.txt with relative file paths (overwrites if exists)
 	filesPath := filepath.Join(outputDir, "files.txt")
-	filesFile, err := os.Create(filesPath)
+	filesFile, err := createAtomic(filesPath)
 	if err != nil {
 		return fmt.Errorf("could not create files list: %w", err)
 	}
-	defer filesFile.Close()
+	defer filesFile.Abort()
 
 	filesWriter := bufio.NewWriter(filesFile)
 	for _, relPath := range allFiles {
 		filesWriter.WriteString(relPath)
 		filesWriter.WriteString("\n")
 	}
-	filesWriter.Flush()
+	if err := filesWriter.Flush(); err != nil {
+		return err
+	}
+	if err := filesFile.Close(); err != nil {
+		return err
+	}
 
-	fmt.Printf("File list written to: %s (%d files)\n", filesPath, len(allFiles))
+	logger.Info("File list written", "path", filesPath, "files", len(allFiles))
 
-	return nil
+	return finishStep(outputDir, StepTokens, 0, "settings.txt", "uniq.txt", "files.txt", StemFormsName)
 }
 
 // BuildIndexCache creates word-to-file index mapping
-func BuildIndexCache(inputDir, outputDir string) error {
-	fmt.Println("Building index cache...")
-	fmt.Printf("Cache dir: %s\n\n", outputDir)
+func BuildIndexCache(ctx context.Context, inputDir, outputDir string) error {
+	logger.Info("Building index cache", "dir", outputDir)
+	reporter.OnStage(StepIndex)
+
+	if err := beginStep(outputDir, StepIndex); err != nil {
+		return err
+	}
 
 	// Load settings.txt to get the original input path for token files
 	settingsPath := filepath.Join(outputDir, "settings.txt")
@@ -167,7 +216,7 @@ func BuildIndexCache(inputDir, outputDir string) error {
 	if tokenInputDir == "" {
 		return fmt.Errorf("could not find input path in settings.txt")
 	}
-	fmt.Printf("Token files dir: %s\n", tokenInputDir)
+	logger.Info("Token files", "dir", tokenInputDir)
 
 	// Load uniq.txt into map (word -> index)
 	uniqPath := filepath.Join(outputDir, "uniq.txt")
@@ -186,7 +235,7 @@ func BuildIndexCache(inputDir, outputDir string) error {
 		wordToIndex[word] = wordIndex
 		wordIndex++
 	}
-	fmt.Printf("Loaded %d unique words from uniq.txt\n", len(wordToIndex))
+	logger.Info("Loaded unique words", "words", len(wordToIndex))
 
 	// Load files.txt into map (relative path -> index)
 	filesPath := filepath.Join(outputDir, "files.txt")
@@ -204,92 +253,95 @@ func BuildIndexCache(inputDir, outputDir string) error {
 		filesList = append(filesList, relPath)
 		fileIndex++
 	}
-	fmt.Printf("Loaded %d files from files.txt\n", len(filesList))
-
-	// Build word -> file indices mapping
-	wordToFiles := make(map[int]map[int]struct{})
+	logger.Info("Loaded files", "files", len(filesList))
 
-	fmt.Println("\nScanning files for word occurrences...")
-	for i, relPath := range filesList {
-		fullPath := filepath.Join(tokenInputDir, relPath)
+	// Build word -> file indices mapping, one partial mapping per worker
+	workers := cacheWorkerCount(len(filesList))
+	partial := make([][]*roaring.Bitmap, workers)
 
-		file, err := os.Open(fullPath)
-		if err != nil {
-			continue
+	logger.Info("Scanning files for word occurrences", "workers", workers)
+	src := newTokenSource(outputDir, tokenInputDir, wordToIndex)
+	err = forEachTokenFile(ctx, src, filesList, func(worker, fileIdx int, words []int) error {
+		if partial[worker] == nil {
+			partial[worker] = make([]*roaring.Bitmap, len(wordToIndex))
 		}
-
-		scanner := bufio.NewScanner(file)
-		scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
-
-		for scanner.Scan() {
-			words := strings.Fields(scanner.Text())
-			for _, word := range words {
-				word = strings.TrimSpace(word)
-				if wIdx, ok := wordToIndex[word]; ok {
-					if wordToFiles[wIdx] == nil {
-						wordToFiles[wIdx] = make(map[int]struct{})
-					}
-					wordToFiles[wIdx][i] = struct{}{}
-				}
+		sets := partial[worker]
+		for _, wIdx := range words {
+			if sets[wIdx] == nil {
+				sets[wIdx] = roaring.New()
 			}
+			sets[wIdx].Add(uint32(fileIdx))
 		}
-		file.Close()
+		return nil
+	}, func(done int) {
+		reporter.OnFile(done, len(filesList))
+	})
+	if err != nil {
+		return err
+	}
 
-		if (i+1)%1000 == 0 || i+1 == len(filesList) {
-			fmt.Printf("Processed: %d / %d files\n", i+1, len(filesList))
+	wordToFiles := make([]*roaring.Bitmap, len(wordToIndex))
+	for wIdx := range wordToFiles {
+		var sets []*roaring.Bitmap
+		for _, p := range partial {
+			if p != nil && p[wIdx] != nil {
+				sets = append(sets, p[wIdx])
+			}
 		}
+		wordToFiles[wIdx] = roaring.FastOr(sets...)
 	}
+	partial = nil
 
 	// Write fileuniqindex.txt
 	indexPath := filepath.Join(outputDir, "fileuniqindex.txt")
-	indexFile, err := os.Create(indexPath)
+	indexFile, err := CreateCacheFile(indexPath)
 	if err != nil {
-		return fmt.Errorf("could not create fileuniqindex.txt: %w", err)
+		return err
 	}
-	defer indexFile.Close()
 
 	writer := bufio.NewWriter(indexFile)
+	for wIdx, fileIndices := range wordToFiles {
+		fileIndices.RunOptimize()
+		writeIndexLine(writer, wIdx, fileIndices)
+	}
+	if err := writer.Flush(); err != nil {
+		AbortCacheFile(indexFile)
+		return err
+	}
+	if err := indexFile.Close(); err != nil {
+		return err
+	}
 
-	for wIdx := 0; wIdx < len(wordToIndex); wIdx++ {
-		fileIndices, ok := wordToFiles[wIdx]
-		if !ok || len(fileIndices) == 0 {
-			writer.WriteString(fmt.Sprintf("%d,[]\n", wIdx))
-			continue
-		}
+	if err := WritePostings(PostingsPath(indexPath), wordToFiles); err != nil {
+		return err
+	}
 
-		indices := make([]int, 0, len(fileIndices))
-		for fIdx := range fileIndices {
-			indices = append(indices, fIdx)
-		}
-		sort.Ints(indices)
+	logger.Info("Done! Index written", "path", indexPath, "words", len(wordToFiles))
 
-		var sb strings.Builder
-		sb.WriteString(fmt.Sprintf("%d,[", wIdx))
-		for j, fIdx := range indices {
-			if j > 0 {
-				sb.WriteString(",")
-			}
-			sb.WriteString(fmt.Sprintf("%d", fIdx))
+	if indexPositions {
+		src := newTokenSource(outputDir, tokenInputDir, wordToIndex)
+		if err := buildPositions(ctx, outputDir, src, filesList); err != nil {
+			return err
 		}
-		sb.WriteString("]\n")
-		writer.WriteString(sb.String())
+	} else {
+		// A positional index from an earlier build no longer matches
+		os.Remove(filepath.Join(outputDir, PositionsName))
 	}
-	writer.Flush()
-
-	fmt.Printf("\nDone! Index written to: %s\n", indexPath)
-	fmt.Printf("Mapped %d words to their file locations\n", len(wordToFiles))
 
-	return nil
+	return finishStep(outputDir, StepIndex, 0, "fileuniqindex.txt", "fileuniqindex.bin", PositionsName)
 }
 
 // BuildNgramCache builds n-gram sequences and their file mappings
-func BuildNgramCache(outputDir string, maxN int) error {
-	fmt.Printf("Building n-gram cache (2 to %d grams)...\n", maxN)
-	fmt.Printf("Cache dir: %s\n\n", outputDir)
+func BuildNgramCache(ctx context.Context, outputDir string, maxN int) error {
+	logger.Info("Building n-gram cache", "dir", outputDir, "maxN", maxN)
+	reporter.OnStage(StepNgrams)
 
 	if maxN < 2 {
 		return fmt.Errorf("ngrams must be at least 2")
 	}
+	if err := beginStep(outputDir, StepNgrams); err != nil {
+		return err
+	}
 
 	settingsPath := filepath.Join(outputDir, "settings.txt")
 	settingsData, err := os.ReadFile(settingsPath)
@@ -307,7 +359,7 @@ func BuildNgramCache(outputDir string, maxN int) error {
 	if tokenInputDir == "" {
 		return fmt.Errorf("could not find input path in settings.txt")
 	}
-	fmt.Printf("Token files dir: %s\n", tokenInputDir)
+	logger.Info("Token files", "dir", tokenInputDir)
 
 	uniqPath := filepath.Join(outputDir, "uniq.txt")
 	uniqFile, err := os.Open(uniqPath)
@@ -324,7 +376,7 @@ func BuildNgramCache(outputDir string, maxN int) error {
 		wordToIndex[scanner.Text()] = wordIdx
 		wordIdx++
 	}
-	fmt.Printf("Loaded %d unique words\n", len(wordToIndex))
+	logger.Info("Loaded unique words", "words", len(wordToIndex))
 
 	filesPath := filepath.Join(outputDir, "files.txt")
 	filesFile, err := os.Open(filesPath)
@@ -338,125 +390,210 @@ func BuildNgramCache(outputDir string, maxN int) error {
 	for scanner.Scan() {
 		filesList = append(filesList, scanner.Text())
 	}
-	fmt.Printf("Loaded %d files\n\n", len(filesList))
-
-	for n := 2; n <= maxN; n++ {
-		fmt.Printf("Processing %d-grams...\n", n)
+	logger.Info("Loaded files", "files", len(filesList))
 
-		ngramToIndex := make(map[string]int)
-		ngramToFiles := make(map[int]map[int]struct{})
-		ngramCount := 0
+	var store *NgramStore
+	storePath := filepath.Join(outputDir, NgramPostingsDB)
+	if cacheBackend == BackendBolt {
+		if store, err = createNgramStore(storePath); err != nil {
+			return err
+		}
+		defer func() {
+			if store != nil {
+				store.Close()
+			}
+		}()
+	} else {
+		removeStaleStore(storePath)
+	}
 
-		for fileIdx, relPath := range filesList {
-			fullPath := filepath.Join(tokenInputDir, relPath)
+	src := newTokenSource(outputDir, tokenInputDir, wordToIndex)
+	src.breaks = sentenceBoundaries
+	filter := newNgramFilter(wordToIndex)
+	cp := loadCheckpoint(outputDir, StepNgrams)
+	for n := 2; n <= maxN; n++ {
+		if cp.done(n) && ngramIndexComplete(outputDir, n) {
+			logger.Info("Skipping n-grams completed by an earlier run", "n", n)
+			continue
+		}
+		logger.Info("Processing n-grams", "n", n)
+		reporter.OnStage(ngramStage(StepNgrams, n))
 
-			file, err := os.Open(fullPath)
-			if err != nil {
-				continue
+		start, runs, err := cp.resumeN(outputDir, n)
+		if err != nil {
+			return err
+		}
+		if store != nil {
+			// Flushes between checkpoints are already in the database, so
+			// an interrupted n starts over
+			start, runs = 0, nil
+			if err := store.resetN(n); err != nil {
+				return err
 			}
+		}
+		if start > 0 {
+			logger.Info("Resuming", "n", n, "file", start, "total", len(filesList))
+		}
 
-			var words []int
-			scanner := bufio.NewScanner(file)
-			scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
-			for scanner.Scan() {
-				for _, word := range strings.Fields(scanner.Text()) {
-					if idx, ok := wordToIndex[strings.TrimSpace(word)]; ok {
-						words = append(words, idx)
+		// Each worker collects its own n-grams with the position they were
+		// first seen at, so the merged index keeps first-occurrence order
+		partial := make([]map[string]*ngramPosting, cacheWorkerCount(len(filesList)))
+		for w := range partial {
+			partial[w] = make(map[string]*ngramPosting)
+		}
+
+		// At a checkpoint the partial postings go to a run file, or to the
+		// database with the bolt backend
+		checkpoint := func(next int) error {
+			if store != nil {
+				for w, postings := range partial {
+					if err := store.addPostings(n, postings); err != nil {
+						return err
 					}
+					partial[w] = make(map[string]*ngramPosting)
 				}
+				runtime.GC()
+				return nil
 			}
-			file.Close()
+			path := filepath.Join(cp.runDir(outputDir, n), fmt.Sprintf("postings-%04d.txt", len(runs)))
+			if err := writePostingRun(path, partial); err != nil {
+				return err
+			}
+			runs = append(runs, path)
+			for w := range partial {
+				partial[w] = make(map[string]*ngramPosting)
+			}
+			runtime.GC()
+			return cp.commit(outputDir, next, runs)
+		}
 
+		err = forEachTokenChunk(ctx, src, filesList, start, func(worker, fileIdx int, words []int) error {
+			postings := partial[worker]
 			for i := 0; i <= len(words)-n; i++ {
+				if filter.skip(words, i, n) {
+					continue
+				}
 				var parts []string
 				for j := 0; j < n; j++ {
 					parts = append(parts, fmt.Sprintf("%d", words[i+j]))
 				}
 				ngramKey := strings.Join(parts, "|")
 
-				ngramIdx, exists := ngramToIndex[ngramKey]
+				p, exists := postings[ngramKey]
 				if !exists {
-					ngramIdx = ngramCount
-					ngramToIndex[ngramKey] = ngramIdx
-					ngramCount++
+					p = &ngramPosting{files: roaring.New(), first: uint64(fileIdx)<<32 | uint64(i)}
+					postings[ngramKey] = p
 				}
+				p.files.Add(uint32(fileIdx))
 
-				if ngramToFiles[ngramIdx] == nil {
-					ngramToFiles[ngramIdx] = make(map[int]struct{})
+				if store != nil && len(postings)%boltFlushEntries == 0 {
+					if err := store.addPostings(n, postings); err != nil {
+						return err
+					}
+					postings = make(map[string]*ngramPosting)
+					partial[worker] = postings
 				}
-				ngramToFiles[ngramIdx][fileIdx] = struct{}{}
 			}
+			return nil
+		}, func(done int) {
+			reporter.OnFile(done, len(filesList))
+		}, checkpoint)
+		if err != nil {
+			return err
+		}
 
-			if (fileIdx+1)%5000 == 0 {
-				fmt.Printf("  Scanned %d / %d files (%d unique %d-grams)\n", fileIdx+1, len(filesList), ngramCount, n)
+		if store != nil {
+			for _, postings := range partial {
+				if err := store.addPostings(n, postings); err != nil {
+					return err
+				}
+			}
+			partial = nil
+			ngramCount, err := store.writeNgramIndex(outputDir, n)
+			if err != nil {
+				return fmt.Errorf("could not write %d-gram index: %w", n, err)
+			}
+			logger.Info("Found unique n-grams", "n", n, "ngrams", ngramCount)
+			logger.Info("Written", "path", ngramIndexSummary(outputDir, n))
+			if err := cp.finishN(outputDir, n); err != nil {
+				return err
 			}
+			continue
 		}
 
-		fmt.Printf("  Found %d unique %d-grams\n", ngramCount, n)
-
-		uniqNgramPath := filepath.Join(outputDir, fmt.Sprintf("uniq%dgram.txt", n))
-		uniqNgramFile, err := os.Create(uniqNgramPath)
-		if err != nil {
-			return fmt.Errorf("could not create %s: %w", uniqNgramPath, err)
+		merged := partial[0]
+		for _, postings := range partial[1:] {
+			for key, p := range postings {
+				mergePosting(merged, key, p)
+			}
+		}
+		partial = nil
+		for _, run := range runs {
+			if err := readPostingRun(run, merged); err != nil {
+				return fmt.Errorf("could not read checkpoint run %s: %w", run, err)
+			}
 		}
 
-		indexToNgram := make([]string, ngramCount)
-		for ngram, idx := range ngramToIndex {
-			indexToNgram[idx] = ngram
+		keys := make([]string, 0, len(merged))
+		for key, p := range merged {
+			if p.files.GetCardinality() >= uint64(ngramMinFiles) {
+				keys = append(keys, key)
+			}
 		}
+		sort.Slice(keys, func(i, j int) bool { return merged[keys[i]].first < merged[keys[j]].first })
 
-		writer := bufio.NewWriter(uniqNgramFile)
-		for _, ngram := range indexToNgram {
-			writer.WriteString(ngram)
-			writer.WriteString("\n")
+		if ngramMinFiles > 1 {
+			logger.Info("Found n-grams", "n", n, "kept", len(keys), "minFiles", ngramMinFiles, "total", len(merged))
+		} else {
+			logger.Info("Found unique n-grams", "n", n, "ngrams", len(keys))
 		}
-		writer.Flush()
-		uniqNgramFile.Close()
 
-		indexPath := filepath.Join(outputDir, fmt.Sprintf("%dgramindex.txt", n))
-		indexFile, err := os.Create(indexPath)
+		w, err := createNgramIndex(outputDir, n, ngramShardCounts(keys, shardCount()))
 		if err != nil {
-			return fmt.Errorf("could not create %s: %w", indexPath, err)
+			return err
 		}
-
-		writer = bufio.NewWriter(indexFile)
-		for ngramIdx := 0; ngramIdx < ngramCount; ngramIdx++ {
-			fileIndices := ngramToFiles[ngramIdx]
-			indices := make([]int, 0, len(fileIndices))
-			for fIdx := range fileIndices {
-				indices = append(indices, fIdx)
+		for _, key := range keys {
+			if err := w.add(key, merged[key].files); err != nil {
+				w.abort()
+				return err
 			}
-			sort.Ints(indices)
-
-			var sb strings.Builder
-			sb.WriteString(fmt.Sprintf("%d,[", ngramIdx))
-			for j, fIdx := range indices {
-				if j > 0 {
-					sb.WriteString(",")
-				}
-				sb.WriteString(fmt.Sprintf("%d", fIdx))
-			}
-			sb.WriteString("]\n")
-			writer.WriteString(sb.String())
 		}
-		writer.Flush()
-		indexFile.Close()
+		merged = nil
+		if err := w.close(); err != nil {
+			return err
+		}
+
+		logger.Info("Written", "path", ngramIndexSummary(outputDir, n))
 
-		fmt.Printf("  Written: %s, %s\n", uniqNgramPath, indexPath)
+		if err := cp.finishN(outputDir, n); err != nil {
+			return err
+		}
 	}
+	cp.finish(outputDir)
 
-	fmt.Println("\nDone!")
-	return nil
+	logger.Info("Done")
+	if store != nil {
+		err := store.Close()
+		store = nil
+		if err != nil {
+			return err
+		}
+	}
+	return finishStep(outputDir, StepNgrams, maxN, append(ngramIndexArtifacts(outputDir, maxN), NgramPostingsDB)...)
 }
 
-// BuildNgramFreqCache builds n-gram frequency cache (only phrases appearing 2+ times)
-func BuildNgramFreqCache(outputDir string, maxN int) error {
-	fmt.Printf("Building n-gram frequency cache (2 to %d grams, min 2 occurrences)...\n", maxN)
-	fmt.Printf("Cache dir: %s\n\n", outputDir)
+// BuildNgramFreqCache builds n-gram frequency cache (only phrases appearing at
+// least the minimum count, 2 by default)
+func BuildNgramFreqCache(ctx context.Context, outputDir string, maxN int) error {
+	logger.Info("Building n-gram frequency cache", "dir", outputDir, "maxN", maxN, "minCount", ngramMinCount)
+	reporter.OnStage(StepNgramFreq)
 
 	if maxN < 2 {
 		return fmt.Errorf("ngrams must be at least 2")
 	}
+	if err := beginStep(outputDir, StepNgramFreq); err != nil {
+		return err
+	}
 
 	settingsPath := filepath.Join(outputDir, "settings.txt")
 	settingsData, err := os.ReadFile(settingsPath)
@@ -474,7 +611,7 @@ func BuildNgramFreqCache(outputDir string, maxN int) error {
 	if tokenInputDir == "" {
 		return fmt.Errorf("could not find input path in settings.txt")
 	}
-	fmt.Printf("Token files dir: %s\n", tokenInputDir)
+	logger.Info("Token files", "dir", tokenInputDir)
 
 	uniqPath := filepath.Join(outputDir, "uniq.txt")
 	uniqFile, err := os.Open(uniqPath)
@@ -491,7 +628,7 @@ func BuildNgramFreqCache(outputDir string, maxN int) error {
 		wordToIndex[scanner.Text()] = wordIdx
 		wordIdx++
 	}
-	fmt.Printf("Loaded %d unique words\n", len(wordToIndex))
+	logger.Info("Loaded unique words", "words", len(wordToIndex))
 
 	filesPath := filepath.Join(outputDir, "files.txt")
 	filesFile, err := os.Open(filesPath)
@@ -505,54 +642,190 @@ func BuildNgramFreqCache(outputDir string, maxN int) error {
 	for scanner.Scan() {
 		filesList = append(filesList, scanner.Text())
 	}
-	fmt.Printf("Loaded %d files\n\n", len(filesList))
+	logger.Info("Loaded files", "files", len(filesList))
 
+	var store *NgramStore
+	storePath := filepath.Join(outputDir, NgramCountsDB)
+	if cacheBackend == BackendBolt {
+		if store, err = createNgramStore(storePath); err != nil {
+			return err
+		}
+		defer func() {
+			if store != nil {
+				store.Close()
+			}
+		}()
+	} else {
+		removeStaleStore(storePath)
+	}
+
+	src := newTokenSource(outputDir, tokenInputDir, wordToIndex)
+	src.breaks = sentenceBoundaries
+	filter := newNgramFilter(wordToIndex)
+	cp := loadCheckpoint(outputDir, StepNgramFreq)
 	for n := 2; n <= maxN; n++ {
-		fmt.Printf("Processing %d-grams...\n", n)
+		freqPath := filepath.Join(outputDir, fmt.Sprintf("%dgramfreq.txt", n))
+		if cp.done(n) && CacheFileExists(freqPath) {
+			logger.Info("Skipping n-grams completed by an earlier run", "n", n)
+			continue
+		}
+		logger.Info("Processing n-grams", "n", n)
+		reporter.OnStage(ngramStage(StepNgramFreq, n))
 
-		ngramCount := make(map[string]int)
+		start, runs, err := cp.resumeN(outputDir, n)
+		if err != nil {
+			return err
+		}
+		if store != nil {
+			// Flushes between checkpoints are already in the database, so
+			// an interrupted n starts over
+			start, runs = 0, nil
+			if err := store.resetN(n); err != nil {
+				return err
+			}
+		}
+		if start > 0 {
+			logger.Info("Resuming", "n", n, "file", start, "total", len(filesList), "runs", len(runs))
+		}
+		runDir := cp.runDir(outputDir, n)
 
-		for fileIdx, relPath := range filesList {
-			fullPath := filepath.Join(tokenInputDir, relPath)
+		partial := make([]map[string]int, cacheWorkerCount(len(filesList)))
+		lastCheck := make([]int, len(partial))
+		for w := range partial {
+			partial[w] = make(map[string]int)
+		}
 
-			file, err := os.Open(fullPath)
+		// Above the RAM limit, a worker spills its counts to a sorted run;
+		// runs are merged at the end. Runs only count towards a resumed build
+		// once a checkpoint commits them. The bolt backend adds them to the
+		// database instead.
+		var runsMu sync.Mutex
+		spill := func(counts map[string]int) error {
+			if store != nil {
+				return store.addCounts(n, counts)
+			}
+			runsMu.Lock()
+			defer runsMu.Unlock()
+			path, err := spillCounts(runDir, counts, len(runs))
 			if err != nil {
-				continue
+				return err
 			}
+			runs = append(runs, path)
+			logger.Info("Spilled n-grams", "n", n, "count", len(counts), "path", path)
+			return nil
+		}
 
-			var words []int
-			scanner := bufio.NewScanner(file)
-			scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
-			for scanner.Scan() {
-				for _, word := range strings.Fields(scanner.Text()) {
-					if idx, ok := wordToIndex[strings.TrimSpace(word)]; ok {
-						words = append(words, idx)
+		checkpoint := func(next int) error {
+			for w, counts := range partial {
+				if len(counts) > 0 {
+					if err := spill(counts); err != nil {
+						return err
 					}
+					partial[w] = make(map[string]int)
+					lastCheck[w] = 0
 				}
 			}
-			file.Close()
+			runtime.GC()
+			if store != nil {
+				return nil
+			}
+			return cp.commit(outputDir, next, runs)
+		}
 
+		err = forEachTokenChunk(ctx, src, filesList, start, func(worker, fileIdx int, words []int) error {
 			for i := 0; i <= len(words)-n; i++ {
+				if filter.skip(words, i, n) {
+					continue
+				}
 				var parts []string
 				for j := 0; j < n; j++ {
 					parts = append(parts, fmt.Sprintf("%d", words[i+j]))
 				}
 				ngramKey := strings.Join(parts, "|")
-				ngramCount[ngramKey]++
+				counts := partial[worker]
+				counts[ngramKey]++
+
+				if (cacheRAMLimit > 0 || store != nil) && len(counts)-lastCheck[worker] >= spillCheckInterval {
+					lastCheck[worker] = len(counts)
+					if memoryExceeded() || store != nil && len(counts) >= boltFlushEntries {
+						if err := spill(counts); err != nil {
+							return fmt.Errorf("could not spill %d-gram counts: %w", n, err)
+						}
+						partial[worker] = make(map[string]int)
+						lastCheck[worker] = 0
+						runtime.GC()
+					}
+				}
 			}
+			return nil
+		}, func(done int) {
+			reporter.OnFile(done, len(filesList))
+		}, checkpoint)
+		if err != nil {
+			return err
+		}
 
-			if (fileIdx+1)%5000 == 0 {
-				fmt.Printf("  Scanned %d / %d files\n", fileIdx+1, len(filesList))
+		if store != nil {
+			for _, counts := range partial {
+				if err == nil && len(counts) > 0 {
+					err = spill(counts)
+				}
 			}
+			partial = nil
+			if err == nil {
+				var total, kept int
+				total, kept, err = freqFromRecords(runDir, func(emit func(countRecord) error) error {
+					return store.eachCount(n, emit)
+				}, ngramMinCount, freqPath)
+				logger.Info("Found n-grams", "n", n, "kept", kept, "minCount", ngramMinCount, "total", total, "db", NgramCountsDB)
+			}
+			if err != nil {
+				return fmt.Errorf("could not write %d-gram counts: %w", n, err)
+			}
+			logger.Info("Written", "path", freqPath)
+			if err := cp.finishN(outputDir, n); err != nil {
+				return err
+			}
+			continue
 		}
 
+		if len(runs) > 0 {
+			for _, counts := range partial {
+				if err == nil && len(counts) > 0 {
+					err = spill(counts)
+				}
+			}
+			partial = nil
+			if err == nil {
+				var total, kept int
+				total, kept, err = externalFreq(runDir, runs, ngramMinCount, freqPath)
+				logger.Info("Found n-grams", "n", n, "kept", kept, "minCount", ngramMinCount, "total", total, "runs", len(runs))
+			}
+			if err != nil {
+				return fmt.Errorf("could not merge %d-gram counts: %w", n, err)
+			}
+			logger.Info("Written", "path", freqPath)
+			if err := cp.finishN(outputDir, n); err != nil {
+				return err
+			}
+			continue
+		}
+
+		ngramCount := partial[0]
+		for _, counts := range partial[1:] {
+			for key, count := range counts {
+				ngramCount[key] += count
+			}
+		}
+		partial = nil
+
 		type ngramFreq struct {
 			ngram string
 			count int
 		}
 		var filtered []ngramFreq
 		for ngram, count := range ngramCount {
-			if count >= 2 {
+			if count >= ngramMinCount {
 				filtered = append(filtered, ngramFreq{ngram, count})
 			}
 		}
@@ -561,38 +834,56 @@ func BuildNgramFreqCache(outputDir string, maxN int) error {
 			return filtered[i].count > filtered[j].count
 		})
 
-		fmt.Printf("  Found %d %d-grams appearing 2+ times (out of %d total)\n", len(filtered), n, len(ngramCount))
+		logger.Info("Found n-grams", "n", n, "kept", len(filtered), "minCount", ngramMinCount, "total", len(ngramCount))
 
-		freqPath := filepath.Join(outputDir, fmt.Sprintf("%dgramfreq.txt", n))
-		freqFile, err := os.Create(freqPath)
+		freqFile, err := CreateCacheFile(freqPath)
 		if err != nil {
-			return fmt.Errorf("could not create %s: %w", freqPath, err)
+			return err
 		}
 
 		writer := bufio.NewWriter(freqFile)
 		for _, nf := range filtered {
 			writer.WriteString(fmt.Sprintf("%s,%d\n", nf.ngram, nf.count))
 		}
-		writer.Flush()
-		freqFile.Close()
+		if err := writer.Flush(); err != nil {
+			AbortCacheFile(freqFile)
+			return err
+		}
+		if err := freqFile.Close(); err != nil {
+			return err
+		}
 
-		fmt.Printf("  Written: %s\n", freqPath)
+		logger.Info("Written", "path", freqPath)
 
 		ngramCount = nil
+		if err := cp.finishN(outputDir, n); err != nil {
+			return err
+		}
 	}
+	cp.finish(outputDir)
 
-	fmt.Println("\nDone!")
-	return nil
+	logger.Info("Done")
+	if store != nil {
+		err := store.Close()
+		store = nil
+		if err != nil {
+			return err
+		}
+	}
+	return finishStep(outputDir, StepNgramFreq, maxN, append(ngramArtifacts(maxN, "%dgramfreq.txt"), NgramCountsDB)...)
 }
 
 // BuildNgramFilesCache builds file-to-ngram reverse index
-func BuildNgramFilesCache(outputDir string, maxN int) error {
-	fmt.Printf("Building n-gram → files reverse index (2 to %d grams)...\n", maxN)
-	fmt.Printf("Cache dir: %s\n\n", outputDir)
+func BuildNgramFilesCache(ctx context.Context, outputDir string, maxN int) error {
+	logger.Info("Building n-gram → files reverse index", "dir", outputDir, "maxN", maxN)
+	reporter.OnStage(StepNgramFiles)
 
 	if maxN < 2 {
 		return fmt.Errorf("ngrams must be at least 2")
 	}
+	if err := beginStep(outputDir, StepNgramFiles); err != nil {
+		return err
+	}
 
 	filesPath := filepath.Join(outputDir, "files.txt")
 	filesFile, err := os.Open(filesPath)
@@ -606,52 +897,61 @@ func BuildNgramFilesCache(outputDir string, maxN int) error {
 	for scanner.Scan() {
 		fileCount++
 	}
-	fmt.Printf("Found %d files\n\n", fileCount)
+	logger.Info("Found files", "files", fileCount)
 
 	for n := 2; n <= maxN; n++ {
-		fmt.Printf("Processing %d-grams...\n", n)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		logger.Info("Processing n-grams", "n", n)
+		reporter.OnStage(ngramStage(StepNgramFiles, n))
 
-		indexPath := filepath.Join(outputDir, fmt.Sprintf("%dgramindex.txt", n))
-		indexFile, err := os.Open(indexPath)
-		if err != nil {
-			fmt.Printf("  Skipping: could not open %s\n", indexPath)
+		parts := NgramIndexParts(outputDir, n)
+		if len(parts) == 0 {
+			logger.Info("Skipping: no n-gram index", "n", n, "dir", outputDir)
 			continue
 		}
 
 		fileToNgrams := make(map[int][]int)
+		for _, part := range parts {
+			indexFile, err := OpenCacheFile(part.Index)
+			if err != nil {
+				return fmt.Errorf("could not open %s: %w", part.Index, err)
+			}
 
-		scanner := bufio.NewScanner(indexFile)
-		scanner.Buffer(make([]byte, 10*1024*1024), 10*1024*1024)
+			scanner := bufio.NewScanner(indexFile)
+			scanner.Buffer(make([]byte, 10*1024*1024), 10*1024*1024)
 
-		for scanner.Scan() {
-			line := scanner.Text()
-			commaIdx := strings.Index(line, ",[")
-			if commaIdx == -1 {
-				continue
-			}
+			for scanner.Scan() {
+				line := scanner.Text()
+				commaIdx := strings.Index(line, ",[")
+				if commaIdx == -1 {
+					continue
+				}
 
-			ngramIdxStr := line[:commaIdx]
-			ngramIdx := 0
-			fmt.Sscanf(ngramIdxStr, "%d", &ngramIdx)
+				ngramIdxStr := line[:commaIdx]
+				ngramIdx := 0
+				fmt.Sscanf(ngramIdxStr, "%d", &ngramIdx)
 
-			arrayPart := line[commaIdx+1:]
-			arrayPart = strings.TrimPrefix(arrayPart, "[")
-			arrayPart = strings.TrimSuffix(arrayPart, "]")
+				arrayPart := line[commaIdx+1:]
+				arrayPart = strings.TrimPrefix(arrayPart, "[")
+				arrayPart = strings.TrimSuffix(arrayPart, "]")
 
-			if arrayPart != "" {
-				for _, fIdxStr := range strings.Split(arrayPart, ",") {
-					var fIdx int
-					fmt.Sscanf(fIdxStr, "%d", &fIdx)
-					fileToNgrams[fIdx] = append(fileToNgrams[fIdx], ngramIdx)
+				if arrayPart != "" {
+					for _, fIdxStr := range strings.Split(arrayPart, ",") {
+						var fIdx int
+						fmt.Sscanf(fIdxStr, "%d", &fIdx)
+						fileToNgrams[fIdx] = append(fileToNgrams[fIdx], ngramIdx)
+					}
 				}
 			}
+			indexFile.Close()
 		}
-		indexFile.Close()
 
 		filesOutPath := filepath.Join(outputDir, fmt.Sprintf("%dgramfiles.txt", n))
-		filesOutFile, err := os.Create(filesOutPath)
+		filesOutFile, err := CreateCacheFile(filesOutPath)
 		if err != nil {
-			return fmt.Errorf("could not create %s: %w", filesOutPath, err)
+			return err
 		}
 
 		writer := bufio.NewWriter(filesOutFile)
@@ -670,20 +970,50 @@ func BuildNgramFilesCache(outputDir string, maxN int) error {
 			sb.WriteString("]\n")
 			writer.WriteString(sb.String())
 		}
-		writer.Flush()
-		filesOutFile.Close()
+		if err := writer.Flush(); err != nil {
+			AbortCacheFile(filesOutFile)
+			return err
+		}
+		if err := filesOutFile.Close(); err != nil {
+			return err
+		}
 
-		fmt.Printf("  Written: %s\n", filesOutPath)
+		logger.Info("Written", "path", filesOutPath)
 	}
 
-	fmt.Println("\nDone!")
-	return nil
+	logger.Info("Done")
+	return finishStep(outputDir, StepNgramFiles, maxN, ngramArtifacts(maxN, "%dgramfiles.txt")...)
+}
+
+var pageSuffixRe = regexp.MustCompile(`\.page(\d{4})$`)
+
+// skipTokenFile reports whether a file of a token directory is left out of
+// the cache: hidden files, the ledger of process with its transcoded.txt and
+// the languages.txt of process -detect-lang, the .meta.json sidecars of
+// process -metadata and outputs it was still writing when it was killed
+func skipTokenFile(path string) bool {
+	base := filepath.Base(path)
+	switch base {
+	case LedgerName, "transcoded.txt", "languages.txt":
+		return true
+	}
+	return strings.HasPrefix(base, ".") || strings.HasSuffix(base, ".meta.json") || strings.HasSuffix(base, tmpSuffix)
 }
 
-// ShowStatus displays conversion status between input and output directories
+// ShowStatus displays conversion status between input and output directories:
+// from the ledger when the output directory has one, and otherwise by
+// counting the outputs
 func ShowStatus(inputDir, outputDir string) error {
+	done, err := LoadLedger(outputDir)
+	if err != nil {
+		return fmt.Errorf("could not read %s: %w", LedgerName, err)
+	}
+	if done != nil {
+		return showLedgerStatus(inputDir, outputDir, done)
+	}
+
 	inputCounts := make(map[string]int)
-	err := filepath.Walk(inputDir, func(path string, info os.FileInfo, err error) error {
+	err = filepath.Walk(inputDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return nil
 		}
@@ -717,6 +1047,13 @@ func ShowStatus(inputDir, outputDir string) error {
 			return nil
 		}
 		original := strings.TrimSuffix(base, ".txt")
+		// Per-page outputs (file.pdf.page0001.txt) count once, via their first page
+		if m := pageSuffixRe.FindStringSubmatch(original); m != nil {
+			if m[1] != "0001" {
+				return nil
+			}
+			original = strings.TrimSuffix(original, m[0])
+		}
 		ext := strings.ToLower(filepath.Ext(original))
 		if ext == "" {
 			ext = "(no extension)"
@@ -773,29 +1110,90 @@ func ShowStatus(inputDir, outputDir string) error {
 	return nil
 }
 
-// Analyze runs all cache building steps in sequence: tokens, index, ngramfreq, ngrams
-func Analyze(inputDir, outputDir string, maxN int) error {
-	fmt.Println("=== STEP 1/4: Building Token Cache ===")
-	if err := BuildTokenCache(inputDir, outputDir); err != nil {
-		return fmt.Errorf("token cache failed: %w", err)
-	}
+// analyzeSkip are the steps Analyze leaves out, and analyzeResume makes it
+// also leave out those the manifest shows complete and current
+var (
+	analyzeSkip   map[string]bool
+	analyzeResume bool
+)
 
-	fmt.Println("\n=== STEP 2/4: Building Word-to-File Index ===")
-	if err := BuildIndexCache(inputDir, outputDir); err != nil {
-		return fmt.Errorf("index cache failed: %w", err)
+// AnalyzeSteps are the steps Analyze runs, in order
+var AnalyzeSteps = []string{StepTokens, StepDocs, StepIndex, StepTFIDF, StepStats, StepNgramFreq, StepNgrams}
+
+// SetAnalyzeSkip sets the steps Analyze leaves out, a comma-separated list
+// of AnalyzeSteps. A skipped step is not checked: the steps after it read
+// whatever it last wrote.
+func SetAnalyzeSkip(steps string) error {
+	analyzeSkip = make(map[string]bool)
+	for _, step := range strings.Split(steps, ",") {
+		step = strings.TrimSpace(step)
+		if step == "" {
+			continue
+		}
+		if !slices.Contains(AnalyzeSteps, step) {
+			return fmt.Errorf("unknown step %q (use %s)", step, strings.Join(AnalyzeSteps, ", "))
+		}
+		analyzeSkip[step] = true
 	}
+	return nil
+}
+
+// SetAnalyzeResume makes Analyze leave out the steps the cache manifest
+// shows complete and current for its input and n-gram size (see
+// StepCurrent), so a build that stopped part way picks up where it did
+func SetAnalyzeResume(resume bool) {
+	analyzeResume = resume
+}
 
-	fmt.Println("\n=== STEP 3/4: Building N-gram Frequency Cache ===")
-	if err := BuildNgramFreqCache(outputDir, maxN); err != nil {
-		return fmt.Errorf("ngramfreq cache failed: %w", err)
+// Analyze runs all cache building steps in sequence: tokens, docs, index,
+// tfidf, stats, ngramfreq, ngrams, but those SetAnalyzeSkip and
+// SetAnalyzeResume leave out. A step is checked for resuming just before it
+// would run, so one whose inputs were just rebuilt runs again. A run stopped
+// through ctx keeps the steps it finished, for -resume to skip.
+func Analyze(ctx context.Context, inputDir, outputDir string, maxN int) error {
+	steps := []struct {
+		step, title, name string
+		run               func() error
+	}{
+		{StepTokens, "Building Token Cache", "token", func() error {
+			if err := BuildTokenCache(ctx, inputDir, outputDir); err != nil {
+				return err
+			}
+			if err := rebuildNormalizedVocab(outputDir); err != nil {
+				return fmt.Errorf("normalized vocabulary failed: %w", err)
+			}
+			return nil
+		}},
+		{StepDocs, "Encoding Files as Word IDs", "docs", func() error { return BuildDocsCache(ctx, outputDir) }},
+		{StepIndex, "Building Word-to-File Index", "index", func() error { return BuildIndexCache(ctx, inputDir, outputDir) }},
+		{StepTFIDF, "Computing Term Statistics", "tfidf", func() error { return BuildTFIDFCache(ctx, outputDir) }},
+		{StepStats, "Computing Corpus Statistics", "stats", func() error { return BuildStatsCache(ctx, outputDir) }},
+		{StepNgramFreq, "Building N-gram Frequency Cache", "ngramfreq", func() error { return BuildNgramFreqCache(ctx, outputDir, maxN) }},
+		{StepNgrams, "Building N-gram Index (for file tracking)", "ngram index", func() error { return BuildNgramCache(ctx, outputDir, maxN) }},
 	}
 
-	fmt.Println("\n=== STEP 4/4: Building N-gram Index (for file tracking) ===")
-	if err := BuildNgramCache(outputDir, maxN); err != nil {
-		return fmt.Errorf("ngram index failed: %w", err)
+	for i, st := range steps {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		logger.Info(fmt.Sprintf("=== STEP %d/%d: %s ===", i+1, len(steps), st.title), "step", st.step)
+		if analyzeSkip[st.step] {
+			logger.Info("Skipping step (-skip)", "step", st.step)
+			continue
+		}
+		if analyzeResume {
+			err := StepCurrent(outputDir, inputDir, st.step, maxN)
+			if err == nil {
+				logger.Info("Skipping step: complete and current (-resume)", "step", st.step)
+				continue
+			}
+			logger.Info("Running step", "step", st.step, "reason", err)
+		}
+		if err := st.run(); err != nil {
+			return fmt.Errorf("%s cache failed: %w", st.name, err)
+		}
 	}
 
-	fmt.Println("\n=== ANALYSIS COMPLETE ===")
-	fmt.Printf("All results written to: %s\n", outputDir)
+	logger.Info("=== ANALYSIS COMPLETE ===", "dir", outputDir)
 	return nil
 }
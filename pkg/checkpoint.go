@@ -0,0 +1,265 @@
+package pkg
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/RoaringBitmap/roaring/v2"
+)
+
+// checkpointEvery is how many token files the n-gram builders read between
+// progress checkpoints; 0 only records each completed n
+var checkpointEvery = 10000
+
+// SetCheckpointInterval sets how many token files BuildNgramCache and
+// BuildNgramFreqCache read between checkpoints. At each checkpoint the partial
+// results are written to run files in the cache dir, so an interrupted build
+// re-run with the same cache resumes from the last checkpoint instead of the
+// start of the current n. 0 keeps per-n resumption only.
+func SetCheckpointInterval(files int) {
+	checkpointEvery = max(0, files)
+}
+
+// buildCheckpoint is the progress of an interrupted n-gram build, kept in
+// .<step>.checkpoint.json in the cache dir
+type buildCheckpoint struct {
+	Step     string   `json:"step"`
+	Source   string   `json:"source"`             // identifies the uniq.txt and files.txt being read
+	DoneN    []int    `json:"doneN"`              // n values whose output is complete
+	N        int      `json:"n,omitempty"`        // n in progress
+	NextFile int      `json:"nextFile,omitempty"` // files before this index are in Runs
+	Runs     []string `json:"runs,omitempty"`     // committed run files, relative to the cache dir
+}
+
+func checkpointPath(cacheDir, step string) string {
+	return filepath.Join(cacheDir, "."+step+".checkpoint.json")
+}
+
+// checkpointSource identifies the vocabulary and file list a build reads;
+// rebuilding either invalidates a checkpoint
+func checkpointSource(cacheDir string) string {
+	var parts []string
+	for _, name := range []string{"uniq.txt", "files.txt"} {
+		info, err := os.Stat(filepath.Join(cacheDir, name))
+		if err != nil {
+			return ""
+		}
+		parts = append(parts, fmt.Sprintf("%s:%d:%d", name, info.Size(), info.ModTime().UnixNano()))
+	}
+	return strings.Join(parts, ",")
+}
+
+// loadCheckpoint returns the checkpoint of an interrupted build of step, or a
+// fresh one when there is none or it was made against other inputs
+func loadCheckpoint(cacheDir, step string) *buildCheckpoint {
+	source := checkpointSource(cacheDir)
+	fresh := &buildCheckpoint{Step: step, Source: source}
+
+	data, err := os.ReadFile(checkpointPath(cacheDir, step))
+	if err != nil {
+		return fresh
+	}
+	var cp buildCheckpoint
+	if json.Unmarshal(data, &cp) != nil || cp.Step != step || cp.Source != source {
+		logger.Info("Discarding checkpoint from an earlier build (inputs changed)", "step", step)
+		if cp.N > 0 {
+			os.RemoveAll(cp.runDir(cacheDir, cp.N))
+		}
+		return fresh
+	}
+	if len(cp.DoneN) > 0 || cp.N > 0 {
+		args := []any{"step", step, "done", fmt.Sprint(cp.DoneN)}
+		if cp.N > 0 {
+			args = append(args, "n", cp.N, "file", cp.NextFile)
+		}
+		logger.Info("Resuming from checkpoint", args...)
+	}
+	return &cp
+}
+
+func (c *buildCheckpoint) save(cacheDir string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(checkpointPath(cacheDir, c.Step), data)
+}
+
+// done reports whether n was completed by an earlier run
+func (c *buildCheckpoint) done(n int) bool {
+	return slices.Contains(c.DoneN, n)
+}
+
+func (c *buildCheckpoint) runDir(cacheDir string, n int) string {
+	return filepath.Join(cacheDir, fmt.Sprintf(".%s-%d-runs", c.Step, n))
+}
+
+// resumeN prepares building n and returns the first file still to be read
+// and the run files holding the files before it. Runs written after the last
+// checkpoint are deleted; their files are read again.
+func (c *buildCheckpoint) resumeN(cacheDir string, n int) (int, []string, error) {
+	dir := c.runDir(cacheDir, n)
+	if c.N != n {
+		os.RemoveAll(dir)
+		c.N, c.NextFile, c.Runs = n, 0, nil
+	}
+
+	var runs []string
+	for _, rel := range c.Runs {
+		runs = append(runs, filepath.Join(cacheDir, rel))
+	}
+	if entries, err := os.ReadDir(dir); err == nil {
+		for _, e := range entries {
+			if !slices.Contains(runs, filepath.Join(dir, e.Name())) {
+				os.Remove(filepath.Join(dir, e.Name()))
+			}
+		}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, nil, err
+	}
+	return c.NextFile, runs, nil
+}
+
+// commit records that every file before next is in runs
+func (c *buildCheckpoint) commit(cacheDir string, next int, runs []string) error {
+	c.NextFile = next
+	c.Runs = c.Runs[:0]
+	for _, path := range runs {
+		rel, err := filepath.Rel(cacheDir, path)
+		if err != nil {
+			return err
+		}
+		c.Runs = append(c.Runs, rel)
+	}
+	return c.save(cacheDir)
+}
+
+// finishN marks n complete and drops its runs
+func (c *buildCheckpoint) finishN(cacheDir string, n int) error {
+	os.RemoveAll(c.runDir(cacheDir, n))
+	c.DoneN = append(c.DoneN, n)
+	c.N, c.NextFile, c.Runs = 0, 0, nil
+	return c.save(cacheDir)
+}
+
+// finish removes the checkpoint once the whole build succeeded
+func (c *buildCheckpoint) finish(cacheDir string) {
+	os.Remove(checkpointPath(cacheDir, c.Step))
+}
+
+// forEachTokenChunk runs forEachTokenFile over filesList[start:] in chunks of
+// checkpointEvery files, calling commit with the index of the next unread
+// file after every chunk but the last. A build stopped through ctx resumes
+// from the last commit when run again.
+func forEachTokenChunk(ctx context.Context, src *tokenSource, filesList []string, start int,
+	fn func(worker, fileIdx int, words []int) error, progress func(done int), commit func(next int) error) error {
+	for chunkStart := start; chunkStart < len(filesList); {
+		chunkEnd := len(filesList)
+		if checkpointEvery > 0 {
+			chunkEnd = min(chunkStart+checkpointEvery, len(filesList))
+		}
+		offset := chunkStart
+		err := forEachTokenRange(ctx, src, filesList, chunkStart, chunkEnd, fn, func(done int) {
+			if progress != nil {
+				progress(offset + done)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		if chunkEnd < len(filesList) {
+			if err := commit(chunkEnd); err != nil {
+				return err
+			}
+		}
+		chunkStart = chunkEnd
+	}
+	return nil
+}
+
+// ngramPosting is the file set of one n-gram and the position it was first
+// seen at, so merged partial results keep first-occurrence order
+type ngramPosting struct {
+	files *roaring.Bitmap
+	first uint64 // fileIdx<<32 | word offset
+}
+
+// writePostingRun writes partial n-gram postings as "key first f1,f2,..." lines
+func writePostingRun(path string, partial []map[string]*ngramPosting) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("could not create %s: %w", path, err)
+	}
+	defer f.Close()
+
+	writer := bufio.NewWriter(f)
+	for _, postings := range partial {
+		for key, p := range postings {
+			writer.WriteString(key)
+			writer.WriteString(" ")
+			writer.WriteString(strconv.FormatUint(p.first, 10))
+			writer.WriteString(" ")
+			it := p.files.Iterator()
+			for first := true; it.HasNext(); first = false {
+				if !first {
+					writer.WriteString(",")
+				}
+				writer.WriteString(strconv.FormatUint(uint64(it.Next()), 10))
+			}
+			writer.WriteString("\n")
+		}
+	}
+	return writer.Flush()
+}
+
+// readPostingRun merges a run written by writePostingRun into merged
+func readPostingRun(path string, merged map[string]*ngramPosting) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 10*1024*1024), 10*1024*1024)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		first, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		files := roaring.New()
+		for _, s := range strings.Split(fields[2], ",") {
+			if fIdx, err := strconv.ParseUint(s, 10, 32); err == nil {
+				files.Add(uint32(fIdx))
+			}
+		}
+		mergePosting(merged, fields[0], &ngramPosting{files: files, first: first})
+	}
+	return scanner.Err()
+}
+
+func mergePosting(merged map[string]*ngramPosting, key string, p *ngramPosting) {
+	if m, ok := merged[key]; ok {
+		m.files.Or(p.files)
+		m.first = min(m.first, p.first)
+	} else {
+		merged[key] = p
+	}
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,297 @@
+package pkg
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Source code extraction modes
+const (
+	CodeComments    = "comments"    // comments and string literals
+	CodeIdentifiers = "identifiers" // identifiers split into lowercase words
+	CodeRaw         = "raw"         // file contents as-is
+)
+
+var codeMode = CodeComments
+
+// SetCodeMode selects how source files are turned into text
+func SetCodeMode(mode string) error {
+	if err := checkCodeMode(mode); err != nil {
+		return err
+	}
+	codeMode = mode
+	return nil
+}
+
+func checkCodeMode(mode string) error {
+	switch mode {
+	case CodeComments, CodeIdentifiers, CodeRaw:
+		return nil
+	}
+	return fmt.Errorf("unknown code mode: %s (use 'comments', 'identifiers', or 'raw')", mode)
+}
+
+// codeSyntax describes the comment and string delimiters of a language family
+type codeSyntax struct {
+	lineComments  []string
+	blockComments [][2]string
+	quotes        string // single-character string delimiters
+	tripleQuotes  bool   // Python """docstrings"""
+	rawBackticks  bool   // Go raw strings and JS template literals
+}
+
+var (
+	cSyntax = codeSyntax{
+		lineComments:  []string{"//"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		quotes:        `"'`,
+		rawBackticks:  true,
+	}
+	hashSyntax = codeSyntax{
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+		tripleQuotes: true,
+	}
+)
+
+// codeSyntaxes maps file extensions to their syntax
+var codeSyntaxes = map[string]codeSyntax{
+	".go": cSyntax, ".js": cSyntax, ".jsx": cSyntax, ".ts": cSyntax, ".tsx": cSyntax,
+	".java": cSyntax, ".c": cSyntax, ".h": cSyntax, ".cpp": cSyntax, ".cc": cSyntax,
+	".hpp": cSyntax, ".cs": cSyntax, ".swift": cSyntax, ".kt": cSyntax,
+	".scala": cSyntax, ".php": cSyntax,
+	".py": hashSyntax, ".rb": hashSyntax, ".sh": hashSyntax, ".pl": hashSyntax,
+}
+
+// codeKeywords are left out of identifier output; they say nothing about the code
+var codeKeywords = map[string]bool{
+	"func": true, "function": true, "def": true, "return": true, "if": true,
+	"else": true, "elif": true, "for": true, "while": true, "do": true,
+	"switch": true, "case": true, "default": true, "break": true, "continue": true,
+	"var": true, "let": true, "const": true, "class": true, "struct": true,
+	"interface": true, "type": true, "import": true, "package": true, "from": true,
+	"public": true, "private": true, "protected": true, "static": true, "void": true,
+	"int": true, "string": true, "bool": true, "true": true, "false": true,
+	"nil": true, "null": true, "none": true, "new": true, "this": true,
+	"self": true, "try": true, "catch": true, "finally": true, "throw": true,
+	"throws": true, "raise": true, "except": true, "with": true, "as": true,
+	"in": true, "is": true, "not": true, "and": true, "or": true,
+	"go": true, "defer": true, "range": true, "map": true, "chan": true,
+	"select": true, "extends": true, "implements": true, "async": true, "await": true,
+	"end": true, "then": true, "fi": true, "lambda": true, "pass": true,
+}
+
+// codeSpan is a run of source text of one kind
+type codeSpan struct {
+	kind int
+	text string
+}
+
+const (
+	spanCode = iota
+	spanComment
+	spanString
+)
+
+// extractCode extracts comments and strings, or split identifiers, from a source file
+func extractCode(src source) (*ExtractionResult, error) {
+	if src.cfg.codeMode == CodeRaw {
+		return extractPlain(src)
+	}
+	content, err := src.readAll()
+	if err != nil {
+		return nil, err
+	}
+	text, enc := decodeText(content)
+
+	var sb strings.Builder
+	for _, span := range scanCode(text, codeSyntaxes[src.ext]) {
+		switch {
+		case src.cfg.codeMode == CodeComments && span.kind != spanCode:
+			// Single characters are char literals, not text
+			if line := strings.Join(strings.Fields(span.text), " "); len([]rune(line)) > 1 {
+				sb.WriteString(line)
+				sb.WriteString("\n")
+			}
+		case src.cfg.codeMode == CodeIdentifiers && span.kind == spanCode:
+			writeIdentifierWords(&sb, span.text)
+		}
+	}
+
+	fullText := sb.String()
+	res := &ExtractionResult{
+		FullText: fullText,
+		Pages:    []string{fullText},
+	}
+	res.setMeta(MetaEncoding, enc)
+	return res, nil
+}
+
+// scanCode splits source text into code, comment and string spans
+func scanCode(text string, syn codeSyntax) []codeSpan {
+	var spans []codeSpan
+	var code strings.Builder
+	add := func(kind int, s string) {
+		if code.Len() > 0 {
+			spans = append(spans, codeSpan{spanCode, code.String()})
+			code.Reset()
+		}
+		spans = append(spans, codeSpan{kind, s})
+	}
+
+	pos := 0
+	for pos < len(text) {
+		rest := text[pos:]
+
+		if lc := matchPrefix(rest, syn.lineComments); lc != "" {
+			end := strings.IndexByte(rest, '\n')
+			if end == -1 {
+				end = len(rest)
+			}
+			add(spanComment, strings.TrimLeft(rest[len(lc):end], "/#!* "))
+			pos += end
+			continue
+		}
+
+		if bc, ok := matchBlockComment(rest, syn.blockComments); ok {
+			body := rest[len(bc[0]):]
+			end := strings.Index(body, bc[1])
+			if end == -1 {
+				add(spanComment, stripCommentStars(body))
+				pos = len(text)
+				continue
+			}
+			add(spanComment, stripCommentStars(body[:end]))
+			pos += len(bc[0]) + end + len(bc[1])
+			continue
+		}
+
+		if syn.tripleQuotes && (strings.HasPrefix(rest, `"""`) || strings.HasPrefix(rest, `'''`)) {
+			delim := rest[:3]
+			end := strings.Index(rest[3:], delim)
+			if end == -1 {
+				add(spanString, rest[3:])
+				pos = len(text)
+				continue
+			}
+			add(spanString, rest[3:3+end])
+			pos += 3 + end + 3
+			continue
+		}
+
+		c := rest[0]
+		if strings.IndexByte(syn.quotes, c) != -1 || (syn.rawBackticks && c == '`') {
+			i := 1
+			for i < len(rest) && rest[i] != c && (rest[i] != '\n' || c == '`') {
+				// Backslash escapes, except in raw backtick strings
+				if rest[i] == '\\' && c != '`' {
+					i++
+				}
+				i++
+			}
+			if i >= len(rest) {
+				add(spanString, rest[1:])
+				pos = len(text)
+				continue
+			}
+			add(spanString, rest[1:i])
+			pos += i
+			// Step over the closing quote; an unterminated string ends at the newline
+			if rest[i] == c {
+				pos++
+			}
+			continue
+		}
+
+		code.WriteByte(c)
+		pos++
+	}
+	if code.Len() > 0 {
+		spans = append(spans, codeSpan{spanCode, code.String()})
+	}
+	return spans
+}
+
+// matchPrefix returns the first of prefixes that s starts with, or ""
+func matchPrefix(s string, prefixes []string) string {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return p
+		}
+	}
+	return ""
+}
+
+// matchBlockComment returns the block comment delimiters s starts with
+func matchBlockComment(s string, delims [][2]string) ([2]string, bool) {
+	for _, d := range delims {
+		if strings.HasPrefix(s, d[0]) {
+			return d, true
+		}
+	}
+	return [2]string{}, false
+}
+
+// stripCommentStars removes the leading " * " of each line of a block comment
+func stripCommentStars(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimLeft(strings.TrimSpace(line), "*")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// writeIdentifierWords writes the identifiers of a code span as lowercase
+// words, one line per source line: parseHTTPResponse_v2 -> parse http response v 2
+func writeIdentifierWords(sb *strings.Builder, code string) {
+	for _, line := range strings.Split(code, "\n") {
+		var words []string
+		for _, ident := range strings.FieldsFunc(line, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+		}) {
+			if unicode.IsDigit([]rune(ident)[0]) || codeKeywords[strings.ToLower(ident)] {
+				continue
+			}
+			words = append(words, splitIdentifier(ident)...)
+		}
+		if len(words) > 0 {
+			sb.WriteString(strings.Join(words, " "))
+			sb.WriteString("\n")
+		}
+	}
+}
+
+// splitIdentifier splits camelCase, PascalCase, snake_case and acronyms into
+// lowercase words
+func splitIdentifier(ident string) []string {
+	var words []string
+	var cur []rune
+	flush := func() {
+		if len(cur) > 0 {
+			words = append(words, strings.ToLower(string(cur)))
+			cur = cur[:0]
+		}
+	}
+
+	runes := []rune(ident)
+	for i, r := range runes {
+		switch {
+		case r == '_':
+			flush()
+			continue
+		case i > 0 && unicode.IsUpper(r):
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			// fooBar, HTTPServer (split before the S), x2Y
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				flush()
+			}
+		case i > 0 && unicode.IsDigit(r) != unicode.IsDigit(runes[i-1]) && runes[i-1] != '_':
+			flush()
+		}
+		cur = append(cur, r)
+	}
+	flush()
+	return words
+}
@@ -0,0 +1,232 @@
+package pkg
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// StepCollocations is the cache step that scores 2- and 3-grams as
+// collocations
+const StepCollocations = "collocations"
+
+// maxCollocationN is the longest n-gram scored: the association measures
+// compare an n-gram with its parts, and past three words those parts are
+// n-grams with counts of their own rather than words
+const maxCollocationN = 3
+
+// Collocation is an n-gram scored by how much more often its words occur
+// together than they would by chance. PMI is the log2 ratio of its count to
+// the count expected if its words were independent; it favors rare n-grams.
+// LLR is Dunning's log-likelihood ratio (G²) of the n-gram's first n-1 words
+// being followed by its last word, which weighs that against how often it
+// was seen, so frequent and strongly bound n-grams both rank high.
+type Collocation struct {
+	Key   string // "w1|w2" word indices, as in {n}gramfreq.txt
+	Count int
+	PMI   float64
+	LLR   float64
+}
+
+// BuildCollocationCache scores the 2- and 3-grams of {n}gramfreq.txt with
+// word counts from tfidf.txt and writes them to {n}gramcolloc.txt, one
+// "key,count,pmi,llr" line each, highest LLR first
+func BuildCollocationCache(ctx context.Context, outputDir string, maxN int) error {
+	if maxN > maxCollocationN {
+		logger.Warn("Limiting collocations", "words", maxCollocationN, "asked", maxN)
+		maxN = maxCollocationN
+	}
+	logger.Info("Building collocation cache", "dir", outputDir, "maxN", maxN)
+	reporter.OnStage(StepCollocations)
+
+	if maxN < 2 {
+		return fmt.Errorf("collocations need at least 2 words (use -ngrams 2 or more)")
+	}
+	if err := beginStep(outputDir, StepCollocations); err != nil {
+		return err
+	}
+
+	for n := 2; n <= maxN; n++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		logger.Info("Scoring n-grams", "n", n)
+		colls, err := ScoreCollocations(outputDir, n)
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(outputDir, fmt.Sprintf("%dgramcolloc.txt", n))
+		if err := writeCollocations(path, colls); err != nil {
+			return err
+		}
+		logger.Info("Written", "path", path, "ngrams", len(colls))
+	}
+
+	logger.Info("Done")
+	return finishStep(outputDir, StepCollocations, maxN, ngramArtifacts(maxN, "%dgramcolloc.txt")...)
+}
+
+// ScoreCollocations scores every n-gram of {n}gramfreq.txt (n = 2 or 3),
+// highest LLR first. Word counts come from tfidf.txt, and the n-1 word
+// prefixes of 3-grams from 2gramfreq.txt. The corpus size is the total word
+// count, so n-grams crossing file or sentence boundaries are not discounted.
+func ScoreCollocations(cacheDir string, n int) ([]Collocation, error) {
+	if n < 2 || n > maxCollocationN {
+		return nil, fmt.Errorf("collocations are scored for 2- and 3-grams, not %d-grams", n)
+	}
+	stats, err := LoadTermStats(cacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s (run -cache tfidf first): %w", TFIDFName, err)
+	}
+	var wordCounts []float64
+	total := 0.0
+	for _, s := range stats {
+		for len(wordCounts) <= s.Word {
+			wordCounts = append(wordCounts, 0)
+		}
+		wordCounts[s.Word] = float64(s.TF)
+		total += float64(s.TF)
+	}
+	count := func(word int) float64 {
+		if word >= 0 && word < len(wordCounts) {
+			return wordCounts[word]
+		}
+		return 0
+	}
+
+	var prefixCounts map[string]int
+	if n == 3 {
+		prefixCounts = make(map[string]int)
+		err := scanFreqFile(filepath.Join(cacheDir, "2gramfreq.txt"), func(key string, c int) {
+			prefixCounts[key] = c
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not read 2gramfreq.txt (run -cache ngramfreq first): %w", err)
+		}
+	}
+
+	var colls []Collocation
+	name := fmt.Sprintf("%dgramfreq.txt", n)
+	words := make([]int, n)
+	err = scanFreqFile(filepath.Join(cacheDir, name), func(key string, c int) {
+		parts := strings.Split(key, "|")
+		if len(parts) != n {
+			return
+		}
+		for i, p := range parts {
+			w, err := strconv.Atoi(p)
+			if err != nil {
+				return
+			}
+			words[i] = w
+		}
+
+		observed := float64(c)
+		expected := total
+		for _, w := range words {
+			expected *= count(w) / total
+		}
+		if expected == 0 {
+			return
+		}
+		// The LLR table splits the n-gram into its first n-1 words and its
+		// last word. A 3-gram's 2-word prefix occurs at least as often as the
+		// 3-gram, unless the stopword filter dropped it from 2gramfreq.txt.
+		prefix := count(words[0])
+		if n == 3 {
+			prefix = math.Max(observed, float64(prefixCounts[parts[0]+"|"+parts[1]]))
+		}
+		last := count(words[n-1])
+		colls = append(colls, Collocation{
+			Key:   key,
+			Count: c,
+			PMI:   math.Log2(observed / expected),
+			LLR: logLikelihood(observed, math.Max(0, prefix-observed), math.Max(0, last-observed),
+				math.Max(0, total-prefix-last+observed)),
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s (run -cache ngramfreq first): %w", name, err)
+	}
+	sortCollocations(colls)
+	return colls, nil
+}
+
+// logLikelihood is Dunning's G² for a 2x2 contingency table: k11 times the
+// prefix followed by the last word, k12 the prefix followed by another word,
+// k21 another prefix followed by the last word, and k22 neither
+func logLikelihood(k11, k12, k21, k22 float64) float64 {
+	n := k11 + k12 + k21 + k22
+	if n == 0 {
+		return 0
+	}
+	term := func(k, row, col float64) float64 {
+		if k == 0 {
+			return 0
+		}
+		return k * math.Log(k*n/(row*col))
+	}
+	r1, r2 := k11+k12, k21+k22
+	c1, c2 := k11+k21, k12+k22
+	return 2 * (term(k11, r1, c1) + term(k12, r1, c2) + term(k21, r2, c1) + term(k22, r2, c2))
+}
+
+func sortCollocations(colls []Collocation) {
+	sort.Slice(colls, func(i, j int) bool {
+		if colls[i].LLR != colls[j].LLR {
+			return colls[i].LLR > colls[j].LLR
+		}
+		if colls[i].Count != colls[j].Count {
+			return colls[i].Count > colls[j].Count
+		}
+		return colls[i].Key < colls[j].Key
+	})
+}
+
+// writeCollocations writes {n}gramcolloc.txt
+func writeCollocations(path string, colls []Collocation) error {
+	out, err := CreateCacheFile(path)
+	if err != nil {
+		return err
+	}
+	defer AbortCacheFile(out)
+	writer := bufio.NewWriter(out)
+	for _, c := range colls {
+		fmt.Fprintf(writer, "%s,%d,%.4f,%.4f\n", c.Key, c.Count, c.PMI, c.LLR)
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// LoadCollocations returns the first top collocations (0 = all) of
+// {n}gramcolloc.txt, highest LLR first
+func LoadCollocations(cacheDir string, n, top int) ([]Collocation, error) {
+	f, err := OpenCacheFile(filepath.Join(cacheDir, fmt.Sprintf("%dgramcolloc.txt", n)))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var colls []Collocation
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	for scanner.Scan() && (top <= 0 || len(colls) < top) {
+		fields := strings.Split(scanner.Text(), ",")
+		if len(fields) != 4 {
+			continue
+		}
+		c := Collocation{Key: fields[0]}
+		c.Count, _ = strconv.Atoi(fields[1])
+		c.PMI, _ = strconv.ParseFloat(fields[2], 64)
+		c.LLR, _ = strconv.ParseFloat(fields[3], 64)
+		colls = append(colls, c)
+	}
+	return colls, scanner.Err()
+}
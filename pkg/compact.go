@@ -0,0 +1,583 @@
+package pkg
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/RoaringBitmap/roaring/v2"
+)
+
+// CompactCache rewrites a cache without the files whose token file was
+// deleted from the input directory and without the words that no remaining
+// file contains. Files and words are renumbered in their existing order, and
+// every artifact that refers to them is rewritten with the new numbers: the
+// vocabulary and file lists, the word and n-gram indexes, the n-gram
+// frequency, count and reverse files, skip-grams, ID streams, positions,
+// statistics and the incremental state.
+//
+// Frequencies are remapped, not recounted. N-grams found only in removed
+// files are dropped where the n-gram index of their n exists, but n-grams
+// shared with remaining files keep the occurrences the removed files added.
+//
+// ctx stops the compaction only until it starts rewriting the cache.
+func CompactCache(ctx context.Context, cacheDir string) error {
+	logger.Info("Compacting cache", "dir", cacheDir)
+
+	inputDir := readCacheInput(cacheDir)
+	if inputDir == "" {
+		return fmt.Errorf("could not find input path in settings.txt (run -cache tokens first)")
+	}
+	words, err := readLines(filepath.Join(cacheDir, "uniq.txt"))
+	if err != nil {
+		return fmt.Errorf("could not read uniq.txt (run -cache tokens first): %w", err)
+	}
+	files, err := readLines(filepath.Join(cacheDir, "files.txt"))
+	if err != nil {
+		return fmt.Errorf("could not read files.txt (run -cache tokens first): %w", err)
+	}
+	indexPath := filepath.Join(cacheDir, "fileuniqindex.txt")
+	actualIndex, ok := ResolveCacheFile(indexPath)
+	if !ok {
+		return fmt.Errorf("compaction needs fileuniqindex.txt to find unused words (run -cache index first)")
+	}
+
+	// Files whose token file is gone are dead
+	fileMap := make([]int, len(files))
+	var newFiles []string
+	for i, relPath := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		fileMap[i] = -1
+		if fileExists(filepath.Join(inputDir, relPath)) {
+			fileMap[i] = len(newFiles)
+			newFiles = append(newFiles, relPath)
+		}
+	}
+
+	// Words that no remaining file contains are unused
+	postings := make([]*roaring.Bitmap, len(words))
+	err = scanIndexFile(indexPath, func(wIdx int, set *roaring.Bitmap) {
+		if wIdx < len(words) {
+			postings[wIdx] = remapFiles(set, fileMap)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("could not read fileuniqindex.txt: %w", err)
+	}
+	wordMap := make([]int, len(words))
+	var newWords []string
+	var newPostings []*roaring.Bitmap
+	for i, word := range words {
+		wordMap[i] = -1
+		if postings[i] != nil && !postings[i].IsEmpty() {
+			wordMap[i] = len(newWords)
+			newWords = append(newWords, word)
+			newPostings = append(newPostings, postings[i])
+		}
+	}
+	postings = nil
+
+	logger.Info("Compacted", "files", len(files), "newFiles", len(newFiles), "words", len(words), "newWords", len(newWords))
+	if len(newFiles) == len(files) && len(newWords) == len(words) {
+		logger.Info("Cache is already compact")
+		return nil
+	}
+	if fileExists(filepath.Join(cacheDir, fileHashesName)) && len(newFiles) < len(files) {
+		logger.Info("Note: analyze -incremental removes deleted files with exact n-gram counts; compaction only remaps them")
+	}
+
+	// The cache is rewritten in place from here, which is not stopped halfway
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Until every artifact is rewritten the cache mixes old and new numbers,
+	// so the manifest shows no step as complete
+	var built map[string]int
+	if m, err := LoadManifest(cacheDir); err == nil {
+		built = make(map[string]int)
+		for step, s := range m.Steps {
+			if !s.Completed.IsZero() {
+				built[step] = s.MaxN
+			}
+		}
+		if err := beginStep(cacheDir, StepTokens); err != nil {
+			return err
+		}
+	}
+
+	// Rewrite everything with the codec the cache was built with
+	savedCodec := cacheCodec
+	cacheCodec = codecOf(actualIndex)
+	defer func() { cacheCodec = savedCodec }()
+
+	if err := writeLines(filepath.Join(cacheDir, "uniq.txt"), newWords); err != nil {
+		return err
+	}
+	if err := writeLines(filepath.Join(cacheDir, "files.txt"), newFiles); err != nil {
+		return err
+	}
+	if err := writeIndexFile(indexPath, newPostings); err != nil {
+		return err
+	}
+
+	maxN := 1
+	for n := 2; hasNgramArtifacts(cacheDir, n); n++ {
+		maxN = n
+	}
+	for n := 2; n <= maxN; n++ {
+		logger.Info("Remapping n-grams", "n", n)
+		gone, ngramMap, err := compactNgramIndex(cacheDir, n, wordMap, fileMap)
+		if err != nil {
+			return fmt.Errorf("could not compact the %d-gram index: %w", n, err)
+		}
+		for _, pattern := range []string{"%dgramfreq.txt", "%dgramcounts.txt", "%dskipgramfreq.txt"} {
+			path := filepath.Join(cacheDir, fmt.Sprintf(pattern, n))
+			if !CacheFileExists(path) {
+				continue
+			}
+			if err := compactCounts(path, wordMap, gone); err != nil {
+				return fmt.Errorf("could not compact %s: %w", path, err)
+			}
+		}
+		path := filepath.Join(cacheDir, fmt.Sprintf("%dgramfiles.txt", n))
+		if CacheFileExists(path) {
+			if err := compactNgramFiles(path, fileMap, ngramMap, len(newFiles)); err != nil {
+				return fmt.Errorf("could not compact %s: %w", path, err)
+			}
+		}
+	}
+
+	if hasDocs(cacheDir) {
+		logger.Info("Remapping ID streams")
+		if err := compactDocs(cacheDir, fileMap, wordMap); err != nil {
+			return err
+		}
+	}
+	if fileExists(filepath.Join(cacheDir, PositionsName)) {
+		logger.Info("Remapping positions")
+		path := filepath.Join(cacheDir, PositionsName)
+		if err := writeRemappedPositions(path, len(newFiles), []cacheRemap{{cacheDir, fileMap, wordMap}}); err != nil {
+			return err
+		}
+	}
+	if fileExists(filepath.Join(cacheDir, StatsName)) {
+		if err := compactStats(cacheDir, fileMap, newPostings, len(newFiles)); err != nil {
+			return err
+		}
+	}
+	if states, err := loadFileStates(cacheDir); err == nil {
+		removeUnusedSnapshots(cacheDir, newFiles, states)
+		if err := writeFileStates(cacheDir, newFiles, states); err != nil {
+			return err
+		}
+	}
+	// The bolt databases are keyed by the old word numbers
+	os.Remove(filepath.Join(cacheDir, NgramCountsDB))
+	os.Remove(filepath.Join(cacheDir, NgramPostingsDB))
+
+	if _, inputFiles, err := inputChecksum(inputDir); err == nil && inputFiles > len(newFiles) {
+		logger.Warn("Token files not in the cache; add them with analyze -incremental or rebuild",
+			"input", inputDir, "files", inputFiles-len(newFiles))
+	}
+	if built != nil {
+		// TF-IDF weights need the term frequencies of the remaining files,
+		// so that step is rebuilt below
+		delete(built, StepTFIDF)
+		if err := recordRewrittenSteps(cacheDir, built, maxN); err != nil {
+			return err
+		}
+	}
+	if CacheFileExists(filepath.Join(cacheDir, TFIDFName)) {
+		if err := BuildTFIDFCache(ctx, cacheDir); err != nil {
+			return err
+		}
+	}
+	// normuniq.txt follows the old uniq.txt, filedates.txt the old files.txt
+	if err := rebuildNormalizedVocab(cacheDir); err != nil {
+		return err
+	}
+	if CacheFileExists(filepath.Join(cacheDir, FileDatesName)) {
+		if err := BuildDatesCache(ctx, cacheDir); err != nil {
+			return err
+		}
+	}
+	// The collocations are keyed by the old word numbers and scored with
+	// the old counts
+	if CacheFileExists(filepath.Join(cacheDir, "2gramcolloc.txt")) {
+		if err := BuildCollocationCache(ctx, cacheDir, maxN); err != nil {
+			return err
+		}
+	}
+	// duplicates.txt lists the old file numbers
+	if fileExists(filepath.Join(cacheDir, DuplicatesName)) {
+		if err := BuildDedupCache(ctx, cacheDir); err != nil {
+			return err
+		}
+	}
+
+	logger.Info("Done! Cache compacted", "dir", cacheDir)
+	return nil
+}
+
+// hasNgramArtifacts reports whether a cache has any per-n file for n
+func hasNgramArtifacts(cacheDir string, n int) bool {
+	if len(NgramIndexParts(cacheDir, n)) > 0 {
+		return true
+	}
+	for _, pattern := range []string{"%dgramfreq.txt", "%dgramcounts.txt", "%dgramfiles.txt", "%dskipgramfreq.txt"} {
+		if CacheFileExists(filepath.Join(cacheDir, fmt.Sprintf(pattern, n))) {
+			return true
+		}
+	}
+	return false
+}
+
+// remapFiles renumbers a file set, dropping dead files
+func remapFiles(set *roaring.Bitmap, fileMap []int) *roaring.Bitmap {
+	out := roaring.New()
+	it := set.Iterator()
+	for it.HasNext() {
+		if f := int(it.Next()); f < len(fileMap) && fileMap[f] >= 0 {
+			out.Add(uint32(fileMap[f]))
+		}
+	}
+	return out
+}
+
+// compactNgramIndex rewrites the n-gram index of n, keeping its shard count.
+// It returns the old keys of the n-grams that no remaining file contains and
+// the new global number of every old one (-1 if dropped).
+func compactNgramIndex(cacheDir string, n int, wordMap, fileMap []int) (map[string]bool, []int, error) {
+	parts := NgramIndexParts(cacheDir, n)
+	if len(parts) == 0 {
+		return nil, nil, nil
+	}
+	type entry struct {
+		idx   int
+		key   string
+		files *roaring.Bitmap
+	}
+	var entries []entry
+	maxIdx := -1
+	err := scanNgramIndex(cacheDir, n, func(idx int, key string, files *roaring.Bitmap) {
+		entries = append(entries, entry{idx, key, files})
+		maxIdx = max(maxIdx, idx)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].idx < entries[j].idx })
+
+	gone := make(map[string]bool)
+	ngramMap := make([]int, maxIdx+1)
+	for i := range ngramMap {
+		ngramMap[i] = -1
+	}
+	kept := entries[:0]
+	var keys []string
+	for _, e := range entries {
+		files := remapFiles(e.files, fileMap)
+		key, ok := remapNgramKey(e.key, wordMap)
+		if !ok || files.IsEmpty() {
+			gone[e.key] = true
+			continue
+		}
+		ngramMap[e.idx] = len(kept)
+		kept = append(kept, entry{e.idx, key, files})
+		keys = append(keys, key)
+	}
+
+	w, err := createNgramIndex(cacheDir, n, ngramShardCounts(keys, len(parts)))
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, e := range kept {
+		if err := w.add(e.key, e.files); err != nil {
+			w.abort()
+			return nil, nil, err
+		}
+	}
+	logger.Info("Index", "n", n, "ngrams", len(entries), "kept", len(kept))
+	return gone, ngramMap, w.close()
+}
+
+// compactCounts rewrites a "key,count" file with new word numbers, dropping
+// keys with an unused word or listed in gone. The order is kept.
+func compactCounts(path string, wordMap []int, gone map[string]bool) error {
+	in, err := OpenCacheFile(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := CreateCacheFile(path)
+	if err != nil {
+		return err
+	}
+	defer AbortCacheFile(out)
+
+	writer := bufio.NewWriter(out)
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		comma := strings.LastIndex(line, ",")
+		if comma == -1 || gone[line[:comma]] {
+			continue
+		}
+		if key, ok := remapNgramKey(line[:comma], wordMap); ok {
+			writer.WriteString(key)
+			writer.WriteString(line[comma:])
+			writer.WriteString("\n")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// compactNgramFiles rewrites {n}gramfiles.txt with new file and n-gram
+// numbers. A nil ngramMap keeps the n-gram numbers.
+func compactNgramFiles(path string, fileMap, ngramMap []int, fileCount int) error {
+	byFile := make([]*roaring.Bitmap, fileCount)
+	for i := range byFile {
+		byFile[i] = roaring.New()
+	}
+	if err := remapNgramFiles(byFile, path, fileMap, ngramMap); err != nil {
+		return err
+	}
+	return writeNgramFiles(path, byFile)
+}
+
+// remapNgramFiles adds the n-grams of every file in the {n}gramfiles.txt at
+// path to byFile, under new file and n-gram numbers
+func remapNgramFiles(byFile []*roaring.Bitmap, path string, fileMap, ngramMap []int) error {
+	return scanIndexFile(path, func(fIdx int, ngrams *roaring.Bitmap) {
+		if fIdx >= len(fileMap) || fileMap[fIdx] < 0 {
+			return
+		}
+		if ngramMap == nil {
+			byFile[fileMap[fIdx]].Or(ngrams)
+			return
+		}
+		it := ngrams.Iterator()
+		for it.HasNext() {
+			if nIdx := int(it.Next()); nIdx < len(ngramMap) && ngramMap[nIdx] >= 0 {
+				byFile[fileMap[fIdx]].Add(uint32(ngramMap[nIdx]))
+			}
+		}
+	})
+}
+
+// writeNgramFiles writes {n}gramfiles.txt, one line per file
+func writeNgramFiles(path string, byFile []*roaring.Bitmap) error {
+	out, err := CreateCacheFile(path)
+	if err != nil {
+		return err
+	}
+	defer AbortCacheFile(out)
+	writer := bufio.NewWriter(out)
+	for fIdx, ngrams := range byFile {
+		writeIndexLine(writer, fIdx, ngrams)
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// compactDocs rewrites the ID streams into a new docs/ directory, which
+// replaces the old one once every stream is written
+func compactDocs(cacheDir string, fileMap, wordMap []int) error {
+	docsDir := filepath.Join(cacheDir, docsDirName)
+	newDir := docsDir + tmpSuffix
+	if err := os.RemoveAll(newDir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(newDir, 0755); err != nil {
+		return err
+	}
+	if err := remapDocs(cacheRemap{cacheDir, fileMap, wordMap}, newDir); err != nil {
+		os.RemoveAll(newDir)
+		return err
+	}
+	if err := os.RemoveAll(docsDir); err != nil {
+		return err
+	}
+	return os.Rename(newDir, docsDir)
+}
+
+// cacheRemap renumbers the files and words of one cache; -1 drops an entry
+type cacheRemap struct {
+	dir     string
+	fileMap []int
+	wordMap []int
+}
+
+// remapWords renumbers the words of file fileIdx read from src
+func (r cacheRemap) remapWords(words []int, fileIdx int, src string) error {
+	for i, w := range words {
+		if w < 0 || w >= len(r.wordMap) || r.wordMap[w] < 0 {
+			return fmt.Errorf("%s: %s of file %d has word %d, which is not in the word index (rebuild it)", r.dir, src, fileIdx, w)
+		}
+		words[i] = r.wordMap[w]
+	}
+	return nil
+}
+
+// remapDocs writes the ID streams and sentence breaks of the files r keeps
+// into dstDir under their new numbers
+func remapDocs(r cacheRemap, dstDir string) error {
+	for oldIdx, newIdx := range r.fileMap {
+		if newIdx < 0 {
+			continue
+		}
+		ids, err := ReadDocIDs(r.dir, oldIdx)
+		if err != nil {
+			return fmt.Errorf("could not read ID stream of file %d (rebuild with -cache docs): %w", oldIdx, err)
+		}
+		if err := r.remapWords(ids, oldIdx, "ID stream"); err != nil {
+			return err
+		}
+		name := strconv.Itoa(newIdx)
+		if err := writeDocIDs(filepath.Join(dstDir, name+".ids"), ids); err != nil {
+			return err
+		}
+		if err := copyFile(docBreaksPath(r.dir, oldIdx), filepath.Join(dstDir, name+".brk")); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := createAtomic(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Abort()
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// writeRemappedPositions writes a positional index of fileCount files at path
+// from the positions of the files each source keeps
+func writeRemappedPositions(path string, fileCount int, sources []cacheRemap) error {
+	f, err := createAtomic(path)
+	if err != nil {
+		return err
+	}
+	defer f.Abort()
+
+	pos := uint64(len(positionsMagic) + 4 + 12*fileCount)
+	if _, err := f.Seek(int64(pos), io.SeekStart); err != nil {
+		return err
+	}
+	offsets := make([]uint64, fileCount)
+	lengths := make([]uint32, fileCount)
+	writer := bufio.NewWriter(f)
+	for _, r := range sources {
+		p, err := OpenPositions(r.dir)
+		if err != nil {
+			return err
+		}
+		for oldIdx, newIdx := range r.fileMap {
+			if newIdx < 0 || oldIdx >= p.Len() {
+				continue
+			}
+			words, err := p.Words(oldIdx)
+			if err == nil {
+				err = r.remapWords(words, oldIdx, "positions")
+			}
+			if err != nil {
+				p.Close()
+				return err
+			}
+			block := encodePositions(words)
+			if _, err := writer.Write(block); err != nil {
+				p.Close()
+				return err
+			}
+			offsets[newIdx], lengths[newIdx] = pos, uint32(len(block))
+			pos += uint64(len(block))
+		}
+		p.Close()
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	if _, err := f.WriteAt(positionsHeader(offsets, lengths), 0); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// compactStats renumbers stats.txt and recomputes stats.json, taking each
+// word's first file from its postings
+func compactStats(cacheDir string, fileMap []int, postings []*roaring.Bitmap, fileCount int) error {
+	tokens := make([]int, fileCount)
+	rows := make([]string, fileCount)
+	for i := range rows {
+		rows[i] = fmt.Sprintf("%d,0,0", i)
+	}
+	if err := remapStats(rows, tokens, cacheDir, fileMap); err != nil {
+		return err
+	}
+	return writeRemappedStats(cacheDir, rows, tokens, postings)
+}
+
+// remapStats fills rows and tokens from the stats.txt of cacheDir, under new
+// file numbers
+func remapStats(rows []string, tokens []int, cacheDir string, fileMap []int) error {
+	lines, err := readLines(filepath.Join(cacheDir, StatsName))
+	if err != nil {
+		return err
+	}
+	for i, line := range lines {
+		fields := strings.Split(line, ",")
+		if len(fields) != 3 {
+			return fmt.Errorf("%s line %d: expected 3 fields, got %d", StatsName, i+1, len(fields))
+		}
+		oldIdx, err := strconv.Atoi(fields[0])
+		if err != nil || oldIdx >= len(fileMap) || fileMap[oldIdx] < 0 {
+			continue
+		}
+		newIdx := fileMap[oldIdx]
+		if tokens[newIdx], err = strconv.Atoi(fields[1]); err != nil {
+			return fmt.Errorf("%s line %d: %w", StatsName, i+1, err)
+		}
+		rows[newIdx] = fmt.Sprintf("%d,%s,%s", newIdx, fields[1], fields[2])
+	}
+	return nil
+}
+
+// writeRemappedStats writes stats.txt and stats.json
+func writeRemappedStats(cacheDir string, rows []string, tokens []int, postings []*roaring.Bitmap) error {
+	if err := writeLines(filepath.Join(cacheDir, StatsName), rows); err != nil {
+		return err
+	}
+	firstFile := make([]int32, len(postings))
+	for w, set := range postings {
+		firstFile[w] = int32(set.Minimum())
+	}
+	return writeCorpusStats(cacheDir, corpusStats(tokens, firstFile))
+}
@@ -0,0 +1,187 @@
+package pkg
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression codecs for the large text artifacts of a cache
+const (
+	CodecNone = "none"
+	CodecGzip = "gzip"
+	CodecZstd = "zstd"
+)
+
+// codecExt maps each codec to the suffix appended to compressed artifacts
+var codecExt = map[string]string{
+	CodecNone: "",
+	CodecGzip: ".gz",
+	CodecZstd: ".zst",
+}
+
+// cacheCodec compresses the per-n artifacts and fileuniqindex.txt
+var cacheCodec = CodecNone
+
+// SetCacheCompression sets the codec the cache builders compress the per-n
+// text artifacts and fileuniqindex.txt with. Compressed files get a .gz or
+// .zst suffix; readers find and decompress them from the uncompressed name, so
+// a cache can mix codecs.
+func SetCacheCompression(codec string) error {
+	if _, ok := codecExt[codec]; !ok {
+		return fmt.Errorf("unknown compression %q (use '%s', '%s' or '%s')", codec, CodecNone, CodecGzip, CodecZstd)
+	}
+	cacheCodec = codec
+	return nil
+}
+
+// ResolveCacheFile returns the file on disk holding the artifact path names:
+// path itself or path with a codec suffix
+func ResolveCacheFile(path string) (string, bool) {
+	for _, ext := range []string{"", ".zst", ".gz"} {
+		if fileExists(path + ext) {
+			return path + ext, true
+		}
+	}
+	return path, false
+}
+
+// codecOf returns the codec a file on disk was written with, by its suffix
+func codecOf(path string) string {
+	for codec, ext := range codecExt {
+		if ext != "" && strings.HasSuffix(path, ext) {
+			return codec
+		}
+	}
+	return CodecNone
+}
+
+// CacheFileExists reports whether an artifact exists in any codec
+func CacheFileExists(path string) bool {
+	_, ok := ResolveCacheFile(path)
+	return ok
+}
+
+// OpenCacheFile opens an artifact by its uncompressed name, decompressing it
+// if it was written compressed
+func OpenCacheFile(path string) (io.ReadCloser, error) {
+	actual, ok := ResolveCacheFile(path)
+	if !ok {
+		return nil, fmt.Errorf("open %s: %w", path, os.ErrNotExist)
+	}
+	f, err := os.Open(actual)
+	if err != nil {
+		return nil, err
+	}
+
+	switch filepath.Ext(actual) {
+	case ".gz":
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s: %w", actual, err)
+		}
+		return &codecReader{Reader: zr, closeCodec: zr.Close, f: f}, nil
+	case ".zst":
+		zr, err := zstd.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s: %w", actual, err)
+		}
+		return &codecReader{Reader: zr, closeCodec: func() error { zr.Close(); return nil }, f: f}, nil
+	}
+	return f, nil
+}
+
+// CreateCacheFile creates an artifact under its uncompressed name, compressed
+// with the configured codec. The file only replaces the artifact when it is
+// closed; AbortCacheFile discards it instead. Copies in other codecs are
+// removed at the same time so readers never see a stale one.
+func CreateCacheFile(path string) (io.WriteCloser, error) {
+	f, err := createAtomic(path + codecExt[cacheCodec])
+	if err != nil {
+		return nil, err
+	}
+	for codec, ext := range codecExt {
+		if codec != cacheCodec {
+			f.replaces = append(f.replaces, path+ext)
+		}
+	}
+
+	switch cacheCodec {
+	case CodecGzip:
+		zw := gzip.NewWriter(f)
+		return &codecWriter{Writer: zw, closeCodec: zw.Close, f: f}, nil
+	case CodecZstd:
+		zw, err := zstd.NewWriter(f)
+		if err != nil {
+			f.Abort()
+			return nil, err
+		}
+		return &codecWriter{Writer: zw, closeCodec: zw.Close, f: f}, nil
+	}
+	return f, nil
+}
+
+// AbortCacheFile discards an artifact being written by CreateCacheFile,
+// leaving its previous version in place. It does nothing once the file was
+// closed.
+func AbortCacheFile(w io.WriteCloser) {
+	switch w := w.(type) {
+	case *atomicFile:
+		w.Abort()
+	case *codecWriter:
+		w.f.Abort()
+	}
+}
+
+// RemoveCacheFile removes an artifact in every codec
+func RemoveCacheFile(path string) {
+	for _, ext := range codecExt {
+		os.Remove(path + ext)
+	}
+}
+
+// cacheArtifacts maps artifact names to the names of the files holding them,
+// for the manifest
+func cacheArtifacts(cacheDir string, names []string) []string {
+	actual := make([]string, len(names))
+	for i, name := range names {
+		path, _ := ResolveCacheFile(filepath.Join(cacheDir, name))
+		actual[i] = name + path[len(filepath.Join(cacheDir, name)):]
+	}
+	return actual
+}
+
+type codecReader struct {
+	io.Reader
+	closeCodec func() error
+	f          *os.File
+}
+
+func (r *codecReader) Close() error {
+	r.closeCodec()
+	return r.f.Close()
+}
+
+type codecWriter struct {
+	io.Writer
+	closeCodec func() error
+	f          *atomicFile
+}
+
+func (w *codecWriter) Close() error {
+	if w.f.done {
+		return nil
+	}
+	if err := w.closeCodec(); err != nil {
+		w.f.Abort()
+		return err
+	}
+	return w.f.Close()
+}
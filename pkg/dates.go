@@ -0,0 +1,174 @@
+package pkg
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StepDates is the cache step that records a date for every file
+const StepDates = "dates"
+
+// FileDatesName holds one line per entry of files.txt, in file order:
+//
+//	fileIdx,unixSeconds,source
+//
+// source says where the date came from: "created" or "modified" from the
+// document's .meta.json sidecar (process -metadata), "mtime" for the source
+// document's modification time recorded there, "file" for the token file's
+// own modification time, or "none" (unixSeconds 0) when the file is gone.
+const FileDatesName = "filedates.txt"
+
+// Where a file's date came from, in order of preference
+const (
+	DateCreated  = "created"
+	DateModified = "modified"
+	DateMTime    = "mtime"
+	DateFile     = "file"
+	DateNone     = "none"
+)
+
+// FileDate is the date of one file of the cache
+type FileDate struct {
+	Time   time.Time // zero if unknown
+	Source string
+}
+
+// metaDateLayouts are the date forms found in document metadata
+var metaDateLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02", "2006-01", "2006"}
+
+// parseMetaDate reads a metadata date
+func parseMetaDate(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range metaDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// BuildDatesCache dates every file of files.txt and writes filedates.txt.
+// A document's creation date is preferred, as it says when its text was
+// written; converted documents carry it in their .meta.json sidecar.
+func BuildDatesCache(ctx context.Context, outputDir string) error {
+	logger.Info("Building file dates cache", "dir", outputDir)
+	reporter.OnStage(StepDates)
+
+	if err := beginStep(outputDir, StepDates); err != nil {
+		return err
+	}
+	dates, err := ReadFileDates(outputDir)
+	if err != nil {
+		return err
+	}
+
+	sources := make(map[string]int)
+	lines := make([]string, len(dates))
+	for i, d := range dates {
+		sec := int64(0)
+		if !d.Time.IsZero() {
+			sec = d.Time.Unix()
+		}
+		lines[i] = fmt.Sprintf("%d,%d,%s", i, sec, d.Source)
+		sources[d.Source]++
+	}
+	path := filepath.Join(outputDir, FileDatesName)
+	if err := writeLines(path, lines); err != nil {
+		return err
+	}
+	logger.Info("Written", "path", path, "files", len(dates),
+		DateCreated, sources[DateCreated], DateModified, sources[DateModified], DateMTime, sources[DateMTime],
+		DateFile, sources[DateFile], DateNone, sources[DateNone])
+
+	logger.Info("Done")
+	return finishStep(outputDir, StepDates, 0, FileDatesName)
+}
+
+// ReadFileDates dates the files of files.txt from their sidecars and token
+// files in the input directory of settings.txt, without writing anything
+func ReadFileDates(cacheDir string) ([]FileDate, error) {
+	tokenInputDir := readCacheInput(cacheDir)
+	if tokenInputDir == "" {
+		return nil, fmt.Errorf("could not find input path in settings.txt (run -cache tokens first)")
+	}
+	files, err := readLines(filepath.Join(cacheDir, "files.txt"))
+	if err != nil {
+		return nil, fmt.Errorf("could not read files.txt (run -cache tokens first): %w", err)
+	}
+
+	dates := make([]FileDate, len(files))
+	for i, f := range files {
+		dates[i] = fileDate(tokenInputDir, f)
+	}
+	return dates, nil
+}
+
+// fileDate dates one token file. Pages of a document share its sidecar.
+func fileDate(inputDir, tokenPath string) FileDate {
+	sidecar := filepath.Join(inputDir, filepath.FromSlash(SourcePath(filepath.ToSlash(tokenPath)))+".meta.json")
+	if data, err := os.ReadFile(sidecar); err == nil {
+		var meta MetadataSidecar
+		if json.Unmarshal(data, &meta) == nil {
+			if t, ok := parseMetaDate(meta.Metadata[MetaCreated]); ok {
+				return FileDate{t, DateCreated}
+			}
+			if t, ok := parseMetaDate(meta.Metadata[MetaModified]); ok {
+				return FileDate{t, DateModified}
+			}
+			if t, ok := parseMetaDate(meta.Modified); ok {
+				return FileDate{t, DateMTime}
+			}
+		}
+	}
+	if info, err := os.Stat(filepath.Join(inputDir, tokenPath)); err == nil {
+		return FileDate{info.ModTime().UTC(), DateFile}
+	}
+	return FileDate{Source: DateNone}
+}
+
+// LoadFileDates reads filedates.txt, one date per file of files.txt
+func LoadFileDates(cacheDir string) ([]FileDate, error) {
+	f, err := OpenCacheFile(filepath.Join(cacheDir, FileDatesName))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var dates []FileDate
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ",")
+		if len(fields) != 3 {
+			continue
+		}
+		idx, err := strconv.Atoi(fields[0])
+		if err != nil || idx < 0 {
+			continue
+		}
+		for len(dates) <= idx {
+			dates = append(dates, FileDate{Source: DateNone})
+		}
+		d := FileDate{Source: fields[2]}
+		if sec, err := strconv.ParseInt(fields[1], 10, 64); err == nil && fields[2] != DateNone {
+			d.Time = time.Unix(sec, 0).UTC()
+		}
+		dates[idx] = d
+	}
+	return dates, scanner.Err()
+}
+
+// DateBucket names the period t falls in: "2024" by year, or "2024-03" by
+// month (the default)
+func DateBucket(t time.Time, period string) string {
+	if period == "year" {
+		return t.Format("2006")
+	}
+	return t.Format("2006-01")
+}
@@ -0,0 +1,232 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// StepDedup is the cache step that finds near-duplicate files
+const StepDedup = "dedup"
+
+// DuplicatesName is the near-duplicate report written by BuildDedupCache: one
+// "cluster,fileIdx,similarity" line per file in a cluster. Clusters are
+// numbered from the largest, and similarity is the estimated Jaccard
+// similarity of the file's shingles to those of its cluster's first file.
+const DuplicatesName = "duplicates.txt"
+
+// MinHash signatures have minhashSize values, split into minhashBands bands
+// for locality-sensitive hashing. Files agreeing on every value of any band
+// are compared; with 32 bands of 4 rows, pairs above about 0.5 similarity are
+// almost always compared, so thresholds below that may miss pairs.
+const (
+	minhashSize  = 128
+	minhashBands = 32
+)
+
+// dedupThreshold is the estimated similarity at which files are duplicates
+var dedupThreshold = 0.8
+
+// dedupShingle is the number of consecutive words in a shingle
+var dedupShingle = 5
+
+// SetDedupThreshold sets the estimated Jaccard similarity of their shingles
+// at or above which BuildDedupCache clusters two files (default 0.8)
+func SetDedupThreshold(similarity float64) {
+	dedupThreshold = min(1, max(0, similarity))
+}
+
+// SetDedupShingle sets how many consecutive words make a shingle (default 5).
+// Shorter shingles find files sharing wording; longer ones, shared passages.
+func SetDedupShingle(words int) {
+	dedupShingle = max(1, words)
+}
+
+// BuildDedupCache computes a MinHash signature of every file's shingles,
+// clusters the files whose signatures agree above the threshold and writes
+// the clusters to duplicates.txt
+func BuildDedupCache(ctx context.Context, outputDir string) error {
+	logger.Info("Finding near-duplicate files", "dir", outputDir, "shingle", dedupShingle, "threshold", dedupThreshold)
+	reporter.OnStage(StepDedup)
+
+	if err := beginStep(outputDir, StepDedup); err != nil {
+		return err
+	}
+
+	tokenInputDir := readCacheInput(outputDir)
+	if tokenInputDir == "" {
+		return fmt.Errorf("could not find input path in settings.txt (run -cache tokens first)")
+	}
+	words, err := readLines(filepath.Join(outputDir, "uniq.txt"))
+	if err != nil {
+		return fmt.Errorf("could not read uniq.txt (run -cache tokens first): %w", err)
+	}
+	filesList, err := readLines(filepath.Join(outputDir, "files.txt"))
+	if err != nil {
+		return fmt.Errorf("could not read files.txt (run -cache tokens first): %w", err)
+	}
+	logger.Info("Loaded cache", "words", len(words), "files", len(filesList))
+
+	seeds := minhashSeeds()
+	signatures := make([][]uint32, len(filesList))
+	src := newTokenSource(outputDir, tokenInputDir, indexWords(words))
+	err = forEachTokenFile(ctx, src, filesList, func(worker, fileIdx int, ids []int) error {
+		signatures[fileIdx] = minhashSignature(ids, dedupShingle, seeds)
+		return nil
+	}, func(done int) {
+		reporter.OnFile(done, len(filesList))
+	})
+	if err != nil {
+		return err
+	}
+
+	clusters := clusterSignatures(signatures, dedupThreshold)
+	var rows []string
+	duplicates := 0
+	for c, files := range clusters {
+		for _, f := range files {
+			sim := signatureSimilarity(signatures[files[0]], signatures[f])
+			rows = append(rows, fmt.Sprintf("%d,%d,%.4f", c, f, sim))
+		}
+		duplicates += len(files) - 1
+	}
+	path := filepath.Join(outputDir, DuplicatesName)
+	if err := writeLines(path, rows); err != nil {
+		return err
+	}
+
+	logger.Info("Near-duplicates found", "clusters", len(clusters), "duplicates", duplicates)
+	for c, files := range firstN(clusters, 10) {
+		logger.Info("Cluster", "cluster", c, "files", len(files), "first", filesList[files[0]])
+	}
+	if len(clusters) > 10 {
+		logger.Info("More clusters", "count", len(clusters)-10)
+	}
+	logger.Info("Done! Duplicates written", "path", path)
+	return finishStep(outputDir, StepDedup, 0, DuplicatesName)
+}
+
+// minhashSeeds returns the multipliers and offsets of the hash functions, odd
+// 64-bit constants from a fixed splitmix64 sequence so signatures are
+// reproducible
+func minhashSeeds() [][2]uint64 {
+	seeds := make([][2]uint64, minhashSize)
+	state := uint64(0x9e3779b97f4a7c15)
+	next := func() uint64 {
+		state += 0x9e3779b97f4a7c15
+		z := state
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		return z ^ (z >> 31)
+	}
+	for i := range seeds {
+		seeds[i] = [2]uint64{next() | 1, next()}
+	}
+	return seeds
+}
+
+// minhashSignature returns the minimum of every hash function over the
+// shingles of ids, or nil for an empty file. A file shorter than one shingle
+// is a single shingle.
+func minhashSignature(ids []int, shingle int, seeds [][2]uint64) []uint32 {
+	if len(ids) == 0 {
+		return nil
+	}
+	sig := make([]uint32, minhashSize)
+	for i := range sig {
+		sig[i] = ^uint32(0)
+	}
+	for start := 0; start == 0 || start+shingle <= len(ids); start++ {
+		// FNV-1a over the word indices of the shingle
+		h := uint64(14695981039346656037)
+		for _, id := range ids[start:min(len(ids), start+shingle)] {
+			h ^= uint64(id)
+			h *= 1099511628211
+		}
+		for i, s := range seeds {
+			if v := uint32((s[0]*h + s[1]) >> 32); v < sig[i] {
+				sig[i] = v
+			}
+		}
+	}
+	return sig
+}
+
+// signatureSimilarity estimates the Jaccard similarity of two files as the
+// share of signature values they agree on
+func signatureSimilarity(a, b []uint32) float64 {
+	if a == nil || b == nil {
+		return 0
+	}
+	same := 0
+	for i := range a {
+		if a[i] == b[i] {
+			same++
+		}
+	}
+	return float64(same) / float64(len(a))
+}
+
+// clusterSignatures groups files whose estimated similarity reaches threshold,
+// comparing only files that share a band. Clusters are linked transitively;
+// each lists its files in order, and the largest cluster comes first.
+func clusterSignatures(signatures [][]uint32, threshold float64) [][]int {
+	parent := make([]int, len(signatures))
+	for i := range parent {
+		parent[i] = i
+	}
+	find := func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+
+	rows := minhashSize / minhashBands
+	for band := 0; band < minhashBands; band++ {
+		// A collision of band hashes only costs a comparison
+		buckets := make(map[uint64][]int)
+		for f, sig := range signatures {
+			if sig == nil {
+				continue
+			}
+			key := uint64(14695981039346656037)
+			for _, v := range sig[band*rows : (band+1)*rows] {
+				key ^= uint64(v)
+				key *= 1099511628211
+			}
+			buckets[key] = append(buckets[key], f)
+		}
+		for _, files := range buckets {
+			for i, a := range files {
+				for _, b := range files[i+1:] {
+					ra, rb := find(a), find(b)
+					if ra != rb && signatureSimilarity(signatures[a], signatures[b]) >= threshold {
+						parent[max(ra, rb)] = min(ra, rb)
+					}
+				}
+			}
+		}
+	}
+
+	groups := make(map[int][]int)
+	for f := range signatures {
+		root := find(f)
+		groups[root] = append(groups[root], f)
+	}
+	var clusters [][]int
+	for _, files := range groups {
+		if len(files) > 1 {
+			clusters = append(clusters, files)
+		}
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		if len(clusters[i]) != len(clusters[j]) {
+			return len(clusters[i]) > len(clusters[j])
+		}
+		return clusters[i][0] < clusters[j][0]
+	})
+	return clusters
+}
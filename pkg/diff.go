@@ -0,0 +1,317 @@
+package pkg
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CacheDiff is how a newer cache differs from an older one
+type CacheDiff struct {
+	Old, New     string
+	OldWords     int
+	NewWords     int
+	AddedWords   []WordCount // most frequent first if the cache has tfidf.txt
+	RemovedWords []WordCount
+	OldFiles     int
+	NewFiles     int
+	AddedFiles   []string
+	RemovedFiles []string
+	Ngrams       []NgramDrift // one per n both caches have {n}gramfreq.txt for
+}
+
+// WordCount is a word and its number of occurrences (0 if unknown)
+type WordCount struct {
+	Word  string
+	Count int64
+}
+
+// NgramDrift lists the n-grams of one n whose frequency changed the most
+type NgramDrift struct {
+	N        int
+	OldTotal int64 // occurrences in {n}gramfreq.txt
+	NewTotal int64
+	Changes  []NgramChange
+}
+
+// NgramChange is one n-gram's count in both caches. Change is the difference
+// in occurrences per million n-grams, so caches of different sizes compare.
+type NgramChange struct {
+	Text     string
+	Old, New int
+	Change   float64
+}
+
+// DiffCaches compares the vocabulary, file lists and n-gram frequencies of
+// two caches. The top n-grams whose frequency changed the most are kept per n
+// (0 keeps all), up to maxN (0 = every n both caches have).
+//
+// N-grams below -min-count are not in {n}gramfreq.txt, so one that crossed
+// the threshold between the caches shows up as changed from or to zero.
+func DiffCaches(oldDir, newDir string, maxN, top int) (*CacheDiff, error) {
+	d := &CacheDiff{Old: oldDir, New: newDir}
+
+	oldWords, err := readLines(filepath.Join(oldDir, "uniq.txt"))
+	if err != nil {
+		return nil, fmt.Errorf("%s: could not read uniq.txt (run -cache tokens first): %w", oldDir, err)
+	}
+	newWords, err := readLines(filepath.Join(newDir, "uniq.txt"))
+	if err != nil {
+		return nil, fmt.Errorf("%s: could not read uniq.txt (run -cache tokens first): %w", newDir, err)
+	}
+	oldFiles, err := readLines(filepath.Join(oldDir, "files.txt"))
+	if err != nil {
+		return nil, fmt.Errorf("%s: could not read files.txt (run -cache tokens first): %w", oldDir, err)
+	}
+	newFiles, err := readLines(filepath.Join(newDir, "files.txt"))
+	if err != nil {
+		return nil, fmt.Errorf("%s: could not read files.txt (run -cache tokens first): %w", newDir, err)
+	}
+	d.OldWords, d.NewWords = len(oldWords), len(newWords)
+	d.OldFiles, d.NewFiles = len(oldFiles), len(newFiles)
+
+	// wordMap takes old word numbers to new ones, -1 for removed words
+	newIdx := make(map[string]int, len(newWords))
+	for i, word := range newWords {
+		newIdx[word] = i
+	}
+	wordMap := make([]int, len(oldWords))
+	inOld := make([]bool, len(newWords))
+	for i, word := range oldWords {
+		wordMap[i] = -1
+		if j, ok := newIdx[word]; ok {
+			wordMap[i] = j
+			inOld[j] = true
+		}
+	}
+	newIdx = nil
+
+	oldTF := wordOccurrences(oldDir, len(oldWords))
+	newTF := wordOccurrences(newDir, len(newWords))
+	for i, word := range oldWords {
+		if wordMap[i] < 0 {
+			d.RemovedWords = append(d.RemovedWords, WordCount{word, oldTF[i]})
+		}
+	}
+	for i, word := range newWords {
+		if !inOld[i] {
+			d.AddedWords = append(d.AddedWords, WordCount{word, newTF[i]})
+		}
+	}
+	sortWords(d.AddedWords)
+	sortWords(d.RemovedWords)
+	d.AddedFiles, d.RemovedFiles = diffFileLists(oldFiles, newFiles)
+
+	for n := 2; maxN <= 0 || n <= maxN; n++ {
+		name := fmt.Sprintf("%dgramfreq.txt", n)
+		if !CacheFileExists(filepath.Join(oldDir, name)) || !CacheFileExists(filepath.Join(newDir, name)) {
+			if maxN <= 0 {
+				break
+			}
+			continue
+		}
+		drift, err := diffNgramFreq(oldDir, newDir, n, oldWords, newWords, wordMap, top)
+		if err != nil {
+			return nil, err
+		}
+		d.Ngrams = append(d.Ngrams, *drift)
+	}
+	return d, nil
+}
+
+// wordOccurrences returns the total occurrences of every word from
+// tfidf.txt, or zeros if the cache has none
+func wordOccurrences(cacheDir string, words int) []int64 {
+	tf := make([]int64, words)
+	stats, err := LoadTermStats(cacheDir)
+	if err != nil {
+		return tf
+	}
+	for _, s := range stats {
+		if s.Word >= 0 && s.Word < words {
+			tf[s.Word] = s.TF
+		}
+	}
+	return tf
+}
+
+// sortWords sorts words by count, then alphabetically
+func sortWords(words []WordCount) {
+	sort.Slice(words, func(i, j int) bool {
+		if words[i].Count != words[j].Count {
+			return words[i].Count > words[j].Count
+		}
+		return words[i].Word < words[j].Word
+	})
+}
+
+func firstN[T any](list []T, n int) []T {
+	if n > 0 && len(list) > n {
+		return list[:n]
+	}
+	return list
+}
+
+// diffFileLists returns the paths only in newFiles and only in oldFiles, in
+// their files.txt order
+func diffFileLists(oldFiles, newFiles []string) (added, removed []string) {
+	inOld := make(map[string]bool, len(oldFiles))
+	for _, f := range oldFiles {
+		inOld[f] = true
+	}
+	inNew := make(map[string]bool, len(newFiles))
+	for _, f := range newFiles {
+		inNew[f] = true
+		if !inOld[f] {
+			added = append(added, f)
+		}
+	}
+	for _, f := range oldFiles {
+		if !inNew[f] {
+			removed = append(removed, f)
+		}
+	}
+	return added, removed
+}
+
+// diffNgramFreq compares the {n}gramfreq.txt of both caches, keying old
+// n-grams by their new word numbers
+func diffNgramFreq(oldDir, newDir string, n int, oldWords, newWords []string, wordMap []int, top int) (*NgramDrift, error) {
+	drift := &NgramDrift{N: n}
+	name := fmt.Sprintf("%dgramfreq.txt", n)
+
+	oldCounts := make(map[string]int)
+	var changes []NgramChange
+	err := scanFreqFile(filepath.Join(oldDir, name), func(key string, count int) {
+		drift.OldTotal += int64(count)
+		if newKey, ok := remapNgramKey(key, wordMap); ok {
+			oldCounts[newKey] += count
+			return
+		}
+		// A word of the n-gram left the vocabulary, so it cannot be in the
+		// new cache
+		changes = append(changes, NgramChange{Text: ngramText(key, oldWords), Old: count})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: could not read %s: %w", oldDir, name, err)
+	}
+	err = scanFreqFile(filepath.Join(newDir, name), func(key string, count int) {
+		drift.NewTotal += int64(count)
+		old := oldCounts[key]
+		delete(oldCounts, key)
+		changes = append(changes, NgramChange{Text: ngramText(key, newWords), Old: old, New: count})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: could not read %s: %w", newDir, name, err)
+	}
+	for key, count := range oldCounts {
+		changes = append(changes, NgramChange{Text: ngramText(key, newWords), Old: count})
+	}
+
+	for i := range changes {
+		changes[i].Change = perMillion(changes[i].New, drift.NewTotal) - perMillion(changes[i].Old, drift.OldTotal)
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		a, b := math.Abs(changes[i].Change), math.Abs(changes[j].Change)
+		if a != b {
+			return a > b
+		}
+		return changes[i].Text < changes[j].Text
+	})
+	drift.Changes = firstN(changes, top)
+	return drift, nil
+}
+
+func perMillion(count int, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(count) * 1e6 / float64(total)
+}
+
+// scanFreqFile calls fn with every "key,count" line of a frequency file
+func scanFreqFile(path string, fn func(key string, count int)) error {
+	f, err := OpenCacheFile(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		comma := strings.LastIndex(line, ",")
+		if comma == -1 {
+			continue
+		}
+		count, err := strconv.Atoi(line[comma+1:])
+		if err != nil {
+			continue
+		}
+		fn(line[:comma], count)
+	}
+	return scanner.Err()
+}
+
+// ngramText turns a "w1|w2|..." key into its words separated by spaces
+func ngramText(key string, words []string) string {
+	parts := strings.Split(key, "|")
+	for i, p := range parts {
+		if idx, err := strconv.Atoi(p); err == nil && idx >= 0 && idx < len(words) {
+			parts[i] = words[idx]
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Print writes the diff as a plain-text report, listing up to top words and
+// files of each kind (0 lists all)
+func (d *CacheDiff) Print(w io.Writer, top int) {
+	fmt.Fprintf(w, "Old: %s\nNew: %s\n", d.Old, d.New)
+
+	fmt.Fprintf(w, "\nVocabulary: %d -> %d words\n", d.OldWords, d.NewWords)
+	for _, list := range []struct {
+		label string
+		words []WordCount
+	}{{"Added", d.AddedWords}, {"Removed", d.RemovedWords}} {
+		fmt.Fprintf(w, "  %s: %d\n", list.label, len(list.words))
+		for _, wc := range firstN(list.words, top) {
+			if wc.Count > 0 {
+				fmt.Fprintf(w, "    %-30s %d\n", wc.Word, wc.Count)
+			} else {
+				fmt.Fprintf(w, "    %s\n", wc.Word)
+			}
+		}
+		printMore(w, len(list.words), top)
+	}
+
+	fmt.Fprintf(w, "\nFiles: %d -> %d\n", d.OldFiles, d.NewFiles)
+	for _, list := range []struct {
+		label string
+		files []string
+	}{{"Only in new", d.AddedFiles}, {"Only in old", d.RemovedFiles}} {
+		fmt.Fprintf(w, "  %s: %d\n", list.label, len(list.files))
+		for _, f := range firstN(list.files, top) {
+			fmt.Fprintf(w, "    %s\n", f)
+		}
+		printMore(w, len(list.files), top)
+	}
+
+	for _, drift := range d.Ngrams {
+		fmt.Fprintf(w, "\n%d-grams: %d -> %d occurrences, biggest changes per million:\n", drift.N, drift.OldTotal, drift.NewTotal)
+		for _, c := range drift.Changes {
+			fmt.Fprintf(w, "  %+12.2f  %8d -> %-8d  %s\n", c.Change, c.Old, c.New, c.Text)
+		}
+	}
+}
+
+func printMore(w io.Writer, total, top int) {
+	if top > 0 && total > top {
+		fmt.Fprintf(w, "    ... and %d more\n", total-top)
+	}
+}
@@ -0,0 +1,48 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// extractDJVU reads the hidden text layer of a DjVu document with djvutxt
+// (DjVuLibre). djvutxt separates pages with form feeds, so each becomes a page.
+func extractDJVU(src source) (*ExtractionResult, error) {
+	bin, err := exec.LookPath("djvutxt")
+	if err != nil {
+		return nil, fmt.Errorf("djvutxt not found in PATH: %w", err)
+	}
+
+	path, cleanup, err := src.localPath()
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	cmd := exec.Command(bin, path)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("djvutxt: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var pages []string
+	var fullTextBuilder strings.Builder
+	for _, page := range strings.Split(stdout.String(), "\f") {
+		page = strings.TrimSpace(page)
+		if page == "" {
+			continue
+		}
+		pages = append(pages, page)
+		fullTextBuilder.WriteString(page)
+		fullTextBuilder.WriteString("\n")
+	}
+
+	return &ExtractionResult{
+		FullText: fullTextBuilder.String(),
+		Pages:    pages,
+	}, nil
+}
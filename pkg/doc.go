@@ -0,0 +1,248 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/extrame/ole2"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// oleSignature starts every OLE2 compound file (.doc, .xls, .msg, ...)
+var oleSignature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+// readOLEStreams returns the contents of the named streams of a compound file.
+// Leading control characters are ignored when matching names, so
+// "SummaryInformation" finds "\x05SummaryInformation". Streams that are not
+// present are omitted from the result.
+func readOLEStreams(src source, names ...string) (map[string][]byte, error) {
+	ole, err := ole2.Open(src.reader(), "utf-8")
+	if err != nil {
+		return nil, err
+	}
+	dir, err := ole.ListDir()
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	var root *ole2.File
+	for _, f := range dir {
+		if f.Name() == "Root Entry" {
+			root = f
+			break
+		}
+	}
+
+	streams := make(map[string][]byte)
+	for _, f := range dir {
+		// Property set streams carry a leading control character (\x05SummaryInformation)
+		name := strings.TrimLeft(f.Name(), "\x01\x02\x03\x05")
+		if !wanted[name] {
+			continue
+		}
+		if _, seen := streams[name]; seen {
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(ole.OpenFile(f, root), int64(f.Size)))
+		if err != nil {
+			return nil, fmt.Errorf("read stream %s: %w", name, err)
+		}
+		streams[name] = data
+	}
+	return streams, nil
+}
+
+// extractDOC reads the text of a Word 97-2003 binary document via its piece table
+func extractDOC(src source) (res *ExtractionResult, err error) {
+	// Malformed compound files can make the OLE reader panic
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("doc parser panic: %v", r)
+		}
+	}()
+
+	head := make([]byte, 8)
+	if _, err := src.r.ReadAt(head, 0); err != nil {
+		return nil, err
+	}
+	// Plenty of ".doc" files are really RTF saved with the wrong extension
+	if bytes.HasPrefix(head, []byte(`{\rtf`)) {
+		return extractRTF(src)
+	}
+	if !bytes.Equal(head, oleSignature) {
+		return nil, fmt.Errorf("not an OLE2 compound file")
+	}
+
+	streams, err := readOLEStreams(src, "WordDocument", "0Table", "1Table")
+	if err != nil {
+		return nil, err
+	}
+	wordDoc := streams["WordDocument"]
+	if len(wordDoc) < 0x1AA {
+		return nil, fmt.Errorf("WordDocument stream missing or too short")
+	}
+
+	if binary.LittleEndian.Uint16(wordDoc[0:]) != 0xA5EC {
+		return nil, fmt.Errorf("invalid Word FIB signature")
+	}
+	flags := binary.LittleEndian.Uint16(wordDoc[0x0A:])
+	if flags&0x0100 != 0 {
+		return nil, fmt.Errorf("encrypted Word document")
+	}
+	tableName := "0Table"
+	if flags&0x0200 != 0 {
+		tableName = "1Table"
+	}
+	table := streams[tableName]
+	if table == nil {
+		return nil, fmt.Errorf("%s stream missing (Word 6/95 documents are not supported)", tableName)
+	}
+
+	// FibBase (32 bytes), then csw + FibRgW, cslw + FibRgLw, cbRgFcLcb + FibRgFcLcb
+	pos := 32
+	csw := int(binary.LittleEndian.Uint16(wordDoc[pos:]))
+	pos += 2 + csw*2
+	cslw := int(binary.LittleEndian.Uint16(wordDoc[pos:]))
+	rgLw := pos + 2
+	pos = rgLw + cslw*4
+	rgFcLcb := pos + 2
+	if rgFcLcb+34*8 > len(wordDoc) {
+		return nil, fmt.Errorf("truncated FIB")
+	}
+
+	// ccpText (main document length in characters) is the 4th FibRgLw entry,
+	// fcClx/lcbClx the 34th FibRgFcLcb pair
+	ccpText := int(binary.LittleEndian.Uint32(wordDoc[rgLw+3*4:]))
+	fcClx := int(binary.LittleEndian.Uint32(wordDoc[rgFcLcb+33*8:]))
+	lcbClx := int(binary.LittleEndian.Uint32(wordDoc[rgFcLcb+33*8+4:]))
+	if fcClx+lcbClx > len(table) || lcbClx == 0 {
+		return nil, fmt.Errorf("piece table out of range")
+	}
+
+	text, err := readPieceTable(wordDoc, table[fcClx:fcClx+lcbClx], ccpText)
+	if err != nil {
+		return nil, err
+	}
+	text = cleanWordText(text)
+
+	res = &ExtractionResult{
+		FullText: text,
+		Pages:    []string{text},
+	}
+	res.mergeMeta(readOLESummary(src))
+	return res, nil
+}
+
+// readPieceTable walks the Clx structure and concatenates the text pieces of
+// the first maxCP characters (the main document story)
+func readPieceTable(wordDoc, clx []byte, maxCP int) (string, error) {
+	// Skip Prc entries (clxt 0x01) until the Pcdt (clxt 0x02)
+	pos := 0
+	for pos < len(clx) && clx[pos] == 0x01 {
+		if pos+3 > len(clx) {
+			return "", fmt.Errorf("truncated Prc")
+		}
+		pos += 3 + int(binary.LittleEndian.Uint16(clx[pos+1:]))
+	}
+	if pos+5 > len(clx) || clx[pos] != 0x02 {
+		return "", fmt.Errorf("Pcdt not found")
+	}
+	lcb := int(binary.LittleEndian.Uint32(clx[pos+1:]))
+	plc := clx[pos+5:]
+	if lcb > len(plc) || lcb < 4 {
+		return "", fmt.Errorf("truncated PlcPcd")
+	}
+	plc = plc[:lcb]
+
+	// PlcPcd: n+1 character positions followed by n 8-byte piece descriptors
+	n := (lcb - 4) / 12
+	decoder := charmap.Windows1252.NewDecoder()
+
+	var sb strings.Builder
+	for i := 0; i < n; i++ {
+		cpStart := int(binary.LittleEndian.Uint32(plc[i*4:]))
+		cpEnd := int(binary.LittleEndian.Uint32(plc[(i+1)*4:]))
+		if cpStart >= maxCP {
+			break
+		}
+		if cpEnd > maxCP {
+			cpEnd = maxCP
+		}
+		count := cpEnd - cpStart
+		if count <= 0 {
+			continue
+		}
+
+		pcd := plc[(n+1)*4+i*8:]
+		fc := binary.LittleEndian.Uint32(pcd[2:])
+		compressed := fc&0x40000000 != 0
+		offset := int(fc & 0x3FFFFFFF)
+
+		if compressed {
+			offset /= 2
+			if offset+count > len(wordDoc) {
+				continue
+			}
+			decoded, err := decoder.Bytes(wordDoc[offset : offset+count])
+			if err != nil {
+				continue
+			}
+			sb.Write(decoded)
+			continue
+		}
+
+		if offset+count*2 > len(wordDoc) {
+			continue
+		}
+		units := make([]uint16, count)
+		for j := range units {
+			units[j] = binary.LittleEndian.Uint16(wordDoc[offset+j*2:])
+		}
+		sb.WriteString(string(utf16.Decode(units)))
+	}
+	return sb.String(), nil
+}
+
+// cleanWordText maps Word control characters to plain text and drops field codes
+// (the text between 0x13 and 0x14), keeping field results
+func cleanWordText(text string) string {
+	var sb strings.Builder
+	inFieldCode := 0
+	for _, r := range text {
+		switch r {
+		case 0x13:
+			inFieldCode++
+			continue
+		case 0x14, 0x15:
+			if inFieldCode > 0 {
+				inFieldCode--
+			}
+			continue
+		}
+		if inFieldCode > 0 {
+			continue
+		}
+		switch r {
+		case '\r', 0x0B, 0x0C:
+			sb.WriteRune('\n')
+		case 0x07:
+			sb.WriteRune('\t')
+		case 0x1E:
+			sb.WriteRune('-')
+		case 0x01, 0x08, 0x1F:
+			// embedded objects, drawn objects, soft hyphens
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
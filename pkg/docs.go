@@ -0,0 +1,230 @@
+package pkg
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// StepDocs is the cache step that writes each token file as word indices
+const StepDocs = "docs"
+
+// docsDirName holds one <fileIdx>.ids file per entry of files.txt: the file's
+// vocabulary indices as a stream of uvarints, in token order. Next to it,
+// <fileIdx>.brk holds the offsets at which the file's lines (sentences) after
+// the first begin, as uvarint deltas.
+const docsDirName = "docs"
+
+// DocIDsPath returns the ID stream of file fileIdx in a cache directory
+func DocIDsPath(cacheDir string, fileIdx int) string {
+	return filepath.Join(cacheDir, docsDirName, strconv.Itoa(fileIdx)+".ids")
+}
+
+func docBreaksPath(cacheDir string, fileIdx int) string {
+	return filepath.Join(cacheDir, docsDirName, strconv.Itoa(fileIdx)+".brk")
+}
+
+// BuildDocsCache writes every token file as a compact stream of word indices,
+// so later passes decode varints instead of re-tokenizing text for every n
+func BuildDocsCache(ctx context.Context, outputDir string) error {
+	logger.Info("Building document ID cache", "dir", outputDir)
+	reporter.OnStage(StepDocs)
+
+	if err := beginStep(outputDir, StepDocs); err != nil {
+		return err
+	}
+
+	tokenInputDir := readCacheInput(outputDir)
+	if tokenInputDir == "" {
+		return fmt.Errorf("could not find input path in settings.txt (run -cache tokens first)")
+	}
+	words, err := readLines(filepath.Join(outputDir, "uniq.txt"))
+	if err != nil {
+		return fmt.Errorf("could not read uniq.txt (run -cache tokens first): %w", err)
+	}
+	filesList, err := readLines(filepath.Join(outputDir, "files.txt"))
+	if err != nil {
+		return fmt.Errorf("could not read files.txt (run -cache tokens first): %w", err)
+	}
+	logger.Info("Loaded cache", "words", len(words), "files", len(filesList))
+
+	docsDir := filepath.Join(outputDir, docsDirName)
+	if err := os.RemoveAll(docsDir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(docsDir, 0755); err != nil {
+		return err
+	}
+
+	// Always tokenize here; the old ID streams were just removed
+	src := &tokenSource{inputDir: tokenInputDir, wordToIndex: indexWords(words), breaks: true}
+	var total int64
+	err = forEachTokenFile(ctx, src, filesList, func(worker, fileIdx int, ids []int) error {
+		ids, starts := splitBreaks(ids)
+		if err := writeDocIDs(DocIDsPath(outputDir, fileIdx), ids); err != nil {
+			return err
+		}
+		return writeDocIDs(docBreaksPath(outputDir, fileIdx), deltas(starts))
+	}, func(done int) {
+		reporter.OnFile(done, len(filesList))
+	})
+	if err != nil {
+		return err
+	}
+	if entries, err := os.ReadDir(docsDir); err == nil {
+		for _, e := range entries {
+			if info, err := e.Info(); err == nil {
+				total += info.Size()
+			}
+		}
+	}
+
+	logger.Info("Done! ID streams written", "path", docsDir, "files", len(filesList), "bytes", total)
+	return finishStep(outputDir, StepDocs, 0)
+}
+
+// splitBreaks removes the sentence breaks from words and returns the offsets
+// in the remaining words at which a new sentence begins
+func splitBreaks(words []int) ([]int, []int) {
+	ids := make([]int, 0, len(words))
+	var starts []int
+	for _, w := range words {
+		if w == sentenceBreak {
+			starts = append(starts, len(ids))
+			continue
+		}
+		ids = append(ids, w)
+	}
+	return ids, starts
+}
+
+// joinBreaks is the inverse of splitBreaks
+func joinBreaks(ids, starts []int) []int {
+	if len(starts) == 0 {
+		return ids
+	}
+	words := make([]int, 0, len(ids)+len(starts))
+	next := 0
+	for i, id := range ids {
+		if next < len(starts) && starts[next] == i {
+			words = append(words, sentenceBreak)
+			next++
+		}
+		words = append(words, id)
+	}
+	return words
+}
+
+func deltas(values []int) []int {
+	out := make([]int, len(values))
+	prev := 0
+	for i, v := range values {
+		out[i], prev = v-prev, v
+	}
+	return out
+}
+
+func writeDocIDs(path string, ids []int) error {
+	buf := make([]byte, 0, len(ids)*2)
+	for _, id := range ids {
+		buf = binary.AppendUvarint(buf, uint64(id))
+	}
+	return writeFileAtomic(path, buf)
+}
+
+// ReadDocIDs reads the word indices of file fileIdx written by BuildDocsCache
+func ReadDocIDs(cacheDir string, fileIdx int) ([]int, error) {
+	return readUvarints(DocIDsPath(cacheDir, fileIdx))
+}
+
+// readDocBreaks reads the sentence start offsets of file fileIdx
+func readDocBreaks(cacheDir string, fileIdx int) ([]int, error) {
+	starts, err := readUvarints(docBreaksPath(cacheDir, fileIdx))
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i < len(starts); i++ {
+		starts[i] += starts[i-1]
+	}
+	return starts, nil
+}
+
+func readUvarints(path string) ([]int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var ids []int
+	r := bufio.NewReader(f)
+	for {
+		id, err := binary.ReadUvarint(r)
+		if err == io.EOF {
+			return ids, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name(), err)
+		}
+		ids = append(ids, int(id))
+	}
+}
+
+// tokenSource reads the word indices of the files a cache was built from,
+// from the ID streams when the docs step is current and otherwise by
+// tokenizing the token files
+type tokenSource struct {
+	inputDir    string
+	cacheDir    string // set when docs/ can be read
+	wordToIndex map[string]int
+	breaks      bool // separate sentences with sentenceBreak
+}
+
+// newTokenSource returns a source for the cache in outputDir. The ID streams
+// are only used when the manifest shows the docs step finished after the
+// vocabulary was last written.
+func newTokenSource(outputDir, tokenInputDir string, wordToIndex map[string]int) *tokenSource {
+	src := &tokenSource{inputDir: tokenInputDir, wordToIndex: wordToIndex}
+	if m, err := LoadManifest(outputDir); err == nil && m.checkStep(outputDir, StepDocs, false) == nil {
+		src.cacheDir = outputDir
+		logger.Debug("Reading word IDs", "path", filepath.Join(outputDir, docsDirName))
+	}
+	return src
+}
+
+// words returns the word indices of file fileIdx at relPath. A missing or
+// unreadable ID stream falls back to the token file.
+func (s *tokenSource) words(fileIdx int, relPath string) ([]int, error) {
+	if s.cacheDir != "" {
+		if ids, err := ReadDocIDs(s.cacheDir, fileIdx); err == nil {
+			if !s.breaks {
+				return ids, nil
+			}
+			if starts, err := readDocBreaks(s.cacheDir, fileIdx); err == nil {
+				return joinBreaks(ids, starts), nil
+			}
+		}
+	}
+	return readTokenWords(filepath.Join(s.inputDir, relPath), s.wordToIndex, s.breaks)
+}
+
+// ReadTokenWords returns the word indices of the file at relPath in the token
+// directory a cache was built from, as listed in its settings.txt. Words not
+// in wordToIndex are left out.
+func ReadTokenWords(cacheDir, relPath string, wordToIndex map[string]int) ([]int, error) {
+	tokenInputDir := readCacheInput(cacheDir)
+	if tokenInputDir == "" {
+		return nil, fmt.Errorf("could not find input path in settings.txt")
+	}
+	return readTokenWords(filepath.Join(tokenInputDir, relPath), wordToIndex, false)
+}
+
+// hasDocs reports whether a cache directory has ID streams to keep current
+func hasDocs(cacheDir string) bool {
+	return fileExists(filepath.Join(cacheDir, docsDirName))
+}
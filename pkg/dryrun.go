@@ -0,0 +1,160 @@
+package pkg
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DryRunCount counts the files of one extension by what RunProcess would do
+// with them
+type DryRunCount struct {
+	Ext         string
+	Files       int
+	Convert     int   // would be converted
+	Existing    int   // converted before (see resumeAction), kept without -r
+	Unsupported int   // no extractor, even after sniffing the content
+	TooLarge    int   // above the MaxFileSize of the extract options
+	Bytes       int64 // size of the files to convert
+}
+
+// DryRunReport is what RunProcess would do with the files of an input
+// directory, by extension
+type DryRunReport struct {
+	Input  string
+	Output string
+	Exts   []DryRunCount // by extension
+	Total  DryRunCount
+}
+
+// DryRun walks inputDir as RunProcess does and sorts each file as converted,
+// kept as converted before, unsupported or too large, with the same options,
+// ledger, extract options and OCR backend, without extracting anything. The
+// content of a file is only read to sniff its format when its extension has
+// no extractor. Archives and .pst files to convert count as converted, and
+// the language filter of opts is not applied, as both need the extracted
+// text.
+func DryRun(inputDir, outputDir string, opts ProcessOptions) (*DryRunReport, error) {
+	files, err := listInputFiles(inputDir, opts)
+	if err != nil {
+		return nil, err
+	}
+	done, err := LoadLedger(outputDir)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]*DryRunCount)
+	for _, path := range files {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		key := ext
+		if key == "" {
+			key = "(no extension)"
+		}
+		c := counts[key]
+		if c == nil {
+			c = &DryRunCount{Ext: key}
+			counts[key] = c
+		}
+		c.Files++
+
+		relPath, err := filepath.Rel(inputDir, path)
+		if err != nil {
+			continue
+		}
+		container := opts.Archives && archiveKind(path) != "" || ext == ".pst"
+		if !opts.Replace {
+			switch resumeAction(done, path, relPath, filepath.Join(outputDir, relPath), info, container, opts) {
+			case resumeSkip, resumeKeep:
+				c.Existing++
+				continue
+			}
+		}
+		switch {
+		case container:
+		case !formatSupported(path, ext, info.Size()):
+			c.Unsupported++
+			continue
+		case extractOptions.checkFileSize(info.Size()) != nil:
+			c.TooLarge++
+			continue
+		}
+		c.Convert++
+		c.Bytes += info.Size()
+	}
+
+	report := &DryRunReport{Input: inputDir, Output: outputDir, Total: DryRunCount{Ext: "TOTAL"}}
+	for _, c := range counts {
+		report.Exts = append(report.Exts, *c)
+		report.Total.Files += c.Files
+		report.Total.Convert += c.Convert
+		report.Total.Existing += c.Existing
+		report.Total.Unsupported += c.Unsupported
+		report.Total.TooLarge += c.TooLarge
+		report.Total.Bytes += c.Bytes
+	}
+	sort.Slice(report.Exts, func(i, j int) bool { return report.Exts[i].Ext < report.Exts[j].Ext })
+	return report, nil
+}
+
+// formatSupported reports whether ExtractContent has an extractor for a
+// file: by its extension, or by its content when sniffing is on
+func formatSupported(path, ext string, size int64) bool {
+	if _, ok := lookupExtractor(ext); ok {
+		return true
+	}
+	supported := func(ext string) bool {
+		return builtinExtractor(ext) != nil && (currentOCRBackend() != nil || !imageExtension(ext))
+	}
+	if supported(ext) || !sniffContent {
+		return supported(ext)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	return supported(sniffExtension(source{r: f, size: size, path: path, ext: ext}, ext))
+}
+
+// Print writes the report as a table by extension
+func (r *DryRunReport) Print(w io.Writer) {
+	fmt.Fprintln(w, "\n=== Dry Run ===")
+	fmt.Fprintf(w, "Input:  %s\n", r.Input)
+	fmt.Fprintf(w, "Output: %s\n\n", r.Output)
+
+	row := "%-15s %8s %8s %8s %11s %9s %10s\n"
+	fmt.Fprintf(w, row, "Extension", "Files", "Convert", "Existing", "Unsupported", "Too large", "Size")
+	fmt.Fprintln(w, strings.Repeat("-", 75))
+	printRow := func(c DryRunCount) {
+		fmt.Fprintf(w, row, c.Ext, fmt.Sprint(c.Files), fmt.Sprint(c.Convert), fmt.Sprint(c.Existing),
+			fmt.Sprint(c.Unsupported), fmt.Sprint(c.TooLarge), formatSize(c.Bytes))
+	}
+	for _, c := range r.Exts {
+		printRow(c)
+	}
+	fmt.Fprintln(w, strings.Repeat("-", 75))
+	printRow(r.Total)
+	fmt.Fprintf(w, "\n%d files (%s) would be converted\n\n", r.Total.Convert, formatSize(r.Total.Bytes))
+}
+
+// formatSize writes a size in B, KB, MB or GB
+func formatSize(n int64) string {
+	units := []string{"B", "KB", "MB", "GB"}
+	f, i := float64(n), 0
+	for f >= 1024 && i < len(units)-1 {
+		f /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%.1f %s", f, units[i])
+}
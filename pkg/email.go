@@ -0,0 +1,237 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// includeEmailHeaders prepends Subject/From/To/Date to each extracted message
+var includeEmailHeaders = true
+
+// SetEmailHeaders controls whether Subject/From/To/Date headers are included in email text
+func SetEmailHeaders(include bool) {
+	includeEmailHeaders = include
+}
+
+var headerDecoder = &mime.WordDecoder{CharsetReader: charsetReader}
+
+func extractEML(src source) (*ExtractionResult, error) {
+	content, err := src.readAll()
+	if err != nil {
+		return nil, err
+	}
+
+	text, header, err := emailToText(content, src.cfg.emailHeaders)
+	if err != nil {
+		return nil, err
+	}
+	res := &ExtractionResult{
+		FullText: text,
+		Pages:    []string{text},
+	}
+	res.setMeta(MetaTitle, decodeHeader(header.Get("Subject")))
+	res.setMeta(MetaAuthor, decodeHeader(header.Get("From")))
+	if date, err := header.Date(); err == nil {
+		res.setMeta(MetaCreated, date.UTC().Format(time.RFC3339))
+	}
+	return res, nil
+}
+
+// extractMBOX splits an mbox file on "From " separator lines; each message becomes a page
+func extractMBOX(src source) (*ExtractionResult, error) {
+	var pages []string
+	var fullTextBuilder strings.Builder
+	var msg bytes.Buffer
+
+	flush := func() {
+		if msg.Len() == 0 {
+			return
+		}
+		text, _, err := emailToText(msg.Bytes(), src.cfg.emailHeaders)
+		msg.Reset()
+		if err != nil || strings.TrimSpace(text) == "" {
+			return
+		}
+		pages = append(pages, text)
+		fullTextBuilder.WriteString(text)
+		fullTextBuilder.WriteString("\n")
+	}
+
+	reader := bufio.NewReader(src.reader())
+	for {
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			switch {
+			case strings.HasPrefix(line, "From "):
+				flush()
+			case strings.HasPrefix(line, ">From "):
+				// mboxrd quoting of body lines that start with "From "
+				msg.WriteString(line[1:])
+			default:
+				msg.WriteString(line)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	flush()
+
+	return &ExtractionResult{
+		FullText: fullTextBuilder.String(),
+		Pages:    pages,
+	}, nil
+}
+
+// emailToText parses an RFC 5322 message and returns its readable text body,
+// after its Subject/From/To/Date with headers set
+func emailToText(raw []byte, headers bool) (string, mail.Header, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return "", nil, err
+	}
+
+	var sb strings.Builder
+	if headers {
+		for _, key := range []string{"Subject", "From", "To", "Date"} {
+			value := decodeHeader(msg.Header.Get(key))
+			if value == "" {
+				continue
+			}
+			sb.WriteString(key + ": " + value + "\n")
+		}
+		sb.WriteString("\n")
+	}
+
+	body, err := mimePartText(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body, headers)
+	if err != nil {
+		return "", nil, err
+	}
+	sb.WriteString(body)
+	return sb.String(), msg.Header, nil
+}
+
+// decodeHeader decodes RFC 2047 encoded words (=?UTF-8?B?...?=), falling back to the raw value
+func decodeHeader(value string) string {
+	if decoded, err := headerDecoder.DecodeHeader(value); err == nil {
+		return decoded
+	}
+	return value
+}
+
+// mimePartText returns the text of a MIME entity, recursing into multiparts.
+// Binary parts and attachments produce no text. headers is that of
+// emailToText, for attached messages.
+func mimePartText(contentType, transferEncoding string, body io.Reader, headers bool) (string, error) {
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		var plain, htmlText, other []string
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", err
+			}
+			if disp, _, _ := mime.ParseMediaType(part.Header.Get("Content-Disposition")); disp == "attachment" {
+				continue
+			}
+			partType := part.Header.Get("Content-Type")
+			text, err := mimePartText(partType, part.Header.Get("Content-Transfer-Encoding"), part, headers)
+			if err != nil || strings.TrimSpace(text) == "" {
+				continue
+			}
+			switch {
+			case strings.HasPrefix(partType, "text/plain") || partType == "":
+				plain = append(plain, text)
+			case strings.HasPrefix(partType, "text/html"):
+				htmlText = append(htmlText, text)
+			default:
+				other = append(other, text)
+			}
+		}
+		// multipart/alternative carries the same body twice: prefer plain over HTML
+		if mediaType == "multipart/alternative" {
+			if len(plain) > 0 {
+				return strings.Join(plain, "\n"), nil
+			}
+			return strings.Join(append(htmlText, other...), "\n"), nil
+		}
+		return strings.Join(append(append(plain, htmlText...), other...), "\n"), nil
+	}
+
+	if mediaType == "message/rfc822" {
+		data, err := io.ReadAll(decodeTransfer(transferEncoding, body))
+		if err != nil {
+			return "", err
+		}
+		text, _, err := emailToText(data, headers)
+		return text, err
+	}
+
+	if !strings.HasPrefix(mediaType, "text/") {
+		return "", nil
+	}
+
+	data, err := io.ReadAll(decodeTransfer(transferEncoding, body))
+	if err != nil {
+		return "", err
+	}
+	if charset := params["charset"]; charset != "" {
+		if r, err := charsetReader(charset, bytes.NewReader(data)); err == nil {
+			if decoded, err := io.ReadAll(r); err == nil {
+				data = decoded
+			}
+		}
+	}
+
+	if mediaType == "text/html" {
+		return htmlToText(bytes.NewReader(data))
+	}
+	return string(data), nil
+}
+
+func decodeTransfer(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+	return r
+}
+
+// charsetReader converts text in a named charset to UTF-8
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	if strings.EqualFold(charset, "utf-8") || strings.EqualFold(charset, "us-ascii") {
+		return input, nil
+	}
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, fmt.Errorf("unknown charset %q", charset)
+	}
+	return enc.NewDecoder().Reader(input), nil
+}
@@ -0,0 +1,111 @@
+package pkg
+
+import (
+	"bytes"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// Encoding names reported in MetaEncoding
+const (
+	EncodingUTF8        = "utf-8"
+	EncodingUTF16LE     = "utf-16le"
+	EncodingUTF16BE     = "utf-16be"
+	EncodingWindows1252 = "windows-1252"
+	EncodingLatin1      = "iso-8859-1"
+)
+
+// decodeText converts raw text of unknown encoding to UTF-8 and returns the
+// name of the detected source encoding. A byte order mark wins; otherwise
+// valid UTF-8 is kept, NUL-interleaved text is taken as UTF-16, and anything
+// else is treated as Windows-1252 (or Latin-1 if it has no 0x80-0x9F bytes).
+func decodeText(data []byte) (string, string) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return string(data[3:]), EncodingUTF8
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return decodeWith(unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM), data, EncodingUTF16LE)
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return decodeWith(unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM), data, EncodingUTF16BE)
+	}
+
+	if utf8.Valid(data) {
+		return string(data), EncodingUTF8
+	}
+
+	if endian, ok := sniffUTF16(data); ok {
+		if endian == unicode.LittleEndian {
+			return decodeWith(unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), data, EncodingUTF16LE)
+		}
+		return decodeWith(unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM), data, EncodingUTF16BE)
+	}
+
+	// A file truncated mid-rune is still UTF-8
+	if trimmed := trimPartialRune(data); len(trimmed) < len(data) && utf8.Valid(trimmed) {
+		return string(trimmed), EncodingUTF8
+	}
+
+	// 0x80-0x9F are control codes in Latin-1 but printable in Windows-1252
+	// (curly quotes, dashes, euro sign); otherwise the two are identical
+	for _, b := range data {
+		if b >= 0x80 && b <= 0x9F {
+			return decodeWith(charmap.Windows1252, data, EncodingWindows1252)
+		}
+	}
+	return decodeWith(charmap.ISO8859_1, data, EncodingLatin1)
+}
+
+func decodeWith(enc encoding.Encoding, data []byte, name string) (string, string) {
+	decoded, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return string(data), name
+	}
+	return string(decoded), name
+}
+
+// sniffUTF16 detects BOM-less UTF-16 from the NUL bytes that ASCII characters
+// leave in every other position of the first 4KB
+func sniffUTF16(data []byte) (unicode.Endianness, bool) {
+	sample := data
+	if len(sample) > 4096 {
+		sample = sample[:4096]
+	}
+	if len(sample) < 4 {
+		return unicode.LittleEndian, false
+	}
+	var evenNUL, oddNUL int
+	for i, b := range sample {
+		if b != 0 {
+			continue
+		}
+		if i%2 == 0 {
+			evenNUL++
+		} else {
+			oddNUL++
+		}
+	}
+	half := len(sample) / 2
+	switch {
+	case oddNUL > half*3/4 && evenNUL < half/10:
+		return unicode.LittleEndian, true
+	case evenNUL > half*3/4 && oddNUL < half/10:
+		return unicode.BigEndian, true
+	}
+	return unicode.LittleEndian, false
+}
+
+// trimPartialRune drops an incomplete UTF-8 sequence at the end of data
+func trimPartialRune(data []byte) []byte {
+	for i := 1; i <= utf8.UTFMax && i <= len(data); i++ {
+		if utf8.RuneStart(data[len(data)-i]) {
+			if !utf8.FullRune(data[len(data)-i:]) {
+				return data[:len(data)-i]
+			}
+			break
+		}
+	}
+	return data
+}
@@ -0,0 +1,144 @@
+package pkg
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// epubContainer is META-INF/container.xml, which points at the OPF package file
+type epubContainer struct {
+	Rootfiles []struct {
+		FullPath string `xml:"full-path,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+// epubPackage is the subset of the OPF package document needed to read chapters in order
+type epubPackage struct {
+	Metadata struct {
+		Title    string `xml:"title"`
+		Creator  string `xml:"creator"`
+		Date     string `xml:"date"`
+		Language string `xml:"language"`
+		Subject  string `xml:"subject"`
+	} `xml:"metadata"`
+	Manifest []struct {
+		ID        string `xml:"id,attr"`
+		Href      string `xml:"href,attr"`
+		MediaType string `xml:"media-type,attr"`
+	} `xml:"manifest>item"`
+	Spine []struct {
+		IDRef string `xml:"idref,attr"`
+	} `xml:"spine>itemref"`
+}
+
+// extractEPUB reads the spine of an EPUB and returns one page per chapter
+func extractEPUB(src source) (*ExtractionResult, error) {
+	r, err := zip.NewReader(src.r, src.size)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]*zip.File, len(r.File))
+	for _, f := range r.File {
+		files[f.Name] = f
+	}
+
+	var container epubContainer
+	if err := decodeZipXML(files["META-INF/container.xml"], &container); err != nil {
+		return nil, fmt.Errorf("epub container: %w", err)
+	}
+	if len(container.Rootfiles) == 0 {
+		return nil, fmt.Errorf("epub container: no rootfile")
+	}
+
+	opfPath := container.Rootfiles[0].FullPath
+	var pkgDoc epubPackage
+	if err := decodeZipXML(files[opfPath], &pkgDoc); err != nil {
+		return nil, fmt.Errorf("epub package %s: %w", opfPath, err)
+	}
+
+	// Manifest hrefs are relative to the OPF file
+	baseDir := path.Dir(opfPath)
+	hrefByID := make(map[string]string, len(pkgDoc.Manifest))
+	for _, item := range pkgDoc.Manifest {
+		if item.MediaType != "" && !strings.Contains(item.MediaType, "html") {
+			continue
+		}
+		hrefByID[item.ID] = path.Join(baseDir, item.Href)
+	}
+
+	var pages []string
+	var fullTextBuilder strings.Builder
+
+	for _, ref := range pkgDoc.Spine {
+		if src.cfg.limits.pageLimitReached(len(pages)) {
+			break
+		}
+		href, ok := hrefByID[ref.IDRef]
+		if !ok {
+			continue
+		}
+		// Hrefs may be URL-escaped or carry a fragment
+		if i := strings.Index(href, "#"); i != -1 {
+			href = href[:i]
+		}
+		f := files[href]
+		if f == nil {
+			f = files[strings.ReplaceAll(href, "%20", " ")]
+		}
+		if f == nil {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			continue
+		}
+		text, err := htmlToText(rc)
+		rc.Close()
+		if err != nil {
+			continue
+		}
+
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		pages = append(pages, text)
+		fullTextBuilder.WriteString(text)
+		fullTextBuilder.WriteString("\n")
+	}
+
+	res := &ExtractionResult{
+		FullText: fullTextBuilder.String(),
+		Pages:    pages,
+	}
+	res.setMeta(MetaTitle, pkgDoc.Metadata.Title)
+	res.setMeta(MetaAuthor, pkgDoc.Metadata.Creator)
+	res.setMeta(MetaCreated, pkgDoc.Metadata.Date)
+	res.setMeta(MetaLanguage, pkgDoc.Metadata.Language)
+	res.setMeta(MetaSubject, pkgDoc.Metadata.Subject)
+	return res, nil
+}
+
+// decodeZipXML unmarshals a single XML member of a zip archive
+func decodeZipXML(f *zip.File, v interface{}) error {
+	if f == nil {
+		return fmt.Errorf("missing file")
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return err
+	}
+	return xml.Unmarshal(data, v)
+}
@@ -0,0 +1,250 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/RoaringBitmap/roaring/v2"
+)
+
+// What Export writes
+const (
+	ExportVocab    = "vocab"    // every word with its files and occurrences
+	ExportNgrams   = "ngrams"   // every n-gram of the frequency files with its count
+	ExportPostings = "postings" // the files of every word
+)
+
+// The formats of Export
+const (
+	ExportCSV   = "csv"   // a header row, then one row per record
+	ExportJSON  = "json"  // one array of objects
+	ExportJSONL = "jsonl" // one object per line
+)
+
+// VocabRecord is a word of ExportVocab. Files, Count and IDF come from
+// tfidf.txt and are left out without it.
+type VocabRecord struct {
+	ID    int      `json:"id"`
+	Word  string   `json:"word"`
+	Files *int     `json:"files,omitempty"`
+	Count *int64   `json:"count,omitempty"`
+	IDF   *float64 `json:"idf,omitempty"`
+}
+
+// NgramRecord is an n-gram of ExportNgrams
+type NgramRecord struct {
+	N     int    `json:"n"`
+	Ngram string `json:"ngram"`
+	Count int    `json:"count"`
+}
+
+// PostingRecord is a word of ExportPostings with the paths of the files it
+// occurs in. CSV writes one word,file row per file instead.
+type PostingRecord struct {
+	ID    int      `json:"id"`
+	Word  string   `json:"word"`
+	Files []string `json:"files"`
+}
+
+// Export writes what (ExportVocab, ExportNgrams or ExportPostings) of a cache
+// to w in format (ExportCSV, ExportJSON or ExportJSONL), with words and files
+// by name instead of the indices of the cache files. ExportNgrams writes the
+// {n}gramfreq.txt of every n from 2 to maxN the cache has, or to the largest
+// with maxN 0.
+func Export(w io.Writer, cacheDir, what, format string, maxN int) error {
+	cache, err := OpenCache(cacheDir)
+	if err != nil {
+		return err
+	}
+	defer cache.Close()
+	words, err := cache.WordIndex()
+	if err != nil {
+		return err
+	}
+	switch what {
+	case ExportVocab:
+		return exportVocab(w, cacheDir, format, words)
+	case ExportNgrams:
+		return exportNgrams(w, cache, format, maxN)
+	case ExportPostings:
+		return exportPostings(w, cache, format)
+	}
+	return fmt.Errorf("unknown export %q (use 'vocab', 'ngrams' or 'postings')", what)
+}
+
+// exportWriter writes records in one of the formats of Export
+type exportWriter struct {
+	out   *bufio.Writer
+	csv   *csv.Writer   // ExportCSV
+	enc   *json.Encoder // ExportJSON and ExportJSONL, encoding into buf
+	buf   bytes.Buffer
+	array bool // ExportJSON
+	count int
+}
+
+// newExportWriter starts writing format to w; header is the CSV header row
+func newExportWriter(w io.Writer, format string, header []string) (*exportWriter, error) {
+	e := &exportWriter{out: bufio.NewWriter(w)}
+	switch format {
+	case ExportCSV:
+		e.csv = csv.NewWriter(e.out)
+		e.csv.Write(header)
+	case ExportJSON, ExportJSONL:
+		e.array = format == ExportJSON
+		e.enc = json.NewEncoder(&e.buf)
+		e.enc.SetEscapeHTML(false)
+	default:
+		return nil, fmt.Errorf("unknown export format %q (use 'csv', 'json' or 'jsonl')", format)
+	}
+	return e, nil
+}
+
+// write writes a record: row in CSV, rec in JSON
+func (e *exportWriter) write(row []string, rec any) error {
+	if e.csv != nil {
+		return e.csv.Write(row)
+	}
+	e.buf.Reset()
+	if err := e.enc.Encode(rec); err != nil {
+		return err
+	}
+	if e.array {
+		// One object per line, after a comma ending the one before
+		if e.count == 0 {
+			e.out.WriteString("[\n")
+		} else {
+			e.out.WriteString(",\n")
+		}
+		e.buf.Truncate(e.buf.Len() - 1)
+	}
+	e.count++
+	_, err := e.out.Write(e.buf.Bytes())
+	return err
+}
+
+// close ends the output and flushes it
+func (e *exportWriter) close() error {
+	if e.csv != nil {
+		e.csv.Flush()
+		if err := e.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if e.array {
+		if e.count == 0 {
+			e.out.WriteString("[")
+		}
+		e.out.WriteString("\n]\n")
+	}
+	return e.out.Flush()
+}
+
+func exportVocab(w io.Writer, cacheDir, format string, words []string) error {
+	stats, err := LoadTermStats(cacheDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	header := []string{"id", "word"}
+	if stats != nil {
+		header = append(header, "files", "count", "idf")
+	}
+	e, err := newExportWriter(w, format, header)
+	if err != nil {
+		return err
+	}
+	for i, word := range words {
+		rec := VocabRecord{ID: i, Word: word}
+		row := []string{strconv.Itoa(i), word}
+		if i < len(stats) {
+			s := stats[i]
+			rec.Files, rec.Count, rec.IDF = &s.DF, &s.TF, &s.IDF
+			row = append(row, strconv.Itoa(s.DF), strconv.FormatInt(s.TF, 10), strconv.FormatFloat(s.IDF, 'f', 6, 64))
+		}
+		if err := e.write(row, rec); err != nil {
+			return err
+		}
+	}
+	return e.close()
+}
+
+func exportNgrams(w io.Writer, cache *Cache, format string, maxN int) error {
+	if built := cache.MaxN(); maxN == 0 || maxN > built {
+		maxN = built
+	}
+	if maxN < 2 {
+		return fmt.Errorf("no 2gramfreq.txt in %s (run -cache ngramfreq first)", cache.Dir())
+	}
+	e, err := newExportWriter(w, format, []string{"n", "ngram", "count"})
+	if err != nil {
+		return err
+	}
+	for n := 2; n <= maxN; n++ {
+		if err := exportNgramFile(e, cache, n); err != nil {
+			return fmt.Errorf("%dgramfreq.txt: %w", n, err)
+		}
+	}
+	return e.close()
+}
+
+func exportNgramFile(e *exportWriter, cache *Cache, n int) error {
+	it, err := cache.NgramIterator(n)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	for it.Next() {
+		ng := it.Ngram()
+		text := ng.Text()
+		err := e.write([]string{strconv.Itoa(n), text, strconv.Itoa(ng.Count)},
+			NgramRecord{N: n, Ngram: text, Count: ng.Count})
+		if err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
+
+func exportPostings(w io.Writer, cache *Cache, format string) error {
+	files, err := cache.Files()
+	if err != nil {
+		return err
+	}
+	header := []string{"word", "file"}
+	e, err := newExportWriter(w, format, header)
+	if err != nil {
+		return err
+	}
+	var writeErr error
+	err = cache.EachPostingList(func(id int, word string, set *roaring.Bitmap) bool {
+		rec := PostingRecord{ID: id, Word: word, Files: make([]string, 0, set.GetCardinality())}
+		for it := set.Iterator(); it.HasNext(); {
+			if f := int(it.Next()); f < len(files) {
+				rec.Files = append(rec.Files, files[f])
+			}
+		}
+		if e.csv == nil {
+			writeErr = e.write(nil, rec)
+			return writeErr == nil
+		}
+		for _, f := range rec.Files {
+			if writeErr = e.write([]string{rec.Word, f}, nil); writeErr != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+	return e.close()
+}
@@ -3,11 +3,16 @@ package pkg
 import (
 	"archive/zip"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/J45k4/rtf"
 	"github.com/extrame/xls"
@@ -20,35 +25,312 @@ import (
 // ExtractionResult holds the extracted content, potentially paginated
 type ExtractionResult struct {
 	FullText string
-	Pages    []string // If applicable (PDF, PPT), otherwise single element
+	Pages    []string          // If applicable (PDF, PPT), otherwise single element
+	Metadata map[string]string // Title, author, dates, ... where the format records them (see Meta* keys)
 }
 
-// ExtractContent identifies the file type and extracts text
+var (
+	// ErrUnsupportedExtension is returned for a file no extractor handles,
+	// by its extension or, when sniffing, by its content
+	ErrUnsupportedExtension = errors.New("unsupported file extension")
+	// ErrCorruptFile wraps the error of a built-in extractor that could not
+	// parse its input: a damaged or truncated file, or one that is not in
+	// the format its extension claims
+	ErrCorruptFile = errors.New("corrupt file")
+)
+
+// ExtractorFunc extracts text from the file at path
+type ExtractorFunc func(path string) (*ExtractionResult, error)
+
+var (
+	customExtractors   = make(map[string]ExtractorFunc)
+	customExtractorsMu sync.RWMutex
+)
+
+// RegisterExtractor adds a handler for an extension that has no built-in extractor
+// (e.g. ".foo" or "foo"). Registering the same extension again replaces the handler.
+func RegisterExtractor(ext string, fn ExtractorFunc) {
+	ext = strings.ToLower(ext)
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	customExtractorsMu.Lock()
+	defer customExtractorsMu.Unlock()
+	if fn == nil {
+		delete(customExtractors, ext)
+		return
+	}
+	customExtractors[ext] = fn
+}
+
+func lookupExtractor(ext string) (ExtractorFunc, bool) {
+	customExtractorsMu.RLock()
+	defer customExtractorsMu.RUnlock()
+	fn, ok := customExtractors[ext]
+	return fn, ok
+}
+
+// ExtractContent identifies the file type and extracts text, within the
+// limits set by SetExtractOptions. Unless disabled with SetContentSniffing,
+// the file's contents decide the format when the extension is missing or wrong.
 func ExtractContent(path string) (*ExtractionResult, error) {
+	return extractFile(path, packageExtractConfig())
+}
+
+// ExtractContentWithOptions is ExtractContent with some of the package-wide
+// settings overridden for this call only, e.g.
+//
+//	ExtractContentWithOptions(path, WithOCR(nil), WithHTMLMode(HTMLContent), WithMaxPages(10))
+//
+// An unknown mode is an error.
+func ExtractContentWithOptions(path string, opts ...ExtractOption) (*ExtractionResult, error) {
+	cfg := packageExtractConfig()
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if err := cfg.check(); err != nil {
+		return nil, err
+	}
+	return extractFile(path, cfg)
+}
+
+// extractFile is ExtractContent with the settings of cfg
+func extractFile(path string, cfg *extractConfig) (*ExtractionResult, error) {
 	ext := strings.ToLower(filepath.Ext(path))
 
+	fn := builtinExtractor(ext)
+	if fn == nil {
+		if custom, ok := lookupExtractor(ext); ok {
+			info, err := os.Stat(path)
+			if err != nil {
+				return nil, err
+			}
+			if err := cfg.limits.checkFileSize(info.Size()); err != nil {
+				return nil, err
+			}
+			return cfg.limits.withTimeout(ext, func() (*ExtractionResult, error) {
+				return cfg.limits.finishResult(custom(path))
+			})
+		}
+		if !cfg.sniff {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedExtension, ext)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.limits.checkFileSize(info.Size()); err != nil {
+		return nil, err
+	}
+	return extractSource(source{r: f, size: info.Size(), path: path, ext: ext, cfg: cfg})
+}
+
+// ExtractContentFromReader extracts text from streamed or in-memory data
+// (S3 objects, HTTP bodies, archive members). ext selects the format, with or
+// without the leading dot. Readers that are not io.ReaderAt are buffered in memory.
+func ExtractContentFromReader(r io.Reader, ext string) (*ExtractionResult, error) {
+	cfg := packageExtractConfig()
+	ext = strings.ToLower(ext)
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+
+	fn := builtinExtractor(ext)
+	if fn == nil {
+		custom, ok := lookupExtractor(ext)
+		if !ok && !cfg.sniff {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedExtension, ext)
+		}
+		if ok {
+			// Custom extractors only accept paths
+			src, err := newReaderSource(r, cfg)
+			if err != nil {
+				return nil, err
+			}
+			src.ext = ext
+			path, cleanup, err := src.localPath()
+			if err != nil {
+				return nil, err
+			}
+			defer cleanup()
+			return cfg.limits.withTimeout(ext, func() (*ExtractionResult, error) {
+				return cfg.limits.finishResult(custom(path))
+			})
+		}
+	}
+
+	src, err := newReaderSource(r, cfg)
+	if err != nil {
+		return nil, err
+	}
+	src.ext = ext
+	return extractSource(src)
+}
+
+// extractSource runs the built-in extractor for src, sniffing the real format first if enabled
+func extractSource(src source) (*ExtractionResult, error) {
+	if src.cfg.sniff {
+		src.ext = sniffExtension(src, src.ext)
+	}
+	fn := builtinExtractor(src.ext)
+	if fn == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedExtension, src.ext)
+	}
+	return src.cfg.limits.withTimeout(src.ext, func() (*ExtractionResult, error) {
+		res, err := fn(src)
+		return src.cfg.limits.finishResult(res, corruptError(err))
+	})
+}
+
+// corruptError wraps the error of a built-in extractor with ErrCorruptFile,
+// unless it comes from a limit, an unsupported format, reading the file or
+// running a missing tool
+func corruptError(err error) error {
+	var pathErr *fs.PathError
+	var execErr *exec.Error
+	switch {
+	case err == nil,
+		errors.Is(err, ErrTooLarge),
+		errors.Is(err, ErrUnsupportedExtension),
+		errors.Is(err, ErrCorruptFile),
+		errors.As(err, &pathErr),
+		errors.As(err, &execErr):
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrCorruptFile, err)
+}
+
+// finishResult applies MaxPages and fills in metadata every format can provide
+func (o ExtractOptions) finishResult(res *ExtractionResult, err error) (*ExtractionResult, error) {
+	if err != nil || res == nil {
+		return res, err
+	}
+	o.truncatePages(res)
+	if _, ok := res.Metadata[MetaPages]; !ok && len(res.Pages) > 0 {
+		res.setMeta(MetaPages, strconv.Itoa(len(res.Pages)))
+	}
+	return res, nil
+}
+
+// builtinExtractor returns the extractor for a lower-cased extension, or nil
+func builtinExtractor(ext string) func(source) (*ExtractionResult, error) {
 	switch ext {
 	case ".pdf":
-		return extractPDF(path)
+		return extractPDF
 	case ".docx":
-		return extractDOCX(path)
+		return extractDOCX
+	case ".doc":
+		return extractDOC
 	case ".xlsx":
-		return extractXLSX(path)
+		return extractXLSX
 	case ".html", ".htm":
-		return extractHTML(path)
+		return extractHTML
 	case ".pptx":
-		return extractPPTX(path)
+		return extractPPTX
 	case ".xls":
-		return extractXLS(path)
+		return extractXLS
 	case ".csv":
-		return extractCSV(path)
+		return extractCSV
 	case ".rtf":
-		return extractRTF(path)
-	case ".txt", ".md":
-		return extractPlain(path)
-	default:
-		return nil, fmt.Errorf("unsupported file extension: %s", ext)
+		return extractRTF
+	case ".epub":
+		return extractEPUB
+	case ".json":
+		return extractJSON
+	case ".yaml", ".yml":
+		return extractYAML
+	case ".eml":
+		return extractEML
+	case ".mbox":
+		return extractMBOX
+	case ".msg":
+		return extractMSG
+	case ".pst":
+		return extractPST
+	case ".png", ".jpg", ".jpeg", ".tif", ".tiff", ".bmp", ".gif":
+		return extractImage
+	case ".md", ".markdown":
+		return extractMarkdown
+	case ".tex", ".ltx":
+		return extractLaTeX
+	case ".srt", ".vtt":
+		return extractSubtitles
+	case ".xps", ".oxps":
+		return extractXPS
+	case ".djvu", ".djv":
+		return extractDJVU
+	case ".txt":
+		return extractPlain
 	}
+	if _, ok := codeSyntaxes[ext]; ok {
+		return extractCode
+	}
+	return nil
+}
+
+// source is the input handed to built-in extractors: random access to the
+// data, plus the original path when it came from disk (OCR tools need a file),
+// and the settings to extract it with
+type source struct {
+	r    io.ReaderAt
+	size int64
+	path string
+	ext  string
+	cfg  *extractConfig
+}
+
+// newReaderSource wraps r for random access, buffering it when it is not seekable
+func newReaderSource(r io.Reader, cfg *extractConfig) (source, error) {
+	if ra, ok := r.(io.ReaderAt); ok {
+		if seeker, ok := r.(io.Seeker); ok {
+			size, err := seeker.Seek(0, io.SeekEnd)
+			if err == nil {
+				return source{r: ra, size: size, cfg: cfg}, cfg.limits.checkFileSize(size)
+			}
+		}
+	}
+	data, err := cfg.limits.limitedReadAll(r)
+	if err != nil {
+		return source{}, err
+	}
+	return source{r: bytes.NewReader(data), size: int64(len(data)), cfg: cfg}, nil
+}
+
+// reader returns a fresh sequential reader over the whole source
+func (s source) reader() *io.SectionReader {
+	return io.NewSectionReader(s.r, 0, s.size)
+}
+
+func (s source) readAll() ([]byte, error) {
+	return io.ReadAll(s.reader())
+}
+
+// localPath returns a filesystem path holding the data, writing a temp file
+// when the source did not come from disk. cleanup removes that temp file.
+func (s source) localPath() (string, func(), error) {
+	if s.path != "" {
+		return s.path, func() {}, nil
+	}
+	tmp, err := os.CreateTemp("", "tokentrove-*"+s.ext)
+	if err != nil {
+		return "", func() {}, err
+	}
+	cleanup := func() { os.Remove(tmp.Name()) }
+	_, err = io.Copy(tmp, s.reader())
+	tmp.Close()
+	if err != nil {
+		cleanup()
+		return "", func() {}, err
+	}
+	return tmp.Name(), cleanup, nil
 }
 
 // ... (existing extractPlain, extractPDF, extractDOCX, extractXLSX, extractHTML) ...
@@ -58,21 +340,23 @@ func ExtractContent(path string) (*ExtractionResult, error) {
 
 // NEW FUNCTIONS
 
-func extractCSV(path string) (*ExtractionResult, error) {
-	content, err := os.ReadFile(path)
+func extractCSV(src source) (*ExtractionResult, error) {
+	content, err := src.readAll()
 	if err != nil {
 		return nil, err
 	}
 	// CSV is basically text, but we might want to return it as-is or parsed?
 	// The user wants "pure text". Raw CSV is text.
-	text := string(content)
-	return &ExtractionResult{
+	text, enc := decodeText(content)
+	res := &ExtractionResult{
 		FullText: text,
 		Pages:    []string{text},
-	}, nil
+	}
+	res.setMeta(MetaEncoding, enc)
+	return res, nil
 }
 
-func extractXLS(path string) (res *ExtractionResult, err error) {
+func extractXLS(src source) (res *ExtractionResult, err error) {
 	// Panic recovery for bad XLS files (library can panic)
 	defer func() {
 		if r := recover(); r != nil {
@@ -80,13 +364,14 @@ func extractXLS(path string) (res *ExtractionResult, err error) {
 		}
 	}()
 
-	xl, err := xls.Open(path, "utf-8")
+	xl, err := xls.OpenReader(src.reader(), "utf-8")
 	if err != nil {
 		return nil, err
 	}
 
 	var fullTextBuilder strings.Builder
 	var pages []string
+	var sheetNames []string
 
 	for i := 0; i < xl.NumSheets(); i++ {
 		sheet := xl.GetSheet(i)
@@ -94,6 +379,8 @@ func extractXLS(path string) (res *ExtractionResult, err error) {
 			continue
 		}
 
+		sheetNames = append(sheetNames, sheet.Name)
+
 		var sheetText strings.Builder
 		for row := 0; row <= int(sheet.MaxRow); row++ {
 			r := sheet.Row(row)
@@ -115,20 +402,19 @@ func extractXLS(path string) (res *ExtractionResult, err error) {
 		fullTextBuilder.WriteString(text)
 	}
 
-	return &ExtractionResult{
+	res = &ExtractionResult{
 		FullText: fullTextBuilder.String(),
 		Pages:    pages,
-	}, nil
+	}
+	res.setMeta(MetaSheets, strings.Join(sheetNames, ", "))
+	res.mergeMeta(readOLESummary(src))
+	return res, nil
 }
 
-func extractRTF(path string) (*ExtractionResult, error) {
+func extractRTF(src source) (*ExtractionResult, error) {
 	// Simple RTF stripper using library or manual?
 	// J45k4/rtf seems to be a reader.
-	f, err := os.Open(path)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
+	f := src.reader()
 
 	// The library github.com/J45k4/rtf claims to read RTF.
 	// We need to see how to get plain text.
@@ -168,37 +454,59 @@ func extractRTF(path string) (*ExtractionResult, error) {
 	}, nil
 }
 
-func extractPlain(path string) (*ExtractionResult, error) {
-	content, err := os.ReadFile(path)
+func extractPlain(src source) (*ExtractionResult, error) {
+	content, err := src.readAll()
 	if err != nil {
 		return nil, err
 	}
-	text := string(content)
-	return &ExtractionResult{
+	text, enc := decodeText(content)
+	res := &ExtractionResult{
 		FullText: text,
 		Pages:    []string{text},
-	}, nil
+	}
+	res.setMeta(MetaEncoding, enc)
+	return res, nil
 }
 
-func extractPDF(path string) (*ExtractionResult, error) {
-	f, r, err := pdf.Open(path)
+func extractPDF(src source) (*ExtractionResult, error) {
+	r, err := pdf.NewReader(src.r, src.size)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
+
+	// A file path for OCR is only materialized if a page needs it
+	ocrPath, cleanupOCR := "", func() {}
+	defer func() { cleanupOCR() }()
 
 	var pages []string
 	var fullTextBuilder strings.Builder
 
 	totalPage := r.NumPage()
-	for i := 1; i <= totalPage; i++ {
+	for i := 1; i <= totalPage && !src.cfg.limits.pageLimitReached(len(pages)); i++ {
 		p := r.Page(i)
 		if p.V.IsNull() {
 			continue
 		}
 		text, err := p.GetPlainText(nil)
 		if err != nil {
-			// specific page error, continue?
+			// A broken text layer is read like a missing one
+			text = ""
+		}
+		// Scanned pages have no text layer, fall back to OCR when enabled
+		if strings.TrimSpace(text) == "" && src.cfg.ocr != nil {
+			if ocrPath == "" {
+				if tmpPath, cleanup, err := src.localPath(); err == nil {
+					ocrPath, cleanupOCR = tmpPath, cleanup
+				}
+			}
+			if ocrPath != "" {
+				if ocrText, ocrErr := src.cfg.ocr.RecognizePDFPage(ocrPath, i); ocrErr == nil {
+					text, err = ocrText, nil
+				}
+			}
+		}
+		if err != nil {
+			// Neither the text layer nor OCR read the page
 			continue
 		}
 		pages = append(pages, text)
@@ -206,28 +514,44 @@ func extractPDF(path string) (*ExtractionResult, error) {
 		fullTextBuilder.WriteString("\n")
 	}
 
-	return &ExtractionResult{
+	res := &ExtractionResult{
 		FullText: fullTextBuilder.String(),
 		Pages:    pages,
-	}, nil
+	}
+	res.setMeta(MetaPages, strconv.Itoa(totalPage))
+	if info := r.Trailer().Key("Info"); !info.IsNull() {
+		res.setMeta(MetaTitle, info.Key("Title").Text())
+		res.setMeta(MetaAuthor, info.Key("Author").Text())
+		res.setMeta(MetaSubject, info.Key("Subject").Text())
+		res.setMeta(MetaProducer, info.Key("Producer").Text())
+		if created := info.Key("CreationDate").Text(); created != "" {
+			res.setMeta(MetaCreated, parsePDFDate(created))
+		}
+		if modified := info.Key("ModDate").Text(); modified != "" {
+			res.setMeta(MetaModified, parsePDFDate(modified))
+		}
+	}
+	return res, nil
 }
 
-func extractDOCX(path string) (*ExtractionResult, error) {
-	r, err := docx.ReadDocxFile(path)
+func extractDOCX(src source) (*ExtractionResult, error) {
+	r, err := docx.ReadDocxFromMemory(src.r, src.size)
 	if err != nil {
 		return nil, err
 	}
 	defer r.Close()
 
 	content := r.Editable().GetContent()
-	return &ExtractionResult{
+	res := &ExtractionResult{
 		FullText: content,
 		Pages:    []string{content}, // DOCX is continuous flow, no pages in data structure
-	}, nil
+	}
+	res.mergeMeta(readOOXMLMetadata(src))
+	return res, nil
 }
 
-func extractXLSX(path string) (*ExtractionResult, error) {
-	f, err := excelize.OpenFile(path)
+func extractXLSX(src source) (*ExtractionResult, error) {
+	f, err := excelize.OpenReader(src.reader())
 	if err != nil {
 		return nil, err
 	}
@@ -254,23 +578,45 @@ func extractXLSX(path string) (*ExtractionResult, error) {
 		fullTextBuilder.WriteString(text)
 	}
 
-	return &ExtractionResult{
+	res := &ExtractionResult{
 		FullText: fullTextBuilder.String(),
 		Pages:    pages,
-	}, nil
+	}
+	res.setMeta(MetaSheets, strings.Join(f.GetSheetList(), ", "))
+	res.mergeMeta(readOOXMLMetadata(src))
+	return res, nil
 }
 
-func extractHTML(path string) (*ExtractionResult, error) {
-	content, err := os.ReadFile(path)
+func extractHTML(src source) (*ExtractionResult, error) {
+	doc, err := html.Parse(src.reader())
 	if err != nil {
 		return nil, err
 	}
 
-	doc, err := html.Parse(bytes.NewReader(content))
+	var result string
+	if src.cfg.htmlMode == HTMLContent {
+		result = htmlContentText(doc)
+	} else {
+		result = htmlNodeText(doc)
+	}
+	res := &ExtractionResult{
+		FullText: result,
+		Pages:    []string{result},
+	}
+	res.mergeMeta(htmlMetadata(doc))
+	return res, nil
+}
+
+// htmlToText parses an HTML/XHTML document and joins its text nodes with spaces
+func htmlToText(r io.Reader) (string, error) {
+	doc, err := html.Parse(r)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
+	return htmlNodeText(doc), nil
+}
 
+func htmlNodeText(doc *html.Node) string {
 	var f func(*html.Node)
 	var textBuilder strings.Builder
 
@@ -289,20 +635,59 @@ func extractHTML(path string) (*ExtractionResult, error) {
 	}
 	f(doc)
 
-	result := textBuilder.String()
-	return &ExtractionResult{
-		FullText: result,
-		Pages:    []string{result},
-	}, nil
+	return textBuilder.String()
+}
+
+// htmlMetadata reads <title>, <html lang> and the author/date <meta> tags
+func htmlMetadata(doc *html.Node) map[string]string {
+	meta := make(map[string]string)
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "html":
+				meta[MetaLanguage] = htmlAttr(n, "lang")
+			case "title":
+				if n.FirstChild != nil && meta[MetaTitle] == "" {
+					meta[MetaTitle] = n.FirstChild.Data
+				}
+			case "meta":
+				content := htmlAttr(n, "content")
+				switch strings.ToLower(htmlAttr(n, "name")) {
+				case "author":
+					meta[MetaAuthor] = content
+				case "description":
+					meta[MetaSubject] = content
+				case "date", "dcterms.created":
+					meta[MetaCreated] = content
+				case "dcterms.modified", "last-modified":
+					meta[MetaModified] = content
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(doc)
+	return meta
+}
+
+func htmlAttr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
 }
 
 // Minimal XML structs for parsing PPTX slides
-func extractPPTX(path string) (*ExtractionResult, error) {
-	r, err := zip.OpenReader(path)
+func extractPPTX(src source) (*ExtractionResult, error) {
+	r, err := zip.NewReader(src.r, src.size)
 	if err != nil {
 		return nil, err
 	}
-	defer r.Close()
 
 	var pages []string
 	var fullTextBuilder strings.Builder
@@ -315,6 +700,9 @@ func extractPPTX(path string) (*ExtractionResult, error) {
 	// but simple iteration checks "ppt/slides/slide" prefix.
 
 	for _, f := range r.File {
+		if src.cfg.limits.pageLimitReached(len(pages)) {
+			break
+		}
 		if strings.HasPrefix(f.Name, "ppt/slides/slide") && strings.HasSuffix(f.Name, ".xml") {
 			rc, err := f.Open()
 			if err != nil {
@@ -359,8 +747,10 @@ func extractPPTX(path string) (*ExtractionResult, error) {
 		}
 	}
 
-	return &ExtractionResult{
+	res := &ExtractionResult{
 		FullText: fullTextBuilder.String(),
 		Pages:    pages,
-	}, nil
+	}
+	res.mergeMeta(readOOXMLMetadata(src))
+	return res, nil
 }
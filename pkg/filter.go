@@ -0,0 +1,110 @@
+package pkg
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/RoaringBitmap/roaring/v2"
+)
+
+// SourcePath returns the path of the document a token file listed in
+// files.txt was converted from: "2023/report.pdf" for "2023/report.pdf.txt"
+// and "2023/report.pdf.page0001.txt"
+func SourcePath(tokenPath string) string {
+	return pageSuffixRe.ReplaceAllString(strings.TrimSuffix(tokenPath, ".txt"), "")
+}
+
+// FilterFiles returns the files of files.txt whose path matches pathGlob and
+// whose source document has one of the comma-separated extensions exts
+// (".pdf,docx"; case does not matter). Either may be empty to match every
+// file. In pathGlob, * and ? stay within a directory and ** spans any number
+// of them; it is matched against both the token file's and the source
+// document's path, and a pattern naming a directory matches the files under
+// it.
+func FilterFiles(cacheDir, pathGlob, exts string) (*roaring.Bitmap, error) {
+	files, err := readLines(filepath.Join(cacheDir, "files.txt"))
+	if err != nil {
+		return nil, fmt.Errorf("could not read files.txt (run -cache tokens first): %w", err)
+	}
+	return MatchFiles(files, pathGlob, exts)
+}
+
+// MatchFiles is FilterFiles over a list of token file paths
+func MatchFiles(files []string, pathGlob, exts string) (*roaring.Bitmap, error) {
+	pattern, err := splitPathGlob(pathGlob)
+	if err != nil {
+		return nil, err
+	}
+	wantExt := extensionSet(strings.Split(exts, ","))
+
+	set := roaring.New()
+	for i, f := range files {
+		f = filepath.ToSlash(f)
+		source := SourcePath(f)
+		if len(wantExt) > 0 && !wantExt[strings.ToLower(path.Ext(source))] {
+			continue
+		}
+		if pattern != nil && !matchPath(pattern, f) && !matchPath(pattern, source) {
+			continue
+		}
+		set.Add(uint32(i))
+	}
+	return set, nil
+}
+
+// splitPathGlob splits a path glob into its segments, or returns nil for an
+// empty one
+func splitPathGlob(pathGlob string) ([]string, error) {
+	if pathGlob = strings.Trim(filepath.ToSlash(pathGlob), "/"); pathGlob == "" {
+		return nil, nil
+	}
+	pattern := strings.Split(pathGlob, "/")
+	for _, seg := range pattern {
+		if _, err := path.Match(seg, ""); err != nil {
+			return nil, fmt.Errorf("invalid path pattern %q: %w", pathGlob, err)
+		}
+	}
+	return pattern, nil
+}
+
+// extensionSet returns extensions such as "pdf" or ".PDF" as a set of
+// lowercase extensions with their dot
+func extensionSet(exts []string) map[string]bool {
+	set := make(map[string]bool)
+	for _, ext := range exts {
+		if ext = strings.ToLower(strings.TrimSpace(ext)); ext != "" {
+			set["."+strings.TrimPrefix(ext, ".")] = true
+		}
+	}
+	return set
+}
+
+// matchPath matches a slash-separated path against a glob split into
+// segments, or against the directory the glob names
+func matchPath(pattern []string, name string) bool {
+	segs := strings.Split(name, "/")
+	return matchSegments(pattern, segs) || matchSegments(append(pattern[:len(pattern):len(pattern)], "**"), segs)
+}
+
+// matchSegments matches path segments one glob segment at a time; "**"
+// matches any number of segments
+func matchSegments(pattern, segs []string) bool {
+	if len(pattern) == 0 {
+		return len(segs) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segs); i++ {
+			if matchSegments(pattern[1:], segs[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segs) == 0 {
+		return false
+	}
+	ok, _ := path.Match(pattern[0], segs[0])
+	return ok && matchSegments(pattern[1:], segs[1:])
+}
@@ -0,0 +1,197 @@
+package pkg
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// HTML extraction modes
+const (
+	HTMLFull    = "full"    // every text node, as before
+	HTMLContent = "content" // main content only, one paragraph per line
+)
+
+var htmlMode = HTMLFull
+
+// SetHTMLMode selects how .html/.htm documents are turned into text
+func SetHTMLMode(mode string) error {
+	if err := checkHTMLMode(mode); err != nil {
+		return err
+	}
+	htmlMode = mode
+	return nil
+}
+
+func checkHTMLMode(mode string) error {
+	switch mode {
+	case HTMLFull, HTMLContent:
+		return nil
+	}
+	return fmt.Errorf("unknown html mode: %s (use 'full' or 'content')", mode)
+}
+
+// htmlSkipTags never contain readable content
+var htmlSkipTags = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true,
+	"nav": true, "footer": true, "aside": true,
+	"form": true, "iframe": true, "svg": true, "button": true,
+	"select": true, "dialog": true, "menu": true,
+}
+
+// htmlBlockTags end a paragraph
+var htmlBlockTags = map[string]bool{
+	"p": true, "div": true, "section": true, "article": true, "main": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"li": true, "dt": true, "dd": true, "blockquote": true, "pre": true,
+	"table": true, "tr": true, "figcaption": true, "br": true, "hr": true,
+	"ul": true, "ol": true, "dl": true, "address": true,
+}
+
+// htmlBoilerplateHints in a class or id mark cookie banners, menus and the like
+var htmlBoilerplateHints = []string{
+	"cookie", "consent", "banner", "navbar", "menu", "breadcrumb",
+	"sidebar", "footer", "advert", "promo", "social", "share", "newsletter",
+	"related", "popup", "modal", "skip-link",
+}
+
+// htmlContentText returns the readable main content of a page: boilerplate
+// elements are dropped and each paragraph becomes one line
+func htmlContentText(doc *html.Node) string {
+	root := htmlContentRoot(doc)
+
+	var paragraphs []string
+	var current strings.Builder
+	flush := func() {
+		if text := strings.Join(strings.Fields(current.String()), " "); text != "" {
+			paragraphs = append(paragraphs, text)
+		}
+		current.Reset()
+	}
+
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			current.WriteString(n.Data)
+			return
+		case html.ElementNode:
+			if htmlIsBoilerplate(n) {
+				return
+			}
+		}
+
+		block := n.Type == html.ElementNode && htmlBlockTags[n.Data]
+		if block {
+			flush()
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+		if block {
+			flush()
+		}
+	}
+	f(root)
+	flush()
+
+	return strings.Join(paragraphs, "\n")
+}
+
+// htmlContentRoot picks <main>, else the longest <article>, else <body>
+func htmlContentRoot(doc *html.Node) *html.Node {
+	var mainNode, body, article *html.Node
+	articleLen := 0
+
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch {
+			case n.Data == "main" || htmlAttr(n, "role") == "main":
+				if mainNode == nil {
+					mainNode = n
+				}
+			case n.Data == "article":
+				if l := len(htmlNodeText(n)); l > articleLen {
+					article, articleLen = n, l
+				}
+			case n.Data == "body":
+				body = n
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(doc)
+
+	switch {
+	case mainNode != nil:
+		return mainNode
+	case article != nil:
+		return article
+	case body != nil:
+		return body
+	}
+	return doc
+}
+
+// htmlIsBoilerplate reports whether an element and its subtree should be dropped
+func htmlIsBoilerplate(n *html.Node) bool {
+	if htmlSkipTags[n.Data] {
+		return true
+	}
+	if _, hidden := htmlAttrOK(n, "hidden"); hidden || htmlAttr(n, "aria-hidden") == "true" {
+		return true
+	}
+	// Page-level containers often carry layout classes like "has-sidebar"
+	switch n.Data {
+	case "html", "body", "main", "article":
+		return false
+	}
+	switch htmlAttr(n, "role") {
+	case "navigation", "banner", "contentinfo", "complementary", "dialog", "alert":
+		return true
+	}
+
+	hints := strings.ToLower(htmlAttr(n, "class") + " " + htmlAttr(n, "id"))
+	for _, hint := range htmlBoilerplateHints {
+		if strings.Contains(hints, hint) {
+			return true
+		}
+	}
+
+	// Link lists (menus, tag clouds, "read more" blocks) are mostly anchor text
+	switch n.Data {
+	case "div", "ul", "ol", "section", "table":
+		total := len(strings.TrimSpace(htmlNodeText(n)))
+		if total > 0 && total < 1000 && htmlLinkTextLen(n)*2 > total {
+			return true
+		}
+	}
+	return false
+}
+
+// htmlLinkTextLen is the amount of text inside <a> elements under n
+func htmlLinkTextLen(n *html.Node) int {
+	total := 0
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.Data == "a" {
+			total += len(strings.TrimSpace(htmlNodeText(c)))
+			continue
+		}
+		total += htmlLinkTextLen(c)
+	}
+	return total
+}
+
+// htmlAttrOK is htmlAttr that also reports whether the attribute is present
+func htmlAttrOK(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,928 @@
+package pkg
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/RoaringBitmap/roaring/v2"
+)
+
+// Incremental cache state, kept next to the cache files:
+//
+//	filehashes.txt        relpath \t sha256 \t size \t mtime (unix nanos), in files.txt order
+//	snapshots/<sha256>.gz token text of each file as last indexed, so a changed or
+//	                      deleted file's n-gram counts can be subtracted
+//	{n}gramcounts.txt     key,count for every n-gram ({n}gramfreq.txt keeps the
+//	                      unpruned ones seen at least the minimum count)
+const (
+	fileHashesName  = "filehashes.txt"
+	snapshotDirName = "snapshots"
+)
+
+// fileState identifies the content of a token file at the last cache update
+type fileState struct {
+	Hash    string
+	Size    int64
+	ModTime int64
+}
+
+// UpdateCache brings a cache up to date with inputDir, re-tokenizing only the
+// files that were added or whose content changed, and merging the result into
+// uniq.txt, files.txt, fileuniqindex.txt and the n-gram files. A cache without
+// file hashes (or built from another input directory) gets a full Analyze first.
+func UpdateCache(ctx context.Context, inputDir, outputDir string, maxN int) error {
+	if maxN < 2 {
+		return fmt.Errorf("ngrams must be at least 2")
+	}
+
+	states, err := loadFileStates(outputDir)
+	if err != nil || readCacheInput(outputDir) != inputDir || checkCacheWords(outputDir) != nil {
+		logger.Info("No incremental state for this input and tokenizer, running full analysis", "input", inputDir)
+		if err := Analyze(ctx, inputDir, outputDir, maxN); err != nil {
+			return err
+		}
+		return initIncrementalState(ctx, inputDir, outputDir, maxN)
+	}
+	return updateCacheIncremental(ctx, inputDir, outputDir, maxN, states)
+}
+
+// readCacheInput returns the input= path from settings.txt, or ""
+func readCacheInput(outputDir string) string {
+	data, err := os.ReadFile(filepath.Join(outputDir, "settings.txt"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "input=") {
+			return strings.TrimPrefix(line, "input=")
+		}
+	}
+	return ""
+}
+
+// initIncrementalState records hashes, snapshots and full n-gram counts for a
+// freshly built cache
+func initIncrementalState(ctx context.Context, inputDir, outputDir string, maxN int) error {
+	logger.Info("Recording incremental state")
+	files, err := readLines(filepath.Join(outputDir, "files.txt"))
+	if err != nil {
+		return fmt.Errorf("could not read files.txt: %w", err)
+	}
+	words, err := readLines(filepath.Join(outputDir, "uniq.txt"))
+	if err != nil {
+		return fmt.Errorf("could not read uniq.txt: %w", err)
+	}
+
+	states := make(map[string]fileState, len(files))
+	for _, relPath := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		path := filepath.Join(inputDir, relPath)
+		state, err := hashFile(path)
+		if err != nil {
+			continue
+		}
+		if err := writeSnapshot(outputDir, path, state.Hash); err != nil {
+			return err
+		}
+		states[relPath] = state
+	}
+	if err := writeFileStates(outputDir, files, states); err != nil {
+		return err
+	}
+
+	wordToIndex := indexWords(words)
+	filter := newNgramFilter(wordToIndex)
+	for n := 2; n <= maxN; n++ {
+		counts := countNgramsFromFiles(inputDir, files, wordToIndex, n)
+		if err := writeNgramCounts(outputDir, n, counts, filter); err != nil {
+			return err
+		}
+	}
+	logger.Info("Incremental state written", "files", len(states))
+	return recordIncrementalSteps(outputDir, maxN)
+}
+
+// updateCacheIncremental applies the changes of inputDir to the cache. It
+// stops for ctx only until it starts writing, as the cache files are
+// rewritten together; the steps rebuilt after them stop like any build.
+func updateCacheIncremental(ctx context.Context, inputDir, outputDir string, maxN int, oldStates map[string]fileState) error {
+	logger.Info("Updating cache incrementally", "input", inputDir, "output", outputDir)
+
+	oldFiles, err := readLines(filepath.Join(outputDir, "files.txt"))
+	if err != nil {
+		return fmt.Errorf("could not read files.txt: %w", err)
+	}
+	oldWords, err := readLines(filepath.Join(outputDir, "uniq.txt"))
+	if err != nil {
+		return fmt.Errorf("could not read uniq.txt: %w", err)
+	}
+
+	// Find added, changed and removed files; only files whose size or mtime
+	// moved are re-hashed
+	newStates := make(map[string]fileState)
+	var current []string
+	err = filepath.Walk(inputDir, func(path string, info os.FileInfo, err error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err != nil || info.IsDir() || skipTokenFile(path) {
+			return nil
+		}
+		relPath, err := filepath.Rel(inputDir, path)
+		if err != nil {
+			return nil
+		}
+		old, ok := oldStates[relPath]
+		if ok && old.Size == info.Size() && old.ModTime == info.ModTime().UnixNano() {
+			newStates[relPath] = old
+		} else if state, err := hashFile(path); err == nil {
+			newStates[relPath] = state
+		} else {
+			return nil
+		}
+		current = append(current, relPath)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var added, changed, removed []string
+	for _, relPath := range current {
+		old, ok := oldStates[relPath]
+		switch {
+		case !ok:
+			added = append(added, relPath)
+		case old.Hash != newStates[relPath].Hash:
+			changed = append(changed, relPath)
+		}
+	}
+	for _, relPath := range oldFiles {
+		if _, ok := newStates[relPath]; !ok {
+			removed = append(removed, relPath)
+		}
+	}
+	logger.Info("Compared files", "added", len(added), "changed", len(changed), "removed", len(removed),
+		"unchanged", len(current)-len(added)-len(changed))
+	if len(added)+len(changed)+len(removed) == 0 {
+		// Refresh mtimes so the next run does not re-hash touched files
+		if err := writeFileStates(outputDir, oldFiles, newStates); err != nil {
+			return err
+		}
+		logger.Info("Cache is up to date")
+		return nil
+	}
+
+	// Surviving files keep their order, new files are appended. Changed files
+	// keep their slot but lose their old postings.
+	changedSet := make(map[string]bool, len(changed))
+	for _, relPath := range changed {
+		changedSet[relPath] = true
+	}
+	var newFiles []string
+	oldToNew := make([]int, len(oldFiles))
+	for i, relPath := range oldFiles {
+		oldToNew[i] = -1
+		if _, ok := newStates[relPath]; !ok {
+			continue
+		}
+		if !changedSet[relPath] {
+			oldToNew[i] = len(newFiles)
+		}
+		newFiles = append(newFiles, relPath)
+	}
+	newFiles = append(newFiles, added...)
+
+	// Tokens of the new versions, and of the old versions from their snapshots
+	fresh := make(map[int][]string)
+	for fIdx, relPath := range newFiles {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if changedSet[relPath] || oldStates[relPath].Hash == "" {
+			tokens, err := readTokens(filepath.Join(inputDir, relPath))
+			if err != nil {
+				continue
+			}
+			fresh[fIdx] = tokens
+		}
+	}
+	var stale [][]string
+	exactCounts := true
+	for _, relPath := range append(append([]string{}, changed...), removed...) {
+		tokens, err := readSnapshot(outputDir, oldStates[relPath].Hash)
+		if err != nil {
+			exactCounts = false
+			continue
+		}
+		stale = append(stale, tokens)
+	}
+
+	// Word -> files, from the old index plus the fresh tokens
+	wordFiles := make(map[string]*roaring.Bitmap)
+	err = scanIndexFile(filepath.Join(outputDir, "fileuniqindex.txt"), func(wIdx int, files *roaring.Bitmap) {
+		if wIdx >= len(oldWords) {
+			return
+		}
+		it := files.Iterator()
+		for it.HasNext() {
+			if f := int(it.Next()); f < len(oldToNew) && oldToNew[f] >= 0 {
+				addPosting(wordFiles, oldWords[wIdx], oldToNew[f])
+			}
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("could not read fileuniqindex.txt: %w", err)
+	}
+	for fIdx, tokens := range fresh {
+		for _, word := range tokens {
+			if word != sentenceBreakToken {
+				addPosting(wordFiles, word, fIdx)
+			}
+		}
+	}
+
+	newWords := make([]string, 0, len(wordFiles))
+	for word := range wordFiles {
+		newWords = append(newWords, word)
+	}
+	sort.Strings(newWords)
+	wordToIndex := indexWords(newWords)
+	oldWordToNew := make([]int, len(oldWords))
+	for i, word := range oldWords {
+		if idx, ok := wordToIndex[word]; ok {
+			oldWordToNew[i] = idx
+		} else {
+			oldWordToNew[i] = -1
+		}
+	}
+
+	if err := writeLines(filepath.Join(outputDir, "uniq.txt"), newWords); err != nil {
+		return err
+	}
+	if err := writeLines(filepath.Join(outputDir, "files.txt"), newFiles); err != nil {
+		return err
+	}
+	if stemmer != nil {
+		paths := make([]string, 0, len(fresh))
+		for fIdx := range fresh {
+			paths = append(paths, filepath.Join(inputDir, newFiles[fIdx]))
+		}
+		if err := updateStemForms(outputDir, paths); err != nil {
+			return fmt.Errorf("could not update %s: %w", StemFormsName, err)
+		}
+	}
+	wordPostings := make([]*roaring.Bitmap, len(newWords))
+	for i, word := range newWords {
+		wordPostings[i] = wordFiles[word]
+	}
+	if err := writeIndexFile(filepath.Join(outputDir, "fileuniqindex.txt"), wordPostings); err != nil {
+		return err
+	}
+	logger.Info("Vocabulary", "words", len(oldWords), "newWords", len(newWords), "files", len(oldFiles), "newFiles", len(newFiles))
+
+	// File and word indices may have moved, so positions are rewritten whole
+	if indexPositions || fileExists(filepath.Join(outputDir, PositionsName)) {
+		src := &tokenSource{inputDir: inputDir, wordToIndex: wordToIndex}
+		if err := buildPositions(context.WithoutCancel(ctx), outputDir, src, newFiles); err != nil {
+			return err
+		}
+	}
+
+	freshIdx := make(map[int][]int, len(fresh))
+	for fIdx, tokens := range fresh {
+		freshIdx[fIdx] = tokensToIndices(tokens, wordToIndex)
+	}
+
+	filter := newNgramFilter(wordToIndex)
+	for n := 2; n <= maxN; n++ {
+		logger.Info("Merging n-grams", "n", n)
+		if err := mergeNgramIndex(inputDir, outputDir, n, newFiles, wordToIndex, oldWordToNew, oldToNew, freshIdx, filter); err != nil {
+			return err
+		}
+
+		var counts map[string]int
+		if exactCounts {
+			counts, err = mergeNgramCounts(outputDir, n, oldWordToNew, wordToIndex, stale, freshIdx)
+		}
+		if !exactCounts || err != nil {
+			// Old contributions are unknown; count this n from scratch
+			counts = countNgramsFromFiles(inputDir, newFiles, wordToIndex, n)
+		}
+		if err := writeNgramCounts(outputDir, n, counts, filter); err != nil {
+			return err
+		}
+	}
+
+	if CacheFileExists(filepath.Join(outputDir, "2gramfiles.txt")) {
+		if err := BuildNgramFilesCache(context.WithoutCancel(ctx), outputDir, maxN); err != nil {
+			return err
+		}
+	}
+
+	// Snapshots for new content, then drop those no file refers to any more
+	for fIdx := range fresh {
+		relPath := newFiles[fIdx]
+		if err := writeSnapshot(outputDir, filepath.Join(inputDir, relPath), newStates[relPath].Hash); err != nil {
+			return err
+		}
+	}
+	removeUnusedSnapshots(outputDir, newFiles, newStates)
+	if err := writeFileStates(outputDir, newFiles, newStates); err != nil {
+		return err
+	}
+	if err := recordIncrementalSteps(outputDir, maxN); err != nil {
+		return err
+	}
+	// The bolt databases hold the counts and postings before the update
+	os.Remove(filepath.Join(outputDir, NgramCountsDB))
+	os.Remove(filepath.Join(outputDir, NgramPostingsDB))
+	// ID streams index the old vocabulary
+	if hasDocs(outputDir) {
+		if err := BuildDocsCache(ctx, outputDir); err != nil {
+			return err
+		}
+	}
+	if CacheFileExists(filepath.Join(outputDir, TFIDFName)) {
+		if err := BuildTFIDFCache(ctx, outputDir); err != nil {
+			return err
+		}
+	}
+	if err := rebuildNormalizedVocab(outputDir); err != nil {
+		return err
+	}
+	if CacheFileExists(filepath.Join(outputDir, FileDatesName)) {
+		if err := BuildDatesCache(ctx, outputDir); err != nil {
+			return err
+		}
+	}
+	if fileExists(filepath.Join(outputDir, StatsName)) {
+		if err := BuildStatsCache(ctx, outputDir); err != nil {
+			return err
+		}
+	}
+	if CacheFileExists(filepath.Join(outputDir, "2gramcolloc.txt")) {
+		if err := BuildCollocationCache(ctx, outputDir, maxN); err != nil {
+			return err
+		}
+	}
+	if fileExists(filepath.Join(outputDir, DuplicatesName)) {
+		if err := BuildDedupCache(ctx, outputDir); err != nil {
+			return err
+		}
+	}
+
+	logger.Info("Done! Cache updated", "dir", outputDir)
+	return nil
+}
+
+// recordIncrementalSteps records every step an incremental update rewrote in
+// the manifest, in dependency order so none looks older than its inputs
+func recordIncrementalSteps(outputDir string, maxN int) error {
+	if err := finishStep(outputDir, StepTokens, 0, "settings.txt", "uniq.txt", "files.txt", StemFormsName); err != nil {
+		return err
+	}
+	steps := []struct {
+		step      string
+		artifacts []string
+	}{
+		{StepIndex, []string{"fileuniqindex.txt", "fileuniqindex.bin", PositionsName}},
+		{StepNgrams, ngramIndexArtifacts(outputDir, maxN)},
+		{StepNgramFreq, ngramArtifacts(maxN, "%dgramfreq.txt", "%dgramcounts.txt")},
+		{StepNgramFiles, ngramArtifacts(maxN, "%dgramfiles.txt")},
+	}
+	for _, st := range steps {
+		if len(st.artifacts) == 0 || !CacheFileExists(filepath.Join(outputDir, st.artifacts[0])) {
+			continue
+		}
+		if err := beginStep(outputDir, st.step); err != nil {
+			return err
+		}
+		if err := finishStep(outputDir, st.step, maxN, st.artifacts...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeNgramIndex remaps the n-gram index of n to the new word and file
+// numbering and adds the n-grams of the re-tokenized files. Without an
+// existing index the n-grams of every file are collected. The index is
+// rewritten with the current shard count and pruning settings; n-grams pruned
+// by an earlier build only count the files added since.
+func mergeNgramIndex(inputDir, outputDir string, n int, files []string, wordToIndex map[string]int, oldWordToNew, oldToNew []int, fresh map[int][]int, filter *ngramFilter) error {
+	var keys []string
+	keyToIndex := make(map[string]int)
+	var postings []*roaring.Bitmap
+	add := func(key string, fIdx int) {
+		if filter.skipKey(key) {
+			return
+		}
+		idx, ok := keyToIndex[key]
+		if !ok {
+			idx = len(keys)
+			keyToIndex[key] = idx
+			keys = append(keys, key)
+			postings = append(postings, roaring.New())
+		}
+		postings[idx].Add(uint32(fIdx))
+	}
+
+	// Shards hold their n-grams in global order, so old entries are collected
+	// and replayed by their global number
+	type oldEntry struct {
+		idx   int
+		key   string
+		files *roaring.Bitmap
+	}
+	var old []oldEntry
+	err := scanNgramIndex(outputDir, n, func(nIdx int, key string, files *roaring.Bitmap) {
+		old = append(old, oldEntry{nIdx, key, files})
+	})
+	if err == nil {
+		sort.Slice(old, func(i, j int) bool { return old[i].idx < old[j].idx })
+		for _, e := range old {
+			key, ok := remapNgramKey(e.key, oldWordToNew)
+			if !ok {
+				continue
+			}
+			it := e.files.Iterator()
+			for it.HasNext() {
+				if f := int(it.Next()); f < len(oldToNew) && oldToNew[f] >= 0 {
+					add(key, oldToNew[f])
+				}
+			}
+		}
+		old = nil
+	}
+	if err != nil {
+		// No usable index for this n: collect it from every file
+		keys, keyToIndex, postings = nil, make(map[string]int), nil
+		for fIdx, relPath := range files {
+			tokens, err := readTokens(filepath.Join(inputDir, relPath))
+			if err != nil {
+				continue
+			}
+			for _, key := range ngramKeys(tokensToIndices(tokens, wordToIndex), n) {
+				add(key, fIdx)
+			}
+		}
+	} else {
+		for fIdx, words := range fresh {
+			for _, key := range ngramKeys(words, n) {
+				add(key, fIdx)
+			}
+		}
+	}
+
+	kept := keys[:0:0]
+	for idx, key := range keys {
+		if postings[idx].GetCardinality() >= uint64(ngramMinFiles) {
+			kept = append(kept, key)
+		}
+	}
+	w, err := createNgramIndex(outputDir, n, ngramShardCounts(kept, shardCount()))
+	if err != nil {
+		return err
+	}
+	for idx, key := range keys {
+		if postings[idx].GetCardinality() < uint64(ngramMinFiles) {
+			continue
+		}
+		if err := w.add(key, postings[idx]); err != nil {
+			w.abort()
+			return err
+		}
+	}
+	return w.close()
+}
+
+// mergeNgramCounts remaps {n}gramcounts.txt, subtracts the stale token
+// streams and adds the fresh ones
+func mergeNgramCounts(outputDir string, n int, oldWordToNew []int, wordToIndex map[string]int, stale [][]string, fresh map[int][]int) (map[string]int, error) {
+	f, err := OpenCacheFile(filepath.Join(outputDir, fmt.Sprintf("%dgramcounts.txt", n)))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	counts := make(map[string]int)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		comma := strings.LastIndex(line, ",")
+		if comma == -1 {
+			continue
+		}
+		count, err := strconv.Atoi(line[comma+1:])
+		if err != nil {
+			continue
+		}
+		if key, ok := remapNgramKey(line[:comma], oldWordToNew); ok {
+			counts[key] += count
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, tokens := range stale {
+		for _, key := range ngramKeys(tokensToIndices(tokens, wordToIndex), n) {
+			counts[key]--
+		}
+	}
+	for _, words := range fresh {
+		for _, key := range ngramKeys(words, n) {
+			counts[key]++
+		}
+	}
+	for key, count := range counts {
+		if count <= 0 {
+			delete(counts, key)
+		}
+	}
+	return counts, nil
+}
+
+// countNgramsFromFiles counts every n-gram occurrence across the token files
+func countNgramsFromFiles(inputDir string, files []string, wordToIndex map[string]int, n int) map[string]int {
+	counts := make(map[string]int)
+	for _, relPath := range files {
+		tokens, err := readTokens(filepath.Join(inputDir, relPath))
+		if err != nil {
+			continue
+		}
+		for _, key := range ngramKeys(tokensToIndices(tokens, wordToIndex), n) {
+			counts[key]++
+		}
+	}
+	return counts
+}
+
+// writeNgramCounts writes {n}gramcounts.txt with every n-gram and
+// {n}gramfreq.txt with those the filter keeps that were seen at least the
+// minimum count, most frequent first
+func writeNgramCounts(outputDir string, n int, counts map[string]int, filter *ngramFilter) error {
+	type ngramFreq struct {
+		ngram string
+		count int
+	}
+	all := make([]ngramFreq, 0, len(counts))
+	for ngram, count := range counts {
+		all = append(all, ngramFreq{ngram, count})
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].count != all[j].count {
+			return all[i].count > all[j].count
+		}
+		return all[i].ngram < all[j].ngram
+	})
+
+	countsFile, err := CreateCacheFile(filepath.Join(outputDir, fmt.Sprintf("%dgramcounts.txt", n)))
+	if err != nil {
+		return err
+	}
+	defer AbortCacheFile(countsFile)
+	freqFile, err := CreateCacheFile(filepath.Join(outputDir, fmt.Sprintf("%dgramfreq.txt", n)))
+	if err != nil {
+		return err
+	}
+	defer AbortCacheFile(freqFile)
+
+	countsWriter := bufio.NewWriter(countsFile)
+	freqWriter := bufio.NewWriter(freqFile)
+	for _, nf := range all {
+		line := fmt.Sprintf("%s,%d\n", nf.ngram, nf.count)
+		countsWriter.WriteString(line)
+		if nf.count >= ngramMinCount && !filter.skipKey(nf.ngram) {
+			freqWriter.WriteString(line)
+		}
+	}
+	if err := countsWriter.Flush(); err != nil {
+		return err
+	}
+	if err := freqWriter.Flush(); err != nil {
+		return err
+	}
+	if err := countsFile.Close(); err != nil {
+		return err
+	}
+	return freqFile.Close()
+}
+
+// remapNgramKey rewrites a "w1|w2|..." key to new word indices, leaving
+// skip-gram wildcards as they are; ok is false if a word left the vocabulary
+func remapNgramKey(key string, oldWordToNew []int) (string, bool) {
+	parts := strings.Split(key, "|")
+	for i, p := range parts {
+		if p == SkipgramWildcard {
+			continue
+		}
+		idx, err := strconv.Atoi(p)
+		if err != nil || idx < 0 || idx >= len(oldWordToNew) || oldWordToNew[idx] < 0 {
+			return "", false
+		}
+		parts[i] = strconv.Itoa(oldWordToNew[idx])
+	}
+	return strings.Join(parts, "|"), true
+}
+
+// ngramKeys returns the "w1|w2|..." key of every n-gram in words that does
+// not span a sentence break
+func ngramKeys(words []int, n int) []string {
+	if len(words) < n {
+		return nil
+	}
+	keys := make([]string, 0, len(words)-n+1)
+	parts := make([]string, n)
+	for i := 0; i <= len(words)-n; i++ {
+		if crossesBreak(words, i, n) {
+			continue
+		}
+		for j := 0; j < n; j++ {
+			parts[j] = strconv.Itoa(words[i+j])
+		}
+		keys = append(keys, strings.Join(parts, "|"))
+	}
+	return keys
+}
+
+// tokensToIndices maps tokens to vocabulary indices, dropping unknown tokens
+// the way the cache builders do. Sentence break tokens become sentenceBreak.
+func tokensToIndices(tokens []string, wordToIndex map[string]int) []int {
+	words := make([]int, 0, len(tokens))
+	for _, t := range tokens {
+		if t == sentenceBreakToken {
+			words = append(words, sentenceBreak)
+		} else if idx, ok := wordToIndex[t]; ok {
+			words = append(words, idx)
+		}
+	}
+	return words
+}
+
+func indexWords(words []string) map[string]int {
+	wordToIndex := make(map[string]int, len(words))
+	for i, w := range words {
+		wordToIndex[w] = i
+	}
+	return wordToIndex
+}
+
+func addPosting(postings map[string]*roaring.Bitmap, word string, fIdx int) {
+	if postings[word] == nil {
+		postings[word] = roaring.New()
+	}
+	postings[word].Add(uint32(fIdx))
+}
+
+// readTokens returns the whitespace-separated tokens of a token file. With
+// sentence boundaries on, a sentenceBreakToken separates the tokens of
+// consecutive lines.
+func readTokens(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return scanTokens(f)
+}
+
+func scanTokens(r io.Reader) ([]string, error) {
+	var tokens []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	for scanner.Scan() {
+		fields := tokenWords(scanner.Text())
+		if sentenceBoundaries && len(fields) > 0 && len(tokens) > 0 {
+			tokens = append(tokens, sentenceBreakToken)
+		}
+		tokens = append(tokens, fields...)
+	}
+	return tokens, scanner.Err()
+}
+
+// scanIndexFile calls fn for every "idx,[f1,f2,...]" line
+func scanIndexFile(path string, fn func(idx int, files *roaring.Bitmap)) error {
+	return scanIndexLines(path, func(idx int, files *roaring.Bitmap) error {
+		fn(idx, files)
+		return nil
+	})
+}
+
+// scanIndexLines is scanIndexFile stopping at the first error of fn, which
+// it returns unless it is errStopScan
+func scanIndexLines(path string, fn func(idx int, files *roaring.Bitmap) error) error {
+	f, err := OpenCacheFile(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 10*1024*1024), 10*1024*1024)
+	for scanner.Scan() {
+		idx, files, err := ParseIndexLine(scanner.Text())
+		if err != nil {
+			continue
+		}
+		if err := fn(idx, files); err != nil {
+			if err == errStopScan {
+				return nil
+			}
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// writeIndexFile writes one "idx,[f1,f2,...]" line per posting set, plus the
+// matching binary posting file
+func writeIndexFile(path string, postings []*roaring.Bitmap) error {
+	f, err := CreateCacheFile(path)
+	if err != nil {
+		return err
+	}
+	defer AbortCacheFile(f)
+
+	writer := bufio.NewWriter(f)
+	for idx, set := range postings {
+		set.RunOptimize()
+		writeIndexLine(writer, idx, set)
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return WritePostings(PostingsPath(path), postings)
+}
+
+func readLines(path string) ([]string, error) {
+	f, err := OpenCacheFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+func writeLines(path string, lines []string) error {
+	f, err := createAtomic(path)
+	if err != nil {
+		return err
+	}
+	defer f.Abort()
+	if err := writeLinesTo(f, lines); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func writeLinesTo(w io.Writer, lines []string) error {
+	writer := bufio.NewWriter(w)
+	for _, line := range lines {
+		writer.WriteString(line)
+		writer.WriteString("\n")
+	}
+	return writer.Flush()
+}
+
+// hashFile returns the sha256, size and mtime of a file
+func hashFile(path string) (fileState, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return fileState{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fileState{}, err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return fileState{}, err
+	}
+	return fileState{
+		Hash:    hex.EncodeToString(h.Sum(nil)),
+		Size:    info.Size(),
+		ModTime: info.ModTime().UnixNano(),
+	}, nil
+}
+
+func loadFileStates(outputDir string) (map[string]fileState, error) {
+	lines, err := readLines(filepath.Join(outputDir, fileHashesName))
+	if err != nil {
+		return nil, err
+	}
+	states := make(map[string]fileState, len(lines))
+	for _, line := range lines {
+		parts := strings.Split(line, "\t")
+		if len(parts) != 4 {
+			continue
+		}
+		size, _ := strconv.ParseInt(parts[2], 10, 64)
+		modTime, _ := strconv.ParseInt(parts[3], 10, 64)
+		states[parts[0]] = fileState{Hash: parts[1], Size: size, ModTime: modTime}
+	}
+	return states, nil
+}
+
+func writeFileStates(outputDir string, files []string, states map[string]fileState) error {
+	lines := make([]string, 0, len(files))
+	for _, relPath := range files {
+		state, ok := states[relPath]
+		if !ok {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s\t%s\t%d\t%d", relPath, state.Hash, state.Size, state.ModTime))
+	}
+	return writeLines(filepath.Join(outputDir, fileHashesName), lines)
+}
+
+// removeUnusedSnapshots removes the snapshots no file in files refers to
+func removeUnusedSnapshots(outputDir string, files []string, states map[string]fileState) {
+	referenced := make(map[string]bool, len(files))
+	for _, relPath := range files {
+		if state, ok := states[relPath]; ok {
+			referenced[state.Hash] = true
+		}
+	}
+	entries, err := os.ReadDir(filepath.Join(outputDir, snapshotDirName))
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if !referenced[strings.TrimSuffix(e.Name(), ".gz")] {
+			os.Remove(filepath.Join(outputDir, snapshotDirName, e.Name()))
+		}
+	}
+}
+
+// writeSnapshot stores a gzip copy of a token file under its content hash
+func writeSnapshot(outputDir, path, hash string) error {
+	dir := filepath.Join(outputDir, snapshotDirName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	dst := filepath.Join(dir, hash+".gz")
+	if _, err := os.Stat(dst); err == nil {
+		return nil
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	out, err := createAtomic(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Abort()
+
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, src); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+func readSnapshot(outputDir, hash string) ([]string, error) {
+	f, err := os.Open(filepath.Join(outputDir, snapshotDirName, hash+".gz"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	return scanTokens(gz)
+}
@@ -0,0 +1,153 @@
+package pkg
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// LanguageUnknown is returned when a document has too little text to classify
+const LanguageUnknown = "und"
+
+// languageSeeds are short samples of the most frequent words of each language.
+// Trigram profiles are built from them at startup, so no model files ship with the binary.
+var languageSeeds = map[string]string{
+	"en": `the of and to in is that it was for on are as with his they at be this from have or by one had not but what all were when we there can an your which their said if do will each about how up out them then she many some so these would other into has more her two like him see time could no make than first been its who now people my made over did down only way find use may water long little very after words called just where most know get through back much before go good new write our used me man too any day same right look think also around another came come work three word must because does part even place well such here take why things help put years different away again off went old number great tell men say small every found still between name should home big give air line set own under read last never us left end along while might next sound below saw something thought both few those always looked show large often together asked house world going want school important until form food keep children feet land side without boy once animals life enough took sometimes four head above kind began almost live page got earth need far hand high year mother light parts country father let night following picture being study second eyes soon times story boys since white days ever paper hard near sentence better best across during today others however sure means knew its try told young miles sun ways thing whole hear example heard several change answer room sea against top turned learn point city play toward five using himself usually money seen`,
+	"de": `der die und in den von zu das mit sich des auf für ist im dem nicht ein die eine als auch es an werden aus er hat dass sie nach wird bei einer der um am sind noch wie einem über einen das so zum war haben nur oder aber vor zur bis mehr durch man sein wurde sei in prozent hatte kann gegen vom können schon wenn habe seine mark ihre dann unter wir soll ich eines es jahr zwei jahren diese dieser wieder keine uhr seiner worden und will zwischen immer millionen ein was sagte gibt alle diesem seit muss wurden beim doch jetzt waren drei jahre mark neue neuen damit bereits da auch ihr seinen müssen ab ihrer ohne sondern selbst ersten nun etwa heute weil ihm menschen deutschland anderen werde ihren sagt sehr rund dies eigenen ganz bisher weiter großen fast wo`,
+	"fr": `de la le et les des en un du une que est pour qui dans par plus pas au sur ne se le il sont ce avec mais on ou son elle nous comme été tout leur aux cette ses deux lui fait ont sa même aussi entre dont bien ces sans peut être après était tous encore autres fois faire avait dire très ans où depuis contre premier sous doit leurs selon alors quand années avant trois ainsi moins peu notre chez toute mais donc cela où autre temps déjà nos entre vous je tout rien jamais elles celui votre toujours faut pendant afin grand car lors nouveau nouvelle celle française france pays monde`,
+	"es": `de la que el en y a los del se las por un para con no una su al es lo como más pero sus le ya o este sí porque esta entre cuando muy sin sobre también me hasta hay donde quien desde todo nos durante todos uno les ni contra otros ese eso ante ellos e esto mí antes algunos qué unos yo otro otras otra él tanto esa estos mucho quienes nada muchos cual poco ella estar estas algunas algo nosotros mi mis tú te ti tu tus ellas nosotras vosotros vosotras os mío mía míos mías tuyo año años país gobierno parte después tiene puede ser hace han fue era había están forma vez cada`,
+	"it": `di e il la che in a per un è non del le si con una dei da sono i al ma come più anche ha alla nel della gli lo delle su cui se o ci questo sua ad era essere tra loro quando stato suo fra quello molto hanno nella ai degli tutti dal anni dopo due dalla sul prima solo può tutto ancora fatto così dove sia quale ogni contro quella fare mentre tempo poi perché questa io nostro parte cosa sempre senza già modo nei sulla anno grande italia paese altri ora alcuni tre invece oggi proprio qui`,
+	"pt": `de a o que e do da em um para é com não uma os no se na por mais as dos como mas foi ao ele das tem à seu sua ou ser quando muito há nos já está eu também só pelo pela até isso ela entre era depois sem mesmo aos ter seus quem nas me esse eles estão você tinha foram essa num nem suas meu às minha têm numa pelos elas havia seja qual será nós tenho lhe deles essas esses pelas este fosse dele tu te vocês vos lhes meus minhas teu tua ano anos governo país brasil ainda sobre apenas porque pode fazer tempo grande`,
+	"nl": `de en van het een in is dat op te zijn met voor niet aan er die ook als door maar om dan bij of worden nog wel uit naar heeft kan al over ze hij zo tot was wordt hebben meer ik geen deze zich moet nu je wat werd onder worden we veel jaar twee waren tegen na omdat waar zou ons andere alle hun zijn toen kunnen hem haar mensen tijd nieuwe grote nederland eerste daar goed zonder tussen echter gaat altijd iets`,
+	"sv": `och i att det som en på är av för med till den har de inte om ett han men var jag sig från vi så kan man när år säger hon under också efter eller nu sin där vid mot ska skulle kommer ut får finns vara hade alla andra mycket än här då sedan över bara in blir upp även vad få två vill ha många hur mer går sverige kronor detta nya procent skall hans utan sina något svenska allt första fick måste mellan blev bli dag någon några sitt stora varit dem bland bra tre ta genom del hela annat fram gör ingen stockholm`,
+	"pl": `i w nie na się z że do to jest jak o co ale po tak za od już jego przez jej ich być czy tylko może był jeszcze dla go są też które który bardzo tym kiedy gdy były więc było także ten tego tej ma ja mi mnie pan pani są lub oraz gdzie będzie roku lat polsce polski jednak przed między wszystko nawet swoje sobie bez ponad według dwa trzy teraz zawsze nigdy wtedy każdy inne innych`,
+	"ru": `и в не на я что он с как а то все она так его но да ты к у же вы за бы по только ее мне было вот от меня еще нет о из ему теперь когда даже ну вдруг ли если уже или ни быть был него до вас нибудь опять уж вам ведь там потом себя ничего ей может они тут где есть надо ней для мы тебя их чем была сам чтоб без будто чего раз тоже себе под будет ж тогда кто этот того потому этого какой совсем ним здесь этом один почти мой тем чтобы нее сейчас были куда зачем всех никогда можно при наконец два об другой хоть после над больше тот через эти нас про всего них какая много разве три эту моя впрочем хорошо свою этой перед иногда лучше чуть том нельзя такой им более всегда конечно всю между год россии года`,
+}
+
+// trigramProfileSize is the number of top trigrams compared (Cavnar & Trenkle)
+const trigramProfileSize = 300
+
+var languageProfiles = buildLanguageProfiles()
+
+func buildLanguageProfiles() map[string]map[string]int {
+	profiles := make(map[string]map[string]int, len(languageSeeds))
+	for lang, seed := range languageSeeds {
+		profiles[lang] = rankTrigrams(seed)
+	}
+	return profiles
+}
+
+// rankTrigrams returns the most frequent padded word trigrams of text mapped to their rank
+func rankTrigrams(text string) map[string]int {
+	counts := make(map[string]int)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}) {
+		runes := []rune(" " + word + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			counts[string(runes[i:i+3])]++
+		}
+	}
+
+	trigrams := make([]string, 0, len(counts))
+	for t := range counts {
+		trigrams = append(trigrams, t)
+	}
+	sort.Slice(trigrams, func(i, j int) bool {
+		if counts[trigrams[i]] != counts[trigrams[j]] {
+			return counts[trigrams[i]] > counts[trigrams[j]]
+		}
+		return trigrams[i] < trigrams[j]
+	})
+	if len(trigrams) > trigramProfileSize {
+		trigrams = trigrams[:trigramProfileSize]
+	}
+
+	ranks := make(map[string]int, len(trigrams))
+	for i, t := range trigrams {
+		ranks[t] = i
+	}
+	return ranks
+}
+
+// DetectLanguage returns the ISO 639-1 code of the dominant language of text,
+// or LanguageUnknown. Non-Latin scripts are identified by script alone; Latin
+// and Cyrillic text is classified by trigram profile distance.
+func DetectLanguage(text string) string {
+	// The first 16KB is plenty and keeps large documents cheap
+	if len(text) > 16*1024 {
+		text = text[:16*1024]
+	}
+
+	if lang := detectScript(text); lang != "" {
+		return lang
+	}
+
+	doc := rankTrigrams(text)
+	if len(doc) < 20 {
+		return LanguageUnknown
+	}
+
+	best, bestDist := LanguageUnknown, -1
+	for lang, profile := range languageProfiles {
+		dist := 0
+		for t, rank := range doc {
+			if pRank, ok := profile[t]; ok {
+				if pRank > rank {
+					dist += pRank - rank
+				} else {
+					dist += rank - pRank
+				}
+			} else {
+				dist += trigramProfileSize
+			}
+		}
+		if bestDist == -1 || dist < bestDist {
+			best, bestDist = lang, dist
+		}
+	}
+	return best
+}
+
+// detectScript classifies text written mostly in a script used by a single language
+func detectScript(text string) string {
+	counts := make(map[string]int)
+	letters := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			counts["ja"]++
+		case unicode.Is(unicode.Hangul, r):
+			counts["ko"]++
+		case unicode.Is(unicode.Han, r):
+			counts["zh"]++
+		case unicode.Is(unicode.Arabic, r):
+			counts["ar"]++
+		case unicode.Is(unicode.Greek, r):
+			counts["el"]++
+		case unicode.Is(unicode.Hebrew, r):
+			counts["he"]++
+		case unicode.Is(unicode.Thai, r):
+			counts["th"]++
+		case unicode.Is(unicode.Devanagari, r):
+			counts["hi"]++
+		}
+	}
+	if letters == 0 {
+		return ""
+	}
+	// Japanese mixes kana with Han characters
+	if counts["ja"] > 0 && counts["ja"]+counts["zh"] > letters/2 {
+		return "ja"
+	}
+	for lang, n := range counts {
+		if n > letters/2 {
+			return lang
+		}
+	}
+	return ""
+}
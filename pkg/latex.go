@@ -0,0 +1,434 @@
+package pkg
+
+import "strings"
+
+// texSkipEnvs are environments whose whole body is dropped: math, floats,
+// tables, code and drawings
+var texSkipEnvs = map[string]bool{
+	"equation": true, "equation*": true, "align": true, "align*": true,
+	"alignat": true, "alignat*": true, "gather": true, "gather*": true,
+	"multline": true, "multline*": true, "eqnarray": true, "eqnarray*": true,
+	"flalign": true, "flalign*": true, "math": true, "displaymath": true,
+	"figure": true, "figure*": true, "table": true, "table*": true,
+	"tabular": true, "tabular*": true, "tabularx": true, "longtable": true,
+	"tikzpicture": true, "picture": true, "verbatim": true, "verbatim*": true,
+	"lstlisting": true, "minted": true, "algorithm": true, "algorithmic": true,
+	"thebibliography": true, "filecontents": true, "comment": true,
+}
+
+// texDropArgs maps commands whose arguments are not prose to the number of
+// brace arguments to discard (optional [...] arguments are always dropped)
+var texDropArgs = map[string]int{
+	"cite": 1, "citep": 1, "citet": 1, "nocite": 1, "ref": 1, "eqref": 1,
+	"pageref": 1, "autoref": 1, "cref": 1, "Cref": 1, "label": 1, "url": 1,
+	"includegraphics": 1, "input": 1, "include": 1, "usepackage": 1,
+	"RequirePackage": 1, "documentclass": 1, "bibliography": 1,
+	"bibliographystyle": 1, "vspace": 1, "hspace": 1, "pagestyle": 1,
+	"thispagestyle": 1, "hypersetup": 1, "graphicspath": 1, "geometry": 1,
+	"newcommand": 2, "renewcommand": 2, "providecommand": 2,
+	"newenvironment": 3, "renewenvironment": 3, "setlength": 2,
+	"addtolength": 2, "setcounter": 2, "addtocounter": 2, "color": 1,
+	"thanks": 1, "href": 1, "newtheorem": 2, "DeclareMathOperator": 2,
+}
+
+// texSections start a new heading line and are recorded in MetaHeadings
+var texSections = map[string]int{
+	"part": 1, "chapter": 1, "section": 2, "subsection": 3,
+	"subsubsection": 4, "paragraph": 5, "subparagraph": 6,
+}
+
+// texMeta are preamble commands that supply metadata instead of text
+var texMeta = map[string]string{
+	"title": MetaTitle, "author": MetaAuthor, "date": MetaCreated,
+}
+
+// texParser converts LaTeX source to prose in a single pass
+type texParser struct {
+	s        string
+	pos      int
+	meta     map[string]string
+	headings []string
+	inBody   bool // past \begin{document}, or the file has none
+}
+
+// extractLaTeX keeps the prose of a .tex file: commands, comments, math,
+// floats and the preamble are removed, section titles become lines
+func extractLaTeX(src source) (*ExtractionResult, error) {
+	content, err := src.readAll()
+	if err != nil {
+		return nil, err
+	}
+	text, enc := decodeText(content)
+
+	p := &texParser{
+		s:      strings.ReplaceAll(text, "\r\n", "\n"),
+		meta:   make(map[string]string),
+		inBody: !strings.Contains(text, `\begin{document}`),
+	}
+	body := p.parse(false)
+
+	// Collapse the whitespace left behind by removed markup
+	var lines []string
+	blank := false
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line == "" {
+			if !blank && len(lines) > 0 {
+				lines = append(lines, "")
+			}
+			blank = true
+			continue
+		}
+		lines = append(lines, line)
+		blank = false
+	}
+	fullText := strings.TrimSpace(strings.Join(lines, "\n"))
+
+	res := &ExtractionResult{
+		FullText: fullText,
+		Pages:    []string{fullText},
+	}
+	res.mergeMeta(p.meta)
+	res.setMeta(MetaHeadings, strings.Join(p.headings, "\n"))
+	res.setMeta(MetaEncoding, enc)
+	return res, nil
+}
+
+// parse consumes text until the end of input, or the closing brace of the
+// current group if inGroup is set
+func (p *texParser) parse(inGroup bool) string {
+	var out strings.Builder
+	emit := func(s string) {
+		if p.inBody {
+			out.WriteString(s)
+		}
+	}
+
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		switch c {
+		case '%':
+			p.skipComment()
+		case '}':
+			p.pos++
+			if inGroup {
+				return out.String()
+			}
+		case '{':
+			p.pos++
+			emit(p.parse(true))
+		case '$':
+			p.skipDollarMath()
+			emit(" ")
+		case '~':
+			p.pos++
+			emit(" ")
+		case '&':
+			p.pos++
+			emit(" ")
+		case '`', '\'':
+			// ``quoted'' text
+			if p.pos+1 < len(p.s) && p.s[p.pos+1] == c {
+				p.pos += 2
+				emit(`"`)
+			} else {
+				p.pos++
+				emit(string(c))
+			}
+		case '\\':
+			emit(p.command())
+		default:
+			p.pos++
+			emit(string(c))
+		}
+	}
+	return out.String()
+}
+
+// command consumes a control sequence starting at the backslash and returns
+// the text it contributes
+func (p *texParser) command() string {
+	p.pos++ // backslash
+	if p.pos >= len(p.s) {
+		return ""
+	}
+
+	// Control symbols: \\ \[ \( \% \& ...
+	c := p.s[p.pos]
+	if !isTexLetter(c) {
+		p.pos++
+		switch c {
+		case '\\':
+			p.skipStar()
+			p.skipOptional()
+			return "\n"
+		case '[':
+			p.skipUntil(`\]`)
+			return " "
+		case '(':
+			p.skipUntil(`\)`)
+			return " "
+		case '%', '&', '$', '#', '_', '{', '}':
+			return string(c)
+		case ',', ';', ':', '!', ' ', '\n':
+			return " "
+		}
+		return ""
+	}
+
+	start := p.pos
+	for p.pos < len(p.s) && isTexLetter(p.s[p.pos]) {
+		p.pos++
+	}
+	name := p.s[start:p.pos]
+
+	switch name {
+	case "begin":
+		env := p.braceArg()
+		if env == "document" {
+			p.inBody = true
+			return ""
+		}
+		if texSkipEnvs[env] {
+			p.skipEnvironment(env)
+			return "\n"
+		}
+		p.skipOptional()
+		return "\n"
+	case "end":
+		p.braceArg()
+		return "\n"
+	case "item":
+		label := ""
+		if p.peekAfterSpace() == '[' {
+			p.skipSpace()
+			label = p.optionalArg()
+		}
+		return "\n" + label + " "
+	case "par", "newline", "linebreak", "newpage", "clearpage", "maketitle":
+		return "\n"
+	case "def", "let":
+		// \def\name{...} / \let\a\b
+		p.skipSpace()
+		if p.pos < len(p.s) && p.s[p.pos] == '\\' {
+			p.pos++
+			for p.pos < len(p.s) && isTexLetter(p.s[p.pos]) {
+				p.pos++
+			}
+		}
+		if name == "def" {
+			for p.pos < len(p.s) && p.s[p.pos] != '{' {
+				p.pos++
+			}
+			p.skipGroup()
+		} else {
+			p.command()
+		}
+		return ""
+	}
+
+	p.skipStar()
+
+	if key, ok := texMeta[name]; ok && !p.inBody {
+		p.skipOptional()
+		value := p.braceArg()
+		value = strings.ReplaceAll(value, `\and`, ",")
+		sub := &texParser{s: value, meta: p.meta, inBody: true}
+		p.meta[key] = strings.Join(strings.Fields(sub.parse(false)), " ")
+		return ""
+	}
+
+	if level, ok := texSections[name]; ok {
+		p.skipOptional()
+		title := strings.Join(strings.Fields(p.groupText()), " ")
+		if p.inBody && title != "" {
+			p.headings = append(p.headings, strings.Repeat("#", level)+" "+title)
+		}
+		return "\n" + title + "\n"
+	}
+
+	if n, ok := texDropArgs[name]; ok {
+		for i := 0; i < n; i++ {
+			p.skipOptional()
+			p.skipSpace()
+			p.skipGroup()
+		}
+		p.skipOptional()
+		return " "
+	}
+
+	// Unknown commands: the name is dropped, optional arguments too, and any
+	// brace arguments are kept as text by the caller
+	p.skipOptional()
+	return ""
+}
+
+func isTexLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '@'
+}
+
+func (p *texParser) skipComment() {
+	for p.pos < len(p.s) && p.s[p.pos] != '\n' {
+		p.pos++
+	}
+	// A comment swallows its line break and the next line's indentation
+	p.pos++
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *texParser) skipSpace() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t' || p.s[p.pos] == '\n') {
+		p.pos++
+	}
+}
+
+func (p *texParser) peekAfterSpace() byte {
+	i := p.pos
+	for i < len(p.s) && (p.s[i] == ' ' || p.s[i] == '\t') {
+		i++
+	}
+	if i < len(p.s) {
+		return p.s[i]
+	}
+	return 0
+}
+
+func (p *texParser) skipStar() {
+	if p.pos < len(p.s) && p.s[p.pos] == '*' {
+		p.pos++
+	}
+}
+
+// skipOptional drops a [...] argument if one follows
+func (p *texParser) skipOptional() {
+	if p.peekAfterSpace() == '[' {
+		p.skipSpace()
+		p.optionalArg()
+	}
+}
+
+// optionalArg consumes [...] at pos and returns its text
+func (p *texParser) optionalArg() string {
+	p.pos++ // [
+	depth := 0
+	start := p.pos
+	for p.pos < len(p.s) {
+		switch p.s[p.pos] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ']':
+			if depth == 0 {
+				arg := p.s[start:p.pos]
+				p.pos++
+				return arg
+			}
+		}
+		p.pos++
+	}
+	return p.s[start:]
+}
+
+// braceArg returns the raw contents of the next {...} group
+func (p *texParser) braceArg() string {
+	p.skipSpace()
+	if p.pos >= len(p.s) || p.s[p.pos] != '{' {
+		return ""
+	}
+	start := p.pos + 1
+	p.skipGroup()
+	end := p.pos - 1
+	if end < start {
+		return ""
+	}
+	return p.s[start:end]
+}
+
+// groupText parses the next {...} group as prose
+func (p *texParser) groupText() string {
+	p.skipSpace()
+	if p.pos >= len(p.s) || p.s[p.pos] != '{' {
+		return ""
+	}
+	p.pos++
+	inBody := p.inBody
+	p.inBody = true
+	text := p.parse(true)
+	p.inBody = inBody
+	return text
+}
+
+// skipGroup skips a balanced {...} group at pos
+func (p *texParser) skipGroup() {
+	if p.pos >= len(p.s) || p.s[p.pos] != '{' {
+		return
+	}
+	depth := 0
+	for p.pos < len(p.s) {
+		switch p.s[p.pos] {
+		case '\\':
+			p.pos++
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				p.pos++
+				return
+			}
+		}
+		p.pos++
+	}
+}
+
+func (p *texParser) skipUntil(marker string) {
+	if i := strings.Index(p.s[p.pos:], marker); i != -1 {
+		p.pos += i + len(marker)
+		return
+	}
+	p.pos = len(p.s)
+}
+
+// skipDollarMath skips $...$ or $$...$$ starting at pos
+func (p *texParser) skipDollarMath() {
+	if strings.HasPrefix(p.s[p.pos:], "$$") {
+		p.pos += 2
+		p.skipUntil("$$")
+		return
+	}
+	p.pos++
+	for p.pos < len(p.s) {
+		switch p.s[p.pos] {
+		case '\\':
+			p.pos++
+		case '$':
+			p.pos++
+			return
+		}
+		p.pos++
+	}
+}
+
+// skipEnvironment skips to the matching \end{env}, allowing nesting
+func (p *texParser) skipEnvironment(env string) {
+	begin, end := `\begin{`+env+`}`, `\end{`+env+`}`
+	depth := 1
+	for depth > 0 {
+		rest := p.s[p.pos:]
+		e := strings.Index(rest, end)
+		if e == -1 {
+			p.pos = len(p.s)
+			return
+		}
+		if b := strings.Index(rest, begin); b != -1 && b < e {
+			depth++
+			p.pos += b + len(begin)
+			continue
+		}
+		depth--
+		p.pos += e + len(end)
+	}
+}
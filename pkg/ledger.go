@@ -0,0 +1,211 @@
+package pkg
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// LedgerName is the file in the output directory of process recording every
+// input file converted, one JSON LedgerEntry per line
+const LedgerName = "processed.jsonl"
+
+// The statuses of a LedgerEntry
+const (
+	LedgerConverted = "converted" // its outputs were written
+	LedgerIgnored   = "ignored"   // nothing to write: unsupported, too large or another language
+	LedgerFailed    = "failed"    // an error, listed in errors.txt; converted again next run
+	LedgerExisting  = "existing"  // its output was there before the ledger, and kept
+)
+
+// LedgerEntry records how process ended with an input file. The ledger is
+// only appended to, so the last entry of a path is the one in force.
+type LedgerEntry struct {
+	Path       string    `json:"path"` // relative to the input directory, with slashes
+	Hash       string    `json:"hash"` // sha256 of the input file
+	Size       int64     `json:"size"`
+	ModTime    int64     `json:"modTime"` // unix nanos
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"` // the first error, or why it was ignored
+	DurationMS int64     `json:"durationMs"`
+	Time       time.Time `json:"time"`
+}
+
+// done reports whether the entry spares converting the file at path again:
+// the file was converted or ignored and has not changed since
+func (e LedgerEntry) done(path string, info os.FileInfo) bool {
+	return e.Status != LedgerFailed && e.unchanged(path, info)
+}
+
+// unchanged reports whether the file at path is the one the entry recorded:
+// it has the same size and modification time, or else the same size and
+// hash, as a file touched or copied without being edited
+func (e LedgerEntry) unchanged(path string, info os.FileInfo) bool {
+	if info == nil || e.Size != info.Size() {
+		return false
+	}
+	if e.ModTime == info.ModTime().UnixNano() {
+		return true
+	}
+	if e.Hash == "" {
+		return false
+	}
+	state, err := hashFile(path)
+	return err == nil && state.Hash == e.Hash
+}
+
+// What processFile does with a file when outputs are not replaced
+const (
+	resumeConvert = iota // convert it
+	resumeReplace        // convert it, replacing what a crashed run may have left
+	resumeSkip           // skip it: the ledger shows it done and it is unchanged
+	resumeKeep           // keep the output there before the ledger, recording it
+)
+
+// resumeAction decides what processFile does with the file at path when
+// outputs are not replaced, from done, the ledger as the run found it. An
+// output directory without a ledger keeps the outputs there, as it cannot
+// tell a finished one from one cut short; archives and .pst files
+// (containers) check each of their outputs instead.
+func resumeAction(done map[string]LedgerEntry, path, relPath, outBase string, info os.FileInfo, container bool,
+	opts ProcessOptions) int {
+	if done == nil {
+		if !container && outputExists(outBase, opts) {
+			return resumeKeep
+		}
+		return resumeConvert
+	}
+	if entry, ok := done[filepath.ToSlash(relPath)]; ok && entry.done(path, info) {
+		return resumeSkip
+	}
+	return resumeReplace
+}
+
+// LoadLedger returns the last entry of each path in the ledger of an output
+// directory, or nil if it has none. Unreadable lines, such as one cut short
+// by a crash, are skipped.
+func LoadLedger(outputDir string) (map[string]LedgerEntry, error) {
+	f, err := os.Open(filepath.Join(outputDir, LedgerName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries := make(map[string]LedgerEntry)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e LedgerEntry
+		if json.Unmarshal(scanner.Bytes(), &e) == nil && e.Path != "" {
+			entries[e.Path] = e
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// fileOutcome collects what happened to one input file while it is converted
+type fileOutcome struct {
+	written int    // outputs written
+	failed  error  // the first error
+	ignored string // the first reason to write nothing
+}
+
+// status is the ledger status of the file and its error or reason
+func (o *fileOutcome) status() (string, string) {
+	switch {
+	case o.failed != nil:
+		return LedgerFailed, o.failed.Error()
+	case o.written == 0 && o.ignored != "":
+		return LedgerIgnored, o.ignored
+	}
+	return LedgerConverted, ""
+}
+
+// record appends the entry of a file to the ledger, hashing its content
+func (l runLogs) record(path, relPath string, info os.FileInfo, status, reason string, d time.Duration) {
+	e := LedgerEntry{Path: filepath.ToSlash(relPath), Status: status, Error: reason,
+		DurationMS: d.Milliseconds(), Time: time.Now().UTC()}
+	if state, err := hashFile(path); err == nil {
+		e.Hash, e.Size, e.ModTime = state.Hash, state.Size, state.ModTime
+	} else if info != nil {
+		e.Size, e.ModTime = info.Size(), info.ModTime().UnixNano()
+	}
+	l.ledger <- e
+}
+
+// showLedgerStatus prints, by extension, the input files the ledger shows
+// converted, ignored and failed, and those left to convert: not in the
+// ledger, or changed since
+func showLedgerStatus(inputDir, outputDir string, done map[string]LedgerEntry) error {
+	type counts struct{ total, converted, ignored, failed, remaining int }
+	byExt := make(map[string]*counts)
+	err := filepath.Walk(inputDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || strings.HasPrefix(filepath.Base(path), ".") {
+			return nil
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if ext == "" {
+			ext = "(no extension)"
+		}
+		c := byExt[ext]
+		if c == nil {
+			c = &counts{}
+			byExt[ext] = c
+		}
+		c.total++
+		rel, err := filepath.Rel(inputDir, path)
+		if err != nil {
+			return nil
+		}
+		entry, ok := done[filepath.ToSlash(rel)]
+		switch {
+		case !ok || !entry.unchanged(path, info):
+			c.remaining++
+		case entry.Status == LedgerFailed:
+			c.failed++
+		case entry.Status == LedgerIgnored:
+			c.ignored++
+		default:
+			c.converted++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("\n=== Conversion Status ===")
+	fmt.Printf("Input:  %s\n", inputDir)
+	fmt.Printf("Output: %s (from %s)\n\n", outputDir, LedgerName)
+
+	exts := make([]string, 0, len(byExt))
+	for ext := range byExt {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	row := "%-15s %8d %10d %8d %7d %10d\n"
+	fmt.Printf("%-15s %8s %10s %8s %7s %10s\n", "Extension", "Total", "Converted", "Ignored", "Failed", "Remaining")
+	fmt.Println(strings.Repeat("-", 63))
+	var total counts
+	for _, ext := range exts {
+		c := byExt[ext]
+		fmt.Printf(row, ext, c.total, c.converted, c.ignored, c.failed, c.remaining)
+		total.total += c.total
+		total.converted += c.converted
+		total.ignored += c.ignored
+		total.failed += c.failed
+		total.remaining += c.remaining
+	}
+	fmt.Println(strings.Repeat("-", 63))
+	fmt.Printf(row, "TOTAL", total.total, total.converted, total.ignored, total.failed, total.remaining)
+	fmt.Println()
+	return nil
+}
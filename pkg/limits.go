@@ -0,0 +1,177 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExtractOptions bounds the work a single document may cost. Zero values mean
+// no limit.
+type ExtractOptions struct {
+	MaxFileSize int64         // bytes; larger inputs are refused before parsing
+	MaxPages    int           // pages (slides, sheets, chapters, ...) kept per document
+	Timeout     time.Duration // per-document extraction time
+	// FormatTimeouts overrides Timeout per extension (".pdf", ".csv", ...)
+	FormatTimeouts map[string]time.Duration
+}
+
+var (
+	// ErrTooLarge is returned for inputs above ExtractOptions.MaxFileSize
+	ErrTooLarge = errors.New("file exceeds size limit")
+
+	// ErrExtractTimeout is returned when extraction exceeds its timeout
+	ErrExtractTimeout = errors.New("extraction timed out")
+)
+
+var extractOptions ExtractOptions
+
+// SetExtractOptions sets the size, page and time limits applied by ExtractContent
+func SetExtractOptions(opts ExtractOptions) {
+	extractOptions = opts.normalized()
+}
+
+// normalized returns the options with the keys of FormatTimeouts as
+// extractTimeout looks them up
+func (o ExtractOptions) normalized() ExtractOptions {
+	formatTimeouts := make(map[string]time.Duration, len(o.FormatTimeouts))
+	for ext, d := range o.FormatTimeouts {
+		formatTimeouts[normalizeExt(ext)] = d
+	}
+	o.FormatTimeouts = formatTimeouts
+	return o
+}
+
+// ParseFormatTimeouts parses ".pdf=5m,.csv=30s" into per-extension timeouts
+func ParseFormatTimeouts(s string) (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		ext, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid format timeout %q (want ext=duration)", part)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid format timeout %q: %w", part, err)
+		}
+		timeouts[strings.TrimSpace(ext)] = d
+	}
+	return timeouts, nil
+}
+
+// ParseExtWorkers parses ".pdf=2,.docx=4" into per-extension worker counts
+// for ProcessOptions.ExtWorkers
+func ParseExtWorkers(s string) (map[string]int, error) {
+	workers := make(map[string]int)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		ext, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid extension workers %q (want ext=count)", part)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid extension workers %q: want a count of at least 1", part)
+		}
+		workers[normalizeExt(strings.TrimSpace(ext))] = n
+	}
+	return workers, nil
+}
+
+// normalizeExt lowercases an extension and adds its leading dot
+func normalizeExt(ext string) string {
+	ext = strings.ToLower(ext)
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
+
+// checkFileSize refuses inputs above MaxFileSize
+func (o ExtractOptions) checkFileSize(size int64) error {
+	if o.MaxFileSize > 0 && size > o.MaxFileSize {
+		return fmt.Errorf("%w: %d bytes (limit %d)", ErrTooLarge, size, o.MaxFileSize)
+	}
+	return nil
+}
+
+// limitedReadAll buffers r, stopping with ErrTooLarge once MaxFileSize is passed
+func (o ExtractOptions) limitedReadAll(r io.Reader) ([]byte, error) {
+	if o.MaxFileSize <= 0 {
+		return io.ReadAll(r)
+	}
+	data, err := io.ReadAll(io.LimitReader(r, o.MaxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if err := o.checkFileSize(int64(len(data))); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// pageLimitReached reports whether an extractor already holds MaxPages pages
+func (o ExtractOptions) pageLimitReached(pages int) bool {
+	return o.MaxPages > 0 && pages >= o.MaxPages
+}
+
+// truncatePages applies MaxPages to extractors that do not stop early,
+// rebuilding FullText from the kept pages
+func (o ExtractOptions) truncatePages(res *ExtractionResult) {
+	if o.MaxPages <= 0 || len(res.Pages) <= o.MaxPages {
+		return
+	}
+	res.Pages = res.Pages[:o.MaxPages]
+	res.FullText = strings.Join(res.Pages, "\n")
+}
+
+// extractTimeout returns the timeout for ext, or 0 for none
+func (o ExtractOptions) extractTimeout(ext string) time.Duration {
+	if d, ok := o.FormatTimeouts[ext]; ok {
+		return d
+	}
+	return o.Timeout
+}
+
+// withTimeout runs fn, giving up after the timeout for ext. An abandoned
+// extractor keeps running in the background until its input is closed by the caller.
+func (o ExtractOptions) withTimeout(ext string, fn func() (*ExtractionResult, error)) (*ExtractionResult, error) {
+	timeout := o.extractTimeout(ext)
+	if timeout <= 0 {
+		return fn()
+	}
+
+	type result struct {
+		res *ExtractionResult
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- result{nil, fmt.Errorf("extractor panic: %v", r)}
+			}
+		}()
+		res, err := fn()
+		done <- result{res, err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.res, r.err
+	case <-timer.C:
+		return nil, fmt.Errorf("%w after %s", ErrExtractTimeout, timeout)
+	}
+}
@@ -0,0 +1,149 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The formats of NewLogger
+const (
+	LogConsole = "console" // the message, then its attributes as key=value
+	LogText    = "text"    // slog's logfmt lines, with time and level
+	LogJSON    = "json"    // one JSON object per line
+)
+
+// logger receives the progress, warnings and errors of the builds and of the
+// web server; SetLogger replaces it
+var logger = slog.New(NewConsoleHandler(os.Stdout, slog.LevelInfo))
+
+// Logger returns the logger in use
+func Logger() *slog.Logger {
+	return logger
+}
+
+// SetLogger replaces the logger; set it before starting a build
+func SetLogger(l *slog.Logger) {
+	logger = l
+}
+
+// NewLogger returns a logger writing to w the records at level ('debug',
+// 'info', 'warn' or 'error') and above, in format (LogConsole, LogText or
+// LogJSON)
+func NewLogger(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q (use 'debug', 'info', 'warn' or 'error')", level)
+	}
+	switch strings.ToLower(format) {
+	case LogConsole, "":
+		return slog.New(NewConsoleHandler(w, lvl)), nil
+	case LogText:
+		return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: lvl})), nil
+	case LogJSON:
+		return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: lvl})), nil
+	}
+	return nil, fmt.Errorf("invalid log format %q (use 'console', 'text' or 'json')", format)
+}
+
+// ConsoleHandler writes records for a terminal: the message followed by its
+// attributes as key=value, warnings and errors prefixed as such, with no
+// time or level
+type ConsoleHandler struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	level  slog.Leveler
+	attrs  string // the attributes of With, formatted
+	groups string // the groups of WithGroup, as a key prefix
+}
+
+// NewConsoleHandler returns a ConsoleHandler writing the records at level and
+// above to w
+func NewConsoleHandler(w io.Writer, level slog.Leveler) *ConsoleHandler {
+	return &ConsoleHandler{mu: &sync.Mutex{}, w: w, level: level}
+}
+
+// Enabled reports whether records at level are written
+func (h *ConsoleHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+// Handle writes a record as one line
+func (h *ConsoleHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	switch {
+	case r.Level >= slog.LevelError:
+		b.WriteString("Error: ")
+	case r.Level >= slog.LevelWarn:
+		b.WriteString("Warning: ")
+	}
+	b.WriteString(r.Message)
+	b.WriteString(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		writeConsoleAttr(&b, h.groups, a)
+		return true
+	})
+	b.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+// WithAttrs returns a handler adding attrs to every record
+func (h *ConsoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var b strings.Builder
+	for _, a := range attrs {
+		writeConsoleAttr(&b, h.groups, a)
+	}
+	h2 := *h
+	h2.attrs += b.String()
+	return &h2
+}
+
+// WithGroup returns a handler prefixing the keys of later attributes with name
+func (h *ConsoleHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.groups += name + "."
+	return &h2
+}
+
+// writeConsoleAttr writes " key=value", quoting values with spaces
+func writeConsoleAttr(b *strings.Builder, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			writeConsoleAttr(b, prefix, ga)
+		}
+		return
+	}
+	var s string
+	switch a.Value.Kind() {
+	case slog.KindDuration:
+		s = a.Value.Duration().Round(time.Millisecond).String()
+	case slog.KindFloat64:
+		s = strconv.FormatFloat(a.Value.Float64(), 'f', -1, 64)
+	default:
+		s = a.Value.String()
+	}
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		s = strconv.Quote(s)
+	}
+	b.WriteString(" " + prefix + a.Key + "=" + s)
+}
@@ -0,0 +1,410 @@
+package pkg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ManifestVersion is the cache format version written to manifest.json.
+// Caches with another version have to be rebuilt.
+const ManifestVersion = 1
+
+const manifestName = "manifest.json"
+
+// Cache build steps, named after their -cache modes
+const (
+	StepTokens     = "tokens"
+	StepIndex      = "index"
+	StepNgrams     = "ngrams"
+	StepNgramFreq  = "ngramfreq"
+	StepNgramFiles = "ngramfiles"
+)
+
+// stepRequires lists the steps whose output each step reads
+var stepRequires = map[string][]string{
+	StepTokens:       nil,
+	StepDocs:         {StepTokens},
+	StepIndex:        {StepTokens},
+	StepNgrams:       {StepTokens},
+	StepNgramFreq:    {StepTokens},
+	StepNgramFiles:   {StepNgrams},
+	StepTFIDF:        {StepTokens},
+	StepStats:        {StepTokens},
+	StepSkipgrams:    {StepTokens},
+	StepDedup:        {StepTokens},
+	StepCollocations: {StepNgramFreq, StepTFIDF},
+	StepNormalize:    {StepTokens},
+	StepDates:        {StepTokens},
+}
+
+// ErrStaleCache is returned when a cache is partially built, out of date or
+// was modified after it was built
+var ErrStaleCache = errors.New("stale cache")
+
+// Manifest records how and from what a cache directory was built
+type Manifest struct {
+	Version       int                         `json:"version"`
+	Input         string                      `json:"input"`
+	InputChecksum string                      `json:"inputChecksum"` // over token file paths, sizes and mtimes
+	InputFiles    int                         `json:"inputFiles"`
+	MaxN          int                         `json:"maxN,omitempty"`
+	Steps         map[string]*ManifestStep    `json:"steps"`
+	Artifacts     map[string]ManifestArtifact `json:"artifacts"`
+}
+
+// ManifestStep records when a build step ran. Completed is zero while the
+// step is running or after it died.
+type ManifestStep struct {
+	Started   time.Time `json:"started"`
+	Completed time.Time `json:"completed,omitzero"`
+	MaxN      int       `json:"maxN,omitempty"`
+}
+
+// ManifestArtifact is one file written by a build step
+type ManifestArtifact struct {
+	Step   string `json:"step"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// LoadManifest reads manifest.json from a cache directory
+func LoadManifest(cacheDir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(cacheDir, manifestName))
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", manifestName, err)
+	}
+	if m.Steps == nil {
+		m.Steps = make(map[string]*ManifestStep)
+	}
+	if m.Artifacts == nil {
+		m.Artifacts = make(map[string]ManifestArtifact)
+	}
+	return &m, nil
+}
+
+func (m *Manifest) save(cacheDir string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(cacheDir, manifestName), append(data, '\n'))
+}
+
+// stepCommand tells the user how to re-run a step
+func stepCommand(step string) string {
+	return fmt.Sprintf("process -cache %s", step)
+}
+
+// checkStep verifies that step finished, is newer than the steps it depends
+// on, and that its artifacts still match. deep also compares SHA-256 sums.
+func (m *Manifest) checkStep(cacheDir, step string, deep bool) error {
+	s := m.Steps[step]
+	if s == nil {
+		return fmt.Errorf("%w: %s step has not been run (run: %s)", ErrStaleCache, step, stepCommand(step))
+	}
+	if s.Completed.IsZero() {
+		return fmt.Errorf("%w: %s step started %s but did not finish (re-run: %s)",
+			ErrStaleCache, step, s.Started.Format(time.RFC3339), stepCommand(step))
+	}
+	for _, dep := range stepRequires[step] {
+		if d := m.Steps[dep]; d != nil && d.Completed.After(s.Started) {
+			return fmt.Errorf("%w: %s was rebuilt after %s (re-run: %s)", ErrStaleCache, dep, step, stepCommand(step))
+		}
+	}
+
+	var names []string
+	for name, a := range m.Artifacts {
+		if a.Step == step {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		a := m.Artifacts[name]
+		path := filepath.Join(cacheDir, name)
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("%w: %s is missing (re-run: %s)", ErrStaleCache, name, stepCommand(step))
+		}
+		if info.Size() != a.Size {
+			return fmt.Errorf("%w: %s changed since the %s step (re-run: %s)", ErrStaleCache, name, step, stepCommand(step))
+		}
+		if deep {
+			sum, err := fileSHA256(path)
+			if err != nil {
+				return err
+			}
+			if sum != a.SHA256 {
+				return fmt.Errorf("%w: %s changed since the %s step (re-run: %s)", ErrStaleCache, name, step, stepCommand(step))
+			}
+		}
+	}
+	return nil
+}
+
+// VerifyCache checks that the given steps of a cache completed and are
+// consistent. Caches built before manifests existed pass with a warning.
+func VerifyCache(cacheDir string, deep bool, steps ...string) error {
+	if partial := PartialArtifacts(cacheDir); len(partial) > 0 {
+		logger.Warn("Unfinished writes; a build was interrupted, re-run it", "dir", cacheDir,
+			"count", len(partial), "files", strings.Join(partial[:min(len(partial), 5)], ","))
+	}
+	m, err := LoadManifest(cacheDir)
+	if errors.Is(err, os.ErrNotExist) {
+		logger.Warn("No "+manifestName+" (built by an older version); skipping cache checks", "dir", cacheDir)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if m.Version != ManifestVersion {
+		return fmt.Errorf("%w: cache format version %d, expected %d (rebuild with: analyze)", ErrStaleCache, m.Version, ManifestVersion)
+	}
+	for _, step := range steps {
+		if err := m.checkStep(cacheDir, step, deep); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StepCurrent reports, as nil, whether step of the cache in cacheDir
+// completed and is still current for a build from inputDir with n-grams up
+// to maxN: its artifacts are unchanged, no step it reads was rebuilt after
+// it, the n-gram steps went up to maxN, and the tokens step read inputDir and
+// its token files have not changed since. The error says why not.
+func StepCurrent(cacheDir, inputDir, step string, maxN int) error {
+	m, err := LoadManifest(cacheDir)
+	if err != nil {
+		return fmt.Errorf("no %s: %w", manifestName, err)
+	}
+	if m.Version != ManifestVersion {
+		return fmt.Errorf("%w: cache format version %d, expected %d", ErrStaleCache, m.Version, ManifestVersion)
+	}
+	if err := m.checkStep(cacheDir, step, false); err != nil {
+		return err
+	}
+	if (step == StepNgrams || step == StepNgramFreq) && m.Steps[step].MaxN < maxN {
+		return fmt.Errorf("%w: %s step built n-grams up to %d, not %d", ErrStaleCache, step, m.Steps[step].MaxN, maxN)
+	}
+	if step != StepTokens {
+		return nil
+	}
+	if err := checkCacheWords(cacheDir); err != nil {
+		return err
+	}
+	if absPath(m.Input) != absPath(inputDir) {
+		return fmt.Errorf("%w: tokens step read %s, not %s", ErrStaleCache, m.Input, inputDir)
+	}
+	sum, _, err := inputChecksum(inputDir)
+	if err != nil {
+		return fmt.Errorf("could not read token files: %w", err)
+	}
+	if sum != m.InputChecksum {
+		return fmt.Errorf("%w: token files in %s changed since the tokens step", ErrStaleCache, inputDir)
+	}
+	return nil
+}
+
+// absPath is path made absolute and clean, or path itself if it cannot be
+func absPath(path string) string {
+	if a, err := filepath.Abs(path); err == nil {
+		return a
+	}
+	return path
+}
+
+// beginStep checks that the steps a build step reads from are complete and
+// current, then records the step as started. The manifest is created by the
+// tokens step; without one the checks are skipped. Temporary files left by an
+// interrupted build are removed.
+func beginStep(cacheDir, step string) error {
+	removePartialArtifacts(cacheDir)
+	if step == StepTokens {
+		m := &Manifest{
+			Version:   ManifestVersion,
+			Steps:     map[string]*ManifestStep{StepTokens: {Started: time.Now().UTC()}},
+			Artifacts: make(map[string]ManifestArtifact),
+		}
+		return m.save(cacheDir)
+	}
+	if err := checkCacheWords(cacheDir); err != nil {
+		return err
+	}
+
+	m, err := LoadManifest(cacheDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if m.Version != ManifestVersion {
+		return fmt.Errorf("%w: cache format version %d, expected %d (rebuild with: analyze)", ErrStaleCache, m.Version, ManifestVersion)
+	}
+	for _, dep := range stepRequires[step] {
+		if err := m.checkStep(cacheDir, dep, true); err != nil {
+			return err
+		}
+	}
+	if m.Input != "" && stepRequires[step] != nil && m.Steps[StepTokens] != nil {
+		sum, _, err := inputChecksum(m.Input)
+		if err != nil {
+			return fmt.Errorf("could not read token files: %w", err)
+		}
+		if sum != m.InputChecksum {
+			return fmt.Errorf("%w: token files in %s changed since the tokens step (re-run: %s)",
+				ErrStaleCache, m.Input, stepCommand(StepTokens))
+		}
+	}
+
+	// Artifacts of a previous run of this step are no longer trustworthy
+	for name, a := range m.Artifacts {
+		if a.Step == step {
+			delete(m.Artifacts, name)
+		}
+	}
+	m.Steps[step] = &ManifestStep{Started: time.Now().UTC()}
+	return m.save(cacheDir)
+}
+
+// finishStep records a step as completed together with the checksums of the
+// artifacts it wrote (names relative to cacheDir; missing ones are skipped)
+func finishStep(cacheDir, step string, maxN int, artifacts ...string) error {
+	m, err := LoadManifest(cacheDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, name := range cacheArtifacts(cacheDir, artifacts) {
+		path := filepath.Join(cacheDir, name)
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		sum, err := fileSHA256(path)
+		if err != nil {
+			return err
+		}
+		m.Artifacts[name] = ManifestArtifact{Step: step, Size: info.Size(), SHA256: sum}
+	}
+
+	s := m.Steps[step]
+	if s == nil {
+		s = &ManifestStep{Started: time.Now().UTC()}
+		m.Steps[step] = s
+	}
+	s.Completed = time.Now().UTC()
+	s.MaxN = maxN
+	if maxN > 0 {
+		m.MaxN = maxN
+	}
+
+	if step == StepTokens {
+		m.Input = readCacheInput(cacheDir)
+		m.InputChecksum, m.InputFiles, err = inputChecksum(m.Input)
+		if err != nil {
+			return err
+		}
+	}
+	return m.save(cacheDir)
+}
+
+// recordRewrittenSteps records the tokens step and the given steps, with
+// their built n-gram sizes, as complete with the checksums of their current
+// files, for operations that rewrite a cache outside the builders. Steps are
+// recorded in dependency order so none looks older than its inputs.
+func recordRewrittenSteps(cacheDir string, steps map[string]int, maxN int) error {
+	if err := finishStep(cacheDir, StepTokens, 0, "settings.txt", "uniq.txt", "files.txt", StemFormsName); err != nil {
+		return err
+	}
+	order := []struct {
+		step      string
+		artifacts []string
+	}{
+		{StepIndex, []string{"fileuniqindex.txt", "fileuniqindex.bin", PositionsName}},
+		{StepDocs, nil},
+		{StepNgrams, ngramIndexArtifacts(cacheDir, maxN)},
+		{StepNgramFreq, ngramArtifacts(maxN, "%dgramfreq.txt", "%dgramcounts.txt")},
+		{StepNgramFiles, ngramArtifacts(maxN, "%dgramfiles.txt")},
+		{StepTFIDF, []string{TFIDFName}},
+		{StepStats, []string{StatsName, StatsJSONName}},
+		{StepSkipgrams, ngramArtifacts(maxN, "%dskipgramfreq.txt")},
+	}
+	for _, st := range order {
+		stepN, ok := steps[st.step]
+		if !ok {
+			continue
+		}
+		if err := beginStep(cacheDir, st.step); err != nil {
+			return err
+		}
+		if err := finishStep(cacheDir, st.step, stepN, st.artifacts...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ngramArtifacts returns the per-n artifact names for n = 2..maxN
+func ngramArtifacts(maxN int, patterns ...string) []string {
+	var names []string
+	for n := 2; n <= maxN; n++ {
+		for _, p := range patterns {
+			names = append(names, fmt.Sprintf(p, n))
+		}
+	}
+	return names
+}
+
+// inputChecksum hashes the relative path, size and mtime of every token file,
+// using the same walk as BuildTokenCache
+func inputChecksum(inputDir string) (string, int, error) {
+	h := sha256.New()
+	files := 0
+	err := filepath.Walk(inputDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || skipTokenFile(path) {
+			return nil
+		}
+		relPath, err := filepath.Rel(inputDir, path)
+		if err != nil {
+			relPath = path
+		}
+		fmt.Fprintf(h, "%s\t%d\t%d\n", relPath, info.Size(), info.ModTime().UnixNano())
+		files++
+		return nil
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), files, nil
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,190 @@
+package pkg
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Markdown code block handling
+const (
+	MarkdownCodeStrip = "strip" // drop fenced code blocks
+	MarkdownCodeTag   = "tag"   // keep code between "[code <lang>]" and "[/code]" lines
+	MarkdownCodeKeep  = "keep"  // keep code as plain text
+)
+
+var markdownCodeMode = MarkdownCodeStrip
+
+// SetMarkdownCodeMode selects what happens to fenced code blocks in .md files
+func SetMarkdownCodeMode(mode string) error {
+	if err := checkMarkdownCodeMode(mode); err != nil {
+		return err
+	}
+	markdownCodeMode = mode
+	return nil
+}
+
+func checkMarkdownCodeMode(mode string) error {
+	switch mode {
+	case MarkdownCodeStrip, MarkdownCodeTag, MarkdownCodeKeep:
+		return nil
+	}
+	return fmt.Errorf("unknown markdown code mode: %s (use 'strip', 'tag', or 'keep')", mode)
+}
+
+var (
+	mdATXHeading  = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	mdSetext      = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+	mdRule        = regexp.MustCompile(`^ {0,3}([-*_])[ \t]*(?:[-*_][ \t]*){2,}$`)
+	mdFence       = regexp.MustCompile("^ {0,3}(```+|~~~+)[ \\t]*([^ \\t`]*)")
+	mdRefDef      = regexp.MustCompile(`^ {0,3}\[[^\]]+\]:[ \t]*\S+`)
+	mdListMarker  = regexp.MustCompile(`^[ \t]*(?:[-*+]|\d+[.)])[ \t]+(?:\[[ xX]\][ \t]+)?`)
+	mdQuote       = regexp.MustCompile(`^[ \t]*(?:>[ \t]?)+`)
+	mdTableSep    = regexp.MustCompile(`^[ \t]*\|?[ \t]*:?-+:?[ \t]*(?:\|[ \t]*:?-+:?[ \t]*)*\|?[ \t]*$`)
+	mdImage       = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	mdLink        = regexp.MustCompile(`\[([^\]]*)\](?:\([^)]*\)|\[[^\]]*\])`)
+	mdAutolink    = regexp.MustCompile(`<(?:https?|ftp|mailto):[^>]*>`)
+	mdHTMLTag     = regexp.MustCompile(`</?[a-zA-Z][^>]*>`)
+	mdInlineCode  = regexp.MustCompile("`+([^`]*)`+")
+	mdEmphasis    = regexp.MustCompile(`(\*{1,3}|~~)([^*~]+?)(\*{1,3}|~~)`)
+	mdUnderscore  = regexp.MustCompile(`(^|\W)_{1,3}([^_]+?)_{1,3}(\W|$)`)
+	mdFrontMatter = regexp.MustCompile(`(?s)\A---[ \t]*\r?\n(.*?)\r?\n(?:---|\.\.\.)[ \t]*(?:\r?\n|\z)`)
+)
+
+// extractMarkdown returns the prose of a markdown document without syntax,
+// link targets or (by default) code blocks, and records its heading outline
+func extractMarkdown(src source) (*ExtractionResult, error) {
+	content, err := src.readAll()
+	if err != nil {
+		return nil, err
+	}
+	text, enc := decodeText(content)
+
+	res := &ExtractionResult{}
+	res.setMeta(MetaEncoding, enc)
+
+	// YAML front matter (Jekyll, Hugo, ...) supplies metadata, not text
+	if m := mdFrontMatter.FindStringSubmatchIndex(text); m != nil {
+		var front map[string]interface{}
+		if yaml.Unmarshal([]byte(text[m[2]:m[3]]), &front) == nil {
+			for key, metaKey := range map[string]string{
+				"title": MetaTitle, "author": MetaAuthor, "date": MetaCreated,
+				"description": MetaSubject, "lang": MetaLanguage,
+			} {
+				switch v := front[key].(type) {
+				case nil:
+				case time.Time:
+					res.setMeta(metaKey, v.UTC().Format(time.RFC3339))
+				default:
+					res.setMeta(metaKey, fmt.Sprint(v))
+				}
+			}
+		}
+		text = text[m[1]:]
+	}
+
+	var out strings.Builder
+	var headings []string
+	var fence string
+	var prev string
+
+	addHeading := func(level int, title string) {
+		title = markdownInline(title)
+		if title == "" {
+			return
+		}
+		headings = append(headings, strings.Repeat("#", level)+" "+title)
+		if level == 1 {
+			res.mergeMeta(map[string]string{MetaTitle: title})
+		}
+		out.WriteString(title)
+		out.WriteString("\n")
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		if fence != "" {
+			if strings.HasPrefix(strings.TrimSpace(line), fence) {
+				fence = ""
+				if src.cfg.markdownCode == MarkdownCodeTag {
+					out.WriteString("[/code]\n")
+				}
+			} else if src.cfg.markdownCode != MarkdownCodeStrip {
+				out.WriteString(line)
+				out.WriteString("\n")
+			}
+			prev = ""
+			continue
+		}
+
+		if m := mdFence.FindStringSubmatch(line); m != nil {
+			fence = m[1]
+			if src.cfg.markdownCode == MarkdownCodeTag {
+				out.WriteString(strings.TrimSpace("[code " + m[2]))
+				out.WriteString("]\n")
+			}
+			prev = ""
+			continue
+		}
+
+		switch {
+		case mdATXHeading.MatchString(line):
+			m := mdATXHeading.FindStringSubmatch(line)
+			addHeading(len(m[1]), m[2])
+			prev = ""
+			continue
+		case prev != "" && mdSetext.MatchString(line) && !mdListMarker.MatchString(prev):
+			// The previous line was a heading underlined with === or ---
+			level := 2
+			if strings.Contains(line, "=") {
+				level = 1
+			}
+			title := strings.TrimSpace(prev)
+			// Drop the copy already written as a paragraph line
+			written := out.String()
+			out.Reset()
+			out.WriteString(strings.TrimSuffix(written, markdownInline(title)+"\n"))
+			addHeading(level, title)
+			prev = ""
+			continue
+		case mdRule.MatchString(line), mdRefDef.MatchString(line), mdTableSep.MatchString(line):
+			prev = ""
+			continue
+		}
+
+		stripped := mdQuote.ReplaceAllString(line, "")
+		stripped = mdListMarker.ReplaceAllString(stripped, "")
+		if strings.Contains(stripped, "|") {
+			stripped = strings.Trim(strings.TrimSpace(stripped), "|")
+			stripped = strings.ReplaceAll(stripped, "|", " ")
+		}
+		stripped = markdownInline(stripped)
+
+		out.WriteString(stripped)
+		out.WriteString("\n")
+		prev = line
+		if strings.TrimSpace(line) == "" {
+			prev = ""
+		}
+	}
+
+	res.FullText = out.String()
+	res.Pages = []string{res.FullText}
+	res.setMeta(MetaHeadings, strings.Join(headings, "\n"))
+	return res, nil
+}
+
+// markdownInline removes inline markup from a line, keeping link and image text
+func markdownInline(s string) string {
+	s = mdInlineCode.ReplaceAllString(s, "$1")
+	s = mdImage.ReplaceAllString(s, "$1")
+	s = mdLink.ReplaceAllString(s, "$1")
+	s = mdAutolink.ReplaceAllString(s, "")
+	s = mdHTMLTag.ReplaceAllString(s, "")
+	s = mdEmphasis.ReplaceAllString(s, "$2")
+	// Underscores only mark emphasis at word boundaries, not in snake_case
+	s = mdUnderscore.ReplaceAllString(s, "$1$2$3")
+	return strings.TrimSpace(s)
+}
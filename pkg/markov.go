@@ -0,0 +1,174 @@
+package pkg
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MarkovModel predicts the next word of a text from the n-1 before it, by
+// the counts of the n-grams of a cache. Text it generates reads like the
+// corpus as far as the n-gram tables captured it.
+type MarkovModel struct {
+	N      int
+	Source string // the file the counts come from
+
+	words  []string
+	next   map[string][]markovNext // by the "id|id" key of n-1 words
+	starts []string                // the keys of next, for restarts
+	weight []int64                 // the cumulative counts of starts
+}
+
+type markovNext struct {
+	word  int
+	count int64
+}
+
+// MarkovSample is a text generated by a MarkovModel. Restarts counts the
+// times it reached n-1 words no n-gram continues and began again from a
+// random context; a model that restarts often captured little of the corpus.
+type MarkovSample struct {
+	Text     string
+	Words    int
+	Restarts int
+}
+
+// LoadMarkovModel reads the n-grams of size n of a cache from
+// {n}gramcounts.txt, or {n}gramfreq.txt without it, for a model of order
+// n-1. The whole table is held in memory.
+func LoadMarkovModel(cacheDir string, n int) (*MarkovModel, error) {
+	if n < 2 {
+		return nil, fmt.Errorf("n must be at least 2, got %d", n)
+	}
+	words, err := readLines(filepath.Join(cacheDir, "uniq.txt"))
+	if err != nil {
+		return nil, fmt.Errorf("could not read uniq.txt: %w", err)
+	}
+	var path string
+	for _, pattern := range []string{"%dgramcounts.txt", "%dgramfreq.txt"} {
+		if p := filepath.Join(cacheDir, fmt.Sprintf(pattern, n)); CacheFileExists(p) {
+			path = p
+			break
+		}
+	}
+	if path == "" {
+		return nil, fmt.Errorf("no %dgramfreq.txt in %s (run -cache ngramfreq -ngrams %d)", n, cacheDir, n)
+	}
+
+	m := &MarkovModel{N: n, Source: filepath.Base(path), words: words, next: make(map[string][]markovNext)}
+	err = scanFreqFile(path, func(key string, count int) {
+		cut := strings.LastIndex(key, "|")
+		if cut == -1 || count <= 0 {
+			return
+		}
+		w, err := strconv.Atoi(key[cut+1:])
+		if err != nil || w < 0 || w >= len(words) {
+			return
+		}
+		m.next[key[:cut]] = append(m.next[key[:cut]], markovNext{w, int64(count)})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %w", m.Source, err)
+	}
+	if len(m.next) == 0 {
+		return nil, fmt.Errorf("%s has no %d-grams", m.Source, n)
+	}
+
+	// The restart contexts in a fixed order, weighted by how often they
+	// occur, so a seed always gives the same text
+	var total int64
+	for key, next := range m.next {
+		sort.Slice(next, func(i, j int) bool { return next[i].word < next[j].word })
+		m.starts = append(m.starts, key)
+	}
+	sort.Strings(m.starts)
+	m.weight = make([]int64, len(m.starts))
+	for i, key := range m.starts {
+		for _, nx := range m.next[key] {
+			total += nx.count
+		}
+		m.weight[i] = total
+	}
+	return m, nil
+}
+
+// Generate writes a text of up to length words. It continues prompt when the
+// model knows its last n-1 words and otherwise starts from a random context.
+// temperature flattens the choice of each next word (above 1) or sharpens it
+// toward the most frequent (below 1): a word is picked with a weight of its
+// count to the power 1/temperature.
+func (m *MarkovModel) Generate(rng *rand.Rand, prompt []string, length int, temperature float64) MarkovSample {
+	var sample MarkovSample
+	var text []int
+	ids := make(map[string]int, len(prompt))
+	for _, w := range prompt {
+		if _, ok := ids[w]; !ok {
+			ids[w] = -1
+		}
+	}
+	for i, w := range m.words {
+		if _, ok := ids[w]; ok {
+			ids[w] = i
+		}
+	}
+	for _, w := range prompt {
+		if id := ids[w]; id >= 0 {
+			text = append(text, id)
+		}
+	}
+
+	context := func() string {
+		if len(text) < m.N-1 {
+			return ""
+		}
+		parts := make([]string, m.N-1)
+		for i, id := range text[len(text)-(m.N-1):] {
+			parts[i] = strconv.Itoa(id)
+		}
+		return strings.Join(parts, "|")
+	}
+	restart := func() {
+		pick := rng.Int63n(m.weight[len(m.weight)-1])
+		key := m.starts[sort.Search(len(m.weight), func(i int) bool { return m.weight[i] > pick })]
+		for _, p := range strings.Split(key, "|") {
+			id, _ := strconv.Atoi(p)
+			text = append(text, id)
+		}
+	}
+
+	if _, ok := m.next[context()]; !ok {
+		restart()
+	}
+	var weights []float64
+	for len(text) < length {
+		next, ok := m.next[context()]
+		if !ok {
+			sample.Restarts++
+			restart()
+			continue
+		}
+		weights = weights[:0]
+		var sum float64
+		for _, nx := range next {
+			w := math.Pow(float64(nx.count), 1/temperature)
+			sum += w
+			weights = append(weights, sum)
+		}
+		pick := rng.Float64() * sum
+		i := sort.SearchFloat64s(weights, pick)
+		text = append(text, next[min(i, len(next)-1)].word)
+	}
+
+	text = text[:min(len(text), max(length, len(prompt)))]
+	parts := make([]string, len(text))
+	for i, id := range text {
+		parts[i] = m.words[id]
+	}
+	sample.Text = strings.Join(parts, " ")
+	sample.Words = len(parts)
+	return sample
+}
@@ -0,0 +1,506 @@
+package pkg
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/RoaringBitmap/roaring/v2"
+)
+
+// mergeSource is one of the caches being merged
+type mergeSource struct {
+	cacheRemap
+	label    string
+	words    []string
+	files    []string
+	manifest *Manifest // nil for caches built before manifests existed
+}
+
+// usable reports whether the source has a current build of step. has says
+// whether its files are there, which is all caches without a manifest go by.
+func (s *mergeSource) usable(step string, has bool) bool {
+	if !has {
+		return false
+	}
+	if s.manifest == nil {
+		return true
+	}
+	if err := s.manifest.checkStep(s.dir, step, false); err != nil {
+		logger.Warn("Not merging", "step", step, "dir", s.dir, "error", err)
+		return false
+	}
+	return true
+}
+
+// MergeCaches combines caches built from different token directories into a
+// new cache in outputDir. The vocabularies are unioned and sorted, and the
+// files of each cache are appended in argument order, prefixed with the name
+// of its cache directory. Every artifact that all caches have is merged under
+// the new word and file numbers: the word index, positions, ID streams,
+// n-gram indexes, reverse files and frequencies, skip-grams, and term and
+// corpus statistics.
+//
+// Frequencies are summed, so an n-gram that -min-count pruned from one cache
+// only counts its occurrences in the others. The merged cache has no input
+// directory, so steps that read token files cannot be re-run on it. A merge
+// stopped through ctx removes the directory it created.
+func MergeCaches(ctx context.Context, outputDir string, cacheDirs []string) (err error) {
+	if len(cacheDirs) < 2 {
+		return fmt.Errorf("need at least two caches to merge")
+	}
+	if fileExists(filepath.Join(outputDir, "uniq.txt")) {
+		return fmt.Errorf("%s already holds a cache; merge into a new directory", outputDir)
+	}
+
+	logger.Info("Merging caches", "caches", len(cacheDirs))
+	sources, err := loadMergeSources(cacheDirs)
+	if err != nil {
+		return err
+	}
+	logger.Info("Output", "dir", outputDir)
+
+	// Sorted union of the vocabularies
+	wordIdx := make(map[string]int)
+	for _, src := range sources {
+		for _, word := range src.words {
+			wordIdx[word] = 0
+		}
+	}
+	words := make([]string, 0, len(wordIdx))
+	for word := range wordIdx {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	for i, word := range words {
+		wordIdx[word] = i
+	}
+
+	// Files keep their order, one cache after the other
+	var files []string
+	for _, src := range sources {
+		src.wordMap = make([]int, len(src.words))
+		for i, word := range src.words {
+			src.wordMap[i] = wordIdx[word]
+		}
+		src.fileMap = make([]int, len(src.files))
+		for i, relPath := range src.files {
+			src.fileMap[i] = len(files)
+			files = append(files, filepath.Join(src.label, relPath))
+		}
+		logger.Info("Source", "dir", src.dir, "files", len(src.files), "words", len(src.words))
+	}
+	wordIdx = nil
+	logger.Info("Merged", "files", len(files), "words", len(words))
+
+	created := !fileExists(outputDir)
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return err
+	}
+	defer func() {
+		if created && err != nil && ctx.Err() != nil {
+			os.RemoveAll(outputDir)
+		}
+	}()
+	// Without an input= line the token-reading builders refuse the cache;
+	// the source= lines record where it came from
+	var settings strings.Builder
+	for _, src := range sources {
+		abs, err := filepath.Abs(src.dir)
+		if err != nil {
+			abs = src.dir
+		}
+		fmt.Fprintf(&settings, "source=%s\n", abs)
+	}
+	if err := writeFileAtomic(filepath.Join(outputDir, "settings.txt"), []byte(settings.String())); err != nil {
+		return fmt.Errorf("could not write settings: %w", err)
+	}
+	if err := beginStep(outputDir, StepTokens); err != nil {
+		return err
+	}
+	if err := writeLines(filepath.Join(outputDir, "uniq.txt"), words); err != nil {
+		return err
+	}
+	if err := writeLines(filepath.Join(outputDir, "files.txt"), files); err != nil {
+		return err
+	}
+
+	// merged records the steps whose output is complete, with their n
+	merged := make(map[string]int)
+	all := func(step string, has func(src *mergeSource) bool) bool {
+		for _, src := range sources {
+			if !src.usable(step, has(src)) {
+				return false
+			}
+		}
+		return true
+	}
+	remaps := make([]cacheRemap, len(sources))
+	for i, src := range sources {
+		remaps[i] = src.cacheRemap
+	}
+
+	var postings []*roaring.Bitmap
+	if all(StepIndex, func(src *mergeSource) bool { return CacheFileExists(filepath.Join(src.dir, "fileuniqindex.txt")) }) {
+		logger.Info("Merging word index")
+		if postings, err = mergeWordIndex(outputDir, sources, len(words)); err != nil {
+			return err
+		}
+		merged[StepIndex] = 0
+		if all(StepIndex, func(src *mergeSource) bool { return fileExists(filepath.Join(src.dir, PositionsName)) }) {
+			logger.Info("Merging positions")
+			if err := writeRemappedPositions(filepath.Join(outputDir, PositionsName), len(files), remaps); err != nil {
+				return err
+			}
+		}
+	}
+	if all(StepDocs, func(src *mergeSource) bool { return hasDocs(src.dir) }) {
+		logger.Info("Merging ID streams")
+		docsDir := filepath.Join(outputDir, docsDirName)
+		if err := os.MkdirAll(docsDir, 0755); err != nil {
+			return err
+		}
+		for _, r := range remaps {
+			if err := remapDocs(r, docsDir); err != nil {
+				return err
+			}
+		}
+		merged[StepDocs] = 0
+	}
+
+	maxN := 0
+	for i, src := range sources {
+		srcMaxN := 1
+		for n := 2; hasNgramArtifacts(src.dir, n); n++ {
+			srcMaxN = n
+		}
+		if i == 0 || srcMaxN < maxN {
+			maxN = srcMaxN
+		}
+	}
+	if err := mergeNgrams(ctx, outputDir, sources, maxN, len(files), merged, all); err != nil {
+		return err
+	}
+
+	if all(StepTFIDF, func(src *mergeSource) bool { return CacheFileExists(filepath.Join(src.dir, TFIDFName)) }) {
+		logger.Info("Merging term statistics")
+		if err := mergeTermStats(outputDir, sources, len(words), len(files)); err != nil {
+			return err
+		}
+		merged[StepTFIDF] = 0
+	}
+	if postings != nil && all(StepStats, func(src *mergeSource) bool { return fileExists(filepath.Join(src.dir, StatsName)) }) {
+		logger.Info("Merging corpus statistics")
+		tokens := make([]int, len(files))
+		rows := make([]string, len(files))
+		for i := range rows {
+			rows[i] = fmt.Sprintf("%d,0,0", i)
+		}
+		for _, src := range sources {
+			if err := remapStats(rows, tokens, src.dir, src.fileMap); err != nil {
+				return fmt.Errorf("%s: %w", src.dir, err)
+			}
+		}
+		if err := writeRemappedStats(outputDir, rows, tokens, postings); err != nil {
+			return err
+		}
+		merged[StepStats] = 0
+	}
+
+	if err := recordRewrittenSteps(outputDir, merged, maxN); err != nil {
+		return err
+	}
+	logger.Info("Done! Caches merged", "dir", outputDir)
+	return nil
+}
+
+// loadMergeSources reads the file lists and vocabularies of the caches and
+// labels each with its directory name, numbered if two share one
+func loadMergeSources(cacheDirs []string) ([]*mergeSource, error) {
+	var sources []*mergeSource
+	labels := make(map[string]bool)
+	for _, dir := range cacheDirs {
+		src := &mergeSource{cacheRemap: cacheRemap{dir: dir}}
+		var err error
+		if src.words, err = readLines(filepath.Join(dir, "uniq.txt")); err != nil {
+			return nil, fmt.Errorf("%s: could not read uniq.txt (run -cache tokens first): %w", dir, err)
+		}
+		if src.files, err = readLines(filepath.Join(dir, "files.txt")); err != nil {
+			return nil, fmt.Errorf("%s: could not read files.txt (run -cache tokens first): %w", dir, err)
+		}
+		if m, err := LoadManifest(dir); err == nil {
+			if err := m.checkStep(dir, StepTokens, false); err != nil {
+				return nil, fmt.Errorf("%s: %w", dir, err)
+			}
+			src.manifest = m
+		}
+
+		base := filepath.Base(filepath.Clean(dir))
+		src.label = base
+		for i := 2; labels[src.label]; i++ {
+			src.label = fmt.Sprintf("%s-%d", base, i)
+		}
+		labels[src.label] = true
+		sources = append(sources, src)
+	}
+	return sources, nil
+}
+
+// mergeWordIndex writes the union of the word indexes and returns it
+func mergeWordIndex(outputDir string, sources []*mergeSource, wordCount int) ([]*roaring.Bitmap, error) {
+	postings := make([]*roaring.Bitmap, wordCount)
+	for i := range postings {
+		postings[i] = roaring.New()
+	}
+	for _, src := range sources {
+		err := scanIndexFile(filepath.Join(src.dir, "fileuniqindex.txt"), func(wIdx int, set *roaring.Bitmap) {
+			if wIdx < len(src.wordMap) {
+				postings[src.wordMap[wIdx]].Or(remapFiles(set, src.fileMap))
+			}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: could not read fileuniqindex.txt: %w", src.dir, err)
+		}
+	}
+	return postings, writeIndexFile(filepath.Join(outputDir, "fileuniqindex.txt"), postings)
+}
+
+// mergeNgrams merges the per-n artifacts for n = 2..maxN. A step is recorded
+// in merged if some of its files were merged and none that a source has was
+// left out.
+func mergeNgrams(ctx context.Context, outputDir string, sources []*mergeSource, maxN, fileCount int, merged map[string]int,
+	all func(step string, has func(src *mergeSource) bool) bool) error {
+	if maxN < 2 {
+		return nil
+	}
+	runDir := filepath.Join(outputDir, ".merge-runs")
+	defer os.RemoveAll(runDir)
+
+	wrote := make(map[string]bool)
+	missed := make(map[string]bool)
+	try := func(step string, has func(src *mergeSource) bool, write func() error) error {
+		if all(step, has) {
+			wrote[step] = true
+			return write()
+		}
+		for _, src := range sources {
+			if has(src) {
+				missed[step] = true
+			}
+		}
+		return nil
+	}
+
+	for n := 2; n <= maxN; n++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		logger.Info("Merging n-grams", "n", n)
+		var ngramMaps [][]int
+		err := try(StepNgrams, func(src *mergeSource) bool { return len(NgramIndexParts(src.dir, n)) > 0 }, func() error {
+			var err error
+			if ngramMaps, err = unionNgramIndex(outputDir, n, sources); err != nil {
+				return fmt.Errorf("could not merge the %d-gram index: %w", n, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		name := fmt.Sprintf("%dgramfiles.txt", n)
+		err = try(StepNgramFiles, func(src *mergeSource) bool {
+			return ngramMaps != nil && CacheFileExists(filepath.Join(src.dir, name))
+		}, func() error {
+			byFile := make([]*roaring.Bitmap, fileCount)
+			for i := range byFile {
+				byFile[i] = roaring.New()
+			}
+			for i, src := range sources {
+				if err := remapNgramFiles(byFile, filepath.Join(src.dir, name), src.fileMap, ngramMaps[i]); err != nil {
+					return fmt.Errorf("%s: could not read %s: %w", src.dir, name, err)
+				}
+			}
+			return writeNgramFiles(filepath.Join(outputDir, name), byFile)
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, c := range []struct{ step, pattern string }{
+			{StepNgramFreq, "%dgramfreq.txt"},
+			{StepSkipgrams, "%dskipgramfreq.txt"},
+		} {
+			name := fmt.Sprintf(c.pattern, n)
+			err := try(c.step, func(src *mergeSource) bool { return CacheFileExists(filepath.Join(src.dir, name)) }, func() error {
+				if err := os.MkdirAll(runDir, 0755); err != nil {
+					return err
+				}
+				if err := mergeCounts(runDir, filepath.Join(outputDir, name), sources, name); err != nil {
+					return fmt.Errorf("could not merge %s: %w", name, err)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for step := range wrote {
+		if !missed[step] {
+			merged[step] = maxN
+		}
+	}
+	return nil
+}
+
+// unionNgramIndex writes the union of the n-gram indexes of n, numbering the
+// n-grams of the first cache first, then the new ones of each following
+// cache. It returns, per source, the new number of every old one.
+func unionNgramIndex(outputDir string, n int, sources []*mergeSource) ([][]int, error) {
+	type entry struct {
+		idx   int
+		key   string
+		files *roaring.Bitmap
+	}
+	var kept []entry
+	keyIdx := make(map[string]int)
+	ngramMaps := make([][]int, len(sources))
+	for i, src := range sources {
+		var entries []entry
+		maxIdx := -1
+		err := scanNgramIndex(src.dir, n, func(idx int, key string, files *roaring.Bitmap) {
+			entries = append(entries, entry{idx, key, files})
+			maxIdx = max(maxIdx, idx)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", src.dir, err)
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].idx < entries[j].idx })
+
+		ngramMap := make([]int, maxIdx+1)
+		for j := range ngramMap {
+			ngramMap[j] = -1
+		}
+		for _, e := range entries {
+			key, ok := remapNgramKey(e.key, src.wordMap)
+			if !ok {
+				return nil, fmt.Errorf("%s: %d-gram %s has a word that is not in uniq.txt", src.dir, n, e.key)
+			}
+			files := remapFiles(e.files, src.fileMap)
+			if j, ok := keyIdx[key]; ok {
+				kept[j].files.Or(files)
+				ngramMap[e.idx] = j
+				continue
+			}
+			keyIdx[key] = len(kept)
+			ngramMap[e.idx] = len(kept)
+			kept = append(kept, entry{len(kept), key, files})
+		}
+		ngramMaps[i] = ngramMap
+	}
+	keyIdx = nil
+
+	keys := make([]string, len(kept))
+	for i, e := range kept {
+		keys[i] = e.key
+	}
+	w, err := createNgramIndex(outputDir, n, ngramShardCounts(keys, shardCount()))
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range kept {
+		if err := w.add(e.key, e.files); err != nil {
+			w.abort()
+			return nil, err
+		}
+	}
+	logger.Info("Index", "n", n, "ngrams", len(kept))
+	return ngramMaps, w.close()
+}
+
+// mergeCounts sums the "key,count" file name of every source into a
+// frequency file at outPath, spilling sorted runs to runDir past the RAM limit
+func mergeCounts(runDir, outPath string, sources []*mergeSource, name string) error {
+	counts := make(map[string]int)
+	var runs []string
+	spill := func() error {
+		path, err := spillCounts(runDir, counts, len(runs))
+		if err != nil {
+			return err
+		}
+		runs = append(runs, path)
+		counts = make(map[string]int)
+		return nil
+	}
+	for _, src := range sources {
+		f, err := OpenCacheFile(filepath.Join(src.dir, name))
+		if err != nil {
+			return err
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+		for scanner.Scan() {
+			line := scanner.Text()
+			comma := strings.LastIndex(line, ",")
+			if comma == -1 {
+				continue
+			}
+			count, err := strconv.Atoi(line[comma+1:])
+			if err != nil {
+				continue
+			}
+			key, ok := remapNgramKey(line[:comma], src.wordMap)
+			if !ok {
+				f.Close()
+				return fmt.Errorf("%s: %s has a word that is not in uniq.txt", src.dir, name)
+			}
+			if _, seen := counts[key]; !seen && len(counts)%spillCheckInterval == 0 && memoryExceeded() {
+				if err := spill(); err != nil {
+					f.Close()
+					return err
+				}
+			}
+			counts[key] += count
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("%s: could not read %s: %w", src.dir, name, err)
+		}
+	}
+	if err := spill(); err != nil {
+		return err
+	}
+	_, kept, err := externalFreq(runDir, runs, 1, outPath)
+	if err != nil {
+		return err
+	}
+	logger.Info("Written", "file", name, "ngrams", kept)
+	return nil
+}
+
+// mergeTermStats sums the document and term frequencies of every word and
+// recomputes the weights over the merged file count
+func mergeTermStats(outputDir string, sources []*mergeSource, wordCount, fileCount int) error {
+	df := make([]int64, wordCount)
+	tf := make([]int64, wordCount)
+	for _, src := range sources {
+		stats, err := LoadTermStats(src.dir)
+		if err != nil {
+			return fmt.Errorf("%s: %w", src.dir, err)
+		}
+		for _, s := range stats {
+			if s.Word < 0 || s.Word >= len(src.wordMap) {
+				return fmt.Errorf("%s: %s has word %d, which is not in uniq.txt", src.dir, TFIDFName, s.Word)
+			}
+			df[src.wordMap[s.Word]] += int64(s.DF)
+			tf[src.wordMap[s.Word]] += s.TF
+		}
+	}
+	return writeTermStats(filepath.Join(outputDir, TFIDFName), df, tf, fileCount)
+}
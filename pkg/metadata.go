@@ -0,0 +1,211 @@
+package pkg
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Metadata keys used across extractors. Extractors only set the keys their
+// format actually records; values are strings, dates are RFC 3339.
+const (
+	MetaTitle    = "title"
+	MetaAuthor   = "author"
+	MetaSubject  = "subject"
+	MetaCreated  = "created"
+	MetaModified = "modified"
+	MetaPages    = "pages"
+	MetaSheets   = "sheets"
+	MetaLanguage = "language"
+	MetaProducer = "producer"
+	MetaEncoding = "encoding" // source encoding of plain-text formats
+	MetaHeadings = "headings" // markdown outline, one "## Heading" line per heading
+)
+
+// setMeta stores a trimmed, non-empty metadata value, creating the map if needed
+func (res *ExtractionResult) setMeta(key, value string) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return
+	}
+	if res.Metadata == nil {
+		res.Metadata = make(map[string]string)
+	}
+	res.Metadata[key] = value
+}
+
+// mergeMeta copies values from m without overwriting keys that are already set
+func (res *ExtractionResult) mergeMeta(m map[string]string) {
+	for k, v := range m {
+		if _, ok := res.Metadata[k]; !ok {
+			res.setMeta(k, v)
+		}
+	}
+}
+
+// MetadataSidecar is the content of the .meta.json file written next to each output
+type MetadataSidecar struct {
+	Source   string            `json:"source"`
+	Size     int64             `json:"size,omitempty"`
+	Modified string            `json:"modified,omitempty"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+// writeMetadataSidecar writes outBase.meta.json; info may be nil for archive members
+func writeMetadataSidecar(res *ExtractionResult, label string, info os.FileInfo, outBase string) error {
+	sidecar := MetadataSidecar{Source: label, Metadata: res.Metadata}
+	if sidecar.Metadata == nil {
+		sidecar.Metadata = map[string]string{}
+	}
+	if info != nil {
+		sidecar.Size = info.Size()
+		sidecar.Modified = info.ModTime().UTC().Format(time.RFC3339)
+	}
+	data, err := json.MarshalIndent(sidecar, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(outBase+".meta.json", data)
+}
+
+// ooxmlCoreProps is docProps/core.xml shared by .docx, .xlsx and .pptx
+type ooxmlCoreProps struct {
+	Title    string `xml:"title"`
+	Subject  string `xml:"subject"`
+	Creator  string `xml:"creator"`
+	Language string `xml:"language"`
+	Created  string `xml:"created"`
+	Modified string `xml:"modified"`
+}
+
+// readOOXMLMetadata returns the core properties of an Office Open XML package
+func readOOXMLMetadata(src source) map[string]string {
+	r, err := zip.NewReader(src.r, src.size)
+	if err != nil {
+		return nil
+	}
+	for _, f := range r.File {
+		if f.Name != "docProps/core.xml" {
+			continue
+		}
+		var props ooxmlCoreProps
+		if err := decodeZipXML(f, &props); err != nil {
+			return nil
+		}
+		return map[string]string{
+			MetaTitle:    props.Title,
+			MetaSubject:  props.Subject,
+			MetaAuthor:   props.Creator,
+			MetaLanguage: props.Language,
+			MetaCreated:  props.Created,
+			MetaModified: props.Modified,
+		}
+	}
+	return nil
+}
+
+// parsePDFDate converts "D:20230115093000+01'00'" to RFC 3339, returning the
+// input unchanged if it cannot be parsed
+func parsePDFDate(s string) string {
+	raw := strings.TrimPrefix(strings.TrimSpace(s), "D:")
+	raw = strings.ReplaceAll(raw, "'", "")
+	for _, layout := range []string{"20060102150405-0700", "20060102150405Z0700", "20060102150405Z", "20060102150405", "20060102"} {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return t.UTC().Format(time.RFC3339)
+		}
+	}
+	return s
+}
+
+// readOLESummary parses the \x05SummaryInformation property set of an OLE2
+// compound file (.doc, .xls) for title, author and dates
+func readOLESummary(src source) map[string]string {
+	streams, err := readOLEStreams(src, "SummaryInformation")
+	if err != nil {
+		return nil
+	}
+	data := streams["SummaryInformation"]
+	// Header (28 bytes) + first FMTID (16) + section offset (4)
+	if len(data) < 48 {
+		return nil
+	}
+	section := int(binary.LittleEndian.Uint32(data[44:]))
+	if section+8 > len(data) {
+		return nil
+	}
+	count := int(binary.LittleEndian.Uint32(data[section+4:]))
+
+	names := map[uint32]string{
+		2: MetaTitle, 3: MetaSubject, 4: MetaAuthor,
+		12: MetaCreated, 13: MetaModified, 14: MetaPages,
+	}
+	meta := make(map[string]string)
+	for i := 0; i < count; i++ {
+		entry := section + 8 + i*8
+		if entry+8 > len(data) {
+			break
+		}
+		key, ok := names[binary.LittleEndian.Uint32(data[entry:])]
+		if !ok {
+			continue
+		}
+		at := section + int(binary.LittleEndian.Uint32(data[entry+4:]))
+		if value, ok := olePropertyValue(data, at); ok {
+			meta[key] = value
+		}
+	}
+	return meta
+}
+
+// olePropertyValue decodes the typed property value at offset at
+func olePropertyValue(data []byte, at int) (string, bool) {
+	if at+8 > len(data) {
+		return "", false
+	}
+	vt := binary.LittleEndian.Uint32(data[at:])
+	body := data[at+4:]
+
+	switch vt {
+	case 0x03: // VT_I4
+		return strconv.Itoa(int(int32(binary.LittleEndian.Uint32(body)))), true
+	case 0x1E: // VT_LPSTR (assume Windows-1252)
+		n := int(binary.LittleEndian.Uint32(body))
+		if n > len(body)-4 {
+			return "", false
+		}
+		decoded, err := charmap.Windows1252.NewDecoder().Bytes(body[4 : 4+n])
+		if err != nil {
+			return "", false
+		}
+		return strings.TrimRight(string(decoded), "\x00"), true
+	case 0x1F: // VT_LPWSTR
+		n := int(binary.LittleEndian.Uint32(body))
+		if n*2 > len(body)-4 {
+			return "", false
+		}
+		units := make([]uint16, n)
+		for i := range units {
+			units[i] = binary.LittleEndian.Uint16(body[4+i*2:])
+		}
+		return strings.TrimRight(string(utf16.Decode(units)), "\x00"), true
+	case 0x40: // VT_FILETIME: 100ns intervals since 1601-01-01
+		if len(body) < 8 {
+			return "", false
+		}
+		ticks := int64(binary.LittleEndian.Uint64(body))
+		if ticks == 0 {
+			return "", false
+		}
+		const epochDiff = 116444736000000000
+		t := time.Unix(0, (ticks-epochDiff)*100).UTC()
+		return t.Format(time.RFC3339), true
+	}
+	return "", false
+}
@@ -0,0 +1,124 @@
+package pkg
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// NgramFilter selects the n-grams an NgramIterator yields
+type NgramFilter func(Ngram) bool
+
+// NgramMinCount selects the n-grams occurring at least count times
+func NgramMinCount(count int) NgramFilter {
+	return func(ng Ngram) bool { return ng.Count >= count }
+}
+
+// NgramHasWord selects the n-grams containing the word of index id
+func NgramHasWord(id int) NgramFilter {
+	return func(ng Ngram) bool { return slices.Contains(ng.IDs, id) }
+}
+
+// NgramIterator reads the n-grams of an {n}gramfreq.txt one line at a time,
+// most frequent first, keeping none of them:
+//
+//	it, err := cache.NgramIterator(3, pkg.NgramMinCount(10))
+//	if err != nil { ... }
+//	defer it.Close()
+//	for it.Next() {
+//		ng := it.Ngram()
+//		...
+//	}
+//	if err := it.Err(); err != nil { ... }
+//
+// Stopping early is calling Close before Next returns false.
+type NgramIterator struct {
+	f       io.Closer
+	scanner *bufio.Scanner
+	words   []string // fills Ngram.Words; nil leaves it empty
+	filters []NgramFilter
+	ng      Ngram
+	err     error
+}
+
+// NgramIterator iterates over the n-grams of {n}gramfreq.txt passing every
+// filter, with their words
+func (c *Cache) NgramIterator(n int, filters ...NgramFilter) (*NgramIterator, error) {
+	words, err := c.WordIndex()
+	if err != nil {
+		return nil, err
+	}
+	it, err := OpenNgramIterator(c.dir, n, filters...)
+	if err != nil {
+		return nil, err
+	}
+	it.words = words
+	return it, nil
+}
+
+// OpenNgramIterator iterates over the n-grams of {n}gramfreq.txt in cacheDir
+// passing every filter. It does not read the vocabulary, so the n-grams have
+// IDs and Count but no Words, for a caller that keeps its own vocabulary.
+func OpenNgramIterator(cacheDir string, n int, filters ...NgramFilter) (*NgramIterator, error) {
+	path := filepath.Join(cacheDir, fmt.Sprintf("%dgramfreq.txt", n))
+	if !CacheFileExists(path) {
+		return nil, fmt.Errorf("no %dgramfreq.txt in %s (run -cache ngramfreq -ngrams %d)", n, cacheDir, n)
+	}
+	f, err := OpenCacheFile(path)
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	return &NgramIterator{f: f, scanner: scanner, filters: filters}, nil
+}
+
+// Next moves to the next n-gram passing the filters, returning false at the
+// end of the file or on an error
+func (it *NgramIterator) Next() bool {
+	if it.scanner == nil {
+		return false
+	}
+next:
+	for it.scanner.Scan() {
+		line := it.scanner.Text()
+		comma := strings.LastIndex(line, ",")
+		if comma == -1 {
+			continue
+		}
+		count, err := strconv.Atoi(line[comma+1:])
+		if err != nil {
+			continue
+		}
+		it.ng = parseNgram(line[:comma], count, it.words)
+		for _, keep := range it.filters {
+			if !keep(it.ng) {
+				continue next
+			}
+		}
+		return true
+	}
+	it.err = it.scanner.Err()
+	it.scanner = nil
+	return false
+}
+
+// Ngram returns the n-gram Next moved to
+func (it *NgramIterator) Ngram() Ngram {
+	return it.ng
+}
+
+// Err returns the error that ended the iteration, if any
+func (it *NgramIterator) Err() error {
+	return it.err
+}
+
+// Close closes the file; the iterator yields nothing more
+func (it *NgramIterator) Close() error {
+	it.scanner = nil
+	return it.f.Close()
+}
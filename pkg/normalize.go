@@ -0,0 +1,169 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// StepNormalize is the cache step that maps the vocabulary to normalized
+// forms, so queries can match "Invoice", "invoice" and "INVOICE" alike
+const StepNormalize = "normalize"
+
+// NormVocabName holds the normalization used on its first line, "# fold,nfkc"
+// and then one line per entry of uniq.txt, in vocabulary order: the word's
+// normalized form
+const NormVocabName = "normuniq.txt"
+
+// Normalization is how words are made comparable across variants. Fold
+// case-folds them, NFKC applies Unicode compatibility normalization (so
+// "ﬁle" is "file" and full-width digits are digits), and Accents strips
+// combining marks ("café" becomes "cafe").
+type Normalization struct {
+	Fold    bool
+	NFKC    bool
+	Accents bool
+}
+
+// normalization is used by BuildNormalizedVocab
+var normalization = Normalization{Fold: true}
+
+// ParseNormalization reads a comma-separated list of "fold", "nfkc" and
+// "accents"; "none" or "" is no normalization
+func ParseNormalization(spec string) (Normalization, error) {
+	var n Normalization
+	for _, part := range strings.Split(spec, ",") {
+		switch strings.ToLower(strings.TrimSpace(part)) {
+		case "", "none":
+		case "fold":
+			n.Fold = true
+		case "nfkc":
+			n.NFKC = true
+		case "accents":
+			n.Accents = true
+		default:
+			return n, fmt.Errorf("unknown normalization %q (use fold, nfkc and/or accents)", part)
+		}
+	}
+	return n, nil
+}
+
+// SetNormalization sets the normalization -cache normalize applies (default
+// "fold"), see ParseNormalization
+func SetNormalization(spec string) error {
+	n, err := ParseNormalization(spec)
+	if err != nil {
+		return err
+	}
+	normalization = n
+	return nil
+}
+
+func (n Normalization) String() string {
+	var parts []string
+	if n.Fold {
+		parts = append(parts, "fold")
+	}
+	if n.NFKC {
+		parts = append(parts, "nfkc")
+	}
+	if n.Accents {
+		parts = append(parts, "accents")
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, ",")
+}
+
+// Apply returns the normalized form of word. NFKC comes first, as it can
+// turn one character into letters with accents or case.
+func (n Normalization) Apply(word string) string {
+	if n.NFKC {
+		word = norm.NFKC.String(word)
+	}
+	if n.Accents {
+		// The transformers keep state, so each call makes its own
+		t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+		if s, _, err := transform.String(t, word); err == nil {
+			word = s
+		}
+	}
+	if n.Fold {
+		word = cases.Fold().String(word)
+	}
+	return word
+}
+
+// BuildNormalizedVocab writes normuniq.txt, the normalized form of every
+// word of uniq.txt under the normalization set by SetNormalization
+func BuildNormalizedVocab(ctx context.Context, outputDir string) error {
+	return buildNormalizedVocab(outputDir, normalization)
+}
+
+func buildNormalizedVocab(outputDir string, n Normalization) error {
+	logger.Info("Building normalized vocabulary", "dir", outputDir, "normalize", n.String())
+	reporter.OnStage(StepNormalize)
+
+	if err := beginStep(outputDir, StepNormalize); err != nil {
+		return err
+	}
+	words, err := readLines(filepath.Join(outputDir, "uniq.txt"))
+	if err != nil {
+		return fmt.Errorf("could not read uniq.txt (run -cache tokens first): %w", err)
+	}
+
+	lines := make([]string, 0, len(words)+1)
+	lines = append(lines, "# "+n.String())
+	forms := make(map[string]bool)
+	for _, w := range words {
+		form := n.Apply(w)
+		lines = append(lines, form)
+		forms[form] = true
+	}
+	path := filepath.Join(outputDir, NormVocabName)
+	if err := writeLines(path, lines); err != nil {
+		return err
+	}
+	logger.Info("Written", "path", path, "words", len(words), "forms", len(forms))
+
+	logger.Info("Done")
+	return finishStep(outputDir, StepNormalize, 0, NormVocabName)
+}
+
+// rebuildNormalizedVocab rewrites normuniq.txt, if the cache has one, with
+// the normalization it was built with, after uniq.txt changed
+func rebuildNormalizedVocab(outputDir string) error {
+	if !CacheFileExists(filepath.Join(outputDir, NormVocabName)) {
+		return nil
+	}
+	n, _, err := LoadNormalizedVocab(outputDir)
+	if err != nil {
+		return err
+	}
+	return buildNormalizedVocab(outputDir, n)
+}
+
+// LoadNormalizedVocab reads normuniq.txt: the normalization it was built
+// with and the normalized form of each word of uniq.txt
+func LoadNormalizedVocab(cacheDir string) (Normalization, []string, error) {
+	lines, err := readLines(filepath.Join(cacheDir, NormVocabName))
+	if err != nil {
+		return Normalization{}, nil, err
+	}
+	if len(lines) == 0 || !strings.HasPrefix(lines[0], "# ") {
+		return Normalization{}, nil, fmt.Errorf("%s has no normalization header (re-run: %s)", NormVocabName, stepCommand(StepNormalize))
+	}
+	n, err := ParseNormalization(strings.TrimPrefix(lines[0], "# "))
+	if err != nil {
+		return Normalization{}, nil, err
+	}
+	return n, lines[1:], nil
+}
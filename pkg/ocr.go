@@ -0,0 +1,140 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// OCRBackend recognizes text in images and in rasterized PDF pages
+type OCRBackend interface {
+	// RecognizeImage returns the text found in an image file (.png, .jpg, .tiff, ...)
+	RecognizeImage(path string) (string, error)
+	// RecognizePDFPage returns the text found on a single 1-based page of a PDF
+	RecognizePDFPage(path string, page int) (string, error)
+}
+
+// ocrBackend is used for image inputs and image-only PDF pages; nil disables
+// OCR. Extractions running on other goroutines read it, so it is guarded.
+var (
+	ocrBackend   OCRBackend
+	ocrBackendMu sync.RWMutex
+)
+
+// SetOCRBackend enables OCR with the given backend (pass nil to disable it)
+func SetOCRBackend(b OCRBackend) {
+	ocrBackendMu.Lock()
+	defer ocrBackendMu.Unlock()
+	ocrBackend = b
+}
+
+// currentOCRBackend returns the backend of SetOCRBackend
+func currentOCRBackend() OCRBackend {
+	ocrBackendMu.RLock()
+	defer ocrBackendMu.RUnlock()
+	return ocrBackend
+}
+
+// TesseractOCR implements OCRBackend using the tesseract CLI.
+// PDF pages are rasterized with pdftoppm (poppler-utils) first.
+type TesseractOCR struct {
+	TesseractPath string
+	PdftoppmPath  string
+	Language      string
+	DPI           int
+}
+
+// NewTesseractOCR locates the tesseract and pdftoppm binaries on PATH
+func NewTesseractOCR(language string) (*TesseractOCR, error) {
+	tesseract, err := exec.LookPath("tesseract")
+	if err != nil {
+		return nil, fmt.Errorf("tesseract not found in PATH: %w", err)
+	}
+	// pdftoppm is optional: without it only image files are OCR'd
+	pdftoppm, _ := exec.LookPath("pdftoppm")
+
+	if language == "" {
+		language = "eng"
+	}
+	return &TesseractOCR{
+		TesseractPath: tesseract,
+		PdftoppmPath:  pdftoppm,
+		Language:      language,
+		DPI:           300,
+	}, nil
+}
+
+// RecognizeImage runs tesseract on an image and returns stdout
+func (t *TesseractOCR) RecognizeImage(path string) (string, error) {
+	cmd := exec.Command(t.TesseractPath, path, "stdout", "-l", t.Language)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("tesseract: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// RecognizePDFPage rasterizes one page to a temporary PNG and OCRs it
+func (t *TesseractOCR) RecognizePDFPage(path string, page int) (string, error) {
+	if t.PdftoppmPath == "" {
+		return "", fmt.Errorf("pdftoppm not found in PATH, cannot OCR PDF pages")
+	}
+
+	tmpDir, err := os.MkdirTemp("", "tokentrove-ocr-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	prefix := filepath.Join(tmpDir, "page")
+	pageStr := strconv.Itoa(page)
+	cmd := exec.Command(t.PdftoppmPath,
+		"-f", pageStr, "-l", pageStr,
+		"-r", strconv.Itoa(t.DPI),
+		"-png", "-singlefile",
+		path, prefix)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("pdftoppm: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return t.RecognizeImage(prefix + ".png")
+}
+
+// imageExtension reports whether ext is an image format, which needs OCR
+func imageExtension(ext string) bool {
+	switch ext {
+	case ".png", ".jpg", ".jpeg", ".tif", ".tiff", ".bmp", ".gif":
+		return true
+	}
+	return false
+}
+
+func extractImage(src source) (*ExtractionResult, error) {
+	if src.cfg.ocr == nil {
+		return nil, fmt.Errorf("%w: %s (enable OCR to process images)", ErrUnsupportedExtension, src.ext)
+	}
+
+	path, cleanup, err := src.localPath()
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	text, err := src.cfg.ocr.RecognizeImage(path)
+	if err != nil {
+		return nil, err
+	}
+	return &ExtractionResult{
+		FullText: text,
+		Pages:    []string{text},
+	}, nil
+}
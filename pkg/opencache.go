@@ -0,0 +1,244 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/RoaringBitmap/roaring/v2"
+)
+
+// Cache reads a cache directory built by process -cache or analyze: its
+// vocabulary, file list, n-gram frequencies and word index. The vocabulary
+// and file list are read on first use and kept; n-grams and posting lists
+// are read from disk on each call, one line at a time. A Cache is safe for
+// concurrent use; Close releases the word index PostingList keeps open.
+type Cache struct {
+	dir string
+
+	wordsOnce sync.Once
+	words     []string
+	wordIDs   map[string]int
+	wordsErr  error
+
+	filesOnce sync.Once
+	files     []string
+	filesErr  error
+
+	postingsOnce sync.Once
+	postings     *Postings // fileuniqindex.bin; nil reads fileuniqindex.txt
+	postingsMu   sync.Mutex
+}
+
+// errStopScan, returned by the function of a scan, ends it without error
+var errStopScan = errors.New("stop scan")
+
+// Ngram is an n-gram of a frequency file: the indices of its words in the
+// vocabulary, the words and its count
+type Ngram struct {
+	IDs   []int
+	Words []string
+	Count int
+}
+
+// Text returns the words of the n-gram separated by spaces
+func (ng Ngram) Text() string {
+	return strings.Join(ng.Words, " ")
+}
+
+// NgramOptions selects the n-grams Cache.Ngrams returns. Zero values select
+// everything.
+type NgramOptions struct {
+	Limit    int // at most this many, the most frequent
+	MinCount int // occurring at least this many times
+}
+
+// OpenCache opens a cache directory, which needs at least the uniq.txt and
+// files.txt of -cache tokens
+func OpenCache(dir string) (*Cache, error) {
+	for _, name := range []string{"uniq.txt", "files.txt"} {
+		if !CacheFileExists(filepath.Join(dir, name)) {
+			return nil, fmt.Errorf("%s is not a cache: no %s (run -cache tokens first)", dir, name)
+		}
+	}
+	return &Cache{dir: dir}, nil
+}
+
+// Dir returns the directory of the cache
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// Close closes the binary word index if a PostingList call opened it
+func (c *Cache) Close() error {
+	c.postingsMu.Lock()
+	defer c.postingsMu.Unlock()
+	if c.postings == nil {
+		return nil
+	}
+	err := c.postings.Close()
+	c.postings = nil
+	return err
+}
+
+func (c *Cache) loadWords() {
+	c.wordsOnce.Do(func() {
+		c.words, c.wordsErr = readLines(filepath.Join(c.dir, "uniq.txt"))
+		if c.wordsErr != nil {
+			c.wordsErr = fmt.Errorf("could not read uniq.txt: %w", c.wordsErr)
+			return
+		}
+		c.wordIDs = make(map[string]int, len(c.words))
+		for i, w := range c.words {
+			c.wordIDs[w] = i
+		}
+	})
+}
+
+// WordIndex returns the vocabulary of uniq.txt, the word of each index. The
+// slice is shared and must not be modified.
+func (c *Cache) WordIndex() ([]string, error) {
+	c.loadWords()
+	return c.words, c.wordsErr
+}
+
+// WordID returns the index of a word in the vocabulary
+func (c *Cache) WordID(word string) (int, bool) {
+	c.loadWords()
+	id, ok := c.wordIDs[word]
+	return id, ok
+}
+
+// Files returns the token files of files.txt, the path of each file index.
+// The slice is shared and must not be modified.
+func (c *Cache) Files() ([]string, error) {
+	c.filesOnce.Do(func() {
+		c.files, c.filesErr = readLines(filepath.Join(c.dir, "files.txt"))
+		if c.filesErr != nil {
+			c.filesErr = fmt.Errorf("could not read files.txt: %w", c.filesErr)
+		}
+	})
+	return c.files, c.filesErr
+}
+
+// MaxN returns the largest n with an {n}gramfreq.txt, or 0 without -cache
+// ngramfreq
+func (c *Cache) MaxN() int {
+	maxN := 0
+	for n := 2; CacheFileExists(c.ngramFreqPath(n)); n++ {
+		maxN = n
+	}
+	return maxN
+}
+
+func (c *Cache) ngramFreqPath(n int) string {
+	return filepath.Join(c.dir, fmt.Sprintf("%dgramfreq.txt", n))
+}
+
+// Ngrams returns the n-grams of {n}gramfreq.txt selected by opts, most
+// frequent first. Reading stops once opts.Limit are found or the counts
+// fall below opts.MinCount.
+func (c *Cache) Ngrams(n int, opts NgramOptions) ([]Ngram, error) {
+	it, err := c.NgramIterator(n)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	var result []Ngram
+	for it.Next() {
+		ng := it.Ngram()
+		if opts.MinCount > 0 && ng.Count < opts.MinCount {
+			break
+		}
+		result = append(result, ng)
+		if opts.Limit > 0 && len(result) >= opts.Limit {
+			break
+		}
+	}
+	if err := it.Err(); err != nil {
+		return nil, fmt.Errorf("%dgramfreq.txt: %w", n, err)
+	}
+	return result, nil
+}
+
+// parseNgram turns a "w1|w2|..." key of a frequency file into an Ngram
+func parseNgram(key string, count int, words []string) Ngram {
+	parts := strings.Split(key, "|")
+	ng := Ngram{IDs: make([]int, 0, len(parts)), Words: make([]string, 0, len(parts)), Count: count}
+	for _, part := range parts {
+		idx, err := strconv.Atoi(part)
+		if err != nil {
+			continue
+		}
+		ng.IDs = append(ng.IDs, idx)
+		if idx >= 0 && idx < len(words) {
+			ng.Words = append(ng.Words, words[idx])
+		}
+	}
+	return ng
+}
+
+// PostingList returns the files a word occurs in, as indices into Files; an
+// empty set for a word not in the vocabulary. It reads fileuniqindex.bin, or
+// scans fileuniqindex.txt up to the word without it.
+func (c *Cache) PostingList(word string) (*roaring.Bitmap, error) {
+	id, ok := c.WordID(word)
+	if !ok {
+		if _, err := c.WordIndex(); err != nil {
+			return nil, err
+		}
+		return roaring.New(), nil
+	}
+	indexPath := filepath.Join(c.dir, "fileuniqindex.txt")
+	c.postingsOnce.Do(func() {
+		if p, err := OpenPostings(PostingsPath(indexPath)); err == nil {
+			c.postings = p
+		}
+	})
+	c.postingsMu.Lock()
+	p := c.postings
+	c.postingsMu.Unlock()
+	if p != nil && id < p.Len() {
+		return p.Get(id)
+	}
+
+	set := roaring.New()
+	err := scanIndexLines(indexPath, func(idx int, files *roaring.Bitmap) error {
+		if idx != id {
+			return nil
+		}
+		set = files
+		return errStopScan
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not read fileuniqindex.txt (run -cache index first): %w", err)
+	}
+	return set, nil
+}
+
+// EachPostingList calls fn with every word of the word index, by index, and
+// the files it occurs in, one line of fileuniqindex.txt at a time, until fn
+// returns false
+func (c *Cache) EachPostingList(fn func(id int, word string, files *roaring.Bitmap) bool) error {
+	words, err := c.WordIndex()
+	if err != nil {
+		return err
+	}
+	err = scanIndexLines(filepath.Join(c.dir, "fileuniqindex.txt"), func(idx int, files *roaring.Bitmap) error {
+		if idx < 0 || idx >= len(words) {
+			return nil
+		}
+		if !fn(idx, words[idx], files) {
+			return errStopScan
+		}
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("could not read fileuniqindex.txt (run -cache index first): %w", err)
+	}
+	return err
+}
@@ -0,0 +1,112 @@
+package pkg
+
+import (
+	"errors"
+	"time"
+)
+
+// extractConfig is everything that decides how a document is extracted: the
+// limits of ExtractOptions and the modes the Set* functions set for the
+// whole package. Built-in extractors find it in their source.
+type extractConfig struct {
+	limits         ExtractOptions
+	ocr            OCRBackend // nil disables OCR
+	sniff          bool
+	emailHeaders   bool
+	htmlMode       string
+	structuredMode string
+	markdownCode   string
+	codeMode       string
+}
+
+// ExtractOption overrides one package-wide setting for a single call of
+// ExtractContentWithOptions, leaving the other calls alone
+type ExtractOption func(*extractConfig)
+
+// packageExtractConfig returns the settings of ExtractContent, those of
+// SetExtractOptions, SetOCRBackend, SetContentSniffing, SetEmailHeaders and
+// the Set*Mode functions
+func packageExtractConfig() *extractConfig {
+	return &extractConfig{
+		limits:         extractOptions,
+		ocr:            currentOCRBackend(),
+		sniff:          sniffContent,
+		emailHeaders:   includeEmailHeaders,
+		htmlMode:       htmlMode,
+		structuredMode: structuredMode,
+		markdownCode:   markdownCodeMode,
+		codeMode:       codeMode,
+	}
+}
+
+// check refuses unknown modes, as the Set*Mode functions do
+func (c *extractConfig) check() error {
+	return errors.Join(
+		checkHTMLMode(c.htmlMode),
+		checkStructuredMode(c.structuredMode),
+		checkMarkdownCodeMode(c.markdownCode),
+		checkCodeMode(c.codeMode),
+	)
+}
+
+// WithLimits replaces the size, page and time limits of SetExtractOptions
+func WithLimits(opts ExtractOptions) ExtractOption {
+	opts = opts.normalized()
+	return func(c *extractConfig) { c.limits = opts }
+}
+
+// WithMaxFileSize refuses inputs above size bytes with ErrTooLarge (0 = no limit)
+func WithMaxFileSize(size int64) ExtractOption {
+	return func(c *extractConfig) { c.limits.MaxFileSize = size }
+}
+
+// WithMaxPages keeps at most pages pages, slides, sheets or chapters (0 = all)
+func WithMaxPages(pages int) ExtractOption {
+	return func(c *extractConfig) { c.limits.MaxPages = pages }
+}
+
+// WithTimeout gives up on the document after d with ErrExtractTimeout
+// (0 = no limit), unless the limits have a timeout for its extension
+func WithTimeout(d time.Duration) ExtractOption {
+	return func(c *extractConfig) { c.limits.Timeout = d }
+}
+
+// WithOCR reads images and image-only PDF pages with b; nil turns OCR off
+func WithOCR(b OCRBackend) ExtractOption {
+	return func(c *extractConfig) { c.ocr = b }
+}
+
+// WithSniffing lets the content pick the extractor when the extension is
+// missing, unknown or wrong, as SetContentSniffing does
+func WithSniffing(enabled bool) ExtractOption {
+	return func(c *extractConfig) { c.sniff = enabled }
+}
+
+// WithEmailHeaders includes Subject/From/To/Date in email text, as
+// SetEmailHeaders does
+func WithEmailHeaders(include bool) ExtractOption {
+	return func(c *extractConfig) { c.emailHeaders = include }
+}
+
+// WithHTMLMode selects HTMLFull or HTMLContent, the latter dropping menus,
+// scripts and banners
+func WithHTMLMode(mode string) ExtractOption {
+	return func(c *extractConfig) { c.htmlMode = mode }
+}
+
+// WithStructuredMode selects StructuredValues, StructuredKeys or
+// StructuredRaw for JSON and YAML
+func WithStructuredMode(mode string) ExtractOption {
+	return func(c *extractConfig) { c.structuredMode = mode }
+}
+
+// WithMarkdownCodeMode selects MarkdownCodeStrip, MarkdownCodeTag or
+// MarkdownCodeKeep for fenced code blocks
+func WithMarkdownCodeMode(mode string) ExtractOption {
+	return func(c *extractConfig) { c.markdownCode = mode }
+}
+
+// WithCodeMode selects CodeComments, CodeIdentifiers or CodeRaw for source files
+func WithCodeMode(mode string) ExtractOption {
+	return func(c *extractConfig) { c.codeMode = mode }
+}
@@ -0,0 +1,122 @@
+package pkg
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+
+	"github.com/RoaringBitmap/roaring/v2"
+)
+
+// FileVocabulary is how far the words of a file stray from those of the
+// corpus it is in
+type FileVocabulary struct {
+	Index      int
+	Tokens     int
+	Types      int     // distinct words
+	Divergence float64 // KL divergence of its word distribution from the corpus one, in bits
+	HapaxRatio float64 // share of its tokens that occur nowhere else in the corpus
+}
+
+// VocabularyOutliers compares the word distribution of each file of files
+// (nil for all) with that of all of them together and returns the files of
+// at least minTokens tokens, the most divergent first. Corrupted extractions
+// and files in another language stand out with a high divergence and many
+// words found in no other file. The files are read twice, first for the
+// corpus counts; progress is called after each file read, from the reading
+// goroutines, with the reads done and to do; an error from it stops the scan
+// and is returned.
+func VocabularyOutliers(cacheDir string, minTokens int, files *roaring.Bitmap,
+	progress func(done, total int) error) ([]FileVocabulary, error) {
+	filesList, err := readLines(filepath.Join(cacheDir, "files.txt"))
+	if err != nil {
+		return nil, fmt.Errorf("could not read files.txt: %w", err)
+	}
+	words, err := readLines(filepath.Join(cacheDir, "uniq.txt"))
+	if err != nil {
+		return nil, fmt.Errorf("could not read uniq.txt: %w", err)
+	}
+
+	src := newTokenSource(cacheDir, readCacheInput(cacheDir), indexWords(words))
+	if src.cacheDir == "" && src.inputDir == "" {
+		return nil, fmt.Errorf("no word IDs (-cache docs) or token directory in settings.txt to read the files from")
+	}
+	selected := fileSet(files, len(filesList))
+	count := int(selected.GetCardinality())
+	total := 2 * count
+	var done atomic.Int64
+	step := func() error {
+		if progress != nil {
+			return progress(int(done.Add(1)), total)
+		}
+		return nil
+	}
+
+	// The corpus counts of each word
+	corpus := make([]atomic.Int64, len(words))
+	var corpusTokens atomic.Int64
+	err = forEachTokenIndex(src, filesList, count, bitmapIndices(selected), func(worker, fileIdx int, ids []int) error {
+		for _, id := range ids {
+			if id >= 0 && id < len(corpus) {
+				corpus[id].Add(1)
+			}
+		}
+		corpusTokens.Add(int64(len(ids)))
+		return step()
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if corpusTokens.Load() == 0 {
+		return nil, nil
+	}
+	totalTokens := float64(corpusTokens.Load())
+
+	results := make([]FileVocabulary, len(filesList))
+	err = forEachTokenIndex(src, filesList, count, bitmapIndices(selected), func(worker, fileIdx int, ids []int) error {
+		counts := make(map[int]int)
+		for _, id := range ids {
+			if id >= 0 && id < len(corpus) {
+				counts[id]++
+			}
+		}
+		fv := FileVocabulary{Index: fileIdx, Types: len(counts)}
+		for _, c := range counts {
+			fv.Tokens += c
+		}
+		if fv.Tokens == 0 {
+			return step()
+		}
+		hapax := 0
+		for id, c := range counts {
+			p := float64(c) / float64(fv.Tokens)
+			q := float64(corpus[id].Load()) / totalTokens
+			fv.Divergence += p * math.Log2(p/q)
+			if corpus[id].Load() == int64(c) {
+				hapax += c
+			}
+		}
+		fv.HapaxRatio = float64(hapax) / float64(fv.Tokens)
+		results[fileIdx] = fv
+		return step()
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var outliers []FileVocabulary
+	for _, fv := range results {
+		if fv.Tokens > 0 && fv.Tokens >= minTokens {
+			outliers = append(outliers, fv)
+		}
+	}
+	sort.SliceStable(outliers, func(i, j int) bool {
+		if outliers[i].Divergence != outliers[j].Divergence {
+			return outliers[i].Divergence > outliers[j].Divergence
+		}
+		return outliers[i].HapaxRatio > outliers[j].HapaxRatio
+	})
+	return outliers, nil
+}
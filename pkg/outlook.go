@@ -0,0 +1,284 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net/mail"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// msgPropStream prefixes the stream holding a MAPI property of a .msg file;
+// the property tag and type follow as 8 hex digits (0037001F = Unicode subject)
+const msgPropStream = "__substg1.0_"
+
+// MAPI property tags read from .msg files
+const (
+	msgTagSubject     = "0037"
+	msgTagHeaders     = "007D"
+	msgTagSenderName  = "0C1A"
+	msgTagSenderEmail = "0C1F"
+	msgTagDisplayTo   = "0E04"
+	msgTagBody        = "1000"
+	msgTagHTML        = "1013"
+	msgTagSenderSMTP  = "5D01"
+)
+
+// extractMSG reads an Outlook .msg file (an OLE2 compound file of MAPI properties)
+func extractMSG(src source) (res *ExtractionResult, err error) {
+	// Malformed compound files can make the OLE reader panic
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("msg parser panic: %v", r)
+		}
+	}()
+
+	head := make([]byte, 8)
+	if _, err := src.r.ReadAt(head, 0); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(head, oleSignature) {
+		return nil, fmt.Errorf("not an OLE2 compound file")
+	}
+
+	var names []string
+	for _, tag := range []string{msgTagSubject, msgTagHeaders, msgTagSenderName, msgTagSenderEmail,
+		msgTagDisplayTo, msgTagBody, msgTagSenderSMTP} {
+		names = append(names, msgPropStream+tag+"001F", msgPropStream+tag+"001E")
+	}
+	names = append(names, msgPropStream+msgTagHTML+"0102")
+
+	streams, err := readOLEStreams(src, names...)
+	if err != nil {
+		return nil, err
+	}
+	prop := func(tag string) string {
+		if data, ok := streams[msgPropStream+tag+"001F"]; ok {
+			return utf16LEString(data)
+		}
+		if data, ok := streams[msgPropStream+tag+"001E"]; ok {
+			decoded, err := charmap.Windows1252.NewDecoder().Bytes(data)
+			if err != nil {
+				return ""
+			}
+			return strings.TrimRight(string(decoded), "\x00")
+		}
+		return ""
+	}
+
+	// Exchange senders have an X.500 address ("/O=...") in place of SMTP
+	email := prop(msgTagSenderSMTP)
+	if email == "" && !strings.HasPrefix(prop(msgTagSenderEmail), "/") {
+		email = prop(msgTagSenderEmail)
+	}
+	from := prop(msgTagSenderName)
+	switch {
+	case from == "":
+		from = email
+	case email != "" && !strings.Contains(from, email):
+		from = fmt.Sprintf("%s <%s>", from, email)
+	}
+
+	// The original internet headers, when present, carry the send date
+	var date time.Time
+	if headers := prop(msgTagHeaders); headers != "" {
+		if msg, err := mail.ReadMessage(strings.NewReader(strings.TrimSpace(headers) + "\r\n\r\n")); err == nil {
+			date, _ = msg.Header.Date()
+		}
+	}
+
+	body := prop(msgTagBody)
+	if strings.TrimSpace(body) == "" {
+		if html, ok := streams[msgPropStream+msgTagHTML+"0102"]; ok {
+			body, _ = htmlToText(bytes.NewReader(html))
+		}
+	}
+
+	var sb strings.Builder
+	if src.cfg.emailHeaders {
+		dateStr := ""
+		if !date.IsZero() {
+			dateStr = date.Format(time.RFC1123Z)
+		}
+		for _, h := range [][2]string{{"Subject", prop(msgTagSubject)}, {"From", from}, {"To", prop(msgTagDisplayTo)}, {"Date", dateStr}} {
+			if h[1] != "" {
+				sb.WriteString(h[0] + ": " + h[1] + "\n")
+			}
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString(body)
+	text := sb.String()
+
+	res = &ExtractionResult{
+		FullText: text,
+		Pages:    []string{text},
+	}
+	res.setMeta(MetaTitle, prop(msgTagSubject))
+	res.setMeta(MetaAuthor, from)
+	if !date.IsZero() {
+		res.setMeta(MetaCreated, date.UTC().Format(time.RFC3339))
+	}
+	return res, nil
+}
+
+// utf16LEString decodes a NUL-terminated little-endian UTF-16 string
+func utf16LEString(data []byte) string {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(data[i*2:])
+	}
+	return strings.TrimRight(string(utf16.Decode(units)), "\x00")
+}
+
+// mailMessage is one message of a mail container such as a .pst file
+type mailMessage struct {
+	Folder string // folder path inside the container
+	Key    string // file-name-safe Message-ID or subject, unique within Folder
+	Result *ExtractionResult
+}
+
+// readPSTMessages unpacks a .pst with readpst (libpst) and extracts every
+// message it contains, with headers as emailToText takes it
+func readPSTMessages(path string, headers bool) ([]mailMessage, error) {
+	bin, err := exec.LookPath("readpst")
+	if err != nil {
+		return nil, fmt.Errorf("readpst not found in PATH: %w", err)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "tokentrove-pst-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// -e: one .eml file per message, -b: skip RTF bodies, -q: quiet
+	cmd := exec.Command(bin, "-q", "-e", "-b", "-o", tmpDir, path)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("readpst: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var files []string
+	filepath.Walk(tmpDir, func(p string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			files = append(files, p)
+		}
+		return nil
+	})
+	sort.Strings(files)
+
+	used := make(map[string]int)
+	var messages []mailMessage
+	for _, p := range files {
+		raw, err := os.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		// Contacts and calendar items are not messages
+		text, header, err := emailToText(raw, headers)
+		if err != nil || header.Get("From") == "" && header.Get("Subject") == "" {
+			continue
+		}
+
+		folder, _ := filepath.Rel(tmpDir, filepath.Dir(p))
+		if folder == "." {
+			folder = ""
+		}
+		key := mailMessageKey(header)
+		id := filepath.Join(folder, key)
+		if n := used[id]; n > 0 {
+			key = fmt.Sprintf("%s-%d", key, n+1)
+		}
+		used[id]++
+
+		res := &ExtractionResult{
+			FullText: text,
+			Pages:    []string{text},
+		}
+		res.setMeta(MetaTitle, decodeHeader(header.Get("Subject")))
+		res.setMeta(MetaAuthor, decodeHeader(header.Get("From")))
+		if date, err := header.Date(); err == nil {
+			res.setMeta(MetaCreated, date.UTC().Format(time.RFC3339))
+		}
+		messages = append(messages, mailMessage{Folder: folder, Key: key, Result: res})
+	}
+	return messages, nil
+}
+
+// mailMessageKey names a message's output file after its Message-ID, or its
+// subject if it has none
+func mailMessageKey(header mail.Header) string {
+	key := strings.Trim(strings.TrimSpace(header.Get("Message-Id")), "<>")
+	if key == "" {
+		key = decodeHeader(header.Get("Subject"))
+	}
+	key = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9',
+			r == '.', r == '-', r == '_', r == '@':
+			return r
+		}
+		return '_'
+	}, key)
+	key = strings.Trim(key, "._")
+	if len(key) > 100 {
+		key = key[:100]
+	}
+	if key == "" {
+		key = "message"
+	}
+	return key
+}
+
+// extractPST returns every message of a .pst as one page each
+func extractPST(src source) (*ExtractionResult, error) {
+	path, cleanup, err := src.localPath()
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	messages, err := readPSTMessages(path, src.cfg.emailHeaders)
+	if err != nil {
+		return nil, err
+	}
+
+	var pages []string
+	var fullTextBuilder strings.Builder
+	for _, m := range messages {
+		pages = append(pages, m.Result.FullText)
+		fullTextBuilder.WriteString(m.Result.FullText)
+		fullTextBuilder.WriteString("\n")
+	}
+	return &ExtractionResult{
+		FullText: fullTextBuilder.String(),
+		Pages:    pages,
+	}, nil
+}
+
+// processPST writes each message of a .pst to outBase/<folder>/<key>.txt
+func processPST(path, outBase string, opts ProcessOptions, logs runLogs) {
+	messages, err := readPSTMessages(path, includeEmailHeaders)
+	if err != nil {
+		logs.fail(path, fmt.Errorf("pst error: %w", err))
+		return
+	}
+	for _, m := range messages {
+		out := filepath.Join(outBase, m.Folder, m.Key)
+		if !opts.Replace && outputExists(out, opts) {
+			continue
+		}
+		label := path + "/" + filepath.ToSlash(filepath.Join(m.Folder, m.Key))
+		writeOutput(m.Result, label, nil, out, opts, logs)
+	}
+}
@@ -0,0 +1,292 @@
+package pkg
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/RoaringBitmap/roaring/v2"
+)
+
+// The kinds of personal data ScanPII finds
+const (
+	PIIEmail      = "email"
+	PIIPhone      = "phone"
+	PIISSN        = "ssn"
+	PIICreditCard = "credit_card"
+	PIIIBAN       = "iban"
+)
+
+// PIIKinds are the kinds of personal data, in the order they are matched:
+// a span of text counts once, as the first kind it matches
+var PIIKinds = []string{PIICreditCard, PIIIBAN, PIISSN, PIIPhone, PIIEmail}
+
+// PIIHit is a piece of personal data found in a text
+type PIIHit struct {
+	Kind string
+	Text string
+}
+
+// FilePII are the personal data found in a file: the hits of each kind and
+// up to a few samples of each
+type FilePII struct {
+	Index   int
+	Total   int
+	Counts  map[string]int
+	Samples map[string][]string
+}
+
+// The patterns of each kind. They match raw text and token files alike, as
+// the tokenizer leaves digits and letters in their groups with spaces in
+// place of the dashes, dots and brackets between them. Each match is checked
+// further (Luhn, IBAN checksum, SSN ranges) before it counts.
+var (
+	cardPattern  = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+	ibanPattern  = regexp.MustCompile(`(?i)\b[a-z]{2}\d{2}(?:[a-z0-9]{11,30}|(?: [a-z0-9]{4}){2,7}(?: [a-z0-9]{1,4})?)\b`)
+	ssnPattern   = regexp.MustCompile(`\b(\d{3})[- ](\d{2})[- ](\d{4})\b`)
+	phonePattern = regexp.MustCompile(`(?:\+\d{1,3}[ .-]?)?(?:\(\d{3}\) ?|\b\d{3}[ .-]?)\d{3}[ .-]\d{4}\b|\+\d{1,3}(?:[ .-]?\(?\d{1,4}\)?){2,5}\b`)
+	emailPattern = regexp.MustCompile(`(?i)\b[a-z0-9._%+-]+@[a-z0-9-]+(?:\.[a-z0-9-]+)*\.[a-z]{2,}\b`)
+)
+
+// FindPII returns the personal data in text: email addresses, phone numbers,
+// US social security numbers, payment card numbers that pass the Luhn check
+// and IBANs with a valid checksum, in the order of PIIKinds and then of the
+// text. Email addresses and phone numbers in international form need raw
+// text, as tokenizing drops their @ and +.
+func FindPII(text string) []PIIHit {
+	var hits []PIIHit
+	var taken [][2]int
+	overlaps := func(span []int) bool {
+		for _, t := range taken {
+			if span[0] < t[1] && t[0] < span[1] {
+				return true
+			}
+		}
+		return false
+	}
+	find := func(kind string, pattern *regexp.Regexp, valid func(match string) (string, bool)) {
+		for _, span := range pattern.FindAllStringIndex(text, -1) {
+			if overlaps(span) {
+				continue
+			}
+			match, ok := valid(text[span[0]:span[1]])
+			if !ok {
+				continue
+			}
+			taken = append(taken, [2]int{span[0], span[0] + len(match)})
+			hits = append(hits, PIIHit{Kind: kind, Text: match})
+		}
+	}
+
+	find(PIICreditCard, cardPattern, func(m string) (string, bool) {
+		digits := onlyDigits(m)
+		return m, strings.ContainsRune("3456", rune(digits[0])) && luhnValid(digits)
+	})
+	find(PIIIBAN, ibanPattern, validIBANPrefix)
+	find(PIISSN, ssnPattern, func(m string) (string, bool) {
+		d := onlyDigits(m)
+		area, group, serial := d[:3], d[3:5], d[5:]
+		return m, area != "000" && area != "666" && area[0] != '9' && group != "00" && serial != "0000"
+	})
+	find(PIIPhone, phonePattern, func(m string) (string, bool) {
+		n := len(onlyDigits(m))
+		return m, n >= 10 && n <= 15
+	})
+	find(PIIEmail, emailPattern, func(m string) (string, bool) { return m, true })
+	return hits
+}
+
+// onlyDigits returns the digits of s
+func onlyDigits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// luhnValid reports whether a string of digits passes the Luhn check of
+// payment card numbers
+func luhnValid(digits string) bool {
+	sum := 0
+	for i := range len(digits) {
+		d := int(digits[len(digits)-1-i] - '0')
+		if i%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// validIBANPrefix returns the longest IBAN a match begins with. A spaced
+// IBAN ends in a short group, so a word following it may be matched as one;
+// groups are dropped from the end until the checksum holds.
+func validIBANPrefix(m string) (string, bool) {
+	for {
+		if ibanValid(strings.ReplaceAll(m, " ", "")) {
+			return m, true
+		}
+		cut := strings.LastIndex(m, " ")
+		if cut <= 4 {
+			return "", false
+		}
+		m = m[:cut]
+	}
+}
+
+// ibanValid reports whether s, without spaces, is an IBAN of 15 to 34
+// characters whose ISO 13616 checksum (mod 97) holds
+func ibanValid(s string) bool {
+	if len(s) < 15 || len(s) > 34 {
+		return false
+	}
+	s = strings.ToUpper(s)
+	var b strings.Builder
+	for _, r := range s[4:] + s[:4] {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r >= 'A' && r <= 'Z':
+			fmt.Fprintf(&b, "%d", r-'A'+10)
+		default:
+			return false
+		}
+	}
+	n, ok := new(big.Int).SetString(b.String(), 10)
+	return ok && new(big.Int).Mod(n, big.NewInt(97)).Int64() == 1
+}
+
+// ScanPII looks for personal data in the files of files (nil for all) with
+// FindPII and returns the files with any, the most hits first, keeping up to
+// samples of each kind per file. The files are read from the input directory
+// of the cache, which holds raw extracts when it was built from the output of
+// process -type text; those keep the @ of email addresses that tokenizing
+// drops. A file missing there is read from the word IDs of docs/. progress is called after each file read, from the
+// reading goroutines, with the files done and to do; an error from it stops
+// the scan and is returned.
+func ScanPII(cacheDir string, files *roaring.Bitmap, samples int,
+	progress func(done, total int) error) ([]FilePII, error) {
+	filesList, err := readLines(filepath.Join(cacheDir, "files.txt"))
+	if err != nil {
+		return nil, fmt.Errorf("could not read files.txt: %w", err)
+	}
+	textDir := readCacheInput(cacheDir)
+	var words []string
+	var src *tokenSource
+	if hasDocs(cacheDir) {
+		if words, err = readLines(filepath.Join(cacheDir, "uniq.txt")); err != nil {
+			return nil, fmt.Errorf("could not read uniq.txt: %w", err)
+		}
+		src = newTokenSource(cacheDir, "", nil)
+		if src.cacheDir == "" {
+			src = nil
+		}
+	}
+	if textDir == "" && src == nil {
+		return nil, fmt.Errorf("no input directory in settings.txt or word IDs (-cache docs) to read the files from")
+	}
+
+	// text is the text of a file, from textDir or else from docs/
+	text := func(fileIdx int) (string, bool) {
+		if textDir != "" {
+			if data, err := os.ReadFile(filepath.Join(textDir, filesList[fileIdx])); err == nil {
+				return string(data), true
+			}
+		}
+		if src == nil {
+			return "", false
+		}
+		ids, err := ReadDocIDs(src.cacheDir, fileIdx)
+		if err != nil {
+			return "", false
+		}
+		parts := make([]string, 0, len(ids))
+		for _, id := range ids {
+			if id >= 0 && id < len(words) {
+				parts = append(parts, words[id])
+			}
+		}
+		return strings.Join(parts, " "), true
+	}
+
+	selected := fileSet(files, len(filesList))
+	total := int(selected.GetCardinality())
+	jobs := make(chan int)
+	stop := make(chan struct{})
+	var (
+		mu       sync.Mutex
+		found    []FilePII
+		firstErr error
+		errOnce  sync.Once
+		done     atomic.Int64
+		wg       sync.WaitGroup
+	)
+	for range cacheWorkerCount(total) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for fileIdx := range jobs {
+				if t, ok := text(fileIdx); ok {
+					if fp := filePII(fileIdx, FindPII(t), samples); fp.Total > 0 {
+						mu.Lock()
+						found = append(found, fp)
+						mu.Unlock()
+					}
+				}
+				if progress != nil {
+					if err := progress(int(done.Add(1)), total); err != nil {
+						errOnce.Do(func() {
+							firstErr = err
+							close(stop)
+						})
+					}
+				}
+			}
+		}()
+	}
+feed:
+	for fileIdx := range bitmapIndices(selected) {
+		select {
+		case jobs <- fileIdx:
+		case <-stop:
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].Total != found[j].Total {
+			return found[i].Total > found[j].Total
+		}
+		return found[i].Index < found[j].Index
+	})
+	return found, nil
+}
+
+// filePII counts the hits of a file by kind, keeping the first samples
+// distinct ones of each
+func filePII(fileIdx int, hits []PIIHit, samples int) FilePII {
+	fp := FilePII{Index: fileIdx, Total: len(hits), Counts: make(map[string]int), Samples: make(map[string][]string)}
+	for _, h := range hits {
+		fp.Counts[h.Kind]++
+		if s := fp.Samples[h.Kind]; len(s) < samples && !slices.Contains(s, h.Text) {
+			fp.Samples[h.Kind] = append(s, h.Text)
+		}
+	}
+	return fp
+}
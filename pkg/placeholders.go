@@ -0,0 +1,146 @@
+package pkg
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// The kinds of text ProcessOptions.Placeholders replaces with a placeholder
+// token
+const (
+	PlaceholderEmail = "email"
+	PlaceholderURL   = "url"
+	PlaceholderDate  = "date"
+	PlaceholderNum   = "num"
+)
+
+// PlaceholderKinds are the kinds of placeholder, in the order they are
+// matched: a span of text is replaced once, by the first kind it matches, so
+// the digits of a date are not also numbers
+var PlaceholderKinds = []string{PlaceholderEmail, PlaceholderURL, PlaceholderDate, PlaceholderNum}
+
+// placeholderTokens are the tokens written in place of each kind. They have
+// no letters of a word around them, so no tokenizer or stemmer makes them
+// one, and the cache builders keep them as they are.
+var placeholderTokens = map[string]string{
+	PlaceholderEmail: "<EMAIL>",
+	PlaceholderURL:   "<URL>",
+	PlaceholderDate:  "<DATE>",
+	PlaceholderNum:   "<NUM>",
+}
+
+// The patterns of each kind. Dates are ISO (2024-03-05), numeric (05/03/2024,
+// 5.3.24) or with a month name and a year (March 5, 2024 or 5 Mar 2024); a
+// number is a run of digits with decimal or thousands separators, not one
+// glued to letters like "3rd" or "mp3".
+var (
+	urlPattern       = regexp.MustCompile(`(?i)\b(?:https?://|ftp://|www\.)[^\s<>"'()\[\]]+`)
+	isoDatePattern   = regexp.MustCompile(`\b\d{4}-\d{1,2}-\d{1,2}(?:[T ]\d{1,2}:\d{2}(?::\d{2})?)?\b`)
+	numDatePattern   = regexp.MustCompile(`\b\d{1,2}[/.]\d{1,2}[/.](?:\d{4}|\d{2})\b`)
+	monthDatePattern = regexp.MustCompile(`(?i)\b(?:\d{1,2}(?:st|nd|rd|th)?\.? ` + monthNames + `\.?,? \d{4}|` + monthNames + `\.? \d{1,2}(?:st|nd|rd|th)?,? \d{4})\b`)
+	numPattern       = regexp.MustCompile(`[-+]?\b\d+(?:[.,]\d+)*(?:[eE][-+]?\d+)?\b`)
+)
+
+const monthNames = `(?:jan(?:uary)?|feb(?:ruary)?|mar(?:ch)?|apr(?:il)?|may|june?|july?|aug(?:ust)?|sept?(?:ember)?|oct(?:ober)?|nov(?:ember)?|dec(?:ember)?)`
+
+// placeholderPatterns are the patterns of each kind
+var placeholderPatterns = map[string][]*regexp.Regexp{
+	PlaceholderEmail: {emailPattern},
+	PlaceholderURL:   {urlPattern},
+	PlaceholderDate:  {isoDatePattern, monthDatePattern, numDatePattern},
+	PlaceholderNum:   {numPattern},
+}
+
+// ParsePlaceholders reads a comma-separated list of placeholder kinds, or
+// "all" for every kind, into the order of PlaceholderKinds. "" is none.
+func ParsePlaceholders(spec string) ([]string, error) {
+	want := make(map[string]bool)
+	for _, kind := range strings.Split(spec, ",") {
+		kind = strings.ToLower(strings.TrimSpace(kind))
+		switch {
+		case kind == "":
+		case kind == "all":
+			for _, k := range PlaceholderKinds {
+				want[k] = true
+			}
+		case placeholderTokens[kind] != "":
+			want[kind] = true
+		default:
+			return nil, fmt.Errorf("unknown placeholder %q (use %s or all)", kind, strings.Join(PlaceholderKinds, ", "))
+		}
+	}
+	var kinds []string
+	for _, k := range PlaceholderKinds {
+		if want[k] {
+			kinds = append(kinds, k)
+		}
+	}
+	return kinds, nil
+}
+
+// IsPlaceholder reports whether word is a placeholder token such as <NUM>
+func IsPlaceholder(word string) bool {
+	if !strings.HasPrefix(word, "<") {
+		return false
+	}
+	for _, token := range placeholderTokens {
+		if word == token {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenizeWithPlaceholders is Tokenize with the text of the given kinds
+// replaced by their placeholder tokens, lower-casing the other words if
+// lower is set
+func tokenizeWithPlaceholders(text string, kinds []string, lower bool) []string {
+	type span struct {
+		start, end int
+		token      string
+	}
+	var spans []span
+	overlaps := func(s []int) bool {
+		for _, t := range spans {
+			if s[0] < t.end && t.start < s[1] {
+				return true
+			}
+		}
+		return false
+	}
+	for _, kind := range kinds {
+		for _, pattern := range placeholderPatterns[kind] {
+			for _, s := range pattern.FindAllStringIndex(text, -1) {
+				if !overlaps(s) {
+					spans = append(spans, span{s[0], s[1], placeholderTokens[kind]})
+				}
+			}
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+
+	var words []string
+	add := func(part string) {
+		for _, w := range Tokenize(part) {
+			if lower {
+				w = strings.ToLower(w)
+			}
+			words = append(words, w)
+		}
+	}
+	pos := 0
+	for _, s := range spans {
+		end := s.end
+		if s.token == placeholderTokens[PlaceholderURL] {
+			// A URL ending a sentence or in brackets leaves the punctuation
+			end = s.start + len(strings.TrimRight(text[s.start:end], ".,;:!?"))
+		}
+		add(text[pos:s.start])
+		words = append(words, s.token)
+		pos = end
+	}
+	add(text[pos:])
+	return words
+}
@@ -0,0 +1,289 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// PositionsName is the positional index written next to fileuniqindex.txt
+// when positions are enabled. It stores, for every file, the token offsets of
+// each word in it:
+//
+//	"TTPS" | uint32 count | count × (uint64 offset, uint32 length) | blocks
+//
+// Block i belongs to file i and is a uvarint word count followed by, for each
+// word in increasing vocabulary order, uvarint word delta, uvarint occurrence
+// count and uvarint offset deltas. Offsets count vocabulary words from the
+// start of the file, the same positions the n-gram builders use.
+const PositionsName = "positions.bin"
+
+var positionsMagic = []byte("TTPS")
+
+// indexPositions makes BuildIndexCache write positions.bin
+var indexPositions = false
+
+// SetIndexPositions sets whether BuildIndexCache also writes the positional
+// index. It costs one to three bytes per token on disk and lets phrase,
+// proximity and concordance queries run without rereading the token files.
+func SetIndexPositions(enabled bool) {
+	indexPositions = enabled
+}
+
+// buildPositions writes positions.bin for filesList. Blocks are appended in
+// the order workers finish them; the header is written last.
+func buildPositions(ctx context.Context, outputDir string, src *tokenSource, filesList []string) error {
+	path := filepath.Join(outputDir, PositionsName)
+	f, err := createAtomic(path)
+	if err != nil {
+		return err
+	}
+	defer f.Abort()
+
+	headerSize := int64(len(positionsMagic) + 4 + 12*len(filesList))
+	offsets := make([]uint64, len(filesList))
+	lengths := make([]uint32, len(filesList))
+	pos := headerSize
+
+	var mu sync.Mutex
+	logger.Info("Writing positional index", "files", len(filesList))
+	reporter.OnStage("positions")
+	err = forEachTokenFile(ctx, src, filesList, func(worker, fileIdx int, words []int) error {
+		block := encodePositions(words)
+		mu.Lock()
+		defer mu.Unlock()
+		if _, err := f.WriteAt(block, pos); err != nil {
+			return err
+		}
+		offsets[fileIdx], lengths[fileIdx] = uint64(pos), uint32(len(block))
+		pos += int64(len(block))
+		return nil
+	}, func(done int) {
+		reporter.OnFile(done, len(filesList))
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.WriteAt(positionsHeader(offsets, lengths), 0); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	logger.Info("Positional index written", "path", path)
+	return nil
+}
+
+// positionsHeader encodes the header of a positional index with the given
+// block offsets and lengths
+func positionsHeader(offsets []uint64, lengths []uint32) []byte {
+	var header bytes.Buffer
+	header.Write(positionsMagic)
+	binary.Write(&header, binary.LittleEndian, uint32(len(offsets)))
+	for i := range offsets {
+		binary.Write(&header, binary.LittleEndian, offsets[i])
+		binary.Write(&header, binary.LittleEndian, lengths[i])
+	}
+	return header.Bytes()
+}
+
+// encodePositions encodes the word offsets of one file's words
+func encodePositions(words []int) []byte {
+	byWord := make(map[int][]uint32)
+	for i, w := range words {
+		byWord[w] = append(byWord[w], uint32(i))
+	}
+	keys := make([]int, 0, len(byWord))
+	for w := range byWord {
+		keys = append(keys, w)
+	}
+	slices.Sort(keys)
+
+	buf := binary.AppendUvarint(nil, uint64(len(keys)))
+	prevWord := 0
+	for _, w := range keys {
+		offsets := byWord[w]
+		buf = binary.AppendUvarint(buf, uint64(w-prevWord))
+		buf = binary.AppendUvarint(buf, uint64(len(offsets)))
+		prev := uint32(0)
+		for _, off := range offsets {
+			buf = binary.AppendUvarint(buf, uint64(off-prev))
+			prev = off
+		}
+		prevWord = w
+	}
+	return buf
+}
+
+// Positions reads per-file word offsets from positions.bin on demand
+type Positions struct {
+	f       *os.File
+	offsets []uint64
+	lengths []uint32
+}
+
+// OpenPositions opens the positional index of a cache directory
+func OpenPositions(cacheDir string) (*Positions, error) {
+	path := filepath.Join(cacheDir, PositionsName)
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(f)
+	header := make([]byte, len(positionsMagic)+4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if !bytes.Equal(header[:len(positionsMagic)], positionsMagic) {
+		f.Close()
+		return nil, fmt.Errorf("%s: not a positional index", path)
+	}
+	count := binary.LittleEndian.Uint32(header[len(positionsMagic):])
+	p := &Positions{f: f, offsets: make([]uint64, count), lengths: make([]uint32, count)}
+	var end uint64
+	for i := range p.offsets {
+		if err := binary.Read(r, binary.LittleEndian, &p.offsets[i]); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if err := binary.Read(r, binary.LittleEndian, &p.lengths[i]); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		end = max(end, p.offsets[i]+uint64(p.lengths[i]))
+	}
+	if info, err := f.Stat(); err == nil && end > uint64(info.Size()) {
+		f.Close()
+		return nil, fmt.Errorf("%w: %s has %d of %d bytes", ErrTruncated, path, info.Size(), end)
+	}
+	return p, nil
+}
+
+// Len returns the number of files
+func (p *Positions) Len() int {
+	return len(p.offsets)
+}
+
+// File returns the offsets of every word in file fileIdx, keyed by word index
+func (p *Positions) File(fileIdx int) (map[int][]uint32, error) {
+	if fileIdx < 0 || fileIdx >= p.Len() {
+		return nil, fmt.Errorf("file %d out of range (%d files)", fileIdx, p.Len())
+	}
+	buf := make([]byte, p.lengths[fileIdx])
+	if _, err := p.f.ReadAt(buf, int64(p.offsets[fileIdx])); err != nil {
+		return nil, err
+	}
+
+	r := bytes.NewReader(buf)
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, fmt.Errorf("file %d: corrupt positions: %w", fileIdx, err)
+	}
+	positions := make(map[int][]uint32, count)
+	word := 0
+	for range count {
+		delta, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, fmt.Errorf("file %d: corrupt positions: %w", fileIdx, err)
+		}
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, fmt.Errorf("file %d: corrupt positions: %w", fileIdx, err)
+		}
+		word += int(delta)
+		offsets := make([]uint32, n)
+		prev := uint32(0)
+		for i := range offsets {
+			d, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, fmt.Errorf("file %d: corrupt positions: %w", fileIdx, err)
+			}
+			prev += uint32(d)
+			offsets[i] = prev
+		}
+		positions[word] = offsets
+	}
+	return positions, nil
+}
+
+// Words returns the word indices of file fileIdx in order, rebuilt from its
+// positions; concordance views can take context from it without the token file
+func (p *Positions) Words(fileIdx int) ([]int, error) {
+	positions, err := p.File(fileIdx)
+	if err != nil {
+		return nil, err
+	}
+	total := 0
+	for _, offsets := range positions {
+		total += len(offsets)
+	}
+	words := make([]int, total)
+	for w, offsets := range positions {
+		for _, off := range offsets {
+			if int(off) < total {
+				words[off] = w
+			}
+		}
+	}
+	return words, nil
+}
+
+// Phrase returns the offsets in file fileIdx where words occur consecutively
+func (p *Positions) Phrase(fileIdx int, words []int) ([]uint32, error) {
+	return p.Near(fileIdx, words, 0)
+}
+
+// Near returns the offsets in file fileIdx where words occur in order with at
+// most slop other words between consecutive ones; slop 0 is an exact phrase.
+// The offset returned is that of the first word.
+func (p *Positions) Near(fileIdx int, words []int, slop int) ([]uint32, error) {
+	if len(words) == 0 {
+		return nil, nil
+	}
+	positions, err := p.File(fileIdx)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []uint32
+	for _, start := range positions[words[0]] {
+		last, ok := start, true
+		for _, w := range words[1:] {
+			next, found := nextOffset(positions[w], last, uint32(slop))
+			if !found {
+				ok = false
+				break
+			}
+			last = next
+		}
+		if ok {
+			matches = append(matches, start)
+		}
+	}
+	return matches, nil
+}
+
+// nextOffset returns the first offset in sorted offsets within slop+1 words
+// after prev
+func nextOffset(offsets []uint32, prev, slop uint32) (uint32, bool) {
+	i, _ := slices.BinarySearch(offsets, prev+1)
+	if i < len(offsets) && offsets[i] <= prev+1+slop {
+		return offsets[i], true
+	}
+	return 0, false
+}
+
+// Close closes the underlying file
+func (p *Positions) Close() error {
+	return p.f.Close()
+}
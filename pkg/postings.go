@@ -0,0 +1,203 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/RoaringBitmap/roaring/v2"
+)
+
+// Binary posting files sit next to the text indexes (fileuniqindex.bin next to
+// fileuniqindex.txt, {n}gramindex.bin next to {n}gramindex.txt) and hold the
+// same file sets as roaring bitmaps, one per line of the text index:
+//
+//	"TTPB" | uint32 count | (count+1) uint64 offsets | serialized bitmaps
+//
+// Offsets are little-endian and relative to the start of the file, so entry i
+// is the bytes between offsets[i] and offsets[i+1].
+var postingsMagic = []byte("TTPB")
+
+// PostingsPath returns the binary posting file for a text index path
+func PostingsPath(indexPath string) string {
+	return strings.TrimSuffix(indexPath, ".txt") + ".bin"
+}
+
+// WritePostings writes sets as a binary posting file
+func WritePostings(path string, sets []*roaring.Bitmap) error {
+	w, err := createPostings(path, len(sets))
+	if err != nil {
+		return err
+	}
+	for _, set := range sets {
+		if err := w.add(set); err != nil {
+			w.abort()
+			return err
+		}
+	}
+	return w.close()
+}
+
+// postingsWriter streams a binary posting file whose entry count is known up
+// front; the offsets are filled in by close
+type postingsWriter struct {
+	f       *atomicFile
+	writer  *bufio.Writer
+	count   int
+	offsets []uint64
+}
+
+func createPostings(path string, count int) (*postingsWriter, error) {
+	f, err := createAtomic(path)
+	if err != nil {
+		return nil, err
+	}
+	headerSize := uint64(len(postingsMagic) + 4 + 8*(count+1))
+	w := &postingsWriter{f: f, count: count, offsets: make([]uint64, 1, count+1)}
+	w.offsets[0] = headerSize
+	if _, err := f.Seek(int64(headerSize), io.SeekStart); err != nil {
+		f.Abort()
+		return nil, err
+	}
+	w.writer = bufio.NewWriter(f)
+	return w, nil
+}
+
+func (w *postingsWriter) add(set *roaring.Bitmap) error {
+	size, err := set.WriteTo(w.writer)
+	if err != nil {
+		return err
+	}
+	w.offsets = append(w.offsets, w.offsets[len(w.offsets)-1]+uint64(size))
+	return nil
+}
+
+func (w *postingsWriter) close() error {
+	defer w.f.Abort()
+	if err := w.writer.Flush(); err != nil {
+		return err
+	}
+	if len(w.offsets)-1 != w.count {
+		return fmt.Errorf("%s: wrote %d of %d postings", w.f.path, len(w.offsets)-1, w.count)
+	}
+	var header bytes.Buffer
+	header.Write(postingsMagic)
+	binary.Write(&header, binary.LittleEndian, uint32(len(w.offsets)-1))
+	binary.Write(&header, binary.LittleEndian, w.offsets)
+	if _, err := w.f.WriteAt(header.Bytes(), 0); err != nil {
+		return err
+	}
+	return w.f.Close()
+}
+
+// abort discards the posting file
+func (w *postingsWriter) abort() {
+	w.f.Abort()
+}
+
+// Postings reads file sets from a binary posting file on demand
+type Postings struct {
+	f       *os.File
+	offsets []uint64
+}
+
+// OpenPostings opens a binary posting file written by WritePostings
+func OpenPostings(path string) (*Postings, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, len(postingsMagic)+4)
+	if _, err := io.ReadFull(f, header); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if !bytes.Equal(header[:len(postingsMagic)], postingsMagic) {
+		f.Close()
+		return nil, fmt.Errorf("%s: not a posting file", path)
+	}
+	count := binary.LittleEndian.Uint32(header[len(postingsMagic):])
+	offsets := make([]uint64, count+1)
+	if err := binary.Read(bufio.NewReader(f), binary.LittleEndian, offsets); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if info, err := f.Stat(); err == nil && offsets[count] > uint64(info.Size()) {
+		f.Close()
+		return nil, fmt.Errorf("%w: %s has %d of %d bytes", ErrTruncated, path, info.Size(), offsets[count])
+	}
+	return &Postings{f: f, offsets: offsets}, nil
+}
+
+// Len returns the number of file sets
+func (p *Postings) Len() int {
+	return len(p.offsets) - 1
+}
+
+// Get returns the file set of entry i
+func (p *Postings) Get(i int) (*roaring.Bitmap, error) {
+	if i < 0 || i >= p.Len() {
+		return nil, fmt.Errorf("posting %d out of range (%d entries)", i, p.Len())
+	}
+	start, end := p.offsets[i], p.offsets[i+1]
+	buf := make([]byte, end-start)
+	if _, err := p.f.ReadAt(buf, int64(start)); err != nil {
+		return nil, err
+	}
+	set := roaring.New()
+	if _, err := set.FromBuffer(buf); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// Close closes the underlying file
+func (p *Postings) Close() error {
+	return p.f.Close()
+}
+
+// ParseIndexLine parses an "idx,[f1,f2,...]" line of a text index
+func ParseIndexLine(line string) (int, *roaring.Bitmap, error) {
+	commaIdx := strings.Index(line, ",[")
+	if commaIdx == -1 {
+		return 0, nil, fmt.Errorf("invalid index line %q", line)
+	}
+	idx, err := strconv.Atoi(line[:commaIdx])
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid index line %q: %w", line, err)
+	}
+	set := roaring.New()
+	arrayPart := strings.TrimSuffix(line[commaIdx+2:], "]")
+	if arrayPart != "" {
+		for _, s := range strings.Split(arrayPart, ",") {
+			fIdx, err := strconv.Atoi(s)
+			if err != nil {
+				return 0, nil, fmt.Errorf("invalid index line %q: %w", line, err)
+			}
+			set.Add(uint32(fIdx))
+		}
+	}
+	return idx, set, nil
+}
+
+// writeIndexLine writes set as an "idx,[f1,f2,...]" line of a text index
+func writeIndexLine(w *bufio.Writer, idx int, set *roaring.Bitmap) {
+	var sb strings.Builder
+	sb.WriteString(strconv.Itoa(idx))
+	sb.WriteString(",[")
+	it := set.Iterator()
+	for first := true; it.HasNext(); first = false {
+		if !first {
+			sb.WriteString(",")
+		}
+		sb.WriteString(strconv.FormatUint(uint64(it.Next()), 10))
+	}
+	sb.WriteString("]\n")
+	w.WriteString(sb.String())
+}
@@ -1,10 +1,13 @@
 package pkg
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
-	"regexp"
 	"runtime"
 	"strings"
 	"sync"
@@ -43,12 +46,203 @@ func ParseMemoryLimit(s string) (uint64, error) {
 	return val * multiplier, nil
 }
 
-// RunProcess processes files from inputDir to outputDir with concurrent workers
-func RunProcess(inputDir, outputDir, processType string, workers int, replace bool, ramLimit uint64) error {
+// ProcessOptions controls how RunProcess converts files
+type ProcessOptions struct {
+	ProcessType string // "text", "token", or "lowercase"
+	Workers     int
+	Replace     bool   // overwrite existing outputs
+	RAMLimit    uint64 // soft memory limit in bytes, 0 for none
+
+	// Archives unpacks .zip/.tar/.tar.gz/.7z files and writes each member
+	// under <archive path>/<member path>.txt
+	Archives bool
+	// Pages writes one file per page (file.pdf.page0001.txt, ...) instead of one per document
+	Pages bool
+	// Metadata writes a <output>.meta.json sidecar with the document's metadata
+	Metadata bool
+	// DetectLanguage records the dominant language of each document in languages.txt
+	DetectLanguage bool
+	// Languages, if set, only converts documents detected as one of these
+	// ISO 639-1 codes (implies DetectLanguage)
+	Languages []string
+	// Sentences writes one sentence per line, so the cache builders can keep
+	// n-grams from crossing sentence boundaries (see SetSentenceBoundaries)
+	Sentences bool
+	// Placeholders are the kinds of PlaceholderKinds the "token" and
+	// "lowercase" types replace with a placeholder token, "<NUM>" for every
+	// number, so unique numbers, dates and links do not crowd out the words
+	Placeholders []string
+	// Progress receives the progress and the files that could not be
+	// converted; nil for the reporter of SetProgressReporter
+	Progress ProgressReporter
+
+	// Include, if set, only converts the files whose path under the input
+	// directory matches one of these globs, as FilterFiles matches them:
+	// "contracts/**/*.pdf", or "contracts" for every file under it
+	Include []string
+	// Exclude leaves out the files matching one of these globs
+	Exclude []string
+	// Exts, if set, only converts files with one of these extensions
+	// (".pdf" or "pdf"; case does not matter)
+	Exts []string
+
+	// ExtWorkers gives the files of an extension (".pdf" or "pdf") workers
+	// of their own, this many, instead of sharing the Workers of the rest:
+	// fewer for heavy formats, so they neither starve light ones nor run
+	// out of memory
+	ExtWorkers map[string]int
+}
+
+// inputFilter is the Include, Exclude and Exts of ProcessOptions, parsed
+type inputFilter struct {
+	include, exclude [][]string
+	exts             map[string]bool
+}
+
+// inputFilter parses the Include, Exclude and Exts globs
+func (o ProcessOptions) inputFilter() (*inputFilter, error) {
+	f := &inputFilter{exts: extensionSet(o.Exts)}
+	for _, list := range []struct {
+		globs []string
+		to    *[][]string
+	}{{o.Include, &f.include}, {o.Exclude, &f.exclude}} {
+		for _, glob := range list.globs {
+			pattern, err := splitPathGlob(glob)
+			if err != nil {
+				return nil, err
+			}
+			if pattern != nil {
+				*list.to = append(*list.to, pattern)
+			}
+		}
+	}
+	return f, nil
+}
+
+// matches reports whether the file at relPath, relative to the input
+// directory, is to be converted
+func (f *inputFilter) matches(relPath string) bool {
+	relPath = filepath.ToSlash(relPath)
+	if len(f.exts) > 0 && !f.exts[strings.ToLower(path.Ext(relPath))] {
+		return false
+	}
+	matchAny := func(patterns [][]string) bool {
+		for _, p := range patterns {
+			if matchPath(p, relPath) {
+				return true
+			}
+		}
+		return false
+	}
+	return (len(f.include) == 0 || matchAny(f.include)) && !matchAny(f.exclude)
+}
+
+// detectLanguage reports whether documents need language identification
+func (o ProcessOptions) detectLanguage() bool {
+	return o.DetectLanguage || len(o.Languages) > 0
+}
+
+// languageAllowed reports whether lang passes the Languages whitelist
+func (o ProcessOptions) languageAllowed(lang string) bool {
+	if len(o.Languages) == 0 {
+		return true
+	}
+	for _, l := range o.Languages {
+		if strings.EqualFold(l, lang) {
+			return true
+		}
+	}
+	return false
+}
+
+// runLogs are the channels feeding the log files in the output directory
+type runLogs struct {
+	ignored    chan<- string
+	errors     chan<- string
+	languages  chan<- string // "<source>\t<language>" lines for languages.txt
+	transcoded chan<- string // "<source>\t<encoding>" lines for transcoded.txt
+	ledger     chan<- LedgerEntry
+	progress   ProgressReporter
+
+	// done is the ledger as the run found it, nil if there was none
+	done map[string]LedgerEntry
+	// outcome collects what happens to the input file being converted
+	outcome *fileOutcome
+}
+
+// fail records a file that could not be converted in errors.txt and reports
+// it
+func (l runLogs) fail(path string, err error) {
+	l.errors <- fmt.Sprintf("%s: %v", path, err)
+	l.progress.OnError(path, err)
+	if l.outcome != nil && l.outcome.failed == nil {
+		l.outcome.failed = err
+	}
+}
+
+// ignore records a file or archive member left out in ignored.txt
+func (l runLogs) ignore(label, reason string) {
+	l.ignored <- fmt.Sprintf("%s: %s", label, reason)
+	if l.outcome != nil && l.outcome.ignored == "" {
+		l.outcome.ignored = reason
+	}
+}
+
+// wrote counts an output written for the input file being converted
+func (l runLogs) wrote() {
+	if l.outcome != nil {
+		l.outcome.written++
+	}
+}
+
+// RunProcess processes files from inputDir to outputDir with concurrent workers.
+// Once ctx is done no more files are started; those being converted are
+// finished and ctx.Err() is returned.
+func RunProcess(ctx context.Context, inputDir, outputDir string, opts ProcessOptions) error {
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
 		return fmt.Errorf("could not create output directory: %w", err)
 	}
 
+	logger.Info("Scanning input directory to count files", "input", inputDir)
+	allFiles, err := listInputFiles(inputDir, opts)
+	if err != nil {
+		return err
+	}
+
+	return processFiles(ctx, inputDir, outputDir, allFiles, opts)
+}
+
+// listInputFiles returns the files under inputDir that RunProcess converts:
+// all but hidden ones and those the filters of opts leave out
+func listInputFiles(inputDir string, opts ProcessOptions) ([]string, error) {
+	filter, err := opts.inputFilter()
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	err = filepath.Walk(inputDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if strings.HasPrefix(filepath.Base(path), ".") {
+			return nil
+		}
+		if rel, err := filepath.Rel(inputDir, path); err != nil || !filter.matches(rel) {
+			return nil
+		}
+		files = append(files, path)
+		return nil
+	})
+	return files, err
+}
+
+// processFiles converts allFiles, paths under inputDir, to outputDir with
+// concurrent workers, as RunProcess does
+func processFiles(ctx context.Context, inputDir, outputDir string, allFiles []string, opts ProcessOptions) error {
+	workers := opts.Workers
 	ignoredFile, err := os.OpenFile(filepath.Join(outputDir, "ignored.txt"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		return fmt.Errorf("setup logs: %w", err)
@@ -63,78 +257,111 @@ func RunProcess(inputDir, outputDir, processType string, workers int, replace bo
 
 	logIgnored := make(chan string, 1000)
 	logError := make(chan string, 1000)
-
+	logLanguage := make(chan string, 1000)
+	logTranscoded := make(chan string, 1000)
+	progress := opts.Progress
+	if progress == nil {
+		progress = reporter
+	}
+	done, err := LoadLedger(outputDir)
+	if err != nil {
+		return fmt.Errorf("could not read %s: %w", LedgerName, err)
+	}
+	ledgerFile, err := os.OpenFile(filepath.Join(outputDir, LedgerName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("setup logs: %w", err)
+	}
+	defer ledgerFile.Close()
+	logLedger := make(chan LedgerEntry, 1000)
+	logs := runLogs{ignored: logIgnored, errors: logError, languages: logLanguage, transcoded: logTranscoded,
+		ledger: logLedger, progress: progress, done: done}
+
+	// writers drains the log channels; they are closed and drained before
+	// returning, so no line is lost
+	var writers sync.WaitGroup
+	writers.Add(5)
 	go func() {
+		defer writers.Done()
 		for msg := range logIgnored {
 			ignoredFile.WriteString(msg + "\n")
+			logger.Debug("Ignored", "detail", msg)
 		}
 	}()
 	go func() {
+		defer writers.Done()
 		for msg := range logError {
 			errorsFile.WriteString(msg + "\n")
 		}
 	}()
-
-	fmt.Println("Scanning input directory to count files...")
-	var allFiles []string
-	err = filepath.Walk(inputDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return nil
+	// statuses counts the ledger entries of the run for its summary
+	statuses := make(map[string]int)
+	go func() {
+		defer writers.Done()
+		enc := json.NewEncoder(ledgerFile)
+		for e := range logLedger {
+			enc.Encode(e)
+			statuses[e.Status]++
 		}
-		if info.IsDir() {
-			return nil
+	}()
+
+	transcodedFile, err := os.OpenFile(filepath.Join(outputDir, "transcoded.txt"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("setup logs: %w", err)
+	}
+	defer transcodedFile.Close()
+	go func() {
+		defer writers.Done()
+		for msg := range logTranscoded {
+			transcodedFile.WriteString(msg + "\n")
 		}
-		if strings.HasPrefix(filepath.Base(path), ".") {
-			return nil
+	}()
+
+	var languagesFile *os.File
+	if opts.detectLanguage() {
+		languagesFile, err = os.OpenFile(filepath.Join(outputDir, "languages.txt"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("setup logs: %w", err)
 		}
-		allFiles = append(allFiles, path)
-		return nil
-	})
-	if err != nil {
-		return err
+		defer languagesFile.Close()
 	}
+	go func() {
+		defer writers.Done()
+		for msg := range logLanguage {
+			languagesFile.WriteString(msg + "\n")
+		}
+	}()
 
 	totalFiles := len(allFiles)
-	fmt.Printf("Found %d files. Starting processing with %d workers...\n", totalFiles, workers)
+	logger.Info("Found files; starting processing", "files", totalFiles, "workers", workers)
+	start := time.Now()
+	progress.OnStage("process")
 
-	jobs := make(chan Job, workers*2)
 	progressChan := make(chan bool, workers*2)
 	doneProcessing := make(chan struct{})
 
 	var wg sync.WaitGroup
 
-	for i := 0; i < workers; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for job := range jobs {
-				processFile(job.Path, inputDir, outputDir, processType, replace, logIgnored, logError)
-				progressChan <- true
-			}
-		}()
-	}
-
-	go func() {
-		var m runtime.MemStats
-		for index, path := range allFiles {
-			if ramLimit > 0 {
-				for {
-					runtime.ReadMemStats(&m)
-					if m.Alloc < ramLimit {
-						break
-					}
-					runtime.GC()
-					time.Sleep(100 * time.Millisecond)
+	for _, pool := range workerPools(allFiles, workers, opts.ExtWorkers) {
+		if pool.ext != "" {
+			logger.Debug("Extension workers", "ext", pool.ext, "files", len(pool.jobs), "workers", pool.workers)
+		}
+		jobs := make(chan Job, pool.workers*2)
+		for i := 0; i < pool.workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for job := range jobs {
+					processFile(job.Path, inputDir, outputDir, opts, logs)
+					progressChan <- true
 				}
-			}
-
-			jobs <- Job{Path: path, Index: index + 1}
+			}()
 		}
-		close(jobs)
-	}()
+		go feedJobs(ctx, pool.jobs, jobs, opts.RAMLimit)
+	}
 
+	finished := 0
 	go func() {
-		finished := 0
+		defer close(doneProcessing)
 		notifyStep := workers
 		if notifyStep < 1 {
 			notifyStep = 10
@@ -144,13 +371,8 @@ func RunProcess(inputDir, outputDir, processType string, workers int, replace bo
 			finished++
 			if finished%notifyStep == 0 || finished == totalFiles {
 				runtime.GC()
-				percent := float64(finished) / float64(totalFiles) * 100
-				fmt.Printf("Progress: %d / %d (%.1f%%)\n", finished, totalFiles, percent)
-			}
-			if finished == totalFiles {
-				close(doneProcessing)
-				return
 			}
+			progress.OnFile(finished, totalFiles)
 		}
 	}()
 
@@ -161,82 +383,274 @@ func RunProcess(inputDir, outputDir, processType string, workers int, replace bo
 
 	close(logIgnored)
 	close(logError)
-
-	fmt.Printf("\nSuccessfully converted files into directory: %s\n", outputDir)
+	close(logLanguage)
+	close(logTranscoded)
+	close(logLedger)
+	writers.Wait()
+
+	// Files the ledger showed done get no entry, so they are the finished
+	// files not counted in it
+	recorded := 0
+	for _, n := range statuses {
+		recorded += n
+	}
+	summary := []any{"output", outputDir, "files", totalFiles,
+		"converted", statuses[LedgerConverted], "ignored", statuses[LedgerIgnored],
+		"failed", statuses[LedgerFailed], "kept", statuses[LedgerExisting],
+		"skipped", finished - recorded, "duration", time.Since(start).Round(time.Millisecond)}
+	if err := ctx.Err(); err != nil {
+		logger.Warn("Processing stopped", append(summary, "remaining", totalFiles-finished)...)
+		return err
+	}
+	logger.Info("Processing finished", summary...)
 	return nil
 }
 
-func processFile(path, inputDir, outputDir, processType string, replace bool, logIgnored, logError chan<- string) {
+// processFile converts a file and records it in the ledger. Without
+// opts.Replace, resumeAction decides whether it is converted again.
+func processFile(path, inputDir, outputDir string, opts ProcessOptions, logs runLogs) {
+	var relPath string
+	var info os.FileInfo
+	start := time.Now()
 	defer func() {
 		if r := recover(); r != nil {
-			logError <- fmt.Sprintf("%s: PANIC during processing: %v", path, r)
+			logs.fail(path, fmt.Errorf("PANIC during processing: %v", r))
+		}
+		if logs.outcome != nil {
+			status, reason := logs.outcome.status()
+			logs.record(path, relPath, info, status, reason, time.Since(start))
 		}
 	}()
 
 	relPath, err := filepath.Rel(inputDir, path)
 	if err != nil {
-		logError <- fmt.Sprintf("%s: relative path error %v", path, err)
+		logs.fail(path, fmt.Errorf("relative path error %w", err))
 		return
 	}
-
-	outPath := filepath.Join(outputDir, relPath+".txt")
-
-	if !replace {
-		if _, err := os.Stat(outPath); err == nil {
+	info, _ = os.Stat(path)
+	outBase := filepath.Join(outputDir, relPath)
+	archive := opts.Archives && archiveKind(path) != ""
+	pst := strings.EqualFold(filepath.Ext(path), ".pst")
+
+	if !opts.Replace {
+		switch resumeAction(logs.done, path, relPath, outBase, info, archive || pst, opts) {
+		case resumeSkip:
+			return
+		case resumeKeep:
+			logs.record(path, relPath, info, LedgerExisting, "", 0)
 			return
+		case resumeReplace:
+			opts.Replace = true
 		}
 	}
+	logs.outcome = &fileOutcome{}
+
+	if archive {
+		processArchive(path, path, outBase, opts, 0, logs)
+		return
+	}
+
+	// Each message of a .pst becomes its own output under <file>.pst/
+	if pst {
+		processPST(path, outBase, opts, logs)
+		return
+	}
 
 	res, err := ExtractContent(path)
 	if err != nil {
-		if strings.Contains(err.Error(), "unsupported file extension") {
-			logIgnored <- fmt.Sprintf("%s: unsupported extension", path)
-			return
-		}
-		logError <- fmt.Sprintf("%s: extraction error: %v", path, err)
+		logExtractError(path, err, logs)
 		return
 	}
+	var meta os.FileInfo
+	if opts.Metadata {
+		meta = info
+	}
+	writeOutput(res, path, meta, outBase, opts, logs)
+}
 
-	outputText := res.FullText
+// pageOutputPath names the output of a 0-based page: file.pdf.page0001.txt
+func pageOutputPath(outBase string, page int) string {
+	return fmt.Sprintf("%s.page%04d.txt", outBase, page+1)
+}
 
-	switch processType {
-	case "token":
-		outputText = CleanToTokens(outputText)
-	case "lowercase":
-		outputText = CleanToLowerTokens(outputText)
+// outputExists reports whether outBase was already converted (per-page mode checks the first page)
+func outputExists(outBase string, opts ProcessOptions) bool {
+	outPath := outBase + ".txt"
+	if opts.Pages {
+		outPath = pageOutputPath(outBase, 0)
 	}
+	_, err := os.Stat(outPath)
+	return err == nil
+}
 
-	if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
-		logError <- fmt.Sprintf("%s: mkdir error: %v", path, err)
+// logExtractError routes an extraction failure to ignored.txt or errors.txt.
+// label identifies the source in the log line.
+func logExtractError(label string, err error, logs runLogs) {
+	if errors.Is(err, ErrUnsupportedExtension) {
+		logs.ignore(label, "unsupported extension")
 		return
 	}
-
-	if err := os.WriteFile(outPath, []byte(outputText), 0644); err != nil {
-		logError <- fmt.Sprintf("%s: write error: %v", path, err)
+	if errors.Is(err, ErrTooLarge) {
+		logs.ignore(label, err.Error())
 		return
 	}
+	logs.fail(label, fmt.Errorf("extraction error: %w", err))
 }
 
-// CleanToTokens removes all special characters, newlines, tabs, etc.
-// and returns only words separated by single spaces
-func CleanToTokens(text string) string {
-	text = strings.ReplaceAll(text, "\n", " ")
-	text = strings.ReplaceAll(text, "\r", " ")
-	text = strings.ReplaceAll(text, "\t", " ")
+// writeOutput applies the processing type to an extraction result and writes
+// it to outBase.txt, or to one outBase.pageNNNN.txt per page in per-page mode.
+// info describes the source file for the metadata sidecar and may be nil.
+func writeOutput(res *ExtractionResult, label string, info os.FileInfo, outBase string, opts ProcessOptions, logs runLogs) {
+	// Plain-text sources that were not UTF-8 are listed in transcoded.txt
+	if enc := res.Metadata[MetaEncoding]; enc != "" && enc != EncodingUTF8 {
+		logs.transcoded <- label + "\t" + enc
+	}
+
+	if opts.detectLanguage() {
+		lang := DetectLanguage(res.FullText)
+		logs.languages <- label + "\t" + lang
+		if !opts.languageAllowed(lang) {
+			logs.ignore(label, fmt.Sprintf("language %s not selected", lang))
+			return
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(outBase), 0755); err != nil {
+		logs.fail(label, fmt.Errorf("mkdir error: %w", err))
+		return
+	}
 
-	re := regexp.MustCompile(`[^a-zA-Z0-9\s]`)
-	text = re.ReplaceAllString(text, " ")
+	if opts.Metadata {
+		if err := writeMetadataSidecar(res, label, info, outBase); err != nil {
+			logs.fail(label, fmt.Errorf("metadata write error: %w", err))
+		}
+	}
 
-	spaceRe := regexp.MustCompile(`\s+`)
-	text = spaceRe.ReplaceAllString(text, " ")
+	if !opts.Pages {
+		outputText := cleanForType(res.FullText, opts)
+		if err := writeFileAtomic(outBase+".txt", []byte(outputText)); err != nil {
+			logs.fail(label, fmt.Errorf("write error: %w", err))
+			return
+		}
+		logs.wrote()
+		return
+	}
+
+	for i, page := range res.Pages {
+		outputText := cleanForType(page, opts)
+		if err := writeFileAtomic(pageOutputPath(outBase, i), []byte(outputText)); err != nil {
+			logs.fail(label, fmt.Errorf("write error (page %d): %w", i+1, err))
+			return
+		}
+	}
+	logs.wrote()
+}
 
-	text = strings.TrimSpace(text)
+// cleanForType applies the "token" or "lowercase" cleanup, the words of
+// Tokenize separated by spaces; "text" is returned unchanged. With
+// opts.Sentences every sentence goes on its own line, and opts.Placeholders
+// replaces numbers, dates, URLs and email addresses.
+func cleanForType(text string, opts ProcessOptions) string {
+	if opts.Sentences {
+		var lines []string
+		for _, sentence := range SplitSentences(text) {
+			if line := cleanForType(sentence, ProcessOptions{ProcessType: opts.ProcessType, Placeholders: opts.Placeholders}); line != "" {
+				lines = append(lines, line)
+			}
+		}
+		return strings.Join(lines, "\n")
+	}
 
+	if len(opts.Placeholders) > 0 && (opts.ProcessType == "token" || opts.ProcessType == "lowercase") {
+		return strings.Join(tokenizeWithPlaceholders(text, opts.Placeholders, opts.ProcessType == "lowercase"), " ")
+	}
+	switch opts.ProcessType {
+	case "token":
+		return strings.Join(Tokenize(text), " ")
+	case "lowercase":
+		return strings.ToLower(strings.Join(Tokenize(text), " "))
+	}
 	return text
 }
 
+// CleanToTokens removes all special characters, newlines, tabs, etc.
+// and returns only words separated by single spaces. It is the "ascii"
+// tokenizer whatever SetTokenizer set.
+func CleanToTokens(text string) string {
+	return strings.Join(asciiTokenizer.Tokenize(text), " ")
+}
+
 // CleanToLowerTokens is like CleanToTokens but also converts to lowercase
 func CleanToLowerTokens(text string) string {
 	text = CleanToTokens(text)
 	return strings.ToLower(text)
 }
+
+// workerPool is a share of the files of a run with the workers converting it
+type workerPool struct {
+	ext     string // the extension of ProcessOptions.ExtWorkers, "" for the rest
+	jobs    []Job
+	workers int
+}
+
+// workerPools gives the files of each extension of extWorkers a pool with
+// its count of workers, and the rest a pool with workers. Pools without
+// files are left out.
+func workerPools(files []string, workers int, extWorkers map[string]int) []workerPool {
+	limits := make(map[string]int, len(extWorkers))
+	for ext, n := range extWorkers {
+		limits[normalizeExt(ext)] = n
+	}
+	rest := &workerPool{workers: workers}
+	byExt := make(map[string]*workerPool)
+	pools := []*workerPool{rest}
+	for i, path := range files {
+		job := Job{Path: path, Index: i + 1}
+		ext := strings.ToLower(filepath.Ext(path))
+		n, ok := limits[ext]
+		if !ok || ext == "" {
+			rest.jobs = append(rest.jobs, job)
+			continue
+		}
+		pool := byExt[ext]
+		if pool == nil {
+			pool = &workerPool{ext: ext, workers: max(1, n)}
+			byExt[ext] = pool
+			pools = append(pools, pool)
+		}
+		pool.jobs = append(pool.jobs, job)
+	}
+
+	var out []workerPool
+	for _, pool := range pools {
+		if len(pool.jobs) > 0 {
+			out = append(out, *pool)
+		}
+	}
+	return out
+}
+
+// feedJobs sends jobs to ch until ctx is done, waiting while the heap is
+// above ramLimit (0 for no limit), then closes ch
+func feedJobs(ctx context.Context, jobs []Job, ch chan<- Job, ramLimit uint64) {
+	defer close(ch)
+	var m runtime.MemStats
+	for _, job := range jobs {
+		if ramLimit > 0 {
+			for ctx.Err() == nil {
+				runtime.ReadMemStats(&m)
+				if m.Alloc < ramLimit {
+					break
+				}
+				runtime.GC()
+				time.Sleep(100 * time.Millisecond)
+			}
+		}
+
+		select {
+		case ch <- job:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
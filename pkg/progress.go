@@ -0,0 +1,84 @@
+package pkg
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+// ProgressReporter receives the progress of RunProcess and the cache builds,
+// so an embedder can show it in its own UI. Its methods may be called from
+// several goroutines at once.
+type ProgressReporter interface {
+	// OnStage is called as a stage begins: "process", a cache step such as
+	// "tfidf", or one n of an n-gram build such as "ngramfreq 3-grams"
+	OnStage(stage string)
+	// OnFile is called after each file of the stage, with the files done and
+	// the files to do in all
+	OnFile(done, total int)
+	// OnError is called for a file that could not be converted; the run
+	// goes on
+	OnError(path string, err error)
+}
+
+// reporter receives the progress of the cache builds and, unless its options
+// name another, of RunProcess; SetProgressReporter replaces it
+var reporter ProgressReporter = NewConsoleProgress(1000)
+
+// SetProgressReporter sets where the cache builds and RunProcess report
+// their progress; nil restores the console
+func SetProgressReporter(r ProgressReporter) {
+	if r == nil {
+		r = NewConsoleProgress(1000)
+	}
+	reporter = r
+}
+
+// ConsoleProgress is the default ProgressReporter. It logs every stage,
+// the progress every so many files and at the end of a stage, and errors as
+// warnings.
+type ConsoleProgress struct {
+	every int
+
+	mu    sync.Mutex
+	stage string
+}
+
+// NewConsoleProgress returns a ConsoleProgress logging the progress every
+// every files
+func NewConsoleProgress(every int) *ConsoleProgress {
+	return &ConsoleProgress{every: max(every, 1)}
+}
+
+// OnStage logs the stage and reports the files of later calls under it
+func (p *ConsoleProgress) OnStage(stage string) {
+	p.mu.Lock()
+	p.stage = stage
+	p.mu.Unlock()
+	logger.Debug("Stage", "stage", stage)
+}
+
+// OnFile logs the files done every p.every files and when the last is done
+func (p *ConsoleProgress) OnFile(done, total int) {
+	if done%p.every != 0 && done != total {
+		return
+	}
+	p.mu.Lock()
+	stage := p.stage
+	p.mu.Unlock()
+	percent := 100.0
+	if total > 0 {
+		percent = math.Round(float64(done)/float64(total)*1000) / 10
+	}
+	logger.Info("Progress", "stage", stage, "files", done, "total", total, "percent", percent)
+}
+
+// OnError logs the file as a warning
+func (p *ConsoleProgress) OnError(path string, err error) {
+	logger.Warn("Could not convert", "file", path, "error", err)
+}
+
+// ngramStage names the stage of one n of an n-gram build
+func ngramStage(step string, n int) string {
+	return fmt.Sprintf("%s %d-grams", step, n)
+}
@@ -0,0 +1,103 @@
+package pkg
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ngramMinCount is how often an n-gram must occur to be written to
+// {n}gramfreq.txt
+var ngramMinCount = 2
+
+// ngramMinFiles is how many files an n-gram must occur in to be written to
+// the n-gram index
+var ngramMinFiles = 1
+
+// stopwords are matched case-insensitively against the vocabulary
+var stopwords map[string]bool
+
+// SetNgramMinCount sets how often an n-gram must occur to be kept in
+// {n}gramfreq.txt (default 2). {n}gramcounts.txt, kept for incremental
+// updates, is never pruned.
+func SetNgramMinCount(count int) {
+	ngramMinCount = max(1, count)
+}
+
+// SetNgramMinFiles sets how many files an n-gram must occur in to be kept in
+// the n-gram index (default 1). The frequency counts do not track files, so
+// it only applies to BuildNgramCache.
+func SetNgramMinFiles(files int) {
+	ngramMinFiles = max(1, files)
+}
+
+// SetStopwordFile loads a stopword list, one word per line ('#' starts a
+// comment), or the built-in list of a language like "en"; several can be
+// given separated by commas (see LoadStopwords). N-grams that begin or end
+// with a stopword are skipped while counting, so "of the" or "the cat" never
+// reach memory or disk while "end of the day" is kept. An empty path clears
+// the list.
+func SetStopwordFile(path string) error {
+	if path == "" {
+		stopwords = nil
+		return nil
+	}
+	words, err := LoadStopwords(path)
+	if err != nil {
+		return err
+	}
+	stopwords = words
+	return nil
+}
+
+// ngramFilter decides which n-grams the builders skip by their words
+type ngramFilter struct {
+	stop   []bool // indexed by word index
+	breaks bool   // windows crossing a sentenceBreak are skipped
+}
+
+// newNgramFilter resolves the stopword list against a vocabulary
+func newNgramFilter(wordToIndex map[string]int) *ngramFilter {
+	f := &ngramFilter{breaks: sentenceBoundaries}
+	if len(stopwords) == 0 {
+		return f
+	}
+	f.stop = make([]bool, len(wordToIndex))
+	matched := 0
+	for word, idx := range wordToIndex {
+		if idx < len(f.stop) && stopwords[strings.ToLower(word)] {
+			f.stop[idx] = true
+			matched++
+		}
+	}
+	logger.Info("Skipping n-grams that begin or end with a stopword", "stopwords", matched)
+	return f
+}
+
+func (f *ngramFilter) isStop(word int) bool {
+	return word >= 0 && word < len(f.stop) && f.stop[word]
+}
+
+// skip reports whether the n-gram words[i:i+n] is dropped
+func (f *ngramFilter) skip(words []int, i, n int) bool {
+	if f.breaks && crossesBreak(words, i, n) {
+		return true
+	}
+	return f.stop != nil && (f.isStop(words[i]) || f.isStop(words[i+n-1]))
+}
+
+// skipKey is skip for a "w1|w2|..." key
+func (f *ngramFilter) skipKey(key string) bool {
+	if f.stop == nil {
+		return false
+	}
+	first, last := key, key
+	if i := strings.IndexByte(key, '|'); i >= 0 {
+		first = key[:i]
+	}
+	if i := strings.LastIndexByte(key, '|'); i >= 0 {
+		last = key[i+1:]
+	}
+	a, errA := strconv.Atoi(first)
+	b, errB := strconv.Atoi(last)
+	return errA == nil && f.isStop(a) || errB == nil && f.isStop(b)
+}
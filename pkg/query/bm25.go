@@ -0,0 +1,175 @@
+package query
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/RoaringBitmap/roaring/v2"
+	"github.com/openfluke/tokentrove/pkg"
+)
+
+// Okapi BM25 parameters: k1 caps how much repeated occurrences add, b how
+// strongly scores are normalized by document length
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// SearchBM25 runs a query like Search but ranks the matching files by their
+// Okapi BM25 score over the query's words and phrases, a phrase counting as
+// one term. Document lengths come from stats.txt (-cache stats), without
+// which scores are not length-normalized; term frequencies come from
+// positions.bin or docs/, and are 1 per term without them.
+func (ix *Index) SearchBM25(q string) ([]Result, error) {
+	node, err := Parse(q)
+	if err != nil {
+		return nil, err
+	}
+	ix.lengthsOnce.Do(func() {
+		// Without stats.txt every file counts as average length
+		ix.lengths, _ = pkg.LoadDocLengths(ix.dir)
+		total := 0
+		for _, n := range ix.lengths {
+			total += n
+		}
+		ix.avgLen = 1
+		if len(ix.lengths) > 0 && total > 0 {
+			ix.avgLen = float64(total) / float64(len(ix.lengths))
+		}
+	})
+
+	files := float64(len(ix.files))
+	var idf []float64
+	results, err := ix.run(node, func(r *Result, terms []*Node, counts []int, sets []*roaring.Bitmap) {
+		if idf == nil {
+			idf = make([]float64, len(sets))
+			for i, set := range sets {
+				df := float64(set.GetCardinality())
+				idf[i] = math.Log(1 + (files-df+0.5)/(df+0.5))
+			}
+		}
+		length := ix.avgLen
+		if r.Index < len(ix.lengths) {
+			length = float64(ix.lengths[r.Index])
+		}
+		norm := bm25K1 * (1 - bm25B + bm25B*length/ix.avgLen)
+		for i, c := range counts {
+			tf := float64(c)
+			r.Score += idf[i] * tf * (bm25K1 + 1) / (tf + norm)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	return results, nil
+}
+
+// Excerpt is a passage of a file around a query match, split at the match
+// so it can be highlighted. Before starts and After ends with "..." where the
+// file goes on. Match is empty, and Offset -1, if no query term was found.
+type Excerpt struct {
+	Before string
+	Match  string
+	After  string
+	Offset int // word offset of Match in the file
+}
+
+// String returns the passage as plain text
+func (e *Excerpt) String() string {
+	var parts []string
+	for _, p := range []string{e.Before, e.Match, e.After} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Excerpt returns up to width words of file fileIdx around the first
+// occurrence of one of the query's words or phrases. The words come from
+// positions.bin or docs/, or else from the file's token file in the input
+// directory the cache was built from; it is nil if none of them is there.
+func (ix *Index) Excerpt(fileIdx int, q string, width int) (*Excerpt, error) {
+	node, err := Parse(q)
+	if err != nil {
+		return nil, err
+	}
+	seq, err := ix.fileSequence(fileIdx)
+	if err != nil || len(seq) == 0 {
+		return nil, err
+	}
+
+	var terms []*Node
+	collectTerms(node, &terms)
+	var phrases [][]int
+	for _, t := range terms {
+		phrases = append(phrases, ix.termIDs(t)...)
+	}
+	hit, hitLen := -1, 0
+	for off := range seq {
+		for _, ids := range phrases {
+			if matchesAt(seq, off, ids) {
+				hit, hitLen = off, len(ids)
+				break
+			}
+		}
+		if hitLen > 0 {
+			break
+		}
+	}
+
+	start := max(0, hit-(width-hitLen)/2)
+	end := min(len(seq), start+max(width, hitLen))
+	start = max(0, end-max(width, hitLen))
+	var before, match, after []string
+	if start > 0 {
+		before = append(before, "...")
+	}
+	for off := start; off < end; off++ {
+		id := seq[off]
+		if id < 0 || id >= len(ix.words) {
+			continue
+		}
+		switch {
+		case hit < 0 || off < hit:
+			before = append(before, ix.words[id])
+		case off < hit+hitLen:
+			match = append(match, ix.words[id])
+		default:
+			after = append(after, ix.words[id])
+		}
+	}
+	if end < len(seq) {
+		after = append(after, "...")
+	}
+	return &Excerpt{
+		Before: strings.Join(before, " "),
+		Match:  strings.Join(match, " "),
+		After:  strings.Join(after, " "),
+		Offset: hit,
+	}, nil
+}
+
+// Snippet returns Excerpt as plain text, or "" if there is none
+func (ix *Index) Snippet(fileIdx int, q string, width int) (string, error) {
+	e, err := ix.Excerpt(fileIdx, q, width)
+	if e == nil {
+		return "", err
+	}
+	return e.String(), nil
+}
+
+// matchesAt reports whether ids occur in seq starting at off
+func matchesAt(seq []int, off int, ids []int) bool {
+	if off+len(ids) > len(seq) {
+		return false
+	}
+	for i, id := range ids {
+		if seq[off+i] != id {
+			return false
+		}
+	}
+	return true
+}
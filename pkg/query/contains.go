@@ -0,0 +1,49 @@
+package query
+
+import (
+	"fmt"
+)
+
+// Containment is the answer to Contains. Exact is false when the sentence is
+// longer than the largest n-gram index and the cache has neither positions.bin
+// nor docs/, so files holding all of its n-grams apart are included too.
+type Containment struct {
+	Words   []string // the sentence as tokenized
+	Missing []string // words not in the vocabulary, so in no file
+	Exact   bool
+	Results []Result // most occurrences first
+}
+
+// Contains finds the files containing a sentence word for word. The sentence
+// is tokenized like process -type token with the cache's tokenizer, each word
+// looked up as written and then lower-cased, and the sequence matched as a
+// phrase.
+func (ix *Index) Contains(sentence string) (*Containment, error) {
+	words := ix.tokenize(sentence)
+	if len(words) == 0 {
+		return nil, fmt.Errorf("no words in %q", sentence)
+	}
+	c := &Containment{
+		Words: words,
+		Exact: len(words) == 1 || ix.positions != nil || ix.docs || len(words) <= ix.maxN,
+	}
+	for _, w := range words {
+		if _, ok := ix.wordID(w); !ok {
+			c.Missing = append(c.Missing, w)
+		}
+	}
+	if len(c.Missing) > 0 {
+		return c, nil
+	}
+
+	node := &Node{Op: OpPhrase, Words: words}
+	if len(words) == 1 {
+		node.Op = OpWord
+	}
+	results, err := ix.Run(node)
+	if err != nil {
+		return nil, err
+	}
+	c.Results = results
+	return c, nil
+}
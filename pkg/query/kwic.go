@@ -0,0 +1,114 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/RoaringBitmap/roaring/v2"
+)
+
+// Line is one occurrence of a word or phrase with the words around it. Offset
+// is where the match starts in the file, in words.
+type Line struct {
+	File   string
+	Index  int
+	Offset int
+	Left   string
+	Match  string
+	Right  string
+}
+
+// Concordance lists the occurrences of a word or phrase (a wildcard word
+// matches each word it stands for) with up to width words either side, in
+// file order, stopping after limit lines (0 = all). Files are picked from the
+// word index and read from positions.bin or docs/, one of which it needs.
+func (ix *Index) Concordance(phrase string, width, limit int) ([]Line, error) {
+	if ix.positions == nil && !ix.docs {
+		return nil, fmt.Errorf("a concordance needs positions.bin (run -cache index -positions) or docs/ (run -cache docs)")
+	}
+	// The phrase is split as the cache's token files were, so punctuation
+	// and case match; a wildcard, which the tokenizer would drop, only at
+	// white space
+	words := strings.Fields(phrase)
+	if !isPattern(phrase) {
+		words = ix.tokenize(phrase)
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("empty phrase")
+	}
+	// A word matches any of the words a wildcard stands for, a phrase its
+	// word indices in order
+	var files *roaring.Bitmap
+	var single map[int]bool
+	var phraseIDs []int
+	var err error
+	if len(words) > 1 {
+		if isPattern(phrase) {
+			return nil, fmt.Errorf("wildcards are not supported in phrases: %q", phrase)
+		}
+		ids, ok := ix.wordIDs(words)
+		if !ok {
+			return nil, nil
+		}
+		phraseIDs = ids
+		files, err = ix.phraseFiles(words)
+	} else {
+		single = make(map[int]bool)
+		for _, id := range ix.MatchWords(words[0]) {
+			single[id] = true
+		}
+		files, err = ix.wordFiles(words[0])
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []Line
+	it := files.Iterator()
+	for it.HasNext() {
+		f := int(it.Next())
+		if f >= len(ix.files) {
+			continue
+		}
+		seq, err := ix.fileSequence(f)
+		if err != nil {
+			return nil, err
+		}
+		for off := range seq {
+			var end int
+			if single != nil {
+				if !single[seq[off]] {
+					continue
+				}
+				end = off + 1
+			} else if matchesAt(seq, off, phraseIDs) {
+				end = off + len(phraseIDs)
+			} else {
+				continue
+			}
+			lines = append(lines, Line{
+				File:   ix.files[f],
+				Index:  f,
+				Offset: off,
+				Left:   ix.joinWords(seq[max(0, off-width):off]),
+				Match:  ix.joinWords(seq[off:end]),
+				Right:  ix.joinWords(seq[end:min(len(seq), end+width)]),
+			})
+			if limit > 0 && len(lines) >= limit {
+				return lines, nil
+			}
+		}
+	}
+	return lines, nil
+}
+
+// joinWords joins the words of a run of word indices with spaces
+func (ix *Index) joinWords(ids []int) string {
+	words := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id >= 0 && id < len(ix.words) {
+			words = append(words, ix.words[id])
+		}
+	}
+	return strings.Join(words, " ")
+}
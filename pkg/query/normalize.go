@@ -0,0 +1,162 @@
+package query
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/openfluke/tokentrove/pkg"
+)
+
+// maxPhraseVariants caps the spellings a phrase is expanded to, taken in
+// vocabulary order of each word's variants
+const maxPhraseVariants = 64
+
+// maxPatternVariants caps the words a wildcard is expanded to
+const maxPatternVariants = 1000
+
+// normVocab groups the vocabulary by normalized form (normuniq.txt)
+type normVocab struct {
+	mode  pkg.Normalization
+	forms *vocab  // the distinct normalized forms
+	words [][]int // word indices of forms.words[i]
+	index map[string]int
+}
+
+// loadNorm reads normuniq.txt once
+func (ix *Index) loadNorm() (*normVocab, error) {
+	ix.normOnce.Do(func() {
+		if ix.normErr = pkg.VerifyCache(ix.dir, false, pkg.StepNormalize); ix.normErr != nil {
+			return
+		}
+		mode, forms, err := pkg.LoadNormalizedVocab(ix.dir)
+		if err != nil {
+			ix.normErr = fmt.Errorf("could not read %s (run -cache normalize first): %w", pkg.NormVocabName, err)
+			return
+		}
+		if len(forms) != len(ix.words) {
+			ix.normErr = fmt.Errorf("%s has %d words and uniq.txt %d (re-run -cache normalize)", pkg.NormVocabName, len(forms), len(ix.words))
+			return
+		}
+		nv := &normVocab{mode: mode, index: make(map[string]int)}
+		var distinct []string
+		for id, form := range forms {
+			i, ok := nv.index[form]
+			if !ok {
+				i = len(distinct)
+				nv.index[form] = i
+				distinct = append(distinct, form)
+				nv.words = append(nv.words, nil)
+			}
+			nv.words[i] = append(nv.words[i], id)
+		}
+		nv.forms = newVocab(distinct)
+		ix.norm = nv
+	})
+	return ix.norm, ix.normErr
+}
+
+// Variants returns the vocabulary words with the same normalized form as
+// word, in vocabulary order, or for a wildcard the words whose normalized
+// form matches the normalized pattern. The cache needs normuniq.txt
+// (-cache normalize).
+func (ix *Index) Variants(word string) ([]string, error) {
+	nv, err := ix.loadNorm()
+	if err != nil {
+		return nil, err
+	}
+	form := nv.mode.Apply(word)
+	var forms []int
+	if isPattern(word) {
+		forms = nv.forms.match(form)
+	} else if i, ok := nv.index[form]; ok {
+		forms = []int{i}
+	}
+	var ids []int
+	for _, i := range forms {
+		ids = append(ids, nv.words[i]...)
+	}
+	slices.Sort(ids)
+	variants := make([]string, len(ids))
+	for i, id := range ids {
+		variants[i] = ix.words[id]
+	}
+	return variants, nil
+}
+
+// Normalize returns the query with every word replaced by the OR of its
+// variants (see Variants) and every phrase by the OR of the phrases their
+// variants spell, up to maxPhraseVariants. "invoice" then matches
+// "Invoice" and "INVOICE", and with accent stripping "cafe" matches "café".
+// Words without variants are kept as written.
+func (ix *Index) Normalize(node *Node) (*Node, error) {
+	switch node.Op {
+	case OpWord:
+		variants, err := ix.quotableVariants(node.Words[0])
+		if err != nil || len(variants) == 0 {
+			return node, err
+		}
+		if isPattern(node.Words[0]) && len(variants) > maxPatternVariants {
+			variants = variants[:maxPatternVariants]
+		}
+		return anyOf(variants, func(v string) *Node { return &Node{Op: OpWord, Words: []string{v}} }), nil
+	case OpPhrase:
+		spellings := [][]string{nil}
+		for _, w := range node.Words {
+			variants, err := ix.quotableVariants(w)
+			if err != nil {
+				return nil, err
+			}
+			if len(variants) == 0 {
+				variants = []string{w}
+			}
+			var next [][]string
+			for _, s := range spellings {
+				for _, v := range variants {
+					if len(next) < maxPhraseVariants {
+						next = append(next, append(s[:len(s):len(s)], v))
+					}
+				}
+			}
+			spellings = next
+		}
+		return anyOf(spellings, func(s []string) *Node { return &Node{Op: OpPhrase, Words: s} }), nil
+	}
+	children := make([]*Node, len(node.Children))
+	for i, c := range node.Children {
+		n, err := ix.Normalize(c)
+		if err != nil {
+			return nil, err
+		}
+		children[i] = n
+	}
+	return &Node{Op: node.Op, Children: children}, nil
+}
+
+// quotableVariants are the Variants that survive being written back into a
+// query string: without quotes, wildcards or spaces
+func (ix *Index) quotableVariants(word string) ([]string, error) {
+	variants, err := ix.Variants(word)
+	if err != nil {
+		return nil, err
+	}
+	kept := variants[:0]
+	for _, v := range variants {
+		if !strings.ContainsAny(v, "\"* \t\r\n") {
+			kept = append(kept, v)
+		}
+	}
+	return kept, nil
+}
+
+// anyOf is the OR of a node per item, or the one node
+func anyOf[T any](items []T, node func(T) *Node) *Node {
+	if len(items) == 1 {
+		return node(items[0])
+	}
+	or := &Node{Op: OpOr}
+	for _, item := range items {
+		or.Children = append(or.Children, node(item))
+	}
+	return or
+}
@@ -0,0 +1,331 @@
+// Package query runs boolean and phrase queries against a cache directory.
+//
+// A query is a sequence of words and quoted phrases combined with AND, OR and
+// NOT (upper case; lower-case "and", "or" and "not" are ordinary words) and
+// grouped with parentheses. Terms next to each other are ANDed, and AND binds
+// tighter than OR:
+//
+//	budget "fiscal year" OR (audit NOT internal)
+//
+// A * in a word matches any run of characters, so "transa*" finds every word
+// starting with transa. Phrases cannot hold wildcards.
+package query
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/openfluke/tokentrove/pkg"
+)
+
+// Op is the kind of a query node
+type Op int
+
+const (
+	OpWord Op = iota
+	OpPhrase
+	OpAnd
+	OpOr
+	OpNot
+)
+
+// Node is one node of a parsed query. Words holds the word of an OpWord and
+// the words of an OpPhrase; the other ops have Children.
+type Node struct {
+	Op       Op
+	Words    []string
+	Children []*Node
+}
+
+// String writes the node back as a fully parenthesized query. Words that
+// would read as an operator or a parenthesis are quoted.
+func (n *Node) String() string {
+	switch n.Op {
+	case OpWord:
+		if w := n.Words[0]; w == "AND" || w == "OR" || w == "NOT" || strings.ContainsAny(w, "()") {
+			return `"` + w + `"`
+		}
+		return n.Words[0]
+	case OpPhrase:
+		return `"` + strings.Join(n.Words, " ") + `"`
+	case OpNot:
+		return "NOT " + n.Children[0].String()
+	}
+	parts := make([]string, len(n.Children))
+	for i, c := range n.Children {
+		parts[i] = c.String()
+	}
+	sep := " AND "
+	if n.Op == OpOr {
+		sep = " OR "
+	}
+	return "(" + strings.Join(parts, sep) + ")"
+}
+
+// WithoutStopwords returns the query with the words stop reports true for
+// (given lower-cased) taken out of its AND and OR groups, so "the invoice"
+// matches every file with "invoice". Phrases and NOT keep their words. If
+// every term is a stopword the query is returned unchanged.
+func WithoutStopwords(node *Node, stop func(string) bool) *Node {
+	if pruned := withoutStopwords(node, stop); pruned != nil {
+		return pruned
+	}
+	return node
+}
+
+// withoutStopwords returns nil when nothing of node is left
+func withoutStopwords(node *Node, stop func(string) bool) *Node {
+	switch node.Op {
+	case OpWord:
+		if stop(strings.ToLower(node.Words[0])) {
+			return nil
+		}
+	case OpAnd, OpOr:
+		var children []*Node
+		for _, c := range node.Children {
+			if c = withoutStopwords(c, stop); c != nil {
+				children = append(children, c)
+			}
+		}
+		switch len(children) {
+		case 0:
+			return nil
+		case 1:
+			return children[0]
+		}
+		return &Node{Op: node.Op, Children: children}
+	}
+	return node
+}
+
+// token kinds of the query lexer
+const (
+	tokWord = iota
+	tokPhrase
+	tokAnd
+	tokOr
+	tokNot
+	tokOpen
+	tokClose
+)
+
+type token struct {
+	kind  int
+	words []string
+}
+
+// PhraseQuery returns text as the query for one phrase, split into words the
+// way process -type token splits them (pkg.Tokenize): an OpPhrase, an OpWord
+// for one word, or nil if text has none
+func PhraseQuery(text string) *Node {
+	words := pkg.Tokenize(text)
+	switch len(words) {
+	case 0:
+		return nil
+	case 1:
+		return &Node{Op: OpWord, Words: words}
+	}
+	return &Node{Op: OpPhrase, Words: words}
+}
+
+// Parse parses a query string
+func Parse(q string) (*Node, error) {
+	tokens, err := lex(q)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty query")
+	}
+	p := &parser{tokens: tokens}
+	node, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %s", p.describe())
+	}
+	return node, nil
+}
+
+// phraseWords splits the text of a quoted phrase with pkg.SplitWords, or at
+// white space when it has a wildcard the tokenizer would drop
+func phraseWords(text string) []string {
+	if strings.Contains(text, "*") {
+		return strings.Fields(text)
+	}
+	return pkg.SplitWords(text)
+}
+
+// lex splits a query into words, phrases, operators and parentheses
+func lex(q string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(q); {
+		switch c := q[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokOpen})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokClose})
+			i++
+		case c == '"':
+			end := strings.IndexByte(q[i+1:], '"')
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated phrase at %q", q[i:])
+			}
+			words := phraseWords(q[i+1 : i+1+end])
+			if len(words) == 0 {
+				return nil, fmt.Errorf("empty phrase")
+			}
+			if len(words) > 1 && strings.Contains(q[i+1:i+1+end], "*") {
+				return nil, fmt.Errorf("wildcards are not supported in phrases: %s", q[i:i+2+end])
+			}
+			tokens = append(tokens, token{kind: tokPhrase, words: words})
+			i += end + 2
+		default:
+			start := i
+			for i < len(q) && !strings.ContainsRune(" \t\n\r()\"", rune(q[i])) {
+				i++
+			}
+			word := q[start:i]
+			switch word {
+			case "AND":
+				tokens = append(tokens, token{kind: tokAnd})
+			case "OR":
+				tokens = append(tokens, token{kind: tokOr})
+			case "NOT":
+				tokens = append(tokens, token{kind: tokNot})
+			default:
+				// A tokenizer can cut one word into several, such as the
+				// character pairs of Chinese, which are then a phrase
+				switch words := phraseWords(word); {
+				case len(words) > 1:
+					tokens = append(tokens, token{kind: tokPhrase, words: words})
+				case len(words) == 1:
+					tokens = append(tokens, token{kind: tokWord, words: words})
+				default:
+					tokens = append(tokens, token{kind: tokWord, words: []string{word}})
+				}
+			}
+		}
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() int {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos].kind
+	}
+	return -1
+}
+
+func (p *parser) describe() string {
+	if p.pos >= len(p.tokens) {
+		return "end of query"
+	}
+	switch t := p.tokens[p.pos]; t.kind {
+	case tokWord:
+		return fmt.Sprintf("%q", t.words[0])
+	case tokPhrase:
+		return fmt.Sprintf("%q", strings.Join(t.words, " "))
+	case tokAnd:
+		return "AND"
+	case tokOr:
+		return "OR"
+	case tokNot:
+		return "NOT"
+	case tokOpen:
+		return "("
+	default:
+		return ")"
+	}
+}
+
+// or := and ("OR" and)*
+func (p *parser) or() (*Node, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	children := []*Node{left}
+	for p.peek() == tokOr {
+		p.pos++
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, right)
+	}
+	if len(children) == 1 {
+		return left, nil
+	}
+	return &Node{Op: OpOr, Children: children}, nil
+}
+
+// and := unary (["AND"] unary)*
+func (p *parser) and() (*Node, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	children := []*Node{left}
+	for {
+		switch p.peek() {
+		case tokAnd:
+			p.pos++
+		case tokWord, tokPhrase, tokNot, tokOpen:
+		default:
+			if len(children) == 1 {
+				return left, nil
+			}
+			return &Node{Op: OpAnd, Children: children}, nil
+		}
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, right)
+	}
+}
+
+// unary := "NOT" unary | word | phrase | "(" or ")"
+func (p *parser) unary() (*Node, error) {
+	switch p.peek() {
+	case tokNot:
+		p.pos++
+		child, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &Node{Op: OpNot, Children: []*Node{child}}, nil
+	case tokWord:
+		p.pos++
+		return &Node{Op: OpWord, Words: p.tokens[p.pos-1].words}, nil
+	case tokPhrase:
+		p.pos++
+		words := p.tokens[p.pos-1].words
+		if len(words) == 1 {
+			return &Node{Op: OpWord, Words: words}, nil
+		}
+		return &Node{Op: OpPhrase, Words: words}, nil
+	case tokOpen:
+		p.pos++
+		node, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != tokClose {
+			return nil, fmt.Errorf("expected ) but found %s", p.describe())
+		}
+		p.pos++
+		return node, nil
+	}
+	return nil, fmt.Errorf("expected a word, phrase or ( but found %s", p.describe())
+}
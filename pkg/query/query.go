@@ -0,0 +1,551 @@
+package query
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/RoaringBitmap/roaring/v2"
+	"github.com/openfluke/tokentrove/pkg"
+)
+
+// Index answers queries from the files of one cache directory. Words are
+// looked up in fileuniqindex.txt (through fileuniqindex.bin when present).
+// Phrases are matched exactly, and occurrences counted, with positions.bin or
+// else the docs/ ID streams. Without either, phrases are looked up in the
+// n-gram index of their length; a phrase longer than the largest n-gram
+// index matches files containing all of its n-grams, which can include files
+// where they are not consecutive. An Index is safe for concurrent use.
+type Index struct {
+	dir       string
+	words     []string
+	wordIdx   map[string]int
+	vocab     *vocab
+	files     []string
+	postings  *pkg.Postings     // nil if the cache has no fileuniqindex.bin
+	text      []*roaring.Bitmap // fileuniqindex.txt, read when postings is nil
+	positions *pkg.Positions    // nil if the cache has no positions.bin
+	docs      bool              // the cache has docs/ ID streams
+	maxN      int               // largest n with an n-gram index
+	tokenizer pkg.Tokenizer     // of the tokens step; nil for the defaults
+	stemmer   pkg.Stemmer       // of the tokens step; nil if it did not stem
+
+	lengthsOnce sync.Once
+	lengths     []int   // token count per file from stats.txt, loaded by SearchBM25
+	avgLen      float64 // mean of lengths
+
+	normOnce sync.Once
+	norm     *normVocab // normuniq.txt, loaded by Normalize
+	normErr  error
+}
+
+// Result is one matching file. Hits is the number of occurrences of the
+// query's words and phrases if the cache has positions.bin or docs/, and the
+// number of its distinct words and phrases the file contains otherwise.
+// Score is the BM25 score of SearchBM25.
+type Result struct {
+	File  string
+	Index int
+	Hits  int
+	Score float64
+}
+
+// Open loads the vocabulary and file list of a cache and opens its indexes
+func Open(cacheDir string) (*Index, error) {
+	cache, err := pkg.OpenCache(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	ix := &Index{dir: cacheDir, wordIdx: make(map[string]int)}
+	words, err := cache.WordIndex()
+	if err != nil {
+		return nil, err
+	}
+	ix.words = words
+	for i, w := range words {
+		ix.wordIdx[w] = i
+	}
+	ix.vocab = newVocab(words)
+	if ix.files, err = cache.Files(); err != nil {
+		return nil, err
+	}
+
+	indexPath := filepath.Join(cacheDir, "fileuniqindex.txt")
+	if ix.postings, err = pkg.OpenPostings(pkg.PostingsPath(indexPath)); err != nil {
+		if ix.text, err = readIndex(indexPath, len(words)); err != nil {
+			return nil, fmt.Errorf("could not read fileuniqindex.txt (run -cache index first): %w", err)
+		}
+	}
+	if p, err := pkg.OpenPositions(cacheDir); err == nil {
+		ix.positions = p
+	} else if !errors.Is(err, os.ErrNotExist) {
+		ix.Close()
+		return nil, err
+	}
+	_, err = os.Stat(pkg.DocIDsPath(cacheDir, 0))
+	ix.docs = err == nil
+	if ix.tokenizer, err = pkg.CacheTokenizer(cacheDir); err != nil && !errors.Is(err, os.ErrNotExist) {
+		ix.Close()
+		return nil, err
+	}
+	if ix.stemmer, err = pkg.CacheStemmer(cacheDir); err != nil && !errors.Is(err, os.ErrNotExist) {
+		ix.Close()
+		return nil, err
+	}
+	for n := 2; len(pkg.NgramIndexParts(cacheDir, n)) > 0; n++ {
+		ix.maxN = n
+	}
+	return ix, nil
+}
+
+// Tokenizer returns the tokenizer the cache was built with, recorded in its
+// settings.txt, or nil for the defaults
+func (ix *Index) Tokenizer() pkg.Tokenizer {
+	return ix.tokenizer
+}
+
+// tokenize splits text into words the way the cache's token files were:
+// with its tokenizer, or as process -type token does without one
+func (ix *Index) tokenize(text string) []string {
+	if ix.tokenizer == nil {
+		return strings.Fields(pkg.CleanToTokens(text))
+	}
+	return ix.tokenizer.Tokenize(text)
+}
+
+// CountsHits reports whether Result.Hits counts occurrences, the cache having
+// positions.bin or docs/, rather than the terms a file contains
+func (ix *Index) CountsHits() bool {
+	return ix.positions != nil || ix.docs
+}
+
+// Close closes the index files
+func (ix *Index) Close() error {
+	if ix.postings != nil {
+		ix.postings.Close()
+	}
+	if ix.positions != nil {
+		ix.positions.Close()
+	}
+	return nil
+}
+
+// Search parses and runs a query, returning the matching files with the most
+// hits first
+func (ix *Index) Search(q string) ([]Result, error) {
+	node, err := Parse(q)
+	if err != nil {
+		return nil, err
+	}
+	return ix.Run(node)
+}
+
+// Run runs a parsed query
+func (ix *Index) Run(node *Node) ([]Result, error) {
+	results, err := ix.run(node, nil)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Hits > results[j].Hits })
+	return results, nil
+}
+
+// run evaluates node and counts the hits of every matching file. score, if
+// set, is called with each file's per-term counts and the file sets of the
+// terms.
+func (ix *Index) run(node *Node, score func(r *Result, terms []*Node, counts []int, sets []*roaring.Bitmap)) ([]Result, error) {
+	e := &evaluator{ix: ix, sets: make(map[*Node]*roaring.Bitmap)}
+	matches, err := e.eval(node)
+	if err != nil {
+		return nil, err
+	}
+
+	var terms []*Node
+	collectTerms(node, &terms)
+	sets := make([]*roaring.Bitmap, len(terms))
+	for i, t := range terms {
+		sets[i] = e.sets[t]
+	}
+	results := make([]Result, 0, matches.GetCardinality())
+	it := matches.Iterator()
+	for it.HasNext() {
+		f := int(it.Next())
+		if f >= len(ix.files) {
+			continue
+		}
+		counts, err := ix.termCounts(f, terms, sets)
+		if err != nil {
+			return nil, err
+		}
+		r := Result{File: ix.files[f], Index: f}
+		for _, c := range counts {
+			r.Hits += c
+		}
+		if score != nil {
+			score(&r, terms, counts, sets)
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// collectTerms appends the words and phrases of node that are not negated
+func collectTerms(node *Node, terms *[]*Node) {
+	switch node.Op {
+	case OpWord, OpPhrase:
+		*terms = append(*terms, node)
+	case OpAnd, OpOr:
+		for _, c := range node.Children {
+			collectTerms(c, terms)
+		}
+	}
+}
+
+// evaluator runs one query, remembering the file set of every term
+type evaluator struct {
+	ix   *Index
+	sets map[*Node]*roaring.Bitmap
+}
+
+func (e *evaluator) eval(node *Node) (*roaring.Bitmap, error) {
+	switch node.Op {
+	case OpWord:
+		set, err := e.ix.wordFiles(node.Words[0])
+		e.sets[node] = set
+		return set, err
+	case OpPhrase:
+		set, err := e.ix.phraseFiles(node.Words)
+		e.sets[node] = set
+		return set, err
+	case OpNot:
+		child, err := e.eval(node.Children[0])
+		if err != nil {
+			return nil, err
+		}
+		return roaring.AndNot(e.ix.all(), child), nil
+	case OpOr:
+		result := roaring.New()
+		for _, c := range node.Children {
+			set, err := e.eval(c)
+			if err != nil {
+				return nil, err
+			}
+			result.Or(set)
+		}
+		return result, nil
+	}
+
+	// AND: intersect the positive children, then subtract the negated ones
+	var result *roaring.Bitmap
+	var excluded []*roaring.Bitmap
+	for _, c := range node.Children {
+		if c.Op == OpNot {
+			set, err := e.eval(c.Children[0])
+			if err != nil {
+				return nil, err
+			}
+			excluded = append(excluded, set)
+			continue
+		}
+		set, err := e.eval(c)
+		if err != nil {
+			return nil, err
+		}
+		if result == nil {
+			result = set.Clone()
+		} else {
+			result.And(set)
+		}
+	}
+	if result == nil {
+		result = e.ix.all()
+	}
+	for _, set := range excluded {
+		result.AndNot(set)
+	}
+	return result, nil
+}
+
+// termCounts returns how often each term occurs in file f, or without
+// positions.bin and docs/ whether its file set has f
+func (ix *Index) termCounts(f int, terms []*Node, sets []*roaring.Bitmap) ([]int, error) {
+	counts := make([]int, len(terms))
+	positions, err := ix.fileWords(f)
+	if err != nil {
+		return nil, err
+	}
+	for i, t := range terms {
+		if positions == nil {
+			if sets[i].Contains(uint32(f)) {
+				counts[i] = 1
+			}
+			continue
+		}
+		for _, ids := range ix.termIDs(t) {
+			if len(ids) == 1 {
+				counts[i] += len(positions[ids[0]])
+			} else {
+				counts[i] += phraseCount(positions, ids)
+			}
+		}
+	}
+	return counts, nil
+}
+
+// fileWords returns the offsets of every word in file f, from positions.bin
+// or the file's ID stream; nil if the cache has neither
+func (ix *Index) fileWords(f int) (map[int][]uint32, error) {
+	if ix.positions != nil {
+		return ix.positions.File(f)
+	}
+	if !ix.docs {
+		return nil, nil
+	}
+	ids, err := pkg.ReadDocIDs(ix.dir, f)
+	if err != nil {
+		return nil, err
+	}
+	positions := make(map[int][]uint32)
+	for off, id := range ids {
+		positions[id] = append(positions[id], uint32(off))
+	}
+	return positions, nil
+}
+
+// fileSequence returns the word indices of file f in order, from
+// positions.bin, docs/ or else the token file the cache was built from
+func (ix *Index) fileSequence(f int) ([]int, error) {
+	if ix.positions != nil {
+		return ix.positions.Words(f)
+	}
+	if ix.docs {
+		return pkg.ReadDocIDs(ix.dir, f)
+	}
+	if f < 0 || f >= len(ix.files) {
+		return nil, fmt.Errorf("no file %d in the cache", f)
+	}
+	return pkg.ReadTokenWords(ix.dir, ix.files[f], ix.wordIdx)
+}
+
+// FileWords returns the words of file f in order, as the cache tokenized it
+func (ix *Index) FileWords(f int) ([]string, error) {
+	ids, err := ix.fileSequence(f)
+	if err != nil {
+		return nil, err
+	}
+	words := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id >= 0 && id < len(ix.words) {
+			words = append(words, ix.words[id])
+		}
+	}
+	return words, nil
+}
+
+// phraseCount counts where ids occur consecutively in a file's positions
+func phraseCount(positions map[int][]uint32, ids []int) int {
+	count := 0
+	for _, start := range positions[ids[0]] {
+		ok := true
+		for i, id := range ids[1:] {
+			offsets := positions[id]
+			want := start + uint32(i+1)
+			j := sort.Search(len(offsets), func(k int) bool { return offsets[k] >= want })
+			if j == len(offsets) || offsets[j] != want {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			count++
+		}
+	}
+	return count
+}
+
+// all returns every file of the cache
+func (ix *Index) all() *roaring.Bitmap {
+	set := roaring.New()
+	set.AddRange(0, uint64(len(ix.files)))
+	return set
+}
+
+// wordID looks a word up as written, then lower-cased, or by its stem in a
+// stemmed cache
+func (ix *Index) wordID(word string) (int, bool) {
+	if ix.stemmer != nil {
+		id, ok := ix.wordIdx[ix.stemmer.Stem(word)]
+		return id, ok
+	}
+	if id, ok := ix.wordIdx[word]; ok {
+		return id, true
+	}
+	id, ok := ix.wordIdx[strings.ToLower(word)]
+	return id, ok
+}
+
+// MatchWords returns the uniq.txt indices of the words matching a wildcard
+// pattern, in order, matching as written and then lower-cased like other
+// query words. A pattern without * matches only itself.
+func (ix *Index) MatchWords(pattern string) []int {
+	if !isPattern(pattern) {
+		if id, ok := ix.wordID(pattern); ok {
+			return []int{id}
+		}
+		return nil
+	}
+	ids := ix.vocab.match(pattern)
+	if lower := strings.ToLower(pattern); len(ids) == 0 && lower != pattern {
+		ids = ix.vocab.match(lower)
+	}
+	return ids
+}
+
+// termIDs returns the word indices of a word or phrase term, one list per
+// word a wildcard matches
+func (ix *Index) termIDs(t *Node) [][]int {
+	if t.Op == OpWord {
+		var alts [][]int
+		for _, id := range ix.MatchWords(t.Words[0]) {
+			alts = append(alts, []int{id})
+		}
+		return alts
+	}
+	if ids, ok := ix.wordIDs(t.Words); ok {
+		return [][]int{ids}
+	}
+	return nil
+}
+
+// Word returns word i of uniq.txt
+func (ix *Index) Word(i int) string {
+	return ix.words[i]
+}
+
+// wordIDs looks up every word; ok is false if one is not in the vocabulary
+func (ix *Index) wordIDs(words []string) ([]int, bool) {
+	ids := make([]int, len(words))
+	for i, w := range words {
+		id, ok := ix.wordID(w)
+		if !ok {
+			return nil, false
+		}
+		ids[i] = id
+	}
+	return ids, true
+}
+
+// wordFiles returns the files containing word, or any word a wildcard
+// matches
+func (ix *Index) wordFiles(word string) (*roaring.Bitmap, error) {
+	result := roaring.New()
+	for _, id := range ix.MatchWords(word) {
+		set, err := ix.idFiles(id)
+		if err != nil {
+			return nil, err
+		}
+		result.Or(set)
+	}
+	return result, nil
+}
+
+func (ix *Index) idFiles(id int) (*roaring.Bitmap, error) {
+	if ix.postings != nil {
+		if id >= ix.postings.Len() {
+			return roaring.New(), nil
+		}
+		return ix.postings.Get(id)
+	}
+	if id >= len(ix.text) || ix.text[id] == nil {
+		return roaring.New(), nil
+	}
+	return ix.text[id].Clone(), nil
+}
+
+// phraseFiles returns the files containing words as a phrase
+func (ix *Index) phraseFiles(words []string) (*roaring.Bitmap, error) {
+	ids, ok := ix.wordIDs(words)
+	if !ok {
+		return roaring.New(), nil
+	}
+
+	if ix.positions != nil || ix.docs {
+		var candidates *roaring.Bitmap
+		for _, id := range ids {
+			set, err := ix.idFiles(id)
+			if err != nil {
+				return nil, err
+			}
+			if candidates == nil {
+				candidates = set
+			} else {
+				candidates.And(set)
+			}
+		}
+		result := roaring.New()
+		it := candidates.Iterator()
+		for it.HasNext() {
+			f := it.Next()
+			if int(f) >= len(ix.files) {
+				continue
+			}
+			positions, err := ix.fileWords(int(f))
+			if err != nil {
+				return nil, err
+			}
+			if phraseCount(positions, ids) > 0 {
+				result.Add(f)
+			}
+		}
+		return result, nil
+	}
+
+	if ix.maxN < 2 {
+		return nil, fmt.Errorf("phrase %q needs positions.bin (-cache index -positions), docs/ (-cache docs) or an n-gram index (-cache ngrams)",
+			strings.Join(words, " "))
+	}
+	n := min(len(ids), ix.maxN)
+	var result *roaring.Bitmap
+	for start := 0; start+n <= len(ids); start++ {
+		set, err := pkg.LookupNgram(ix.dir, ids[start:start+n])
+		if err != nil {
+			return nil, err
+		}
+		if result == nil {
+			result = set
+		} else {
+			result.And(set)
+		}
+		if result.IsEmpty() {
+			break
+		}
+	}
+	return result, nil
+}
+
+// readIndex reads a text word index into memory
+func readIndex(path string, words int) ([]*roaring.Bitmap, error) {
+	f, err := pkg.OpenCacheFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sets := make([]*roaring.Bitmap, words)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 10*1024*1024), 10*1024*1024)
+	for scanner.Scan() {
+		idx, set, err := pkg.ParseIndexLine(scanner.Text())
+		if err != nil {
+			return nil, err
+		}
+		if idx >= 0 && idx < words {
+			sets[idx] = set
+		}
+	}
+	return sets, scanner.Err()
+}
@@ -0,0 +1,129 @@
+package query
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// vocab finds the words matching a wildcard pattern with binary searches: by
+// prefix over the vocabulary in byte order (uniq.txt already is, unless
+// incremental updates appended to it), and by suffix over the words spelled
+// backwards, which is sorted on first use.
+type vocab struct {
+	words  []string // uniq.txt
+	sorted []string // words in byte order
+	ids    []int    // word index of sorted[i]
+
+	once     sync.Once
+	reversed []string // words spelled backwards, in byte order
+	revIDs   []int    // word index of reversed[i]
+}
+
+func newVocab(words []string) *vocab {
+	v := &vocab{words: words, sorted: words, ids: make([]int, len(words))}
+	for i := range v.ids {
+		v.ids[i] = i
+	}
+	if !sort.StringsAreSorted(words) {
+		v.sorted = slices.Clone(words)
+		sort.Slice(v.ids, func(i, j int) bool { return words[v.ids[i]] < words[v.ids[j]] })
+		for i, id := range v.ids {
+			v.sorted[i] = words[id]
+		}
+	}
+	return v
+}
+
+// isPattern reports whether a query word is a wildcard pattern
+func isPattern(word string) bool {
+	return strings.Contains(word, "*")
+}
+
+// match returns the indices of the words matching pattern, in which * stands
+// for any run of characters, in vocabulary order
+func (v *vocab) match(pattern string) []int {
+	parts := strings.Split(pattern, "*")
+	prefix, suffix := parts[0], parts[len(parts)-1]
+
+	var ids []int
+	switch {
+	case prefix != "":
+		lo, hi := prefixRange(v.sorted, prefix)
+		for i := lo; i < hi; i++ {
+			if globMatch(parts, v.sorted[i]) {
+				ids = append(ids, v.ids[i])
+			}
+		}
+	case suffix != "":
+		v.once.Do(v.buildReversed)
+		lo, hi := prefixRange(v.reversed, reverse(suffix))
+		for i := lo; i < hi; i++ {
+			if globMatch(parts, v.words[v.revIDs[i]]) {
+				ids = append(ids, v.revIDs[i])
+			}
+		}
+	default:
+		for i, word := range v.sorted {
+			if globMatch(parts, word) {
+				ids = append(ids, v.ids[i])
+			}
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func (v *vocab) buildReversed() {
+	type entry struct {
+		word string
+		id   int
+	}
+	entries := make([]entry, len(v.sorted))
+	for i, word := range v.sorted {
+		entries[i] = entry{reverse(word), v.ids[i]}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].word < entries[j].word })
+	v.reversed = make([]string, len(entries))
+	v.revIDs = make([]int, len(entries))
+	for i, e := range entries {
+		v.reversed[i], v.revIDs[i] = e.word, e.id
+	}
+}
+
+// prefixRange returns the range of sorted words starting with prefix
+func prefixRange(sorted []string, prefix string) (int, int) {
+	lo := sort.SearchStrings(sorted, prefix)
+	hi := lo + sort.Search(len(sorted)-lo, func(i int) bool {
+		return !strings.HasPrefix(sorted[lo+i], prefix)
+	})
+	return lo, hi
+}
+
+// globMatch matches word against a pattern split at its *s
+func globMatch(parts []string, word string) bool {
+	if len(parts) == 1 {
+		return word == parts[0]
+	}
+	if !strings.HasPrefix(word, parts[0]) {
+		return false
+	}
+	word = word[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(word, part)
+		if i == -1 {
+			return false
+		}
+		word = word[i+len(part):]
+	}
+	return len(word) >= len(last) && strings.HasSuffix(word, last)
+}
+
+// reverse spells s backwards, rune by rune
+func reverse(s string) string {
+	r := []rune(s)
+	slices.Reverse(r)
+	return string(r)
+}
@@ -0,0 +1,6 @@
+// Package rpc is the gRPC API of the TokenTrove web server, generated from
+// tokentrove.proto. Go clients use NewTokenTroveClient; other languages
+// generate theirs from the .proto.
+package rpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative tokentrove.proto
@@ -0,0 +1,1765 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: tokentrove.proto
+
+package rpc
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type GetStatsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetStatsRequest) Reset() {
+	*x = GetStatsRequest{}
+	mi := &file_tokentrove_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetStatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStatsRequest) ProtoMessage() {}
+
+func (x *GetStatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tokentrove_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStatsRequest.ProtoReflect.Descriptor instead.
+func (*GetStatsRequest) Descriptor() ([]byte, []int) {
+	return file_tokentrove_proto_rawDescGZIP(), []int{0}
+}
+
+type Stats struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	WordCount int64                  `protobuf:"varint,1,opt,name=word_count,json=wordCount,proto3" json:"word_count,omitempty"`
+	FileCount int64                  `protobuf:"varint,2,opt,name=file_count,json=fileCount,proto3" json:"file_count,omitempty"`
+	MaxN      int32                  `protobuf:"varint,3,opt,name=max_n,json=maxN,proto3" json:"max_n,omitempty"`
+	// The n-grams of each size, by n
+	NgramCounts map[int32]int64 `protobuf:"bytes,4,rep,name=ngram_counts,json=ngramCounts,proto3" json:"ngram_counts,omitempty" protobuf_key:"varint,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	// When the vocabulary and n-grams were loaded, RFC 3339
+	LoadedAt      string      `protobuf:"bytes,5,opt,name=loaded_at,json=loadedAt,proto3" json:"loaded_at,omitempty"`
+	Queue         *QueueStats `protobuf:"bytes,6,opt,name=queue,proto3" json:"queue,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Stats) Reset() {
+	*x = Stats{}
+	mi := &file_tokentrove_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Stats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Stats) ProtoMessage() {}
+
+func (x *Stats) ProtoReflect() protoreflect.Message {
+	mi := &file_tokentrove_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Stats.ProtoReflect.Descriptor instead.
+func (*Stats) Descriptor() ([]byte, []int) {
+	return file_tokentrove_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Stats) GetWordCount() int64 {
+	if x != nil {
+		return x.WordCount
+	}
+	return 0
+}
+
+func (x *Stats) GetFileCount() int64 {
+	if x != nil {
+		return x.FileCount
+	}
+	return 0
+}
+
+func (x *Stats) GetMaxN() int32 {
+	if x != nil {
+		return x.MaxN
+	}
+	return 0
+}
+
+func (x *Stats) GetNgramCounts() map[int32]int64 {
+	if x != nil {
+		return x.NgramCounts
+	}
+	return nil
+}
+
+func (x *Stats) GetLoadedAt() string {
+	if x != nil {
+		return x.LoadedAt
+	}
+	return ""
+}
+
+func (x *Stats) GetQueue() *QueueStats {
+	if x != nil {
+		return x.Queue
+	}
+	return nil
+}
+
+type QueueStats struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Depth         int32                  `protobuf:"varint,1,opt,name=depth,proto3" json:"depth,omitempty"`
+	Capacity      int32                  `protobuf:"varint,2,opt,name=capacity,proto3" json:"capacity,omitempty"`
+	Running       int32                  `protobuf:"varint,3,opt,name=running,proto3" json:"running,omitempty"`
+	Workers       int32                  `protobuf:"varint,4,opt,name=workers,proto3" json:"workers,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QueueStats) Reset() {
+	*x = QueueStats{}
+	mi := &file_tokentrove_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueueStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueueStats) ProtoMessage() {}
+
+func (x *QueueStats) ProtoReflect() protoreflect.Message {
+	mi := &file_tokentrove_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueueStats.ProtoReflect.Descriptor instead.
+func (*QueueStats) Descriptor() ([]byte, []int) {
+	return file_tokentrove_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *QueueStats) GetDepth() int32 {
+	if x != nil {
+		return x.Depth
+	}
+	return 0
+}
+
+func (x *QueueStats) GetCapacity() int32 {
+	if x != nil {
+		return x.Capacity
+	}
+	return 0
+}
+
+func (x *QueueStats) GetRunning() int32 {
+	if x != nil {
+		return x.Running
+	}
+	return 0
+}
+
+func (x *QueueStats) GetWorkers() int32 {
+	if x != nil {
+		return x.Workers
+	}
+	return 0
+}
+
+type SearchRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Query string                 `protobuf:"bytes,1,opt,name=query,proto3" json:"query,omitempty"`
+	// The page of matching files; limit defaults to 20
+	Limit  int32 `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
+	Offset int32 `protobuf:"varint,3,opt,name=offset,proto3" json:"offset,omitempty"`
+	// Only files whose path matches this glob
+	Path string `protobuf:"bytes,4,opt,name=path,proto3" json:"path,omitempty"`
+	// Only files converted from these extensions, comma-separated
+	Ext string `protobuf:"bytes,5,opt,name=ext,proto3" json:"ext,omitempty"`
+	// Stopword languages or file, as in /api/search
+	Stopwords     string `protobuf:"bytes,6,opt,name=stopwords,proto3" json:"stopwords,omitempty"`
+	Normalize     bool   `protobuf:"varint,7,opt,name=normalize,proto3" json:"normalize,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SearchRequest) Reset() {
+	*x = SearchRequest{}
+	mi := &file_tokentrove_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchRequest) ProtoMessage() {}
+
+func (x *SearchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tokentrove_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchRequest.ProtoReflect.Descriptor instead.
+func (*SearchRequest) Descriptor() ([]byte, []int) {
+	return file_tokentrove_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *SearchRequest) GetQuery() string {
+	if x != nil {
+		return x.Query
+	}
+	return ""
+}
+
+func (x *SearchRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *SearchRequest) GetOffset() int32 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *SearchRequest) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *SearchRequest) GetExt() string {
+	if x != nil {
+		return x.Ext
+	}
+	return ""
+}
+
+func (x *SearchRequest) GetStopwords() string {
+	if x != nil {
+		return x.Stopwords
+	}
+	return ""
+}
+
+func (x *SearchRequest) GetNormalize() bool {
+	if x != nil {
+		return x.Normalize
+	}
+	return false
+}
+
+type WordMatch struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Index         int32                  `protobuf:"varint,1,opt,name=index,proto3" json:"index,omitempty"`
+	Word          string                 `protobuf:"bytes,2,opt,name=word,proto3" json:"word,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WordMatch) Reset() {
+	*x = WordMatch{}
+	mi := &file_tokentrove_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WordMatch) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WordMatch) ProtoMessage() {}
+
+func (x *WordMatch) ProtoReflect() protoreflect.Message {
+	mi := &file_tokentrove_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WordMatch.ProtoReflect.Descriptor instead.
+func (*WordMatch) Descriptor() ([]byte, []int) {
+	return file_tokentrove_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *WordMatch) GetIndex() int32 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+func (x *WordMatch) GetWord() string {
+	if x != nil {
+		return x.Word
+	}
+	return ""
+}
+
+type NgramMatch struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	N             int32                  `protobuf:"varint,1,opt,name=n,proto3" json:"n,omitempty"`
+	Words         []string               `protobuf:"bytes,2,rep,name=words,proto3" json:"words,omitempty"`
+	Count         int64                  `protobuf:"varint,3,opt,name=count,proto3" json:"count,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *NgramMatch) Reset() {
+	*x = NgramMatch{}
+	mi := &file_tokentrove_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *NgramMatch) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NgramMatch) ProtoMessage() {}
+
+func (x *NgramMatch) ProtoReflect() protoreflect.Message {
+	mi := &file_tokentrove_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NgramMatch.ProtoReflect.Descriptor instead.
+func (*NgramMatch) Descriptor() ([]byte, []int) {
+	return file_tokentrove_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *NgramMatch) GetN() int32 {
+	if x != nil {
+		return x.N
+	}
+	return 0
+}
+
+func (x *NgramMatch) GetWords() []string {
+	if x != nil {
+		return x.Words
+	}
+	return nil
+}
+
+func (x *NgramMatch) GetCount() int64 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+type Highlight struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Before        string                 `protobuf:"bytes,1,opt,name=before,proto3" json:"before,omitempty"`
+	Match         string                 `protobuf:"bytes,2,opt,name=match,proto3" json:"match,omitempty"`
+	After         string                 `protobuf:"bytes,3,opt,name=after,proto3" json:"after,omitempty"`
+	Offset        int32                  `protobuf:"varint,4,opt,name=offset,proto3" json:"offset,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Highlight) Reset() {
+	*x = Highlight{}
+	mi := &file_tokentrove_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Highlight) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Highlight) ProtoMessage() {}
+
+func (x *Highlight) ProtoReflect() protoreflect.Message {
+	mi := &file_tokentrove_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Highlight.ProtoReflect.Descriptor instead.
+func (*Highlight) Descriptor() ([]byte, []int) {
+	return file_tokentrove_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Highlight) GetBefore() string {
+	if x != nil {
+		return x.Before
+	}
+	return ""
+}
+
+func (x *Highlight) GetMatch() string {
+	if x != nil {
+		return x.Match
+	}
+	return ""
+}
+
+func (x *Highlight) GetAfter() string {
+	if x != nil {
+		return x.After
+	}
+	return ""
+}
+
+func (x *Highlight) GetOffset() int32 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+type Document struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	File          string                 `protobuf:"bytes,1,opt,name=file,proto3" json:"file,omitempty"`
+	Index         int32                  `protobuf:"varint,2,opt,name=index,proto3" json:"index,omitempty"`
+	Score         float64                `protobuf:"fixed64,3,opt,name=score,proto3" json:"score,omitempty"`
+	Hits          int32                  `protobuf:"varint,4,opt,name=hits,proto3" json:"hits,omitempty"`
+	Snippet       string                 `protobuf:"bytes,5,opt,name=snippet,proto3" json:"snippet,omitempty"`
+	Highlight     *Highlight             `protobuf:"bytes,6,opt,name=highlight,proto3" json:"highlight,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Document) Reset() {
+	*x = Document{}
+	mi := &file_tokentrove_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Document) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Document) ProtoMessage() {}
+
+func (x *Document) ProtoReflect() protoreflect.Message {
+	mi := &file_tokentrove_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Document.ProtoReflect.Descriptor instead.
+func (*Document) Descriptor() ([]byte, []int) {
+	return file_tokentrove_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Document) GetFile() string {
+	if x != nil {
+		return x.File
+	}
+	return ""
+}
+
+func (x *Document) GetIndex() int32 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+func (x *Document) GetScore() float64 {
+	if x != nil {
+		return x.Score
+	}
+	return 0
+}
+
+func (x *Document) GetHits() int32 {
+	if x != nil {
+		return x.Hits
+	}
+	return 0
+}
+
+func (x *Document) GetSnippet() string {
+	if x != nil {
+		return x.Snippet
+	}
+	return ""
+}
+
+func (x *Document) GetHighlight() *Highlight {
+	if x != nil {
+		return x.Highlight
+	}
+	return nil
+}
+
+type SearchResponse struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Words  []*WordMatch           `protobuf:"bytes,1,rep,name=words,proto3" json:"words,omitempty"`
+	Ngrams []*NgramMatch          `protobuf:"bytes,2,rep,name=ngrams,proto3" json:"ngrams,omitempty"`
+	// The number of matching files
+	Total     int32       `protobuf:"varint,3,opt,name=total,proto3" json:"total,omitempty"`
+	Documents []*Document `protobuf:"bytes,4,rep,name=documents,proto3" json:"documents,omitempty"`
+	// Why the file search failed, if it did
+	DocumentsError string `protobuf:"bytes,5,opt,name=documents_error,json=documentsError,proto3" json:"documents_error,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *SearchResponse) Reset() {
+	*x = SearchResponse{}
+	mi := &file_tokentrove_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchResponse) ProtoMessage() {}
+
+func (x *SearchResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_tokentrove_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchResponse.ProtoReflect.Descriptor instead.
+func (*SearchResponse) Descriptor() ([]byte, []int) {
+	return file_tokentrove_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *SearchResponse) GetWords() []*WordMatch {
+	if x != nil {
+		return x.Words
+	}
+	return nil
+}
+
+func (x *SearchResponse) GetNgrams() []*NgramMatch {
+	if x != nil {
+		return x.Ngrams
+	}
+	return nil
+}
+
+func (x *SearchResponse) GetTotal() int32 {
+	if x != nil {
+		return x.Total
+	}
+	return 0
+}
+
+func (x *SearchResponse) GetDocuments() []*Document {
+	if x != nil {
+		return x.Documents
+	}
+	return nil
+}
+
+func (x *SearchResponse) GetDocumentsError() string {
+	if x != nil {
+		return x.DocumentsError
+	}
+	return ""
+}
+
+type ListNgramsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	N     int32                  `protobuf:"varint,1,opt,name=n,proto3" json:"n,omitempty"`
+	// limit defaults to 50
+	Limit  int32 `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
+	Offset int32 `protobuf:"varint,3,opt,name=offset,proto3" json:"offset,omitempty"`
+	// count (the default), files or alpha
+	Sort          string `protobuf:"bytes,4,opt,name=sort,proto3" json:"sort,omitempty"`
+	MinCount      int64  `protobuf:"varint,5,opt,name=min_count,json=minCount,proto3" json:"min_count,omitempty"`
+	Contains      string `protobuf:"bytes,6,opt,name=contains,proto3" json:"contains,omitempty"`
+	Path          string `protobuf:"bytes,7,opt,name=path,proto3" json:"path,omitempty"`
+	Ext           string `protobuf:"bytes,8,opt,name=ext,proto3" json:"ext,omitempty"`
+	Stopwords     string `protobuf:"bytes,9,opt,name=stopwords,proto3" json:"stopwords,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListNgramsRequest) Reset() {
+	*x = ListNgramsRequest{}
+	mi := &file_tokentrove_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListNgramsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListNgramsRequest) ProtoMessage() {}
+
+func (x *ListNgramsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tokentrove_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListNgramsRequest.ProtoReflect.Descriptor instead.
+func (*ListNgramsRequest) Descriptor() ([]byte, []int) {
+	return file_tokentrove_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ListNgramsRequest) GetN() int32 {
+	if x != nil {
+		return x.N
+	}
+	return 0
+}
+
+func (x *ListNgramsRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *ListNgramsRequest) GetOffset() int32 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *ListNgramsRequest) GetSort() string {
+	if x != nil {
+		return x.Sort
+	}
+	return ""
+}
+
+func (x *ListNgramsRequest) GetMinCount() int64 {
+	if x != nil {
+		return x.MinCount
+	}
+	return 0
+}
+
+func (x *ListNgramsRequest) GetContains() string {
+	if x != nil {
+		return x.Contains
+	}
+	return ""
+}
+
+func (x *ListNgramsRequest) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *ListNgramsRequest) GetExt() string {
+	if x != nil {
+		return x.Ext
+	}
+	return ""
+}
+
+func (x *ListNgramsRequest) GetStopwords() string {
+	if x != nil {
+		return x.Stopwords
+	}
+	return ""
+}
+
+type Ngram struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Words         []string               `protobuf:"bytes,1,rep,name=words,proto3" json:"words,omitempty"`
+	Count         int64                  `protobuf:"varint,2,opt,name=count,proto3" json:"count,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Ngram) Reset() {
+	*x = Ngram{}
+	mi := &file_tokentrove_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Ngram) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Ngram) ProtoMessage() {}
+
+func (x *Ngram) ProtoReflect() protoreflect.Message {
+	mi := &file_tokentrove_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Ngram.ProtoReflect.Descriptor instead.
+func (*Ngram) Descriptor() ([]byte, []int) {
+	return file_tokentrove_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *Ngram) GetWords() []string {
+	if x != nil {
+		return x.Words
+	}
+	return nil
+}
+
+func (x *Ngram) GetCount() int64 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+type ListNgramsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	N             int32                  `protobuf:"varint,1,opt,name=n,proto3" json:"n,omitempty"`
+	Sort          string                 `protobuf:"bytes,2,opt,name=sort,proto3" json:"sort,omitempty"`
+	Total         int64                  `protobuf:"varint,3,opt,name=total,proto3" json:"total,omitempty"`
+	Offset        int32                  `protobuf:"varint,4,opt,name=offset,proto3" json:"offset,omitempty"`
+	Ngrams        []*Ngram               `protobuf:"bytes,5,rep,name=ngrams,proto3" json:"ngrams,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListNgramsResponse) Reset() {
+	*x = ListNgramsResponse{}
+	mi := &file_tokentrove_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListNgramsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListNgramsResponse) ProtoMessage() {}
+
+func (x *ListNgramsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_tokentrove_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListNgramsResponse.ProtoReflect.Descriptor instead.
+func (*ListNgramsResponse) Descriptor() ([]byte, []int) {
+	return file_tokentrove_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *ListNgramsResponse) GetN() int32 {
+	if x != nil {
+		return x.N
+	}
+	return 0
+}
+
+func (x *ListNgramsResponse) GetSort() string {
+	if x != nil {
+		return x.Sort
+	}
+	return ""
+}
+
+func (x *ListNgramsResponse) GetTotal() int64 {
+	if x != nil {
+		return x.Total
+	}
+	return 0
+}
+
+func (x *ListNgramsResponse) GetOffset() int32 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *ListNgramsResponse) GetNgrams() []*Ngram {
+	if x != nil {
+		return x.Ngrams
+	}
+	return nil
+}
+
+// CreateReportRequest takes the options of POST /api/report
+type CreateReportRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Type  string                 `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	Query string                 `protobuf:"bytes,2,opt,name=query,proto3" json:"query,omitempty"`
+	// chain_depth is the length of linked_ngrams and best_chains chains in
+	// n-grams, 2 to 50; 0 for the default
+	ChainDepth    int32  `protobuf:"varint,3,opt,name=chain_depth,json=chainDepth,proto3" json:"chain_depth,omitempty"`
+	MinN          int32  `protobuf:"varint,4,opt,name=min_n,json=minN,proto3" json:"min_n,omitempty"`
+	MinFiles      int32  `protobuf:"varint,5,opt,name=min_files,json=minFiles,proto3" json:"min_files,omitempty"`
+	SkipNumeric   bool   `protobuf:"varint,6,opt,name=skip_numeric,json=skipNumeric,proto3" json:"skip_numeric,omitempty"`
+	TopN          int32  `protobuf:"varint,7,opt,name=top_n,json=topN,proto3" json:"top_n,omitempty"`
+	Width         int32  `protobuf:"varint,8,opt,name=width,proto3" json:"width,omitempty"`
+	Path          string `protobuf:"bytes,9,opt,name=path,proto3" json:"path,omitempty"`
+	Ext           string `protobuf:"bytes,10,opt,name=ext,proto3" json:"ext,omitempty"`
+	Period        string `protobuf:"bytes,11,opt,name=period,proto3" json:"period,omitempty"`
+	SkipStopwords bool   `protobuf:"varint,12,opt,name=skip_stopwords,json=skipStopwords,proto3" json:"skip_stopwords,omitempty"`
+	Stopwords     string `protobuf:"bytes,13,opt,name=stopwords,proto3" json:"stopwords,omitempty"`
+	Priority      int32  `protobuf:"varint,14,opt,name=priority,proto3" json:"priority,omitempty"`
+	// overlap is how many words the n-grams of recurring_text, linked_ngrams
+	// and best_chains chains share with the next, 2 to min_n - 1; 0 for 2
+	Overlap       int32 `protobuf:"varint,15,opt,name=overlap,proto3" json:"overlap,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateReportRequest) Reset() {
+	*x = CreateReportRequest{}
+	mi := &file_tokentrove_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateReportRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateReportRequest) ProtoMessage() {}
+
+func (x *CreateReportRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tokentrove_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateReportRequest.ProtoReflect.Descriptor instead.
+func (*CreateReportRequest) Descriptor() ([]byte, []int) {
+	return file_tokentrove_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *CreateReportRequest) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *CreateReportRequest) GetQuery() string {
+	if x != nil {
+		return x.Query
+	}
+	return ""
+}
+
+func (x *CreateReportRequest) GetChainDepth() int32 {
+	if x != nil {
+		return x.ChainDepth
+	}
+	return 0
+}
+
+func (x *CreateReportRequest) GetMinN() int32 {
+	if x != nil {
+		return x.MinN
+	}
+	return 0
+}
+
+func (x *CreateReportRequest) GetMinFiles() int32 {
+	if x != nil {
+		return x.MinFiles
+	}
+	return 0
+}
+
+func (x *CreateReportRequest) GetSkipNumeric() bool {
+	if x != nil {
+		return x.SkipNumeric
+	}
+	return false
+}
+
+func (x *CreateReportRequest) GetTopN() int32 {
+	if x != nil {
+		return x.TopN
+	}
+	return 0
+}
+
+func (x *CreateReportRequest) GetWidth() int32 {
+	if x != nil {
+		return x.Width
+	}
+	return 0
+}
+
+func (x *CreateReportRequest) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *CreateReportRequest) GetExt() string {
+	if x != nil {
+		return x.Ext
+	}
+	return ""
+}
+
+func (x *CreateReportRequest) GetPeriod() string {
+	if x != nil {
+		return x.Period
+	}
+	return ""
+}
+
+func (x *CreateReportRequest) GetSkipStopwords() bool {
+	if x != nil {
+		return x.SkipStopwords
+	}
+	return false
+}
+
+func (x *CreateReportRequest) GetStopwords() string {
+	if x != nil {
+		return x.Stopwords
+	}
+	return ""
+}
+
+func (x *CreateReportRequest) GetPriority() int32 {
+	if x != nil {
+		return x.Priority
+	}
+	return 0
+}
+
+func (x *CreateReportRequest) GetOverlap() int32 {
+	if x != nil {
+		return x.Overlap
+	}
+	return 0
+}
+
+type Report struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Id          string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Type        string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	Name        string                 `protobuf:"bytes,3,opt,name=name,proto3" json:"name,omitempty"`
+	Description string                 `protobuf:"bytes,4,opt,name=description,proto3" json:"description,omitempty"`
+	// queued, running, done, error or cancelled
+	Status   string `protobuf:"bytes,5,opt,name=status,proto3" json:"status,omitempty"`
+	Progress int32  `protobuf:"varint,6,opt,name=progress,proto3" json:"progress,omitempty"`
+	Total    int32  `protobuf:"varint,7,opt,name=total,proto3" json:"total,omitempty"`
+	Message  string `protobuf:"bytes,8,opt,name=message,proto3" json:"message,omitempty"`
+	// RFC 3339
+	CreatedAt string `protobuf:"bytes,9,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	// Of the report file, in bytes
+	Size int64 `protobuf:"varint,10,opt,name=size,proto3" json:"size,omitempty"`
+	// The schedule that ran it
+	Schedule string `protobuf:"bytes,11,opt,name=schedule,proto3" json:"schedule,omitempty"`
+	Error    string `protobuf:"bytes,12,opt,name=error,proto3" json:"error,omitempty"`
+	// The place of a queued report in the queue, 1 for next
+	Position      int32 `protobuf:"varint,13,opt,name=position,proto3" json:"position,omitempty"`
+	Priority      int32 `protobuf:"varint,14,opt,name=priority,proto3" json:"priority,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Report) Reset() {
+	*x = Report{}
+	mi := &file_tokentrove_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Report) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Report) ProtoMessage() {}
+
+func (x *Report) ProtoReflect() protoreflect.Message {
+	mi := &file_tokentrove_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Report.ProtoReflect.Descriptor instead.
+func (*Report) Descriptor() ([]byte, []int) {
+	return file_tokentrove_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *Report) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Report) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Report) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Report) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *Report) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *Report) GetProgress() int32 {
+	if x != nil {
+		return x.Progress
+	}
+	return 0
+}
+
+func (x *Report) GetTotal() int32 {
+	if x != nil {
+		return x.Total
+	}
+	return 0
+}
+
+func (x *Report) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *Report) GetCreatedAt() string {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return ""
+}
+
+func (x *Report) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *Report) GetSchedule() string {
+	if x != nil {
+		return x.Schedule
+	}
+	return ""
+}
+
+func (x *Report) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *Report) GetPosition() int32 {
+	if x != nil {
+		return x.Position
+	}
+	return 0
+}
+
+func (x *Report) GetPriority() int32 {
+	if x != nil {
+		return x.Priority
+	}
+	return 0
+}
+
+type GetReportRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetReportRequest) Reset() {
+	*x = GetReportRequest{}
+	mi := &file_tokentrove_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetReportRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetReportRequest) ProtoMessage() {}
+
+func (x *GetReportRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tokentrove_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetReportRequest.ProtoReflect.Descriptor instead.
+func (*GetReportRequest) Descriptor() ([]byte, []int) {
+	return file_tokentrove_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *GetReportRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type ListReportsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListReportsRequest) Reset() {
+	*x = ListReportsRequest{}
+	mi := &file_tokentrove_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListReportsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListReportsRequest) ProtoMessage() {}
+
+func (x *ListReportsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tokentrove_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListReportsRequest.ProtoReflect.Descriptor instead.
+func (*ListReportsRequest) Descriptor() ([]byte, []int) {
+	return file_tokentrove_proto_rawDescGZIP(), []int{15}
+}
+
+type ListReportsResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Newest first
+	Reports []*Report `protobuf:"bytes,1,rep,name=reports,proto3" json:"reports,omitempty"`
+	// Of every report file in the reports directory
+	DiskUsage     int64 `protobuf:"varint,2,opt,name=disk_usage,json=diskUsage,proto3" json:"disk_usage,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListReportsResponse) Reset() {
+	*x = ListReportsResponse{}
+	mi := &file_tokentrove_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListReportsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListReportsResponse) ProtoMessage() {}
+
+func (x *ListReportsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_tokentrove_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListReportsResponse.ProtoReflect.Descriptor instead.
+func (*ListReportsResponse) Descriptor() ([]byte, []int) {
+	return file_tokentrove_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *ListReportsResponse) GetReports() []*Report {
+	if x != nil {
+		return x.Reports
+	}
+	return nil
+}
+
+func (x *ListReportsResponse) GetDiskUsage() int64 {
+	if x != nil {
+		return x.DiskUsage
+	}
+	return 0
+}
+
+type DeleteReportRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteReportRequest) Reset() {
+	*x = DeleteReportRequest{}
+	mi := &file_tokentrove_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteReportRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteReportRequest) ProtoMessage() {}
+
+func (x *DeleteReportRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tokentrove_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteReportRequest.ProtoReflect.Descriptor instead.
+func (*DeleteReportRequest) Descriptor() ([]byte, []int) {
+	return file_tokentrove_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *DeleteReportRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type DeleteReportResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The cancelled report; unset if it was deleted
+	Report        *Report `protobuf:"bytes,1,opt,name=report,proto3" json:"report,omitempty"`
+	Deleted       bool    `protobuf:"varint,2,opt,name=deleted,proto3" json:"deleted,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteReportResponse) Reset() {
+	*x = DeleteReportResponse{}
+	mi := &file_tokentrove_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteReportResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteReportResponse) ProtoMessage() {}
+
+func (x *DeleteReportResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_tokentrove_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteReportResponse.ProtoReflect.Descriptor instead.
+func (*DeleteReportResponse) Descriptor() ([]byte, []int) {
+	return file_tokentrove_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *DeleteReportResponse) GetReport() *Report {
+	if x != nil {
+		return x.Report
+	}
+	return nil
+}
+
+func (x *DeleteReportResponse) GetDeleted() bool {
+	if x != nil {
+		return x.Deleted
+	}
+	return false
+}
+
+type DownloadReportRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// json (the default), csv or txt
+	Format        string `protobuf:"bytes,2,opt,name=format,proto3" json:"format,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DownloadReportRequest) Reset() {
+	*x = DownloadReportRequest{}
+	mi := &file_tokentrove_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DownloadReportRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DownloadReportRequest) ProtoMessage() {}
+
+func (x *DownloadReportRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tokentrove_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DownloadReportRequest.ProtoReflect.Descriptor instead.
+func (*DownloadReportRequest) Descriptor() ([]byte, []int) {
+	return file_tokentrove_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *DownloadReportRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *DownloadReportRequest) GetFormat() string {
+	if x != nil {
+		return x.Format
+	}
+	return ""
+}
+
+type ReportChunk struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Data          []byte                 `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReportChunk) Reset() {
+	*x = ReportChunk{}
+	mi := &file_tokentrove_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReportChunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReportChunk) ProtoMessage() {}
+
+func (x *ReportChunk) ProtoReflect() protoreflect.Message {
+	mi := &file_tokentrove_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReportChunk.ProtoReflect.Descriptor instead.
+func (*ReportChunk) Descriptor() ([]byte, []int) {
+	return file_tokentrove_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *ReportChunk) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+var File_tokentrove_proto protoreflect.FileDescriptor
+
+const file_tokentrove_proto_rawDesc = "" +
+	"\n" +
+	"\x10tokentrove.proto\x12\rtokentrove.v1\"\x11\n" +
+	"\x0fGetStatsRequest\"\xb2\x02\n" +
+	"\x05Stats\x12\x1d\n" +
+	"\n" +
+	"word_count\x18\x01 \x01(\x03R\twordCount\x12\x1d\n" +
+	"\n" +
+	"file_count\x18\x02 \x01(\x03R\tfileCount\x12\x13\n" +
+	"\x05max_n\x18\x03 \x01(\x05R\x04maxN\x12H\n" +
+	"\fngram_counts\x18\x04 \x03(\v2%.tokentrove.v1.Stats.NgramCountsEntryR\vngramCounts\x12\x1b\n" +
+	"\tloaded_at\x18\x05 \x01(\tR\bloadedAt\x12/\n" +
+	"\x05queue\x18\x06 \x01(\v2\x19.tokentrove.v1.QueueStatsR\x05queue\x1a>\n" +
+	"\x10NgramCountsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\x05R\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x03R\x05value:\x028\x01\"r\n" +
+	"\n" +
+	"QueueStats\x12\x14\n" +
+	"\x05depth\x18\x01 \x01(\x05R\x05depth\x12\x1a\n" +
+	"\bcapacity\x18\x02 \x01(\x05R\bcapacity\x12\x18\n" +
+	"\arunning\x18\x03 \x01(\x05R\arunning\x12\x18\n" +
+	"\aworkers\x18\x04 \x01(\x05R\aworkers\"\xb5\x01\n" +
+	"\rSearchRequest\x12\x14\n" +
+	"\x05query\x18\x01 \x01(\tR\x05query\x12\x14\n" +
+	"\x05limit\x18\x02 \x01(\x05R\x05limit\x12\x16\n" +
+	"\x06offset\x18\x03 \x01(\x05R\x06offset\x12\x12\n" +
+	"\x04path\x18\x04 \x01(\tR\x04path\x12\x10\n" +
+	"\x03ext\x18\x05 \x01(\tR\x03ext\x12\x1c\n" +
+	"\tstopwords\x18\x06 \x01(\tR\tstopwords\x12\x1c\n" +
+	"\tnormalize\x18\a \x01(\bR\tnormalize\"5\n" +
+	"\tWordMatch\x12\x14\n" +
+	"\x05index\x18\x01 \x01(\x05R\x05index\x12\x12\n" +
+	"\x04word\x18\x02 \x01(\tR\x04word\"F\n" +
+	"\n" +
+	"NgramMatch\x12\f\n" +
+	"\x01n\x18\x01 \x01(\x05R\x01n\x12\x14\n" +
+	"\x05words\x18\x02 \x03(\tR\x05words\x12\x14\n" +
+	"\x05count\x18\x03 \x01(\x03R\x05count\"g\n" +
+	"\tHighlight\x12\x16\n" +
+	"\x06before\x18\x01 \x01(\tR\x06before\x12\x14\n" +
+	"\x05match\x18\x02 \x01(\tR\x05match\x12\x14\n" +
+	"\x05after\x18\x03 \x01(\tR\x05after\x12\x16\n" +
+	"\x06offset\x18\x04 \x01(\x05R\x06offset\"\xb0\x01\n" +
+	"\bDocument\x12\x12\n" +
+	"\x04file\x18\x01 \x01(\tR\x04file\x12\x14\n" +
+	"\x05index\x18\x02 \x01(\x05R\x05index\x12\x14\n" +
+	"\x05score\x18\x03 \x01(\x01R\x05score\x12\x12\n" +
+	"\x04hits\x18\x04 \x01(\x05R\x04hits\x12\x18\n" +
+	"\asnippet\x18\x05 \x01(\tR\asnippet\x126\n" +
+	"\thighlight\x18\x06 \x01(\v2\x18.tokentrove.v1.HighlightR\thighlight\"\xe9\x01\n" +
+	"\x0eSearchResponse\x12.\n" +
+	"\x05words\x18\x01 \x03(\v2\x18.tokentrove.v1.WordMatchR\x05words\x121\n" +
+	"\x06ngrams\x18\x02 \x03(\v2\x19.tokentrove.v1.NgramMatchR\x06ngrams\x12\x14\n" +
+	"\x05total\x18\x03 \x01(\x05R\x05total\x125\n" +
+	"\tdocuments\x18\x04 \x03(\v2\x17.tokentrove.v1.DocumentR\tdocuments\x12'\n" +
+	"\x0fdocuments_error\x18\x05 \x01(\tR\x0edocumentsError\"\xe0\x01\n" +
+	"\x11ListNgramsRequest\x12\f\n" +
+	"\x01n\x18\x01 \x01(\x05R\x01n\x12\x14\n" +
+	"\x05limit\x18\x02 \x01(\x05R\x05limit\x12\x16\n" +
+	"\x06offset\x18\x03 \x01(\x05R\x06offset\x12\x12\n" +
+	"\x04sort\x18\x04 \x01(\tR\x04sort\x12\x1b\n" +
+	"\tmin_count\x18\x05 \x01(\x03R\bminCount\x12\x1a\n" +
+	"\bcontains\x18\x06 \x01(\tR\bcontains\x12\x12\n" +
+	"\x04path\x18\a \x01(\tR\x04path\x12\x10\n" +
+	"\x03ext\x18\b \x01(\tR\x03ext\x12\x1c\n" +
+	"\tstopwords\x18\t \x01(\tR\tstopwords\"3\n" +
+	"\x05Ngram\x12\x14\n" +
+	"\x05words\x18\x01 \x03(\tR\x05words\x12\x14\n" +
+	"\x05count\x18\x02 \x01(\x03R\x05count\"\x92\x01\n" +
+	"\x12ListNgramsResponse\x12\f\n" +
+	"\x01n\x18\x01 \x01(\x05R\x01n\x12\x12\n" +
+	"\x04sort\x18\x02 \x01(\tR\x04sort\x12\x14\n" +
+	"\x05total\x18\x03 \x01(\x03R\x05total\x12\x16\n" +
+	"\x06offset\x18\x04 \x01(\x05R\x06offset\x12,\n" +
+	"\x06ngrams\x18\x05 \x03(\v2\x14.tokentrove.v1.NgramR\x06ngrams\"\x99\x03\n" +
+	"\x13CreateReportRequest\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x12\x14\n" +
+	"\x05query\x18\x02 \x01(\tR\x05query\x12\x1f\n" +
+	"\vchain_depth\x18\x03 \x01(\x05R\n" +
+	"chainDepth\x12\x13\n" +
+	"\x05min_n\x18\x04 \x01(\x05R\x04minN\x12\x1b\n" +
+	"\tmin_files\x18\x05 \x01(\x05R\bminFiles\x12!\n" +
+	"\fskip_numeric\x18\x06 \x01(\bR\vskipNumeric\x12\x13\n" +
+	"\x05top_n\x18\a \x01(\x05R\x04topN\x12\x14\n" +
+	"\x05width\x18\b \x01(\x05R\x05width\x12\x12\n" +
+	"\x04path\x18\t \x01(\tR\x04path\x12\x10\n" +
+	"\x03ext\x18\n" +
+	" \x01(\tR\x03ext\x12\x16\n" +
+	"\x06period\x18\v \x01(\tR\x06period\x12%\n" +
+	"\x0eskip_stopwords\x18\f \x01(\bR\rskipStopwords\x12\x1c\n" +
+	"\tstopwords\x18\r \x01(\tR\tstopwords\x12\x1a\n" +
+	"\bpriority\x18\x0e \x01(\x05R\bpriority\x12\x18\n" +
+	"\aoverlap\x18\x0f \x01(\x05R\aoverlap\"\xe3\x02\n" +
+	"\x06Report\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12\x12\n" +
+	"\x04name\x18\x03 \x01(\tR\x04name\x12 \n" +
+	"\vdescription\x18\x04 \x01(\tR\vdescription\x12\x16\n" +
+	"\x06status\x18\x05 \x01(\tR\x06status\x12\x1a\n" +
+	"\bprogress\x18\x06 \x01(\x05R\bprogress\x12\x14\n" +
+	"\x05total\x18\a \x01(\x05R\x05total\x12\x18\n" +
+	"\amessage\x18\b \x01(\tR\amessage\x12\x1d\n" +
+	"\n" +
+	"created_at\x18\t \x01(\tR\tcreatedAt\x12\x12\n" +
+	"\x04size\x18\n" +
+	" \x01(\x03R\x04size\x12\x1a\n" +
+	"\bschedule\x18\v \x01(\tR\bschedule\x12\x14\n" +
+	"\x05error\x18\f \x01(\tR\x05error\x12\x1a\n" +
+	"\bposition\x18\r \x01(\x05R\bposition\x12\x1a\n" +
+	"\bpriority\x18\x0e \x01(\x05R\bpriority\"\"\n" +
+	"\x10GetReportRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\x14\n" +
+	"\x12ListReportsRequest\"e\n" +
+	"\x13ListReportsResponse\x12/\n" +
+	"\areports\x18\x01 \x03(\v2\x15.tokentrove.v1.ReportR\areports\x12\x1d\n" +
+	"\n" +
+	"disk_usage\x18\x02 \x01(\x03R\tdiskUsage\"%\n" +
+	"\x13DeleteReportRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"_\n" +
+	"\x14DeleteReportResponse\x12-\n" +
+	"\x06report\x18\x01 \x01(\v2\x15.tokentrove.v1.ReportR\x06report\x12\x18\n" +
+	"\adeleted\x18\x02 \x01(\bR\adeleted\"?\n" +
+	"\x15DownloadReportRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x16\n" +
+	"\x06format\x18\x02 \x01(\tR\x06format\"!\n" +
+	"\vReportChunk\x12\x12\n" +
+	"\x04data\x18\x01 \x01(\fR\x04data2\xfd\x04\n" +
+	"\n" +
+	"TokenTrove\x12@\n" +
+	"\bGetStats\x12\x1e.tokentrove.v1.GetStatsRequest\x1a\x14.tokentrove.v1.Stats\x12E\n" +
+	"\x06Search\x12\x1c.tokentrove.v1.SearchRequest\x1a\x1d.tokentrove.v1.SearchResponse\x12Q\n" +
+	"\n" +
+	"ListNgrams\x12 .tokentrove.v1.ListNgramsRequest\x1a!.tokentrove.v1.ListNgramsResponse\x12I\n" +
+	"\fCreateReport\x12\".tokentrove.v1.CreateReportRequest\x1a\x15.tokentrove.v1.Report\x12C\n" +
+	"\tGetReport\x12\x1f.tokentrove.v1.GetReportRequest\x1a\x15.tokentrove.v1.Report\x12T\n" +
+	"\vListReports\x12!.tokentrove.v1.ListReportsRequest\x1a\".tokentrove.v1.ListReportsResponse\x12W\n" +
+	"\fDeleteReport\x12\".tokentrove.v1.DeleteReportRequest\x1a#.tokentrove.v1.DeleteReportResponse\x12T\n" +
+	"\x0eDownloadReport\x12$.tokentrove.v1.DownloadReportRequest\x1a\x1a.tokentrove.v1.ReportChunk0\x01B)Z'github.com/openfluke/tokentrove/pkg/rpcb\x06proto3"
+
+var (
+	file_tokentrove_proto_rawDescOnce sync.Once
+	file_tokentrove_proto_rawDescData []byte
+)
+
+func file_tokentrove_proto_rawDescGZIP() []byte {
+	file_tokentrove_proto_rawDescOnce.Do(func() {
+		file_tokentrove_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_tokentrove_proto_rawDesc), len(file_tokentrove_proto_rawDesc)))
+	})
+	return file_tokentrove_proto_rawDescData
+}
+
+var file_tokentrove_proto_msgTypes = make([]protoimpl.MessageInfo, 22)
+var file_tokentrove_proto_goTypes = []any{
+	(*GetStatsRequest)(nil),       // 0: tokentrove.v1.GetStatsRequest
+	(*Stats)(nil),                 // 1: tokentrove.v1.Stats
+	(*QueueStats)(nil),            // 2: tokentrove.v1.QueueStats
+	(*SearchRequest)(nil),         // 3: tokentrove.v1.SearchRequest
+	(*WordMatch)(nil),             // 4: tokentrove.v1.WordMatch
+	(*NgramMatch)(nil),            // 5: tokentrove.v1.NgramMatch
+	(*Highlight)(nil),             // 6: tokentrove.v1.Highlight
+	(*Document)(nil),              // 7: tokentrove.v1.Document
+	(*SearchResponse)(nil),        // 8: tokentrove.v1.SearchResponse
+	(*ListNgramsRequest)(nil),     // 9: tokentrove.v1.ListNgramsRequest
+	(*Ngram)(nil),                 // 10: tokentrove.v1.Ngram
+	(*ListNgramsResponse)(nil),    // 11: tokentrove.v1.ListNgramsResponse
+	(*CreateReportRequest)(nil),   // 12: tokentrove.v1.CreateReportRequest
+	(*Report)(nil),                // 13: tokentrove.v1.Report
+	(*GetReportRequest)(nil),      // 14: tokentrove.v1.GetReportRequest
+	(*ListReportsRequest)(nil),    // 15: tokentrove.v1.ListReportsRequest
+	(*ListReportsResponse)(nil),   // 16: tokentrove.v1.ListReportsResponse
+	(*DeleteReportRequest)(nil),   // 17: tokentrove.v1.DeleteReportRequest
+	(*DeleteReportResponse)(nil),  // 18: tokentrove.v1.DeleteReportResponse
+	(*DownloadReportRequest)(nil), // 19: tokentrove.v1.DownloadReportRequest
+	(*ReportChunk)(nil),           // 20: tokentrove.v1.ReportChunk
+	nil,                           // 21: tokentrove.v1.Stats.NgramCountsEntry
+}
+var file_tokentrove_proto_depIdxs = []int32{
+	21, // 0: tokentrove.v1.Stats.ngram_counts:type_name -> tokentrove.v1.Stats.NgramCountsEntry
+	2,  // 1: tokentrove.v1.Stats.queue:type_name -> tokentrove.v1.QueueStats
+	6,  // 2: tokentrove.v1.Document.highlight:type_name -> tokentrove.v1.Highlight
+	4,  // 3: tokentrove.v1.SearchResponse.words:type_name -> tokentrove.v1.WordMatch
+	5,  // 4: tokentrove.v1.SearchResponse.ngrams:type_name -> tokentrove.v1.NgramMatch
+	7,  // 5: tokentrove.v1.SearchResponse.documents:type_name -> tokentrove.v1.Document
+	10, // 6: tokentrove.v1.ListNgramsResponse.ngrams:type_name -> tokentrove.v1.Ngram
+	13, // 7: tokentrove.v1.ListReportsResponse.reports:type_name -> tokentrove.v1.Report
+	13, // 8: tokentrove.v1.DeleteReportResponse.report:type_name -> tokentrove.v1.Report
+	0,  // 9: tokentrove.v1.TokenTrove.GetStats:input_type -> tokentrove.v1.GetStatsRequest
+	3,  // 10: tokentrove.v1.TokenTrove.Search:input_type -> tokentrove.v1.SearchRequest
+	9,  // 11: tokentrove.v1.TokenTrove.ListNgrams:input_type -> tokentrove.v1.ListNgramsRequest
+	12, // 12: tokentrove.v1.TokenTrove.CreateReport:input_type -> tokentrove.v1.CreateReportRequest
+	14, // 13: tokentrove.v1.TokenTrove.GetReport:input_type -> tokentrove.v1.GetReportRequest
+	15, // 14: tokentrove.v1.TokenTrove.ListReports:input_type -> tokentrove.v1.ListReportsRequest
+	17, // 15: tokentrove.v1.TokenTrove.DeleteReport:input_type -> tokentrove.v1.DeleteReportRequest
+	19, // 16: tokentrove.v1.TokenTrove.DownloadReport:input_type -> tokentrove.v1.DownloadReportRequest
+	1,  // 17: tokentrove.v1.TokenTrove.GetStats:output_type -> tokentrove.v1.Stats
+	8,  // 18: tokentrove.v1.TokenTrove.Search:output_type -> tokentrove.v1.SearchResponse
+	11, // 19: tokentrove.v1.TokenTrove.ListNgrams:output_type -> tokentrove.v1.ListNgramsResponse
+	13, // 20: tokentrove.v1.TokenTrove.CreateReport:output_type -> tokentrove.v1.Report
+	13, // 21: tokentrove.v1.TokenTrove.GetReport:output_type -> tokentrove.v1.Report
+	16, // 22: tokentrove.v1.TokenTrove.ListReports:output_type -> tokentrove.v1.ListReportsResponse
+	18, // 23: tokentrove.v1.TokenTrove.DeleteReport:output_type -> tokentrove.v1.DeleteReportResponse
+	20, // 24: tokentrove.v1.TokenTrove.DownloadReport:output_type -> tokentrove.v1.ReportChunk
+	17, // [17:25] is the sub-list for method output_type
+	9,  // [9:17] is the sub-list for method input_type
+	9,  // [9:9] is the sub-list for extension type_name
+	9,  // [9:9] is the sub-list for extension extendee
+	0,  // [0:9] is the sub-list for field type_name
+}
+
+func init() { file_tokentrove_proto_init() }
+func file_tokentrove_proto_init() {
+	if File_tokentrove_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_tokentrove_proto_rawDesc), len(file_tokentrove_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   22,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_tokentrove_proto_goTypes,
+		DependencyIndexes: file_tokentrove_proto_depIdxs,
+		MessageInfos:      file_tokentrove_proto_msgTypes,
+	}.Build()
+	File_tokentrove_proto = out.File
+	file_tokentrove_proto_goTypes = nil
+	file_tokentrove_proto_depIdxs = nil
+}
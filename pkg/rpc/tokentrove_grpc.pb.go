@@ -0,0 +1,417 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: tokentrove.proto
+
+package rpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	TokenTrove_GetStats_FullMethodName       = "/tokentrove.v1.TokenTrove/GetStats"
+	TokenTrove_Search_FullMethodName         = "/tokentrove.v1.TokenTrove/Search"
+	TokenTrove_ListNgrams_FullMethodName     = "/tokentrove.v1.TokenTrove/ListNgrams"
+	TokenTrove_CreateReport_FullMethodName   = "/tokentrove.v1.TokenTrove/CreateReport"
+	TokenTrove_GetReport_FullMethodName      = "/tokentrove.v1.TokenTrove/GetReport"
+	TokenTrove_ListReports_FullMethodName    = "/tokentrove.v1.TokenTrove/ListReports"
+	TokenTrove_DeleteReport_FullMethodName   = "/tokentrove.v1.TokenTrove/DeleteReport"
+	TokenTrove_DownloadReport_FullMethodName = "/tokentrove.v1.TokenTrove/DownloadReport"
+)
+
+// TokenTroveClient is the client API for TokenTrove service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// TokenTrove serves the caches of the web server. The "cache" metadata key
+// names one of those added with -caches; calls without it go to the -cache
+// one.
+type TokenTroveClient interface {
+	// GetStats is GET /api/stats
+	GetStats(ctx context.Context, in *GetStatsRequest, opts ...grpc.CallOption) (*Stats, error)
+	// Search is GET /api/search
+	Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResponse, error)
+	// ListNgrams is GET /api/ngrams/:n
+	ListNgrams(ctx context.Context, in *ListNgramsRequest, opts ...grpc.CallOption) (*ListNgramsResponse, error)
+	// CreateReport is POST /api/report
+	CreateReport(ctx context.Context, in *CreateReportRequest, opts ...grpc.CallOption) (*Report, error)
+	// GetReport is GET /api/report/:id
+	GetReport(ctx context.Context, in *GetReportRequest, opts ...grpc.CallOption) (*Report, error)
+	// ListReports is GET /api/reports
+	ListReports(ctx context.Context, in *ListReportsRequest, opts ...grpc.CallOption) (*ListReportsResponse, error)
+	// DeleteReport is DELETE /api/report/:id: it cancels a queued or running
+	// report and deletes a finished one
+	DeleteReport(ctx context.Context, in *DeleteReportRequest, opts ...grpc.CallOption) (*DeleteReportResponse, error)
+	// DownloadReport is GET /api/report/:id/download, in chunks
+	DownloadReport(ctx context.Context, in *DownloadReportRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ReportChunk], error)
+}
+
+type tokenTroveClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTokenTroveClient(cc grpc.ClientConnInterface) TokenTroveClient {
+	return &tokenTroveClient{cc}
+}
+
+func (c *tokenTroveClient) GetStats(ctx context.Context, in *GetStatsRequest, opts ...grpc.CallOption) (*Stats, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Stats)
+	err := c.cc.Invoke(ctx, TokenTrove_GetStats_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tokenTroveClient) Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SearchResponse)
+	err := c.cc.Invoke(ctx, TokenTrove_Search_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tokenTroveClient) ListNgrams(ctx context.Context, in *ListNgramsRequest, opts ...grpc.CallOption) (*ListNgramsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListNgramsResponse)
+	err := c.cc.Invoke(ctx, TokenTrove_ListNgrams_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tokenTroveClient) CreateReport(ctx context.Context, in *CreateReportRequest, opts ...grpc.CallOption) (*Report, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Report)
+	err := c.cc.Invoke(ctx, TokenTrove_CreateReport_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tokenTroveClient) GetReport(ctx context.Context, in *GetReportRequest, opts ...grpc.CallOption) (*Report, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Report)
+	err := c.cc.Invoke(ctx, TokenTrove_GetReport_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tokenTroveClient) ListReports(ctx context.Context, in *ListReportsRequest, opts ...grpc.CallOption) (*ListReportsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListReportsResponse)
+	err := c.cc.Invoke(ctx, TokenTrove_ListReports_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tokenTroveClient) DeleteReport(ctx context.Context, in *DeleteReportRequest, opts ...grpc.CallOption) (*DeleteReportResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteReportResponse)
+	err := c.cc.Invoke(ctx, TokenTrove_DeleteReport_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tokenTroveClient) DownloadReport(ctx context.Context, in *DownloadReportRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ReportChunk], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &TokenTrove_ServiceDesc.Streams[0], TokenTrove_DownloadReport_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[DownloadReportRequest, ReportChunk]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TokenTrove_DownloadReportClient = grpc.ServerStreamingClient[ReportChunk]
+
+// TokenTroveServer is the server API for TokenTrove service.
+// All implementations must embed UnimplementedTokenTroveServer
+// for forward compatibility.
+//
+// TokenTrove serves the caches of the web server. The "cache" metadata key
+// names one of those added with -caches; calls without it go to the -cache
+// one.
+type TokenTroveServer interface {
+	// GetStats is GET /api/stats
+	GetStats(context.Context, *GetStatsRequest) (*Stats, error)
+	// Search is GET /api/search
+	Search(context.Context, *SearchRequest) (*SearchResponse, error)
+	// ListNgrams is GET /api/ngrams/:n
+	ListNgrams(context.Context, *ListNgramsRequest) (*ListNgramsResponse, error)
+	// CreateReport is POST /api/report
+	CreateReport(context.Context, *CreateReportRequest) (*Report, error)
+	// GetReport is GET /api/report/:id
+	GetReport(context.Context, *GetReportRequest) (*Report, error)
+	// ListReports is GET /api/reports
+	ListReports(context.Context, *ListReportsRequest) (*ListReportsResponse, error)
+	// DeleteReport is DELETE /api/report/:id: it cancels a queued or running
+	// report and deletes a finished one
+	DeleteReport(context.Context, *DeleteReportRequest) (*DeleteReportResponse, error)
+	// DownloadReport is GET /api/report/:id/download, in chunks
+	DownloadReport(*DownloadReportRequest, grpc.ServerStreamingServer[ReportChunk]) error
+	mustEmbedUnimplementedTokenTroveServer()
+}
+
+// UnimplementedTokenTroveServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedTokenTroveServer struct{}
+
+func (UnimplementedTokenTroveServer) GetStats(context.Context, *GetStatsRequest) (*Stats, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStats not implemented")
+}
+func (UnimplementedTokenTroveServer) Search(context.Context, *SearchRequest) (*SearchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Search not implemented")
+}
+func (UnimplementedTokenTroveServer) ListNgrams(context.Context, *ListNgramsRequest) (*ListNgramsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListNgrams not implemented")
+}
+func (UnimplementedTokenTroveServer) CreateReport(context.Context, *CreateReportRequest) (*Report, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateReport not implemented")
+}
+func (UnimplementedTokenTroveServer) GetReport(context.Context, *GetReportRequest) (*Report, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetReport not implemented")
+}
+func (UnimplementedTokenTroveServer) ListReports(context.Context, *ListReportsRequest) (*ListReportsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListReports not implemented")
+}
+func (UnimplementedTokenTroveServer) DeleteReport(context.Context, *DeleteReportRequest) (*DeleteReportResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteReport not implemented")
+}
+func (UnimplementedTokenTroveServer) DownloadReport(*DownloadReportRequest, grpc.ServerStreamingServer[ReportChunk]) error {
+	return status.Errorf(codes.Unimplemented, "method DownloadReport not implemented")
+}
+func (UnimplementedTokenTroveServer) mustEmbedUnimplementedTokenTroveServer() {}
+func (UnimplementedTokenTroveServer) testEmbeddedByValue()                    {}
+
+// UnsafeTokenTroveServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TokenTroveServer will
+// result in compilation errors.
+type UnsafeTokenTroveServer interface {
+	mustEmbedUnimplementedTokenTroveServer()
+}
+
+func RegisterTokenTroveServer(s grpc.ServiceRegistrar, srv TokenTroveServer) {
+	// If the following call panics, it indicates UnimplementedTokenTroveServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&TokenTrove_ServiceDesc, srv)
+}
+
+func _TokenTrove_GetStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TokenTroveServer).GetStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TokenTrove_GetStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TokenTroveServer).GetStats(ctx, req.(*GetStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TokenTrove_Search_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TokenTroveServer).Search(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TokenTrove_Search_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TokenTroveServer).Search(ctx, req.(*SearchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TokenTrove_ListNgrams_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListNgramsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TokenTroveServer).ListNgrams(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TokenTrove_ListNgrams_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TokenTroveServer).ListNgrams(ctx, req.(*ListNgramsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TokenTrove_CreateReport_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateReportRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TokenTroveServer).CreateReport(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TokenTrove_CreateReport_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TokenTroveServer).CreateReport(ctx, req.(*CreateReportRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TokenTrove_GetReport_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetReportRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TokenTroveServer).GetReport(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TokenTrove_GetReport_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TokenTroveServer).GetReport(ctx, req.(*GetReportRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TokenTrove_ListReports_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListReportsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TokenTroveServer).ListReports(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TokenTrove_ListReports_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TokenTroveServer).ListReports(ctx, req.(*ListReportsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TokenTrove_DeleteReport_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteReportRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TokenTroveServer).DeleteReport(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TokenTrove_DeleteReport_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TokenTroveServer).DeleteReport(ctx, req.(*DeleteReportRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TokenTrove_DownloadReport_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(DownloadReportRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TokenTroveServer).DownloadReport(m, &grpc.GenericServerStream[DownloadReportRequest, ReportChunk]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TokenTrove_DownloadReportServer = grpc.ServerStreamingServer[ReportChunk]
+
+// TokenTrove_ServiceDesc is the grpc.ServiceDesc for TokenTrove service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var TokenTrove_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "tokentrove.v1.TokenTrove",
+	HandlerType: (*TokenTroveServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetStats",
+			Handler:    _TokenTrove_GetStats_Handler,
+		},
+		{
+			MethodName: "Search",
+			Handler:    _TokenTrove_Search_Handler,
+		},
+		{
+			MethodName: "ListNgrams",
+			Handler:    _TokenTrove_ListNgrams_Handler,
+		},
+		{
+			MethodName: "CreateReport",
+			Handler:    _TokenTrove_CreateReport_Handler,
+		},
+		{
+			MethodName: "GetReport",
+			Handler:    _TokenTrove_GetReport_Handler,
+		},
+		{
+			MethodName: "ListReports",
+			Handler:    _TokenTrove_ListReports_Handler,
+		},
+		{
+			MethodName: "DeleteReport",
+			Handler:    _TokenTrove_DeleteReport_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "DownloadReport",
+			Handler:       _TokenTrove_DownloadReport_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "tokentrove.proto",
+}
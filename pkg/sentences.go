@@ -0,0 +1,125 @@
+package pkg
+
+import (
+	"strings"
+	"unicode"
+)
+
+// sentenceBoundaries makes the n-gram builders treat each line of a token
+// file as a sentence that no n-gram window may cross
+var sentenceBoundaries = false
+
+// SetSentenceBoundaries sets whether n-grams, n-gram counts and skip-grams
+// stop at sentence boundaries. Boundaries are the line breaks of the token
+// files, which RunProcess writes one sentence per line with
+// ProcessOptions.Sentences.
+func SetSentenceBoundaries(enabled bool) {
+	sentenceBoundaries = enabled
+}
+
+// sentenceBreak marks a sentence boundary in a word index stream; builders
+// that ask for boundaries must not form n-grams across it
+const sentenceBreak = -1
+
+// sentenceBreakToken marks a sentence boundary in a token stream read by the
+// incremental updater. Tokens are split on whitespace, so no token equals it.
+const sentenceBreakToken = "\n"
+
+// crossesBreak reports whether the window words[i:i+n] spans a sentence boundary
+func crossesBreak(words []int, i, n int) bool {
+	for _, w := range words[i : i+n] {
+		if w == sentenceBreak {
+			return true
+		}
+	}
+	return false
+}
+
+// sentenceAbbreviations end with a period that does not end a sentence
+var sentenceAbbreviations = map[string]bool{
+	"mr": true, "mrs": true, "ms": true, "dr": true, "prof": true, "sr": true, "jr": true, "st": true,
+	"vs": true, "etc": true, "e.g": true, "i.e": true, "cf": true, "al": true, "approx": true,
+	"no": true, "vol": true, "fig": true, "inc": true, "ltd": true, "co": true, "corp": true,
+	"jan": true, "feb": true, "mar": true, "apr": true, "jun": true, "jul": true, "aug": true,
+	"sep": true, "sept": true, "oct": true, "nov": true, "dec": true,
+}
+
+// SplitSentences splits text into sentences. A sentence ends at '.', '!' or
+// '?' (plus any closing quotes or brackets) followed by whitespace and a word
+// that does not start in lower case, unless the period ends a known
+// abbreviation or a single-letter initial. Blank lines, which separate
+// paragraphs and document sections, always end a sentence. Line breaks inside
+// a sentence become spaces.
+func SplitSentences(text string) []string {
+	var sentences []string
+	var cur strings.Builder
+	flush := func() {
+		if s := strings.Join(strings.Fields(cur.String()), " "); s != "" {
+			sentences = append(sentences, s)
+		}
+		cur.Reset()
+	}
+
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if r == '\n' && blankLineFollows(runes, i) {
+			flush()
+			continue
+		}
+		cur.WriteRune(r)
+		if r != '.' && r != '!' && r != '?' {
+			continue
+		}
+
+		// Take the rest of the terminator: "?!", "...", closing quotes
+		j := i + 1
+		for j < len(runes) && strings.ContainsRune(".!?\"')]}»”’", runes[j]) {
+			cur.WriteRune(runes[j])
+			j++
+		}
+		i = j - 1
+		if j < len(runes) && !unicode.IsSpace(runes[j]) {
+			continue
+		}
+		k := j
+		for k < len(runes) && unicode.IsSpace(runes[k]) {
+			k++
+		}
+		if k < len(runes) && unicode.IsLower(runes[k]) {
+			continue
+		}
+		if r == '.' && isAbbreviation(cur.String()) {
+			continue
+		}
+		flush()
+	}
+	flush()
+	return sentences
+}
+
+// blankLineFollows reports whether the newline at runes[i] is followed by
+// another one with only spaces in between
+func blankLineFollows(runes []rune, i int) bool {
+	for j := i + 1; j < len(runes); j++ {
+		switch {
+		case runes[j] == '\n':
+			return true
+		case !unicode.IsSpace(runes[j]):
+			return false
+		}
+	}
+	return false
+}
+
+// isAbbreviation reports whether the text so far ends with an abbreviation
+// or initial followed by its period
+func isAbbreviation(text string) bool {
+	text = strings.TrimRight(text, ".")
+	start := strings.LastIndexFunc(text, unicode.IsSpace) + 1
+	word := strings.TrimLeft(text[start:], "\"'([{«“‘")
+	if len([]rune(word)) == 1 && unicode.IsUpper([]rune(word)[0]) {
+		return true
+	}
+	return sentenceAbbreviations[strings.ToLower(word)]
+}
@@ -0,0 +1,314 @@
+package pkg
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/RoaringBitmap/roaring/v2"
+)
+
+// cacheShards is how many shards BuildNgramCache splits each n-gram index
+// into; 0 or 1 writes single files
+var cacheShards = 0
+
+// SetCacheShards splits each n's uniq{n}gram.txt, {n}gramindex.txt and
+// {n}gramindex.bin into shards (uniq2gram.000.txt ... uniq2gram.015.txt),
+// partitioned by a hash of the n-gram, so readers can scan them concurrently.
+// The lines of a shard keep the global first-occurrence order and each index
+// line still carries the n-gram's global number, so {n}gramfiles.txt is the
+// same either way.
+func SetCacheShards(shards int) {
+	cacheShards = max(0, shards)
+}
+
+// shardCount returns the number of parts new n-gram indexes are written as
+func shardCount() int {
+	return max(1, cacheShards)
+}
+
+// ngramShardOf returns the shard an n-gram key goes to
+func ngramShardOf(key string, shards int) int {
+	if shards <= 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(shards))
+}
+
+// shardName inserts a shard number before the extension: 2gramindex.txt
+// becomes 2gramindex.003.txt
+func shardName(path string, shard int) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s.%03d%s", strings.TrimSuffix(path, ext), shard, ext)
+}
+
+// NgramIndexPart is one aligned pair of n-gram key and posting files: line i
+// of Uniq is the n-gram whose files are on line i of Index (and entry i of
+// the binary postings next to it)
+type NgramIndexPart struct {
+	Uniq  string
+	Index string
+}
+
+// NgramIndexParts returns the parts of the n-gram index of n in a cache:
+// one for an unsharded index, one per shard otherwise, none if it was not built
+func NgramIndexParts(cacheDir string, n int) []NgramIndexPart {
+	uniq := filepath.Join(cacheDir, fmt.Sprintf("uniq%dgram.txt", n))
+	index := filepath.Join(cacheDir, fmt.Sprintf("%dgramindex.txt", n))
+
+	var parts []NgramIndexPart
+	for s := 0; CacheFileExists(shardName(uniq, s)); s++ {
+		parts = append(parts, NgramIndexPart{shardName(uniq, s), shardName(index, s)})
+	}
+	if len(parts) == 0 && CacheFileExists(uniq) {
+		parts = append(parts, NgramIndexPart{uniq, index})
+	}
+	return parts
+}
+
+// ngramIndexComplete reports whether every part of the index of n has its
+// binary postings, i.e. an earlier build wrote it to the end
+func ngramIndexComplete(cacheDir string, n int) bool {
+	parts := NgramIndexParts(cacheDir, n)
+	for _, part := range parts {
+		if !fileExists(PostingsPath(part.Index)) {
+			return false
+		}
+	}
+	return len(parts) > 0
+}
+
+// ngramIndexArtifacts returns the files of the n-gram indexes for n = 2..maxN,
+// relative to cacheDir, for the manifest
+func ngramIndexArtifacts(cacheDir string, maxN int) []string {
+	var names []string
+	for n := 2; n <= maxN; n++ {
+		for _, part := range NgramIndexParts(cacheDir, n) {
+			for _, path := range []string{part.Uniq, part.Index, PostingsPath(part.Index)} {
+				if rel, err := filepath.Rel(cacheDir, path); err == nil {
+					names = append(names, rel)
+				}
+			}
+		}
+	}
+	return names
+}
+
+// ngramIndexSummary describes the files of the index of n for progress output
+func ngramIndexSummary(cacheDir string, n int) string {
+	parts := NgramIndexParts(cacheDir, n)
+	if len(parts) == 0 {
+		return "nothing"
+	}
+	first := parts[0]
+	files := fmt.Sprintf("%s, %s, %s", first.Uniq, first.Index, PostingsPath(first.Index))
+	if len(parts) > 1 {
+		return fmt.Sprintf("%d shards (%s, ...)", len(parts), files)
+	}
+	return files
+}
+
+// removeNgramIndex removes the index of n in both layouts
+func removeNgramIndex(cacheDir string, n int) {
+	for _, part := range NgramIndexParts(cacheDir, n) {
+		RemoveCacheFile(part.Uniq)
+		RemoveCacheFile(part.Index)
+		os.Remove(PostingsPath(part.Index))
+	}
+}
+
+// ngramIndexWriter writes the n-gram index of one n, numbering n-grams in the
+// order they are added and routing each to its shard
+type ngramIndexWriter struct {
+	parts []*indexPartWriter
+	next  int
+}
+
+type indexPartWriter struct {
+	uniq, index   io.WriteCloser
+	uniqW, indexW *bufio.Writer
+	postings      *postingsWriter
+}
+
+// createNgramIndex replaces the index of n with counts[s] n-grams in shard s;
+// a single count writes the unsharded files
+func createNgramIndex(cacheDir string, n int, counts []int) (*ngramIndexWriter, error) {
+	removeNgramIndex(cacheDir, n)
+
+	uniq := filepath.Join(cacheDir, fmt.Sprintf("uniq%dgram.txt", n))
+	index := filepath.Join(cacheDir, fmt.Sprintf("%dgramindex.txt", n))
+	w := &ngramIndexWriter{}
+	for s, count := range counts {
+		uniqPath, indexPath := uniq, index
+		if len(counts) > 1 {
+			uniqPath, indexPath = shardName(uniq, s), shardName(index, s)
+		}
+		part := &indexPartWriter{}
+		w.parts = append(w.parts, part)
+
+		var err error
+		if part.uniq, err = CreateCacheFile(uniqPath); err != nil {
+			w.abort()
+			return nil, err
+		}
+		if part.index, err = CreateCacheFile(indexPath); err != nil {
+			w.abort()
+			return nil, err
+		}
+		if part.postings, err = createPostings(PostingsPath(indexPath), count); err != nil {
+			w.abort()
+			return nil, err
+		}
+		part.uniqW = bufio.NewWriter(part.uniq)
+		part.indexW = bufio.NewWriter(part.index)
+	}
+	return w, nil
+}
+
+// ngramShardCounts returns how many of keys go to each of shards shards
+func ngramShardCounts(keys []string, shards int) []int {
+	counts := make([]int, shards)
+	for _, key := range keys {
+		counts[ngramShardOf(key, shards)]++
+	}
+	return counts
+}
+
+// add writes the next n-gram and its files
+func (w *ngramIndexWriter) add(key string, files *roaring.Bitmap) error {
+	part := w.parts[ngramShardOf(key, len(w.parts))]
+	files.RunOptimize()
+	part.uniqW.WriteString(key)
+	part.uniqW.WriteString("\n")
+	writeIndexLine(part.indexW, w.next, files)
+	w.next++
+	return part.postings.add(files)
+}
+
+// close flushes and closes every part
+func (w *ngramIndexWriter) close() error {
+	var firstErr error
+	keep := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	for _, part := range w.parts {
+		keep(part.uniqW.Flush())
+		keep(part.indexW.Flush())
+		keep(part.uniq.Close())
+		keep(part.index.Close())
+		keep(part.postings.close())
+	}
+	return firstErr
+}
+
+// abort closes whatever parts were opened without finishing them
+func (w *ngramIndexWriter) abort() {
+	for _, part := range w.parts {
+		if part.uniq != nil {
+			AbortCacheFile(part.uniq)
+		}
+		if part.index != nil {
+			AbortCacheFile(part.index)
+		}
+		if part.postings != nil {
+			part.postings.abort()
+		}
+	}
+}
+
+// scanNgramIndex calls fn with the global number, key and files of every
+// n-gram in the index of n, shard by shard
+func scanNgramIndex(cacheDir string, n int, fn func(idx int, key string, files *roaring.Bitmap)) error {
+	parts := NgramIndexParts(cacheDir, n)
+	if len(parts) == 0 {
+		return fmt.Errorf("no %d-gram index in %s", n, cacheDir)
+	}
+	for _, part := range parts {
+		if err := scanNgramIndexPart(part, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func scanNgramIndexPart(part NgramIndexPart, fn func(idx int, key string, files *roaring.Bitmap)) error {
+	keys, err := readLines(part.Uniq)
+	if err != nil {
+		return err
+	}
+	line := 0
+	return scanIndexFile(part.Index, func(idx int, files *roaring.Bitmap) {
+		if line < len(keys) {
+			fn(idx, keys[line], files)
+		}
+		line++
+	})
+}
+
+// LookupNgram returns the files of the n-gram made of words from the index of
+// len(words), or an empty set if the index does not have it. Only the shard
+// the n-gram hashes to is read. The error wraps os.ErrNotExist if the index
+// of that n was not built.
+func LookupNgram(cacheDir string, words []int) (*roaring.Bitmap, error) {
+	parts := NgramIndexParts(cacheDir, len(words))
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("no %d-gram index in %s: %w", len(words), cacheDir, os.ErrNotExist)
+	}
+	keyParts := make([]string, len(words))
+	for i, w := range words {
+		keyParts[i] = strconv.Itoa(w)
+	}
+	key := strings.Join(keyParts, "|")
+	part := parts[ngramShardOf(key, len(parts))]
+
+	f, err := OpenCacheFile(part.Uniq)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	line := -1
+	for i := 0; scanner.Scan(); i++ {
+		if scanner.Text() == key {
+			line = i
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if line < 0 {
+		return roaring.New(), nil
+	}
+
+	// Prefer the binary postings; older caches only have the text index
+	if postings, err := OpenPostings(PostingsPath(part.Index)); err == nil {
+		defer postings.Close()
+		return postings.Get(line)
+	}
+	var files *roaring.Bitmap
+	i := 0
+	err = scanIndexFile(part.Index, func(_ int, set *roaring.Bitmap) {
+		if i == line {
+			files = set
+		}
+		i++
+	})
+	if err != nil {
+		return nil, err
+	}
+	if files == nil {
+		return nil, fmt.Errorf("%s has no line %d", part.Index, line+1)
+	}
+	return files, nil
+}
@@ -0,0 +1,113 @@
+package pkg
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/RoaringBitmap/roaring/v2"
+)
+
+// SimilarFile is a file sharing n-grams with another. Jaccard is the shared
+// n-grams over the n-grams either file has.
+type SimilarFile struct {
+	Index   int
+	Shared  int
+	Jaccard float64
+}
+
+// SimilarFiles ranks the other files of a cache by the Jaccard similarity of
+// their distinct n-grams to those of file fileIdx, from {n}gramfiles.txt
+// (-cache ngramfiles). It returns the top most similar (0 = all) that share
+// at least one n-gram.
+func SimilarFiles(cacheDir string, fileIdx, n, top int) ([]SimilarFile, error) {
+	path := filepath.Join(cacheDir, fmt.Sprintf("%dgramfiles.txt", n))
+	if !CacheFileExists(path) {
+		return nil, fmt.Errorf("no %dgramfiles.txt in %s (run -cache ngramfiles -ngrams %d)", n, cacheDir, n)
+	}
+	var target *roaring.Bitmap
+	err := scanIndexFile(path, func(idx int, ngrams *roaring.Bitmap) {
+		if idx == fileIdx {
+			target = ngrams
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if target == nil {
+		return nil, fmt.Errorf("file %d is not in %dgramfiles.txt", fileIdx, n)
+	}
+
+	size := int(target.GetCardinality())
+	var similar []SimilarFile
+	err = scanIndexFile(path, func(idx int, ngrams *roaring.Bitmap) {
+		if idx == fileIdx {
+			return
+		}
+		shared := int(target.AndCardinality(ngrams))
+		if shared == 0 {
+			return
+		}
+		union := size + int(ngrams.GetCardinality()) - shared
+		similar = append(similar, SimilarFile{Index: idx, Shared: shared, Jaccard: float64(shared) / float64(union)})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(similar, func(i, j int) bool {
+		if similar[i].Jaccard != similar[j].Jaccard {
+			return similar[i].Jaccard > similar[j].Jaccard
+		}
+		return similar[i].Index < similar[j].Index
+	})
+	return firstN(similar, top), nil
+}
+
+// FileNgram is an n-gram of a file and the number of files of the cache
+// containing it
+type FileNgram struct {
+	Words []int
+	Files int
+}
+
+// FileNgrams returns the n-grams of file fileIdx, from {n}gramfiles.txt
+// (-cache ngramfiles) and the n-gram index, the top (0 = all) found in the
+// most files first
+func FileNgrams(cacheDir string, fileIdx, n, top int) ([]FileNgram, error) {
+	path := filepath.Join(cacheDir, fmt.Sprintf("%dgramfiles.txt", n))
+	if !CacheFileExists(path) {
+		return nil, fmt.Errorf("no %dgramfiles.txt in %s (run -cache ngramfiles -ngrams %d)", n, cacheDir, n)
+	}
+	var target *roaring.Bitmap
+	err := scanIndexFile(path, func(idx int, ngrams *roaring.Bitmap) {
+		if idx == fileIdx {
+			target = ngrams
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if target == nil {
+		return nil, fmt.Errorf("file %d is not in %dgramfiles.txt", fileIdx, n)
+	}
+
+	var ngrams []FileNgram
+	err = scanNgramIndex(cacheDir, n, func(idx int, key string, files *roaring.Bitmap) {
+		if !target.Contains(uint32(idx)) {
+			return
+		}
+		var words []int
+		for _, w := range strings.Split(key, "|") {
+			id, _ := strconv.Atoi(w)
+			words = append(words, id)
+		}
+		ngrams = append(ngrams, FileNgram{Words: words, Files: int(files.GetCardinality())})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(ngrams, func(i, j int) bool { return ngrams[i].Files > ngrams[j].Files })
+	return firstN(ngrams, top), nil
+}
@@ -0,0 +1,213 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// StepSkipgrams is the cache step that counts n-grams with wildcard gaps
+const StepSkipgrams = "skipgrams"
+
+// SkipgramWildcard stands for any single word in a skip-gram key
+const SkipgramWildcard = "*"
+
+// maxSkipgramN caps skip-gram length: the number of gap patterns grows
+// quadratically with n, and templates rarely need more than three fixed words
+const maxSkipgramN = 6
+
+// skipgramPatterns returns, for length n, the gap positions of every pattern
+// with one or two gaps. Gaps are interior, so a skip-gram always begins and
+// ends with a real word.
+func skipgramPatterns(n int) [][]int {
+	var patterns [][]int
+	for a := 1; a < n-1; a++ {
+		patterns = append(patterns, []int{a})
+		for b := a + 1; b < n-1; b++ {
+			patterns = append(patterns, []int{a, b})
+		}
+	}
+	return patterns
+}
+
+// skipgramKey builds the "w1|*|w3" key of words[i:i+n] with gaps at the
+// given offsets
+func skipgramKey(words []int, i, n int, gaps []int, parts []string) string {
+	for j := 0; j < n; j++ {
+		parts[j] = strconv.Itoa(words[i+j])
+	}
+	for _, g := range gaps {
+		parts[g] = SkipgramWildcard
+	}
+	return strings.Join(parts, "|")
+}
+
+// BuildSkipgramCache counts n-grams of length 3 to maxN (capped at 6) in
+// which one or two interior words are replaced by a wildcard, e.g. "the * of",
+// and writes those seen at least the minimum count to {n}skipgramfreq.txt,
+// most frequent first. This surfaces templated text whose slots vary (names,
+// dates, amounts), which never repeats as a contiguous n-gram.
+func BuildSkipgramCache(ctx context.Context, outputDir string, maxN int) error {
+	if maxN > maxSkipgramN {
+		logger.Warn("Limiting skip-grams", "words", maxSkipgramN, "asked", maxN)
+		maxN = maxSkipgramN
+	}
+	logger.Info("Building skip-gram frequency cache (1-2 gaps)", "dir", outputDir, "maxN", maxN)
+	reporter.OnStage(StepSkipgrams)
+
+	if maxN < 3 {
+		return fmt.Errorf("skip-grams need at least 3 words (use -ngrams 3 or more)")
+	}
+	if err := beginStep(outputDir, StepSkipgrams); err != nil {
+		return err
+	}
+
+	tokenInputDir := readCacheInput(outputDir)
+	if tokenInputDir == "" {
+		return fmt.Errorf("could not find input path in settings.txt (run -cache tokens first)")
+	}
+	words, err := readLines(filepath.Join(outputDir, "uniq.txt"))
+	if err != nil {
+		return fmt.Errorf("could not read uniq.txt (run -cache tokens first): %w", err)
+	}
+	filesList, err := readLines(filepath.Join(outputDir, "files.txt"))
+	if err != nil {
+		return fmt.Errorf("could not read files.txt (run -cache tokens first): %w", err)
+	}
+	logger.Info("Loaded cache", "words", len(words), "files", len(filesList))
+
+	wordToIndex := indexWords(words)
+	src := newTokenSource(outputDir, tokenInputDir, wordToIndex)
+	src.breaks = sentenceBoundaries
+	filter := newNgramFilter(wordToIndex)
+	cp := loadCheckpoint(outputDir, StepSkipgrams)
+	for n := 3; n <= maxN; n++ {
+		freqPath := filepath.Join(outputDir, fmt.Sprintf("%dskipgramfreq.txt", n))
+		if cp.done(n) && CacheFileExists(freqPath) {
+			logger.Info("Skipping skip-grams completed by an earlier run", "n", n)
+			continue
+		}
+		patterns := skipgramPatterns(n)
+		logger.Info("Processing skip-grams", "n", n, "patterns", len(patterns))
+		reporter.OnStage(ngramStage(StepSkipgrams, n))
+
+		start, runs, err := cp.resumeN(outputDir, n)
+		if err != nil {
+			return err
+		}
+		if start > 0 {
+			logger.Info("Resuming", "n", n, "file", start, "total", len(filesList), "runs", len(runs))
+		}
+		runDir := cp.runDir(outputDir, n)
+
+		partial := make([]map[string]int, cacheWorkerCount(len(filesList)))
+		lastCheck := make([]int, len(partial))
+		for w := range partial {
+			partial[w] = make(map[string]int)
+		}
+
+		var runsMu sync.Mutex
+		spill := func(counts map[string]int) error {
+			runsMu.Lock()
+			defer runsMu.Unlock()
+			path, err := spillCounts(runDir, counts, len(runs))
+			if err != nil {
+				return err
+			}
+			runs = append(runs, path)
+			logger.Info("Spilled skip-grams", "n", n, "count", len(counts), "path", path)
+			return nil
+		}
+
+		checkpoint := func(next int) error {
+			for w, counts := range partial {
+				if len(counts) > 0 {
+					if err := spill(counts); err != nil {
+						return err
+					}
+					partial[w] = make(map[string]int)
+					lastCheck[w] = 0
+				}
+			}
+			runtime.GC()
+			return cp.commit(outputDir, next, runs)
+		}
+
+		err = forEachTokenChunk(ctx, src, filesList, start, func(worker, fileIdx int, words []int) error {
+			parts := make([]string, n)
+			for i := 0; i <= len(words)-n; i++ {
+				if filter.skip(words, i, n) {
+					continue
+				}
+				counts := partial[worker]
+				for _, gaps := range patterns {
+					counts[skipgramKey(words, i, n, gaps, parts)]++
+				}
+
+				if cacheRAMLimit > 0 && len(counts)-lastCheck[worker] >= spillCheckInterval {
+					lastCheck[worker] = len(counts)
+					if memoryExceeded() {
+						if err := spill(counts); err != nil {
+							return fmt.Errorf("could not spill skip-gram counts: %w", err)
+						}
+						partial[worker] = make(map[string]int)
+						lastCheck[worker] = 0
+						runtime.GC()
+					}
+				}
+			}
+			return nil
+		}, func(done int) {
+			reporter.OnFile(done, len(filesList))
+		}, checkpoint)
+		if err != nil {
+			return err
+		}
+
+		var total, kept int
+		if len(runs) > 0 {
+			for _, counts := range partial {
+				if err == nil && len(counts) > 0 {
+					err = spill(counts)
+				}
+			}
+			partial = nil
+			if err == nil {
+				total, kept, err = externalFreq(runDir, runs, ngramMinCount, freqPath)
+			}
+		} else {
+			merged := partial[0]
+			for _, counts := range partial[1:] {
+				for key, count := range counts {
+					merged[key] += count
+				}
+			}
+			partial = nil
+			total, kept, err = freqFromRecords(runDir, func(emit func(countRecord) error) error {
+				for key, count := range merged {
+					if err := emit(countRecord{key, count}); err != nil {
+						return err
+					}
+				}
+				return nil
+			}, ngramMinCount, freqPath)
+		}
+		if err != nil {
+			return fmt.Errorf("could not write %d-word skip-grams: %w", n, err)
+		}
+		logger.Info("Found skip-grams", "n", n, "kept", kept, "minCount", ngramMinCount, "total", total)
+		logger.Info("Written", "path", freqPath)
+		if err := cp.finishN(outputDir, n); err != nil {
+			return err
+		}
+	}
+	cp.finish(outputDir)
+
+	logger.Info("Done")
+	// maxN 0 leaves the manifest's built n-gram size to the n-gram steps
+	return finishStep(outputDir, StepSkipgrams, 0, ngramArtifacts(maxN, "%dskipgramfreq.txt")...)
+}
@@ -0,0 +1,184 @@
+package pkg
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+
+	"github.com/extrame/ole2"
+)
+
+// sniffContent lets the file's magic bytes override a missing or wrong extension
+var sniffContent = true
+
+// SetContentSniffing controls whether ExtractContent inspects file contents to
+// pick the extractor when the extension is missing, unknown or wrong
+func SetContentSniffing(enabled bool) {
+	sniffContent = enabled
+}
+
+// binarySignatures identify formats by their first bytes
+var binarySignatures = []struct {
+	magic []byte
+	ext   string
+}{
+	{[]byte("%PDF-"), ".pdf"},
+	{[]byte(`{\rtf`), ".rtf"},
+	{[]byte("AT&TFORM"), ".djvu"},
+	{[]byte("!BDN"), ".pst"},
+	{[]byte("\x89PNG\r\n\x1a\n"), ".png"},
+	{[]byte{0xFF, 0xD8, 0xFF}, ".jpg"},
+	{[]byte("GIF87a"), ".gif"},
+	{[]byte("GIF89a"), ".gif"},
+	{[]byte("II*\x00"), ".tiff"},
+	{[]byte("MM\x00*"), ".tiff"},
+}
+
+// sniffExtension returns the extension of the format src actually contains.
+// Binary signatures override the given extension; text heuristics only apply
+// when the extension has no extractor. ext is returned if nothing better is found.
+func sniffExtension(src source, ext string) string {
+	head := make([]byte, 8192)
+	n, err := src.r.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return ext
+	}
+	head = head[:n]
+	if len(head) == 0 {
+		return ext
+	}
+
+	sniffed := sniffBinary(src, head)
+	if sniffed == "" && builtinExtractor(ext) == nil {
+		sniffed = sniffText(head)
+	}
+	if sniffed == "" || builtinExtractor(sniffed) == nil {
+		return ext
+	}
+	// Keep the extension when it is a compatible variant (.jpeg for .jpg, .htm for .html, ...)
+	if sameFormat(ext, sniffed) {
+		return ext
+	}
+	return sniffed
+}
+
+func sniffBinary(src source, head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		return sniffZip(src)
+	case bytes.HasPrefix(head, oleSignature):
+		return sniffOLE(src)
+	}
+	for _, sig := range binarySignatures {
+		if bytes.HasPrefix(head, sig.magic) {
+			return sig.ext
+		}
+	}
+	// "BM" alone is too common in text; the BMP header's reserved words are zero
+	if len(head) >= 14 && bytes.HasPrefix(head, []byte("BM")) && bytes.Equal(head[6:10], []byte{0, 0, 0, 0}) {
+		return ".bmp"
+	}
+	return ""
+}
+
+// sniffZip tells OOXML, EPUB and XPS packages apart by their members
+func sniffZip(src source) string {
+	r, err := zip.NewReader(src.r, src.size)
+	if err != nil {
+		return ""
+	}
+	for _, f := range r.File {
+		name := strings.ToLower(f.Name)
+		switch {
+		case name == "mimetype":
+			if rc, err := f.Open(); err == nil {
+				mime, _ := io.ReadAll(io.LimitReader(rc, 64))
+				rc.Close()
+				if strings.TrimSpace(string(mime)) == "application/epub+zip" {
+					return ".epub"
+				}
+			}
+		case strings.HasPrefix(name, "word/"):
+			return ".docx"
+		case strings.HasPrefix(name, "xl/"):
+			return ".xlsx"
+		case strings.HasPrefix(name, "ppt/"):
+			return ".pptx"
+		case strings.HasSuffix(name, ".fdseq"):
+			return ".xps"
+		}
+	}
+	return ""
+}
+
+// sniffOLE tells Word, Excel and Outlook compound files apart by their streams
+func sniffOLE(src source) (ext string) {
+	// Malformed compound files can make the OLE reader panic
+	defer func() {
+		if recover() != nil {
+			ext = ""
+		}
+	}()
+
+	ole, err := ole2.Open(src.reader(), "utf-8")
+	if err != nil {
+		return ""
+	}
+	dir, err := ole.ListDir()
+	if err != nil {
+		return ""
+	}
+	for _, f := range dir {
+		name := f.Name()
+		switch {
+		case name == "WordDocument":
+			return ".doc"
+		case name == "Workbook" || name == "Book":
+			return ".xls"
+		case strings.HasPrefix(name, msgPropStream):
+			return ".msg"
+		}
+	}
+	return ""
+}
+
+// sniffText recognizes text formats for files whose extension has no extractor
+func sniffText(head []byte) string {
+	// NUL bytes mean binary data (UTF-16 text has a BOM that decodeText handles)
+	if bytes.IndexByte(head, 0) != -1 && !bytes.HasPrefix(head, []byte{0xFF, 0xFE}) && !bytes.HasPrefix(head, []byte{0xFE, 0xFF}) {
+		return ""
+	}
+
+	trimmed := bytes.TrimLeft(bytes.TrimPrefix(head, []byte{0xEF, 0xBB, 0xBF}), " \t\r\n")
+	lower := strings.ToLower(string(trimmed[:min(len(trimmed), 512)]))
+	switch {
+	case strings.HasPrefix(lower, "<!doctype html"), strings.HasPrefix(lower, "<html"):
+		return ".html"
+	case strings.HasPrefix(lower, "webvtt"):
+		return ".vtt"
+	case strings.HasPrefix(lower, "from ") && strings.Contains(lower, "\nfrom:"):
+		return ".mbox"
+	}
+	for _, header := range []string{"received:", "return-path:", "message-id:", "mime-version:", "delivered-to:"} {
+		if strings.HasPrefix(lower, header) {
+			return ".eml"
+		}
+	}
+	return ".txt"
+}
+
+// sameFormat reports whether two extensions select the same extractor family
+func sameFormat(a, b string) bool {
+	aliases := map[string]string{
+		".jpeg": ".jpg", ".tif": ".tiff", ".htm": ".html", ".djv": ".djvu",
+		".oxps": ".xps", ".ltx": ".tex",
+	}
+	if alias, ok := aliases[a]; ok {
+		a = alias
+	}
+	if alias, ok := aliases[b]; ok {
+		b = alias
+	}
+	return a == b
+}
@@ -0,0 +1,273 @@
+package pkg
+
+import (
+	"bufio"
+	"container/heap"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// cacheRAMLimit is the soft memory limit for the cache builders, 0 for none.
+// Like ProcessOptions.RAMLimit it is compared against the live heap (MemStats.Alloc).
+var cacheRAMLimit uint64
+
+// SetCacheRAMLimit sets the soft memory limit above which the cache builders
+// spill partial results to disk instead of growing their in-memory maps
+func SetCacheRAMLimit(limit uint64) {
+	cacheRAMLimit = limit
+}
+
+// spillCheckInterval is how many new map entries may be added between heap checks
+const spillCheckInterval = 100000
+
+// memoryExceeded reports whether the heap has reached cacheRAMLimit
+func memoryExceeded() bool {
+	if cacheRAMLimit == 0 {
+		return false
+	}
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.Alloc >= cacheRAMLimit
+}
+
+// countRecord is one "key,count" line of a run or frequency file
+type countRecord struct {
+	key   string
+	count int
+}
+
+// byCountDesc orders frequency output: most frequent first, then by key
+func byCountDesc(a, b countRecord) bool {
+	if a.count != b.count {
+		return a.count > b.count
+	}
+	return a.key < b.key
+}
+
+func byKey(a, b countRecord) bool {
+	return a.key < b.key
+}
+
+// spillCounts writes counts sorted by key as a run file and returns its path
+func spillCounts(dir string, counts map[string]int, run int) (string, error) {
+	records := make([]countRecord, 0, len(counts))
+	for key, count := range counts {
+		records = append(records, countRecord{key, count})
+	}
+	sort.Slice(records, func(i, j int) bool { return byKey(records[i], records[j]) })
+	return writeRun(filepath.Join(dir, fmt.Sprintf("counts-%04d.txt", run)), records)
+}
+
+// writeRun writes records as "key,count" lines
+func writeRun(path string, records []countRecord) (string, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("could not create %s: %w", path, err)
+	}
+	defer f.Close()
+	return path, writeRecords(f, records)
+}
+
+func writeRecords(w io.Writer, records []countRecord) error {
+	writer := bufio.NewWriter(w)
+	for _, r := range records {
+		writer.WriteString(r.key)
+		writer.WriteString(",")
+		writer.WriteString(strconv.Itoa(r.count))
+		writer.WriteString("\n")
+	}
+	return writer.Flush()
+}
+
+// runReader streams the records of one run file
+type runReader struct {
+	f       *os.File
+	scanner *bufio.Scanner
+	current countRecord
+}
+
+func openRun(path string) (*runReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	return &runReader{f: f, scanner: scanner}, nil
+}
+
+// next advances to the next record, returning false at the end of the run
+func (r *runReader) next() bool {
+	for r.scanner.Scan() {
+		line := r.scanner.Text()
+		commaIdx := strings.LastIndex(line, ",")
+		if commaIdx == -1 {
+			continue
+		}
+		count, err := strconv.Atoi(line[commaIdx+1:])
+		if err != nil {
+			continue
+		}
+		r.current = countRecord{line[:commaIdx], count}
+		return true
+	}
+	return false
+}
+
+// runHeap orders open runs by their current record
+type runHeap struct {
+	runs []*runReader
+	less func(a, b countRecord) bool
+}
+
+func (h *runHeap) Len() int           { return len(h.runs) }
+func (h *runHeap) Less(i, j int) bool { return h.less(h.runs[i].current, h.runs[j].current) }
+func (h *runHeap) Swap(i, j int)      { h.runs[i], h.runs[j] = h.runs[j], h.runs[i] }
+func (h *runHeap) Push(x any)         { h.runs = append(h.runs, x.(*runReader)) }
+func (h *runHeap) Pop() any {
+	last := h.runs[len(h.runs)-1]
+	h.runs = h.runs[:len(h.runs)-1]
+	return last
+}
+
+// mergeRuns k-way merges run files sorted by less and calls emit for each
+// record in order. With combine set, records with the same key (adjacent when
+// runs are sorted by key) are summed into one.
+func mergeRuns(paths []string, less func(a, b countRecord) bool, combine bool, emit func(countRecord) error) error {
+	h := &runHeap{less: less}
+	defer func() {
+		for _, r := range h.runs {
+			r.f.Close()
+		}
+	}()
+	for _, path := range paths {
+		r, err := openRun(path)
+		if err != nil {
+			return err
+		}
+		if r.next() {
+			h.runs = append(h.runs, r)
+		} else {
+			r.f.Close()
+		}
+	}
+	heap.Init(h)
+
+	var pending countRecord
+	hasPending := false
+	for h.Len() > 0 {
+		r := h.runs[0]
+		rec := r.current
+		if r.next() {
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+			r.f.Close()
+		}
+
+		if !combine {
+			if err := emit(rec); err != nil {
+				return err
+			}
+			continue
+		}
+		if hasPending && pending.key == rec.key {
+			pending.count += rec.count
+			continue
+		}
+		if hasPending {
+			if err := emit(pending); err != nil {
+				return err
+			}
+		}
+		pending, hasPending = rec, true
+	}
+	if hasPending {
+		return emit(pending)
+	}
+	return nil
+}
+
+// externalFreq turns spilled count runs into a frequency file: counts are
+// merged by key, n-grams seen fewer than minCount times dropped, and the rest
+// sorted by count, spilling again while the filtered set exceeds the RAM limit
+func externalFreq(dir string, runs []string, minCount int, outPath string) (total, kept int, err error) {
+	return freqFromRecords(dir, func(emit func(countRecord) error) error {
+		return mergeRuns(runs, byKey, true, emit)
+	}, minCount, outPath)
+}
+
+// freqFromRecords is externalFreq over records produced by each, one per key
+func freqFromRecords(dir string, each func(emit func(countRecord) error) error, minCount int, outPath string) (total, kept int, err error) {
+	var sorted []string
+	var buf []countRecord
+	flush := func() error {
+		sort.Slice(buf, func(i, j int) bool { return byCountDesc(buf[i], buf[j]) })
+		path, err := writeRun(filepath.Join(dir, fmt.Sprintf("freq-%04d.txt", len(sorted))), buf)
+		if err != nil {
+			return err
+		}
+		sorted = append(sorted, path)
+		buf = nil
+		runtime.GC()
+		return nil
+	}
+
+	err = each(func(rec countRecord) error {
+		total++
+		if rec.count < minCount {
+			return nil
+		}
+		kept++
+		buf = append(buf, rec)
+		if len(buf)%spillCheckInterval == 0 && memoryExceeded() {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return total, kept, err
+	}
+
+	if len(sorted) == 0 {
+		sort.Slice(buf, func(i, j int) bool { return byCountDesc(buf[i], buf[j]) })
+		out, err := CreateCacheFile(outPath)
+		if err != nil {
+			return total, kept, err
+		}
+		defer AbortCacheFile(out)
+		if err := writeRecords(out, buf); err != nil {
+			return total, kept, err
+		}
+		return total, kept, out.Close()
+	}
+	if len(buf) > 0 {
+		if err := flush(); err != nil {
+			return total, kept, err
+		}
+	}
+
+	out, err := CreateCacheFile(outPath)
+	if err != nil {
+		return total, kept, err
+	}
+	defer AbortCacheFile(out)
+	writer := bufio.NewWriter(out)
+	err = mergeRuns(sorted, byCountDesc, false, func(rec countRecord) error {
+		_, err := fmt.Fprintf(writer, "%s,%d\n", rec.key, rec.count)
+		return err
+	})
+	if err != nil {
+		return total, kept, err
+	}
+	if err := writer.Flush(); err != nil {
+		return total, kept, err
+	}
+	return total, kept, out.Close()
+}
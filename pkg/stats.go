@@ -0,0 +1,208 @@
+package pkg
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// StepStats is the cache step that writes document lengths and corpus
+// statistics
+const StepStats = "stats"
+
+// Corpus statistics written by BuildStatsCache. stats.txt has one
+// "fileIdx,tokens,types" line per entry of files.txt; stats.json holds the
+// CorpusStats summary.
+const (
+	StatsName     = "stats.txt"
+	StatsJSONName = "stats.json"
+)
+
+// growthPoints is how many points of the vocabulary growth curve are kept
+const growthPoints = 100
+
+// CorpusStats summarizes a cache's token files. Tokens count vocabulary words,
+// the same positions the n-gram builders use.
+type CorpusStats struct {
+	Files          int           `json:"files"`
+	Tokens         int64         `json:"tokens"`
+	Vocabulary     int           `json:"vocabulary"`
+	AvgDocLength   float64       `json:"avgDocLength"`
+	TypeTokenRatio float64       `json:"typeTokenRatio"`
+	Growth         []GrowthPoint `json:"growth"`
+}
+
+// GrowthPoint is the number of distinct words in the first Files files of
+// files.txt, which together hold Tokens tokens
+type GrowthPoint struct {
+	Files      int   `json:"files"`
+	Tokens     int64 `json:"tokens"`
+	Vocabulary int   `json:"vocabulary"`
+}
+
+// BuildStatsCache records the token and distinct word count of every file,
+// the average document length, the type/token ratio and how the vocabulary
+// grows as files are added
+func BuildStatsCache(ctx context.Context, outputDir string) error {
+	logger.Info("Building corpus statistics", "dir", outputDir)
+	reporter.OnStage(StepStats)
+
+	if err := beginStep(outputDir, StepStats); err != nil {
+		return err
+	}
+
+	tokenInputDir := readCacheInput(outputDir)
+	if tokenInputDir == "" {
+		return fmt.Errorf("could not find input path in settings.txt (run -cache tokens first)")
+	}
+	words, err := readLines(filepath.Join(outputDir, "uniq.txt"))
+	if err != nil {
+		return fmt.Errorf("could not read uniq.txt (run -cache tokens first): %w", err)
+	}
+	filesList, err := readLines(filepath.Join(outputDir, "files.txt"))
+	if err != nil {
+		return fmt.Errorf("could not read files.txt (run -cache tokens first): %w", err)
+	}
+	logger.Info("Loaded cache", "words", len(words), "files", len(filesList))
+
+	// firstFile[w] ends up as the lowest file index word w occurs in, which
+	// gives the growth curve without reading the files in order
+	tokens := make([]int, len(filesList))
+	types := make([]int, len(filesList))
+	firstFile := make([]int32, len(words))
+	for i := range firstFile {
+		firstFile[i] = math.MaxInt32
+	}
+
+	src := newTokenSource(outputDir, tokenInputDir, indexWords(words))
+	err = forEachTokenFile(ctx, src, filesList, func(worker, fileIdx int, ids []int) error {
+		seen := make(map[int]struct{})
+		for _, id := range ids {
+			if id >= 0 && id < len(words) {
+				seen[id] = struct{}{}
+			}
+		}
+		for id := range seen {
+			for {
+				cur := atomic.LoadInt32(&firstFile[id])
+				if int32(fileIdx) >= cur || atomic.CompareAndSwapInt32(&firstFile[id], cur, int32(fileIdx)) {
+					break
+				}
+			}
+		}
+		tokens[fileIdx] = len(ids)
+		types[fileIdx] = len(seen)
+		return nil
+	}, func(done int) {
+		reporter.OnFile(done, len(filesList))
+	})
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(outputDir, StatsName)
+	f, err := createAtomic(path)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(f)
+	for i := range filesList {
+		fmt.Fprintf(writer, "%d,%d,%d\n", i, tokens[i], types[i])
+	}
+	if err := writer.Flush(); err != nil {
+		f.Abort()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	stats := corpusStats(tokens, firstFile)
+	if err := writeCorpusStats(outputDir, stats); err != nil {
+		return err
+	}
+	jsonPath := filepath.Join(outputDir, StatsJSONName)
+
+	logger.Info("Corpus statistics", "tokens", stats.Tokens, "vocabulary", stats.Vocabulary,
+		"avgDocLength", math.Round(stats.AvgDocLength*10)/10, "typeTokenRatio", math.Round(stats.TypeTokenRatio*1e4)/1e4)
+	logger.Info("Done! Statistics written", "path", path, "json", jsonPath)
+	return finishStep(outputDir, StepStats, 0, StatsName, StatsJSONName)
+}
+
+// corpusStats summarizes per-file token counts and the first file of every word
+func corpusStats(tokens []int, firstFile []int32) *CorpusStats {
+	newWords := make([]int, len(tokens))
+	for _, f := range firstFile {
+		if int(f) < len(tokens) {
+			newWords[f]++
+		}
+	}
+
+	stats := &CorpusStats{Files: len(tokens), Growth: []GrowthPoint{}}
+	step := max(1, len(tokens)/growthPoints)
+	vocabulary := 0
+	for i, n := range tokens {
+		stats.Tokens += int64(n)
+		vocabulary += newWords[i]
+		if (i+1)%step == 0 || i == len(tokens)-1 {
+			stats.Growth = append(stats.Growth, GrowthPoint{Files: i + 1, Tokens: stats.Tokens, Vocabulary: vocabulary})
+		}
+	}
+	stats.Vocabulary = vocabulary
+	if len(tokens) > 0 {
+		stats.AvgDocLength = float64(stats.Tokens) / float64(len(tokens))
+	}
+	if stats.Tokens > 0 {
+		stats.TypeTokenRatio = float64(vocabulary) / float64(stats.Tokens)
+	}
+	return stats
+}
+
+// writeCorpusStats writes stats.json
+func writeCorpusStats(cacheDir string, stats *CorpusStats) error {
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(cacheDir, StatsJSONName), append(data, '\n'))
+}
+
+// LoadCorpusStats reads stats.json
+func LoadCorpusStats(cacheDir string) (*CorpusStats, error) {
+	data, err := os.ReadFile(filepath.Join(cacheDir, StatsJSONName))
+	if err != nil {
+		return nil, err
+	}
+	var stats CorpusStats
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return nil, fmt.Errorf("%s: %w", StatsJSONName, err)
+	}
+	return &stats, nil
+}
+
+// LoadDocLengths reads the token count of every file from stats.txt, indexed
+// by file index
+func LoadDocLengths(cacheDir string) ([]int, error) {
+	lines, err := readLines(filepath.Join(cacheDir, StatsName))
+	if err != nil {
+		return nil, err
+	}
+	lengths := make([]int, len(lines))
+	for i, line := range lines {
+		fields := strings.Split(line, ",")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s line %d: expected 3 fields, got %d", StatsName, i+1, len(fields))
+		}
+		if lengths[i], err = strconv.Atoi(fields[1]); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", StatsName, i+1, err)
+		}
+	}
+	return lengths, nil
+}
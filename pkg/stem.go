@@ -0,0 +1,518 @@
+package pkg
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// StemFormsName maps each stem of a stemmed cache to the words it stands
+// for: the language on its first line, "# en", then one line per stem in
+// order, "stem form:count form:count ...", the most frequent form first
+const StemFormsName = "stemforms.txt"
+
+// Stemmer reduces a word to its stem, so "connect", "connected" and
+// "connections" are one word of the vocabulary
+type Stemmer interface {
+	Stem(word string) string
+	Language() string
+}
+
+// stemmer is set by SetStemming; nil leaves words as they are
+var stemmer Stemmer
+
+// stemSuffixes are the endings the light stemmers remove, longest first
+var stemSuffixes = map[string][]string{
+	"de": {"erinnen", "heiten", "keiten", "ungen", "innen", "isch", "heit", "keit", "lich", "ung", "ern", "end", "em", "en", "er", "es", "e", "s"},
+	"fr": {"issements", "issement", "atrices", "ateurs", "ations", "ements", "atrice", "ateur", "ation", "ement", "euses", "iques", "ismes", "istes", "ables", "ibles", "ités", "ment", "euse", "ique", "isme", "iste", "able", "ible", "ives", "ité", "eux", "ive", "ifs", "ées", "és", "ée", "er", "ez", "if", "é", "e", "s", "x"},
+	"es": {"amientos", "imientos", "amiento", "imiento", "aciones", "uciones", "adoras", "adores", "ancias", "idades", "ación", "ución", "adora", "mente", "ancia", "ismos", "ables", "ibles", "istas", "iendo", "idad", "ador", "ismo", "able", "ible", "ista", "osos", "osas", "ivos", "ivas", "ando", "oso", "osa", "ivo", "iva", "ado", "ido", "ar", "er", "ir", "es", "os", "as", "a", "o", "e", "s"},
+	"it": {"amenti", "imenti", "amento", "imento", "azioni", "azione", "atori", "atore", "mente", "abili", "abile", "ibili", "ibile", "ismi", "ismo", "iste", "ista", "ando", "endo", "ità", "osi", "oso", "ose", "osa", "ivi", "ivo", "ive", "iva", "are", "ere", "ire", "ato", "ata", "ati", "ate", "ito", "ita", "iti", "ite", "i", "e", "a", "o"},
+	"pt": {"amentos", "imentos", "amento", "imento", "adoras", "adores", "idades", "ações", "mente", "idade", "ismos", "istas", "adora", "ação", "ismo", "ista", "ável", "ível", "osos", "osas", "ivos", "ivas", "ando", "endo", "indo", "oso", "osa", "ivo", "iva", "ar", "er", "ir", "es", "os", "as", "a", "o", "e", "s"},
+	"nl": {"heden", "ingen", "heid", "lijk", "baar", "ende", "ing", "end", "ers", "en", "er", "es", "e", "s"},
+	"sv": {"heterna", "arnas", "ernas", "ornas", "andes", "arens", "andet", "heten", "heter", "arna", "erna", "orna", "ande", "arne", "aste", "aren", "ades", "erns", "ade", "are", "ern", "ens", "het", "ast", "ad", "en", "ar", "er", "or", "as", "es", "at", "a", "e", "s"},
+}
+
+// StemLanguages returns the language codes NewStemmer knows
+func StemLanguages() []string {
+	langs := []string{"en"}
+	for lang := range stemSuffixes {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// NewStemmer returns the stemmer of a language: Porter's original algorithm
+// for "en", and for the other languages of StemLanguages a light stemmer
+// removing the commonest inflection and derivation endings. Neither is a
+// Snowball stemmer. Stems are lower case.
+func NewStemmer(lang string) (Stemmer, error) {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if lang == "en" {
+		return porterStemmer{}, nil
+	}
+	if suffixes, ok := stemSuffixes[lang]; ok {
+		return suffixStemmer{lang: lang, suffixes: suffixes}, nil
+	}
+	return nil, fmt.Errorf("no stemmer for %q (use %s)", lang, strings.Join(StemLanguages(), ", "))
+}
+
+// SetStemming makes the -cache tokens step, and the steps after it, index
+// the stems of the words in lang (see NewStemmer), recording the words of
+// each stem in stemforms.txt. "" turns stemming off.
+func SetStemming(lang string) error {
+	if lang == "" {
+		stemmer = nil
+		return nil
+	}
+	s, err := NewStemmer(lang)
+	if err != nil {
+		return err
+	}
+	stemmer = s
+	return nil
+}
+
+// stemLanguage is the language of s, "" for nil
+func stemLanguage(s Stemmer) string {
+	if s == nil {
+		return ""
+	}
+	return s.Language()
+}
+
+// CacheStemmer returns the stemmer the tokens step of a cache recorded in
+// settings.txt, or nil if it did not stem
+func CacheStemmer(cacheDir string) (Stemmer, error) {
+	lang, err := cacheSetting(cacheDir, "stem")
+	if err != nil || lang == "" {
+		return nil, err
+	}
+	return NewStemmer(lang)
+}
+
+// Stem returns the stem of word with the stemmer of SetStemming, or word
+// itself without one or for a placeholder token
+func Stem(word string) string {
+	if stemmer == nil || IsPlaceholder(word) {
+		return word
+	}
+	return stemmer.Stem(word)
+}
+
+// tokenWords splits a line of a token file into the words the cache
+// indexes: those of SplitWords, stemmed with the stemmer of SetStemming
+func tokenWords(line string) []string {
+	words := SplitWords(line)
+	if stemmer != nil {
+		for i, w := range words {
+			words[i] = Stem(w)
+		}
+	}
+	return words
+}
+
+// stemForms counts the words of each stem
+type stemForms map[string]map[string]int
+
+// add counts word under its stem and returns the stem
+func (f stemForms) add(word string) string {
+	stem := Stem(word)
+	forms := f[stem]
+	if forms == nil {
+		forms = make(map[string]int)
+		f[stem] = forms
+	}
+	forms[word]++
+	return stem
+}
+
+// addFile counts the words of a token file
+func (f stemForms) addFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	for scanner.Scan() {
+		for _, word := range SplitWords(scanner.Text()) {
+			f.add(word)
+		}
+	}
+	return scanner.Err()
+}
+
+// write writes StemFormsName to cacheDir
+func (f stemForms) write(cacheDir string) error {
+	stems := make([]string, 0, len(f))
+	for stem := range f {
+		stems = append(stems, stem)
+	}
+	sort.Strings(stems)
+
+	out, err := createAtomic(filepath.Join(cacheDir, StemFormsName))
+	if err != nil {
+		return err
+	}
+	defer out.Abort()
+	w := bufio.NewWriter(out)
+	fmt.Fprintf(w, "# %s\n", stemLanguage(stemmer))
+	for _, stem := range stems {
+		w.WriteString(stem)
+		for _, form := range sortedForms(f[stem]) {
+			fmt.Fprintf(w, " %s:%d", form, f[stem][form])
+		}
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// sortedForms returns the words of a stem, the most frequent first
+func sortedForms(counts map[string]int) []string {
+	forms := make([]string, 0, len(counts))
+	for form := range counts {
+		forms = append(forms, form)
+	}
+	sort.Slice(forms, func(i, j int) bool {
+		if counts[forms[i]] != counts[forms[j]] {
+			return counts[forms[i]] > counts[forms[j]]
+		}
+		return forms[i] < forms[j]
+	})
+	return forms
+}
+
+// readStemForms reads the StemFormsName of a cache with the counts
+func readStemForms(cacheDir string) (stemForms, error) {
+	file, err := OpenCacheFile(filepath.Join(cacheDir, StemFormsName))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	forms := make(stemForms)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || fields[0] == "#" {
+			continue
+		}
+		counts := make(map[string]int, len(fields)-1)
+		for _, field := range fields[1:] {
+			colon := strings.LastIndex(field, ":")
+			if colon <= 0 {
+				continue
+			}
+			if n, err := strconv.Atoi(field[colon+1:]); err == nil {
+				counts[field[:colon]] += n
+			}
+		}
+		forms[fields[0]] = counts
+	}
+	return forms, scanner.Err()
+}
+
+// LoadStemForms returns the words of each stem of a stemmed cache, the most
+// frequent first, so a stem can be shown as the word it most often was
+func LoadStemForms(cacheDir string) (map[string][]string, error) {
+	forms, err := readStemForms(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string][]string, len(forms))
+	for stem, counts := range forms {
+		result[stem] = sortedForms(counts)
+	}
+	return result, nil
+}
+
+// updateStemForms adds the words of the token files at paths to the
+// StemFormsName of a cache, for UpdateCache. Words of removed files stay.
+func updateStemForms(cacheDir string, paths []string) error {
+	forms, err := readStemForms(cacheDir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if forms == nil {
+		forms = make(stemForms)
+	}
+	for _, path := range paths {
+		if err := forms.addFile(path); err != nil {
+			continue
+		}
+	}
+	return forms.write(cacheDir)
+}
+
+// suffixStemmer removes the longest ending of its list that leaves a stem of
+// at least three letters
+type suffixStemmer struct {
+	lang     string
+	suffixes []string
+}
+
+func (s suffixStemmer) Stem(word string) string {
+	word = strings.ToLower(word)
+	for _, suffix := range s.suffixes {
+		if strings.HasSuffix(word, suffix) && utf8.RuneCountInString(word)-utf8.RuneCountInString(suffix) >= 3 {
+			return word[:len(word)-len(suffix)]
+		}
+	}
+	return word
+}
+
+func (s suffixStemmer) Language() string {
+	return s.lang
+}
+
+// porterStemmer is Porter's algorithm for English. Words with anything but
+// the letters a to z are only lower-cased.
+type porterStemmer struct{}
+
+func (porterStemmer) Language() string {
+	return "en"
+}
+
+func (porterStemmer) Stem(word string) string {
+	word = strings.ToLower(word)
+	if len(word) <= 2 || strings.IndexFunc(word, func(r rune) bool { return r < 'a' || r > 'z' }) >= 0 {
+		return word
+	}
+	p := &porter{b: []byte(word), k: len(word) - 1}
+	p.step1ab()
+	if p.k > 0 {
+		p.step1c()
+		p.step2()
+		p.step3()
+		p.step4()
+		p.step5()
+	}
+	return string(p.b[:p.k+1])
+}
+
+// porter is a word being stemmed: b[:k+1] is the word so far, and j marks
+// the end of the stem before the suffix last matched by ends
+type porter struct {
+	b    []byte
+	k, j int
+}
+
+// cons reports whether b[i] is a consonant
+func (p *porter) cons(i int) bool {
+	switch p.b[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return i == 0 || !p.cons(i-1)
+	}
+	return true
+}
+
+// m counts the vowel-consonant sequences of b[:j+1]
+func (p *porter) m() int {
+	n, i := 0, 0
+	for ; i <= p.j && p.cons(i); i++ {
+	}
+	for i <= p.j {
+		for ; i <= p.j && !p.cons(i); i++ {
+		}
+		if i > p.j {
+			break
+		}
+		n++
+		for ; i <= p.j && p.cons(i); i++ {
+		}
+	}
+	return n
+}
+
+// vowelInStem reports whether b[:j+1] has a vowel
+func (p *porter) vowelInStem() bool {
+	for i := 0; i <= p.j; i++ {
+		if !p.cons(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// doubleCons reports whether b[i-1:i+1] is a double consonant
+func (p *porter) doubleCons(i int) bool {
+	return i >= 1 && p.b[i] == p.b[i-1] && p.cons(i)
+}
+
+// cvc reports whether b[i-2:i+1] is consonant, vowel, consonant and the
+// last is not w, x or y, as in "hop"
+func (p *porter) cvc(i int) bool {
+	if i < 2 || !p.cons(i) || p.cons(i-1) || !p.cons(i-2) {
+		return false
+	}
+	switch p.b[i] {
+	case 'w', 'x', 'y':
+		return false
+	}
+	return true
+}
+
+// ends reports whether the word ends with s, setting j before it
+func (p *porter) ends(s string) bool {
+	if len(s) > p.k+1 || string(p.b[p.k+1-len(s):p.k+1]) != s {
+		return false
+	}
+	p.j = p.k - len(s)
+	return true
+}
+
+// setTo replaces the suffix after j with s
+func (p *porter) setTo(s string) {
+	p.b = append(p.b[:p.j+1], s...)
+	p.k = p.j + len(s)
+}
+
+// replace replaces the suffix after j with s if the stem has m() > 0
+func (p *porter) replace(s string) {
+	if p.m() > 0 {
+		p.setTo(s)
+	}
+}
+
+// step1ab removes plurals and -ed or -ing
+func (p *porter) step1ab() {
+	if p.b[p.k] == 's' {
+		switch {
+		case p.ends("sses"):
+			p.k -= 2
+		case p.ends("ies"):
+			p.setTo("i")
+		case p.b[p.k-1] != 's':
+			p.k--
+		}
+	}
+	if p.ends("eed") {
+		if p.m() > 0 {
+			p.k--
+		}
+		return
+	}
+	if (p.ends("ed") || p.ends("ing")) && p.vowelInStem() {
+		p.k = p.j
+		switch {
+		case p.ends("at"):
+			p.setTo("ate")
+		case p.ends("bl"):
+			p.setTo("ble")
+		case p.ends("iz"):
+			p.setTo("ize")
+		case p.doubleCons(p.k):
+			switch p.b[p.k] {
+			case 'l', 's', 'z':
+			default:
+				p.k--
+			}
+		default:
+			p.j = p.k
+			if p.m() == 1 && p.cvc(p.k) {
+				p.setTo("e")
+			}
+		}
+	}
+}
+
+// step1c turns a final y into i when there is another vowel in the stem
+func (p *porter) step1c() {
+	if p.ends("y") && p.vowelInStem() {
+		p.b[p.k] = 'i'
+	}
+}
+
+// porterStep2 maps double suffixes to single ones, by the letter before
+// last; porterStep3 the -ic-, -full, -ness endings by the last letter
+var (
+	porterStep2 = map[byte][][2]string{
+		'a': {{"ational", "ate"}, {"tional", "tion"}},
+		'c': {{"enci", "ence"}, {"anci", "ance"}},
+		'e': {{"izer", "ize"}},
+		'l': {{"bli", "ble"}, {"alli", "al"}, {"entli", "ent"}, {"eli", "e"}, {"ousli", "ous"}},
+		'o': {{"ization", "ize"}, {"ation", "ate"}, {"ator", "ate"}},
+		's': {{"alism", "al"}, {"iveness", "ive"}, {"fulness", "ful"}, {"ousness", "ous"}},
+		't': {{"aliti", "al"}, {"iviti", "ive"}, {"biliti", "ble"}},
+		'g': {{"logi", "log"}},
+	}
+	porterStep3 = map[byte][][2]string{
+		'e': {{"icate", "ic"}, {"ative", ""}, {"alize", "al"}},
+		'i': {{"iciti", "ic"}},
+		'l': {{"ical", "ic"}, {"ful", ""}},
+		's': {{"ness", ""}},
+	}
+	porterStep4 = map[byte][]string{
+		'a': {"al"},
+		'c': {"ance", "ence"},
+		'e': {"er"},
+		'i': {"ic"},
+		'l': {"able", "ible"},
+		'n': {"ant", "ement", "ment", "ent"},
+		'o': {"ion", "ou"},
+		's': {"ism"},
+		't': {"ate", "iti"},
+		'u': {"ous"},
+		'v': {"ive"},
+		'z': {"ize"},
+	}
+)
+
+// replaceFirst replaces the first suffix of rules the word ends with
+func (p *porter) replaceFirst(rules [][2]string) {
+	for _, r := range rules {
+		if p.ends(r[0]) {
+			p.replace(r[1])
+			return
+		}
+	}
+}
+
+func (p *porter) step2() {
+	p.replaceFirst(porterStep2[p.b[p.k-1]])
+}
+
+func (p *porter) step3() {
+	p.replaceFirst(porterStep3[p.b[p.k]])
+}
+
+// step4 removes -ant, -ence and the like from a stem with m() > 1
+func (p *porter) step4() {
+	for _, suffix := range porterStep4[p.b[p.k-1]] {
+		if !p.ends(suffix) {
+			continue
+		}
+		if suffix == "ion" && (p.j < 0 || p.b[p.j] != 's' && p.b[p.j] != 't') {
+			return
+		}
+		if p.m() > 1 {
+			p.k = p.j
+		}
+		return
+	}
+}
+
+// step5 removes a final -e and turns -ll into -l where the stem is long
+func (p *porter) step5() {
+	p.j = p.k
+	if p.b[p.k] == 'e' {
+		if a := p.m(); a > 1 || a == 1 && !p.cvc(p.k-1) {
+			p.k--
+		}
+	}
+	if p.b[p.k] == 'l' && p.doubleCons(p.k) && p.m() > 1 {
+		p.k--
+	}
+}
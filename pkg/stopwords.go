@@ -0,0 +1,64 @@
+package pkg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// builtinStopwords are the function words of the languages DetectLanguage
+// knows, lower case and space separated
+var builtinStopwords = map[string]string{
+	"en": `a about above after again against all am an and any are aren't as at be because been before being below between both but by can can't cannot could couldn't did didn't do does doesn't doing don't down during each few for from further had hadn't has hasn't have haven't having he he'd he'll he's her here here's hers herself him himself his how how's i i'd i'll i'm i've if in into is isn't it it's its itself let's me more most mustn't my myself no nor not of off on once only or other ought our ours ourselves out over own same shan't she she'd she'll she's should shouldn't so some such than that that's the their theirs them themselves then there there's these they they'd they'll they're they've this those through to too under until up very was wasn't we we'd we'll we're we've were weren't what what's when when's where where's which while who who's whom why why's will with won't would wouldn't you you'd you'll you're you've your yours yourself yourselves also may might must shall upon within without via per`,
+	"de": `aber alle allem allen aller alles als also am an ander andere anderem anderen anderer anderes anderm andern anderr anders auch auf aus bei bin bis bist da damit dann das dass dasselbe dazu dein deine deinem deinen deiner deines dem demselben den denn denselben der derer derselbe derselben des desselben dessen dich die dies diese dieselbe dieselben diesem diesen dieser dieses dir doch dort du durch ein eine einem einen einer eines einig einige einigem einigen einiger einiges einmal er es etwas euch euer eure eurem euren eurer eures für gegen gewesen hab habe haben hat hatte hatten hier hin hinter ich ihm ihn ihnen ihr ihre ihrem ihren ihrer ihres im in indem ins ist jede jedem jeden jeder jedes jene jenem jenen jener jenes jetzt kann kein keine keinem keinen keiner keines können könnte machen man manche manchem manchen mancher manches mein meine meinem meinen meiner meines mich mir mit muss musste nach nicht nichts noch nun nur ob oder ohne sehr sein seine seinem seinen seiner seines selbst sich sie sind so solche solchem solchen solcher solches soll sollte sondern sonst über um und uns unsere unserem unseren unser unseres unter viel vom von vor während war waren warst was weg weil weiter welche welchem welchen welcher welches wenn werde werden wie wieder will wir wird wirst wo wollen wollte würde würden zu zum zur zwar zwischen`,
+	"fr": `a ai aie aient aies ait as au aura aurai auraient aurais aurait auras aurez auriez aurions aurons auront aux avaient avais avait avec avez aviez avions avons ayant ayez ayons c ce ceci cela celà ces cet cette d dans de des du elle en es est et étaient étais était étant été étiez étions être eu eue eues eûmes eurent eus eusse eussent eusses eussiez eussions eut eût eûtes eux fûmes furent fus fusse fussent fusses fussiez fussions fut fût fûtes ici il ils j je l la le les leur leurs lui m ma mais me même mes moi mon n ne nos notre nous on ont ou où par pas pour qu que quel quelle quelles quels qui s sa sans se sera serai seraient serais serait seras serez seriez serions serons seront ses si son sont sur t ta te tes toi ton tu un une vos votre vous y`,
+	"es": `a al algo algunas algunos ante antes como con contra cual cuando de del desde donde durante e el él ella ellas ellos en entre era erais eran eras eres es esa esas ese eso esos esta estaba estaban estado estais estamos estan estar estas este esto estos estoy fue fueron fui fuimos ha habia habían han has hasta hay he la las le les lo los más me mi mí mis mucho muchos muy nada ni no nos nosotras nosotros nuestra nuestras nuestro nuestros o os otra otras otro otros para pero poco por porque que qué quien quienes se sea sean según ser si sí siempre sin sobre sois somos son soy su sus suya suyas suyo suyos también tanto te tendrá tenemos tengo ti tiene tienen todo todos tu tú tus un una uno unos vosotras vosotros vuestra vuestras vuestro vuestros y ya yo`,
+	"it": `a ad agli ai al alla alle allo anche avere aveva avevano c che chi ci coi col come con contro cui da dagli dai dal dall dalla dalle dallo degli dei del dell della delle dello di dov dove e è ed era erano essere fa gli ha hai hanno ho i il in io l la le lei li lo loro lui ma mi mia mie miei mio ne negli nei nel nell nella nelle nello noi non nostra nostre nostri nostro o per perché più quale quali quella quelle quelli quello questa queste questi questo se sei si sia siamo siete sono su sua sue sugli sui sul sull sulla sulle sullo suo suoi ti tra tu tua tue tuo tuoi tutti tutto un una uno vi voi vostra vostre vostri vostro`,
+	"pt": `a à ao aos aquela aquelas aquele aqueles aquilo as às até com como da das de dela delas dele deles depois do dos e é ela elas ele eles em entre era eram essa essas esse esses esta está estamos estão estas estava estavam este estes eu foi fomos for foram fosse fossem há isso isto já lhe lhes mais mas me mesmo meu meus minha minhas muito na não nas nem no nos nós nossa nossas nosso nossos num numa o os ou para pela pelas pelo pelos por qual quando que quem são se seja sejam sem ser será seu seus só sua suas também te tem têm tinha tu tua tuas um uma você vocês vos`,
+	"nl": `aan al alles als altijd andere ben bij daar dan dat de der deze die dit doch doen door dus een eens en er ge geen geweest haar had heb hebben heeft hem het hier hij hoe hun iemand iets ik in is ja je kan kon kunnen maar me meer men met mij mijn moet na naar niet niets nog nu of om omdat onder ons ook op over reeds te tegen toch toen tot u uit uw van veel voor want waren was wat werd wezen wie wil worden wordt zal ze zelf zich zij zijn zo zonder zou`,
+	"sv": `alla allt att av blev bli blir blivit de dem den denna deras dess dessa det detta dig din dina ditt du där då efter ej eller en er era ert ett från för ha hade han hans har henne hennes hon honom hur här i icke ingen inom inte jag ju kan kunde man med mellan men mig min mina mitt mot mycket ni nu när någon något några och om oss på samma sedan sig sin sina sitta själv skulle som så sådan sådana sådant till under upp ut utan vad var vara varför varit varje vars vart vem vi vid vilka vilkas vilken vilket vår våra vårt än är åt över`,
+	"pl": `a aby ale bardzo bez bo być był była było były będzie ci co czy dla do gdy gdzie go i ich ile im innych ja jak jaki jako je jego jej jest jestem jeszcze jeśli już każdy kiedy kto która które który ku lub ma mi mnie może mu my na nad nam nas nie nic nich nim niż o od on ona one oni oraz po pod przed przez przy są się sobie tak także tam te tego tej ten też to tu tym u w we wiele wszystko z za że żeby`,
+	"ru": `а без более бы был была были было быть в вам вас весь во вот все всего всех вы где да даже для до его ее ей ему если есть еще же за здесь и из или им их к как ко когда кто ли либо мне может мы на над надо наш не него нее нет ни них но ну о об однако он она они оно от очень по под при с со так также такой там те тем то того тоже той только том ты у уже хотя чего чей чем что чтобы чье чья эта эти это я`,
+}
+
+// StopwordLanguages returns the language codes with a built-in stopword list
+func StopwordLanguages() []string {
+	langs := make([]string, 0, len(builtinStopwords))
+	for lang := range builtinStopwords {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// LoadStopwords reads a comma-separated list of stopword sources, each a
+// language code with a built-in list ("en", "de", see StopwordLanguages) or
+// a file with one word per line ('#' starts a comment). A file takes
+// precedence over a language of the same name. Words are lower-cased.
+func LoadStopwords(spec string) (map[string]bool, error) {
+	words := make(map[string]bool)
+	for _, source := range strings.Split(spec, ",") {
+		if source = strings.TrimSpace(source); source == "" {
+			continue
+		}
+		if list, ok := builtinStopwords[strings.ToLower(source)]; ok && !fileExists(source) {
+			for _, w := range strings.Fields(list) {
+				words[w] = true
+			}
+			continue
+		}
+		lines, err := readLines(source)
+		if err != nil {
+			return nil, fmt.Errorf("could not read stopwords (not a file or one of %s): %w", strings.Join(StopwordLanguages(), ", "), err)
+		}
+		for _, line := range lines {
+			if i := strings.IndexByte(line, '#'); i >= 0 {
+				line = line[:i]
+			}
+			if word := strings.ToLower(strings.TrimSpace(line)); word != "" {
+				words[word] = true
+			}
+		}
+	}
+	return words, nil
+}
@@ -0,0 +1,136 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Structured text modes for .json/.yaml/.yml files
+const (
+	StructuredValues = "values" // string values only
+	StructuredKeys   = "keys"   // object keys and string values
+	StructuredRaw    = "raw"    // file contents as-is
+)
+
+var structuredMode = StructuredValues
+
+// SetStructuredMode selects how JSON and YAML documents are turned into text
+func SetStructuredMode(mode string) error {
+	if err := checkStructuredMode(mode); err != nil {
+		return err
+	}
+	structuredMode = mode
+	return nil
+}
+
+func checkStructuredMode(mode string) error {
+	switch mode {
+	case StructuredValues, StructuredKeys, StructuredRaw:
+		return nil
+	}
+	return fmt.Errorf("unknown structured mode: %s (use 'values', 'keys', or 'raw')", mode)
+}
+
+func extractJSON(src source) (*ExtractionResult, error) {
+	if src.cfg.structuredMode == StructuredRaw {
+		return extractPlain(src)
+	}
+	content, err := src.readAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var doc interface{}
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	var sb strings.Builder
+	walkStructured(doc, src.cfg.structuredMode == StructuredKeys, &sb)
+	text := sb.String()
+	return &ExtractionResult{
+		FullText: text,
+		Pages:    []string{text},
+	}, nil
+}
+
+// extractYAML returns one page per YAML document in the stream
+func extractYAML(src source) (*ExtractionResult, error) {
+	if src.cfg.structuredMode == StructuredRaw {
+		return extractPlain(src)
+	}
+	content, err := src.readAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var pages []string
+	var fullTextBuilder strings.Builder
+
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		var doc interface{}
+		err := dec.Decode(&doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var sb strings.Builder
+		walkStructured(doc, src.cfg.structuredMode == StructuredKeys, &sb)
+		text := sb.String()
+		pages = append(pages, text)
+		fullTextBuilder.WriteString(text)
+	}
+
+	return &ExtractionResult{
+		FullText: fullTextBuilder.String(),
+		Pages:    pages,
+	}, nil
+}
+
+// walkStructured writes string values (and keys with withKeys, for
+// StructuredKeys) one per line. Map keys are visited in sorted order so output
+// is stable between runs.
+func walkStructured(v interface{}, withKeys bool, sb *strings.Builder) {
+	switch node := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(node))
+		for k := range node {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if withKeys {
+				sb.WriteString(k)
+				sb.WriteString("\n")
+			}
+			walkStructured(node[k], withKeys, sb)
+		}
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(node))
+		for k, val := range node {
+			converted[fmt.Sprint(k)] = val
+		}
+		walkStructured(converted, withKeys, sb)
+	case []interface{}:
+		for _, item := range node {
+			walkStructured(item, withKeys, sb)
+		}
+	case string:
+		if strings.TrimSpace(node) != "" {
+			sb.WriteString(node)
+			sb.WriteString("\n")
+		}
+	}
+}
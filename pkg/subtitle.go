@@ -0,0 +1,74 @@
+package pkg
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	subtitleTiming = regexp.MustCompile(`^\s*(\d+:)?\d{1,2}:\d{2}[.,]\d{1,3}\s*-->`)
+	subtitleTag    = regexp.MustCompile(`<[^>]*>|\{\\[^}]*\}`)
+	subtitleVoice  = regexp.MustCompile(`<v(?:\.[^ >]*)?\s+([^>]+)>`)
+)
+
+// extractSubtitles keeps the spoken text of SubRip (.srt) and WebVTT (.vtt)
+// files: cue numbers, timestamps, styling and header blocks are removed, and
+// one line is written per cue
+func extractSubtitles(src source) (*ExtractionResult, error) {
+	content, err := src.readAll()
+	if err != nil {
+		return nil, err
+	}
+	text, enc := decodeText(content)
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	var lines []string
+	var cue []string
+	lastLine := ""
+	flush := func() {
+		line := strings.Join(strings.Fields(strings.Join(cue, " ")), " ")
+		cue = cue[:0]
+		// Auto-generated captions repeat the previous cue as they scroll
+		if line == "" || line == lastLine {
+			return
+		}
+		lines = append(lines, line)
+		lastLine = line
+	}
+
+	// Blocks are separated by blank lines
+	for _, block := range strings.Split(text, "\n\n") {
+		blockLines := strings.Split(strings.Trim(block, "\n"), "\n")
+		first := strings.TrimSpace(blockLines[0])
+		// WebVTT header and NOTE/STYLE/REGION blocks carry no speech
+		if strings.HasPrefix(first, "WEBVTT") || strings.HasPrefix(first, "NOTE") ||
+			first == "STYLE" || first == "REGION" {
+			continue
+		}
+
+		inCue := false
+		for _, line := range blockLines {
+			if subtitleTiming.MatchString(line) {
+				inCue = true
+				continue
+			}
+			// Cue numbers (SRT) and cue identifiers (VTT) precede the timing line
+			if !inCue {
+				continue
+			}
+			// Keep the speaker name of WebVTT voice spans
+			line = subtitleVoice.ReplaceAllString(line, "$1: ")
+			line = subtitleTag.ReplaceAllString(line, "")
+			cue = append(cue, line)
+		}
+		flush()
+	}
+
+	fullText := strings.Join(lines, "\n")
+	res := &ExtractionResult{
+		FullText: fullText,
+		Pages:    []string{fullText},
+	}
+	res.setMeta(MetaEncoding, enc)
+	return res, nil
+}
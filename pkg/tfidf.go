@@ -0,0 +1,162 @@
+package pkg
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// StepTFIDF is the cache step that writes per-word corpus statistics
+const StepTFIDF = "tfidf"
+
+// TFIDFName holds one line per entry of uniq.txt, in vocabulary order:
+//
+//	wordIdx,df,tf,idf,tfidf
+//
+// df is the number of files the word occurs in, tf its total number of
+// occurrences, idf = ln((1+N)/(1+df)) + 1 for N files, and tfidf = tf × idf.
+const TFIDFName = "tfidf.txt"
+
+// TermStats are the corpus statistics of one vocabulary word
+type TermStats struct {
+	Word  int
+	DF    int
+	TF    int64
+	IDF   float64
+	TFIDF float64
+}
+
+// smoothIDF is the inverse document frequency of a word found in df of n
+// files. The smoothing keeps it finite for words in no file and positive for
+// words in every file.
+func smoothIDF(df, n int) float64 {
+	return math.Log(float64(1+n)/float64(1+df)) + 1
+}
+
+// BuildTFIDFCache counts, for every vocabulary word, the files it occurs in and
+// its total occurrences, and writes them with IDF and TF-IDF weights so
+// searches and reports can rank words by how informative they are
+func BuildTFIDFCache(ctx context.Context, outputDir string) error {
+	logger.Info("Building term statistics cache", "dir", outputDir)
+	reporter.OnStage(StepTFIDF)
+
+	if err := beginStep(outputDir, StepTFIDF); err != nil {
+		return err
+	}
+
+	tokenInputDir := readCacheInput(outputDir)
+	if tokenInputDir == "" {
+		return fmt.Errorf("could not find input path in settings.txt (run -cache tokens first)")
+	}
+	words, err := readLines(filepath.Join(outputDir, "uniq.txt"))
+	if err != nil {
+		return fmt.Errorf("could not read uniq.txt (run -cache tokens first): %w", err)
+	}
+	filesList, err := readLines(filepath.Join(outputDir, "files.txt"))
+	if err != nil {
+		return fmt.Errorf("could not read files.txt (run -cache tokens first): %w", err)
+	}
+	logger.Info("Loaded cache", "words", len(words), "files", len(filesList))
+
+	// Counts are shared between workers; a file's words are deduplicated
+	// locally before they count towards df
+	df := make([]int64, len(words))
+	tf := make([]int64, len(words))
+	src := newTokenSource(outputDir, tokenInputDir, indexWords(words))
+	err = forEachTokenFile(ctx, src, filesList, func(worker, fileIdx int, ids []int) error {
+		seen := make(map[int]int)
+		for _, id := range ids {
+			if id >= 0 && id < len(words) {
+				seen[id]++
+			}
+		}
+		for id, count := range seen {
+			atomic.AddInt64(&tf[id], int64(count))
+			atomic.AddInt64(&df[id], 1)
+		}
+		return nil
+	}, func(done int) {
+		reporter.OnFile(done, len(filesList))
+	})
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(outputDir, TFIDFName)
+	if err := writeTermStats(path, df, tf, len(filesList)); err != nil {
+		return err
+	}
+
+	logger.Info("Done! Term statistics written", "path", path)
+	return finishStep(outputDir, StepTFIDF, 0, TFIDFName)
+}
+
+// writeTermStats writes tfidf.txt from per-word document and term frequencies
+// over a corpus of files files
+func writeTermStats(path string, df, tf []int64, files int) error {
+	f, err := CreateCacheFile(path)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(f)
+	for i := range df {
+		idf := smoothIDF(int(df[i]), files)
+		fmt.Fprintf(writer, "%d,%d,%d,%.6f,%.6f\n", i, df[i], tf[i], idf, float64(tf[i])*idf)
+	}
+	if err := writer.Flush(); err != nil {
+		AbortCacheFile(f)
+		return err
+	}
+	return f.Close()
+}
+
+// LoadTermStats reads the statistics written by BuildTFIDFCache, indexed by
+// word index
+func LoadTermStats(cacheDir string) ([]TermStats, error) {
+	f, err := OpenCacheFile(filepath.Join(cacheDir, TFIDFName))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var stats []TermStats
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		s, err := parseTermStats(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", TFIDFName, len(stats)+1, err)
+		}
+		stats = append(stats, s)
+	}
+	return stats, scanner.Err()
+}
+
+func parseTermStats(line string) (TermStats, error) {
+	fields := strings.Split(line, ",")
+	if len(fields) != 5 {
+		return TermStats{}, fmt.Errorf("expected 5 fields, got %d", len(fields))
+	}
+	var s TermStats
+	var err error
+	if s.Word, err = strconv.Atoi(fields[0]); err != nil {
+		return s, err
+	}
+	if s.DF, err = strconv.Atoi(fields[1]); err != nil {
+		return s, err
+	}
+	if s.TF, err = strconv.ParseInt(fields[2], 10, 64); err != nil {
+		return s, err
+	}
+	if s.IDF, err = strconv.ParseFloat(fields[3], 64); err != nil {
+		return s, err
+	}
+	if s.TFIDF, err = strconv.ParseFloat(fields[4], 64); err != nil {
+		return s, err
+	}
+	return s, nil
+}
@@ -0,0 +1,311 @@
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Tokenizer splits text into words: process -type token writes them space
+// separated, the cache builders index them and queries are split the same
+// way. A tokenizer never returns words containing white space. String
+// returns the spec ParseTokenizer reads it back from, as recorded in
+// settings.txt.
+type Tokenizer interface {
+	Tokenize(text string) []string
+	String() string
+}
+
+// The tokenizers of ParseTokenizer, besides "regex:PATTERN"
+const (
+	TokenizerASCII      = "ascii"      // runs of ASCII letters and digits, as CleanToTokens
+	TokenizerWhitespace = "whitespace" // everything between white space
+	TokenizerUnicode    = "unicode"    // words of any script, Chinese, Japanese and Korean in character pairs
+	TokenizerCJK        = "cjk"        // unicode, with each Han, kana and Hangul character a word
+)
+
+// tokenizer is set by SetTokenizer; nil keeps the defaults of Tokenize and
+// SplitWords
+var tokenizer Tokenizer
+
+var asciiTokenizer = &RegexTokenizer{name: TokenizerASCII, re: regexp.MustCompile(`[a-zA-Z0-9]+`)}
+
+// ParseTokenizer returns the tokenizer of a spec: "ascii", "whitespace",
+// "unicode", "cjk" or "regex:PATTERN". "" is nil, the defaults.
+func ParseTokenizer(spec string) (Tokenizer, error) {
+	if pattern, ok := strings.CutPrefix(spec, "regex:"); ok {
+		return NewRegexTokenizer(pattern)
+	}
+	switch strings.ToLower(strings.TrimSpace(spec)) {
+	case "":
+		return nil, nil
+	case TokenizerASCII:
+		return asciiTokenizer, nil
+	case TokenizerWhitespace:
+		return WhitespaceTokenizer{}, nil
+	case TokenizerUnicode:
+		return UnicodeTokenizer{}, nil
+	case TokenizerCJK:
+		return CJKTokenizer{}, nil
+	}
+	return nil, fmt.Errorf("unknown tokenizer %q (use 'ascii', 'whitespace', 'unicode', 'cjk' or 'regex:PATTERN')", spec)
+}
+
+// SetTokenizer sets the tokenizer of process -type token and lowercase and
+// of the -cache tokens step, which records it in settings.txt for the later
+// steps to check. nil restores the defaults: ASCII words for process, and
+// the token files split at white space for the cache.
+func SetTokenizer(t Tokenizer) {
+	tokenizer = t
+}
+
+// Tokenize splits text into words with the tokenizer of SetTokenizer, or
+// into runs of ASCII letters and digits without one, as process -type token
+// does
+func Tokenize(text string) []string {
+	if tokenizer == nil {
+		return asciiTokenizer.Tokenize(text)
+	}
+	return tokenizer.Tokenize(text)
+}
+
+// SplitWords splits already tokenized text, a line of a token file or a
+// query phrase, with the tokenizer of SetTokenizer, or at white space
+// without one. Placeholder tokens such as <NUM> stay whole.
+func SplitWords(text string) []string {
+	if tokenizer == nil {
+		return strings.Fields(text)
+	}
+	if !strings.Contains(text, "<") {
+		return tokenizer.Tokenize(text)
+	}
+	var words []string
+	for _, field := range strings.Fields(text) {
+		if IsPlaceholder(field) {
+			words = append(words, field)
+		} else {
+			words = append(words, tokenizer.Tokenize(field)...)
+		}
+	}
+	return words
+}
+
+// tokenizerSpec is the spec of t, "" for nil
+func tokenizerSpec(t Tokenizer) string {
+	if t == nil {
+		return ""
+	}
+	return t.String()
+}
+
+// cacheSetting returns the key= value of a cache's settings.txt, or ""
+func cacheSetting(cacheDir, key string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(cacheDir, "settings.txt"))
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if value, ok := strings.CutPrefix(line, key+"="); ok {
+			return value, nil
+		}
+	}
+	return "", nil
+}
+
+// CacheTokenizer returns the tokenizer the tokens step of a cache recorded
+// in settings.txt, or nil if it ran without one
+func CacheTokenizer(cacheDir string) (Tokenizer, error) {
+	spec, err := cacheSetting(cacheDir, "tokenizer")
+	if err != nil {
+		return nil, err
+	}
+	return ParseTokenizer(spec)
+}
+
+// checkCacheWords refuses to read the token files of a cache with another
+// tokenizer or stemmer than its tokens step used, which would index words
+// its vocabulary does not have
+func checkCacheWords(cacheDir string) error {
+	if built, err := CacheTokenizer(cacheDir); err == nil {
+		if have, want := tokenizerSpec(tokenizer), tokenizerSpec(built); have != want {
+			return fmt.Errorf("%w: tokens step used tokenizer %s, not %s (pass the same -tokenizer, or re-run: %s)",
+				ErrStaleCache, orNone(want), orNone(have), stepCommand(StepTokens))
+		}
+	}
+	if built, err := CacheStemmer(cacheDir); err == nil {
+		if have, want := stemLanguage(stemmer), stemLanguage(built); have != want {
+			return fmt.Errorf("%w: tokens step used stemming %s, not %s (pass the same -stem, or re-run: %s)",
+				ErrStaleCache, orNone(want), orNone(have), stepCommand(StepTokens))
+		}
+	}
+	return nil
+}
+
+// orNone is spec, or "none" for no tokenizer or stemmer
+func orNone(spec string) string {
+	if spec == "" {
+		return "none"
+	}
+	return spec
+}
+
+// WhitespaceTokenizer splits text at white space, keeping punctuation
+type WhitespaceTokenizer struct{}
+
+func (WhitespaceTokenizer) Tokenize(text string) []string {
+	return strings.Fields(text)
+}
+
+func (WhitespaceTokenizer) String() string {
+	return TokenizerWhitespace
+}
+
+// UnicodeTokenizer splits text into words of letters, digits and combining
+// marks of any script, so accents stay: "café", "Straße" and "naïve" are
+// words as written, in NFC whatever form the document used. Chinese,
+// Japanese and Korean, which put no spaces between words, are cut into
+// overlapping pairs of characters, the common way to index them without a
+// dictionary: "東京都" is "東京 京都", so the phrase finds the city.
+type UnicodeTokenizer struct{}
+
+func (UnicodeTokenizer) Tokenize(text string) []string {
+	return scanWords(norm.NFC.String(text), cjkBigrams)
+}
+
+func (UnicodeTokenizer) String() string {
+	return TokenizerUnicode
+}
+
+// CJKTokenizer is UnicodeTokenizer with each Han, kana or Hangul character a
+// word of its own rather than a pair, for a vocabulary of characters
+type CJKTokenizer struct{}
+
+func (CJKTokenizer) Tokenize(text string) []string {
+	return scanWords(norm.NFC.String(text), cjkChars)
+}
+
+func (CJKTokenizer) String() string {
+	return TokenizerCJK
+}
+
+// isCJK reports whether r is written without spaces between words
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// scanWords splits text into runs of letters and digits, a combining mark
+// staying with the run before it, and hands each run of CJK characters to
+// cjk to be cut into words
+func scanWords(text string, cjk func(words []string, run string) []string) []string {
+	var words []string
+	start, cjkStart := -1, -1
+	flush := func(i int) {
+		if start >= 0 {
+			words = append(words, text[start:i])
+			start = -1
+		}
+		if cjkStart >= 0 {
+			words = cjk(words, text[cjkStart:i])
+			cjkStart = -1
+		}
+	}
+	for i, r := range text {
+		switch {
+		case unicode.Is(unicode.M, r):
+		case isCJK(r):
+			if start >= 0 {
+				flush(i)
+			}
+			if cjkStart < 0 {
+				cjkStart = i
+			}
+		case unicode.IsLetter(r) || unicode.IsNumber(r):
+			if cjkStart >= 0 {
+				flush(i)
+			}
+			if start < 0 {
+				start = i
+			}
+		default:
+			flush(i)
+		}
+	}
+	flush(len(text))
+	return words
+}
+
+// cjkBigrams adds the overlapping character pairs of run, or run itself if
+// it is one character
+func cjkBigrams(words []string, run string) []string {
+	chars := cjkCharacters(run)
+	if len(chars) == 1 {
+		return append(words, chars[0])
+	}
+	for i := 0; i+1 < len(chars); i++ {
+		words = append(words, chars[i]+chars[i+1])
+	}
+	return words
+}
+
+// cjkChars adds each character of run
+func cjkChars(words []string, run string) []string {
+	return append(words, cjkCharacters(run)...)
+}
+
+// cjkCharacters splits a run into characters, each with the combining marks
+// after it
+func cjkCharacters(run string) []string {
+	var chars []string
+	start := 0
+	for i, r := range run {
+		if i > start && !unicode.Is(unicode.M, r) {
+			chars = append(chars, run[start:i])
+			start = i
+		}
+	}
+	return append(chars, run[start:])
+}
+
+// RegexTokenizer takes the matches of a regular expression as the words
+type RegexTokenizer struct {
+	name string // the spec of a built-in tokenizer, "" for regex:PATTERN
+	re   *regexp.Regexp
+}
+
+// NewRegexTokenizer returns a tokenizer whose words are the matches of
+// pattern, e.g. `[\p{L}\p{N}]+(?:'[\p{L}]+)?` to keep "don't" whole. Matches
+// are split at white space.
+func NewRegexTokenizer(pattern string) (*RegexTokenizer, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tokenizer pattern: %w", err)
+	}
+	return &RegexTokenizer{re: re}, nil
+}
+
+func (t *RegexTokenizer) Tokenize(text string) []string {
+	matches := t.re.FindAllString(text, -1)
+	words := make([]string, 0, len(matches))
+	for _, m := range matches {
+		switch {
+		case m == "":
+		case strings.IndexFunc(m, unicode.IsSpace) >= 0:
+			words = append(words, strings.Fields(m)...)
+		default:
+			words = append(words, m)
+		}
+	}
+	return words
+}
+
+func (t *RegexTokenizer) String() string {
+	if t.name != "" {
+		return t.name
+	}
+	return "regex:" + t.re.String()
+}
@@ -0,0 +1,309 @@
+package pkg
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"sort"
+
+	"github.com/RoaringBitmap/roaring/v2"
+)
+
+// TopicOptions configure TopicClusters
+type TopicOptions struct {
+	K          int     // clusters to find
+	Iterations int     // most rounds of k-means; it stops earlier once no file moves
+	MinFiles   int     // fewest files a word must be in to be a term
+	MaxShare   float64 // largest share of the files a term may be in; 0 for 0.5
+	Seed       int64   // of the choice of the first centroids
+	TopTerms   int     // terms listed per cluster
+	TopFiles   int     // member files listed per cluster, the most central first; 0 for all
+
+	Files *roaring.Bitmap        // the files to cluster; nil for all
+	Skip  func(word string) bool // words never to use as terms; nil for none
+}
+
+// TopicCluster is a group of files about the same thing. Terms are the words
+// of most weight in its centroid and Files its members, the closest to the
+// centroid first; Size counts every member.
+type TopicCluster struct {
+	Size  int
+	Terms []TopicTerm
+	Files []TopicFile
+}
+
+// TopicTerm is a word of a cluster with its weight in the centroid
+type TopicTerm struct {
+	Word   string
+	Weight float64
+}
+
+// TopicFile is a member file of a cluster with its cosine similarity to the
+// centroid
+type TopicFile struct {
+	Index      int
+	Similarity float64
+}
+
+// TopicStats sum up a clustering: the files clustered, those with no term
+// that were left out, the terms used and the rounds of k-means run
+type TopicStats struct {
+	Files      int
+	Unassigned int
+	Terms      int
+	Iterations int
+}
+
+// topicDoc is the TF-IDF vector of a file, L2-normalized, over the terms it
+// contains. The word→file index says which words a file has but not how
+// often, so a term weighs its IDF in every file that has it.
+type topicDoc struct {
+	file    int
+	terms   []int32
+	weights []float64
+}
+
+// TopicClusters groups files by the words they share, from the word→file
+// index (fileuniqindex.txt, -cache index): each file becomes a TF-IDF vector
+// over the words in at least MinFiles and at most MaxShare of the files, and
+// spherical k-means splits those vectors into K clusters by cosine
+// similarity. Clusters are returned largest first. progress is called after
+// each round of k-means with the rounds done and the most to do; an error
+// from it stops the clustering and is returned.
+func TopicClusters(cacheDir string, opts TopicOptions, progress func(done, total int) error) ([]TopicCluster, TopicStats, error) {
+	var stats TopicStats
+	if opts.K < 1 {
+		return nil, stats, fmt.Errorf("k must be at least 1, got %d", opts.K)
+	}
+	if opts.MaxShare <= 0 {
+		opts.MaxShare = 0.5
+	}
+	indexPath := filepath.Join(cacheDir, "fileuniqindex.txt")
+	if !CacheFileExists(indexPath) {
+		return nil, stats, fmt.Errorf("no fileuniqindex.txt in %s (run -cache index)", cacheDir)
+	}
+	filesList, err := readLines(filepath.Join(cacheDir, "files.txt"))
+	if err != nil {
+		return nil, stats, fmt.Errorf("could not read files.txt: %w", err)
+	}
+	words, err := readLines(filepath.Join(cacheDir, "uniq.txt"))
+	if err != nil {
+		return nil, stats, fmt.Errorf("could not read uniq.txt: %w", err)
+	}
+	selected := fileSet(opts.Files, len(filesList))
+	count := int(selected.GetCardinality())
+	maxFiles := max(int(opts.MaxShare*float64(count)), opts.MinFiles)
+
+	// The terms and, for each file, the terms it has with their IDF
+	var terms []int // term → word index
+	docs := make([]topicDoc, len(filesList))
+	err = scanIndexFile(indexPath, func(wIdx int, files *roaring.Bitmap) {
+		if wIdx < 0 || wIdx >= len(words) || opts.Skip != nil && opts.Skip(words[wIdx]) {
+			return
+		}
+		files.And(selected)
+		df := int(files.GetCardinality())
+		if df < max(opts.MinFiles, 1) || df > maxFiles {
+			return
+		}
+		t := int32(len(terms))
+		terms = append(terms, wIdx)
+		idf := smoothIDF(df, count)
+		it := files.Iterator()
+		for it.HasNext() {
+			d := &docs[it.Next()]
+			d.terms = append(d.terms, t)
+			d.weights = append(d.weights, idf)
+		}
+	})
+	if err != nil {
+		return nil, stats, fmt.Errorf("could not read fileuniqindex.txt: %w", err)
+	}
+
+	var vectors []topicDoc
+	for i, d := range docs {
+		if len(d.terms) == 0 {
+			continue
+		}
+		var norm float64
+		for _, w := range d.weights {
+			norm += w * w
+		}
+		norm = math.Sqrt(norm)
+		for j := range d.weights {
+			d.weights[j] /= norm
+		}
+		d.file = i
+		vectors = append(vectors, d)
+	}
+	docs = nil
+	stats = TopicStats{Files: len(vectors), Unassigned: count - len(vectors), Terms: len(terms)}
+	if len(vectors) == 0 {
+		return nil, stats, nil
+	}
+
+	k := min(opts.K, len(vectors))
+	rng := rand.New(rand.NewSource(opts.Seed))
+	centroids := seedCentroids(vectors, k, len(terms), rng)
+	assign := make([]int, len(vectors))
+	sims := make([]float64, len(vectors))
+	for i := range assign {
+		assign[i] = -1
+	}
+	for stats.Iterations < max(opts.Iterations, 1) {
+		moved := 0
+		for i, d := range vectors {
+			best, bestSim := 0, math.Inf(-1)
+			for c, centroid := range centroids {
+				if s := d.dot(centroid); s > bestSim {
+					best, bestSim = c, s
+				}
+			}
+			if assign[i] != best {
+				assign[i] = best
+				moved++
+			}
+			sims[i] = bestSim
+		}
+		stats.Iterations++
+		if progress != nil {
+			if err := progress(stats.Iterations, max(opts.Iterations, 1)); err != nil {
+				return nil, stats, err
+			}
+		}
+		if moved == 0 || stats.Iterations == max(opts.Iterations, 1) {
+			break
+		}
+		updateCentroids(vectors, assign, sims, centroids)
+	}
+
+	// The clusters, with the terms weighing most in their centroid and the
+	// files closest to it
+	clusters := make([]TopicCluster, k)
+	for i, d := range vectors {
+		c := &clusters[assign[i]]
+		c.Size++
+		c.Files = append(c.Files, TopicFile{Index: d.file, Similarity: sims[i]})
+	}
+	for c := range clusters {
+		order := make([]int, 0, len(terms))
+		for t, w := range centroids[c] {
+			if w > 0 {
+				order = append(order, t)
+			}
+		}
+		sort.Slice(order, func(i, j int) bool {
+			if centroids[c][order[i]] != centroids[c][order[j]] {
+				return centroids[c][order[i]] > centroids[c][order[j]]
+			}
+			return order[i] < order[j]
+		})
+		for _, t := range firstN(order, opts.TopTerms) {
+			clusters[c].Terms = append(clusters[c].Terms, TopicTerm{Word: words[terms[t]], Weight: centroids[c][t]})
+		}
+		files := clusters[c].Files
+		sort.SliceStable(files, func(i, j int) bool { return files[i].Similarity > files[j].Similarity })
+		clusters[c].Files = firstN(files, opts.TopFiles)
+	}
+	sort.SliceStable(clusters, func(i, j int) bool { return clusters[i].Size > clusters[j].Size })
+	for len(clusters) > 0 && clusters[len(clusters)-1].Size == 0 {
+		clusters = clusters[:len(clusters)-1]
+	}
+	return clusters, stats, nil
+}
+
+// dot is the dot product of a file vector with a dense one
+func (d topicDoc) dot(dense []float64) float64 {
+	var s float64
+	for i, t := range d.terms {
+		s += d.weights[i] * dense[t]
+	}
+	return s
+}
+
+// seedCentroids picks k files as the first centroids by k-means++: each
+// after the first with a chance growing with its cosine distance to the
+// nearest one picked, which spreads them across the corpus
+func seedCentroids(vectors []topicDoc, k, dims int, rng *rand.Rand) [][]float64 {
+	dense := func(d topicDoc) []float64 {
+		c := make([]float64, dims)
+		for i, t := range d.terms {
+			c[t] = d.weights[i]
+		}
+		return c
+	}
+	centroids := [][]float64{dense(vectors[rng.Intn(len(vectors))])}
+	dist := make([]float64, len(vectors))
+	for i := range dist {
+		dist[i] = math.Inf(1)
+	}
+	for len(centroids) < k {
+		last := centroids[len(centroids)-1]
+		var sum float64
+		for i, d := range vectors {
+			dist[i] = min(dist[i], math.Max(0, 1-d.dot(last)))
+			sum += dist[i] * dist[i]
+		}
+		pick := rng.Intn(len(vectors))
+		if sum > 0 {
+			r := rng.Float64() * sum
+			for i := range vectors {
+				if r -= dist[i] * dist[i]; r <= 0 {
+					pick = i
+					break
+				}
+			}
+		}
+		centroids = append(centroids, dense(vectors[pick]))
+	}
+	return centroids
+}
+
+// updateCentroids sets each centroid to the normalized sum of the vectors
+// of its members. A cluster left with none takes the file least similar to
+// its own centroid, so k clusters remain.
+func updateCentroids(vectors []topicDoc, assign []int, sims []float64, centroids [][]float64) {
+	sizes := make([]int, len(centroids))
+	for c := range centroids {
+		clear(centroids[c])
+	}
+	for i, d := range vectors {
+		sizes[assign[i]]++
+		for j, t := range d.terms {
+			centroids[assign[i]][t] += d.weights[j]
+		}
+	}
+	for c, centroid := range centroids {
+		if sizes[c] == 0 {
+			worst := -1
+			for i := range vectors {
+				if sizes[assign[i]] > 1 && (worst == -1 || sims[i] < sims[worst]) {
+					worst = i
+				}
+			}
+			if worst == -1 {
+				continue
+			}
+			sizes[assign[worst]]--
+			sizes[c]++
+			for j, t := range vectors[worst].terms {
+				centroids[assign[worst]][t] -= vectors[worst].weights[j]
+				centroid[t] += vectors[worst].weights[j]
+			}
+			assign[worst] = c
+			sims[worst] = 1
+		}
+	}
+	for _, centroid := range centroids {
+		var norm float64
+		for _, w := range centroid {
+			norm += w * w
+		}
+		if norm = math.Sqrt(norm); norm > 0 {
+			for t := range centroid {
+				centroid[t] /= norm
+			}
+		}
+	}
+}
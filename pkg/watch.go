@@ -0,0 +1,150 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// WatchProcess converts the files of inputDir as RunProcess does, then
+// watches inputDir and its subdirectories and converts the files added or
+// modified there, replacing their outputs. Changed files are converted
+// together once no file has changed for settle, so a file still being copied
+// is not read halfway. after, if not nil, is called after the first pass and
+// after each batch, e.g. to update a cache of the outputs; an error from it
+// is logged and the watching goes on. Outputs of deleted files are kept.
+//
+// WatchProcess runs until ctx is done. A modified file whose batch was
+// stopped is not converted again until it changes, though a new one is.
+func WatchProcess(ctx context.Context, inputDir, outputDir string, opts ProcessOptions,
+	settle time.Duration, after func() error) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("could not watch %s: %w", inputDir, err)
+	}
+	defer w.Close()
+	absOutput, _ := filepath.Abs(outputDir)
+	filter, err := opts.inputFilter()
+	if err != nil {
+		return err
+	}
+	// selected reports whether a changed file is to be converted
+	selected := func(path string) bool {
+		rel, err := filepath.Rel(inputDir, path)
+		return err == nil && !strings.HasPrefix(filepath.Base(path), ".") && filter.matches(rel)
+	}
+
+	// pending are the files changed since the last batch
+	pending := make(map[string]bool)
+	// watchTree watches dir and the directories under it, adding their
+	// files to pending when found is set
+	watchTree := func(dir string, found bool) error {
+		return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			if info.IsDir() {
+				if abs, _ := filepath.Abs(path); abs == absOutput {
+					return filepath.SkipDir
+				}
+				if err := w.Add(path); err != nil {
+					return fmt.Errorf("could not watch %s: %w", path, err)
+				}
+			} else if found && selected(path) {
+				pending[path] = true
+			}
+			return nil
+		})
+	}
+	// The watches are set before the first pass, so no file dropped
+	// during it is missed
+	if err := watchTree(inputDir, false); err != nil {
+		return err
+	}
+
+	runAfter := func() {
+		if after == nil || ctx.Err() != nil {
+			return
+		}
+		if err := after(); err != nil && ctx.Err() == nil {
+			logger.Warn("Update after processing failed", "error", err)
+		}
+	}
+	if err := RunProcess(ctx, inputDir, outputDir, opts); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+	runAfter()
+
+	opts.Replace = true
+	logger.Info("Watching for new files", "input", inputDir)
+	var settled <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("Stopped watching", "input", inputDir)
+			return nil
+		case ev, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			if abs, _ := filepath.Abs(ev.Name); abs == absOutput || strings.HasPrefix(abs, absOutput+string(filepath.Separator)) {
+				continue
+			}
+			switch {
+			case ev.Has(fsnotify.Create) || ev.Has(fsnotify.Write):
+				info, err := os.Stat(ev.Name)
+				if err != nil {
+					continue
+				}
+				if info.IsDir() {
+					// A directory moved in may hold files already
+					if err := watchTree(ev.Name, true); err != nil {
+						logger.Warn("Watching new directory", "dir", ev.Name, "error", err)
+					}
+				} else if selected(ev.Name) {
+					pending[ev.Name] = true
+				}
+			case ev.Has(fsnotify.Remove) || ev.Has(fsnotify.Rename):
+				delete(pending, ev.Name)
+			default:
+				continue
+			}
+			settled = time.After(settle)
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			logger.Warn("Watching for new files", "error", err)
+		case <-settled:
+			settled = nil
+			var files []string
+			for path := range pending {
+				if info, err := os.Stat(path); err == nil && !info.IsDir() {
+					files = append(files, path)
+				}
+			}
+			clear(pending)
+			if len(files) == 0 {
+				continue
+			}
+			sort.Strings(files)
+			logger.Info("Files changed", "files", len(files))
+			if err := processFiles(ctx, inputDir, outputDir, files, opts); err != nil {
+				if ctx.Err() != nil {
+					continue
+				}
+				return err
+			}
+			runAfter()
+		}
+	}
+}
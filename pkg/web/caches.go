@@ -0,0 +1,126 @@
+package web
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// addedCache is a cache registered with AddCache
+type addedCache struct {
+	name, dir string
+}
+
+// addedCaches are the caches StartServer serves besides its own, in the
+// order they were added
+var addedCaches []addedCache
+
+// servedCaches are the caches being served, the one of StartServer first
+var servedCaches []*CacheConfig
+
+// cacheNamePattern is what a cache name may look like, to be a path segment
+var cacheNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// reservedCacheNames are the first path segments of the pages and API of
+// the cache of StartServer, which a named cache would hide
+var reservedCacheNames = map[string]bool{
+	"api": true, "ws": true, "reports": true, "files": true, "caches": true,
+	"stats": true, "refresh": true, "ngrams": true, "search": true, "kwic": true,
+	"contains": true, "similar": true, "file": true, "report": true,
+	"queries": true, "schedules": true, "queue": true, "report-templates": true,
+}
+
+// AddCache makes StartServer also serve the cache in dir under name: its
+// pages under /{name}/ and its API under /api/{name}/, with every n-gram size
+// it has. Its reports go to a subdirectory name of the reports directory;
+// the report workers and queue are shared by every cache.
+func AddCache(name, dir string) error {
+	if !cacheNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid cache name %q (use letters, digits, '.', '_' and '-')", name)
+	}
+	if reservedCacheNames[name] {
+		return fmt.Errorf("cache name %q is taken by the API", name)
+	}
+	for _, ac := range addedCaches {
+		if ac.name == name {
+			return fmt.Errorf("cache %q added twice", name)
+		}
+	}
+	if info, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("cache %s: %w", name, err)
+	} else if !info.IsDir() {
+		return fmt.Errorf("cache %s: %s is not a directory", name, dir)
+	}
+	addedCaches = append(addedCaches, addedCache{name, dir})
+	return nil
+}
+
+// cacheByName returns the served cache called name, "" being the cache of
+// StartServer
+func cacheByName(name string) (*CacheConfig, bool) {
+	for _, config := range servedCaches {
+		if config.Name == name {
+			return config, true
+		}
+	}
+	return nil, false
+}
+
+// base is the path the pages of the cache are under: "" for the cache of
+// StartServer and "/{name}" for the others. Its API is under "/api" + base.
+func (config *CacheConfig) base() string {
+	if config.Name == "" {
+		return ""
+	}
+	return "/" + config.Name
+}
+
+// title is the title of the main page of the cache
+func (config *CacheConfig) title() string {
+	if config.Name == "" {
+		return "TokenTrove"
+	}
+	return config.Name + " · TokenTrove"
+}
+
+// cacheLinks lists the served caches for the cache menu of the main page,
+// or nothing when there is only one
+func cacheLinks() []fiber.Map {
+	if len(servedCaches) < 2 {
+		return nil
+	}
+	var links []fiber.Map
+	for _, config := range servedCaches {
+		name := config.Name
+		if name == "" {
+			name = "default"
+		}
+		links = append(links, fiber.Map{"Name": name, "Base": config.base()})
+	}
+	return links
+}
+
+// listCaches lists the served caches with where their pages and API are
+func listCaches(c *fiber.Ctx) error {
+	caches := []fiber.Map{}
+	for _, config := range servedCaches {
+		m := config.mem()
+		caches = append(caches, fiber.Map{
+			"name": config.Name, "path": config.base() + "/", "api": "/api" + config.base(),
+			"wordCount": len(m.words), "fileCount": len(m.files), "maxN": config.MaxN,
+		})
+	}
+	return c.JSON(fiber.Map{"caches": caches})
+}
+
+// cacheJob returns the report job id if it belongs to the cache; the caller
+// holds reportJobsMu
+func cacheJob(config *CacheConfig, id string) (*ReportJob, bool) {
+	job, ok := reportJobs[id]
+	if !ok || job.config != config {
+		return nil, false
+	}
+	return job, true
+}
@@ -0,0 +1,167 @@
+package web
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/RoaringBitmap/roaring/v2"
+)
+
+// The Linked N-grams and Best Chains reports chain n-grams whose last words
+// are the first of the next, the job's overlap of them (two by default). Following every link from every
+// n-gram grows exponentially with the chain depth, so both search the links
+// with a beam: a few of the best chains so far are extended at each step.
+
+const (
+	// linkedChainDepth and bestChainDepth are the default chainDepth of the
+	// Linked N-grams and Best Chains reports, in n-grams
+	linkedChainDepth = 3
+	bestChainDepth   = 11
+
+	// maxChainDepth is the longest chain a report may ask for
+	maxChainDepth = 50
+
+	// defaultOverlap is how many words the n-grams of a chain share with the
+	// next unless the job sets its overlap
+	defaultOverlap = 2
+
+	// chainBeamWidth is how many chains from each n-gram the beam search
+	// keeps extending at each step
+	chainBeamWidth = 8
+)
+
+// chainLink is an n-gram a chain report links; files is nil without file
+// data
+type chainLink struct {
+	words  []string
+	n      int
+	files  *roaring.Bitmap
+	count  int
+	phrase string
+}
+
+// ngramLinks holds the n-grams of a chain report by their first overlap
+// words
+type ngramLinks struct {
+	overlap    int
+	startsWith map[string][]*chainLink
+	links      []*chainLink
+}
+
+func newNgramLinks(overlap int) *ngramLinks {
+	return &ngramLinks{overlap: overlap, startsWith: make(map[string][]*chainLink)}
+}
+
+// add adds an n-gram of at least overlap words to the graph
+func (g *ngramLinks) add(words []string, n int, files *roaring.Bitmap, count int) {
+	l := &chainLink{words: words, n: n, files: files, count: count, phrase: strings.Join(words, " ")}
+	key := strings.Join(words[:g.overlap], " ")
+	g.startsWith[key] = append(g.startsWith[key], l)
+	g.links = append(g.links, l)
+}
+
+// next lists the n-grams that can follow l in a chain
+func (g *ngramLinks) next(l *chainLink) []*chainLink {
+	return g.startsWith[strings.Join(l.words[len(l.words)-g.overlap:], " ")]
+}
+
+// chainPath is a chain of n-grams with the files all of them are in, nil
+// when one has no file data
+type chainPath struct {
+	links []*chainLink
+	files *roaring.Bitmap
+}
+
+// fileCount is the number of files the whole chain is in, or without file
+// data the smallest count of its n-grams
+func (p *chainPath) fileCount() int {
+	if p.files != nil {
+		return int(p.files.GetCardinality())
+	}
+	count := p.links[0].count
+	for _, l := range p.links[1:] {
+		count = min(count, l.count)
+	}
+	return count
+}
+
+// text is the text the chain spans, its n-grams overlapping by overlap words
+func (p *chainPath) text(overlap int) string {
+	parts := []string{p.links[0].phrase}
+	for _, l := range p.links[1:] {
+		if len(l.words) > overlap {
+			parts = append(parts, strings.Join(l.words[overlap:], " "))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// contains reports whether the chain already goes through l
+func (p *chainPath) contains(l *chainLink) bool {
+	for _, k := range p.links {
+		if k.phrase == l.phrase {
+			return true
+		}
+	}
+	return false
+}
+
+// extend returns the chain followed by l, or false when fewer than minFiles
+// files hold both
+func (p *chainPath) extend(l *chainLink, minFiles int) (*chainPath, bool) {
+	var files *roaring.Bitmap
+	if p.files != nil && l.files != nil {
+		files = roaring.And(p.files, l.files)
+		if int(files.GetCardinality()) < minFiles {
+			return nil, false
+		}
+	}
+	links := make([]*chainLink, len(p.links), len(p.links)+1)
+	copy(links, p.links)
+	return &chainPath{links: append(links, l), files: files}, true
+}
+
+// beamChains follows the links from start for chains of up to depth n-grams
+// all in at least minFiles files. At each step it extends every kept chain
+// by every n-gram that can follow it and keeps the width chains in the most
+// files, the most frequent n-grams breaking ties. It returns the kept chains
+// of each length from two n-grams up, shortest first.
+func (g *ngramLinks) beamChains(start *chainLink, depth, width, minFiles int) []*chainPath {
+	beam := []*chainPath{{links: []*chainLink{start}, files: start.files}}
+	var kept []*chainPath
+	for len(beam) > 0 && len(beam[0].links) < depth {
+		var grown []*chainPath
+		for _, p := range beam {
+			for _, l := range g.next(p.links[len(p.links)-1]) {
+				if p.contains(l) {
+					continue
+				}
+				if q, ok := p.extend(l, minFiles); ok {
+					grown = append(grown, q)
+				}
+			}
+		}
+		sort.SliceStable(grown, func(i, j int) bool {
+			fi, fj := grown[i].fileCount(), grown[j].fileCount()
+			if fi != fj {
+				return fi > fj
+			}
+			return grown[i].links[len(grown[i].links)-1].count > grown[j].links[len(grown[j].links)-1].count
+		})
+		if len(grown) > width {
+			grown = grown[:width]
+		}
+		kept = append(kept, grown...)
+		beam = grown
+	}
+	return kept
+}
+
+// chainNodes lists the n-grams of a chain for a report
+func chainNodes(p *chainPath) []ChainNode {
+	nodes := make([]ChainNode, len(p.links))
+	for i, l := range p.links {
+		nodes[i] = ChainNode{Phrase: l.phrase, N: l.n, Count: l.count}
+	}
+	return nodes
+}
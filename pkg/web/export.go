@@ -0,0 +1,376 @@
+package web
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/openfluke/tokentrove/pkg"
+)
+
+// errNoReport is the error of a report that does not exist or has no file
+var errNoReport = errors.New("not found")
+
+// errBadFormat is the error of an unknown download format
+var errBadFormat = errors.New("unknown format")
+
+// downloadReport sends a finished report as a file:
+// /api/report/:id/download?format=json|csv|txt. JSON is the report as
+// written; CSV and text flatten it to one row per result, text as
+// tab-separated columns.
+func downloadReport(c *fiber.Ctx, config *CacheConfig) error {
+	name, contentType, out, err := exportReport(config, c.Params("id"), c.Query("format", "json"))
+	switch {
+	case errors.Is(err, errNoReport):
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, errBadFormat):
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	case err != nil:
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, name))
+	return c.Send(out)
+}
+
+// exportReport reads the report id of a cache in a download format, returning the file
+// name and content type to send it with. It fails with errNoReport for a
+// report that is unknown or unfinished, or whose file can't be read.
+func exportReport(config *CacheConfig, id, format string) (name, contentType string, out []byte, err error) {
+	reportJobsMu.RLock()
+	job, ok := cacheJob(config, id)
+	var jobType, path string
+	if ok {
+		jobType, path = job.Type, job.FilePath
+	}
+	reportJobsMu.RUnlock()
+	if !ok || path == "" {
+		return "", "", nil, errNoReport
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("%w: %v", errNoReport, err)
+	}
+
+	name = jobType + "_" + id + "." + format
+	switch format {
+	case "json":
+		return name, fiber.MIMEApplicationJSON, data, nil
+	case "csv", "txt":
+		header, rows, err := reportRows(jobType, data)
+		if err != nil {
+			return "", "", nil, err
+		}
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		if format == "txt" {
+			w.Comma = '\t'
+		}
+		w.Write(header)
+		w.WriteAll(rows)
+		if err := w.Error(); err != nil {
+			return "", "", nil, err
+		}
+		if format == "csv" {
+			return name, "text/csv; charset=utf-8", buf.Bytes(), nil
+		}
+		return name, fiber.MIMETextPlainCharsetUTF8, buf.Bytes(), nil
+	default:
+		return "", "", nil, fmt.Errorf("%w %q (use json, csv or txt)", errBadFormat, format)
+	}
+}
+
+// ngramRow is an entry of the per-size lists of the n-gram reports
+type ngramRow struct {
+	Phrase string   `json:"phrase"`
+	Count  int      `json:"count"`
+	PMI    *float64 `json:"pmi"`
+	LLR    *float64 `json:"llr"`
+}
+
+// reportRows flattens a report of type jobType to a header and one row per
+// result. Chains are joined with " → " and file lists with "; ".
+func reportRows(jobType string, data []byte) ([]string, [][]string, error) {
+	var rows [][]string
+	switch jobType {
+	case "top_ngrams", "search", "collocations":
+		var lists map[string][]ngramRow
+		if err := json.Unmarshal(data, &lists); err != nil {
+			return nil, nil, err
+		}
+		var sizes []int
+		for key := range lists {
+			if n, err := strconv.Atoi(strings.TrimSuffix(key, "grams")); err == nil {
+				sizes = append(sizes, n)
+			}
+		}
+		sort.Ints(sizes)
+		header := []string{"n", "phrase", "count"}
+		if jobType == "collocations" {
+			header = append(header, "pmi", "llr")
+		}
+		for _, n := range sizes {
+			for _, r := range lists[fmt.Sprintf("%dgrams", n)] {
+				row := []string{strconv.Itoa(n), r.Phrase, strconv.Itoa(r.Count)}
+				if jobType == "collocations" {
+					row = append(row, formatFloat(r.PMI), formatFloat(r.LLR))
+				}
+				rows = append(rows, row)
+			}
+		}
+		return header, rows, nil
+
+	case "recurring_text":
+		var r struct {
+			Chains []RecurringChain `json:"chains"`
+		}
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, nil, err
+		}
+		for i, ch := range r.Chains {
+			var phrases []string
+			for _, s := range ch.Segments {
+				phrases = append(phrases, s.Phrase)
+			}
+			rows = append(rows, []string{strconv.Itoa(i + 1), ch.FullText, strconv.Itoa(ch.FileCount), strconv.Itoa(ch.TotalLength),
+				ch.Overlap, strings.Join(phrases, " → "), strings.Join(ch.Files, "; ")})
+		}
+		return []string{"rank", "text", "files", "length", "overlap", "segments", "file_names"}, rows, nil
+
+	case "linked_ngrams":
+		var r struct {
+			Chains []NgramChainResult `json:"chains"`
+		}
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, nil, err
+		}
+		for i, ch := range r.Chains {
+			rows = append(rows, []string{strconv.Itoa(i + 1), ch.FullText, strconv.Itoa(ch.FileCount), strconv.Itoa(ch.ChainLength),
+				chainPhrases(ch.Chain), strings.Join(ch.Files, "; ")})
+		}
+		return []string{"rank", "text", "files", "chain_length", "chain", "file_names"}, rows, nil
+
+	case "best_chains":
+		var r struct {
+			Chains []BestChain `json:"chains"`
+		}
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, nil, err
+		}
+		for i, ch := range r.Chains {
+			rows = append(rows, []string{strconv.Itoa(i + 1), ch.FullText, strconv.Itoa(ch.FileCount), strconv.Itoa(ch.WordCount),
+				strconv.Itoa(ch.Score), chainPhrases(ch.Chain), strings.Join(ch.Files, "; ")})
+		}
+		return []string{"rank", "text", "files", "words", "score", "chain", "file_names"}, rows, nil
+
+	case "kwic":
+		var r struct {
+			Lines []struct {
+				File   string `json:"file"`
+				Index  int    `json:"index"`
+				Offset int    `json:"offset"`
+				Left   string `json:"left"`
+				Match  string `json:"match"`
+				Right  string `json:"right"`
+			} `json:"lines"`
+		}
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, nil, err
+		}
+		for _, l := range r.Lines {
+			rows = append(rows, []string{l.File, strconv.Itoa(l.Index), strconv.Itoa(l.Offset), l.Left, l.Match, l.Right})
+		}
+		return []string{"file", "index", "offset", "left", "match", "right"}, rows, nil
+
+	case "similar":
+		var r struct {
+			Files []struct {
+				File    string  `json:"file"`
+				Index   int     `json:"index"`
+				Shared  int     `json:"shared"`
+				Jaccard float64 `json:"jaccard"`
+			} `json:"files"`
+		}
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, nil, err
+		}
+		for _, f := range r.Files {
+			rows = append(rows, []string{f.File, strconv.Itoa(f.Index), strconv.Itoa(f.Shared), formatFloat(&f.Jaccard)})
+		}
+		return []string{"file", "index", "shared", "jaccard"}, rows, nil
+
+	case "boilerplate":
+		var r struct {
+			Files []struct {
+				File     string  `json:"file"`
+				Index    int     `json:"index"`
+				Tokens   int     `json:"tokens"`
+				Covered  int     `json:"covered"`
+				Coverage float64 `json:"coverage"`
+			} `json:"files"`
+		}
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, nil, err
+		}
+		for _, f := range r.Files {
+			rows = append(rows, []string{f.File, strconv.Itoa(f.Index), strconv.Itoa(f.Tokens), strconv.Itoa(f.Covered), formatFloat(&f.Coverage)})
+		}
+		return []string{"file", "index", "tokens", "covered", "coverage"}, rows, nil
+
+	case "zipf":
+		// The rank-frequency curve; the fits and distributions are in the JSON
+		var r struct {
+			RankFrequency []struct {
+				Rank  int    `json:"rank"`
+				Word  string `json:"word"`
+				Count int64  `json:"count"`
+			} `json:"rankFrequency"`
+		}
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, nil, err
+		}
+		for _, p := range r.RankFrequency {
+			rows = append(rows, []string{strconv.Itoa(p.Rank), p.Word, strconv.FormatInt(p.Count, 10)})
+		}
+		return []string{"rank", "word", "count"}, rows, nil
+
+	case "markov":
+		var r struct {
+			Samples []struct {
+				Text     string `json:"text"`
+				Words    int    `json:"words"`
+				Restarts int    `json:"restarts"`
+			} `json:"samples"`
+		}
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, nil, err
+		}
+		for i, s := range r.Samples {
+			rows = append(rows, []string{strconv.Itoa(i + 1), strconv.Itoa(s.Words), strconv.Itoa(s.Restarts), s.Text})
+		}
+		return []string{"sample", "words", "restarts", "text"}, rows, nil
+
+	case "topics":
+		// A row per cluster, its terms and closest files joined
+		var r struct {
+			Clusters []struct {
+				Size  int `json:"size"`
+				Terms []struct {
+					Word string `json:"word"`
+				} `json:"terms"`
+				Files []struct {
+					File string `json:"file"`
+				} `json:"files"`
+			} `json:"clusters"`
+		}
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, nil, err
+		}
+		for i, c := range r.Clusters {
+			terms := make([]string, len(c.Terms))
+			for j, t := range c.Terms {
+				terms[j] = t.Word
+			}
+			files := make([]string, len(c.Files))
+			for j, f := range c.Files {
+				files[j] = f.File
+			}
+			rows = append(rows, []string{strconv.Itoa(i + 1), strconv.Itoa(c.Size), strings.Join(terms, " "), strings.Join(files, "; ")})
+		}
+		return []string{"cluster", "size", "terms", "files"}, rows, nil
+
+	case "pii":
+		// A row per file with its hits of each kind
+		var r struct {
+			Files []struct {
+				File    string              `json:"file"`
+				Index   int                 `json:"index"`
+				Total   int                 `json:"total"`
+				Counts  map[string]int      `json:"counts"`
+				Samples map[string][]string `json:"samples"`
+			} `json:"files"`
+		}
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, nil, err
+		}
+		header := []string{"file", "index", "total"}
+		header = append(header, pkg.PIIKinds...)
+		header = append(header, "samples")
+		for _, f := range r.Files {
+			row := []string{f.File, strconv.Itoa(f.Index), strconv.Itoa(f.Total)}
+			var samples []string
+			for _, kind := range pkg.PIIKinds {
+				row = append(row, strconv.Itoa(f.Counts[kind]))
+				samples = append(samples, f.Samples[kind]...)
+			}
+			rows = append(rows, append(row, strings.Join(samples, "; ")))
+		}
+		return header, rows, nil
+
+	case "outliers":
+		var r struct {
+			Files []struct {
+				File       string  `json:"file"`
+				Index      int     `json:"index"`
+				Tokens     int     `json:"tokens"`
+				Types      int     `json:"types"`
+				Divergence float64 `json:"divergence"`
+				HapaxRatio float64 `json:"hapaxRatio"`
+			} `json:"files"`
+		}
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, nil, err
+		}
+		for _, f := range r.Files {
+			rows = append(rows, []string{f.File, strconv.Itoa(f.Index), strconv.Itoa(f.Tokens), strconv.Itoa(f.Types),
+				formatFloat(&f.Divergence), formatFloat(&f.HapaxRatio)})
+		}
+		return []string{"file", "index", "tokens", "types", "divergence", "hapaxRatio"}, rows, nil
+
+	case "timeline":
+		// One row per series and period
+		var r struct {
+			Periods []string          `json:"periods"`
+			Total   []int             `json:"total"`
+			Series  []*timelineSeries `json:"series"`
+		}
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, nil, err
+		}
+		for _, s := range r.Series {
+			for i, p := range r.Periods {
+				row := []string{s.Phrase, p, strconv.Itoa(s.Files[i]), strconv.Itoa(r.Total[i]), ""}
+				if s.Hits != nil {
+					row[4] = strconv.Itoa(s.Hits[i])
+				}
+				rows = append(rows, row)
+			}
+		}
+		return []string{"phrase", "period", "files", "dated_files", "hits"}, rows, nil
+	}
+	return nil, nil, fmt.Errorf("%s reports cannot be flattened", jobType)
+}
+
+// chainPhrases joins the phrases of a chain
+func chainPhrases(chain []ChainNode) string {
+	phrases := make([]string, len(chain))
+	for i, node := range chain {
+		phrases[i] = node.Phrase
+	}
+	return strings.Join(phrases, " → ")
+}
+
+// formatFloat writes a score in its shortest form, or "" if absent
+func formatFloat(f *float64) string {
+	if f == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f, 'g', -1, 64)
+}
@@ -0,0 +1,98 @@
+package web
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/openfluke/tokentrove/pkg"
+)
+
+// listFiles pages through the files of the cache with their token counts:
+// /api/files?limit=50&offset=0, with the path and ext filters of search
+func listFiles(c *fiber.Ctx, config *CacheConfig) error {
+	filter, err := fileFilter(config, c.Query("path"), c.Query("ext"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	limit, _ := strconv.Atoi(c.Query("limit", "50"))
+	if limit <= 0 {
+		limit = 50
+	}
+	offset := max(0, c.QueryInt("offset"))
+
+	m := config.mem()
+	var selected []int
+	for i := range m.files {
+		if filter == nil || filter.Contains(uint32(i)) {
+			selected = append(selected, i)
+		}
+	}
+	files := []fiber.Map{}
+	for _, i := range selected[min(offset, len(selected)):min(offset+limit, len(selected))] {
+		file := fiber.Map{"index": i, "file": m.files[i]}
+		if i < len(m.lengths) {
+			file["tokens"] = m.lengths[i]
+		}
+		files = append(files, file)
+	}
+	return c.JSON(fiber.Map{"type": "files", "total": len(selected), "offset": offset, "limit": limit, "files": files})
+}
+
+// getFile returns a file's tokenized text and the n-grams it contains found
+// in the most files: /api/file/:idx?n=3&limit=50. The text needs
+// positions.bin, docs/ or the token files; the n-grams need -cache
+// ngramfiles, and are left out with an "ngramError" without it.
+func getFile(c *fiber.Ctx, config *CacheConfig) error {
+	fileIdx, err := strconv.Atoi(c.Params("idx"))
+	m := config.mem()
+	if err != nil || fileIdx < 0 || fileIdx >= len(m.files) {
+		return c.Status(404).JSON(fiber.Map{"error": "no such file"})
+	}
+	n, _ := strconv.Atoi(c.Query("n", strconv.Itoa(min(3, config.MaxN))))
+	limit, _ := strconv.Atoi(c.Query("limit", "50"))
+	if limit <= 0 {
+		limit = 50
+	}
+
+	result, err := fileResult(config, fileIdx, n, limit)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(result)
+}
+
+// fileResult reads the text of file fileIdx and its limit n-grams found in
+// the most files, as getFile returns them
+func fileResult(config *CacheConfig, fileIdx, n, limit int) (fiber.Map, error) {
+	ix, release, err := config.index()
+	if err != nil {
+		return nil, err
+	}
+	words, err := ix.FileWords(fileIdx)
+	release()
+	if err != nil {
+		return nil, err
+	}
+	m := config.mem()
+	result := fiber.Map{
+		"type": "file", "index": fileIdx, "file": m.files[fileIdx],
+		"tokens": len(words), "text": strings.Join(words, " "), "n": n,
+	}
+
+	ngrams, err := pkg.FileNgrams(config.CacheDir, fileIdx, n, limit)
+	if err != nil {
+		result["ngramError"] = err.Error()
+		return result, nil
+	}
+	list := []fiber.Map{}
+	for _, ng := range ngrams {
+		var phrase []string
+		for _, id := range ng.Words {
+			phrase = append(phrase, m.words[id])
+		}
+		list = append(list, fiber.Map{"ngram": strings.Join(phrase, "|"), "words": phrase, "files": ng.Files})
+	}
+	result["ngrams"] = list
+	return result, nil
+}
@@ -0,0 +1,209 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// reportChain is a chain of any of the chain reports: recurring_text,
+// linked_ngrams and best_chains
+type reportChain struct {
+	Segments    []ChainNode `json:"segments"` // recurring_text; read into Chain
+	Chain       []ChainNode `json:"chain"`
+	FullText    string      `json:"fullText"`
+	Overlap     string      `json:"overlap"`
+	FileCount   int         `json:"fileCount"`
+	Files       []string    `json:"files"`
+	TotalLength int         `json:"totalLength"`
+	ChainLength int         `json:"chainLength"`
+	WordCount   int         `json:"wordCount"`
+	Score       int         `json:"score"`
+}
+
+// readChains reads the chains of a chain report, their file lists without
+// the note of the files left out
+func readChains(jobType string, data []byte) ([]reportChain, error) {
+	switch jobType {
+	case "recurring_text", "linked_ngrams", "best_chains":
+	default:
+		return nil, fmt.Errorf("%s reports have no chains", jobType)
+	}
+	var r struct {
+		Chains []reportChain `json:"chains"`
+	}
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	for i := range r.Chains {
+		ch := &r.Chains[i]
+		if ch.Chain == nil {
+			ch.Chain = ch.Segments
+		}
+		// Drop the "... and N more" entry ending a truncated file list
+		if k := len(ch.Files) - 1; k >= 0 && k < ch.FileCount && strings.HasPrefix(ch.Files[k], "...") {
+			ch.Files = ch.Files[:k]
+		}
+	}
+	return r.Chains, nil
+}
+
+// graphNode is an n-gram of a chain graph
+type graphNode struct {
+	ID     string `json:"id"`
+	Phrase string `json:"phrase"`
+	N      int    `json:"n"`
+	Count  int    `json:"count"`
+	Chains int    `json:"chains"` // the chains through it
+}
+
+// graphEdge links two n-grams that follow each other in a chain
+type graphEdge struct {
+	ID        string   `json:"id"`
+	Source    string   `json:"source"`
+	Target    string   `json:"target"`
+	Chains    int      `json:"chains"`    // the chains linking them
+	FileCount int      `json:"fileCount"` // files of the most widespread of those chains
+	Files     []string `json:"files"`     // the files those chains list
+}
+
+// chainGraph joins the chains of a report into one graph: every n-gram is a
+// node, however many chains it is in, and consecutive n-grams of a chain are
+// linked. Edges of fewer than minChains chains are left out, and then the
+// nodes left without an edge.
+func chainGraph(chains []reportChain, minChains int) ([]*graphNode, []*graphEdge) {
+	nodes := make(map[string]*graphNode)
+	var order []*graphNode
+	edges := make(map[[2]string]*graphEdge)
+	edgeFiles := make(map[[2]string]map[string]bool)
+	var edgeOrder []*graphEdge
+
+	for _, ch := range chains {
+		prev := ""
+		seen := make(map[string]bool)
+		seenEdges := make(map[[2]string]bool)
+		for _, cn := range ch.Chain {
+			node, ok := nodes[cn.Phrase]
+			if !ok {
+				node = &graphNode{ID: fmt.Sprintf("n%d", len(order)), Phrase: cn.Phrase, N: cn.N, Count: cn.Count}
+				nodes[cn.Phrase] = node
+				order = append(order, node)
+			}
+			if !seen[cn.Phrase] {
+				node.Chains++
+				seen[cn.Phrase] = true
+			}
+			if prev != "" && !seenEdges[[2]string{nodes[prev].ID, node.ID}] {
+				key := [2]string{nodes[prev].ID, node.ID}
+				seenEdges[key] = true
+				edge, ok := edges[key]
+				if !ok {
+					edge = &graphEdge{ID: fmt.Sprintf("e%d", len(edgeOrder)), Source: key[0], Target: key[1]}
+					edges[key], edgeFiles[key] = edge, make(map[string]bool)
+					edgeOrder = append(edgeOrder, edge)
+				}
+				edge.Chains++
+				edge.FileCount = max(edge.FileCount, ch.FileCount)
+				for _, f := range ch.Files {
+					edgeFiles[key][f] = true
+				}
+			}
+			prev = cn.Phrase
+		}
+	}
+
+	linked := make(map[string]bool)
+	resultEdges := []*graphEdge{}
+	for _, edge := range edgeOrder {
+		if edge.Chains < minChains {
+			continue
+		}
+		edge.Files = make([]string, 0, len(edgeFiles[[2]string{edge.Source, edge.Target}]))
+		for f := range edgeFiles[[2]string{edge.Source, edge.Target}] {
+			edge.Files = append(edge.Files, f)
+		}
+		sort.Strings(edge.Files)
+		linked[edge.Source], linked[edge.Target] = true, true
+		resultEdges = append(resultEdges, edge)
+	}
+	resultNodes := []*graphNode{}
+	for _, node := range order {
+		if minChains <= 1 || linked[node.ID] {
+			resultNodes = append(resultNodes, node)
+		}
+	}
+	return resultNodes, resultEdges
+}
+
+// reportGraph returns the chains of a recurring_text, linked_ngrams or
+// best_chains report as a graph of n-grams:
+// /api/report/:id/graph?format=json|dot|cytoscape&min_chains=1. JSON has
+// the nodes and edges, dot is a GraphViz digraph and cytoscape the elements
+// of Cytoscape.js.
+func reportGraph(c *fiber.Ctx, config *CacheConfig) error {
+	reportJobsMu.RLock()
+	job, ok := cacheJob(config, c.Params("id"))
+	var jobType, path, id string
+	if ok {
+		jobType, path, id = job.Type, job.FilePath, job.ID
+	}
+	reportJobsMu.RUnlock()
+	if !ok || path == "" {
+		return c.Status(404).JSON(fiber.Map{"error": "not found"})
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+	chains, err := readChains(jobType, data)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	nodes, edges := chainGraph(chains, max(1, c.QueryInt("min_chains", 1)))
+
+	switch format := c.Query("format", "json"); format {
+	case "json":
+		return c.JSON(fiber.Map{"type": "graph", "report": jobType, "chains": len(chains), "nodes": nodes, "edges": edges})
+	case "cytoscape":
+		var elements []fiber.Map
+		for _, n := range nodes {
+			elements = append(elements, fiber.Map{"group": "nodes", "data": n})
+		}
+		for _, e := range edges {
+			elements = append(elements, fiber.Map{"group": "edges", "data": e})
+		}
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s_%s_graph.json"`, jobType, id))
+		return c.JSON(fiber.Map{"elements": elements})
+	case "dot":
+		c.Set(fiber.HeaderContentType, "text/vnd.graphviz; charset=utf-8")
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s_%s.dot"`, jobType, id))
+		return c.SendString(chainDot(jobType, nodes, edges))
+	default:
+		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("unknown format %q (use json, dot or cytoscape)", format)})
+	}
+}
+
+// chainDot writes a chain graph in the GraphViz dot language, the edges
+// thicker the more chains link their n-grams
+func chainDot(name string, nodes []*graphNode, edges []*graphEdge) string {
+	quote := func(s string) string {
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %s {\n", quote(name))
+	b.WriteString("  rankdir=LR;\n  node [shape=box, style=rounded];\n")
+	for _, n := range nodes {
+		fmt.Fprintf(&b, "  %s [label=%s, tooltip=%s];\n", n.ID, quote(n.Phrase),
+			quote(fmt.Sprintf("%d-gram, count %d, in %d chains", n.N, n.Count, n.Chains)))
+	}
+	for _, e := range edges {
+		fmt.Fprintf(&b, "  %s -> %s [label=%s, penwidth=%d];\n", e.Source, e.Target,
+			quote(fmt.Sprintf("%d files", e.FileCount)), min(e.Chains, 8))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
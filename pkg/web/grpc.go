@@ -0,0 +1,343 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/openfluke/tokentrove/pkg"
+	"github.com/openfluke/tokentrove/pkg/rpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// grpcPort is the port of the gRPC API; 0 (the default) leaves it off
+var grpcPort int
+
+// SetGRPCPort makes StartServer also serve the gRPC API of pkg/rpc on port,
+// on the same address and with the same TLS certificate as the web
+// interface. 0 leaves it off.
+func SetGRPCPort(port int) {
+	grpcPort = port
+}
+
+// downloadChunkSize is the most report bytes in one DownloadReport message
+const downloadChunkSize = 64 << 10
+
+// listenGRPC starts the gRPC API on grpcPort, returning once it listens
+func listenGRPC() error {
+	lis, err := net.Listen("tcp", net.JoinHostPort(bindAddress, strconv.Itoa(grpcPort)))
+	if err != nil {
+		return fmt.Errorf("gRPC: %w", err)
+	}
+	var opts []grpc.ServerOption
+	if tlsCert != "" {
+		creds, err := credentials.NewServerTLSFromFile(tlsCert, tlsKey)
+		if err != nil {
+			lis.Close()
+			return fmt.Errorf("gRPC: %w", err)
+		}
+		opts = append(opts, grpc.Creds(creds))
+	}
+	s := grpc.NewServer(opts...)
+	rpc.RegisterTokenTroveServer(s, &grpcServer{})
+	pkg.Logger().Info("🔮 TokenTrove gRPC API", "addr", lis.Addr().String())
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			pkg.Logger().Error("gRPC server stopped", "error", err)
+		}
+	}()
+	return nil
+}
+
+// grpcServer answers the gRPC API with the handlers of the REST API
+type grpcServer struct {
+	rpc.UnimplementedTokenTroveServer
+}
+
+// cacheMetadata is the gRPC metadata key naming the cache a call is for, as
+// added with AddCache; without it calls go to the cache of StartServer
+const cacheMetadata = "cache"
+
+// cache returns the cache a call is for
+func (s *grpcServer) cache(ctx context.Context) (*CacheConfig, error) {
+	name := ""
+	if names := metadata.ValueFromIncomingContext(ctx, cacheMetadata); len(names) > 0 {
+		name = names[0]
+	}
+	config, ok := cacheByName(name)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no cache %q", name)
+	}
+	return config, nil
+}
+
+func (s *grpcServer) GetStats(ctx context.Context, req *rpc.GetStatsRequest) (*rpc.Stats, error) {
+	config, err := s.cache(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m := config.mem()
+	stats := &rpc.Stats{
+		WordCount:   int64(len(m.words)),
+		FileCount:   int64(len(m.files)),
+		MaxN:        int32(config.MaxN),
+		NgramCounts: make(map[int32]int64),
+		LoadedAt:    m.loadedAt.Format(time.RFC3339),
+	}
+	for n := 2; n <= config.MaxN; n++ {
+		stats.NgramCounts[int32(n)] = int64(m.counts[n])
+	}
+	reportJobsMu.RLock()
+	q := queueStats()
+	reportJobsMu.RUnlock()
+	stats.Queue = &rpc.QueueStats{
+		Depth:    int32(q["depth"].(int)),
+		Capacity: int32(q["capacity"].(int)),
+		Running:  int32(q["running"].(int)),
+		Workers:  int32(q["workers"].(int)),
+	}
+	return stats, nil
+}
+
+func (s *grpcServer) Search(ctx context.Context, req *rpc.SearchRequest) (*rpc.SearchResponse, error) {
+	config, err := s.cache(ctx)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := fileFilter(config, req.Path, req.Ext)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	stop, err := stopwordSet(req.Stopwords)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	limit := int(req.Limit)
+	if limit <= 0 {
+		limit = 20
+	}
+	config.queries.record(req.Query, req.Path, req.Ext)
+	result := runSearch(config, req.Query, filter, stop, req.Normalize, limit, int(req.Offset))
+
+	resp := &rpc.SearchResponse{}
+	for _, w := range result["words"].([]fiber.Map) {
+		resp.Words = append(resp.Words, &rpc.WordMatch{Index: int32(w["index"].(int)), Word: w["word"].(string)})
+	}
+	ngrams := result["ngrams"].(map[int][]fiber.Map)
+	sizes := make([]int, 0, len(ngrams))
+	for n := range ngrams {
+		sizes = append(sizes, n)
+	}
+	sort.Ints(sizes)
+	for _, n := range sizes {
+		for _, ng := range ngrams[n] {
+			resp.Ngrams = append(resp.Ngrams, &rpc.NgramMatch{N: int32(n), Words: ng["words"].([]string), Count: int64(ng["count"].(int))})
+		}
+	}
+	documents := result["documents"].(fiber.Map)
+	if e, ok := documents["error"].(string); ok {
+		resp.DocumentsError = e
+		return resp, nil
+	}
+	resp.Total = int32(documents["total"].(int))
+	for _, d := range documents["results"].([]fiber.Map) {
+		doc := &rpc.Document{
+			File:  d["file"].(string),
+			Index: int32(d["index"].(int)),
+			Score: d["score"].(float64),
+			Hits:  int32(d["hits"].(int)),
+		}
+		doc.Snippet, _ = d["snippet"].(string)
+		if h, ok := d["highlight"].(fiber.Map); ok {
+			doc.Highlight = &rpc.Highlight{
+				Before: h["before"].(string),
+				Match:  h["match"].(string),
+				After:  h["after"].(string),
+				Offset: int32(h["offset"].(int)),
+			}
+		}
+		resp.Documents = append(resp.Documents, doc)
+	}
+	return resp, nil
+}
+
+func (s *grpcServer) ListNgrams(ctx context.Context, req *rpc.ListNgramsRequest) (*rpc.ListNgramsResponse, error) {
+	config, err := s.cache(ctx)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := fileFilter(config, req.Path, req.Ext)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	stop, err := stopwordSet(req.Stopwords)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	limit := int(req.Limit)
+	if limit <= 0 {
+		limit = 50
+	}
+	opts := ngramOptions{Sort: req.Sort, MinCount: int(req.MinCount), Contains: req.Contains}
+	result, err := streamNgramsWS(config, int(req.N), limit, int(req.Offset), filter, stop, opts)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	resp := &rpc.ListNgramsResponse{
+		N:      req.N,
+		Sort:   result["sort"].(string),
+		Total:  int64(result["total"].(int)),
+		Offset: int32(result["offset"].(int)),
+	}
+	ngrams, _ := result["ngrams"].([]fiber.Map)
+	for _, ng := range ngrams {
+		resp.Ngrams = append(resp.Ngrams, &rpc.Ngram{Words: ng["words"].([]string), Count: int64(ng["count"].(int))})
+	}
+	return resp, nil
+}
+
+func (s *grpcServer) CreateReport(ctx context.Context, req *rpc.CreateReportRequest) (*rpc.Report, error) {
+	config, err := s.cache(ctx)
+	if err != nil {
+		return nil, err
+	}
+	job, err := enqueueReport(config, reportRequest{
+		Type:          req.Type,
+		Query:         req.Query,
+		ChainDepth:    int(req.ChainDepth),
+		Overlap:       int(req.Overlap),
+		MinN:          int(req.MinN),
+		MinFiles:      int(req.MinFiles),
+		SkipNumeric:   req.SkipNumeric,
+		TopN:          int(req.TopN),
+		Width:         int(req.Width),
+		Path:          req.Path,
+		Ext:           req.Ext,
+		Period:        req.Period,
+		Priority:      int(req.Priority),
+		SkipStopwords: req.SkipStopwords,
+		Stopwords:     req.Stopwords,
+	})
+	if errors.Is(err, errQueueFull) {
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	} else if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	reportJobsMu.RLock()
+	defer reportJobsMu.RUnlock()
+	return reportMessage(job), nil
+}
+
+func (s *grpcServer) GetReport(ctx context.Context, req *rpc.GetReportRequest) (*rpc.Report, error) {
+	config, err := s.cache(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reportJobsMu.RLock()
+	defer reportJobsMu.RUnlock()
+	job, ok := cacheJob(config, req.Id)
+	if !ok {
+		return nil, status.Error(codes.NotFound, "not found")
+	}
+	return reportMessage(job), nil
+}
+
+func (s *grpcServer) ListReports(ctx context.Context, req *rpc.ListReportsRequest) (*rpc.ListReportsResponse, error) {
+	config, err := s.cache(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp := &rpc.ListReportsResponse{}
+	for _, f := range reportFiles(config.ReportsDir) {
+		resp.DiskUsage += f.size
+	}
+	reportJobsMu.RLock()
+	defer reportJobsMu.RUnlock()
+	var jobs []*ReportJob
+	for _, j := range reportJobs {
+		if j.config == config {
+			jobs = append(jobs, j)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.After(jobs[j].CreatedAt) })
+	for _, j := range jobs {
+		resp.Reports = append(resp.Reports, reportMessage(j))
+	}
+	return resp, nil
+}
+
+func (s *grpcServer) DeleteReport(ctx context.Context, req *rpc.DeleteReportRequest) (*rpc.DeleteReportResponse, error) {
+	config, err := s.cache(ctx)
+	if err != nil {
+		return nil, err
+	}
+	job, err := cancelReport(config, req.Id)
+	if errors.Is(err, errNoReport) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	} else if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if job == nil {
+		return &rpc.DeleteReportResponse{Deleted: true}, nil
+	}
+	return &rpc.DeleteReportResponse{Report: reportMessage(job)}, nil
+}
+
+func (s *grpcServer) DownloadReport(req *rpc.DownloadReportRequest, stream grpc.ServerStreamingServer[rpc.ReportChunk]) error {
+	config, err := s.cache(stream.Context())
+	if err != nil {
+		return err
+	}
+	format := req.Format
+	if format == "" {
+		format = "json"
+	}
+	_, _, data, err := exportReport(config, req.Id, format)
+	switch {
+	case errors.Is(err, errNoReport):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, errBadFormat):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case err != nil:
+		return status.Error(codes.Internal, err.Error())
+	}
+	for len(data) > 0 {
+		n := min(len(data), downloadChunkSize)
+		if err := stream.Send(&rpc.ReportChunk{Data: data[:n]}); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+// reportMessage converts a job to its gRPC message; the caller holds
+// reportJobsMu, or has a copy of the job
+func reportMessage(j *ReportJob) *rpc.Report {
+	return &rpc.Report{
+		Id:          j.ID,
+		Type:        j.Type,
+		Name:        j.Name,
+		Description: j.Description,
+		Status:      j.Status,
+		Progress:    int32(j.Progress),
+		Total:       int32(j.Total),
+		Message:     j.Message,
+		CreatedAt:   j.CreatedAt.Format(time.RFC3339),
+		Size:        j.Size,
+		Schedule:    j.Schedule,
+		Error:       j.Error,
+		Position:    int32(j.Position),
+		Priority:    int32(j.Priority),
+	}
+}
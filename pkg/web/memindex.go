@@ -0,0 +1,168 @@
+package web
+
+import (
+	"time"
+
+	"github.com/openfluke/tokentrove/pkg"
+	"github.com/openfluke/tokentrove/pkg/query"
+)
+
+// ngramCacheSize is the number of most frequent n-grams of each size kept in
+// memory by the web server
+var ngramCacheSize = 10000
+
+// SetNgramCacheSize sets how many of the most frequent n-grams of each size
+// the web server keeps in memory (default 10000). Listings and searches
+// reaching beyond them read the frequency files.
+func SetNgramCacheSize(k int) {
+	if k >= 0 {
+		ngramCacheSize = k
+	}
+}
+
+// memIndex is what the search and n-gram listings need on every request,
+// loaded once at StartServer and again by POST /api/refresh
+type memIndex struct {
+	words    map[int]string
+	files    []string
+	lengths  []int                    // tokens per file, from stats.txt; nil without -cache stats
+	ngrams   map[int][]NgramWithFiles // the top ngramCacheSize of each n, most frequent first
+	counts   map[int]int              // the lines of each {n}gramfreq.txt
+	loadedAt time.Time
+}
+
+// loadMemIndex reads the vocabulary, the file list and the top n-grams of
+// each size up to maxN
+func loadMemIndex(cacheDir string, maxN int) (*memIndex, error) {
+	cache, err := pkg.OpenCache(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	words, err := cache.WordIndex()
+	if err != nil {
+		return nil, err
+	}
+	files, err := cache.Files()
+	if err != nil {
+		return nil, err
+	}
+	m := &memIndex{
+		words:    make(map[int]string, len(words)),
+		files:    files,
+		ngrams:   make(map[int][]NgramWithFiles),
+		counts:   make(map[int]int),
+		loadedAt: time.Now(),
+	}
+	// A stemmed cache shows each stem as the word it most often was
+	forms, _ := pkg.LoadStemForms(cacheDir)
+	for i, w := range words {
+		if f := forms[w]; len(f) > 0 {
+			w = f[0]
+		}
+		m.words[i] = w
+	}
+	if lengths, err := pkg.LoadDocLengths(cacheDir); err == nil {
+		m.lengths = lengths
+	}
+	for n := 2; n <= maxN; n++ {
+		ngrams, count, err := loadTopNgrams(cacheDir, n, m.words, ngramCacheSize)
+		if err != nil {
+			return nil, err
+		}
+		m.ngrams[n], m.counts[n] = ngrams, count
+	}
+	return m, nil
+}
+
+// loadTopNgrams reads the first limit n-grams of {n}gramfreq.txt and counts
+// all of its lines
+func loadTopNgrams(cacheDir string, n int, wordIndex map[int]string, limit int) ([]NgramWithFiles, int, error) {
+	it, err := pkg.OpenNgramIterator(cacheDir, n)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer it.Close()
+
+	var result []NgramWithFiles
+	count := 0
+	for it.Next() {
+		count++
+		if len(result) < limit {
+			result = append(result, freqNgram(it.Ngram(), wordIndex))
+		}
+	}
+	return result, count, it.Err()
+}
+
+// mem returns the in-memory index of the cache
+func (config *CacheConfig) mem() *memIndex {
+	config.memMu.RLock()
+	defer config.memMu.RUnlock()
+	return config.memIdx
+}
+
+// refresh reloads the in-memory index and reopens the query index, after the
+// cache was updated under the running server
+func (config *CacheConfig) refresh() error {
+	m, err := loadMemIndex(config.CacheDir, config.MaxN)
+	if err != nil {
+		return err
+	}
+	config.memMu.Lock()
+	config.memIdx = m
+	config.memMu.Unlock()
+
+	config.searchMu.Lock()
+	if old := config.searchIndex; old != nil {
+		old.retired = true
+		if old.users == 0 {
+			old.ix.Close()
+		}
+	}
+	config.searchIndex, config.searchErr = nil, nil
+	config.searchMu.Unlock()
+	return nil
+}
+
+// openIndex is the query index of a cache with the number of searches using
+// it, so one replaced by a refresh is closed as the last of them finishes
+type openIndex struct {
+	ix      *query.Index
+	users   int
+	retired bool
+}
+
+// releaseIndex ends a use of open begun by index
+func (config *CacheConfig) releaseIndex(open *openIndex) {
+	config.searchMu.Lock()
+	defer config.searchMu.Unlock()
+	open.users--
+	if open.retired && open.users == 0 {
+		open.ix.Close()
+	}
+}
+
+// wordIndex returns the vocabulary by word index
+func (config *CacheConfig) wordIndex() map[int]string {
+	return config.mem().words
+}
+
+// fileIndex returns the paths of files.txt
+func (config *CacheConfig) fileIndex() []string {
+	return config.mem().files
+}
+
+// loadFreqNgrams is loadNgramsFreqOnly for the served cache, answered from
+// memory when the first limit (0 = all) n-grams were loaded. The slice is
+// shared and must not be modified.
+func (config *CacheConfig) loadFreqNgrams(_ string, n int, _ map[int]string, limit int) []NgramWithFiles {
+	m := config.mem()
+	cached, ok := m.ngrams[n]
+	if ok && (len(cached) == m.counts[n] || limit > 0 && limit <= len(cached)) {
+		if limit > 0 && limit < len(cached) {
+			return cached[:limit]
+		}
+		return cached
+	}
+	return loadNgramsFreqOnly(config.CacheDir, n, m.words, limit)
+}
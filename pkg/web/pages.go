@@ -0,0 +1,299 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// The server-rendered pages share views/layouts/page. They read the same
+// reports and files as the JSON API, for browsing without the main page.
+
+// pageFuncs are the template functions of the pages
+var pageFuncs = map[string]interface{}{
+	"bytes": formatBytes,
+	"list":  func(v ...interface{}) []interface{} { return v },
+	"inc":   func(i int) int { return i + 1 },
+	"add":   func(a, b int) int { return a + b },
+	"mod":   func(a, b int) int { return a % b },
+	"join":  strings.Join,
+}
+
+// formatBytes writes a size in B, KB, MB or GB, as the web interface does
+func formatBytes(n int64) string {
+	units := []string{"B", "KB", "MB", "GB"}
+	f, i := float64(n), 0
+	for f >= 1024 && i < len(units)-1 {
+		f /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%.1f %s", f, units[i])
+}
+
+// reportTypes are the report types, in the order of the report form
+var reportTypes = []string{"top_ngrams", "search", "recurring_text", "linked_ngrams", "best_chains",
+	"kwic", "similar", "collocations", "timeline", "boilerplate", "outliers", "zipf", "markov", "topics", "pii"}
+
+// reportsPage lists the reports of this run of the server, newest first:
+// /reports?type=&status=&q=, q matching the name or description
+func reportsPage(c *fiber.Ctx, config *CacheConfig) error {
+	typ, status, q := c.Query("type"), c.Query("status"), strings.ToLower(c.Query("q"))
+	var diskUsage int64
+	for _, f := range reportFiles(config.ReportsDir) {
+		diskUsage += f.size
+	}
+
+	reportJobsMu.RLock()
+	var jobs []ReportJob
+	total := 0
+	for _, j := range reportJobs {
+		if j.config != config {
+			continue
+		}
+		total++
+		if typ != "" && j.Type != typ || status != "" && j.Status != status ||
+			q != "" && !strings.Contains(strings.ToLower(j.Name+" "+j.Description), q) {
+			continue
+		}
+		jobs = append(jobs, *j)
+	}
+	reportJobsMu.RUnlock()
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.After(jobs[j].CreatedAt) })
+
+	return c.Render("views/reports", fiber.Map{
+		"Base": config.base(), "Title": "Reports", "Jobs": jobs, "Total": total, "DiskUsage": diskUsage,
+		"Types": reportTypes, "Type": typ, "Status": status, "Query": c.Query("q"),
+		"Statuses": []string{"queued", "running", "done", "error", "cancelled"},
+	}, "views/layouts/page")
+}
+
+// pageChain is a chain of a recurring_text, linked_ngrams or best_chains
+// report as the report page shows it
+type pageChain struct {
+	Text  string
+	Nodes []ChainNode
+	Stats []string
+	Files []pageFile
+	More  int // files counted but not listed in the report
+}
+
+// pageFile is a file a page links to, Index -1 if it is not in the cache
+type pageFile struct {
+	Index int
+	Path  string
+}
+
+// pageCell is a table cell, linked to Link if set
+type pageCell struct {
+	Text string
+	Link string
+}
+
+// reportPage shows a report: its chains with their files for the chain
+// reports, a table of its rows for the others. Unfinished reports show
+// their progress and reload.
+func reportPage(c *fiber.Ctx, config *CacheConfig) error {
+	reportJobsMu.RLock()
+	j, ok := cacheJob(config, c.Params("id"))
+	var job ReportJob
+	if ok {
+		job = *j
+	}
+	reportJobsMu.RUnlock()
+	if !ok {
+		return c.Status(404).Render("views/notfound", fiber.Map{"Base": config.base(), "Title": "Not found", "What": "report"}, "views/layouts/page")
+	}
+	bind := fiber.Map{"Base": config.base(), "Title": job.Name, "Job": job}
+	if job.Total > 0 {
+		bind["Percent"] = job.Progress * 100 / job.Total
+	}
+	if job.Status == "queued" || job.Status == "running" {
+		bind["Refresh"] = 3
+	}
+	if job.Status != "done" || job.FilePath == "" {
+		return c.Render("views/report", bind, "views/layouts/page")
+	}
+	data, err := pageReportFile(&job, bind, max(0, c.QueryInt("offset")))
+	if err != nil {
+		bind["Error"] = err.Error()
+		return c.Render("views/report", bind, "views/layouts/page")
+	}
+
+	switch job.Type {
+	case "recurring_text", "linked_ngrams", "best_chains":
+		chains, err := pageChains(config, job.Type, data)
+		if err != nil {
+			bind["Error"] = err.Error()
+		}
+		bind["Chains"] = chains
+	default:
+		header, rows, err := reportRows(job.Type, data)
+		if err != nil {
+			bind["Error"] = err.Error()
+			break
+		}
+		bind["Header"], bind["Rows"] = header, pageRows(config, header, rows)
+	}
+	return c.Render("views/report", bind, "views/layouts/page")
+}
+
+// reportPageSize is the most results of each list a report page shows
+const reportPageSize = 200
+
+// pageReportFile reads the results of a report from offset for its page,
+// binding the links to the pages before and after it when there are more
+// than fit on one
+func pageReportFile(job *ReportJob, bind fiber.Map, offset int) ([]byte, error) {
+	bind["Offset"] = offset
+	data, totals, err := pageReport(job.FilePath, job.Type, offset, reportPageSize)
+	if errors.Is(err, errNotObject) {
+		return os.ReadFile(job.FilePath)
+	} else if err != nil {
+		return nil, err
+	}
+	total := 0
+	for _, n := range totals {
+		total = max(total, n)
+	}
+	bind["Total"] = total
+	if total > reportPageSize {
+		bind["Paged"] = true
+		bind["Last"] = min(offset+reportPageSize, total)
+		if offset > 0 {
+			bind["Prev"] = strconv.Itoa(max(0, offset-reportPageSize))
+		}
+		if offset+reportPageSize < total {
+			bind["Next"] = strconv.Itoa(offset + reportPageSize)
+		}
+	}
+	return json.Marshal(data)
+}
+
+// pageChains reads the chains of a chain report, finding the files they
+// list in the cache
+func pageChains(config *CacheConfig, jobType string, data []byte) ([]pageChain, error) {
+	chainsIn, err := readChains(jobType, data)
+	if err != nil {
+		return nil, err
+	}
+	byPath := make(map[string]int)
+	for i, f := range config.fileIndex() {
+		byPath[f] = i
+	}
+
+	chains := make([]pageChain, 0, len(chainsIn))
+	for _, ch := range chainsIn {
+		pc := pageChain{Text: ch.FullText, Nodes: ch.Chain, More: max(0, ch.FileCount-len(ch.Files))}
+		switch jobType {
+		case "recurring_text":
+			pc.Stats = []string{fmt.Sprintf("%d words", ch.TotalLength), fmt.Sprintf("overlap %q", ch.Overlap)}
+		case "linked_ngrams":
+			pc.Stats = []string{fmt.Sprintf("%d linked", ch.ChainLength)}
+		case "best_chains":
+			pc.Stats = []string{fmt.Sprintf("score %d", ch.Score), fmt.Sprintf("%d words", ch.WordCount)}
+		}
+		for _, f := range ch.Files {
+			idx, ok := byPath[f]
+			if !ok {
+				idx = -1
+			}
+			pc.Files = append(pc.Files, pageFile{idx, f})
+		}
+		chains = append(chains, pc)
+	}
+	return chains, nil
+}
+
+// pageRows links the file column of report rows to the file page of the
+// cache, when the rows carry the file's index, with the kwic match marked
+func pageRows(config *CacheConfig, header []string, rows [][]string) [][]pageCell {
+	fileCol, indexCol, matchCol := -1, -1, -1
+	for i, h := range header {
+		switch h {
+		case "file":
+			fileCol = i
+		case "index":
+			indexCol = i
+		case "match":
+			matchCol = i
+		}
+	}
+	cells := make([][]pageCell, len(rows))
+	for r, row := range rows {
+		cells[r] = make([]pageCell, len(row))
+		for i, v := range row {
+			cells[r][i].Text = v
+		}
+		if fileCol >= 0 && indexCol >= 0 {
+			link := config.base() + "/files/" + row[indexCol]
+			if matchCol >= 0 {
+				link += "?q=" + url.QueryEscape(row[matchCol])
+			}
+			cells[r][fileCol].Link = link
+		}
+	}
+	return cells
+}
+
+// pageText is a run of words of the file page, Mark if they are an
+// occurrence of the phrase looked for
+type pageText struct {
+	Text string
+	Mark bool
+}
+
+// filePage shows a file's text, with the words of ?q= marked, and its
+// n-grams found in the most other files: /files/:idx?q=&n=3
+func filePage(c *fiber.Ctx, config *CacheConfig) error {
+	fileIdx, err := strconv.Atoi(c.Params("idx"))
+	m := config.mem()
+	if err != nil || fileIdx < 0 || fileIdx >= len(m.files) {
+		return c.Status(404).Render("views/notfound", fiber.Map{"Base": config.base(), "Title": "Not found", "What": "file"}, "views/layouts/page")
+	}
+	n, _ := strconv.Atoi(c.Query("n", strconv.Itoa(min(3, config.MaxN))))
+	result, err := fileResult(config, fileIdx, n, 50)
+	if err != nil {
+		return c.Status(500).Render("views/file", fiber.Map{"Base": config.base(), "Title": m.files[fileIdx], "Error": err.Error()}, "views/layouts/page")
+	}
+
+	words := strings.Fields(result["text"].(string))
+	phrase := strings.Fields(strings.ToLower(c.Query("q")))
+	var text []pageText
+	marks, start := 0, 0
+	for i := 0; len(phrase) > 0 && i+len(phrase) <= len(words); i++ {
+		match := true
+		for k, p := range phrase {
+			if strings.ToLower(words[i+k]) != p {
+				match = false
+				break
+			}
+		}
+		if !match {
+			continue
+		}
+		if start < i {
+			text = append(text, pageText{strings.Join(words[start:i], " "), false})
+		}
+		text = append(text, pageText{strings.Join(words[i:i+len(phrase)], " "), true})
+		marks++
+		i += len(phrase) - 1
+		start = i + 1
+	}
+	if start < len(words) {
+		text = append(text, pageText{strings.Join(words[start:], " "), false})
+	}
+
+	return c.Render("views/file", fiber.Map{
+		"Base": config.base(), "Title": m.files[fileIdx], "File": result, "Text": text, "Query": c.Query("q"), "Marks": marks,
+	}, "views/layouts/page")
+}
@@ -0,0 +1,238 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/openfluke/tokentrove/pkg"
+	"github.com/openfluke/tokentrove/pkg/query"
+)
+
+// QueriesName is the file in the reports directory holding the saved queries
+// and the search history
+const QueriesName = "queries.json"
+
+// maxHistory is the number of past searches kept
+const maxHistory = 100
+
+// SavedQuery is a named search with its file filter
+type SavedQuery struct {
+	Name      string     `json:"name"`
+	Query     string     `json:"query"`
+	Path      string     `json:"path,omitempty"`
+	Ext       string     `json:"ext,omitempty"`
+	Stopwords string     `json:"stopwords,omitempty"`
+	Normalize bool       `json:"normalize,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	LastRun   *time.Time `json:"lastRun,omitempty"`
+}
+
+// PastQuery is a search run from the web interface, newest first in the
+// history
+type PastQuery struct {
+	Query string    `json:"query"`
+	Path  string    `json:"path,omitempty"`
+	Ext   string    `json:"ext,omitempty"`
+	RunAt time.Time `json:"runAt"`
+}
+
+// queryStore keeps the saved queries and search history, written back to
+// queries.json on every change so they outlive the server
+type queryStore struct {
+	mu      sync.Mutex
+	path    string
+	Saved   []SavedQuery `json:"saved"`
+	History []PastQuery  `json:"history"`
+}
+
+// loadQueryStore reads queries.json from dir; a missing file is an empty store
+func loadQueryStore(dir string) (*queryStore, error) {
+	store := &queryStore{path: filepath.Join(dir, QueriesName)}
+	data, err := os.ReadFile(store.path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, store); err != nil {
+		return nil, fmt.Errorf("could not read %s: %w", store.path, err)
+	}
+	return store, nil
+}
+
+// save writes the store; the caller holds mu
+func (s *queryStore) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// record adds a search to the history. Repeating the latest search only
+// moves its time. The strings are copied, as fiber reuses those of a request.
+func (s *queryStore) record(q, pathGlob, exts string) {
+	if strings.TrimSpace(q) == "" {
+		return
+	}
+	q, pathGlob, exts = strings.Clone(q), strings.Clone(pathGlob), strings.Clone(exts)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry := PastQuery{Query: q, Path: pathGlob, Ext: exts, RunAt: time.Now()}
+	if len(s.History) > 0 && s.History[0].Query == q && s.History[0].Path == pathGlob && s.History[0].Ext == exts {
+		s.History[0] = entry
+	} else {
+		s.History = append([]PastQuery{entry}, s.History[:min(len(s.History), maxHistory-1)]...)
+	}
+	if err := s.save(); err != nil {
+		pkg.Logger().Error("Could not save search history", "error", err)
+	}
+}
+
+// find returns the index of the saved query called name, or -1
+func (s *queryStore) find(name string) int {
+	for i, q := range s.Saved {
+		if q.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// listQueries returns the saved queries and the search history
+func listQueries(c *fiber.Ctx, config *CacheConfig) error {
+	s := config.queries
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return c.JSON(fiber.Map{"saved": s.Saved, "history": s.History})
+}
+
+// saveQuery saves {"name", "query", "path", "ext", "stopwords", "normalize"},
+// replacing a saved query of the same name
+func saveQuery(c *fiber.Ctx, config *CacheConfig) error {
+	var req SavedQuery
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || strings.TrimSpace(req.Query) == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "a saved query needs a name and a query"})
+	}
+	if _, err := query.Parse(req.Query); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if _, err := fileFilter(config, req.Path, req.Ext); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if _, err := stopwordSet(req.Stopwords); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	s := config.queries
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	saved := SavedQuery{Name: req.Name, Query: req.Query, Path: req.Path, Ext: req.Ext, Stopwords: req.Stopwords,
+		Normalize: req.Normalize, CreatedAt: time.Now()}
+	if i := s.find(req.Name); i >= 0 {
+		saved.CreatedAt = s.Saved[i].CreatedAt
+		s.Saved[i] = saved
+	} else {
+		s.Saved = append(s.Saved, saved)
+	}
+	if err := s.save(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(saved)
+}
+
+// deleteQuery removes the saved query named in the path
+func deleteQuery(c *fiber.Ctx, config *CacheConfig) error {
+	name, _ := url.PathUnescape(c.Params("name"))
+	s := config.queries
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.find(name)
+	if i < 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "not found"})
+	}
+	s.Saved = append(s.Saved[:i], s.Saved[i+1:]...)
+	if err := s.save(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"deleted": name})
+}
+
+// savedQuery looks up the query named in the path and marks it run
+func savedQuery(c *fiber.Ctx, config *CacheConfig) (SavedQuery, bool) {
+	name, _ := url.PathUnescape(c.Params("name"))
+	s := config.queries
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.find(name)
+	if i < 0 {
+		return SavedQuery{}, false
+	}
+	now := time.Now()
+	s.Saved[i].LastRun = &now
+	if err := s.save(); err != nil {
+		pkg.Logger().Error("Could not save queries", "error", err)
+	}
+	return s.Saved[i], true
+}
+
+// runSavedQuery answers a saved query like /api/search:
+// /api/queries/:name/run?limit=20&offset=0
+func runSavedQuery(c *fiber.Ctx, config *CacheConfig) error {
+	saved, ok := savedQuery(c, config)
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "not found"})
+	}
+	filter, err := fileFilter(config, saved.Path, saved.Ext)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	stop, err := stopwordSet(saved.Stopwords)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	limit, _ := strconv.Atoi(c.Query("limit", "20"))
+	offset, _ := strconv.Atoi(c.Query("offset", "0"))
+	config.queries.record(saved.Query, saved.Path, saved.Ext)
+	return c.JSON(runSearch(config, saved.Query, filter, stop, saved.Normalize, limit, offset))
+}
+
+// reportSavedQuery queues a report on a saved query and its filter. The body
+// takes the options of POST /api/report; the type defaults to "search".
+func reportSavedQuery(c *fiber.Ctx, config *CacheConfig) error {
+	saved, ok := savedQuery(c, config)
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "not found"})
+	}
+	var req reportRequest
+	c.BodyParser(&req)
+	if req.Type == "" {
+		req.Type = "search"
+	}
+	req.Query, req.Path, req.Ext = saved.Query, saved.Path, saved.Ext
+	if saved.Stopwords != "" {
+		req.SkipStopwords, req.Stopwords = true, saved.Stopwords
+	}
+	job, err := enqueueReport(config, req)
+	if err != nil {
+		return c.Status(enqueueStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return jobJSON(c, job)
+}
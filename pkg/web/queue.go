@@ -0,0 +1,205 @@
+package web
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// reportQueueSize is the number of reports that can wait for a worker
+var reportQueueSize = 100
+
+// SetReportQueueSize sets how many reports can wait for a worker (default
+// 100); reports queued beyond it are refused
+func SetReportQueueSize(n int) {
+	if n > 0 {
+		reportQueueSize = n
+	}
+}
+
+// errQueueFull refuses a report when reportQueueSize reports are waiting
+var errQueueFull = errors.New("the report queue is full; try again when a report finishes")
+
+var (
+	// reportQueue holds the queued jobs in the order the workers take them:
+	// by priority, highest first, then in the order they were queued, unless
+	// moved. It is guarded by reportJobsMu.
+	reportQueue []*ReportJob
+	// queueReady wakes a worker waiting for a job
+	queueReady = sync.NewCond(&reportJobsMu)
+)
+
+// enqueueJob hands a new job to the report workers, after the queued jobs
+// of its priority or higher
+func enqueueJob(job *ReportJob) error {
+	reportJobsMu.Lock()
+	defer reportJobsMu.Unlock()
+	if len(reportQueue) >= reportQueueSize {
+		job.cancel()
+		return errQueueFull
+	}
+	reportJobs[job.ID] = job
+	i := 0
+	for i < len(reportQueue) && reportQueue[i].Priority >= job.Priority {
+		i++
+	}
+	insertQueued(job, i)
+	queueReady.Signal()
+	return nil
+}
+
+// insertQueued puts job at index i of the queue; the caller holds
+// reportJobsMu
+func insertQueued(job *ReportJob, i int) {
+	reportQueue = append(reportQueue, nil)
+	copy(reportQueue[i+1:], reportQueue[i:])
+	reportQueue[i] = job
+	updateQueuePositions()
+}
+
+// removeQueued takes job out of the queue, reporting whether it was there;
+// the caller holds reportJobsMu
+func removeQueued(job *ReportJob) bool {
+	for i, j := range reportQueue {
+		if j == job {
+			reportQueue = append(reportQueue[:i], reportQueue[i+1:]...)
+			job.Position = 0
+			updateQueuePositions()
+			return true
+		}
+	}
+	return false
+}
+
+// nextJob waits for a queued job and marks it running
+func nextJob() *ReportJob {
+	reportJobsMu.Lock()
+	defer reportJobsMu.Unlock()
+	for len(reportQueue) == 0 {
+		queueReady.Wait()
+	}
+	job := reportQueue[0]
+	reportQueue = reportQueue[1:]
+	job.Status, job.Message, job.Position = "running", "Starting...", 0
+	updateQueuePositions()
+	return job
+}
+
+// jobJSON answers with a copy of job taken under reportJobsMu, as the
+// workers and the queue change its status and position meanwhile
+func jobJSON(c *fiber.Ctx, job *ReportJob) error {
+	reportJobsMu.RLock()
+	snapshot := *job
+	reportJobsMu.RUnlock()
+	return c.JSON(&snapshot)
+}
+
+// updateQueuePositions numbers the queued jobs in the order the workers take
+// them. The caller holds reportJobsMu.
+func updateQueuePositions() {
+	for i, j := range reportQueue {
+		j.Position = i + 1
+	}
+}
+
+// queueStats describes the queue for /api/stats; the caller holds
+// reportJobsMu
+func queueStats() fiber.Map {
+	running := 0
+	for _, j := range reportJobs {
+		if j.Status == "running" {
+			running++
+		}
+	}
+	return fiber.Map{"depth": len(reportQueue), "capacity": reportQueueSize, "running": running, "workers": reportWorkers}
+}
+
+// getQueue lists the running jobs of a cache and its queued ones in the
+// order they will run, with the counts of the queue every cache shares
+func getQueue(c *fiber.Ctx, config *CacheConfig) error {
+	reportJobsMu.RLock()
+	defer reportJobsMu.RUnlock()
+	running, queued := []*ReportJob{}, []*ReportJob{}
+	for _, j := range reportJobs {
+		if j.config == config && j.Status == "running" {
+			running = append(running, j)
+		}
+	}
+	for _, j := range reportQueue {
+		if j.config == config {
+			queued = append(queued, j)
+		}
+	}
+	stats := queueStats()
+	stats["runningJobs"], stats["queued"] = running, queued
+	return c.JSON(stats)
+}
+
+// moveQueued answers POST /api/queue/:id with {"priority": p} and/or
+// {"position": k}: a new priority moves the job behind the others of its
+// priority or higher, and a position puts it there, 1 being next
+func moveQueued(c *fiber.Ctx, config *CacheConfig) error {
+	var req struct {
+		Priority *int `json:"priority"`
+		Position int  `json:"position"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if req.Priority == nil && req.Position <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "give a priority or a position"})
+	}
+	reportJobsMu.Lock()
+	defer reportJobsMu.Unlock()
+	job, ok := cacheJob(config, c.Params("id"))
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "not found"})
+	}
+	if !removeQueued(job) {
+		return c.Status(409).JSON(fiber.Map{"error": "the report is " + job.Status + ", not queued"})
+	}
+	i := len(reportQueue)
+	if req.Priority != nil {
+		job.Priority = *req.Priority
+		for i = 0; i < len(reportQueue) && reportQueue[i].Priority >= job.Priority; i++ {
+		}
+	}
+	if req.Position > 0 {
+		i = min(req.Position-1, len(reportQueue))
+	}
+	insertQueued(job, i)
+	return c.JSON(job)
+}
+
+// dropQueued drops a queued job, or with no id every queued job of the
+// cache, leaving running ones alone
+func dropQueued(c *fiber.Ctx, config *CacheConfig) error {
+	reportJobsMu.Lock()
+	defer reportJobsMu.Unlock()
+	var drop []*ReportJob
+	if id := c.Params("id"); id != "" {
+		job, ok := cacheJob(config, id)
+		if !ok {
+			return c.Status(404).JSON(fiber.Map{"error": "not found"})
+		}
+		if job.Status != "queued" {
+			return c.Status(409).JSON(fiber.Map{"error": "the report is " + job.Status + ", not queued"})
+		}
+		drop = append(drop, job)
+	} else {
+		for _, job := range reportQueue {
+			if job.config == config {
+				drop = append(drop, job)
+			}
+		}
+	}
+	ids := []string{}
+	for _, job := range drop {
+		removeQueued(job)
+		job.cancel()
+		job.Status, job.Message = "cancelled", "Dropped from the queue"
+		ids = append(ids, job.ID)
+	}
+	return c.JSON(fiber.Map{"dropped": ids})
+}
@@ -0,0 +1,91 @@
+package web
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/gofiber/fiber/v2"
+	"github.com/openfluke/tokentrove/pkg"
+)
+
+// reloadDelay is how long a cache directory must go without changes before
+// the server reloads it; 0 leaves the caches unwatched
+var reloadDelay = 5 * time.Second
+
+// SetReloadDelay makes StartServer reload a cache once its files have not
+// changed for d (default 5s), so a rebuild under the running server is
+// served without a restart. 0 turns the watching off.
+func SetReloadDelay(d time.Duration) {
+	reloadDelay = max(0, d)
+}
+
+// watchCache reloads a cache whenever its directory settles after a change,
+// until the server stops
+func watchCache(config *CacheConfig) {
+	log := pkg.Logger().With("cache", config.CacheDir)
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Warn("Cannot watch for rebuilds", "error", err)
+		return
+	}
+	defer w.Close()
+	if err := w.Add(config.CacheDir); err != nil {
+		log.Warn("Cannot watch for rebuilds", "error", err)
+		return
+	}
+
+	reportsDir := filepath.Clean(config.ReportsDir)
+	var settled <-chan time.Time
+	for {
+		select {
+		case ev, ok := <-w.Events:
+			if !ok {
+				return
+			}
+			// Reports written into the cache directory are not a rebuild
+			if ev.Op == fsnotify.Chmod || config.ReportsDir != "" && filepath.Dir(ev.Name) == reportsDir {
+				continue
+			}
+			settled = time.After(reloadDelay)
+		case err, ok := <-w.Errors:
+			if !ok {
+				return
+			}
+			log.Warn("Watching for rebuilds", "error", err)
+		case <-settled:
+			settled = nil
+			if err := config.reload(); err != nil {
+				log.Warn("Cache changed; not reloaded", "error", err)
+				continue
+			}
+			m := config.mem()
+			log.Info("Reloaded", "words", len(m.words), "files", len(m.files))
+		}
+	}
+}
+
+// reload refreshes a cache after it was rebuilt, unless the build is still
+// writing or left the cache incomplete, in which case the cache keeps
+// serving what it loaded last
+func (config *CacheConfig) reload() error {
+	if partial := pkg.PartialArtifacts(config.CacheDir); len(partial) > 0 {
+		return fmt.Errorf("a build is writing %s", partial[0])
+	}
+	if err := pkg.VerifyCache(config.CacheDir, false, pkg.StepTokens, pkg.StepNgramFreq); err != nil {
+		return err
+	}
+	if m, err := pkg.LoadManifest(config.CacheDir); err == nil && m.Steps[pkg.StepNgramFreq].MaxN < config.MaxN {
+		return fmt.Errorf("the cache has n-grams up to %d, the server serves up to %d", m.Steps[pkg.StepNgramFreq].MaxN, config.MaxN)
+	}
+	return config.refresh()
+}
+
+// refreshIndex answers POST /api/refresh, reloading the cache at once
+func refreshIndex(c *fiber.Ctx, config *CacheConfig) error {
+	if err := config.reload(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(getStats(config))
+}
@@ -0,0 +1,206 @@
+package web
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// errNotObject is the error of a report file that is not a JSON object
+var errNotObject = errors.New("the report is not a JSON object")
+
+// pagedList reports whether the top-level field key of a report of jobType
+// is one of its lists of results, which views page and stream
+func pagedList(jobType, key string) bool {
+	switch jobType {
+	case "top_ngrams", "search", "collocations":
+		return strings.HasSuffix(key, "grams")
+	case "recurring_text", "linked_ngrams", "best_chains":
+		return key == "chains"
+	case "kwic":
+		return key == "lines"
+	case "similar", "boilerplate", "outliers", "pii":
+		return key == "files"
+	case "timeline":
+		return key == "series"
+	case "markov":
+		return key == "samples"
+	case "topics":
+		return key == "clusters"
+	}
+	return false
+}
+
+// walkReport reads a report file a result at a time, so no more of it is in
+// memory than one result: item is called with each element of its lists of
+// results and field with each of its other top-level fields, in file order,
+// and with the lists that are empty or null. A file that is not a JSON
+// object fails with errNotObject before either is called.
+func walkReport(path, jobType string, field func(key string, value json.RawMessage) error,
+	item func(key string, i int, value json.RawMessage) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(bufio.NewReaderSize(f, 1<<16))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return errNotObject
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := tok.(string)
+		if !pagedList(jobType, key) {
+			var value json.RawMessage
+			if err := dec.Decode(&value); err != nil {
+				return err
+			}
+			if err := field(key, value); err != nil {
+				return err
+			}
+			continue
+		}
+		if tok, err = dec.Token(); err != nil {
+			return err
+		}
+		if tok == nil {
+			if err := field(key, json.RawMessage("null")); err != nil {
+				return err
+			}
+			continue
+		}
+		if tok != json.Delim('[') {
+			return fmt.Errorf("%s of the report is not a list", key)
+		}
+		i := 0
+		for ; dec.More(); i++ {
+			var value json.RawMessage
+			if err := dec.Decode(&value); err != nil {
+				return err
+			}
+			if err := item(key, i, value); err != nil {
+				return err
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+		if i == 0 {
+			if err := field(key, json.RawMessage("[]")); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// pageReport reads a report with only the results offset to offset+limit of
+// each of its lists (limit 0 for all of them), and the full length of each
+// list
+func pageReport(path, jobType string, offset, limit int) (map[string]interface{}, map[string]int, error) {
+	data := make(map[string]interface{})
+	totals := make(map[string]int)
+	err := walkReport(path, jobType, func(key string, value json.RawMessage) error {
+		data[key] = value
+		if pagedList(jobType, key) {
+			totals[key] = 0
+		}
+		return nil
+	}, func(key string, i int, value json.RawMessage) error {
+		totals[key]++
+		list, _ := data[key].([]json.RawMessage)
+		if list == nil {
+			list = []json.RawMessage{}
+		}
+		if i >= offset && (limit <= 0 || i < offset+limit) {
+			list = append(list, value)
+		}
+		data[key] = list
+		return nil
+	})
+	return data, totals, err
+}
+
+// viewReport returns a finished report for display:
+// /api/report/:id/view?offset=0&limit=100. offset and limit page each list
+// of results of the report, and totals gives their full lengths; without a
+// limit the lists are whole. format=ndjson streams the report instead.
+func viewReport(c *fiber.Ctx, config *CacheConfig) error {
+	reportJobsMu.RLock()
+	j, ok := cacheJob(config, c.Params("id"))
+	var job ReportJob
+	if ok {
+		job = *j
+	}
+	reportJobsMu.RUnlock()
+	if !ok || job.FilePath == "" {
+		return c.Status(404).JSON(fiber.Map{"error": "not found"})
+	}
+	offset, limit := max(0, c.QueryInt("offset")), max(0, c.QueryInt("limit"))
+
+	switch format := c.Query("format", "json"); format {
+	case "json":
+	case "ndjson":
+		return streamReport(c, &job, offset, limit)
+	default:
+		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("unknown format %q (use json or ndjson)", format)})
+	}
+
+	data, totals, err := pageReport(job.FilePath, job.Type, offset, limit)
+	if errors.Is(err, errNotObject) {
+		text, err := os.ReadFile(job.FilePath)
+		if err != nil {
+			return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(fiber.Map{"job": job, "text": string(text)})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"job": job, "data": data, "totals": totals, "offset": offset, "limit": limit})
+}
+
+// streamReport sends a report as newline-delimited JSON as it reads it: a
+// "job" line, a "field" line for each top-level field that is not a list of
+// results, an "item" line for each result from offset (limit of each list,
+// 0 for all) and an "end" line with the full length of each list. An error
+// while streaming ends it with an "error" line.
+func streamReport(c *fiber.Ctx, job *ReportJob, offset, limit int) error {
+	c.Set(fiber.HeaderContentType, "application/x-ndjson")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		enc := json.NewEncoder(w)
+		enc.Encode(fiber.Map{"type": "job", "job": job})
+		totals := make(map[string]int)
+		err := walkReport(job.FilePath, job.Type, func(key string, value json.RawMessage) error {
+			return enc.Encode(fiber.Map{"type": "field", "name": key, "value": value})
+		}, func(key string, i int, value json.RawMessage) error {
+			totals[key]++
+			if i < offset || limit > 0 && i >= offset+limit {
+				return nil
+			}
+			if err := enc.Encode(fiber.Map{"type": "item", "list": key, "index": i, "item": value}); err != nil {
+				return err
+			}
+			// Send every few results rather than buffering the whole page
+			if (i-offset)%100 == 99 {
+				return w.Flush()
+			}
+			return nil
+		})
+		if err != nil {
+			enc.Encode(fiber.Map{"type": "error", "error": err.Error()})
+		} else {
+			enc.Encode(fiber.Map{"type": "end", "totals": totals})
+		}
+		w.Flush()
+	})
+	return nil
+}
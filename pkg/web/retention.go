@@ -0,0 +1,116 @@
+package web
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/openfluke/tokentrove/pkg"
+)
+
+// The retention policy of the reports directory; zero values keep everything
+var (
+	maxReports     int
+	maxReportAge   time.Duration
+	maxReportBytes int64
+)
+
+// janitorInterval is how often the janitor enforces the retention policy
+const janitorInterval = time.Minute
+
+// SetReportRetention limits the finished reports kept in the reports
+// directory to the newest maxCount, those younger than maxAge and, newest
+// first, those fitting in maxBytes. Zero leaves a limit off.
+func SetReportRetention(maxCount int, maxAge time.Duration, maxBytes int64) {
+	maxReports, maxReportAge, maxReportBytes = max(0, maxCount), max(0, maxAge), max(0, maxBytes)
+}
+
+// reportFile is a report on disk
+type reportFile struct {
+	path    string
+	id      string
+	size    int64
+	modTime time.Time
+}
+
+// reportFiles lists the reports written to dir, newest first, including
+// those of earlier runs of the server
+func reportFiles(dir string) []reportFile {
+	paths, _ := filepath.Glob(filepath.Join(dir, "report_*.json"))
+	var files []reportFile
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		id := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), "report_"), ".json")
+		files = append(files, reportFile{path, id, info.Size(), info.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.After(files[j].modTime) })
+	return files
+}
+
+// reportJanitor enforces the retention policy every janitorInterval and
+// whenever a report finishes, until the server stops
+func reportJanitor(config *CacheConfig) {
+	ticker := time.NewTicker(janitorInterval)
+	defer ticker.Stop()
+	for {
+		enforceRetention(config)
+		select {
+		case <-ticker.C:
+		case <-config.janitorKick:
+		}
+	}
+}
+
+// kickJanitor asks the janitor of a cache to run without waiting for it
+func kickJanitor(config *CacheConfig) {
+	select {
+	case config.janitorKick <- struct{}{}:
+	default:
+	}
+}
+
+// enforceRetention deletes the reports beyond the retention policy, oldest
+// first, and forgets their jobs
+func enforceRetention(config *CacheConfig) {
+	if config.ReportsDir == "" || maxReports == 0 && maxReportAge == 0 && maxReportBytes == 0 {
+		return
+	}
+	now := time.Now()
+	var total int64
+	for i, f := range reportFiles(config.ReportsDir) {
+		expired := maxReports > 0 && i >= maxReports ||
+			maxReportAge > 0 && now.Sub(f.modTime) > maxReportAge ||
+			maxReportBytes > 0 && total+f.size > maxReportBytes
+		if !expired {
+			total += f.size
+			continue
+		}
+		if err := removeReport(f.id, f.path); err != nil {
+			pkg.Logger().Warn("Could not remove report", "path", f.path, "error", err)
+		}
+	}
+}
+
+// removeReport deletes a report's file and job, unless the job is still
+// queued or running
+func removeReport(id, path string) error {
+	reportJobsMu.Lock()
+	if job, ok := reportJobs[id]; ok && (job.Status == "queued" || job.Status == "running") {
+		reportJobsMu.Unlock()
+		return nil
+	}
+	delete(reportJobs, id)
+	reportJobsMu.Unlock()
+	if path == "" {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
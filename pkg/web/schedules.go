@@ -0,0 +1,411 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/openfluke/tokentrove/pkg"
+)
+
+// SchedulesName is the file in the reports directory holding the report
+// schedules
+const SchedulesName = "schedules.json"
+
+// Schedule is a report run on a cron-like schedule. Each run is a report
+// job of its own, tagged with the schedule's name.
+type Schedule struct {
+	Name      string        `json:"name"`
+	Spec      string        `json:"schedule"`
+	Report    reportRequest `json:"report"`
+	CreatedAt time.Time     `json:"createdAt"`
+	LastRun   *time.Time    `json:"lastRun,omitempty"`
+	LastJob   string        `json:"lastJob,omitempty"`
+	NextRun   time.Time     `json:"nextRun"`
+
+	cron *cronSpec
+}
+
+// scheduleStore keeps the schedules, written back to schedules.json on
+// every change
+type scheduleStore struct {
+	mu        sync.Mutex
+	path      string
+	Schedules []*Schedule `json:"schedules"`
+
+	kick chan struct{} // wakes the scheduler after a change
+}
+
+// loadScheduleStore reads schedules.json from dir; a missing file is an
+// empty store. Runs missed while the server was down are skipped.
+func loadScheduleStore(dir string) (*scheduleStore, error) {
+	store := &scheduleStore{path: filepath.Join(dir, SchedulesName), kick: make(chan struct{}, 1)}
+	data, err := os.ReadFile(store.path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, store); err != nil {
+		return nil, fmt.Errorf("could not read %s: %w", store.path, err)
+	}
+	now := time.Now()
+	for _, s := range store.Schedules {
+		if s.cron, err = parseCron(s.Spec); err != nil {
+			return nil, fmt.Errorf("%s: schedule %q: %w", store.path, s.Name, err)
+		}
+		s.NextRun = s.cron.next(now)
+	}
+	return store, nil
+}
+
+// save writes the store; the caller holds mu
+func (s *scheduleStore) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// find returns the index of the schedule called name, or -1
+func (s *scheduleStore) find(name string) int {
+	for i, sc := range s.Schedules {
+		if sc.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// wake makes the scheduler look at the schedules again
+func (s *scheduleStore) wake() {
+	select {
+	case s.kick <- struct{}{}:
+	default:
+	}
+}
+
+// runScheduler queues the report of every schedule that is due, sleeping
+// until the next one (or a minute at most) in between
+func runScheduler(config *CacheConfig) {
+	s := config.schedules
+	for {
+		s.mu.Lock()
+		now := time.Now()
+		wait := time.Minute
+		for _, sc := range s.Schedules {
+			if !sc.NextRun.After(now) {
+				runSchedule(config, sc, now)
+			}
+			if d := sc.NextRun.Sub(now); d < wait {
+				wait = d
+			}
+		}
+		s.mu.Unlock()
+
+		timer := time.NewTimer(max(wait, time.Second))
+		select {
+		case <-timer.C:
+		case <-s.kick:
+			timer.Stop()
+		}
+	}
+}
+
+// runSchedule queues a run of sc and sets its next run; the caller holds the
+// store's mu
+func runSchedule(config *CacheConfig, sc *Schedule, now time.Time) (*ReportJob, error) {
+	sc.NextRun = sc.cron.next(now)
+	job, err := newReportJob(config, sc.Report)
+	if err == nil {
+		job.Schedule = sc.Name
+		job.Name = fmt.Sprintf("%s - %s", sc.Name, now.Format("Jan 2 15:04"))
+		err = enqueueJob(job)
+	}
+	if err != nil {
+		pkg.Logger().Warn("Scheduled report not queued", "schedule", sc.Name, "error", err)
+	} else {
+		sc.LastRun, sc.LastJob = &now, job.ID
+	}
+	if err := config.schedules.save(); err != nil {
+		pkg.Logger().Error("Could not save schedules", "error", err)
+	}
+	return job, err
+}
+
+// listSchedules returns the schedules with their next runs
+func listSchedules(c *fiber.Ctx, config *CacheConfig) error {
+	s := config.schedules
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return c.JSON(fiber.Map{"schedules": s.Schedules})
+}
+
+// saveSchedule saves {"name", "schedule", "report"}, where report takes the
+// options of POST /api/report, replacing a schedule of the same name
+func saveSchedule(c *fiber.Ctx, config *CacheConfig) error {
+	var req Schedule
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "a schedule needs a name"})
+	}
+	cron, err := parseCron(req.Spec)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if _, err := newReportJob(config, req.Report); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	s := config.schedules
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	saved := &Schedule{Name: req.Name, Spec: strings.TrimSpace(req.Spec), Report: req.Report, CreatedAt: now,
+		NextRun: cron.next(now), cron: cron}
+	if i := s.find(req.Name); i >= 0 {
+		saved.CreatedAt, saved.LastRun, saved.LastJob = s.Schedules[i].CreatedAt, s.Schedules[i].LastRun, s.Schedules[i].LastJob
+		s.Schedules[i] = saved
+	} else {
+		s.Schedules = append(s.Schedules, saved)
+	}
+	if err := s.save(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	s.wake()
+	return c.JSON(saved)
+}
+
+// deleteSchedule removes the schedule named in the path; its past runs stay
+func deleteSchedule(c *fiber.Ctx, config *CacheConfig) error {
+	name, _ := url.PathUnescape(c.Params("name"))
+	s := config.schedules
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.find(name)
+	if i < 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "not found"})
+	}
+	s.Schedules = append(s.Schedules[:i], s.Schedules[i+1:]...)
+	if err := s.save(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"deleted": name})
+}
+
+// runScheduleNow queues a run of the schedule named in the path at once; its
+// next scheduled run is counted from now
+func runScheduleNow(c *fiber.Ctx, config *CacheConfig) error {
+	name, _ := url.PathUnescape(c.Params("name"))
+	s := config.schedules
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.find(name)
+	if i < 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "not found"})
+	}
+	job, err := runSchedule(config, s.Schedules[i], time.Now())
+	if err != nil {
+		return c.Status(enqueueStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return jobJSON(c, job)
+}
+
+// listScheduleRuns returns the report jobs a schedule ran since the server
+// started, newest first
+func listScheduleRuns(c *fiber.Ctx, config *CacheConfig) error {
+	name, _ := url.PathUnescape(c.Params("name"))
+	reportJobsMu.RLock()
+	defer reportJobsMu.RUnlock()
+	jobs := []*ReportJob{}
+	for _, j := range reportJobs {
+		if j.config == config && j.Schedule == name {
+			jobs = append(jobs, j)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.After(jobs[j].CreatedAt) })
+	return c.JSON(fiber.Map{"schedule": name, "jobs": jobs})
+}
+
+// cronSpec is a parsed schedule: five cron fields, or a fixed interval
+type cronSpec struct {
+	every                         time.Duration
+	minute, hour, dom, month, dow uint64 // bit i set if value i matches
+	domAny, dowAny                bool
+}
+
+// cronMacros are the named schedules
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var (
+	monthNames = map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}
+	dayNames = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+)
+
+// parseCron reads a schedule: "minute hour day-of-month month day-of-week"
+// in server local time, with *, lists, ranges, steps and month and day
+// names ("30 2 * * mon-fri", "0 */6 * * *"); a macro like "@daily" or
+// "@weekly"; or "@every 6h", at least a minute. As in cron, a day matches
+// either day field when both are restricted.
+func parseCron(spec string) (*cronSpec, error) {
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	if rest, ok := strings.CutPrefix(spec, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+		}
+		if d < time.Minute {
+			return nil, fmt.Errorf("invalid schedule %q: runs must be at least a minute apart", spec)
+		}
+		return &cronSpec{every: d}, nil
+	}
+	if macro, ok := cronMacros[spec]; ok {
+		spec = macro
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q: want 5 fields (minute hour day month weekday), a macro like @daily or @every <duration>", spec)
+	}
+	c := &cronSpec{domAny: strings.HasPrefix(fields[2], "*"), dowAny: strings.HasPrefix(fields[4], "*")}
+	var err error
+	if c.minute, err = parseCronField(fields[0], 0, 59, nil); err == nil {
+		if c.hour, err = parseCronField(fields[1], 0, 23, nil); err == nil {
+			if c.dom, err = parseCronField(fields[2], 1, 31, nil); err == nil {
+				if c.month, err = parseCronField(fields[3], 1, 12, monthNames); err == nil {
+					c.dow, err = parseCronField(fields[4], 0, 7, dayNames)
+				}
+			}
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+	}
+	if c.dow&(1<<7) != 0 { // 7 is Sunday too
+		c.dow |= 1
+	}
+	if c.next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("schedule %q never runs", spec)
+	}
+	return c, nil
+}
+
+// parseCronField reads one comma-separated field of values lo..hi
+func parseCronField(field string, lo, hi int, names map[string]int) (uint64, error) {
+	value := func(s string) (int, error) {
+		if v, ok := names[s]; ok {
+			return v, nil
+		}
+		v, err := strconv.Atoi(s)
+		if err != nil || v < lo || v > hi {
+			return 0, fmt.Errorf("%q is not a value from %d to %d", s, lo, hi)
+		}
+		return v, nil
+	}
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepStr); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step %q", stepStr)
+			}
+		}
+		from, to := lo, hi
+		if rng != "*" {
+			first, last, isRange := strings.Cut(rng, "-")
+			var err error
+			if from, err = value(first); err != nil {
+				return 0, err
+			}
+			to = from
+			if isRange {
+				if to, err = value(last); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				to = hi
+			}
+			if to < from {
+				return 0, fmt.Errorf("invalid range %q", rng)
+			}
+		}
+		for v := from; v <= to; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// next returns the first time after t the schedule runs, or the zero time if
+// it never does within five years
+func (c *cronSpec) next(t time.Time) time.Time {
+	if c.every > 0 {
+		return t.Add(c.every)
+	}
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	end := t.AddDate(5, 0, 0)
+	for t.Before(end) {
+		if c.month&(1<<int(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.hour&(1<<t.Hour()) == 0 {
+			// The next wall-clock hour: Truncate works on absolute time, off
+			// by the half hour of zones like Asia/Kolkata
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.minute&(1<<t.Minute()) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// dayMatches reports whether t's day of the month or week matches
+func (c *cronSpec) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<t.Day()) != 0
+	dow := c.dow&(1<<int(t.Weekday())) != 0
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	}
+	return dom || dow
+}
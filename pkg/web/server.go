@@ -2,8 +2,13 @@ package web
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"math/rand"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -13,19 +18,57 @@ import (
 	"sync"
 	"time"
 
+	"github.com/RoaringBitmap/roaring/v2"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/template/html/v2"
 	"github.com/gofiber/websocket/v2"
+	"github.com/openfluke/tokentrove/pkg"
+	"github.com/openfluke/tokentrove/pkg/query"
 )
 
 type CacheConfig struct {
+	Name       string // "" for the cache of StartServer
 	CacheDir   string
 	ReportsDir string
 	InputDir   string
 	MaxN       int
 	WordCount  int
 	FileCount  int
+
+	searchMu    sync.Mutex
+	searchIndex *openIndex
+	searchErr   error
+
+	memMu  sync.RWMutex
+	memIdx *memIndex
+
+	queries     *queryStore
+	schedules   *scheduleStore
+	templates   *templateStore
+	janitorKick chan struct{} // makes the janitor run at once, as a report finishes
+}
+
+// index returns the query index of the cache, opened on first use and shared
+// by every search so its sorted vocabulary is built once. The caller calls
+// release when done with it, letting a refresh close the files of the index
+// it replaced.
+func (config *CacheConfig) index() (ix *query.Index, release func(), err error) {
+	config.searchMu.Lock()
+	defer config.searchMu.Unlock()
+	if config.searchIndex == nil && config.searchErr == nil {
+		if ix, err := query.Open(config.CacheDir); err != nil {
+			config.searchErr = err
+		} else {
+			config.searchIndex = &openIndex{ix: ix}
+		}
+	}
+	if config.searchErr != nil {
+		return nil, nil, config.searchErr
+	}
+	open := config.searchIndex
+	open.users++
+	return open.ix, func() { config.releaseIndex(open) }, nil
 }
 
 type ReportJob struct {
@@ -35,17 +78,43 @@ type ReportJob struct {
 	Description string    `json:"description"`
 	Query       string    `json:"query"`
 	ChainDepth  int       `json:"chainDepth"`
+	Overlap     int       `json:"overlap"` // words shared by linked n-grams
 	MinN        int       `json:"minN"`
 	MinFiles    int       `json:"minFiles"`
 	SkipNumeric bool      `json:"skipNumeric"`
 	TopN        int       `json:"topN"`
+	Width       int       `json:"width"`
+	Path        string    `json:"path,omitempty"`
+	Ext         string    `json:"ext,omitempty"`
+	Period      string    `json:"period,omitempty"`
+	Length      int       `json:"length,omitempty"`      // words per sample, for Markov text
+	Temperature float64   `json:"temperature,omitempty"` // for Markov text
+	Seed        int64     `json:"seed,omitempty"`        // for Markov text and topics
 	Status      string    `json:"status"`
 	Progress    int       `json:"progress"`
 	Total       int       `json:"total"`
 	Message     string    `json:"message"`
 	CreatedAt   time.Time `json:"createdAt"`
 	FilePath    string    `json:"filePath,omitempty"`
+	Size        int64     `json:"size,omitempty"`     // of the report file, in bytes
+	Schedule    string    `json:"schedule,omitempty"` // the schedule that ran it
 	Error       string    `json:"error,omitempty"`
+
+	// Position is the place of a queued job in the queue, 1 for next
+	Position int `json:"position,omitempty"`
+	Priority int `json:"priority"` // higher runs first
+
+	// SkipStopwords drops n-grams beginning or ending with a word of
+	// Stopwords: built-in languages or files, as pkg.LoadStopwords reads them
+	SkipStopwords bool   `json:"skipStopwords,omitempty"`
+	Stopwords     string `json:"stopwords,omitempty"`
+
+	files *roaring.Bitmap // the files selected by Path and Ext; nil for all
+	stop  map[string]bool // the stopwords to skip; nil for none
+
+	config *CacheConfig    // the cache it reports on
+	ctx    context.Context // cancelled by DELETE /api/report/:id
+	cancel context.CancelFunc
 }
 
 // RecurringChain represents text that repeats across files
@@ -66,18 +135,155 @@ type ChainSegment struct {
 	EndIdx   int    `json:"endIdx"`
 }
 
+// kwicReportLimit caps the lines of a concordance report
+const kwicReportLimit = 5000
+
 var (
 	reportJobs   = make(map[string]*ReportJob)
 	reportJobsMu sync.RWMutex
-	jobQueue     = make(chan *ReportJob, 100)
-	globalConfig *CacheConfig
 )
 
+// reportWorkers is the number of reports StartServer generates at once
+var reportWorkers = 2
+
+// SetReportWorkers sets how many reports are generated at once (default 2),
+// so one long report does not hold up the others
+func SetReportWorkers(n int) {
+	if n > 0 {
+		reportWorkers = n
+	}
+}
+
+// bindAddress is the interface StartServer listens on; "" for all of them
+var bindAddress string
+
+// tlsCert and tlsKey, when set, make StartServer serve HTTPS
+var tlsCert, tlsKey string
+
+// SetBindAddress sets the address StartServer listens on, like "127.0.0.1"
+// or "::1". Empty (the default) listens on every interface.
+func SetBindAddress(addr string) {
+	bindAddress = addr
+}
+
+// SetTLS makes StartServer serve HTTPS with a PEM certificate (chain) and
+// private key file. Empty paths serve plain HTTP.
+func SetTLS(certFile, keyFile string) error {
+	if (certFile == "") != (keyFile == "") {
+		return fmt.Errorf("TLS needs both a certificate and a key file")
+	}
+	tlsCert, tlsKey = certFile, keyFile
+	return nil
+}
+
+// StartServer serves the web interface for a cache, and the caches added
+// with AddCache, until it fails. maxN is the largest n-gram size to serve;
+// 0 serves every size the cache has.
 func StartServer(cacheDir, reportsDir string, maxN int, port int) error {
-	config := &CacheConfig{CacheDir: cacheDir, ReportsDir: reportsDir, MaxN: maxN}
-	globalConfig = config
-	config.WordCount = countLines(filepath.Join(cacheDir, "uniq.txt"))
-	config.FileCount = countLines(filepath.Join(cacheDir, "files.txt"))
+	config, err := openCache("", cacheDir, reportsDir, maxN)
+	if err != nil {
+		return err
+	}
+	servedCaches = []*CacheConfig{config}
+	for _, ac := range addedCaches {
+		dir := ""
+		if reportsDir != "" {
+			dir = filepath.Join(reportsDir, ac.name)
+		}
+		named, err := openCache(ac.name, ac.dir, dir, 0)
+		if err != nil {
+			return fmt.Errorf("cache %s: %w", ac.name, err)
+		}
+		servedCaches = append(servedCaches, named)
+	}
+
+	for i := 0; i < reportWorkers; i++ {
+		go reportWorker()
+	}
+	for _, config := range servedCaches {
+		go reportJanitor(config)
+		go runScheduler(config)
+		if reloadDelay > 0 {
+			go watchCache(config)
+		}
+	}
+
+	engine := html.NewFileSystem(http.FS(viewsFS), ".html")
+	engine.AddFuncMap(pageFuncs)
+	app := fiber.New(fiber.Config{AppName: "TokenTrove", Views: engine, DisableStartupMessage: true})
+	app.Use(cors.New())
+	app.Use(logRequests)
+
+	app.Get("/api/caches", listCaches)
+	for _, config := range servedCaches {
+		cacheRoutes(app, config)
+	}
+
+	if grpcPort > 0 {
+		if err := listenGRPC(); err != nil {
+			return err
+		}
+	}
+
+	addr := net.JoinHostPort(bindAddress, strconv.Itoa(port))
+	host := bindAddress
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	if tlsCert != "" {
+		pkg.Logger().Info("🔮 TokenTrove Web Interface", "url", "https://"+net.JoinHostPort(host, strconv.Itoa(port)))
+		return app.ListenTLS(addr, tlsCert, tlsKey)
+	}
+	pkg.Logger().Info("🔮 TokenTrove Web Interface", "url", "http://"+net.JoinHostPort(host, strconv.Itoa(port)))
+	return app.Listen(addr)
+}
+
+// logRequests logs every request once answered, with its status and the time
+// taken; server errors at error level
+func logRequests(c *fiber.Ctx) error {
+	start := time.Now()
+	err := c.Next()
+	status := c.Response().StatusCode()
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		status = fe.Code
+	} else if err != nil {
+		status = fiber.StatusInternalServerError
+	}
+	level := slog.LevelInfo
+	if status >= 500 {
+		level = slog.LevelError
+	}
+	pkg.Logger().Log(c.UserContext(), level, "Request", "method", c.Method(), "path", c.Path(), "status", status,
+		"duration", time.Since(start), "ip", c.IP())
+	return err
+}
+
+// openCache checks a cache and loads what the server keeps of it in memory,
+// its saved queries, its schedules and its report templates
+func openCache(name, cacheDir, reportsDir string, maxN int) (*CacheConfig, error) {
+	if err := pkg.VerifyCache(cacheDir, false, pkg.StepTokens, pkg.StepNgramFreq); err != nil {
+		return nil, err
+	}
+	cache, err := pkg.OpenCache(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	if maxN <= 0 {
+		maxN = cache.MaxN()
+	}
+	if m, err := pkg.LoadManifest(cacheDir); err == nil && m.Steps[pkg.StepNgramFreq].MaxN < maxN {
+		built := m.Steps[pkg.StepNgramFreq].MaxN
+		return nil, fmt.Errorf("cache has n-grams up to %d; use -ngrams %d or re-run: process -cache ngramfreq -ngrams %d", built, built, maxN)
+	}
+
+	config := &CacheConfig{Name: name, CacheDir: cacheDir, ReportsDir: reportsDir, MaxN: maxN, janitorKick: make(chan struct{}, 1)}
+	pkg.Logger().Info("Loading vocabulary and top n-grams", "name", name, "dir", cacheDir)
+	if err := config.refresh(); err != nil {
+		return nil, err
+	}
+	config.WordCount = len(config.wordIndex())
+	config.FileCount = len(config.fileIndex())
 
 	if data, err := os.ReadFile(filepath.Join(cacheDir, "settings.txt")); err == nil {
 		for _, line := range strings.Split(string(data), "\n") {
@@ -90,91 +296,119 @@ func StartServer(cacheDir, reportsDir string, maxN int, port int) error {
 	if reportsDir != "" {
 		os.MkdirAll(reportsDir, 0755)
 	}
+	queries, err := loadQueryStore(reportsDir)
+	if err != nil {
+		return nil, err
+	}
+	config.queries = queries
+	schedules, err := loadScheduleStore(reportsDir)
+	if err != nil {
+		return nil, err
+	}
+	config.schedules = schedules
+	templates, err := loadTemplateStore(reportsDir)
+	if err != nil {
+		return nil, err
+	}
+	config.templates = templates
+	return config, nil
+}
 
-	go reportWorker(config)
-
-	engine := html.NewFileSystem(http.FS(viewsFS), ".html")
-	app := fiber.New(fiber.Config{AppName: "TokenTrove", Views: engine})
-	app.Use(cors.New())
-
-	app.Use("/ws", func(c *fiber.Ctx) error {
+// cacheRoutes serves the pages of a cache under its base path and its API
+// under /api and the base path
+func cacheRoutes(app *fiber.App, config *CacheConfig) {
+	base := config.base()
+	app.Use(base+"/ws", func(c *fiber.Ctx) error {
 		if websocket.IsWebSocketUpgrade(c) {
 			return c.Next()
 		}
 		return fiber.ErrUpgradeRequired
 	})
-	app.Get("/ws", websocket.New(func(c *websocket.Conn) { handleWebSocket(c, config) }))
+	app.Get(base+"/ws", websocket.New(func(c *websocket.Conn) { handleWebSocket(c, config) }))
 
-	app.Get("/", func(c *fiber.Ctx) error {
+	app.Get(base+"/", func(c *fiber.Ctx) error {
+		m := config.mem()
 		return c.Render("views/index", fiber.Map{
-			"Title": "TokenTrove", "WordCount": config.WordCount,
-			"FileCount": config.FileCount, "MaxN": config.MaxN,
+			"Title": config.title(), "WordCount": len(m.words),
+			"FileCount": len(m.files), "MaxN": config.MaxN,
+			"Base": base, "Caches": cacheLinks(),
 		})
 	})
 
-	api := app.Group("/api")
+	app.Get(base+"/reports", func(c *fiber.Ctx) error { return reportsPage(c, config) })
+	app.Get(base+"/reports/:id", func(c *fiber.Ctx) error { return reportPage(c, config) })
+	app.Get(base+"/files/:idx", func(c *fiber.Ctx) error { return filePage(c, config) })
+
+	api := app.Group("/api" + base)
 	api.Get("/stats", func(c *fiber.Ctx) error { return c.JSON(getStats(config)) })
+	api.Get("/stats/zipf", func(c *fiber.Ctx) error { return getZipfStats(c, config) })
+	api.Get("/generate", func(c *fiber.Ctx) error { return generateText(c, config) })
+	api.Post("/refresh", func(c *fiber.Ctx) error { return refreshIndex(c, config) })
 	api.Get("/ngrams/:n", func(c *fiber.Ctx) error { return streamNgrams(c, config) })
 	api.Get("/search", func(c *fiber.Ctx) error { return streamSearch(c, config) })
+	api.Get("/kwic", func(c *fiber.Ctx) error { return streamKWIC(c, config) })
+	api.Post("/contains", func(c *fiber.Ctx) error { return findSentence(c, config) })
+	api.Get("/similar/:fileIdx", func(c *fiber.Ctx) error { return streamSimilar(c, config) })
+	api.Get("/files", func(c *fiber.Ctx) error { return listFiles(c, config) })
+	api.Get("/file/:idx", func(c *fiber.Ctx) error { return getFile(c, config) })
 	api.Post("/report", func(c *fiber.Ctx) error { return queueReport(c, config) })
-	api.Get("/reports", func(c *fiber.Ctx) error { return listReports(c) })
-	api.Get("/report/:id", func(c *fiber.Ctx) error { return getReportStatus(c) })
-	api.Get("/report/:id/view", func(c *fiber.Ctx) error { return viewReport(c) })
-
-	fmt.Printf("\n🔮 TokenTrove Web Interface: http://localhost:%d\n\n", port)
-	return app.Listen(fmt.Sprintf(":%d", port))
-}
-
-func countLines(path string) int {
-	file, _ := os.Open(path)
-	if file == nil {
-		return 0
-	}
-	defer file.Close()
-	count := 0
-	scanner := bufio.NewScanner(file)
-	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
-	for scanner.Scan() {
-		count++
-	}
-	return count
+	api.Get("/queries", func(c *fiber.Ctx) error { return listQueries(c, config) })
+	api.Post("/queries", func(c *fiber.Ctx) error { return saveQuery(c, config) })
+	api.Delete("/queries/:name", func(c *fiber.Ctx) error { return deleteQuery(c, config) })
+	api.Get("/queries/:name/run", func(c *fiber.Ctx) error { return runSavedQuery(c, config) })
+	api.Post("/queries/:name/report", func(c *fiber.Ctx) error { return reportSavedQuery(c, config) })
+	api.Get("/schedules", func(c *fiber.Ctx) error { return listSchedules(c, config) })
+	api.Post("/schedules", func(c *fiber.Ctx) error { return saveSchedule(c, config) })
+	api.Delete("/schedules/:name", func(c *fiber.Ctx) error { return deleteSchedule(c, config) })
+	api.Post("/schedules/:name/run", func(c *fiber.Ctx) error { return runScheduleNow(c, config) })
+	api.Get("/schedules/:name/runs", func(c *fiber.Ctx) error { return listScheduleRuns(c, config) })
+	api.Get("/report-templates", func(c *fiber.Ctx) error { return listTemplates(c, config) })
+	api.Post("/report-templates", func(c *fiber.Ctx) error { return saveTemplate(c, config) })
+	api.Delete("/report-templates/:name", func(c *fiber.Ctx) error { return deleteTemplate(c, config) })
+	api.Post("/report-templates/:name/report", func(c *fiber.Ctx) error { return reportTemplate(c, config) })
+	api.Get("/queue", func(c *fiber.Ctx) error { return getQueue(c, config) })
+	api.Post("/queue/:id", func(c *fiber.Ctx) error { return moveQueued(c, config) })
+	api.Delete("/queue", func(c *fiber.Ctx) error { return dropQueued(c, config) })
+	api.Delete("/queue/:id", func(c *fiber.Ctx) error { return dropQueued(c, config) })
+	api.Get("/reports", func(c *fiber.Ctx) error { return listReports(c, config) })
+	api.Get("/report/:id", func(c *fiber.Ctx) error { return getReportStatus(c, config) })
+	api.Delete("/report/:id", func(c *fiber.Ctx) error { return deleteReport(c, config) })
+	api.Get("/report/:id/view", func(c *fiber.Ctx) error { return viewReport(c, config) })
+	api.Get("/report/:id/download", func(c *fiber.Ctx) error { return downloadReport(c, config) })
+	api.Get("/report/:id/graph", func(c *fiber.Ctx) error { return reportGraph(c, config) })
 }
 
 func getStats(config *CacheConfig) fiber.Map {
+	m := config.mem()
 	ngramCounts := make(map[string]int)
 	for n := 2; n <= config.MaxN; n++ {
-		ngramCounts[fmt.Sprintf("%dgram", n)] = countLines(filepath.Join(config.CacheDir, fmt.Sprintf("%dgramfreq.txt", n)))
+		ngramCounts[fmt.Sprintf("%dgram", n)] = m.counts[n]
+	}
+	stats := fiber.Map{"type": "stats", "wordCount": len(m.words), "fileCount": len(m.files), "maxN": config.MaxN, "ngramCounts": ngramCounts,
+		"loadedAt": m.loadedAt}
+	reportJobsMu.RLock()
+	stats["queue"] = queueStats()
+	reportJobsMu.RUnlock()
+	if corpus, err := pkg.LoadCorpusStats(config.CacheDir); err == nil {
+		stats["corpus"] = corpus
 	}
-	return fiber.Map{"type": "stats", "wordCount": config.WordCount, "fileCount": config.FileCount, "maxN": config.MaxN, "ngramCounts": ngramCounts}
+	return stats
 }
 
-func loadWordIndex(cacheDir string) map[int]string {
-	index := make(map[int]string)
-	file, _ := os.Open(filepath.Join(cacheDir, "uniq.txt"))
-	if file == nil {
-		return index
-	}
-	defer file.Close()
-	scanner := bufio.NewScanner(file)
-	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
-	for idx := 0; scanner.Scan(); idx++ {
-		index[idx] = scanner.Text()
-	}
-	return index
+// zipfReport is the result of a Zipf report and of /api/stats/zipf
+type zipfReport struct {
+	Type string `json:"type"`
+	*pkg.ZipfStats
 }
 
-func loadFileIndex(cacheDir string) []string {
-	var files []string
-	file, _ := os.Open(filepath.Join(cacheDir, "files.txt"))
-	if file == nil {
-		return files
-	}
-	defer file.Close()
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		files = append(files, scanner.Text())
+// getZipfStats returns the rank-frequency, vocabulary growth and n-gram
+// count distribution of the cache for charting, as the Zipf report does
+func getZipfStats(c *fiber.Ctx, config *CacheConfig) error {
+	stats, err := pkg.ZipfStatistics(config.CacheDir, config.MaxN, nil)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
-	return files
+	return c.JSON(zipfReport{Type: "zipf", ZipfStats: stats})
 }
 
 // NgramWithFiles stores n-gram data including which files contain it
@@ -182,39 +416,117 @@ type NgramWithFiles struct {
 	indices []int
 	words   []string
 	count   int
-	files   map[int]bool // file indices
+	files   *roaring.Bitmap // file indices
+}
+
+// fileCount is the number of files holding the n-gram, within the filter of
+// loadScopedNgrams; 0 without file information
+func (ng NgramWithFiles) fileCount() int {
+	if ng.files == nil {
+		return 0
+	}
+	return int(ng.files.GetCardinality())
+}
+
+// countFields sets "count" in m, the occurrences of the n-gram, and with file
+// information "files", the number of (selected) files holding it
+func (ng NgramWithFiles) countFields(m map[string]interface{}) {
+	m["count"] = ng.count
+	if ng.files != nil {
+		m["files"] = ng.fileCount()
+	}
 }
 
-// Load n-grams with file information from uniqNgram.txt + Ngramindex.txt files
+// Load n-grams with file information from uniqNgram.txt + Ngramindex.txt files.
+// The shards of a sharded index are read concurrently, each contributing an
+// even share of limit.
 func loadNgramsWithFiles(cacheDir string, n int, wordIndex map[int]string, limit int) []NgramWithFiles {
+	parts := pkg.NgramIndexParts(cacheDir, n)
+	if len(parts) == 0 {
+		// Fall back to freq file (no file info)
+		return loadNgramsFreqOnly(cacheDir, n, wordIndex, limit)
+	}
+
+	partLimit := limit
+	if limit > 0 {
+		partLimit = (limit + len(parts) - 1) / len(parts)
+	}
+	loaded := make([][]NgramWithFiles, len(parts))
+	errs := make([]error, len(parts))
+	var wg sync.WaitGroup
+	for i, part := range parts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			loaded[i], errs[i] = loadNgramIndexPart(part, wordIndex, partLimit)
+		}()
+	}
+	wg.Wait()
+
 	var result []NgramWithFiles
+	for i := range parts {
+		if errs[i] != nil {
+			return loadNgramsFreqOnly(cacheDir, n, wordIndex, limit)
+		}
+		result = append(result, loaded[i]...)
+	}
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
 
-	// Load n-gram definitions from uniqNgram.txt
-	uniqPath := filepath.Join(cacheDir, fmt.Sprintf("uniq%dgram.txt", n))
-	indexPath := filepath.Join(cacheDir, fmt.Sprintf("%dgramindex.txt", n))
+// loadNgramIndexPart reads one unsharded index or shard
+func loadNgramIndexPart(part pkg.NgramIndexPart, wordIndex map[int]string, limit int) ([]NgramWithFiles, error) {
+	var result []NgramWithFiles
 
-	uniqFile, err := os.Open(uniqPath)
+	uniqFile, err := pkg.OpenCacheFile(part.Uniq)
 	if err != nil {
-		// Fall back to freq file (no file info)
-		return loadNgramsFreqOnly(cacheDir, n, wordIndex, limit)
+		return nil, err
 	}
 	defer uniqFile.Close()
 
-	indexFile, err := os.Open(indexPath)
-	if err != nil {
-		return loadNgramsFreqOnly(cacheDir, n, wordIndex, limit)
+	// Prefer the binary posting file; older caches only have the text index
+	var nextFiles func() (*roaring.Bitmap, bool)
+	if postings, err := pkg.OpenPostings(pkg.PostingsPath(part.Index)); err == nil {
+		defer postings.Close()
+		i := 0
+		nextFiles = func() (*roaring.Bitmap, bool) {
+			if i >= postings.Len() {
+				return nil, false
+			}
+			files, err := postings.Get(i)
+			i++
+			return files, err == nil
+		}
+	} else {
+		indexFile, err := pkg.OpenCacheFile(part.Index)
+		if err != nil {
+			return nil, err
+		}
+		defer indexFile.Close()
+
+		indexScanner := bufio.NewScanner(indexFile)
+		indexScanner.Buffer(make([]byte, 4*1024*1024), 4*1024*1024)
+		nextFiles = func() (*roaring.Bitmap, bool) {
+			if !indexScanner.Scan() {
+				return nil, false
+			}
+			_, files, err := pkg.ParseIndexLine(indexScanner.Text()) // Format: ngramIdx,[fileIdx1,fileIdx2,...]
+			return files, err == nil
+		}
 	}
-	defer indexFile.Close()
 
 	uniqScanner := bufio.NewScanner(uniqFile)
 	uniqScanner.Buffer(make([]byte, 4*1024*1024), 4*1024*1024)
-	indexScanner := bufio.NewScanner(indexFile)
-	indexScanner.Buffer(make([]byte, 4*1024*1024), 4*1024*1024)
 
 	// Read both files in parallel - they have same line count
-	for uniqScanner.Scan() && indexScanner.Scan() && (limit <= 0 || len(result) < limit) {
-		ngramLine := uniqScanner.Text()  // Format: wordIdx1|wordIdx2|...
-		filesLine := indexScanner.Text() // Format: fileIdx1,fileIdx2,...
+	for uniqScanner.Scan() && (limit <= 0 || len(result) < limit) {
+		ngramLine := uniqScanner.Text() // Format: wordIdx1|wordIdx2|...
+		files, ok := nextFiles()
+		if !ok {
+			break
+		}
 
 		var indices []int
 		var words []string
@@ -226,103 +538,173 @@ func loadNgramsWithFiles(cacheDir string, n int, wordIndex map[int]string, limit
 			}
 		}
 
-		files := make(map[int]bool)
-		for _, fIdxStr := range strings.Split(filesLine, ",") {
-			if fIdxStr != "" {
-				fIdx, _ := strconv.Atoi(fIdxStr)
-				files[fIdx] = true
-			}
-		}
-
 		result = append(result, NgramWithFiles{
 			indices: indices,
 			words:   words,
-			count:   len(files),
+			count:   int(files.GetCardinality()),
 			files:   files,
 		})
 	}
-	return result
+	return result, nil
 }
 
 func loadNgramsFreqOnly(cacheDir string, n int, wordIndex map[int]string, limit int) []NgramWithFiles {
 	var result []NgramWithFiles
-	path := filepath.Join(cacheDir, fmt.Sprintf("%dgramfreq.txt", n))
-	file, _ := os.Open(path)
-	if file == nil {
+	it, err := pkg.OpenNgramIterator(cacheDir, n)
+	if err != nil {
 		return result
 	}
-	defer file.Close()
+	defer it.Close()
+	for (limit <= 0 || len(result) < limit) && it.Next() {
+		result = append(result, freqNgram(it.Ngram(), wordIndex))
+	}
+	return result
+}
+
+// freqNgram turns an n-gram of a frequency file into an NgramWithFiles
+// without files, its words looked up in wordIndex
+func freqNgram(ng pkg.Ngram, wordIndex map[int]string) NgramWithFiles {
+	words := make([]string, 0, len(ng.IDs))
+	for _, idx := range ng.IDs {
+		if w, ok := wordIndex[idx]; ok {
+			words = append(words, w)
+		}
+	}
+	return NgramWithFiles{indices: ng.IDs, words: words, count: ng.Count}
+}
 
-	scanner := bufio.NewScanner(file)
-	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+// fileFilter returns the files whose path matches pathGlob and whose source
+// document has one of the extensions exts, or nil for every file when both
+// are empty
+func fileFilter(config *CacheConfig, pathGlob, exts string) (*roaring.Bitmap, error) {
+	if pathGlob == "" && exts == "" {
+		return nil, nil
+	}
+	return pkg.FilterFiles(config.CacheDir, pathGlob, exts)
+}
 
-	for scanner.Scan() && (limit <= 0 || len(result) < limit) {
-		line := scanner.Text()
-		commaIdx := strings.LastIndex(line, ",")
-		if commaIdx == -1 {
+// loadScopedNgrams loads n-grams with load, or with a filter, the n-grams of
+// the filtered files: each keeps the files in filter, and the limit in most
+// of them (0 = all) are returned. count stays the occurrences in the whole
+// corpus; fileCount is the number of filtered files. Filtering reads the file
+// sets of the n-gram index, so without -cache ngrams nothing matches.
+func loadScopedNgrams(cacheDir string, n int, wordIndex map[int]string, limit int, filter *roaring.Bitmap,
+	load func(string, int, map[int]string, int) []NgramWithFiles) []NgramWithFiles {
+	if filter == nil {
+		return load(cacheDir, n, wordIndex, limit)
+	}
+	var result []NgramWithFiles
+	for _, ng := range withOccurrences(cacheDir, n, loadNgramsWithFiles(cacheDir, n, wordIndex, 0)) {
+		if ng.files == nil {
 			continue
 		}
-		ngramStr := line[:commaIdx]
-		count, _ := strconv.Atoi(line[commaIdx+1:])
+		if ng.files = roaring.And(ng.files, filter); !ng.files.IsEmpty() {
+			result = append(result, ng)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].fileCount() > result[j].fileCount() })
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
 
-		var indices []int
-		var words []string
-		for _, idxStr := range strings.Split(ngramStr, "|") {
-			idx, _ := strconv.Atoi(idxStr)
-			indices = append(indices, idx)
-			if w, ok := wordIndex[idx]; ok {
-				words = append(words, w)
-			}
+// withOccurrences sets the count of n-grams read from the n-gram index, which
+// counts files, to their occurrences in {n}gramfreq.txt. The index holds
+// every n-gram, so those below the -min-count of the ngramfreq step are
+// dropped, leaving the n-grams every other order lists.
+func withOccurrences(cacheDir string, n int, ngrams []NgramWithFiles) []NgramWithFiles {
+	it, err := pkg.OpenNgramIterator(cacheDir, n)
+	if err != nil {
+		return nil
+	}
+	defer it.Close()
+	occurrences := make(map[string]int)
+	for it.Next() {
+		occurrences[idsKey(it.Ngram().IDs)] = it.Ngram().Count
+	}
+	var result []NgramWithFiles
+	for _, ng := range ngrams {
+		if count, ok := occurrences[idsKey(ng.indices)]; ok {
+			ng.count = count
+			result = append(result, ng)
 		}
-		result = append(result, NgramWithFiles{indices: indices, words: words, count: count, files: nil})
 	}
 	return result
 }
 
+// idsKey is the "w1|w2|..." key of an n-gram's word indices
+func idsKey(ids []int) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.Itoa(id)
+	}
+	return strings.Join(parts, "|")
+}
+
 func streamNgrams(c *fiber.Ctx, config *CacheConfig) error {
 	n, _ := strconv.Atoi(c.Params("n"))
 	limit, _ := strconv.Atoi(c.Query("limit", "50"))
 	offset, _ := strconv.Atoi(c.Query("offset", "0"))
-
-	wordIndex := loadWordIndex(config.CacheDir)
-	ngrams := loadNgramsFreqOnly(config.CacheDir, n, wordIndex, 0)
-
-	total := len(ngrams)
-	end := offset + limit
-	if end > total {
-		end = total
+	filter, err := fileFilter(config, c.Query("path"), c.Query("ext"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
-
-	var result []fiber.Map
-	if offset < total {
-		for _, ng := range ngrams[offset:end] {
-			result = append(result, fiber.Map{"ngram": strings.Join(ng.words, "|"), "count": ng.count, "words": ng.words})
-		}
+	stop, err := stopwordSet(c.Query("stopwords"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
-
-	return c.JSON(fiber.Map{"type": "ngrams", "n": n, "total": total, "offset": offset, "ngrams": result})
+	opts := ngramOptions{Sort: c.Query("sort"), MinCount: c.QueryInt("min_count"), Contains: c.Query("contains")}
+	response, err := streamNgramsWS(config, n, limit, offset, filter, stop, opts)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(response)
 }
 
 func streamSearch(c *fiber.Ctx, config *CacheConfig) error {
-	query := strings.ToLower(c.Query("q"))
-	wordIndex := loadWordIndex(config.CacheDir)
-
-	var wordMatches []fiber.Map
-	for idx, word := range wordIndex {
-		if strings.Contains(strings.ToLower(word), query) {
-			wordMatches = append(wordMatches, fiber.Map{"index": idx, "word": word})
-			if len(wordMatches) >= 20 {
-				break
-			}
-		}
+	filter, err := fileFilter(config, c.Query("path"), c.Query("ext"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	stop, err := stopwordSet(c.Query("stopwords"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	limit, _ := strconv.Atoi(c.Query("limit", "20"))
+	offset, _ := strconv.Atoi(c.Query("offset", "0"))
+	normalize := c.QueryBool("normalize")
+	config.queries.record(c.Query("q"), c.Query("path"), c.Query("ext"))
+	return c.JSON(runSearch(config, c.Query("q"), filter, stop, normalize, limit, offset))
+}
+
+// stopwordSet loads the stopwords of spec ("en", "en,de" or a file), or
+// returns nil for an empty spec
+func stopwordSet(spec string) (map[string]bool, error) {
+	if spec == "" {
+		return nil, nil
 	}
+	return pkg.LoadStopwords(spec)
+}
+
+// runSearch answers a search: words matching q, the most frequent n-grams
+// containing it and the page of files matching it as a query. With stop,
+// n-grams beginning or ending with a stopword are skipped and the query's
+// stopwords are left out of the file search. With normalize, the file search
+// matches every spelling of the query's words that normalizes alike.
+func runSearch(config *CacheConfig, q string, filter *roaring.Bitmap, stop map[string]bool, normalize bool, limit, offset int) fiber.Map {
+	wordMatches := searchWords(config, q, 20)
+	wordIndex := config.wordIndex()
+	lower := strings.ToLower(q)
 
 	ngramMatches := make(map[int][]fiber.Map)
 	for n := 2; n <= config.MaxN; n++ {
-		ngrams := loadNgramsFreqOnly(config.CacheDir, n, wordIndex, 500)
+		ngrams := loadScopedNgrams(config.CacheDir, n, wordIndex, 500, filter, config.loadFreqNgrams)
 		for _, ng := range ngrams {
-			if strings.Contains(strings.ToLower(strings.Join(ng.words, " ")), query) {
-				ngramMatches[n] = append(ngramMatches[n], fiber.Map{"words": ng.words, "count": ng.count})
+			if strings.Contains(strings.ToLower(strings.Join(ng.words, " ")), lower) && !hasStopwordEdge(ng.words, stop) {
+				match := fiber.Map{"words": ng.words}
+				ng.countFields(match)
+				ngramMatches[n] = append(ngramMatches[n], match)
 				if len(ngramMatches[n]) >= 10 {
 					break
 				}
@@ -330,205 +712,1243 @@ func streamSearch(c *fiber.Ctx, config *CacheConfig) error {
 		}
 	}
 
-	return c.JSON(fiber.Map{"type": "search", "words": wordMatches, "ngrams": ngramMatches})
-}
-
-func queueReport(c *fiber.Ctx, config *CacheConfig) error {
-	var req struct {
-		Type        string `json:"type"`
-		Query       string `json:"query"`
-		ChainDepth  int    `json:"chainDepth"`
-		MinN        int    `json:"minN"`
-		MinFiles    int    `json:"minFiles"`
-		SkipNumeric bool   `json:"skipNumeric"`
-		TopN        int    `json:"topN"`
+	var documents fiber.Map
+	if q, err := rewriteQuery(config, q, stop, normalize); err != nil {
+		documents = fiber.Map{"error": err.Error()}
+	} else {
+		documents = searchDocuments(config, q, limit, offset, filter)
 	}
-	c.BodyParser(&req)
 
-	now := time.Now()
-	name := fmt.Sprintf("%s - %s", strings.Title(strings.ReplaceAll(req.Type, "_", " ")), now.Format("Jan 2 15:04"))
-	desc := ""
+	return fiber.Map{"type": "search", "words": wordMatches, "ngrams": ngramMatches, "documents": documents}
+}
 
-	switch req.Type {
-	case "top_ngrams":
-		desc = "Top 100 most frequent n-grams for each size"
-	case "search":
-		desc = fmt.Sprintf("Search results for '%s'", req.Query)
-	case "recurring_text":
-		if req.MinN == 0 {
-			req.MinN = 5
+// rewriteQuery leaves the stopwords out of q and, with normalize, expands
+// its words to their variants. A query that does not parse is returned as is
+// for the search to report.
+func rewriteQuery(config *CacheConfig, q string, stop map[string]bool, normalize bool) (string, error) {
+	node, err := query.Parse(q)
+	if err != nil || (stop == nil && !normalize) {
+		return q, nil
+	}
+	if stop != nil {
+		node = query.WithoutStopwords(node, func(w string) bool { return stop[w] })
+	}
+	if normalize {
+		ix, release, err := config.index()
+		if err != nil {
+			return "", err
 		}
-		if req.MinFiles == 0 {
-			req.MinFiles = 2
+		defer release()
+		if node, err = ix.Normalize(node); err != nil {
+			return "", err
 		}
-		desc = fmt.Sprintf("Find text (min %d-grams) appearing in %d+ files", req.MinN, req.MinFiles)
-	case "linked_ngrams":
-		if req.MinN == 0 {
-			req.MinN = 5
+	}
+	return node.String(), nil
+}
+
+// searchWords returns up to limit words matching q: a wildcard pattern like
+// "transa*" or "*ization", or else every word starting with q
+func searchWords(config *CacheConfig, q string, limit int) []fiber.Map {
+	ix, release, err := config.index()
+	if err != nil {
+		return nil
+	}
+	defer release()
+	if q == "" {
+		return nil
+	}
+	if !strings.Contains(q, "*") {
+		q += "*"
+	}
+	var matches []fiber.Map
+	for _, idx := range ix.MatchWords(q) {
+		matches = append(matches, fiber.Map{"index": idx, "word": ix.Word(idx)})
+		if len(matches) >= limit {
+			break
 		}
-		desc = fmt.Sprintf("N-grams with most chain connections (min %d-grams)", req.MinN)
-	case "best_chains":
-		if req.MinN == 0 {
-			req.MinN = 3
+	}
+	return matches
+}
+
+// searchDocuments runs q as a boolean query and returns the page of matching
+// files from offset, ranked by BM25, with a snippet of each and its first
+// match marked. A filter keeps only its files.
+func searchDocuments(config *CacheConfig, q string, limit, offset int, filter *roaring.Bitmap) fiber.Map {
+	ix, release, err := config.index()
+	if err != nil {
+		return fiber.Map{"error": err.Error()}
+	}
+	defer release()
+	results, err := ix.SearchBM25(q)
+	if err != nil {
+		return fiber.Map{"error": err.Error()}
+	}
+	if filter != nil {
+		kept := results[:0]
+		for _, r := range results {
+			if filter.Contains(uint32(r.Index)) {
+				kept = append(kept, r)
+			}
 		}
-		desc = "Longest recurring chains sorted by (files × length)"
+		results = kept
 	}
 
-	job := &ReportJob{
-		ID:          fmt.Sprintf("%d", now.UnixNano()),
-		Type:        req.Type,
-		Name:        name,
-		Description: desc,
-		Query:       req.Query,
-		ChainDepth:  req.ChainDepth,
-		MinN:        req.MinN,
-		MinFiles:    req.MinFiles,
-		SkipNumeric: req.SkipNumeric,
-		TopN:        req.TopN,
-		Status:      "queued",
-		CreatedAt:   now,
+	offset = max(0, offset)
+	if limit <= 0 {
+		limit = 20
+	}
+	end := min(len(results), offset+limit)
+	docs := []fiber.Map{}
+	for i := offset; i < end; i++ {
+		r := results[i]
+		doc := fiber.Map{"file": r.File, "index": r.Index, "score": r.Score, "hits": r.Hits}
+		addExcerpt(doc, ix, r.Index, q)
+		docs = append(docs, doc)
 	}
+	return fiber.Map{"total": len(results), "offset": offset, "limit": limit, "results": docs}
+}
 
-	reportJobsMu.Lock()
-	reportJobs[job.ID] = job
-	reportJobsMu.Unlock()
+// snippetWidth is the number of words in a search result's snippet
+const snippetWidth = 30
+
+// addExcerpt sets the "snippet" of a file in a search response to the words
+// around the first match of q, and "highlight" to the same words split into
+// "before", "match" and "after" with the match's word "offset". Both are left
+// out when the file's words can't be read.
+func addExcerpt(result fiber.Map, ix *query.Index, fileIdx int, q string) {
+	e, _ := ix.Excerpt(fileIdx, q, snippetWidth)
+	if e == nil {
+		return
+	}
+	result["snippet"] = e.String()
+	result["highlight"] = fiber.Map{"before": e.Before, "match": e.Match, "after": e.After, "offset": e.Offset}
+}
 
-	select {
-	case jobQueue <- job:
-	default:
-		job.Status = "error"
-		job.Error = "queue full"
+// streamKWIC lists the occurrences of a word or phrase with the words around
+// them: /api/kwic?q=...&width=5&limit=100
+func streamKWIC(c *fiber.Ctx, config *CacheConfig) error {
+	width, _ := strconv.Atoi(c.Query("width", "5"))
+	limit, _ := strconv.Atoi(c.Query("limit", "100"))
+	if limit <= 0 {
+		limit = 100
+	}
+	lines, err := concordance(config, c.Query("q"), width, limit)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"type": "kwic", "query": c.Query("q"), "width": width, "lines": lines})
+}
+
+// concordance returns up to limit occurrences of phrase, width words of
+// context either side
+func concordance(config *CacheConfig, phrase string, width, limit int) ([]fiber.Map, error) {
+	ix, release, err := config.index()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	lines, err := ix.Concordance(phrase, max(0, width), limit)
+	if err != nil {
+		return nil, err
+	}
+	result := []fiber.Map{}
+	for _, l := range lines {
+		result = append(result, fiber.Map{"file": l.File, "index": l.Index, "offset": l.Offset, "left": l.Left, "match": l.Match, "right": l.Right})
+	}
+	return result, nil
+}
+
+// findSentence answers which files contain a sentence word for word. The
+// body is {"text": ..., "limit": 100, "offset": 0}.
+func findSentence(c *fiber.Ctx, config *CacheConfig) error {
+	var req struct {
+		Text   string `json:"text"`
+		Limit  int    `json:"limit"`
+		Offset int    `json:"offset"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	ix, release, err := config.index()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer release()
+	found, err := ix.Contains(req.Text)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	offset := max(0, req.Offset)
+	limit := req.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	end := min(len(found.Results), offset+limit)
+	files := []fiber.Map{}
+	for i := offset; i < end; i++ {
+		r := found.Results[i]
+		file := fiber.Map{"file": r.File, "index": r.Index, "hits": r.Hits}
+		addExcerpt(file, ix, r.Index, strconv.Quote(strings.Join(found.Words, " ")))
+		files = append(files, file)
+	}
+	return c.JSON(fiber.Map{
+		"words": found.Words, "missing": found.Missing, "exact": found.Exact,
+		"total": len(found.Results), "offset": offset, "limit": limit, "files": files,
+	})
+}
+
+// streamSimilar ranks the files sharing the most n-grams with a file:
+// /api/similar/:fileIdx?n=3&limit=20
+func streamSimilar(c *fiber.Ctx, config *CacheConfig) error {
+	fileIdx, err := strconv.Atoi(c.Params("fileIdx"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid file index"})
+	}
+	n, _ := strconv.Atoi(c.Query("n", strconv.Itoa(min(3, config.MaxN))))
+	limit, _ := strconv.Atoi(c.Query("limit", "20"))
+	if limit <= 0 {
+		limit = 20
+	}
+	files, err := similarFiles(config, fileIdx, n, limit)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"type": "similar", "index": fileIdx, "n": n, "files": files})
+}
+
+// similarFiles returns the limit files most similar to fileIdx by the Jaccard
+// similarity of their n-grams
+func similarFiles(config *CacheConfig, fileIdx, n, limit int) ([]fiber.Map, error) {
+	similar, err := pkg.SimilarFiles(config.CacheDir, fileIdx, n, limit)
+	if err != nil {
+		return nil, err
+	}
+	fileNames := config.fileIndex()
+	result := []fiber.Map{}
+	for _, s := range similar {
+		name := ""
+		if s.Index < len(fileNames) {
+			name = fileNames[s.Index]
+		}
+		result = append(result, fiber.Map{"file": name, "index": s.Index, "shared": s.Shared, "jaccard": s.Jaccard})
+	}
+	return result, nil
+}
+
+// reportRequest is the body of POST /api/report
+type reportRequest struct {
+	Type        string `json:"type"`
+	Query       string `json:"query"`
+	ChainDepth  int    `json:"chainDepth"`
+	Overlap     int    `json:"overlap"`
+	MinN        int    `json:"minN"`
+	MinFiles    int    `json:"minFiles"`
+	SkipNumeric bool   `json:"skipNumeric"`
+	TopN        int    `json:"topN"`
+	Width       int    `json:"width"`
+	Path        string `json:"path"`
+	Ext         string `json:"ext"`
+	Period      string `json:"period"`   // "month" or "year", for timelines
+	Priority    int    `json:"priority"` // queued before reports of lower priority
+
+	// Markov text: words per sample, the sharpness of the choice of each
+	// word, and the seed of the random walk (0 for a random one). Topics
+	// take a seed too, for their first centroids.
+	Length      int     `json:"length"`
+	Temperature float64 `json:"temperature"`
+	Seed        int64   `json:"seed"`
+
+	SkipStopwords bool   `json:"skipStopwords"`
+	Stopwords     string `json:"stopwords"` // default "en"
+}
+
+func queueReport(c *fiber.Ctx, config *CacheConfig) error {
+	var req reportRequest
+	c.BodyParser(&req)
+	job, err := enqueueReport(config, req)
+	if err != nil {
+		return c.Status(enqueueStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return jobJSON(c, job)
+}
+
+// enqueueStatus is the HTTP status of an error queueing a report
+func enqueueStatus(err error) int {
+	if errors.Is(err, errQueueFull) {
+		return 503
+	}
+	return 400
+}
+
+// enqueueReport fills in the defaults of a report request and queues it
+func enqueueReport(config *CacheConfig, req reportRequest) (*ReportJob, error) {
+	job, err := newReportJob(config, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := enqueueJob(job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// newReportJob checks a report request and makes its job, with the defaults
+// filled in
+func newReportJob(config *CacheConfig, req reportRequest) (*ReportJob, error) {
+	files, err := fileFilter(config, req.Path, req.Ext)
+	if err != nil {
+		return nil, err
+	}
+	var stop map[string]bool
+	if req.SkipStopwords {
+		if req.Stopwords == "" {
+			req.Stopwords = "en"
+		}
+		if stop, err = pkg.LoadStopwords(req.Stopwords); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	name := fmt.Sprintf("%s - %s", strings.Title(strings.ReplaceAll(req.Type, "_", " ")), now.Format("Jan 2 15:04"))
+	desc := ""
+
+	switch req.Type {
+	case "top_ngrams":
+		desc = "Top 100 most frequent n-grams for each size"
+	case "search":
+		desc = fmt.Sprintf("Search results for '%s'", req.Query)
+	case "recurring_text":
+		if req.MinN == 0 {
+			req.MinN = 5
+		}
+		if req.MinFiles == 0 {
+			req.MinFiles = 2
+		}
+		desc = fmt.Sprintf("Find text (min %d-grams) appearing in %d+ files", req.MinN, req.MinFiles)
+	case "linked_ngrams":
+		if req.MinN == 0 {
+			req.MinN = 5
+		}
+		if req.ChainDepth == 0 {
+			req.ChainDepth = linkedChainDepth
+		}
+		desc = fmt.Sprintf("Chains of %d n-grams with most files in common (min %d-grams)", req.ChainDepth, req.MinN)
+	case "best_chains":
+		if req.MinN == 0 {
+			req.MinN = 3
+		}
+		if req.ChainDepth == 0 {
+			req.ChainDepth = bestChainDepth
+		}
+		desc = fmt.Sprintf("Longest recurring chains of up to %d n-grams sorted by (files × length)", req.ChainDepth)
+	case "kwic":
+		if req.Width <= 0 {
+			req.Width = 5
+		}
+		desc = fmt.Sprintf("'%s' in context, %d words either side", req.Query, req.Width)
+	case "similar":
+		if req.MinN == 0 {
+			req.MinN = min(3, config.MaxN)
+		}
+		desc = fmt.Sprintf("Files most similar to '%s' by shared %d-grams", req.Query, req.MinN)
+	case "collocations":
+		if req.TopN <= 0 {
+			req.TopN = 100
+		}
+		desc = fmt.Sprintf("Top %d 2- and 3-grams by log-likelihood, with PMI", req.TopN)
+	case "boilerplate":
+		if req.MinN == 0 {
+			req.MinN = min(5, config.MaxN)
+		}
+		if req.MinFiles <= 0 {
+			req.MinFiles = 2
+		}
+		if req.TopN <= 0 {
+			req.TopN = 100
+		}
+		desc = fmt.Sprintf("Files most covered by %d-grams found in %d+ other files", req.MinN, req.MinFiles)
+	case "outliers":
+		if req.TopN <= 0 {
+			req.TopN = 100
+		}
+		desc = fmt.Sprintf("Top %d files whose vocabulary diverges most from the corpus", req.TopN)
+	case "zipf":
+		desc = "Rank-frequency and vocabulary growth with Zipf and Heaps fits, n-gram counts per n"
+	case "markov":
+		if req.MinN == 0 {
+			req.MinN = min(3, config.MaxN)
+		}
+		if req.MinN < 2 || req.MinN > config.MaxN {
+			return nil, fmt.Errorf("minN %d out of range (2 to %d)", req.MinN, config.MaxN)
+		}
+		if req.TopN <= 0 {
+			req.TopN = 5
+		}
+		if req.Length <= 0 {
+			req.Length = markovLength
+		}
+		if req.Length > maxMarkovLength {
+			return nil, fmt.Errorf("length %d out of range (1 to %d words)", req.Length, maxMarkovLength)
+		}
+		if req.Temperature == 0 {
+			req.Temperature = 1
+		} else if req.Temperature < 0 {
+			return nil, fmt.Errorf("temperature %g must be positive", req.Temperature)
+		}
+		if req.Seed == 0 {
+			req.Seed = now.UnixNano()
+		}
+		desc = fmt.Sprintf("%d samples of %d words from the %d-grams at temperature %g", req.TopN, req.Length, req.MinN, req.Temperature)
+	case "pii":
+		if req.TopN <= 0 {
+			req.TopN = 500
+		}
+		desc = fmt.Sprintf("Top %d files by emails, phone numbers, SSNs, card numbers and IBANs found", req.TopN)
+	case "topics":
+		if req.TopN <= 0 {
+			req.TopN = 10
+		}
+		if req.TopN > maxTopics {
+			return nil, fmt.Errorf("topN %d out of range (1 to %d clusters)", req.TopN, maxTopics)
+		}
+		if req.MinFiles <= 0 {
+			req.MinFiles = 2
+		}
+		if req.Seed == 0 {
+			req.Seed = now.UnixNano()
+		}
+		desc = fmt.Sprintf("%d topic clusters of files by TF-IDF over words in %d+ files", req.TopN, req.MinFiles)
+	case "timeline":
+		switch req.Period {
+		case "":
+			req.Period = "month"
+		case "month", "year":
+		default:
+			return nil, fmt.Errorf("unknown period %q (use month or year)", req.Period)
+		}
+		if req.Query != "" {
+			desc = fmt.Sprintf("Files matching '%s' by %s", req.Query, req.Period)
+			break
+		}
+		if req.MinN == 0 {
+			req.MinN = min(2, config.MaxN)
+		}
+		if req.TopN <= 0 {
+			req.TopN = 10
+		}
+		desc = fmt.Sprintf("Top %d %d-grams by %s", req.TopN, req.MinN, req.Period)
+	default:
+		return nil, fmt.Errorf("unknown report type %q", req.Type)
+	}
+	if (req.Type == "linked_ngrams" || req.Type == "best_chains") && (req.ChainDepth < 2 || req.ChainDepth > maxChainDepth) {
+		return nil, fmt.Errorf("chainDepth %d out of range (2 to %d n-grams)", req.ChainDepth, maxChainDepth)
+	}
+	if req.Type == "recurring_text" || req.Type == "linked_ngrams" || req.Type == "best_chains" {
+		// The default overlap is held to minN too: 2-grams leave no overlap
+		if req.MinN < 3 {
+			return nil, fmt.Errorf("minN %d leaves no overlap (2 words up to one less than minN); use minN 3 or more", req.MinN)
+		}
+		if req.Overlap == 0 {
+			req.Overlap = defaultOverlap
+		}
+		if req.Overlap < 2 || req.Overlap >= req.MinN {
+			return nil, fmt.Errorf("overlap %d out of range (2 to %d words, one less than minN)", req.Overlap, req.MinN-1)
+		}
+	}
+
+	job := &ReportJob{
+		ID:          fmt.Sprintf("%d", now.UnixNano()),
+		Type:        req.Type,
+		Name:        name,
+		Description: desc,
+		Query:       req.Query,
+		ChainDepth:  req.ChainDepth,
+		Overlap:     req.Overlap,
+		MinN:        req.MinN,
+		MinFiles:    req.MinFiles,
+		SkipNumeric: req.SkipNumeric,
+		TopN:        req.TopN,
+		Width:       req.Width,
+		Path:        req.Path,
+		Ext:         req.Ext,
+		Period:      req.Period,
+		Length:      req.Length,
+		Temperature: req.Temperature,
+		Seed:        req.Seed,
+		Priority:    req.Priority,
+		Status:      "queued",
+		CreatedAt:   now,
+		files:       files,
+		config:      config,
+
+		SkipStopwords: req.SkipStopwords,
+		Stopwords:     req.Stopwords,
+		stop:          stop,
+	}
+	job.ctx, job.cancel = context.WithCancel(context.Background())
+	return job, nil
+}
+
+func listReports(c *fiber.Ctx, config *CacheConfig) error {
+	var diskUsage int64
+	for _, f := range reportFiles(config.ReportsDir) {
+		diskUsage += f.size
+	}
+	reportJobsMu.RLock()
+	var jobs []*ReportJob
+	for _, j := range reportJobs {
+		if j.config == config {
+			jobs = append(jobs, j)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.After(jobs[j].CreatedAt) })
+	data, err := json.Marshal(fiber.Map{"jobs": jobs, "diskUsage": diskUsage})
+	reportJobsMu.RUnlock()
+	if err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Send(data)
+}
+
+func getReportStatus(c *fiber.Ctx, config *CacheConfig) error {
+	reportJobsMu.RLock()
+	defer reportJobsMu.RUnlock()
+	job, ok := cacheJob(config, c.Params("id"))
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "not found"})
+	}
+	return c.JSON(job)
+}
+
+// deleteReport cancels a queued or running report, or deletes a finished
+// one and its file. A queued report leaves the queue at once; a running
+// one stops at its next check.
+func deleteReport(c *fiber.Ctx, config *CacheConfig) error {
+	job, err := cancelReport(config, c.Params("id"))
+	switch {
+	case errors.Is(err, errNoReport):
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	case err != nil:
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	case job == nil:
+		return c.JSON(fiber.Map{"deleted": c.Params("id")})
+	}
+	return c.JSON(job)
+}
+
+// cancelReport cancels the report id of a cache if it is queued or running
+// and returns a copy of it, or deletes it and its file and returns nil
+func cancelReport(config *CacheConfig, id string) (*ReportJob, error) {
+	reportJobsMu.Lock()
+	job, ok := cacheJob(config, id)
+	if !ok {
+		reportJobsMu.Unlock()
+		return nil, errNoReport
+	}
+	if job.Status != "queued" && job.Status != "running" {
+		path := job.FilePath
+		reportJobsMu.Unlock()
+		return nil, removeReport(id, path)
+	}
+	defer reportJobsMu.Unlock()
+	job.cancel()
+	if job.Status == "queued" {
+		removeQueued(job)
+		job.Status, job.Message = "cancelled", "Cancelled"
+	} else {
+		job.Message = "Cancelling..."
+	}
+	cancelled := *job
+	return &cancelled, nil
+}
+
+func reportWorker() {
+	for {
+		job := nextJob()
+		processReport(job, job.config)
+	}
+}
+
+func updateProgress(job *ReportJob, progress, total int, msg string) {
+	reportJobsMu.Lock()
+	job.Progress, job.Total, job.Message, job.Status = progress, total, msg, "running"
+	reportJobsMu.Unlock()
+}
+
+func processReport(job *ReportJob, config *CacheConfig) {
+	defer job.cancel()
+
+	outPath := filepath.Join(config.ReportsDir, fmt.Sprintf("report_%s.json", job.ID))
+	var err error
+
+	switch job.Type {
+	case "top_ngrams":
+		err = generateTopNgramsReport(job.ctx, job, config, outPath)
+	case "search":
+		err = generateSearchReport(job.ctx, job, config, outPath)
+	case "recurring_text":
+		err = generateRecurringTextReport(job.ctx, job, config, outPath)
+	case "linked_ngrams":
+		err = generateLinkedNgramsReport(job.ctx, job, config, outPath)
+	case "best_chains":
+		err = generateBestChainsReport(job.ctx, job, config, outPath)
+	case "kwic":
+		err = generateKWICReport(job.ctx, job, config, outPath)
+	case "similar":
+		err = generateSimilarReport(job.ctx, job, config, outPath)
+	case "collocations":
+		err = generateCollocationsReport(job.ctx, job, config, outPath)
+	case "timeline":
+		err = generateTimelineReport(job.ctx, job, config, outPath)
+	case "boilerplate":
+		err = generateBoilerplateReport(job.ctx, job, config, outPath)
+	case "outliers":
+		err = generateOutliersReport(job.ctx, job, config, outPath)
+	case "zipf":
+		err = generateZipfReport(job.ctx, job, config, outPath)
+	case "markov":
+		err = generateMarkovReport(job.ctx, job, config, outPath)
+	case "topics":
+		err = generateTopicsReport(job.ctx, job, config, outPath)
+	case "pii":
+		err = generatePIIReport(job.ctx, job, config, outPath)
+	default:
+		err = fmt.Errorf("unknown type")
+	}
+
+	log := pkg.Logger().With("report", job.ID, "type", job.Type)
+	reportJobsMu.Lock()
+	if errors.Is(err, context.Canceled) {
+		os.Remove(outPath)
+		job.Status, job.Message = "cancelled", "Cancelled"
+		log.Info("Report cancelled")
+	} else if err != nil {
+		job.Status, job.Error = "error", err.Error()
+		log.Error("Report failed", "error", err)
+	} else {
+		log.Info("Report done", "path", outPath)
+		job.Status, job.FilePath, job.Progress = "done", outPath, job.Total
+		if info, err := os.Stat(outPath); err == nil {
+			job.Size = info.Size()
+		}
+	}
+	reportJobsMu.Unlock()
+	kickJanitor(config)
+}
+
+func generateTopNgramsReport(ctx context.Context, job *ReportJob, config *CacheConfig, outPath string) error {
+	wordIndex := config.wordIndex()
+	result := make(map[string][]map[string]interface{})
+
+	for n := 2; n <= config.MaxN; n++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		updateProgress(job, n-2, config.MaxN-2, fmt.Sprintf("Processing %d-grams", n))
+		ngrams := loadScopedNgrams(config.CacheDir, n, wordIndex, 200, job.files, config.loadFreqNgrams) // Load more to account for filtering
+		key := fmt.Sprintf("%dgrams", n)
+		count := 0
+		for _, ng := range ngrams {
+			// Skip numeric-only n-grams if requested
+			if job.SkipNumeric && isNumericOnly(ng.words) || hasStopwordEdge(ng.words, job.stop) {
+				continue
+			}
+			entry := map[string]interface{}{"phrase": strings.Join(ng.words, " ")}
+			ng.countFields(entry)
+			result[key] = append(result[key], entry)
+			count++
+			if count >= 100 {
+				break
+			}
+		}
+	}
+
+	data, _ := json.MarshalIndent(result, "", "  ")
+	return os.WriteFile(outPath, data, 0644)
+}
+
+// generateCollocationsReport lists the n-grams whose words occur together
+// most beyond chance, from {n}gramcolloc.txt when -cache collocations has
+// been run and scored from the frequency caches otherwise
+func generateCollocationsReport(ctx context.Context, job *ReportJob, config *CacheConfig, outPath string) error {
+	wordIndex := config.wordIndex()
+	result := make(map[string][]map[string]interface{})
+
+	maxN := min(3, config.MaxN)
+	for n := 2; n <= maxN; n++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		updateProgress(job, n-2, maxN-1, fmt.Sprintf("Scoring %d-grams", n))
+		colls, err := pkg.LoadCollocations(config.CacheDir, n, 0)
+		if err != nil {
+			if colls, err = pkg.ScoreCollocations(config.CacheDir, n); err != nil {
+				return err
+			}
+		}
+		key := fmt.Sprintf("%dgrams", n)
+		for _, c := range colls {
+			var words []string
+			for _, idxStr := range strings.Split(c.Key, "|") {
+				idx, _ := strconv.Atoi(idxStr)
+				words = append(words, wordIndex[idx])
+			}
+			if job.SkipNumeric && isNumericOnly(words) || hasStopwordEdge(words, job.stop) {
+				continue
+			}
+			result[key] = append(result[key], map[string]interface{}{
+				"phrase": strings.Join(words, " "), "count": c.Count, "pmi": c.PMI, "llr": c.LLR,
+			})
+			if len(result[key]) >= job.TopN {
+				break
+			}
+		}
+	}
+
+	data, _ := json.MarshalIndent(result, "", "  ")
+	return os.WriteFile(outPath, data, 0644)
+}
+
+// timelineSeries is one query or n-gram of a timeline report, with its
+// matching files and hits per period
+type timelineSeries struct {
+	Phrase    string `json:"phrase"`
+	FirstSeen string `json:"firstSeen"`
+	LastSeen  string `json:"lastSeen"`
+	Files     []int  `json:"files"`
+	Hits      []int  `json:"hits,omitempty"`
+}
+
+// generateTimelineReport buckets the files matching the job's query, or else
+// those containing the top n-grams, by month or year, using the dates of
+// filedates.txt (-cache dates) or, without it, reading them from the input
+// directory. Files without a date are left out.
+func generateTimelineReport(ctx context.Context, job *ReportJob, config *CacheConfig, outPath string) error {
+	updateProgress(job, 0, 2, "Dating files...")
+	dates, err := pkg.LoadFileDates(config.CacheDir)
+	if err != nil {
+		if dates, err = pkg.ReadFileDates(config.CacheDir); err != nil {
+			return err
+		}
+	}
+	bucket := make([]string, len(dates))
+	filesPer := make(map[string]int)
+	for f, d := range dates {
+		if d.Time.IsZero() || job.files != nil && !job.files.Contains(uint32(f)) {
+			continue
+		}
+		bucket[f] = pkg.DateBucket(d.Time, job.Period)
+		filesPer[bucket[f]]++
+	}
+	periods := make([]string, 0, len(filesPer))
+	for p := range filesPer {
+		periods = append(periods, p)
+	}
+	sort.Strings(periods)
+	at := make(map[string]int, len(periods))
+	totals := make([]int, len(periods))
+	for i, p := range periods {
+		at[p], totals[i] = i, filesPer[p]
+	}
+
+	// add counts file f with hits for s; undated files have no period
+	add := func(s *timelineSeries, f, hits int) {
+		if f >= len(bucket) || bucket[f] == "" {
+			return
+		}
+		i := at[bucket[f]]
+		s.Files[i]++
+		if s.Hits != nil {
+			s.Hits[i] += hits
+		}
+	}
+	newSeries := func(phrase string, hits bool) *timelineSeries {
+		s := &timelineSeries{Phrase: phrase, Files: make([]int, len(periods))}
+		if hits {
+			s.Hits = make([]int, len(periods))
+		}
+		return s
+	}
+
+	updateProgress(job, 1, 2, "Counting matches...")
+	series := []*timelineSeries{}
+	if job.Query != "" {
+		ix, release, err := config.index()
+		if err != nil {
+			return err
+		}
+		results, err := ix.Search(job.Query)
+		release()
+		if err != nil {
+			return err
+		}
+		s := newSeries(job.Query, true)
+		for _, r := range results {
+			add(s, r.Index, r.Hits)
+		}
+		series = append(series, s)
+	} else {
+		wordIndex := config.wordIndex()
+		for _, ng := range loadScopedNgrams(config.CacheDir, job.MinN, wordIndex, 0, job.files, config.loadFreqNgrams) {
+			if len(series) >= job.TopN {
+				break
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if job.SkipNumeric && isNumericOnly(ng.words) || hasStopwordEdge(ng.words, job.stop) {
+				continue
+			}
+			files := ng.files
+			if files == nil {
+				if files, err = pkg.LookupNgram(config.CacheDir, ng.indices); err != nil {
+					return fmt.Errorf("timelines of n-grams need the n-gram index (-cache ngrams): %w", err)
+				}
+			}
+			s := newSeries(strings.Join(ng.words, " "), false)
+			it := files.Iterator()
+			for it.HasNext() {
+				add(s, int(it.Next()), 0)
+			}
+			series = append(series, s)
+		}
+	}
+	for _, s := range series {
+		for i, n := range s.Files {
+			if n > 0 {
+				if s.FirstSeen == "" {
+					s.FirstSeen = periods[i]
+				}
+				s.LastSeen = periods[i]
+			}
+		}
+	}
+
+	result := map[string]interface{}{
+		"type":    "timeline",
+		"query":   job.Query,
+		"n":       job.MinN,
+		"period":  job.Period,
+		"periods": periods,
+		"total":   totals,
+		"series":  series,
+	}
+	data, _ := json.MarshalIndent(result, "", "  ")
+	return os.WriteFile(outPath, data, 0644)
+}
+
+func generateSearchReport(ctx context.Context, job *ReportJob, config *CacheConfig, outPath string) error {
+	query := strings.ToLower(job.Query)
+	wordIndex := config.wordIndex()
+	result := make(map[string][]map[string]interface{})
+
+	for n := 2; n <= config.MaxN; n++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		updateProgress(job, n-2, config.MaxN-2, fmt.Sprintf("Searching %d-grams", n))
+		ngrams := loadScopedNgrams(config.CacheDir, n, wordIndex, 0, job.files, config.loadFreqNgrams)
+		key := fmt.Sprintf("%dgrams", n)
+		count := 0
+		for _, ng := range ngrams {
+			if strings.Contains(strings.ToLower(strings.Join(ng.words, " ")), query) && !hasStopwordEdge(ng.words, job.stop) {
+				entry := map[string]interface{}{"phrase": strings.Join(ng.words, " ")}
+				ng.countFields(entry)
+				result[key] = append(result[key], entry)
+				count++
+				if count >= 50 {
+					break
+				}
+			}
+		}
+	}
+
+	data, _ := json.MarshalIndent(result, "", "  ")
+	return os.WriteFile(outPath, data, 0644)
+}
+
+// generateKWICReport lists every occurrence of the job's word or phrase in
+// context, up to kwicReportLimit lines
+func generateKWICReport(ctx context.Context, job *ReportJob, config *CacheConfig, outPath string) error {
+	updateProgress(job, 0, 1, fmt.Sprintf("Finding '%s'...", job.Query))
+	lines, err := concordance(config, job.Query, job.Width, kwicReportLimit)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	result := map[string]interface{}{
+		"type":      "kwic",
+		"query":     job.Query,
+		"width":     job.Width,
+		"lineCount": len(lines),
+		"lines":     lines,
+	}
+
+	data, _ := json.MarshalIndent(result, "", "  ")
+	return os.WriteFile(outPath, data, 0644)
+}
+
+// generateSimilarReport ranks the files most similar to the job's file,
+// given by its path or index in files.txt
+func generateSimilarReport(ctx context.Context, job *ReportJob, config *CacheConfig, outPath string) error {
+	fileNames := config.fileIndex()
+	fileIdx, err := strconv.Atoi(job.Query)
+	if err != nil {
+		fileIdx = -1
+		for i, name := range fileNames {
+			if name == job.Query {
+				fileIdx = i
+				break
+			}
+		}
+	}
+	if fileIdx < 0 || fileIdx >= len(fileNames) {
+		return fmt.Errorf("no file '%s' in the cache", job.Query)
+	}
+	topN := job.TopN
+	if topN <= 0 {
+		topN = 100
+	}
+
+	updateProgress(job, 0, 1, fmt.Sprintf("Comparing %s with every file...", fileNames[fileIdx]))
+	files, err := similarFiles(config, fileIdx, job.MinN, topN)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	result := map[string]interface{}{
+		"type":  "similar",
+		"file":  fileNames[fileIdx],
+		"index": fileIdx,
+		"n":     job.MinN,
+		"files": files,
+	}
+
+	data, _ := json.MarshalIndent(result, "", "  ")
+	return os.WriteFile(outPath, data, 0644)
+}
+
+// generateBoilerplateReport ranks files by the share of their tokens inside
+// n-grams of size minN that minFiles other files also contain, which is
+// high for form letters, templates and documents made of boilerplate
+func generateBoilerplateReport(ctx context.Context, job *ReportJob, config *CacheConfig, outPath string) error {
+	fileNames := config.fileIndex()
+	updateProgress(job, 0, 1, fmt.Sprintf("Finding %d-grams in %d+ other files...", job.MinN, job.MinFiles))
+	coverage, err := pkg.BoilerplateCoverage(config.CacheDir, job.MinN, job.MinFiles, job.files, func(done, total int) error {
+		if done%100 == 0 || done == total {
+			updateProgress(job, done, total, fmt.Sprintf("Measured %d of %d files", done, total))
+		}
+		return ctx.Err()
+	})
+	if err != nil {
+		return err
+	}
+
+	var tokens, covered int
+	for _, fc := range coverage {
+		tokens += fc.Tokens
+		covered += fc.Covered
+	}
+	files := []fiber.Map{}
+	for _, fc := range coverage[:min(len(coverage), job.TopN)] {
+		name := ""
+		if fc.Index < len(fileNames) {
+			name = fileNames[fc.Index]
+		}
+		files = append(files, fiber.Map{"file": name, "index": fc.Index, "tokens": fc.Tokens, "covered": fc.Covered, "coverage": fc.Coverage})
+	}
+
+	result := map[string]interface{}{
+		"type":                 "boilerplate",
+		"n":                    job.MinN,
+		"minOther":             job.MinFiles,
+		"filesWithBoilerplate": len(coverage),
+		"tokens":               tokens,
+		"covered":              covered,
+		"files":                files,
+	}
+
+	data, _ := json.MarshalIndent(result, "", "  ")
+	return os.WriteFile(outPath, data, 0644)
+}
+
+// generateZipfReport charts how the words and n-grams of the cache are
+// distributed: the rank-frequency curve of the words and the growth of the
+// vocabulary, with the power laws of Zipf and Heaps fitted to them, and how
+// many n-grams of each size occur how often
+func generateZipfReport(ctx context.Context, job *ReportJob, config *CacheConfig, outPath string) error {
+	updateProgress(job, 0, 1, "Ranking words...")
+	stats, err := pkg.ZipfStatistics(config.CacheDir, config.MaxN, func(done, total int) error {
+		if done%100 == 0 || done == total {
+			updateProgress(job, done, total, fmt.Sprintf("Counted %d of %d files", done, total))
+		}
+		return ctx.Err()
+	})
+	if err != nil {
+		return err
+	}
+
+	data, _ := json.MarshalIndent(zipfReport{Type: "zipf", ZipfStats: stats}, "", "  ")
+	return os.WriteFile(outPath, data, 0644)
+}
+
+// markovLength is the words of a Markov sample by default, and
+// maxMarkovLength the most one may have
+const (
+	markovLength    = 50
+	maxMarkovLength = 10000
+)
+
+// promptWords splits a generation prompt into words as process -type
+// lowercase does, stemmed if the cache is
+func promptWords(text string) []string {
+	words := pkg.Tokenize(text)
+	for i, w := range words {
+		words[i] = pkg.Stem(strings.ToLower(w))
+	}
+	return words
+}
+
+// generateMarkovReport writes texts generated by walking the n-gram counts of
+// the cache: text that reads like the corpus shows the n-gram tables
+// captured its language, and many restarts show they did not
+func generateMarkovReport(ctx context.Context, job *ReportJob, config *CacheConfig, outPath string) error {
+	updateProgress(job, 0, job.TopN, fmt.Sprintf("Loading the %d-grams...", job.MinN))
+	model, err := pkg.LoadMarkovModel(config.CacheDir, job.MinN)
+	if err != nil {
+		return err
+	}
+
+	rng := rand.New(rand.NewSource(job.Seed))
+	prompt := promptWords(job.Query)
+	samples := []pkg.MarkovSample{}
+	for i := 0; i < job.TopN; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		samples = append(samples, model.Generate(rng, prompt, job.Length, job.Temperature))
+		updateProgress(job, i+1, job.TopN, fmt.Sprintf("Generated %d of %d samples", i+1, job.TopN))
+	}
+
+	result := map[string]interface{}{
+		"type":        "markov",
+		"n":           model.N,
+		"source":      model.Source,
+		"prompt":      job.Query,
+		"length":      job.Length,
+		"temperature": job.Temperature,
+		"seed":        job.Seed,
+		"samples":     markovSamples(samples),
+	}
+
+	data, _ := json.MarshalIndent(result, "", "  ")
+	return os.WriteFile(outPath, data, 0644)
+}
+
+// generateText generates one text from the n-gram counts as the Markov report
+// does: /api/generate?n=&length=&temperature=&seed=&prompt=
+func generateText(c *fiber.Ctx, config *CacheConfig) error {
+	n := c.QueryInt("n", min(3, config.MaxN))
+	length := c.QueryInt("length", markovLength)
+	temperature := c.QueryFloat("temperature", 1)
+	if n < 2 || n > config.MaxN {
+		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("n %d out of range (2 to %d)", n, config.MaxN)})
+	}
+	if length < 1 || length > maxMarkovLength {
+		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("length %d out of range (1 to %d words)", length, maxMarkovLength)})
+	}
+	if temperature <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("temperature %g must be positive", temperature)})
+	}
+	seed := int64(c.QueryInt("seed"))
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	model, err := pkg.LoadMarkovModel(config.CacheDir, n)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
 	}
-
-	return c.JSON(job)
+	prompt := promptWords(c.Query("prompt"))
+	sample := model.Generate(rand.New(rand.NewSource(seed)), prompt, length, temperature)
+	return c.JSON(fiber.Map{"n": model.N, "source": model.Source, "temperature": temperature, "seed": seed,
+		"text": sample.Text, "words": sample.Words, "restarts": sample.Restarts})
 }
 
-func listReports(c *fiber.Ctx) error {
-	reportJobsMu.RLock()
-	var jobs []*ReportJob
-	for _, j := range reportJobs {
-		jobs = append(jobs, j)
+// markovSamples are the samples of a Markov report as JSON
+func markovSamples(samples []pkg.MarkovSample) []fiber.Map {
+	out := make([]fiber.Map, len(samples))
+	for i, s := range samples {
+		out[i] = fiber.Map{"text": s.Text, "words": s.Words, "restarts": s.Restarts}
 	}
-	reportJobsMu.RUnlock()
-	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.After(jobs[j].CreatedAt) })
-	return c.JSON(fiber.Map{"jobs": jobs})
+	return out
 }
 
-func getReportStatus(c *fiber.Ctx) error {
-	reportJobsMu.RLock()
-	job, ok := reportJobs[c.Params("id")]
-	reportJobsMu.RUnlock()
-	if !ok {
-		return c.Status(404).JSON(fiber.Map{"error": "not found"})
+// piiSamples is the samples of each kind of personal data the PII report
+// keeps per file
+const piiSamples = 3
+
+// generatePIIReport lists the files holding personal data, with their hits
+// of each kind and a few samples, to check a corpus before it is shared
+func generatePIIReport(ctx context.Context, job *ReportJob, config *CacheConfig, outPath string) error {
+	fileNames := config.fileIndex()
+	updateProgress(job, 0, 1, "Scanning files for personal data...")
+	found, err := pkg.ScanPII(config.CacheDir, job.files, piiSamples, func(done, total int) error {
+		if done%100 == 0 || done == total {
+			updateProgress(job, done, total, fmt.Sprintf("Scanned %d of %d files", done, total))
+		}
+		return ctx.Err()
+	})
+	if err != nil {
+		return err
 	}
-	return c.JSON(job)
-}
 
-func viewReport(c *fiber.Ctx) error {
-	reportJobsMu.RLock()
-	job, ok := reportJobs[c.Params("id")]
-	reportJobsMu.RUnlock()
-	if !ok || job.FilePath == "" {
-		return c.Status(404).JSON(fiber.Map{"error": "not found"})
+	totals := make(map[string]int)
+	filesWith := make(map[string]int)
+	for _, fp := range found {
+		for kind, n := range fp.Counts {
+			totals[kind] += n
+			filesWith[kind]++
+		}
 	}
-	data, _ := os.ReadFile(job.FilePath)
-	var result interface{}
-	if json.Unmarshal(data, &result) == nil {
-		return c.JSON(fiber.Map{"job": job, "data": result})
+	kinds := []fiber.Map{}
+	for _, kind := range pkg.PIIKinds {
+		kinds = append(kinds, fiber.Map{"kind": kind, "hits": totals[kind], "files": filesWith[kind]})
+	}
+	files := []fiber.Map{}
+	for _, fp := range found[:min(len(found), job.TopN)] {
+		name := ""
+		if fp.Index < len(fileNames) {
+			name = fileNames[fp.Index]
+		}
+		files = append(files, fiber.Map{"file": name, "index": fp.Index, "total": fp.Total,
+			"counts": fp.Counts, "samples": fp.Samples})
 	}
-	return c.JSON(fiber.Map{"job": job, "text": string(data)})
-}
 
-func reportWorker(config *CacheConfig) {
-	for job := range jobQueue {
-		processReport(job, config)
+	result := map[string]interface{}{
+		"type":          "pii",
+		"filesWithHits": len(found),
+		"kinds":         kinds,
+		"files":         files,
 	}
-}
 
-func updateProgress(job *ReportJob, progress, total int, msg string) {
-	reportJobsMu.Lock()
-	job.Progress, job.Total, job.Message, job.Status = progress, total, msg, "running"
-	reportJobsMu.Unlock()
+	data, _ := json.MarshalIndent(result, "", "  ")
+	return os.WriteFile(outPath, data, 0644)
 }
 
-func processReport(job *ReportJob, config *CacheConfig) {
-	reportJobsMu.Lock()
-	job.Status = "running"
-	job.Message = "Starting..."
-	reportJobsMu.Unlock()
-
-	outPath := filepath.Join(config.ReportsDir, fmt.Sprintf("report_%s.json", job.ID))
-	var err error
+// maxTopics is the most clusters a Topics report finds; topicIterations the
+// most rounds of k-means it runs; topicTerms and topicFiles the terms and
+// member files it lists per cluster
+const (
+	maxTopics       = 200
+	topicIterations = 30
+	topicTerms      = 15
+	topicFiles      = 100
+)
 
-	switch job.Type {
-	case "top_ngrams":
-		err = generateTopNgramsReport(job, config, outPath)
-	case "search":
-		err = generateSearchReport(job, config, outPath)
-	case "recurring_text":
-		err = generateRecurringTextReport(job, config, outPath)
-	case "linked_ngrams":
-		err = generateLinkedNgramsReport(job, config, outPath)
-	case "best_chains":
-		err = generateBestChainsReport(job, config, outPath)
-	default:
-		err = fmt.Errorf("unknown type")
+// generateTopicsReport clusters the files by TF-IDF vectors of the words
+// they contain, from the word→file index, and lists the terms that weigh
+// most in each cluster and the files closest to its centre
+func generateTopicsReport(ctx context.Context, job *ReportJob, config *CacheConfig, outPath string) error {
+	fileNames := config.fileIndex()
+	updateProgress(job, 0, topicIterations, "Building document vectors...")
+	skip := func(word string) bool {
+		return job.stop[word] || job.SkipNumeric && isNumericOnly([]string{word})
 	}
-
-	reportJobsMu.Lock()
+	clusters, stats, err := pkg.TopicClusters(config.CacheDir, pkg.TopicOptions{
+		K:          job.TopN,
+		Iterations: topicIterations,
+		MinFiles:   job.MinFiles,
+		Seed:       job.Seed,
+		TopTerms:   topicTerms,
+		TopFiles:   topicFiles,
+		Files:      job.files,
+		Skip:       skip,
+	}, func(done, total int) error {
+		updateProgress(job, done, total, fmt.Sprintf("k-means round %d", done))
+		return ctx.Err()
+	})
 	if err != nil {
-		job.Status, job.Error = "error", err.Error()
-	} else {
-		job.Status, job.FilePath, job.Progress = "done", outPath, job.Total
+		return err
 	}
-	reportJobsMu.Unlock()
-}
-
-func generateTopNgramsReport(job *ReportJob, config *CacheConfig, outPath string) error {
-	wordIndex := loadWordIndex(config.CacheDir)
-	result := make(map[string][]map[string]interface{})
 
-	for n := 2; n <= config.MaxN; n++ {
-		updateProgress(job, n-2, config.MaxN-2, fmt.Sprintf("Processing %d-grams", n))
-		ngrams := loadNgramsFreqOnly(config.CacheDir, n, wordIndex, 200) // Load more to account for filtering
-		key := fmt.Sprintf("%dgrams", n)
-		count := 0
-		for _, ng := range ngrams {
-			// Skip numeric-only n-grams if requested
-			if job.SkipNumeric && isNumericOnly(ng.words) {
-				continue
-			}
-			result[key] = append(result[key], map[string]interface{}{"phrase": strings.Join(ng.words, " "), "count": ng.count})
-			count++
-			if count >= 100 {
-				break
+	out := []fiber.Map{}
+	for _, c := range clusters {
+		terms := []fiber.Map{}
+		for _, t := range c.Terms {
+			terms = append(terms, fiber.Map{"word": t.Word, "weight": t.Weight})
+		}
+		files := []fiber.Map{}
+		for _, f := range c.Files {
+			name := ""
+			if f.Index < len(fileNames) {
+				name = fileNames[f.Index]
 			}
+			files = append(files, fiber.Map{"file": name, "index": f.Index, "similarity": f.Similarity})
 		}
+		out = append(out, fiber.Map{"size": c.Size, "terms": terms, "files": files})
+	}
+
+	result := map[string]interface{}{
+		"type":       "topics",
+		"k":          job.TopN,
+		"seed":       job.Seed,
+		"files":      stats.Files,
+		"unassigned": stats.Unassigned,
+		"terms":      stats.Terms,
+		"iterations": stats.Iterations,
+		"clusters":   out,
 	}
 
 	data, _ := json.MarshalIndent(result, "", "  ")
 	return os.WriteFile(outPath, data, 0644)
 }
 
-func generateSearchReport(job *ReportJob, config *CacheConfig, outPath string) error {
-	query := strings.ToLower(job.Query)
-	wordIndex := loadWordIndex(config.CacheDir)
-	result := make(map[string][]map[string]interface{})
+// outlierMinTokens is the fewest tokens of a file the Vocabulary Outliers
+// report ranks: the word distribution of a shorter one says little
+const outlierMinTokens = 20
+
+// generateOutliersReport ranks files by the KL divergence of their word
+// distribution from that of the corpus, with the share of their tokens found
+// in no other file, to surface corrupted extractions and files in another
+// language
+func generateOutliersReport(ctx context.Context, job *ReportJob, config *CacheConfig, outPath string) error {
+	fileNames := config.fileIndex()
+	updateProgress(job, 0, 1, "Counting the words of the corpus...")
+	outliers, err := pkg.VocabularyOutliers(config.CacheDir, outlierMinTokens, job.files, func(done, total int) error {
+		if done%100 == 0 || done == total {
+			updateProgress(job, done, total, fmt.Sprintf("Read %d of %d files", done, total))
+		}
+		return ctx.Err()
+	})
+	if err != nil {
+		return err
+	}
 
-	for n := 2; n <= config.MaxN; n++ {
-		updateProgress(job, n-2, config.MaxN-2, fmt.Sprintf("Searching %d-grams", n))
-		ngrams := loadNgramsFreqOnly(config.CacheDir, n, wordIndex, 0)
-		key := fmt.Sprintf("%dgrams", n)
-		count := 0
-		for _, ng := range ngrams {
-			if strings.Contains(strings.ToLower(strings.Join(ng.words, " ")), query) {
-				result[key] = append(result[key], map[string]interface{}{"phrase": strings.Join(ng.words, " "), "count": ng.count})
-				count++
-				if count >= 50 {
-					break
-				}
-			}
+	files := []fiber.Map{}
+	for _, fv := range outliers[:min(len(outliers), job.TopN)] {
+		name := ""
+		if fv.Index < len(fileNames) {
+			name = fileNames[fv.Index]
 		}
+		files = append(files, fiber.Map{"file": name, "index": fv.Index, "tokens": fv.Tokens, "types": fv.Types,
+			"divergence": fv.Divergence, "hapaxRatio": fv.HapaxRatio})
+	}
+
+	result := map[string]interface{}{
+		"type":      "outliers",
+		"minTokens": outlierMinTokens,
+		"ranked":    len(outliers),
+		"files":     files,
 	}
 
 	data, _ := json.MarshalIndent(result, "", "  ")
@@ -536,13 +1956,17 @@ func generateSearchReport(job *ReportJob, config *CacheConfig, outPath string) e
 }
 
 // generateRecurringTextReport finds text patterns that repeat across files
-func generateRecurringTextReport(job *ReportJob, config *CacheConfig, outPath string) error {
-	wordIndex := loadWordIndex(config.CacheDir)
-	fileNames := loadFileIndex(config.CacheDir)
+func generateRecurringTextReport(ctx context.Context, job *ReportJob, config *CacheConfig, outPath string) error {
+	wordIndex := config.wordIndex()
+	fileNames := config.fileIndex()
 	minN := job.MinN
 	if minN < 3 {
 		minN = 5
 	}
+	overlap := job.Overlap
+	if overlap < 2 {
+		overlap = defaultOverlap
+	}
 
 	updateProgress(job, 0, 100, "Loading n-grams with file data...")
 
@@ -550,36 +1974,39 @@ func generateRecurringTextReport(job *ReportJob, config *CacheConfig, outPath st
 	type ngramEntry struct {
 		words []string
 		n     int
-		files map[int]bool
+		files *roaring.Bitmap
 		count int
 	}
 
-	// Map: last 2 words -> list of n-grams ending with those words
+	// Map: last overlap words -> list of n-grams ending with those words
 	endsWith := make(map[string][]ngramEntry)
-	// Map: first 2 words -> list of n-grams starting with those words
+	// Map: first overlap words -> list of n-grams starting with those words
 	startsWith := make(map[string][]ngramEntry)
 
 	totalLoaded := 0
 	for n := minN; n <= config.MaxN; n++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		updateProgress(job, (n-minN)*10, 100, fmt.Sprintf("Loading %d-grams...", n))
 
-		ngrams := loadNgramsWithFiles(config.CacheDir, n, wordIndex, 200) // Top 200 per n
+		ngrams := loadScopedNgrams(config.CacheDir, n, wordIndex, 200, job.files, loadNgramsWithFiles) // Top 200 per n
 		for _, ng := range ngrams {
-			if len(ng.words) < 2 {
+			if len(ng.words) < overlap {
 				continue
 			}
 
 			// Skip numeric-only n-grams if requested
-			if job.SkipNumeric && isNumericOnly(ng.words) {
+			if job.SkipNumeric && isNumericOnly(ng.words) || hasStopwordEdge(ng.words, job.stop) {
 				continue
 			}
 
 			entry := ngramEntry{words: ng.words, n: n, files: ng.files, count: ng.count}
 
-			endKey := strings.Join(ng.words[len(ng.words)-2:], " ")
+			endKey := strings.Join(ng.words[len(ng.words)-overlap:], " ")
 			endsWith[endKey] = append(endsWith[endKey], entry)
 
-			startKey := strings.Join(ng.words[:2], " ")
+			startKey := strings.Join(ng.words[:overlap], " ")
 			startsWith[startKey] = append(startsWith[startKey], entry)
 
 			totalLoaded++
@@ -594,6 +2021,9 @@ func generateRecurringTextReport(job *ReportJob, config *CacheConfig, outPath st
 	seen := make(map[string]bool)
 
 	for endKey, endList := range endsWith {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		startList, ok := startsWith[endKey]
 		if !ok {
 			continue
@@ -610,17 +2040,13 @@ func generateRecurringTextReport(job *ReportJob, config *CacheConfig, outPath st
 				}
 
 				// Find file intersection
-				var sharedFiles []int
+				sharedFiles := roaring.New()
 				if from.files != nil && to.files != nil {
-					for fIdx := range from.files {
-						if to.files[fIdx] {
-							sharedFiles = append(sharedFiles, fIdx)
-						}
-					}
+					sharedFiles = roaring.And(from.files, to.files)
 				}
 
 				// Skip if no shared files (or no file data)
-				fileCount := len(sharedFiles)
+				fileCount := int(sharedFiles.GetCardinality())
 				if fileCount == 0 && from.files != nil {
 					continue
 				}
@@ -646,36 +2072,27 @@ func generateRecurringTextReport(job *ReportJob, config *CacheConfig, outPath st
 				seen[chainKey] = true
 
 				// Build full text by merging overlapping parts
-				// from.words ends with [overlap1, overlap2]
-				// to.words starts with [overlap1, overlap2, rest...]
-				overlap := strings.Join(from.words[len(from.words)-2:], " ")
-				fullText := fromPhrase + " " + strings.Join(to.words[2:], " ")
+				// from.words ends with the overlap words
+				// to.words starts with [overlap words..., rest...]
+				overlapText := strings.Join(from.words[len(from.words)-overlap:], " ")
+				fullText := strings.Join(append(append([]string{}, from.words...), to.words[overlap:]...), " ")
 				fullWords := strings.Split(fullText, " ")
 
 				// Calculate segment positions in fullText
 				// Segment 1 (from): words 0 to len(from.words)-1
-				// Overlap: words len(from.words)-2 to len(from.words)-1
-				// Segment 2 (to): words len(from.words)-2 to end
+				// Overlap: words len(from.words)-overlap to len(from.words)-1
+				// Segment 2 (to): words len(from.words)-overlap to end
 
 				// Convert file indices to names
-				var fileNameList []string
-				for i, fIdx := range sharedFiles {
-					if i >= 20 { // Limit to 20 files shown
-						fileNameList = append(fileNameList, fmt.Sprintf("... and %d more", len(sharedFiles)-20))
-						break
-					}
-					if fIdx < len(fileNames) {
-						fileNameList = append(fileNameList, fileNames[fIdx])
-					}
-				}
+				fileNameList := fileNamesOf(sharedFiles, fileNames, 20, "... and %d more") // Limit to 20 files shown
 
 				chains = append(chains, RecurringChain{
 					Segments: []ChainSegment{
 						{Phrase: fromPhrase, N: from.n, Count: from.count, StartIdx: 0, EndIdx: from.n - 1},
-						{Phrase: toPhrase, N: to.n, Count: to.count, StartIdx: from.n - 2, EndIdx: len(fullWords) - 1},
+						{Phrase: toPhrase, N: to.n, Count: to.count, StartIdx: from.n - overlap, EndIdx: len(fullWords) - 1},
 					},
 					FullText:    fullText,
-					Overlap:     overlap,
+					Overlap:     overlapText,
 					FileCount:   fileCount,
 					Files:       fileNameList,
 					TotalLength: len(fullWords),
@@ -711,6 +2128,7 @@ func generateRecurringTextReport(job *ReportJob, config *CacheConfig, outPath st
 	result := map[string]interface{}{
 		"type":       "recurring_text",
 		"minN":       minN,
+		"overlap":    overlap,
 		"chainCount": len(chains),
 		"chains":     chains,
 	}
@@ -719,6 +2137,28 @@ func generateRecurringTextReport(job *ReportJob, config *CacheConfig, outPath st
 	return os.WriteFile(outPath, data, 0644)
 }
 
+// fileNamesOf lists up to limit file names from a file set, ending with
+// moreFormat (given the number left out) when the set is larger
+func fileNamesOf(files *roaring.Bitmap, fileNames []string, limit int, moreFormat string) []string {
+	if files == nil {
+		return nil
+	}
+	var names []string
+	count := 0
+	it := files.Iterator()
+	for it.HasNext() {
+		if count >= limit {
+			names = append(names, fmt.Sprintf(moreFormat, int(files.GetCardinality())-limit))
+			break
+		}
+		if f := int(it.Next()); f < len(fileNames) {
+			names = append(names, fileNames[f])
+		}
+		count++
+	}
+	return names
+}
+
 func min(a, b int) int {
 	if a < b {
 		return a
@@ -726,6 +2166,29 @@ func min(a, b int) int {
 	return b
 }
 
+// hasStopwordEdge reports whether an n-gram begins or ends with one of stop,
+// like the n-grams -stopwords keeps out of the cache
+func hasStopwordEdge(words []string, stop map[string]bool) bool {
+	if len(stop) == 0 || len(words) == 0 {
+		return false
+	}
+	return stop[strings.ToLower(words[0])] || stop[strings.ToLower(words[len(words)-1])]
+}
+
+// withoutStopwordEdges drops the n-grams beginning or ending with one of stop
+func withoutStopwordEdges(ngrams []NgramWithFiles, stop map[string]bool) []NgramWithFiles {
+	if len(stop) == 0 {
+		return ngrams
+	}
+	kept := make([]NgramWithFiles, 0, len(ngrams))
+	for _, ng := range ngrams {
+		if !hasStopwordEdge(ng.words, stop) {
+			kept = append(kept, ng)
+		}
+	}
+	return kept
+}
+
 // isNumericOnly checks if n-gram is mostly numeric junk (census data, spreadsheets)
 // Returns true if:
 // - All words are pure numbers/scientific notation
@@ -755,6 +2218,12 @@ func isNumericOnly(words []string) bool {
 			continue
 		}
 
+		// Placeholders of process -placeholders stand for numbers and dates
+		if w == "<NUM>" || w == "<DATE>" {
+			numericCount++
+			continue
+		}
+
 		// Check if word starts with a digit (like "0inhouseholds", "7spouse", "28019")
 		if len(w) > 0 && w[0] >= '0' && w[0] <= '9' {
 			numericCount++
@@ -781,60 +2250,49 @@ type ChainNode struct {
 	Count  int    `json:"count"`
 }
 
-// generateLinkedNgramsReport finds chains of n-grams (A→B→C) that form sentences across files
-func generateLinkedNgramsReport(job *ReportJob, config *CacheConfig, outPath string) error {
-	wordIndex := loadWordIndex(config.CacheDir)
-	fileNames := loadFileIndex(config.CacheDir)
+// generateLinkedNgramsReport finds chains of chainDepth n-grams (A→B→C by
+// default) that form sentences across files
+func generateLinkedNgramsReport(ctx context.Context, job *ReportJob, config *CacheConfig, outPath string) error {
+	wordIndex := config.wordIndex()
+	fileNames := config.fileIndex()
 	minN := job.MinN
 	if minN < 3 {
 		minN = 5
 	}
-
-	updateProgress(job, 0, 100, "Loading n-grams with file data...")
-
-	// Load n-grams with file information
-	type ngramEntry struct {
-		words []string
-		n     int
-		files map[int]bool
-		count int
+	overlap := job.Overlap
+	if overlap < 2 {
+		overlap = defaultOverlap
+	}
+	depth := job.ChainDepth
+	if depth < 2 {
+		depth = linkedChainDepth
 	}
 
-	// Map: last 2 words -> list of n-grams ending with those words
-	endsWith := make(map[string][]ngramEntry)
-	// Map: first 2 words -> list of n-grams starting with those words
-	startsWith := make(map[string][]ngramEntry)
+	updateProgress(job, 0, 100, "Loading n-grams with file data...")
 
-	totalLoaded := 0
+	graph := newNgramLinks(overlap)
 	for n := minN; n <= config.MaxN; n++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		updateProgress(job, (n-minN)*15, 100, fmt.Sprintf("Loading %d-grams...", n))
 
-		ngrams := loadNgramsWithFiles(config.CacheDir, n, wordIndex, 300)
+		ngrams := loadScopedNgrams(config.CacheDir, n, wordIndex, 300, job.files, loadNgramsWithFiles)
 		for _, ng := range ngrams {
-			if len(ng.words) < 2 {
+			if len(ng.words) < overlap {
 				continue
 			}
 
 			// Skip numeric-only n-grams if requested
-			if job.SkipNumeric && isNumericOnly(ng.words) {
+			if job.SkipNumeric && isNumericOnly(ng.words) || hasStopwordEdge(ng.words, job.stop) {
 				continue
 			}
-
-			entry := ngramEntry{words: ng.words, n: n, files: ng.files, count: ng.count}
-
-			endKey := strings.Join(ng.words[len(ng.words)-2:], " ")
-			endsWith[endKey] = append(endsWith[endKey], entry)
-
-			startKey := strings.Join(ng.words[:2], " ")
-			startsWith[startKey] = append(startsWith[startKey], entry)
-
-			totalLoaded++
+			graph.add(ng.words, n, ng.files, ng.count)
 		}
 	}
 
-	updateProgress(job, 50, 100, fmt.Sprintf("Building chains from %d n-grams...", totalLoaded))
+	updateProgress(job, 50, 100, fmt.Sprintf("Building %d-n-gram chains from %d n-grams...", depth, len(graph.links)))
 
-	// Find chains: A → B → C (3 n-grams linked together)
 	var chains []NgramChainResult
 	seen := make(map[string]bool)
 
@@ -843,115 +2301,35 @@ func generateLinkedNgramsReport(job *ReportJob, config *CacheConfig, outPath str
 		minFiles = 2
 	}
 
-	for endKey, endList := range endsWith {
-		midList, ok := startsWith[endKey]
-		if !ok {
-			continue
+	for i, start := range graph.links {
+		if err := ctx.Err(); err != nil {
+			return err
 		}
-
-		// For each A that ends with endKey
-		for _, from := range endList {
-			// For each B that starts with endKey
-			for _, mid := range midList {
-				fromPhrase := strings.Join(from.words, " ")
-				midPhrase := strings.Join(mid.words, " ")
-
-				if fromPhrase == midPhrase {
-					continue
-				}
-
-				// Find intersection of files between A and B
-				var sharedFilesAB []int
-				if from.files != nil && mid.files != nil {
-					for fIdx := range from.files {
-						if mid.files[fIdx] {
-							sharedFilesAB = append(sharedFilesAB, fIdx)
-						}
-					}
-				}
-
-				if len(sharedFilesAB) < minFiles && from.files != nil {
-					continue
-				}
-
-				// Try to find C that links from B
-				midEndKey := strings.Join(mid.words[len(mid.words)-2:], " ")
-				toList, hasC := startsWith[midEndKey]
-
-				if hasC {
-					// Build 3-way chains (A → B → C)
-					for _, to := range toList {
-						toPhrase := strings.Join(to.words, " ")
-						if toPhrase == midPhrase || toPhrase == fromPhrase {
-							continue
-						}
-
-						// Find files shared by all 3
-						var sharedFilesABC []int
-						if to.files != nil {
-							for _, fIdx := range sharedFilesAB {
-								if to.files[fIdx] {
-									sharedFilesABC = append(sharedFilesABC, fIdx)
-								}
-							}
-						}
-
-						fileCount := len(sharedFilesABC)
-						if fileCount < minFiles && to.files != nil {
-							continue
-						}
-						if to.files == nil {
-							fileCount = min(min(from.count, mid.count), to.count)
-						}
-
-						chainKey := fromPhrase + "|" + midPhrase + "|" + toPhrase
-						if seen[chainKey] {
-							continue
-						}
-						seen[chainKey] = true
-
-						// Build full text
-						fullText := fromPhrase + " " + strings.Join(mid.words[2:], " ") + " " + strings.Join(to.words[2:], " ")
-
-						var fileList []string
-						for i, fIdx := range sharedFilesABC {
-							if i >= 10 {
-								fileList = append(fileList, fmt.Sprintf("...+%d more", len(sharedFilesABC)-10))
-								break
-							}
-							if fIdx < len(fileNames) {
-								fileList = append(fileList, fileNames[fIdx])
-							}
-						}
-
-						chains = append(chains, NgramChainResult{
-							Chain: []ChainNode{
-								{Phrase: fromPhrase, N: from.n, Count: from.count},
-								{Phrase: midPhrase, N: mid.n, Count: mid.count},
-								{Phrase: toPhrase, N: to.n, Count: to.count},
-							},
-							FullText:    fullText,
-							ChainLength: 3,
-							FileCount:   fileCount,
-							Files:       fileList,
-						})
-
-						if len(chains) >= 300 {
-							break
-						}
-					}
-				}
-
-				if len(chains) >= 300 {
-					break
-				}
+		if i%100 == 0 {
+			updateProgress(job, 50+i*45/len(graph.links), 100, fmt.Sprintf("Building chains from n-gram %d of %d...", i+1, len(graph.links)))
+		}
+		for _, p := range graph.beamChains(start, depth, chainBeamWidth, minFiles) {
+			if len(p.links) < depth {
+				continue
 			}
-			if len(chains) >= 300 {
-				break
+			nodes := chainNodes(p)
+			phrases := make([]string, len(nodes))
+			for k, node := range nodes {
+				phrases[k] = node.Phrase
 			}
-		}
-		if len(chains) >= 300 {
-			break
+			chainKey := strings.Join(phrases, "|")
+			if seen[chainKey] {
+				continue
+			}
+			seen[chainKey] = true
+
+			chains = append(chains, NgramChainResult{
+				Chain:       nodes,
+				FullText:    p.text(overlap),
+				ChainLength: depth,
+				FileCount:   p.fileCount(),
+				Files:       fileNamesOf(p.files, fileNames, 10, "...+%d more"),
+			})
 		}
 	}
 
@@ -972,7 +2350,9 @@ func generateLinkedNgramsReport(job *ReportJob, config *CacheConfig, outPath str
 	result := map[string]interface{}{
 		"type":       "linked_ngrams",
 		"minN":       minN,
+		"overlap":    overlap,
 		"minFiles":   minFiles,
+		"chainDepth": depth,
 		"chainCount": len(chains),
 		"chains":     chains,
 	}
@@ -991,35 +2371,34 @@ type BestChain struct {
 	Files     []string    `json:"files"`
 }
 
-// generateBestChainsReport finds the longest chains sorted by (files × length)
-func generateBestChainsReport(job *ReportJob, config *CacheConfig, outPath string) error {
-	wordIndex := loadWordIndex(config.CacheDir)
-	fileNames := loadFileIndex(config.CacheDir)
+// generateBestChainsReport finds the longest chains of up to chainDepth
+// n-grams sorted by (files × length)
+func generateBestChainsReport(ctx context.Context, job *ReportJob, config *CacheConfig, outPath string) error {
+	wordIndex := config.wordIndex()
+	fileNames := config.fileIndex()
 	minN := job.MinN
 	if minN < 2 {
 		minN = 3
 	}
+	overlap := job.Overlap
+	if overlap < 2 {
+		overlap = defaultOverlap
+	}
 	topN := job.TopN
 	if topN <= 0 {
 		topN = 100
 	}
-
-	updateProgress(job, 0, 100, fmt.Sprintf("Loading top %d n-grams with file data...", topN))
-
-	type ngramEntry struct {
-		words []string
-		n     int
-		files map[int]bool
-		count int
+	depth := job.ChainDepth
+	if depth < 2 {
+		depth = bestChainDepth
 	}
 
-	endsWith := make(map[string][]ngramEntry)
-	startsWith := make(map[string][]ngramEntry)
+	updateProgress(job, 0, 100, fmt.Sprintf("Loading top %d n-grams with file data...", topN))
 
 	// Parallel loading of n-grams
 	type loadResult struct {
-		entries []ngramEntry
-		n       int
+		ngrams []NgramWithFiles
+		n      int
 	}
 	resultChan := make(chan loadResult, config.MaxN-minN+1)
 	var wg sync.WaitGroup
@@ -1028,15 +2407,15 @@ func generateBestChainsReport(job *ReportJob, config *CacheConfig, outPath strin
 		wg.Add(1)
 		go func(nSize int) {
 			defer wg.Done()
-			ngrams := loadNgramsWithFiles(config.CacheDir, nSize, wordIndex, topN)
-			var entries []ngramEntry
+			ngrams := loadScopedNgrams(config.CacheDir, nSize, wordIndex, topN, job.files, loadNgramsWithFiles)
+			var kept []NgramWithFiles
 			for _, ng := range ngrams {
-				if len(ng.words) < 2 || (job.SkipNumeric && isNumericOnly(ng.words)) {
+				if len(ng.words) < overlap || (job.SkipNumeric && isNumericOnly(ng.words)) || hasStopwordEdge(ng.words, job.stop) {
 					continue
 				}
-				entries = append(entries, ngramEntry{words: ng.words, n: nSize, files: ng.files, count: ng.count})
+				kept = append(kept, ng)
 			}
-			resultChan <- loadResult{entries: entries, n: nSize}
+			resultChan <- loadResult{ngrams: kept, n: nSize}
 		}(n)
 	}
 
@@ -1046,137 +2425,67 @@ func generateBestChainsReport(job *ReportJob, config *CacheConfig, outPath strin
 		close(resultChan)
 	}()
 
+	// Collected by size, so the graph does not depend on which loads first
+	bySize := make(map[int][]NgramWithFiles)
 	loaded := 0
 	total := config.MaxN - minN + 1
 	for result := range resultChan {
 		loaded++
 		updateProgress(job, loaded*40/total, 100, fmt.Sprintf("Loaded %d-grams (top %d)...", result.n, topN))
-		for _, entry := range result.entries {
-			endKey := strings.Join(entry.words[len(entry.words)-2:], " ")
-			endsWith[endKey] = append(endsWith[endKey], entry)
-
-			startKey := strings.Join(entry.words[:2], " ")
-			startsWith[startKey] = append(startsWith[startKey], entry)
+		bySize[result.n] = result.ngrams
+	}
+	graph := newNgramLinks(overlap)
+	for n := minN; n <= config.MaxN; n++ {
+		for _, ng := range bySize[n] {
+			graph.add(ng.words, n, ng.files, ng.count)
 		}
 	}
 
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	updateProgress(job, 50, 100, "Building longest chains...")
 
-	// Build chains by following links as far as possible
 	var bestChains []BestChain
 	seen := make(map[string]bool)
 
-	// For each n-gram, try to build the longest chain starting from it
-	for _, startList := range endsWith {
-		for _, start := range startList {
-			chain := []ngramEntry{start}
-			sharedFiles := make(map[int]bool)
-			for f := range start.files {
-				sharedFiles[f] = true
-			}
-
-			// Follow the chain forward
-			current := start
-			for depth := 0; depth < 10; depth++ { // Max 10 links
-				endKey := strings.Join(current.words[len(current.words)-2:], " ")
-				nextList, ok := startsWith[endKey]
-				if !ok || len(nextList) == 0 {
-					break
-				}
-
-				// Find best next n-gram (prefer shared files, fallback to highest count)
-				var bestNext *ngramEntry
-				var bestScore int
-				for i := range nextList {
-					next := &nextList[i]
-					if strings.Join(next.words, " ") == strings.Join(current.words, " ") {
-						continue
-					}
-
-					// Score: shared files * 1000 + count (prioritize file overlap, but use count as tiebreaker)
-					shared := 0
-					if len(sharedFiles) > 0 && next.files != nil {
-						for f := range sharedFiles {
-							if next.files[f] {
-								shared++
-							}
-						}
-					}
-					score := shared*1000 + next.count
-					if bestNext == nil || score > bestScore {
-						bestScore = score
-						bestNext = next
-					}
-				}
-
-				if bestNext == nil {
-					break
-				}
-
-				chain = append(chain, *bestNext)
-				// Update shared files (keep intersection, or just use next's files if we had none)
-				if len(sharedFiles) > 0 && bestNext.files != nil {
-					newShared := make(map[int]bool)
-					for f := range sharedFiles {
-						if bestNext.files[f] {
-							newShared[f] = true
-						}
-					}
-					sharedFiles = newShared
-				} else if bestNext.files != nil {
-					sharedFiles = bestNext.files
-				}
-				current = *bestNext
-			}
-
-			if len(chain) < 2 {
-				continue
-			}
-
-			// Build full text
-			fullText := strings.Join(chain[0].words, " ")
-			for i := 1; i < len(chain); i++ {
-				fullText += " " + strings.Join(chain[i].words[2:], " ")
-			}
-
-			// Create chain key for deduplication
-			chainKey := fullText
-			if seen[chainKey] {
-				continue
-			}
-			seen[chainKey] = true
-
-			wordCount := len(strings.Split(fullText, " "))
-			fileCount := len(sharedFiles)
-			score := wordCount * fileCount
-
-			var fileList []string
-			count := 0
-			for f := range sharedFiles {
-				if count >= 10 {
-					fileList = append(fileList, fmt.Sprintf("...+%d more", fileCount-10))
-					break
-				}
-				if f < len(fileNames) {
-					fileList = append(fileList, fileNames[f])
-				}
-				count++
-			}
+	// Chains must share a file to recur at all
+	minFiles := max(1, job.MinFiles)
 
-			nodes := make([]ChainNode, len(chain))
-			for i, c := range chain {
-				nodes[i] = ChainNode{Phrase: strings.Join(c.words, " "), N: c.n, Count: c.count}
+	// For each n-gram, keep the best chain the beam finds from it
+	for i, start := range graph.links {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if i%100 == 0 {
+			updateProgress(job, 50+i*45/len(graph.links), 100, fmt.Sprintf("Building chains from n-gram %d of %d...", i+1, len(graph.links)))
+		}
+		var best *chainPath
+		var bestWords, bestScore int
+		for _, p := range graph.beamChains(start, depth, chainBeamWidth, minFiles) {
+			words := len(strings.Fields(p.text(overlap)))
+			if score := words * p.fileCount(); best == nil || score > bestScore {
+				best, bestWords, bestScore = p, words, score
 			}
+		}
+		if best == nil {
+			continue
+		}
 
-			bestChains = append(bestChains, BestChain{
-				Chain:     nodes,
-				FullText:  fullText,
-				WordCount: wordCount,
-				FileCount: fileCount,
-				Score:     score,
-				Files:     fileList,
-			})
+		fullText := best.text(overlap)
+		if seen[fullText] {
+			continue
 		}
+		seen[fullText] = true
+
+		bestChains = append(bestChains, BestChain{
+			Chain:     chainNodes(best),
+			FullText:  fullText,
+			WordCount: bestWords,
+			FileCount: best.fileCount(),
+			Score:     bestScore,
+			Files:     fileNamesOf(best.files, fileNames, 10, "...+%d more"),
+		})
 	}
 
 	// Sort by score (files × length) descending
@@ -1193,6 +2502,8 @@ func generateBestChainsReport(job *ReportJob, config *CacheConfig, outPath strin
 	result := map[string]interface{}{
 		"type":       "best_chains",
 		"minN":       minN,
+		"overlap":    overlap,
+		"chainDepth": depth,
 		"chainCount": len(bestChains),
 		"chains":     bestChains,
 	}
@@ -1218,18 +2529,38 @@ func handleWebSocket(c *websocket.Conn, config *CacheConfig) {
 
 		action, _ := req["action"].(string)
 		var response fiber.Map
+		pathGlob, _ := req["path"].(string)
+		exts, _ := req["ext"].(string)
+		spec, _ := req["stopwords"].(string)
+		filter, err := fileFilter(config, pathGlob, exts)
+		stop, stopErr := stopwordSet(spec)
+		if err == nil {
+			err = stopErr
+		}
 
-		switch action {
-		case "stats":
+		switch {
+		case err != nil:
+			response = fiber.Map{"error": err.Error()}
+		case action == "stats":
 			response = getStats(config)
-		case "ngrams":
+		case action == "ngrams":
 			n := int(req["n"].(float64))
 			limit := int(req["limit"].(float64))
 			offset := int(req["offset"].(float64))
-			response = streamNgramsWS(config, n, limit, offset)
-		case "search":
+			var opts ngramOptions
+			opts.Sort, _ = req["sort"].(string)
+			opts.Contains, _ = req["contains"].(string)
+			if minCount, ok := req["min_count"].(float64); ok {
+				opts.MinCount = int(minCount)
+			}
+			if response, err = streamNgramsWS(config, n, limit, offset, filter, stop, opts); err != nil {
+				response = fiber.Map{"error": err.Error()}
+			}
+		case action == "search":
 			query, _ := req["query"].(string)
-			response = streamSearchWS(config, query)
+			normalize, _ := req["normalize"].(bool)
+			config.queries.record(query, pathGlob, exts)
+			response = runSearch(config, query, filter, stop, normalize, 20, 0)
 		default:
 			response = fiber.Map{"error": "unknown"}
 		}
@@ -1239,52 +2570,105 @@ func handleWebSocket(c *websocket.Conn, config *CacheConfig) {
 	}
 }
 
-func streamNgramsWS(config *CacheConfig, n, limit, offset int) fiber.Map {
-	wordIndex := loadWordIndex(config.CacheDir)
-	ngrams := loadNgramsFreqOnly(config.CacheDir, n, wordIndex, 0)
+// ngramOptions are the sort order and conditions of an n-gram listing
+type ngramOptions struct {
+	Sort     string // "count" (default), "files" or "alpha"
+	MinCount int    // leave out n-grams counted fewer times
+	Contains string // keep n-grams containing this text, ignoring case
+}
 
-	total := len(ngrams)
-	end := offset + limit
-	if end > total {
-		end = total
+// streamNgramsWS returns a page of the n-grams of size n, most frequent
+// first unless opts sort them otherwise. Unfiltered pages by count within
+// the n-grams held in memory are served from there, without reading the rest
+// of the frequency file; MinCount cuts the count-ordered lists by binary
+// search.
+func streamNgramsWS(config *CacheConfig, n, limit, offset int, filter *roaring.Bitmap, stop map[string]bool, opts ngramOptions) (fiber.Map, error) {
+	if opts.Sort == "" {
+		opts.Sort = "count"
 	}
-
-	var result []fiber.Map
-	if offset < total {
-		for _, ng := range ngrams[offset:end] {
-			result = append(result, fiber.Map{"ngram": strings.Join(ng.words, "|"), "count": ng.count, "words": ng.words})
+	offset = max(0, offset)
+	var ngrams []NgramWithFiles
+	total := -1
+	m := config.mem()
+	cached := m.ngrams[n]
+	switch opts.Sort {
+	case "count", "alpha":
+		if filter == nil && stop == nil && opts.Contains == "" && opts.Sort == "count" {
+			if cut := countCut(cached, opts.MinCount); cut < len(cached) || len(cached) == m.counts[n] {
+				ngrams, total = cached[:cut], cut
+			} else if opts.MinCount <= 0 && offset+limit <= len(cached) {
+				ngrams, total = cached, m.counts[n]
+			}
 		}
-	}
-
-	return fiber.Map{"type": "ngrams", "n": n, "total": total, "offset": offset, "ngrams": result}
-}
-
-func streamSearchWS(config *CacheConfig, query string) fiber.Map {
-	query = strings.ToLower(query)
-	wordIndex := loadWordIndex(config.CacheDir)
-
-	var wordMatches []fiber.Map
-	for idx, word := range wordIndex {
-		if strings.Contains(strings.ToLower(word), query) {
-			wordMatches = append(wordMatches, fiber.Map{"index": idx, "word": word})
-			if len(wordMatches) >= 20 {
-				break
+		if total < 0 {
+			ngrams = loadScopedNgrams(config.CacheDir, n, m.words, 0, filter, config.loadFreqNgrams)
+			if filter != nil && opts.Sort == "count" {
+				// Scoped n-grams come ranked by their selected files
+				sort.SliceStable(ngrams, func(i, j int) bool { return ngrams[i].count > ngrams[j].count })
 			}
 		}
+	case "files":
+		if filter != nil {
+			ngrams = loadScopedNgrams(config.CacheDir, n, m.words, 0, filter, config.loadFreqNgrams)
+			break
+		}
+		if len(pkg.NgramIndexParts(config.CacheDir, n)) == 0 {
+			return nil, fmt.Errorf("sorting by files needs the n-gram index (-cache ngrams)")
+		}
+		ngrams = withOccurrences(config.CacheDir, n, loadNgramsWithFiles(config.CacheDir, n, m.words, 0))
+		sort.SliceStable(ngrams, func(i, j int) bool { return ngrams[i].fileCount() > ngrams[j].fileCount() })
+	default:
+		return nil, fmt.Errorf("unknown sort %q (use count, files or alpha)", opts.Sort)
 	}
 
-	ngramMatches := make(map[int][]fiber.Map)
-	for n := 2; n <= config.MaxN; n++ {
-		ngrams := loadNgramsFreqOnly(config.CacheDir, n, wordIndex, 500)
-		for _, ng := range ngrams {
-			if strings.Contains(strings.ToLower(strings.Join(ng.words, " ")), query) {
-				ngramMatches[n] = append(ngramMatches[n], fiber.Map{"words": ng.words, "count": ng.count})
-				if len(ngramMatches[n]) >= 10 {
-					break
+	if total < 0 {
+		// min_count is on occurrences whatever the order
+		if opts.MinCount > 0 {
+			kept := make([]NgramWithFiles, 0, len(ngrams))
+			for _, ng := range ngrams {
+				if ng.count >= opts.MinCount {
+					kept = append(kept, ng)
+				}
+			}
+			ngrams = kept
+		}
+		ngrams = withoutStopwordEdges(ngrams, stop)
+		if opts.Contains != "" {
+			needle := strings.ToLower(opts.Contains)
+			kept := make([]NgramWithFiles, 0, len(ngrams))
+			for _, ng := range ngrams {
+				if strings.Contains(strings.ToLower(strings.Join(ng.words, " ")), needle) {
+					kept = append(kept, ng)
 				}
 			}
+			ngrams = kept
 		}
+		if opts.Sort == "alpha" {
+			ngrams = append([]NgramWithFiles(nil), ngrams...)
+			sort.SliceStable(ngrams, func(i, j int) bool {
+				return strings.Join(ngrams[i].words, " ") < strings.Join(ngrams[j].words, " ")
+			})
+		}
+		total = len(ngrams)
+	}
+
+	end := min(offset+limit, len(ngrams))
+	var result []fiber.Map
+	for i := offset; i < end; i++ {
+		ng := ngrams[i]
+		entry := fiber.Map{"ngram": strings.Join(ng.words, "|"), "words": ng.words}
+		ng.countFields(entry)
+		result = append(result, entry)
 	}
 
-	return fiber.Map{"type": "search", "words": wordMatches, "ngrams": ngramMatches}
+	return fiber.Map{"type": "ngrams", "n": n, "sort": opts.Sort, "total": total, "offset": offset, "ngrams": result}, nil
+}
+
+// countCut returns the number of n-grams of a list ordered by count, most
+// first, counted at least minCount times
+func countCut(ngrams []NgramWithFiles, minCount int) int {
+	if minCount <= 0 {
+		return len(ngrams)
+	}
+	return sort.Search(len(ngrams), func(i int) bool { return ngrams[i].count < minCount })
 }
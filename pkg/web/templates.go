@@ -0,0 +1,169 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/openfluke/tokentrove/pkg"
+)
+
+// TemplatesName is the file in the reports directory holding the report
+// templates
+const TemplatesName = "templates.json"
+
+// ReportTemplate is a named preset of report options, so a standard report
+// is queued with one click instead of its options entered again
+type ReportTemplate struct {
+	Name        string        `json:"name"`
+	Description string        `json:"description,omitempty"`
+	Report      reportRequest `json:"report"`
+	CreatedAt   time.Time     `json:"createdAt"`
+	LastRun     *time.Time    `json:"lastRun,omitempty"`
+}
+
+// templateStore keeps the report templates, written back to templates.json
+// on every change
+type templateStore struct {
+	mu        sync.Mutex
+	path      string
+	Templates []ReportTemplate `json:"templates"`
+}
+
+// loadTemplateStore reads templates.json from dir; a missing file is an
+// empty store
+func loadTemplateStore(dir string) (*templateStore, error) {
+	store := &templateStore{path: filepath.Join(dir, TemplatesName)}
+	data, err := os.ReadFile(store.path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, store); err != nil {
+		return nil, fmt.Errorf("could not read %s: %w", store.path, err)
+	}
+	return store, nil
+}
+
+// save writes the store; the caller holds mu
+func (s *templateStore) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// find returns the index of the template called name, or -1
+func (s *templateStore) find(name string) int {
+	for i, t := range s.Templates {
+		if t.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// listTemplates returns the report templates
+func listTemplates(c *fiber.Ctx, config *CacheConfig) error {
+	s := config.templates
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return c.JSON(fiber.Map{"templates": s.Templates})
+}
+
+// saveTemplate saves {"name", "description", "report"}, where report takes
+// the options of POST /api/report, replacing a template of the same name
+func saveTemplate(c *fiber.Ctx, config *CacheConfig) error {
+	var req ReportTemplate
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "a template needs a name"})
+	}
+	if _, err := newReportJob(config, req.Report); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	s := config.templates
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	saved := ReportTemplate{Name: req.Name, Description: strings.TrimSpace(req.Description), Report: req.Report,
+		CreatedAt: time.Now()}
+	if i := s.find(req.Name); i >= 0 {
+		saved.CreatedAt, saved.LastRun = s.Templates[i].CreatedAt, s.Templates[i].LastRun
+		s.Templates[i] = saved
+	} else {
+		s.Templates = append(s.Templates, saved)
+	}
+	if err := s.save(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(saved)
+}
+
+// deleteTemplate removes the template named in the path; its reports stay
+func deleteTemplate(c *fiber.Ctx, config *CacheConfig) error {
+	name, _ := url.PathUnescape(c.Params("name"))
+	s := config.templates
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.find(name)
+	if i < 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "not found"})
+	}
+	s.Templates = append(s.Templates[:i], s.Templates[i+1:]...)
+	if err := s.save(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"deleted": name})
+}
+
+// reportTemplate queues a report with the options of the template named in
+// the path. The body may override any of them, taking the options of POST
+// /api/report: {"path": "contracts/*"} runs the template on other files.
+func reportTemplate(c *fiber.Ctx, config *CacheConfig) error {
+	name, _ := url.PathUnescape(c.Params("name"))
+	s := config.templates
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.find(name)
+	if i < 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "not found"})
+	}
+	req := s.Templates[i].Report
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+	job, err := newReportJob(config, req)
+	if err == nil {
+		now := time.Now()
+		job.Name = fmt.Sprintf("%s - %s", s.Templates[i].Name, now.Format("Jan 2 15:04"))
+		if err = enqueueJob(job); err == nil {
+			s.Templates[i].LastRun = &now
+			if err := s.save(); err != nil {
+				pkg.Logger().Error("Could not save templates", "error", err)
+			}
+		}
+	}
+	if err != nil {
+		return c.Status(enqueueStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return jobJSON(c, job)
+}
@@ -0,0 +1,164 @@
+package pkg
+
+import (
+	"bufio"
+	"context"
+	"iter"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/RoaringBitmap/roaring/v2"
+)
+
+// cacheWorkers is the number of goroutines the cache builders read token files with
+var cacheWorkers = 1
+
+// SetCacheWorkers sets how many token files the cache builders read and
+// tokenize concurrently. Each worker keeps its own partial maps, merged once
+// all files are read, so memory grows with the worker count.
+func SetCacheWorkers(workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	cacheWorkers = workers
+}
+
+// cacheWorkerCount returns the number of workers to use for a file list.
+// Tokenizing is CPU-bound, so more workers than CPUs only costs memory.
+func cacheWorkerCount(files int) int {
+	return max(1, min(cacheWorkers, runtime.NumCPU(), files))
+}
+
+// forEachTokenFile reads the files in filesList from src with cacheWorkerCount
+// workers and calls fn with each file's word indices. fn runs concurrently but
+// each worker sees its files in increasing index order; worker identifies the
+// calling worker so fn can update per-worker state without locking. progress,
+// if not nil, is called with the number of files done so far. The first error
+// returned by fn stops the scan, as does ctx being done, which returns its
+// error.
+func forEachTokenFile(ctx context.Context, src *tokenSource, filesList []string,
+	fn func(worker, fileIdx int, words []int) error, progress func(done int)) error {
+	return forEachTokenRange(ctx, src, filesList, 0, len(filesList), fn, progress)
+}
+
+// forEachTokenRange is forEachTokenFile over filesList[start:end]; fn still
+// gets indices into the whole list
+func forEachTokenRange(ctx context.Context, src *tokenSource, filesList []string, start, end int,
+	fn func(worker, fileIdx int, words []int) error, progress func(done int)) error {
+	indices := func(yield func(int) bool) {
+		for i := start; i < end; i++ {
+			if !yield(i) {
+				return
+			}
+		}
+	}
+	return forEachTokenIndex(src, filesList, end-start, indices, func(worker, fileIdx int, words []int) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fn(worker, fileIdx, words)
+	}, progress)
+}
+
+// forEachTokenIndex is forEachTokenFile over the count files of filesList
+// that indices yields, in increasing order
+func forEachTokenIndex(src *tokenSource, filesList []string, count int, indices iter.Seq[int],
+	fn func(worker, fileIdx int, words []int) error, progress func(done int)) error {
+	workers := cacheWorkerCount(count)
+
+	jobs := make(chan int)
+	stop := make(chan struct{})
+	var firstErr error
+	var errOnce sync.Once
+	var done atomic.Int64
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for fileIdx := range jobs {
+				words, err := src.words(fileIdx, filesList[fileIdx])
+				if err == nil {
+					if err := fn(worker, fileIdx, words); err != nil {
+						errOnce.Do(func() {
+							firstErr = err
+							close(stop)
+						})
+					}
+				}
+				n := done.Add(1)
+				if progress != nil {
+					progress(int(n))
+				}
+			}
+		}(w)
+	}
+
+feed:
+	for i := range indices {
+		select {
+		case jobs <- i:
+		case <-stop:
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return firstErr
+}
+
+// readTokenWords returns the vocabulary indices of a token file's words,
+// skipping words not in the vocabulary. Like the single-threaded builders it
+// keeps what was read before an over-long line. With breaks, a sentenceBreak
+// separates the words of consecutive lines.
+func readTokenWords(path string, wordToIndex map[string]int, breaks bool) ([]int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var words []int
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	for scanner.Scan() {
+		newLine := breaks && len(words) > 0
+		for _, word := range tokenWords(scanner.Text()) {
+			if idx, ok := wordToIndex[strings.TrimSpace(word)]; ok {
+				if newLine {
+					words = append(words, sentenceBreak)
+					newLine = false
+				}
+				words = append(words, idx)
+			}
+		}
+	}
+	return words, nil
+}
+
+// bitmapIndices yields the file indices of a bitmap, for forEachTokenIndex
+func bitmapIndices(files *roaring.Bitmap) iter.Seq[int] {
+	return func(yield func(int) bool) {
+		it := files.Iterator()
+		for it.HasNext() {
+			if !yield(int(it.Next())) {
+				return
+			}
+		}
+	}
+}
+
+// fileSet returns the indices of files below count, or all count of them
+// when files is nil
+func fileSet(files *roaring.Bitmap, count int) *roaring.Bitmap {
+	set := roaring.New()
+	set.AddRange(0, uint64(count))
+	if files != nil {
+		set.And(files)
+	}
+	return set
+}
@@ -0,0 +1,178 @@
+package pkg
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// xpsReference is a DocumentReference (.fdseq) or PageContent (.fdoc) entry
+type xpsReference struct {
+	Source string `xml:"Source,attr"`
+}
+
+type xpsDocumentSequence struct {
+	Documents []xpsReference `xml:"DocumentReference"`
+}
+
+type xpsFixedDocument struct {
+	Pages []xpsReference `xml:"PageContent"`
+}
+
+// extractXPS reads the Glyphs runs of each FixedPage in document order and
+// returns one page per FixedPage
+func extractXPS(src source) (*ExtractionResult, error) {
+	r, err := zip.NewReader(src.r, src.size)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]*zip.File, len(r.File))
+	for _, f := range r.File {
+		files[strings.ToLower(f.Name)] = f
+	}
+	lookup := func(name string) *zip.File {
+		return files[strings.ToLower(strings.TrimPrefix(name, "/"))]
+	}
+
+	pagePaths := xpsPageOrder(r, lookup)
+
+	var pages []string
+	var fullTextBuilder strings.Builder
+	for _, p := range pagePaths {
+		if src.cfg.limits.pageLimitReached(len(pages)) {
+			break
+		}
+		f := lookup(p)
+		if f == nil {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			continue
+		}
+		text, err := xpsPageText(rc)
+		rc.Close()
+		if err != nil || strings.TrimSpace(text) == "" {
+			continue
+		}
+		pages = append(pages, text)
+		fullTextBuilder.WriteString(text)
+		fullTextBuilder.WriteString("\n")
+	}
+
+	res := &ExtractionResult{
+		FullText: fullTextBuilder.String(),
+		Pages:    pages,
+	}
+	res.mergeMeta(readOOXMLMetadata(src))
+	return res, nil
+}
+
+// xpsPageOrder follows FixedDocumentSequence -> FixedDocument -> PageContent.
+// Packages without a readable sequence fall back to every .fpage in name order.
+func xpsPageOrder(r *zip.Reader, lookup func(string) *zip.File) []string {
+	var seqPath string
+	for _, f := range r.File {
+		if strings.HasSuffix(strings.ToLower(f.Name), ".fdseq") {
+			seqPath = f.Name
+			break
+		}
+	}
+
+	var pagePaths []string
+	var seq xpsDocumentSequence
+	if seqPath != "" && decodeZipXML(lookup(seqPath), &seq) == nil {
+		for _, docRef := range seq.Documents {
+			docPath := xpsResolve(seqPath, docRef.Source)
+			var doc xpsFixedDocument
+			if decodeZipXML(lookup(docPath), &doc) != nil {
+				continue
+			}
+			for _, pageRef := range doc.Pages {
+				pagePaths = append(pagePaths, xpsResolve(docPath, pageRef.Source))
+			}
+		}
+	}
+	if len(pagePaths) > 0 {
+		return pagePaths
+	}
+
+	for _, f := range r.File {
+		if strings.HasSuffix(strings.ToLower(f.Name), ".fpage") {
+			pagePaths = append(pagePaths, f.Name)
+		}
+	}
+	// Pages/2.fpage must sort before Pages/10.fpage
+	sort.Slice(pagePaths, func(i, j int) bool {
+		ni, ei := xpsPageNumber(pagePaths[i])
+		nj, ej := xpsPageNumber(pagePaths[j])
+		if ei == nil && ej == nil && path.Dir(pagePaths[i]) == path.Dir(pagePaths[j]) {
+			return ni < nj
+		}
+		return pagePaths[i] < pagePaths[j]
+	})
+	return pagePaths
+}
+
+func xpsPageNumber(p string) (int, error) {
+	return strconv.Atoi(strings.TrimSuffix(path.Base(p), path.Ext(p)))
+}
+
+// xpsResolve resolves a part reference relative to the part that contains it
+func xpsResolve(from, ref string) string {
+	if strings.HasPrefix(ref, "/") {
+		return strings.TrimPrefix(ref, "/")
+	}
+	return path.Join(path.Dir(from), ref)
+}
+
+// xpsPageText concatenates the UnicodeString of each Glyphs element, starting
+// a new line whenever the baseline (OriginY) changes
+func xpsPageText(r io.Reader) (string, error) {
+	dec := xml.NewDecoder(r)
+	var sb strings.Builder
+	lastY := ""
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return sb.String(), err
+		}
+		el, ok := tok.(xml.StartElement)
+		if !ok || el.Name.Local != "Glyphs" {
+			continue
+		}
+
+		var text, y string
+		for _, a := range el.Attr {
+			switch a.Name.Local {
+			case "UnicodeString":
+				text = a.Value
+			case "OriginY":
+				y = a.Value
+			}
+		}
+		// A leading "{}" escapes text that itself starts with "{"
+		text = strings.TrimPrefix(text, "{}")
+		if text == "" {
+			continue
+		}
+		if sb.Len() > 0 {
+			if y != lastY {
+				sb.WriteString("\n")
+			} else {
+				sb.WriteString(" ")
+			}
+		}
+		sb.WriteString(text)
+		lastY = y
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,266 @@
+package pkg
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+)
+
+// rankStep is the ratio between consecutive ranks of the rank-frequency
+// curve once it exceeds one, which keeps a few hundred points of it however
+// large the vocabulary
+const rankStep = 1.05
+
+// ZipfStats describe how the words and n-grams of a cache are distributed:
+// the rank-frequency curve of the words with its Zipf fit, the growth of the
+// vocabulary with its Heaps fit, and how often the n-grams of each size occur
+type ZipfStats struct {
+	Tokens        int64               `json:"tokens"`
+	Vocabulary    int                 `json:"vocabulary"`
+	RankFrequency []RankPoint         `json:"rankFrequency"`
+	Zipf          PowerFit            `json:"zipf"` // count ≈ coefficient × rank^-exponent
+	Growth        []GrowthPoint       `json:"growth"`
+	Heaps         PowerFit            `json:"heaps"` // vocabulary ≈ coefficient × tokens^exponent
+	Ngrams        []NgramDistribution `json:"ngrams"`
+}
+
+// RankPoint is the word of a rank of the rank-frequency curve, 1 for the most
+// frequent, with its number of occurrences
+type RankPoint struct {
+	Rank  int    `json:"rank"`
+	Word  string `json:"word"`
+	Count int64  `json:"count"`
+}
+
+// PowerFit is a least-squares fit of y = Coefficient × x^Exponent on a
+// log-log scale; R2 is its coefficient of determination there
+type PowerFit struct {
+	Coefficient float64 `json:"coefficient"`
+	Exponent    float64 `json:"exponent"`
+	R2          float64 `json:"r2"`
+}
+
+// NgramDistribution counts the n-grams of size N by how often they occur.
+// Source is the file counted: {n}gramcounts.txt has every n-gram, while
+// {n}gramfreq.txt leaves out those below -min-count.
+type NgramDistribution struct {
+	N        int           `json:"n"`
+	Source   string        `json:"source"`
+	Distinct int64         `json:"distinct"`
+	Total    int64         `json:"total"`   // occurrences of all of them
+	Singles  int64         `json:"singles"` // n-grams occurring once
+	Buckets  []CountBucket `json:"buckets"`
+}
+
+// CountBucket is the number of n-grams occurring Min to Max times; the
+// buckets double in width
+type CountBucket struct {
+	Min    int64 `json:"min"`
+	Max    int64 `json:"max"`
+	Ngrams int64 `json:"ngrams"`
+}
+
+// ZipfStatistics gathers the ZipfStats of a cache for n-grams up to maxN. The
+// word counts come from tfidf.txt and the vocabulary growth from stats.json;
+// without either (-cache tfidf, -cache stats) the files are read from docs/
+// or the token files, and progress is called after each, from the reading
+// goroutines, with the files done and to read. An error from it stops the
+// scan and is returned.
+func ZipfStatistics(cacheDir string, maxN int, progress func(done, total int) error) (*ZipfStats, error) {
+	words, err := readLines(filepath.Join(cacheDir, "uniq.txt"))
+	if err != nil {
+		return nil, fmt.Errorf("could not read uniq.txt: %w", err)
+	}
+
+	tf := make([]int64, len(words))
+	terms, termsErr := LoadTermStats(cacheDir)
+	for _, s := range terms {
+		if s.Word >= 0 && s.Word < len(words) {
+			tf[s.Word] = s.TF
+		}
+	}
+	corpus, corpusErr := LoadCorpusStats(cacheDir)
+	if termsErr != nil || corpusErr != nil {
+		if corpus, err = countWords(cacheDir, words, tf, progress); err != nil {
+			return nil, err
+		}
+	}
+
+	stats := &ZipfStats{Vocabulary: len(words), RankFrequency: []RankPoint{}, Growth: corpus.Growth, Ngrams: []NgramDistribution{}}
+	ranked := make([]int, 0, len(words))
+	for id, c := range tf {
+		stats.Tokens += c
+		if c > 0 {
+			ranked = append(ranked, id)
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool { return tf[ranked[i]] > tf[ranked[j]] })
+
+	var xs, ys []float64
+	addRank := func(r int) {
+		id := ranked[r-1]
+		stats.RankFrequency = append(stats.RankFrequency, RankPoint{Rank: r, Word: words[id], Count: tf[id]})
+		xs = append(xs, float64(r))
+		ys = append(ys, float64(tf[id]))
+	}
+	last := 0
+	for r := 1; r <= len(ranked); r = max(r+1, int(float64(r)*rankStep)) {
+		addRank(r)
+		last = r
+	}
+	if last < len(ranked) {
+		addRank(len(ranked))
+	}
+	stats.Zipf = fitPowerLaw(xs, ys)
+	stats.Zipf.Exponent = -stats.Zipf.Exponent
+
+	xs, ys = xs[:0], ys[:0]
+	for _, g := range stats.Growth {
+		if g.Tokens > 0 && g.Vocabulary > 0 {
+			xs = append(xs, float64(g.Tokens))
+			ys = append(ys, float64(g.Vocabulary))
+		}
+	}
+	stats.Heaps = fitPowerLaw(xs, ys)
+
+	for n := 2; n <= maxN; n++ {
+		d, err := ngramDistribution(cacheDir, n)
+		if err != nil {
+			return nil, err
+		}
+		if d != nil {
+			stats.Ngrams = append(stats.Ngrams, *d)
+		}
+	}
+	return stats, nil
+}
+
+// countWords reads every file of a cache, filling tf with the occurrences of
+// each word, and returns its CorpusStats as BuildStatsCache would
+func countWords(cacheDir string, words []string, tf []int64, progress func(done, total int) error) (*CorpusStats, error) {
+	filesList, err := readLines(filepath.Join(cacheDir, "files.txt"))
+	if err != nil {
+		return nil, fmt.Errorf("could not read files.txt: %w", err)
+	}
+	src := newTokenSource(cacheDir, readCacheInput(cacheDir), indexWords(words))
+	if src.cacheDir == "" && src.inputDir == "" {
+		return nil, fmt.Errorf("no tfidf.txt and stats.json (-cache tfidf, -cache stats), word IDs (-cache docs) or token directory in settings.txt")
+	}
+
+	tokens := make([]int, len(filesList))
+	firstFile := make([]int32, len(words))
+	for i := range firstFile {
+		firstFile[i] = math.MaxInt32
+	}
+	counts := make([]atomic.Int64, len(words))
+	var done atomic.Int64
+	all := fileSet(nil, len(filesList))
+	err = forEachTokenIndex(src, filesList, len(filesList), bitmapIndices(all), func(worker, fileIdx int, ids []int) error {
+		for _, id := range ids {
+			if id < 0 || id >= len(words) {
+				continue
+			}
+			counts[id].Add(1)
+			for {
+				cur := atomic.LoadInt32(&firstFile[id])
+				if int32(fileIdx) >= cur || atomic.CompareAndSwapInt32(&firstFile[id], cur, int32(fileIdx)) {
+					break
+				}
+			}
+		}
+		tokens[fileIdx] = len(ids)
+		if progress != nil {
+			return progress(int(done.Add(1)), len(filesList))
+		}
+		return nil
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	for id := range counts {
+		tf[id] = counts[id].Load()
+	}
+	return corpusStats(tokens, firstFile), nil
+}
+
+// ngramDistribution counts the n-grams of size n by occurrences from
+// {n}gramcounts.txt, or {n}gramfreq.txt without it; nil if neither exists
+func ngramDistribution(cacheDir string, n int) (*NgramDistribution, error) {
+	var path string
+	for _, pattern := range []string{"%dgramcounts.txt", "%dgramfreq.txt"} {
+		if p := filepath.Join(cacheDir, fmt.Sprintf(pattern, n)); CacheFileExists(p) {
+			path = p
+			break
+		}
+	}
+	if path == "" {
+		return nil, nil
+	}
+
+	d := &NgramDistribution{N: n, Source: filepath.Base(path)}
+	var buckets []int64
+	err := scanFreqFile(path, func(key string, count int) {
+		if count <= 0 {
+			return
+		}
+		d.Distinct++
+		d.Total += int64(count)
+		if count == 1 {
+			d.Singles++
+		}
+		b := 0
+		for c := count; c > 1; c >>= 1 {
+			b++
+		}
+		for len(buckets) <= b {
+			buckets = append(buckets, 0)
+		}
+		buckets[b]++
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %w", d.Source, err)
+	}
+	d.Buckets = make([]CountBucket, len(buckets))
+	for b, ngrams := range buckets {
+		d.Buckets[b] = CountBucket{Min: 1 << b, Max: 1<<(b+1) - 1, Ngrams: ngrams}
+	}
+	return d, nil
+}
+
+// fitPowerLaw fits y = c × x^e by least squares on the logarithms of the
+// points, which must be positive
+func fitPowerLaw(xs, ys []float64) PowerFit {
+	if len(xs) < 2 {
+		return PowerFit{}
+	}
+	var sx, sy, sxx, sxy float64
+	for i := range xs {
+		x, y := math.Log(xs[i]), math.Log(ys[i])
+		sx += x
+		sy += y
+		sxx += x * x
+		sxy += x * y
+	}
+	n := float64(len(xs))
+	denom := n*sxx - sx*sx
+	if denom == 0 {
+		return PowerFit{}
+	}
+	e := (n*sxy - sx*sy) / denom
+	a := (sy - e*sx) / n
+
+	var ssRes, ssTot float64
+	mean := sy / n
+	for i := range xs {
+		x, y := math.Log(xs[i]), math.Log(ys[i])
+		ssRes += (y - a - e*x) * (y - a - e*x)
+		ssTot += (y - mean) * (y - mean)
+	}
+	fit := PowerFit{Coefficient: math.Exp(a), Exponent: e}
+	if ssTot > 0 {
+		fit.R2 = 1 - ssRes/ssTot
+	}
+	return fit
+}